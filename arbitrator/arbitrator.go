@@ -12,8 +12,6 @@ package arbitrator
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -22,6 +20,7 @@ import (
 	"github.com/signal18/replication-manager/cluster"
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/server"
+	"github.com/signal18/replication-manager/utils/arbitration"
 	"github.com/signal18/replication-manager/utils/dbhelper"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -81,15 +80,34 @@ var rs = routes{
 	},
 	route{
 		"Forget",
-		"PST",
+		"POST",
 		"/forget/",
 		handlerForget,
 	},
-}
-
-type response struct {
-	Arbitration   string `json:"arbitration"`
-	ElectedMaster string `json:"master"`
+	route{
+		"Vote",
+		"POST",
+		"/vote",
+		handlerVote,
+	},
+	route{
+		"Decide",
+		"POST",
+		"/decide",
+		handlerDecide,
+	},
+	route{
+		"Leases",
+		"GET",
+		"/leases",
+		handlerLeases,
+	},
+	route{
+		"Decisions",
+		"GET",
+		"/decisions",
+		handlerDecisions,
+	},
 }
 
 var (
@@ -101,6 +119,8 @@ func init() {
 	rootCmd.AddCommand(arbitratorCmd)
 	arbitratorCmd.Flags().StringVar(&conf.ArbitratorAddress, "arbitrator-bind-address", "0.0.0.0:10001", "Arbitrator API port")
 	arbitratorCmd.Flags().StringVar(&conf.ArbitratorDriver, "arbitrator-driver", "sqlite", "sqlite|mysql, use a local sqllite or use a mysql backend")
+	arbitratorCmd.Flags().StringVar(&conf.ArbitratorPeers, "arbitrator-peers", "", "Other arbitrators of the quorum host:port, elections need a majority of all arbitrators")
+	arbitratorCmd.Flags().StringVar(&conf.ArbitrationSasSecret, "arbitration-external-secret", "", "Secrets of the monitor groups allowed to request arbitration, comma separated")
 
 }
 
@@ -136,8 +156,11 @@ var arbitratorCmd = &cobra.Command{
 		if err != nil {
 			log.WithError(err).Error("Error creating tables")
 		}
+		if RepMan.Confs["arbitrator"].ArbitrationSasSecret == "" {
+			log.Fatal("Arbitrator requires arbitration-external-secret to authenticate requests")
+		}
 		router := newRouter()
-		log.Infof("Arbitrator listening on %s", RepMan.Confs["arbitrator"].ArbitratorAddress)
+		log.Infof("Arbitrator listening on %s, quorum %d of %d", RepMan.Confs["arbitrator"].ArbitratorAddress, arbitration.Quorum(len(getArbitratorPeers())+1), len(getArbitratorPeers())+1)
 		log.Fatal(http.ListenAndServe(RepMan.Confs["arbitrator"].ArbitratorAddress, router))
 	},
 }
@@ -156,92 +179,57 @@ func getArbitratorBackendStorageConnection() (*sqlx.DB, error) {
 }
 
 func handlerArbitrator(w http.ResponseWriter, r *http.Request) {
-	var h server.Heartbeat
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
-	if err != nil {
-		log.Errorln(err)
-		w.WriteHeader(500)
+	h, body, secret, ok := readSignedRequest(w, r)
+	if !ok {
 		return
 	}
-	if err := r.Body.Close(); err != nil {
-		log.Errorln(err)
-		w.WriteHeader(500)
+	if r.Header.Get(arbitration.ConstHeaderPeer) != "" {
+		http.Error(w, "Peers request votes on /vote", 400)
 		return
 	}
-	log.Info("Arbitration request received: ", string(body))
-	if err := json.Unmarshal(body, &h); err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(422) // unprocessable entity
-		if err = json.NewEncoder(w).Encode(err); err != nil {
-			log.Errorln(err)
-			w.WriteHeader(500)
-		}
-	}
-	var send response
-
+	log.Infof("Arbitration request received from %d for cluster %s master %s", h.UID, h.Cluster, h.Master)
 	db, err := getArbitratorBackendStorageConnection()
 	if err != nil {
-		arbitratorCluster.LogPrintf("ERROR", "Error opening arbitrator database: %s", err)
+		log.Errorf("Error opening arbitrator database: %s", err)
+		w.WriteHeader(500)
 		return
 	}
 	defer db.Close()
-	res := dbhelper.RequestArbitration(db, h.UUID, h.Secret, h.Cluster, h.Master, h.UID, h.Hosts, h.Failed)
-	electedmaster := dbhelper.GetArbitrationMaster(db, h.Secret, h.Cluster)
-	if res {
-		send.Arbitration = "winner"
-		send.ElectedMaster = electedmaster
-	} else {
-		send.Arbitration = "looser"
-		send.ElectedMaster = electedmaster
-	}
+	group := arbitration.GroupKey(secret)
+	send := electQuorum(db, h, body, secret)
+	send.Master = dbhelper.GetArbitrationMaster(db, group, h.Cluster)
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusCreated)
-
 	if err := json.NewEncoder(w).Encode(send); err != nil {
-		panic(err)
+		log.Errorln(err)
 	}
-
 }
-func handlerHeartbeat(w http.ResponseWriter, r *http.Request) {
-	var h server.Heartbeat
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
 
-	if err != nil {
-		panic(err)
-	}
-	//log.Printf("INFO: Hearbeat receive:%s", string(body))
-	if err = r.Body.Close(); err != nil {
-		w.WriteHeader(500)
-		log.Errorln(err)
-		return
-	}
-	if err = json.Unmarshal(body, &h); err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(422) // unprocessable entity
-		if err = json.NewEncoder(w).Encode(err); err != nil {
-			w.WriteHeader(500)
-			log.Errorln(err)
-			return
-		}
+func handlerHeartbeat(w http.ResponseWriter, r *http.Request) {
+	h, body, secret, ok := readSignedRequest(w, r)
+	if !ok {
 		return
 	}
-
 	var send string
 	db, err := getArbitratorBackendStorageConnection()
 	if err != nil {
-		arbitratorCluster.LogPrintf("ERROR", "Error opening arbitrator database: %s", err)
 		w.WriteHeader(500)
-		log.Errorln(err)
+		log.Errorf("Error opening arbitrator database: %s", err)
 		return
 	}
 	defer db.Close()
-	res := dbhelper.WriteHeartbeat(db, h.UUID, h.Secret, h.Cluster, h.Master, h.UID, h.Hosts, h.Failed)
+	res := dbhelper.WriteHeartbeat(db, h.UUID, arbitration.GroupKey(secret), h.Cluster, h.Master, h.UID, h.Hosts, h.Failed)
 	if res == nil {
 		send = `{"heartbeat":"succed"}`
 	} else {
 		log.Error("Error writing heartbeat, reason: ", res)
 		send = `{"heartbeat":"failed"}`
 	}
+	// every quorum member needs the heartbeats to vote
+	if r.Header.Get(arbitration.ConstHeaderPeer) == "" {
+		go forwardPeers(secret, h.UID, "/heartbeat", body)
+	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	if err := json.NewEncoder(w).Encode(send); err != nil {
@@ -253,47 +241,27 @@ func handlerHeartbeat(w http.ResponseWriter, r *http.Request) {
 }
 
 func handlerForget(w http.ResponseWriter, r *http.Request) {
-	var h server.Heartbeat
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
-
-	if err != nil {
-		w.WriteHeader(500)
-		log.Errorln(err)
-		return
-	}
-	//log.Printf("INFO: Hearbeat receive:%s", string(body))
-	if err = r.Body.Close(); err != nil {
-		w.WriteHeader(500)
-		log.Errorln(err)
+	h, body, secret, ok := readSignedRequest(w, r)
+	if !ok {
 		return
 	}
-	if err = json.Unmarshal(body, &h); err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(422) // unprocessable entity
-		if err = json.NewEncoder(w).Encode(err); err != nil {
-			w.WriteHeader(500)
-			log.Errorln(err)
-			return
-		}
-		return
-	}
-
-	//	currentCluster := new(cluster.Cluster)
 	var send string
 	db, err := getArbitratorBackendStorageConnection()
 	if err != nil {
-		arbitratorCluster.LogPrintf("ERROR", "Error opening arbitrator database: %s", err)
 		w.WriteHeader(500)
-		log.Errorln(err)
+		log.Errorf("Error opening arbitrator database: %s", err)
 		return
 	}
 	defer db.Close()
-	res := dbhelper.ForgetArbitration(db, h.Secret)
+	res := dbhelper.ForgetArbitration(db, arbitration.GroupKey(secret))
 	if res == nil {
 		send = `{"heartbeat":"succed"}`
 	} else {
 		send = `{"heartbeat":"failed"}`
 	}
+	if r.Header.Get(arbitration.ConstHeaderPeer) == "" {
+		go forwardPeers(secret, h.UID, "/forget/", body)
+	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 	if err := json.NewEncoder(w).Encode(send); err != nil {
@@ -0,0 +1,345 @@
+//go:build arbitrator
+// +build arbitrator
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package arbitrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/arbitration"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	log "github.com/sirupsen/logrus"
+)
+
+// signatureWindow is the clock skew accepted between monitors and arbitrators
+const signatureWindow = 30 * time.Second
+
+// peerTimeout keep a quorum election within the monitor read timeout
+const peerTimeout = 500 * time.Millisecond
+
+var (
+	// arbitrationNonces refuse the replay of a signed request in the window
+	arbitrationNonces = arbitration.NewNonceCache(signatureWindow)
+	// peerVotes keep the votes given to the peers until their decision
+	peerVotes = newVoteRecords()
+)
+
+// voteRecords are the votes this node gave to the elections coordinated by a
+// peer, a decision is only applied for an election this node voted in
+type voteRecords struct {
+	sync.Mutex
+	votes map[string]voteRecord
+}
+
+type voteRecord struct {
+	granted bool
+	date    time.Time
+}
+
+func newVoteRecords() *voteRecords {
+	return &voteRecords{votes: make(map[string]voteRecord)}
+}
+
+func getVoteKey(group string, h arbitration.Request) string {
+	return fmt.Sprintf("%s/%s/%d/%s/%s", group, h.Cluster, h.UID, h.UUID, h.Master)
+}
+
+func (v *voteRecords) add(group string, h arbitration.Request, granted bool, now time.Time) {
+	v.Lock()
+	defer v.Unlock()
+	for k, r := range v.votes {
+		if now.Sub(r.date) > signatureWindow {
+			delete(v.votes, k)
+		}
+	}
+	v.votes[getVoteKey(group, h)] = voteRecord{granted: granted, date: now}
+}
+
+// take return the vote given to the election and forget it, a decision is
+// applied once
+func (v *voteRecords) take(group string, h arbitration.Request, now time.Time) (voteRecord, bool) {
+	v.Lock()
+	defer v.Unlock()
+	key := getVoteKey(group, h)
+	r, ok := v.votes[key]
+	delete(v.votes, key)
+	if ok && now.Sub(r.date) > signatureWindow {
+		return r, false
+	}
+	return r, ok
+}
+
+func getArbitratorPeers() []string {
+	var peers []string
+	for _, peer := range strings.Split(RepMan.Confs["arbitrator"].ArbitratorPeers, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// readSignedRequest authenticate the request and decode its payload, the
+// secret that signed it select the arbitration group
+func readSignedRequest(w http.ResponseWriter, r *http.Request) (arbitration.Request, []byte, string, bool) {
+	var h arbitration.Request
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		log.Errorln(err)
+		w.WriteHeader(500)
+		return h, nil, "", false
+	}
+	r.Body.Close()
+	secret, err := arbitration.Verify(r, RepMan.Confs["arbitrator"].ArbitrationSasSecret, body, time.Now(), signatureWindow, arbitrationNonces)
+	if err != nil {
+		log.Warnf("Refused request %s from %s: %s", r.URL.Path, r.RemoteAddr, err)
+		http.Error(w, err.Error(), 401)
+		return h, nil, "", false
+	}
+	if len(body) == 0 {
+		return h, body, secret, true
+	}
+	if err = json.Unmarshal(body, &h); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		json.NewEncoder(w).Encode(err)
+		return h, nil, "", false
+	}
+	return h, body, secret, true
+}
+
+func newPeerClient(secret string, id int) *arbitration.Client {
+	c := arbitration.NewClient(RepMan.Confs["arbitrator"].ArbitratorPeers, id, secret, peerTimeout)
+	c.Peer = true
+	return c
+}
+
+// forwardPeers send a request to every peer and return the answers of the
+// peers that responded
+func forwardPeers(secret string, id int, path string, body []byte) map[string][]byte {
+	c := newPeerClient(secret, id)
+	return postPeers(c, c.Hosts, path, body)
+}
+
+func postPeers(c *arbitration.Client, peers []string, path string, body []byte) map[string][]byte {
+	answers := make(map[string][]byte)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			content, err := c.PostHost(peer, path, body)
+			if err != nil {
+				log.Warnf("Arbitrator peer %s %s: %s", peer, path, err)
+				return
+			}
+			mu.Lock()
+			answers[peer] = content
+			mu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+	return answers
+}
+
+// electQuorum vote locally and ask the peers, the monitor wins only with the
+// votes of a majority of all arbitrators. The decision is sent to the peers
+// that voted so that the losing votes are released and they keep the history.
+func electQuorum(db *sqlx.DB, h arbitration.Request, body []byte, secret string) arbitration.Response {
+	group := arbitration.GroupKey(secret)
+	quorum := arbitration.Quorum(len(getArbitratorPeers()) + 1)
+	votes := 0
+	local := dbhelper.RequestArbitration(db, h.UUID, group, h.Cluster, h.Master, h.UID, h.Hosts, h.Failed)
+	if local {
+		votes++
+	}
+	c := newPeerClient(secret, h.UID)
+	var voters []string
+	for peer, content := range postPeers(c, c.Hosts, "/vote", body) {
+		var v arbitration.Vote
+		if err := json.Unmarshal(content, &v); err != nil {
+			log.Warnf("Arbitrator peer %s sent invalid vote: %s", peer, err)
+			continue
+		}
+		voters = append(voters, peer)
+		if v.Granted {
+			votes++
+		}
+	}
+	d := arbitration.Decision{Request: h, Winner: votes >= quorum, Votes: votes, Quorum: quorum}
+	applyDecision(db, group, d, local)
+	content, _ := json.Marshal(d)
+	postPeers(c, voters, "/decide", content)
+
+	send := arbitration.Response{Arbitration: "looser", Votes: votes, Quorum: quorum}
+	if d.Winner {
+		send.Arbitration = "winner"
+	}
+	log.Infof("Arbitration %s for %d on cluster %s with %d votes of quorum %d", send.Arbitration, h.UID, h.Cluster, votes, quorum)
+	return send
+}
+
+func applyDecision(db *sqlx.DB, group string, d arbitration.Decision, granted bool) {
+	h := d.Request
+	var err error
+	if d.Winner {
+		err = dbhelper.SetArbitrationWinner(db, group, h.Cluster, h.UID, h.UUID, h.Master)
+	} else if granted {
+		err = dbhelper.ReleaseArbitration(db, group, h.Cluster, h.UID)
+	}
+	if err != nil {
+		log.Errorf("Error applying arbitration decision: %s", err)
+	}
+	err = dbhelper.WriteArbitrationDecision(db, group, h.Cluster, h.UID, h.UUID, h.Master, d.Winner, d.Votes, d.Quorum)
+	if err != nil {
+		log.Errorf("Error writing arbitration decision: %s", err)
+	}
+}
+
+func handlerVote(w http.ResponseWriter, r *http.Request) {
+	h, _, secret, ok := readSignedRequest(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get(arbitration.ConstHeaderPeer) == "" {
+		http.Error(w, "Only arbitrator peers can request a vote", 403)
+		return
+	}
+	db, err := getArbitratorBackendStorageConnection()
+	if err != nil {
+		log.Errorf("Error opening arbitrator database: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	defer db.Close()
+	group := arbitration.GroupKey(secret)
+	v := arbitration.Vote{Granted: dbhelper.RequestArbitration(db, h.UUID, group, h.Cluster, h.Master, h.UID, h.Hosts, h.Failed)}
+	peerVotes.add(group, h, v.Granted, time.Now())
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// handlerDecide apply the decision of an election coordinated by a peer, it
+// has to match the vote this node gave and a win needs this node's vote and
+// the quorum of this node
+func handlerDecide(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	if r.Header.Get(arbitration.ConstHeaderPeer) == "" {
+		http.Error(w, "Only arbitrator peers can send a decision", 403)
+		return
+	}
+	now := time.Now()
+	secret, err := arbitration.Verify(r, RepMan.Confs["arbitrator"].ArbitrationSasSecret, body, now, signatureWindow, arbitrationNonces)
+	if err != nil {
+		log.Warnf("Refused request %s from %s: %s", r.URL.Path, r.RemoteAddr, err)
+		http.Error(w, err.Error(), 401)
+		return
+	}
+	var d arbitration.Decision
+	if err = json.Unmarshal(body, &d); err != nil {
+		w.WriteHeader(422)
+		return
+	}
+	group := arbitration.GroupKey(secret)
+	vote, ok := peerVotes.take(group, d.Request, now)
+	if !ok {
+		log.Warnf("Refused decision from %s for %d on cluster %s: no vote given for this election", r.RemoteAddr, d.Request.UID, d.Request.Cluster)
+		http.Error(w, "No vote given for this election", 409)
+		return
+	}
+	if d.Winner && (!vote.granted || d.Quorum != arbitration.Quorum(len(getArbitratorPeers())+1) || d.Votes < d.Quorum) {
+		log.Warnf("Refused decision from %s for %d on cluster %s: win with %d votes of quorum %d, vote granted %t", r.RemoteAddr, d.Request.UID, d.Request.Cluster, d.Votes, d.Quorum, vote.granted)
+		http.Error(w, "Decision does not match the vote of this arbitrator", 409)
+		return
+	}
+	db, err := getArbitratorBackendStorageConnection()
+	if err != nil {
+		log.Errorf("Error opening arbitrator database: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	defer db.Close()
+	// a vote granted by this node is released when the election is lost
+	applyDecision(db, group, d, vote.granted)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write([]byte(`{"decision":"applied"}`))
+}
+
+// handlerLeases list the monitors elected in the group of the request secret
+func handlerLeases(w http.ResponseWriter, r *http.Request) {
+	_, _, secret, ok := readSignedRequest(w, r)
+	if !ok {
+		return
+	}
+	db, err := getArbitratorBackendStorageConnection()
+	if err != nil {
+		log.Errorf("Error opening arbitrator database: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	defer db.Close()
+	leases, err := dbhelper.GetArbitrationLeases(db, arbitration.GroupKey(secret))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if err := e.Encode(leases); err != nil {
+		log.Errorln(err)
+	}
+}
+
+// handlerDecisions list the last elections, filtered by cluster and limit
+func handlerDecisions(w http.ResponseWriter, r *http.Request) {
+	_, _, secret, ok := readSignedRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	db, err := getArbitratorBackendStorageConnection()
+	if err != nil {
+		log.Errorf("Error opening arbitrator database: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	defer db.Close()
+	decisions, err := dbhelper.GetArbitrationDecisions(db, arbitration.GroupKey(secret), r.URL.Query().Get("cluster"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if err := e.Encode(decisions); err != nil {
+		log.Errorln(err)
+	}
+}
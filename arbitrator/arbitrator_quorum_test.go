@@ -0,0 +1,256 @@
+//go:build arbitrator
+// +build arbitrator
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package arbitrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/server"
+	"github.com/signal18/replication-manager/utils/arbitration"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+const testSecret = "s1"
+
+// fakePeer answer the votes with granted and keep the decisions it receives,
+// a peer with a nil granted does not answer
+type fakePeer struct {
+	server    *httptest.Server
+	granted   *bool
+	mu        sync.Mutex
+	decisions []arbitration.Decision
+}
+
+func newFakePeer(t *testing.T, granted *bool) *fakePeer {
+	p := &fakePeer{granted: granted}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if _, err := arbitration.Verify(r, testSecret, body, time.Now(), signatureWindow, nil); err != nil || r.Header.Get(arbitration.ConstHeaderPeer) == "" {
+			t.Errorf("Peer received an unauthenticated request %s: %v", r.URL.Path, err)
+		}
+		switch r.URL.Path {
+		case "/vote":
+			if p.granted == nil {
+				http.Error(w, "down", 503)
+				return
+			}
+			json.NewEncoder(w).Encode(arbitration.Vote{Granted: *p.granted})
+		case "/decide":
+			var d arbitration.Decision
+			json.Unmarshal(body, &d)
+			p.mu.Lock()
+			p.decisions = append(p.decisions, d)
+			p.mu.Unlock()
+		}
+	}))
+	return p
+}
+
+func (p *fakePeer) getDecisions() []arbitration.Decision {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.decisions
+}
+
+// initTestArbitrator point the arbitrator to a fresh sqlite database and to
+// the peers
+func initTestArbitrator(t *testing.T, peers ...*fakePeer) (*sqlx.DB, func()) {
+	dir, err := ioutil.TempDir("", "arbitrator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for _, p := range peers {
+		hosts = append(hosts, p.server.Listener.Addr().String())
+	}
+	conf.WorkingDir = dir
+	RepMan = &server.ReplicationManager{Confs: map[string]config.Config{"arbitrator": {
+		ArbitratorDriver:     "sqlite",
+		ArbitrationSasSecret: testSecret,
+		ArbitratorPeers:      strings.Join(hosts, ","),
+	}}}
+	arbitrationNonces = arbitration.NewNonceCache(signatureWindow)
+	peerVotes = newVoteRecords()
+	db, err := getArbitratorBackendStorageConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbhelper.SetHeartbeatTable(db); err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		for _, p := range peers {
+			p.server.Close()
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func getTestLeader(t *testing.T, db *sqlx.DB, cluster string) int {
+	leases, err := dbhelper.GetArbitrationLeases(db, arbitration.GroupKey(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range leases {
+		if l.Cluster == cluster {
+			return l.UID
+		}
+	}
+	return 0
+}
+
+func newTestElection(uid int) (arbitration.Request, []byte) {
+	h := arbitration.Request{UUID: "uuid-1", Cluster: "cluster1", Master: "db1:3306", UID: uid, Hosts: 3}
+	body, _ := json.Marshal(h)
+	return h, body
+}
+
+func TestElectQuorum(t *testing.T) {
+	yes, no := true, false
+	voters := []*fakePeer{newFakePeer(t, &yes), newFakePeer(t, &no)}
+	db, cleanup := initTestArbitrator(t, voters...)
+	defer cleanup()
+
+	h, body := newTestElection(1)
+	send := electQuorum(db, h, body, testSecret)
+	if send.Arbitration != "winner" || send.Votes != 2 || send.Quorum != 2 {
+		t.Fatalf("Expected a win with 2 votes of quorum 2, got %+v", send)
+	}
+	if leader := getTestLeader(t, db, h.Cluster); leader != 1 {
+		t.Errorf("Expected monitor 1 elected, got %d", leader)
+	}
+	for _, p := range voters {
+		d := p.getDecisions()
+		if len(d) != 1 || !d[0].Winner || d[0].Request.UID != 1 {
+			t.Errorf("Expected the winning decision sent to every voter, got %+v", d)
+		}
+	}
+}
+
+func TestElectQuorumSplit(t *testing.T) {
+	yes, no := true, false
+	voters := []*fakePeer{newFakePeer(t, &yes), newFakePeer(t, &no), newFakePeer(t, &no)}
+	down := newFakePeer(t, nil)
+	db, cleanup := initTestArbitrator(t, append(voters, down)...)
+	defer cleanup()
+
+	// 2 votes of the 5 arbitrators, the local vote is released
+	h, body := newTestElection(1)
+	send := electQuorum(db, h, body, testSecret)
+	if send.Arbitration != "looser" || send.Votes != 2 || send.Quorum != 3 {
+		t.Fatalf("Expected a lost election with 2 votes of quorum 3, got %+v", send)
+	}
+	if leader := getTestLeader(t, db, h.Cluster); leader != 0 {
+		t.Errorf("Expected the local vote released, got leader %d", leader)
+	}
+	for _, p := range voters {
+		if d := p.getDecisions(); len(d) != 1 || d[0].Winner {
+			t.Errorf("Expected the lost decision sent to the voters, got %+v", d)
+		}
+	}
+	if d := down.getDecisions(); len(d) != 0 {
+		t.Errorf("Expected no decision sent to a peer that did not vote, got %+v", d)
+	}
+
+	// the other monitor can not win while the quorum is split
+	h, body = newTestElection(2)
+	if send := electQuorum(db, h, body, testSecret); send.Arbitration != "looser" {
+		t.Errorf("Expected the second monitor to lose, got %+v", send)
+	}
+}
+
+func postTestPeer(t *testing.T, handler http.HandlerFunc, path string, body []byte, peer bool, secret string) (*http.Request, int) {
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	if peer {
+		req.Header.Set(arbitration.ConstHeaderPeer, "true")
+	}
+	arbitration.Sign(req, 9, secret, body, time.Now())
+	return req, replayTestPeer(handler, req, body)
+}
+
+func replayTestPeer(handler http.HandlerFunc, req *http.Request, body []byte) int {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Code
+}
+
+func TestDecideForged(t *testing.T) {
+	db, cleanup := initTestArbitrator(t, newFakePeer(t, nil), newFakePeer(t, nil))
+	defer cleanup()
+
+	h, body := newTestElection(1)
+	win, _ := json.Marshal(arbitration.Decision{Request: h, Winner: true, Votes: 3, Quorum: 2})
+	if _, code := postTestPeer(t, handlerDecide, "/decide", win, false, testSecret); code != 403 {
+		t.Errorf("Expected a decision from a monitor refused, got %d", code)
+	}
+	if _, code := postTestPeer(t, handlerDecide, "/decide", win, true, "wrong"); code != 401 {
+		t.Errorf("Expected an unsigned decision refused, got %d", code)
+	}
+	if _, code := postTestPeer(t, handlerDecide, "/decide", win, true, testSecret); code != 409 {
+		t.Errorf("Expected a decision without vote refused, got %d", code)
+	}
+	if _, code := postTestPeer(t, handlerVote, "/vote", body, false, testSecret); code != 403 {
+		t.Errorf("Expected a vote asked by a monitor refused, got %d", code)
+	}
+	if _, code := postTestPeer(t, handlerVote, "/vote", body, true, testSecret); code != 200 {
+		t.Fatalf("Expected the vote granted, got %d", code)
+	}
+
+	// the decision has to match the election this node voted for
+	other := h
+	other.Master = "db2:3306"
+	forged, _ := json.Marshal(arbitration.Decision{Request: other, Winner: true, Votes: 3, Quorum: 2})
+	if _, code := postTestPeer(t, handlerDecide, "/decide", forged, true, testSecret); code != 409 {
+		t.Errorf("Expected a decision for another master refused, got %d", code)
+	}
+	short, _ := json.Marshal(arbitration.Decision{Request: h, Winner: true, Votes: 1, Quorum: 1})
+	if _, code := postTestPeer(t, handlerDecide, "/decide", short, true, testSecret); code != 409 {
+		t.Errorf("Expected a win under the local quorum refused, got %d", code)
+	}
+	if _, code := postTestPeer(t, handlerVote, "/vote", body, true, testSecret); code != 200 {
+		t.Fatalf("Expected the vote granted again, got %d", code)
+	}
+	req, code := postTestPeer(t, handlerDecide, "/decide", win, true, testSecret)
+	if code != 200 {
+		t.Fatalf("Expected the matching decision applied, got %d", code)
+	}
+	if leader := getTestLeader(t, db, h.Cluster); leader != 1 {
+		t.Errorf("Expected monitor 1 elected, got %d", leader)
+	}
+	if code := replayTestPeer(handlerDecide, req, win); code != 401 {
+		t.Errorf("Expected a replayed decision refused, got %d", code)
+	}
+
+	// a win of another monitor is refused by a node that did not grant it
+	h2, body2 := newTestElection(2)
+	if _, code := postTestPeer(t, handlerVote, "/vote", body2, true, testSecret); code != 200 {
+		t.Fatalf("Expected the vote answered, got %d", code)
+	}
+	win2, _ := json.Marshal(arbitration.Decision{Request: h2, Winner: true, Votes: 2, Quorum: 2})
+	if _, code := postTestPeer(t, handlerDecide, "/decide", win2, true, testSecret); code != 409 {
+		t.Errorf("Expected a win without the local vote refused, got %d", code)
+	}
+	if leader := getTestLeader(t, db, h.Cluster); leader != 1 {
+		t.Errorf("Expected monitor 1 to stay elected, got %d", leader)
+	}
+}
@@ -0,0 +1,126 @@
+//go:build clients
+// +build clients
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	cliBackupShow     string
+	cliBackupDelete   string
+	cliBackupDownload string
+	cliBackupOutput   string
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Browse the backup catalog",
+	Long:  `The backup command list the backups of a cluster, show, delete or download one of them`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cliInit(true)
+		urlcatalog := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/backups/catalog"
+		var err error
+		switch {
+		case cliBackupDownload != "":
+			err = cliBackupDownloadFile(urlcatalog + "/" + cliBackupDownload + "/actions/download")
+		case cliBackupDelete != "":
+			_, err = cliAPICmd(urlcatalog+"/"+cliBackupDelete+"/actions/delete", nil)
+			if err == nil {
+				fmt.Printf("Backup %s deleted\n", cliBackupDelete)
+			}
+		case cliBackupShow != "":
+			var res string
+			res, err = cliAPICmd(urlcatalog+"/"+cliBackupShow, nil)
+			if err == nil {
+				fmt.Println(res)
+			}
+		default:
+			err = cliBackupList(urlcatalog)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func initBackupFlags(cmd *cobra.Command) {
+	initServerApiFlags(backupCmd)
+	backupCmd.Flags().StringVar(&cliBackupShow, "show", "", "Show the backup with this id")
+	backupCmd.Flags().StringVar(&cliBackupDelete, "delete", "", "Delete the backup with this id")
+	backupCmd.Flags().StringVar(&cliBackupDownload, "download", "", "Download the backup with this id")
+	backupCmd.Flags().StringVar(&cliBackupOutput, "output", "", "File to download the backup to, default is the name sent by the server")
+	viper.BindPFlags(cmd.Flags())
+}
+
+func cliBackupList(urlcatalog string) error {
+	res, err := cliAPICmd(urlcatalog, nil)
+	if err != nil {
+		return err
+	}
+	var backups []cluster.BackupCatalogEntry
+	if err := json.Unmarshal([]byte(res), &backups); err != nil {
+		return err
+	}
+	fmt.Printf("%-48s %-12s %-24s %-8s %14s %-20s %s\n", "Id", "Tool", "Source", "State", "Size", "Start", "Verification")
+	for _, b := range backups {
+		fmt.Printf("%-48s %-12s %-24s %-8s %14d %-20s %s\n", b.Id, b.Tool, b.Source, b.State, b.Size, b.Start.Local().Format("2006-01-02 15:04:05"), b.Verification)
+	}
+	return nil
+}
+
+func cliBackupDownloadFile(urlget string) error {
+	req, err := http.NewRequest("GET", urlget, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cliToken)
+	resp, err := cliConn.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(string(body))
+	}
+	output := cliBackupOutput
+	if output == "" {
+		_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		if err != nil || params["filename"] == "" {
+			return errors.New("No file name sent by the server, use --output")
+		}
+		output = params["filename"]
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to %s, %d bytes\n", output, n)
+	return nil
+}
@@ -67,6 +67,7 @@ var (
 	cliBootstrapWithProvisioning bool
 	cliExit                      bool
 	cliPrefMaster                string
+	cliDryRun                    bool
 	cliStatusErrors              bool
 	cliServerID                  string
 	cliServerMaintenance         bool
@@ -208,6 +209,7 @@ func initBootstrapFlags(cmd *cobra.Command) {
 
 func initFailoverFlags(cmd *cobra.Command) {
 	initServerApiFlags(failoverCmd)
+	failoverCmd.Flags().BoolVar(&cliDryRun, "dry-run", false, "Show the election and the actions of a failover if the master died now without running it")
 	viper.BindPFlags(cmd.Flags())
 }
 
@@ -244,6 +246,7 @@ func initConfiguratorFlags(cmd *cobra.Command) {
 func initSwitchoverFlags(cmd *cobra.Command) {
 	initServerApiFlags(switchoverCmd)
 	switchoverCmd.Flags().StringVar(&cliPrefMaster, "db-servers-prefered-master", "", "Database preferred candidate in election,  host:[port] format")
+	switchoverCmd.Flags().BoolVar(&cliDryRun, "dry-run", false, "Show the election and the actions of the switchover without running it")
 	viper.BindPFlags(cmd.Flags())
 }
 
@@ -304,6 +307,18 @@ func init() {
 	initServerFlags(serverCmd)
 	initClusterFlags(serverCmd)
 
+	rootClientCmd.AddCommand(backupCmd)
+	initBackupFlags(backupCmd)
+	initClusterFlags(backupCmd)
+
+	rootClientCmd.AddCommand(consistencyCmd)
+	initConsistencyFlags(consistencyCmd)
+	initClusterFlags(consistencyCmd)
+
+	rootClientCmd.AddCommand(indexAdvisorCmd)
+	initIndexAdvisorFlags(indexAdvisorCmd)
+	initClusterFlags(indexAdvisorCmd)
+
 	rootClientCmd.AddCommand(showCmd)
 	initShowFlags(showCmd)
 	initClusterFlags(showCmd)
@@ -604,6 +619,69 @@ func cliGetLogs() ([]string, error) {
 	return r, nil
 }
 
+func cliGetPlan(command string, params []RequetParam) (cluster.FailoverPlan, error) {
+	var r cluster.FailoverPlan
+	urlpost := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/" + command
+	var bearer = "Bearer " + cliToken
+	data := url.Values{}
+	for _, param := range params {
+		data.Add(param.key, param.value)
+	}
+	req, err := http.NewRequest("POST", urlpost, bytes.NewBuffer([]byte(data.Encode())))
+	if err != nil {
+		return r, err
+	}
+	req.Header.Set("Authorization", bearer)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := cliConn.Do(req)
+	if err != nil {
+		log.Println("ERROR on getting plan", err)
+		return r, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("ERROR on getting plan", err)
+		return r, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return r, errors.New(strings.TrimSpace(string(body)))
+	}
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		log.Println("ERROR on getting plan", err)
+		return r, err
+	}
+	return r, nil
+}
+
+func cliPrintPlan(plan cluster.FailoverPlan) {
+	fmt.Printf("%s plan for cluster %s, master %s\n", plan.Type, plan.Cluster, plan.Master)
+	fmt.Printf("Feasible: %t, candidate: %s\n\n", plan.Feasible, plan.Candidate)
+	fmt.Println("Checks:")
+	for _, c := range plan.Checks {
+		status := "OK  "
+		if !c.Passed && c.Blocking {
+			status = "FAIL"
+		} else if !c.Passed {
+			status = "WARN"
+		}
+		fmt.Printf("  [%s] %-28s %s\n", status, c.Name, c.Message)
+	}
+	fmt.Println("\nElection:")
+	for _, p := range plan.Election {
+		reasons := strings.Join(p.SkipReasons, ", ")
+		if reasons == "" {
+			reasons = "electable"
+		}
+		fmt.Printf("  %-30s seq:%d pos:%d prefered:%t %s\n", p.URL, p.Seq, p.Pos, p.Prefered, reasons)
+	}
+	fmt.Println("\nActions:")
+	for i, a := range plan.Actions {
+		fmt.Printf("  %2d. %s\n", i+1, a)
+	}
+}
+
 func cliClusterCmd(command string, params []RequetParam) error {
 	//var r string
 	urlpost := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/" + command
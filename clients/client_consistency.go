@@ -0,0 +1,144 @@
+//go:build clients
+// +build clients
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+package clients
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	cliConsistencyRepairs bool
+	cliConsistencyShow    string
+	cliConsistencyApply   string
+)
+
+var consistencyCmd = &cobra.Command{
+	Use:   "consistency",
+	Short: "Report the replica consistency check",
+	Long:  `The consistency command list the last check of every table, the repairs of mismatched chunks, show or apply one of them`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cliInit(true)
+		urlconsistency := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/consistency"
+		var err error
+		switch {
+		case cliConsistencyApply != "":
+			_, err = cliAPICmd(urlconsistency+"/repairs/"+cliConsistencyApply+"/actions/apply", nil)
+			if err == nil {
+				fmt.Printf("Repair %s applying\n", cliConsistencyApply)
+			}
+		case cliConsistencyShow != "":
+			err = cliConsistencyShowRepair(urlconsistency+"/repairs", cliConsistencyShow)
+		case cliConsistencyRepairs:
+			err = cliConsistencyListRepairs(urlconsistency + "/repairs")
+		default:
+			err = cliConsistencyList(urlconsistency)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func initConsistencyFlags(cmd *cobra.Command) {
+	initServerApiFlags(consistencyCmd)
+	consistencyCmd.Flags().BoolVar(&cliConsistencyRepairs, "repairs", false, "List the repairs of mismatched chunks")
+	consistencyCmd.Flags().StringVar(&cliConsistencyShow, "show", "", "Show the statements of the repair with this id")
+	consistencyCmd.Flags().StringVar(&cliConsistencyApply, "apply", "", "Apply the pending or failed repair with this id")
+	viper.BindPFlags(cmd.Flags())
+}
+
+func cliConsistencyList(urlconsistency string) error {
+	res, err := cliAPICmd(urlconsistency, nil)
+	if err != nil {
+		return err
+	}
+	var cc cluster.ConsistencyCheck
+	if err := json.Unmarshal([]byte(res), &cc); err != nil {
+		return err
+	}
+	status := "idle"
+	if cc.Running {
+		status = "checking " + cc.Table
+		if cc.Throttled {
+			status += " throttled"
+		}
+	}
+	fmt.Printf("Pass %d %s, started %s\n", cc.Pass, status, cc.PassStarted.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("%-48s %-6s %8s %12s %-20s %s\n", "Table", "Pass", "Chunks", "Rows", "Finished", "Result")
+	for _, t := range cc.Tables {
+		var result []string
+		if t.Error != "" {
+			result = append(result, t.Error)
+		}
+		for _, r := range t.Replicas {
+			switch {
+			case r.Error != "":
+				result = append(result, r.URL+" "+r.Error)
+			case len(r.Chunks) > 0:
+				result = append(result, fmt.Sprintf("%s %d mismatched chunks", r.URL, len(r.Chunks)))
+			}
+		}
+		if len(result) == 0 {
+			result = append(result, "ok")
+		}
+		fmt.Printf("%-48s %-6d %8d %12d %-20s %s\n", t.Schema+"."+t.Table, t.Pass, t.Chunks, t.Rows, t.Finished.Local().Format("2006-01-02 15:04:05"), strings.Join(result, ", "))
+	}
+	return nil
+}
+
+func cliConsistencyGetRepairs(urlrepairs string) ([]cluster.ConsistencyRepair, error) {
+	res, err := cliAPICmd(urlrepairs, nil)
+	if err != nil {
+		return nil, err
+	}
+	var repairs []cluster.ConsistencyRepair
+	err = json.Unmarshal([]byte(res), &repairs)
+	return repairs, err
+}
+
+func cliConsistencyListRepairs(urlrepairs string) error {
+	repairs, err := cliConsistencyGetRepairs(urlrepairs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-64s %-24s %-8s %8s %8s %-20s %s\n", "Id", "Server", "State", "Replaced", "Deleted", "Created", "Error")
+	for _, r := range repairs {
+		fmt.Printf("%-64s %-24s %-8s %8d %8d %-20s %s\n", r.Id, r.Server, r.State, r.Replaced, r.Deleted, r.Created.Local().Format("2006-01-02 15:04:05"), r.Error)
+	}
+	return nil
+}
+
+func cliConsistencyShowRepair(urlrepairs string, id string) error {
+	repairs, err := cliConsistencyGetRepairs(urlrepairs)
+	if err != nil {
+		return err
+	}
+	for _, r := range repairs {
+		if r.Id != id {
+			continue
+		}
+		fmt.Printf("-- %s.%s chunk %d on %s, %s\n", r.Schema, r.Table, r.Chunk, r.Server, r.State)
+		for _, s := range r.Statements {
+			fmt.Println(s + ";")
+		}
+		if r.Truncated {
+			fmt.Printf("-- %d statements not shown\n", r.Replaced+r.Deleted-len(r.Statements))
+		}
+		return nil
+	}
+	return fmt.Errorf("Repair %s not found", id)
+}
@@ -9,6 +9,7 @@
 package clients
 
 import (
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +20,14 @@ var failoverCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		var slogs []string
 		cliInit(true)
+		if cliDryRun {
+			plan, err := cliGetPlan("actions/failover/plan", nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			cliPrintPlan(plan)
+			return
+		}
 		cliGetTopology()
 		cliClusterCmd("actions/failover", nil)
 		slogs, _ = cliGetLogs()
@@ -0,0 +1,113 @@
+//go:build clients
+// +build clients
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+package clients
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	cliIndexAdvisorShow  string
+	cliIndexAdvisorApply string
+)
+
+var indexAdvisorCmd = &cobra.Command{
+	Use:   "index-advisor",
+	Short: "Suggest indexes from the captured slow queries",
+	Long:  `The index-advisor command list the missing and redundant indexes found from the slow queries captured on a server, show the DDL of an advice or apply it as a rolling schema change validated on a replica`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cliInit(true)
+		if cliServerID == "" {
+			fmt.Fprintf(os.Stderr, "The index-advisor command needs a server id\n")
+			os.Exit(1)
+		}
+		urladvisor := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/servers/" + cliServerID + "/index-advisor"
+		var err error
+		switch {
+		case cliIndexAdvisorApply != "":
+			err = cliIndexAdvisorApplyAdvice(urladvisor, cliIndexAdvisorApply)
+		case cliIndexAdvisorShow != "":
+			err = cliIndexAdvisorShowAdvice(urladvisor, cliIndexAdvisorShow)
+		default:
+			err = cliIndexAdvisorList(urladvisor)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func initIndexAdvisorFlags(cmd *cobra.Command) {
+	initServerApiFlags(indexAdvisorCmd)
+	indexAdvisorCmd.Flags().StringVar(&cliServerID, "id", "", "server id")
+	indexAdvisorCmd.Flags().StringVar(&cliIndexAdvisorShow, "show", "", "Show the DDL and the sample queries of the advice with this id")
+	indexAdvisorCmd.Flags().StringVar(&cliIndexAdvisorApply, "apply", "", "Apply the advice with this id as a rolling schema change")
+	viper.BindPFlags(cmd.Flags())
+}
+
+func cliIndexAdvisorGet(urladvisor string) ([]cluster.IndexAdvice, error) {
+	res, err := cliAPICmd(urladvisor, nil)
+	if err != nil {
+		return nil, err
+	}
+	var advices []cluster.IndexAdvice
+	err = json.Unmarshal([]byte(res), &advices)
+	return advices, err
+}
+
+func cliIndexAdvisorList(urladvisor string) error {
+	advices, err := cliIndexAdvisorGet(urladvisor)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-64s %-10s %-40s %12s %10s %10s %s\n", "Id", "Kind", "Columns", "Rows", "Executions", "Time", "Covered by")
+	for _, a := range advices {
+		fmt.Printf("%-64s %-10s %-40s %12d %10d %10.2f %s\n", a.Id, a.Kind, strings.Join(a.Columns, ","), a.TableRows, a.Executions, a.QueryTime, a.CoveredBy)
+	}
+	return nil
+}
+
+func cliIndexAdvisorShowAdvice(urladvisor string, id string) error {
+	advices, err := cliIndexAdvisorGet(urladvisor)
+	if err != nil {
+		return err
+	}
+	for _, a := range advices {
+		if a.Id != id {
+			continue
+		}
+		fmt.Println(a.DDL + ";")
+		for _, s := range a.Samples {
+			fmt.Printf("-- %s: %s\n", s.Db, s.Query)
+		}
+		return nil
+	}
+	return fmt.Errorf("Index advice %s not found", id)
+}
+
+func cliIndexAdvisorApplyAdvice(urladvisor string, id string) error {
+	res, err := cliAPICmd(urladvisor+"/"+id+"/actions/apply", nil)
+	if err != nil {
+		return err
+	}
+	var sc cluster.SchemaChange
+	if err := json.Unmarshal([]byte(res), &sc); err != nil {
+		return err
+	}
+	fmt.Printf("Schema change %s queued\n", sc.Id)
+	return nil
+}
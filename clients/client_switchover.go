@@ -9,6 +9,7 @@
 package clients
 
 import (
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +24,17 @@ and demoting the old master to slave`,
 		var params []RequetParam
 
 		cliInit(true)
+		if cliDryRun {
+			if cliPrefMaster != "" {
+				params = append(params, RequetParam{key: "prefmaster", value: cliPrefMaster})
+			}
+			plan, err := cliGetPlan("actions/switchover/plan", params)
+			if err != nil {
+				log.Fatal(err)
+			}
+			cliPrintPlan(plan)
+			return
+		}
 		cliGetTopology()
 		if cliPrefMaster != "" {
 			prefMasterParam.key = "prefmaster"
@@ -22,6 +22,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluele/logrus_slack"
@@ -37,11 +38,14 @@ import (
 	v3 "github.com/signal18/replication-manager/repmanv3"
 	"github.com/signal18/replication-manager/router/maxscale"
 	"github.com/signal18/replication-manager/utils/alert"
+	"github.com/signal18/replication-manager/utils/consensus"
 	"github.com/signal18/replication-manager/utils/cron"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/logrus/hooks/pushover"
 	"github.com/signal18/replication-manager/utils/s18log"
 	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/storage"
 	log "github.com/sirupsen/logrus"
 	logsql "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
@@ -111,6 +115,29 @@ type Cluster struct {
 	LogPushover                   *log.Logger           `json:"-"`
 	Log                           s18log.HttpLog        `json:"log"`
 	LogSlack                      *log.Logger           `json:"-"`
+	Notifiers                     []alert.Notifier      `json:"-"`
+	AlertRouter                   *alert.Router         `json:"-"`
+	Journal                       *journal.Journal      `json:"-"`
+	EventBroker                   *journal.Broker       `json:"-"`
+	FailoverReports               []*FailoverReport     `json:"-"`
+	failoverReport                *FailoverReport       `json:"-"`
+	workflows                     map[string]*Workflow  `json:"-"`
+	traceCtx                      atomic.Value          `json:"-"`
+	failoverTraceCtx              atomic.Value          `json:"-"`
+	pitrReport                    *PitrReport           `json:"-"`
+	backupVerifyRunning           bool                  `json:"-"`
+	backupCatalogMutex            sync.Mutex            `json:"-"`
+	backupKeyMutex                sync.Mutex            `json:"-"`
+	schemaChanges                 []*SchemaChange       `json:"-"`
+	schemaChangesInterrupted      []*SchemaChange       `json:"-"`
+	schemaChangeMutex             sync.Mutex            `json:"-"`
+	schemaDrift                   []SchemaDrift         `json:"-"`
+	schemaDriftMutex              sync.Mutex            `json:"-"`
+	consistency                   *ConsistencyCheck     `json:"-"`
+	consistencyRepairs            []*ConsistencyRepair  `json:"-"`
+	consistencyMutex              sync.Mutex            `json:"-"`
+	BackupStorage                 storage.Storage       `json:"-"`
+	Consensus                     *consensus.Node       `json:"-"`
 	JobResults                    map[string]*JobResult `json:"jobResults"`
 	Grants                        map[string]string     `json:"-"`
 	tlog                          *s18log.TermLog       `json:"-"`
@@ -142,6 +169,8 @@ type Cluster struct {
 	//proxysqlPass              string                      `json:"-"`
 	StateMachine              *state.StateMachine         `json:"stateMachine"`
 	runOnceAfterTopology      bool                        `json:"-"`
+	eventTopology             string                      `json:"-"`
+	eventMaster               string                      `json:"-"`
 	logPtr                    *os.File                    `json:"-"`
 	termlength                int                         `json:"-"`
 	runUUID                   string                      `json:"-"`
@@ -187,6 +216,7 @@ type Cluster struct {
 	idSchedulerDbsjobsSsh     cron.EntryID                `json:"-"`
 	idSchedulerRollingReprov  cron.EntryID                `json:"-"`
 	idSchedulerAlertDisable   cron.EntryID                `json:"-"`
+	idSchedulerBackupVerify   cron.EntryID                `json:"-"`
 	WaitingRejoin             int                         `json:"waitingRejoin"`
 	WaitingSwitchover         int                         `json:"waitingSwitchover"`
 	WaitingFailover           int                         `json:"waitingFailover"`
@@ -384,6 +414,8 @@ func (cluster *Cluster) InitFromConf() {
 	cluster.SetClusterCredentialsFromConfig()
 	cluster.LoadAPIUsers()
 	cluster.GetPersitentState()
+	cluster.initBackupStorage()
+	cluster.checkBackupEncryptConfig()
 
 	cluster.LogPushover = log.New()
 	cluster.LogPushover.SetFormatter(&log.TextFormatter{FullTimestamp: true})
@@ -408,6 +440,11 @@ func (cluster *Cluster) InitFromConf() {
 			Timeout:        5 * time.Second, // request timeout for calling slack api
 		})
 	}
+	cluster.initNotifiers()
+	cluster.initAlertRouter()
+	cluster.initJournal()
+	cluster.loadFailoverReports()
+	cluster.loadWorkflows()
 	cluster.LogPrintf("START", "Replication manager started with version: %s", cluster.Conf.Version)
 
 	if cluster.Conf.MailTo != "" {
@@ -526,11 +563,121 @@ func (cluster *Cluster) initScheduler() {
 		cluster.SetSchedulerRollingRestart()
 		cluster.SetSchedulerDbJobsSsh()
 		cluster.SetSchedulerAlertDisable()
+		cluster.SetSchedulerBackupVerify()
 		cluster.scheduler.Start()
 	}
 
 }
 
+// initNotifiers build the alert notifier backends enabled in the cluster configuration
+func (cluster *Cluster) initNotifiers() {
+	cluster.Notifiers = nil
+	if cluster.Conf.AlertWebhookUrl != "" {
+		tmpl := ""
+		if cluster.Conf.AlertWebhookTemplate != "" {
+			content, err := ioutil.ReadFile(cluster.Conf.AlertWebhookTemplate)
+			if err != nil {
+				cluster.LogPrintf(LvlErr, "Could not read webhook template %s: %s", cluster.Conf.AlertWebhookTemplate, err)
+			} else {
+				tmpl = string(content)
+			}
+		}
+		n, err := alert.NewWebhookNotifier(cluster.Conf.AlertWebhookUrl, tmpl, cluster.Conf.AlertNotifierProxyUrl)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not init webhook notifier: %s", err)
+		} else {
+			cluster.Notifiers = append(cluster.Notifiers, n)
+		}
+	}
+	if cluster.Conf.AlertIncidentRoutingKey != "" {
+		n, err := alert.NewIncidentNotifier(cluster.Conf.AlertIncidentUrl, cluster.Conf.GetDecryptedValue("alert-incident-routing-key"), cluster.Conf.AlertNotifierProxyUrl)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not init incident notifier: %s", err)
+		} else {
+			cluster.Notifiers = append(cluster.Notifiers, n)
+		}
+	}
+	if cluster.Conf.AlertChatUrl != "" {
+		n, err := alert.NewChatNotifier(cluster.Conf.AlertChatUrl, cluster.Conf.AlertChatFormat, cluster.Conf.AlertNotifierProxyUrl)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not init chat notifier: %s", err)
+		} else {
+			cluster.Notifiers = append(cluster.Notifiers, n)
+		}
+	}
+	if cluster.Conf.AlertDestinationsFile != "" {
+		dests, err := alert.LoadDestinations(cluster.Conf.AlertDestinationsFile)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not load alert destinations %s: %s", cluster.Conf.AlertDestinationsFile, err)
+		}
+		for _, d := range dests {
+			if cluster.GetNotifier(d.Name) != nil {
+				cluster.LogPrintf(LvlErr, "Alert destination %s is already defined by the alert flags", d.Name)
+				continue
+			}
+			n, err := alert.NewNotifier(d, cluster.Conf.AlertNotifierProxyUrl, &cluster.Conf)
+			if err != nil {
+				cluster.LogPrintf(LvlErr, "Could not init alert destination %s: %s", d.Name, err)
+				continue
+			}
+			cluster.Notifiers = append(cluster.Notifiers, n)
+		}
+	}
+	for _, n := range cluster.Notifiers {
+		cluster.LogPrintf(LvlInfo, "Alert notifier %s enabled: %s", n.GetName(), n.GetType())
+	}
+}
+
+// initAlertRouter load the alert routes, without routes file every alert
+// matching monitoring-alert-trigger goes to all configured destinations
+func (cluster *Cluster) initAlertRouter() {
+	var routes []alert.Route
+	if cluster.Conf.AlertRoutesFile != "" {
+		var err error
+		routes, err = alert.LoadRoutes(cluster.Conf.AlertRoutesFile)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not load alert routes %s: %s", cluster.Conf.AlertRoutesFile, err)
+		}
+	} else if cluster.Conf.MonitoringAlertTrigger != "" {
+		var dests []string
+		if cluster.Conf.MailTo != "" {
+			dests = append(dests, alert.ConstDestinationMail)
+		}
+		if cluster.Conf.AlertScript != "" {
+			dests = append(dests, alert.ConstDestinationScript)
+		}
+		for _, n := range cluster.Notifiers {
+			dests = append(dests, n.GetName())
+		}
+		if len(dests) > 0 {
+			routes = append(routes, alert.Route{
+				Name:         "default",
+				Match:        alert.Matcher{ErrKey: cluster.Conf.MonitoringAlertTrigger},
+				Destinations: dests,
+			})
+		}
+	}
+	cluster.AlertRouter = alert.NewRouter(routes, time.Duration(cluster.Conf.AlertDedupWindow)*time.Second, cluster.Conf.AlertRateLimit)
+	cluster.loadAlertSilences()
+}
+
+func (cluster *Cluster) initJournal() {
+	cluster.EventBroker = journal.NewBroker()
+	if !cluster.Conf.EventsJournal {
+		return
+	}
+	var err error
+	cluster.Journal, err = journal.NewJournal(cluster.WorkingDir+"/events", cluster.Conf.EventsRetentionDays)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not open events journal: %s", err)
+		return
+	}
+	err = cluster.Journal.Purge(time.Now())
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not purge events journal: %s", err)
+	}
+}
+
 func (cluster *Cluster) Run() {
 	interval := time.Second
 
@@ -538,6 +685,7 @@ func (cluster *Cluster) Run() {
 	if _, err := os.Stat(cluster.Conf.WorkingDir + "/" + cluster.Name + "/ca-key.pem"); os.IsNotExist(err) {
 		go cluster.createKeys()
 	}
+	go cluster.runSchemaChanges()
 
 	for cluster.exit == false {
 		if !cluster.Conf.MonitorPause {
@@ -549,7 +697,9 @@ func (cluster *Cluster) Run() {
 				if sig {
 					if cluster.Status == "A" {
 						cluster.LogPrintf(LvlInfo, "Signaling Switchover...")
+						span := cluster.startLoopSpan("Cluster.Switchover")
 						cluster.MasterFailover(false)
+						span.End()
 						cluster.switchoverCond.Send <- true
 					} else {
 						cluster.LogPrintf(LvlInfo, "Not in active mode, cancel switchover %s", cluster.Status)
@@ -573,6 +723,7 @@ func (cluster *Cluster) Run() {
 						}
 					}
 				}
+				span := cluster.startLoopSpan("Cluster.Monitor")
 				wg := new(sync.WaitGroup)
 				wg.Add(1)
 				go cluster.TopologyDiscover(wg)
@@ -588,6 +739,8 @@ func (cluster *Cluster) Run() {
 					}
 					go cluster.initOrchetratorNodes()
 					go cluster.ResticFetchRepo()
+					cluster.ResumeWorkflows()
+					go cluster.recoverSchemaChanges()
 					cluster.runOnceAfterTopology = false
 				} else {
 
@@ -599,6 +752,12 @@ func (cluster *Cluster) Run() {
 					if cluster.StateMachine.SchemaMonitorEndTime+60 < time.Now().Unix() && !cluster.StateMachine.IsInSchemaMonitor() {
 						go cluster.MonitorSchema()
 					}
+					cluster.setSchemaDriftStates()
+					if cluster.Conf.MonitorConsistency {
+						cluster.startConsistencyCheck()
+					}
+					cluster.setConsistencyStates()
+					cluster.setDigestStates()
 					if cluster.Conf.TestInjectTraffic || cluster.Conf.AutorejoinSlavePositionalHeartbeat || cluster.Conf.MonitorWriteHeartbeat {
 						cluster.InjectProxiesTraffic()
 					}
@@ -647,8 +806,10 @@ func (cluster *Cluster) Run() {
 				cluster.CheckFailed()
 
 				cluster.Topology = cluster.GetTopology()
+				cluster.CheckTopologyChange()
 				cluster.SetStatus()
 				cluster.StateProcessing()
+				span.End()
 			}
 		}
 		time.Sleep(interval * time.Duration(cluster.Conf.MonitoringTicker))
@@ -671,7 +832,9 @@ func (cluster *Cluster) StateProcessing() {
 			}
 			if s.ErrKey == "WARN0074" {
 				cluster.LogPrintf(LvlInfo, "Sending master physical backup to reseed %s", s.ServerUrl)
-				if master != nil {
+				if pitrBackup := cluster.getPitrPhysicalBackup(servertoreseed); pitrBackup != "" {
+					go cluster.SSTRunSender(pitrBackup, servertoreseed)
+				} else if master != nil {
 					backupext := ".xbtream"
 
 					if cluster.Conf.CompressBackups {
@@ -747,13 +910,31 @@ func (cluster *Cluster) StateProcessing() {
 		for _, s := range cluster.StateMachine.GetLastOpenedStates() {
 
 			cluster.CheckAlert(s)
+			cluster.LogEvent(journal.ConstEventStateOpen, s.ErrKey, s.ServerUrl, "", "%s", s.ErrDesc)
+			if s.ErrFrom == "JOB" {
+				cluster.LogEvent(journal.ConstEventJob, "running", s.ServerUrl, "", "%s", s.ErrDesc)
+			}
 
 		}
+		for _, s := range cstates {
+			cluster.CheckAlertResolved(s)
+			cluster.LogEvent(journal.ConstEventStateClose, s.ErrKey, s.ServerUrl, "", "%s", s.ErrDesc)
+			if s.ErrFrom == "JOB" {
+				cluster.LogEvent(journal.ConstEventJob, "finished", s.ServerUrl, "", "%s", s.ErrDesc)
+			}
+		}
+		if cluster.AlertRouter.PurgeSilences(time.Now()) {
+			cluster.saveAlertSilences()
+		}
+		cluster.IsAlertDisable = cluster.AlertRouter.HasGlobalSilence(time.Now())
 
 		cluster.StateMachine.ClearState()
 		if cluster.StateMachine.GetHeartbeats()%60 == 0 {
 			cluster.Save()
 		}
+		if cluster.Journal != nil && cluster.StateMachine.GetHeartbeats()%3600 == 0 {
+			cluster.Journal.Purge(time.Now())
+		}
 
 	}
 }
@@ -936,6 +1117,15 @@ func (cluster *Cluster) Save() error {
 	return nil
 }
 
+func (cluster *Cluster) saveAlertSilences() error {
+	saveJson, _ := json.MarshalIndent(cluster.AlertRouter.GetSilences(), "", "\t")
+	err := ioutil.WriteFile(cluster.WorkingDir+"/alertsilences.json", saveJson, 0644)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save alert silences: %s", err)
+	}
+	return err
+}
+
 func (cluster *Cluster) PushConfigToGit(tok string, user string, dir string, name string) {
 
 	if cluster.Conf.LogGit {
@@ -1107,6 +1297,8 @@ func (cluster *Cluster) GetEncryptedValueFromMemory(key string) string {
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("haproxy-password"))
 	case "maxscale-pass":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("maxscale-pass"))
+	case "mysqlrouter-pass":
+		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("mysqlrouter-pass"))
 	case "myproxy-password":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("proxysql-password"))
 	case "proxysql-password":
@@ -1124,12 +1316,18 @@ func (cluster *Cluster) GetEncryptedValueFromMemory(key string) string {
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("backup-restic-aws-access-secret"))
 	case "backup-streaming-aws-access-secret":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("backup-streaming-aws-access-secret"))
+	case "backup-storage-azure-key":
+		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("backup-storage-azure-key"))
 	case "arbitration-external-secret":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("arbitration-external-secret"))
+	case "arbitration-raft-secret":
+		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("arbitration-raft-secret"))
 	case "alert-pushover-user-token":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("alert-pushover-user-token"))
 	case "alert-pushover-app-token":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("alert-pushover-app-token"))
+	case "alert-incident-routing-key":
+		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("alert-incident-routing-key"))
 	case "mail-smtp-password":
 		return cluster.Conf.GetEncryptedString(cluster.Conf.GetDecryptedValue("mail-smtp-password"))
 	case "api-oauth-client-secret":
@@ -1417,6 +1615,9 @@ func (cluster *Cluster) MonitorSchema() {
 			}
 			t.TableSync = oldtable.TableSync
 		}
+		if haschanged && t.TableSchema != "replication_manager_schema" {
+			cluster.recordSchemaVersion(cluster.GetMaster(), t.TableSchema, t.TableName)
+		}
 		// lookup other clusters
 		for _, cl := range cluster.clusterList {
 			if cl.GetName() != cluster.GetName() {
@@ -1449,6 +1650,9 @@ func (cluster *Cluster) MonitorSchema() {
 	cluster.WorkLoad.DBIndexSize = totindexsize
 	cluster.WorkLoad.DBTableSize = tottablesize
 	cluster.GetMaster().DictTables = tables
+	if err == nil {
+		cluster.MonitorSchemaDrift(cluster.GetMaster(), tables)
+	}
 	cluster.StateMachine.RemoveMonitorSchemaState()
 }
 
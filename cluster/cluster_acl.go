@@ -142,6 +142,11 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
+	if cluster.APIUsers[strUser].Grants[config.GrantClusterSharding] {
+		if strings.Contains(URL, "/index-advisor/") && strings.HasSuffix(URL, "/actions/apply") {
+			return true
+		}
+	}
 	if cluster.APIUsers[strUser].Grants[config.GrantProvDBProvision] {
 		if strings.Contains(URL, "/actions/provision") {
 			return true
@@ -243,6 +248,9 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/actions/reseed/") {
 			return true
 		}
+		if strings.Contains(URL, "/actions/pitr") {
+			return true
+		}
 	}
 	if cluster.APIUsers[strUser].Grants[config.GrantDBReadOnly] {
 		if strings.Contains(URL, "actions/toogle-read-only") {
@@ -279,6 +287,12 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/digest-statements-slow") {
 			return true
 		}
+		if strings.Contains(URL, "/digests/history") {
+			return true
+		}
+		if strings.Contains(URL, "/index-advisor") && !strings.Contains(URL, "/actions/") {
+			return true
+		}
 		if strings.Contains(URL, "/actions/toogle-sql-error-log") {
 			return true
 		}
@@ -362,6 +376,12 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/vtables") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/schema/drift") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/schema/") && strings.HasSuffix(URL, "/history") {
+			return true
+		}
 		if strings.Contains(URL, "/tables") {
 			return true
 		}
@@ -440,7 +460,10 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		}
 	}
 	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowBackups] {
-		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/backups") {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/backups") && !strings.Contains(URL, "/actions/") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/pitr") {
 			return true
 		}
 	}
@@ -478,6 +501,9 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/switchover") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/topology/failovers") {
+			return true
+		}
 	}
 
 	if cluster.APIUsers[strUser].Grants[config.GrantClusterTraffic] {
@@ -496,6 +522,18 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/actions/master-physical-backup") {
 			return true
 		}
+		if strings.Contains(URL, "/actions/backup-verify") {
+			return true
+		}
+		if strings.Contains(URL, "/actions/backup-key-init") {
+			return true
+		}
+		if strings.Contains(URL, "/actions/backup-key-rotate") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/backups/catalog/") && strings.Contains(URL, "/actions/") {
+			return true
+		}
 	}
 	if cluster.APIUsers[strUser].Grants[config.GrantClusterBench] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/sysbench") {
@@ -515,6 +553,9 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/failover") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/topology/failovers") {
+			return true
+		}
 	}
 	if cluster.APIUsers[strUser].Grants[config.GrantClusterReplication] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/replication/bootstrap") {
@@ -532,12 +573,18 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/rolling") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/rolling-upgrade") {
+			return true
+		}
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/cancel-rolling-restart") {
 			return true
 		}
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/cancel-rolling-reprov") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/workflows") {
+			return true
+		}
 	}
 	if cluster.APIUsers[strUser].Grants[config.GrantClusterRotatePasswords] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/rotate-passwords") {
@@ -580,11 +627,20 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/reset-failover-control") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/events") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/alerts/silences") {
+			return true
+		}
 	}
 	if cluster.APIUsers[strUser].Grants[config.GrantClusterChecksum] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/checksum-all-tables") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/consistency") {
+			return true
+		}
 	}
 
 	if cluster.APIUsers[strUser].Grants[config.GrantProvCluster] {
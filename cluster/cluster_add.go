@@ -13,6 +13,7 @@ import (
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/router/proxysql"
+	"github.com/signal18/replication-manager/utils/alert"
 	"github.com/signal18/replication-manager/utils/misc"
 )
 
@@ -180,3 +181,13 @@ func (cluster *Cluster) AddShardingQueryRules(schema string, table string) error
 	}
 	return nil
 }
+
+func (cluster *Cluster) AddAlertSilence(silence alert.Silence) (alert.Silence, error) {
+	silence, err := cluster.AlertRouter.AddSilence(silence)
+	if err != nil {
+		return silence, err
+	}
+	cluster.LogPrintf(LvlInfo, "Alert silence %s added by %s until %s", silence.Id, silence.CreatedBy, silence.EndsAt.Format("2006-01-02 15:04:05"))
+	cluster.IsAlertDisable = cluster.AlertRouter.HasGlobalSilence(silence.StartsAt)
+	return silence, cluster.saveAlertSilences()
+}
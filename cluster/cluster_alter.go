@@ -0,0 +1,689 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	ConstSchemaChangeRolling = "rolling"
+	ConstSchemaChangeShadow  = "shadow"
+
+	ConstSchemaChangeQueued    = "queued"
+	ConstSchemaChangeRunning   = "running"
+	ConstSchemaChangeDone      = "done"
+	ConstSchemaChangeFailed    = "failed"
+	ConstSchemaChangeCancelled = "cancelled"
+
+	ConstSchemaChangeServerPending = "pending"
+	ConstSchemaChangeServerAltered = "altered"
+	ConstSchemaChangeServerFailed  = "failed"
+)
+
+// finished schema changes kept in the history
+const schemaChangeHistory = 20
+
+var errSchemaChangeCancelled = errors.New("Cancelled")
+
+// SchemaChange is an online ALTER TABLE submitted to the monitor, changes
+// run one at a time in the order they were submitted
+type SchemaChange struct {
+	Id         string               `json:"id"`
+	Schema     string               `json:"schema"`
+	Table      string               `json:"table"`
+	Alter      string               `json:"alter"`
+	Method     string               `json:"method"`
+	State      string               `json:"state"`
+	Step       string               `json:"step"`
+	Progress   int                  `json:"progress"`
+	RowsCopied int64                `json:"rowsCopied"`
+	RowsTotal  int64                `json:"rowsTotal"`
+	Throttled  bool                 `json:"throttled"`
+	Servers    []SchemaChangeServer `json:"servers,omitempty"`
+	Submitted  time.Time            `json:"submitted"`
+	Started    time.Time            `json:"started"`
+	Updated    time.Time            `json:"updated"`
+	Error      string               `json:"error,omitempty"`
+	cancel     bool
+	switchover bool
+	validate   func(server *ServerMonitor) error
+	rollback   string
+}
+
+// SchemaChangeServer is the progress of a rolling schema change on a server
+type SchemaChangeServer struct {
+	URL   string    `json:"url"`
+	State string    `json:"state"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+func (cluster *Cluster) getSchemaChangesFile() string {
+	return cluster.WorkingDir + "/schemachanges.json"
+}
+
+// saveSchemaChanges is called with the schema change mutex
+func (cluster *Cluster) saveSchemaChanges() {
+	saveJson, _ := json.MarshalIndent(cluster.schemaChanges, "", "\t")
+	err := ioutil.WriteFile(cluster.getSchemaChangesFile(), saveJson, 0644)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save schema changes: %s", err)
+	}
+}
+
+// loadSchemaChanges is called with the schema change mutex, the changes
+// queued or running were interrupted by a monitor restart
+func (cluster *Cluster) loadSchemaChanges() {
+	if cluster.schemaChanges != nil {
+		return
+	}
+	cluster.schemaChanges = []*SchemaChange{}
+	file, err := ioutil.ReadFile(cluster.getSchemaChangesFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			cluster.LogPrintf(LvlErr, "Could not read schema changes: %s", err)
+		}
+		return
+	}
+	err = json.Unmarshal(file, &cluster.schemaChanges)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not parse schema changes: %s", err)
+		return
+	}
+	interrupted := false
+	for _, sc := range cluster.schemaChanges {
+		if sc.State != ConstSchemaChangeQueued && sc.State != ConstSchemaChangeRunning {
+			continue
+		}
+		if sc.State == ConstSchemaChangeRunning && sc.Method == ConstSchemaChangeShadow {
+			cluster.schemaChangesInterrupted = append(cluster.schemaChangesInterrupted, sc)
+		}
+		sc.State = ConstSchemaChangeFailed
+		sc.Error = "Interrupted by a monitor restart"
+		sc.Updated = time.Now()
+		interrupted = true
+	}
+	if interrupted {
+		cluster.saveSchemaChanges()
+	}
+}
+
+// GetSchemaChanges return a copy of the queued, running and last finished
+// schema changes, the latest first
+func (cluster *Cluster) GetSchemaChanges() []SchemaChange {
+	cluster.schemaChangeMutex.Lock()
+	defer cluster.schemaChangeMutex.Unlock()
+	cluster.loadSchemaChanges()
+	changes := make([]SchemaChange, 0, len(cluster.schemaChanges))
+	for i := len(cluster.schemaChanges) - 1; i >= 0; i-- {
+		sc := *cluster.schemaChanges[i]
+		sc.Servers = append([]SchemaChangeServer(nil), sc.Servers...)
+		changes = append(changes, sc)
+	}
+	return changes
+}
+
+// updateSchemaChange apply the update under the schema change mutex, the
+// changes are saved on state and step transitions
+func (cluster *Cluster) updateSchemaChange(sc *SchemaChange, save bool, update func()) {
+	cluster.schemaChangeMutex.Lock()
+	defer cluster.schemaChangeMutex.Unlock()
+	update()
+	sc.Updated = time.Now()
+	if save {
+		cluster.saveSchemaChanges()
+	}
+}
+
+func (cluster *Cluster) setSchemaChangeStep(sc *SchemaChange, step string) {
+	cluster.LogPrintf(LvlInfo, "Schema change %s: %s", sc.Id, step)
+	cluster.updateSchemaChange(sc, true, func() { sc.Step = step })
+}
+
+// IsInSchemaChange is true while a schema change runs, switchovers are
+// refused but the one of a rolling schema change
+func (cluster *Cluster) IsInSchemaChange() bool {
+	cluster.schemaChangeMutex.Lock()
+	defer cluster.schemaChangeMutex.Unlock()
+	for _, sc := range cluster.schemaChanges {
+		if sc.State == ConstSchemaChangeRunning && !sc.switchover {
+			return true
+		}
+	}
+	return false
+}
+
+// AlterTable queue an online schema change of the table, alter is the
+// specification following ALTER TABLE. The rolling method alter the
+// replicas without binlog, switchover and alter the old master, the shadow
+// method copy the table on the master to an altered table kept in sync with
+// triggers and swap them.
+func (cluster *Cluster) AlterTable(schema string, table string, alter string, method string) (*SchemaChange, error) {
+	return cluster.alterTable(schema, table, alter, method, "", nil)
+}
+
+// AlterTableWithValidation queue a rolling schema change that call validate
+// on the first altered replica, on failure the replica is altered back with
+// the rollback specification and the change stops before the other servers
+func (cluster *Cluster) AlterTableWithValidation(schema string, table string, alter string, rollback string, validate func(server *ServerMonitor) error) (*SchemaChange, error) {
+	rollback = strings.TrimSpace(rollback)
+	if rollback == "" || validate == nil {
+		return nil, errors.New("Schema change with validation needs a rollback specification and a validation")
+	}
+	if strings.Contains(rollback, ";") {
+		return nil, errors.New("Schema change rollback specification can not contain several statements")
+	}
+	return cluster.alterTable(schema, table, alter, ConstSchemaChangeRolling, rollback, validate)
+}
+
+func (cluster *Cluster) alterTable(schema string, table string, alter string, method string, rollback string, validate func(server *ServerMonitor) error) (*SchemaChange, error) {
+	alter = strings.TrimSpace(alter)
+	if schema == "" || table == "" || alter == "" {
+		return nil, errors.New("Schema change needs a schema, a table and an alter specification")
+	}
+	if strings.Contains(alter, ";") {
+		return nil, errors.New("Schema change alter specification can not contain several statements")
+	}
+	if method == "" {
+		method = cluster.Conf.SchemaChangeMethod
+	}
+	if method != ConstSchemaChangeRolling && method != ConstSchemaChangeShadow {
+		return nil, fmt.Errorf("Unknown schema change method %s", method)
+	}
+	if method == ConstSchemaChangeRolling && cluster.GetTopology() != topoMasterSlave {
+		return nil, fmt.Errorf("Rolling schema change needs a master-slave topology, not %s", cluster.GetTopology())
+	}
+	// the shadow table and triggers add 5 characters to the name
+	if method == ConstSchemaChangeShadow && len(table) > 59 {
+		return nil, fmt.Errorf("Table name %s too long for a shadow table", table)
+	}
+	now := time.Now()
+	sc := &SchemaChange{
+		Schema:    schema,
+		Table:     table,
+		Alter:     alter,
+		Method:    method,
+		State:     ConstSchemaChangeQueued,
+		Submitted: now,
+		Updated:   now,
+		validate:  validate,
+		rollback:  rollback,
+	}
+	cluster.schemaChangeMutex.Lock()
+	cluster.loadSchemaChanges()
+	for sc.Id == "" || cluster.getSchemaChange(sc.Id) != nil {
+		sc.Id = now.Format("20060102150405.000000") + "-" + schema + "." + table
+		now = now.Add(time.Microsecond)
+	}
+	cluster.schemaChanges = append(cluster.schemaChanges, sc)
+	// drop the oldest finished changes
+	finished := 0
+	for i := len(cluster.schemaChanges) - 1; i >= 0; i-- {
+		if st := cluster.schemaChanges[i].State; st == ConstSchemaChangeQueued || st == ConstSchemaChangeRunning {
+			continue
+		}
+		finished++
+		if finished > schemaChangeHistory {
+			cluster.schemaChanges = append(cluster.schemaChanges[:i], cluster.schemaChanges[i+1:]...)
+		}
+	}
+	cluster.saveSchemaChanges()
+	cluster.schemaChangeMutex.Unlock()
+
+	cluster.LogPrintf(LvlInfo, "Schema change %s queued: ALTER TABLE %s.%s %s", sc.Id, schema, table, alter)
+	cluster.altertableCond.Send <- sc
+	return sc, nil
+}
+
+// getSchemaChange is called with the schema change mutex
+func (cluster *Cluster) getSchemaChange(id string) *SchemaChange {
+	for _, sc := range cluster.schemaChanges {
+		if sc.Id == id {
+			return sc
+		}
+	}
+	return nil
+}
+
+// CancelSchemaChange stop a queued or running schema change, a rolling
+// change stop before the next server and a shadow copy before the next
+// chunk, its triggers and shadow table are dropped
+func (cluster *Cluster) CancelSchemaChange(id string) error {
+	cluster.schemaChangeMutex.Lock()
+	defer cluster.schemaChangeMutex.Unlock()
+	cluster.loadSchemaChanges()
+	sc := cluster.getSchemaChange(id)
+	if sc == nil {
+		return fmt.Errorf("Schema change %s not found", id)
+	}
+	switch sc.State {
+	case ConstSchemaChangeQueued:
+		sc.State = ConstSchemaChangeCancelled
+		sc.Updated = time.Now()
+		cluster.saveSchemaChanges()
+	case ConstSchemaChangeRunning:
+		sc.cancel = true
+	default:
+		return fmt.Errorf("Schema change %s is %s", id, sc.State)
+	}
+	return nil
+}
+
+func (cluster *Cluster) isSchemaChangeCancelled(sc *SchemaChange) bool {
+	cluster.schemaChangeMutex.Lock()
+	defer cluster.schemaChangeMutex.Unlock()
+	return sc.cancel
+}
+
+// runSchemaChanges run the schema changes sent to altertableCond one after
+// the other
+func (cluster *Cluster) runSchemaChanges() {
+	for item := range cluster.altertableCond.Recv {
+		sc, ok := item.(*SchemaChange)
+		if !ok {
+			continue
+		}
+		cluster.schemaChangeMutex.Lock()
+		queued := sc.State == ConstSchemaChangeQueued
+		cluster.schemaChangeMutex.Unlock()
+		if queued {
+			cluster.runSchemaChange(sc)
+		}
+	}
+}
+
+func (cluster *Cluster) runSchemaChange(sc *SchemaChange) {
+	cluster.updateSchemaChange(sc, true, func() {
+		sc.State = ConstSchemaChangeRunning
+		sc.Started = time.Now()
+	})
+	cluster.LogPrintf(LvlInfo, "Schema change %s started with method %s", sc.Id, sc.Method)
+	cluster.LogEvent(journal.ConstEventJob, "schema-change-start", "", "", "Schema change %s of %s.%s started: %s", sc.Method, sc.Schema, sc.Table, sc.Alter)
+
+	var err error
+	if !cluster.IsActive() {
+		err = errors.New("Monitor is not active")
+	} else if sc.Method == ConstSchemaChangeRolling {
+		err = cluster.rollingAlterTable(sc)
+	} else {
+		err = cluster.shadowAlterTable(sc)
+	}
+
+	switch err {
+	case nil:
+		cluster.updateSchemaChange(sc, true, func() {
+			sc.State = ConstSchemaChangeDone
+			sc.Step = ""
+			sc.Progress = 100
+			sc.Throttled = false
+		})
+		cluster.LogPrintf(LvlInfo, "Schema change %s done", sc.Id)
+		cluster.LogEvent(journal.ConstEventJob, "schema-change-done", "", "", "Schema change %s of %s.%s done in %s", sc.Method, sc.Schema, sc.Table, time.Since(sc.Started).Round(time.Second))
+	case errSchemaChangeCancelled:
+		cluster.updateSchemaChange(sc, true, func() {
+			sc.State = ConstSchemaChangeCancelled
+			sc.Throttled = false
+		})
+		cluster.LogPrintf(LvlInfo, "Schema change %s cancelled", sc.Id)
+		cluster.LogEvent(journal.ConstEventJob, "schema-change-cancelled", "", "", "Schema change %s of %s.%s cancelled at %s", sc.Method, sc.Schema, sc.Table, sc.Step)
+	default:
+		cluster.updateSchemaChange(sc, true, func() {
+			sc.State = ConstSchemaChangeFailed
+			sc.Error = err.Error()
+			sc.Throttled = false
+		})
+		cluster.LogPrintf(LvlErr, "Schema change %s failed at %s: %s", sc.Id, sc.Step, err)
+		cluster.LogEvent(journal.ConstEventJob, "schema-change-failed", "", "", "Schema change %s of %s.%s failed at %s: %s", sc.Method, sc.Schema, sc.Table, sc.Step, err)
+		cluster.StateMachine.AddState("ERR00097", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00097"], sc.Schema, sc.Table, err), ErrFrom: "SCHEMA"})
+	}
+}
+
+// recoverSchemaChanges drop the triggers and the shadow table of a shadow
+// copy interrupted by a monitor restart
+func (cluster *Cluster) recoverSchemaChanges() {
+	cluster.schemaChangeMutex.Lock()
+	cluster.loadSchemaChanges()
+	interrupted := cluster.schemaChangesInterrupted
+	cluster.schemaChangesInterrupted = nil
+	cluster.schemaChangeMutex.Unlock()
+	if len(interrupted) == 0 {
+		return
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.Conn == nil {
+		return
+	}
+	for _, sc := range interrupted {
+		cluster.LogPrintf(LvlInfo, "Schema change %s interrupted, dropping its shadow table and triggers", sc.Id)
+		cluster.dropShadowTable(master.Conn, sc)
+	}
+}
+
+// waitSchemaChangeDelay throttle the schema change while the replication
+// delay of a replica is above schema-change-max-delay
+func (cluster *Cluster) waitSchemaChangeDelay(sc *SchemaChange) error {
+	for {
+		if cluster.isSchemaChangeCancelled(sc) {
+			return errSchemaChangeCancelled
+		}
+		var lagging *ServerMonitor
+		for _, s := range cluster.slaves {
+			if !s.IsDown() && s.GetReplicationDelay() > cluster.Conf.SchemaChangeMaxDelay {
+				lagging = s
+				break
+			}
+		}
+		throttled := lagging != nil
+		cluster.updateSchemaChange(sc, false, func() { sc.Throttled = throttled })
+		if !throttled {
+			return nil
+		}
+		cluster.LogPrintf(LvlInfo, "Schema change %s throttled, replication delay of %s is %d", sc.Id, lagging.URL, lagging.GetReplicationDelay())
+		time.Sleep(time.Duration(cluster.Conf.MonitoringTicker) * time.Second)
+	}
+}
+
+func (cluster *Cluster) getSchemaChangeTable(sc *SchemaChange, table string) string {
+	return dbhelper.QuoteIdentifier(sc.Schema) + "." + dbhelper.QuoteIdentifier(table)
+}
+
+// rollingAlterTable alter every replica with sql_log_bin=0, switchover to an
+// altered replica and alter the old master the same way
+func (cluster *Cluster) rollingAlterTable(sc *SchemaChange) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		return errors.New("No master")
+	}
+	var servers []*ServerMonitor
+	for _, s := range cluster.slaves {
+		if s.IsDown() {
+			return fmt.Errorf("Replica %s is down and would miss the change", s.URL)
+		}
+		servers = append(servers, s)
+	}
+	if len(servers) == 0 {
+		return errors.New("No replica to switchover to")
+	}
+	servers = append(servers, master)
+	cluster.updateSchemaChange(sc, true, func() {
+		sc.Servers = nil
+		for _, s := range servers {
+			sc.Servers = append(sc.Servers, SchemaChangeServer{URL: s.URL, State: ConstSchemaChangeServerPending})
+		}
+	})
+	query := "ALTER TABLE " + cluster.getSchemaChangeTable(sc, sc.Table) + " " + sc.Alter
+
+	for i, s := range servers {
+		if s == master {
+			if err := cluster.waitSchemaChangeDelay(sc); err != nil {
+				return err
+			}
+			cluster.setSchemaChangeStep(sc, "switchover")
+			cluster.updateSchemaChange(sc, false, func() { sc.switchover = true })
+			cluster.SwitchoverWaitTest()
+			cluster.updateSchemaChange(sc, false, func() { sc.switchover = false })
+			if cluster.master == nil || cluster.master.Id == master.Id {
+				return fmt.Errorf("Master %s is the same after switchover", master.URL)
+			}
+		}
+		if err := cluster.waitSchemaChangeDelay(sc); err != nil {
+			return err
+		}
+		cluster.setSchemaChangeStep(sc, "alter "+s.URL)
+		err := s.ExecQueryNoBinLog(query)
+		cluster.updateSchemaChange(sc, true, func() {
+			sc.Servers[i].Time = time.Now()
+			if err != nil {
+				sc.Servers[i].State = ConstSchemaChangeServerFailed
+				sc.Servers[i].Error = err.Error()
+				return
+			}
+			sc.Servers[i].State = ConstSchemaChangeServerAltered
+			sc.Progress = (i + 1) * 100 / len(servers)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.URL, err)
+		}
+		if i == 0 && sc.validate != nil {
+			cluster.setSchemaChangeStep(sc, "validate "+s.URL)
+			if err := sc.validate(s); err != nil {
+				if rerr := s.ExecQueryNoBinLog("ALTER TABLE " + cluster.getSchemaChangeTable(sc, sc.Table) + " " + sc.rollback); rerr != nil {
+					cluster.LogPrintf(LvlErr, "Schema change %s could not roll back %s: %s", sc.Id, s.URL, rerr)
+				}
+				cluster.updateSchemaChange(sc, true, func() {
+					sc.Servers[i].State = ConstSchemaChangeServerFailed
+					sc.Servers[i].Error = err.Error()
+				})
+				return fmt.Errorf("Validation on %s: %s", s.URL, err)
+			}
+		}
+	}
+	return nil
+}
+
+// shadowAlterTable create an altered copy of the table on the master, keep
+// it in sync with triggers while the rows are copied by chunks of the
+// primary key and swap the tables with an atomic rename
+func (cluster *Cluster) shadowAlterTable(sc *SchemaChange) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		return errors.New("No master")
+	}
+	conn, err := master.GetNewDBConn()
+	if err != nil {
+		return fmt.Errorf("%s: %s", master.URL, err)
+	}
+	defer conn.Close()
+
+	pk, logs, err := dbhelper.GetTablePrimaryKey(conn, sc.Schema, sc.Table)
+	cluster.LogSQL(logs, err, master.URL, "SchemaChange", LvlDbg, "GetTablePrimaryKey")
+	if err != nil {
+		return err
+	}
+	if len(pk) == 0 {
+		return fmt.Errorf("Table %s.%s has no primary key", sc.Schema, sc.Table)
+	}
+	triggers, logs, err := dbhelper.GetTableTriggers(conn, sc.Schema, sc.Table)
+	cluster.LogSQL(logs, err, master.URL, "SchemaChange", LvlDbg, "GetTableTriggers")
+	if err != nil {
+		return err
+	}
+	if len(triggers) > 0 {
+		return fmt.Errorf("Table %s.%s already has triggers %s", sc.Schema, sc.Table, strings.Join(triggers, ","))
+	}
+	columns, logs, err := dbhelper.GetTableColumns(conn, sc.Schema, sc.Table)
+	cluster.LogSQL(logs, err, master.URL, "SchemaChange", LvlDbg, "GetTableColumns")
+	if err != nil {
+		return err
+	}
+
+	table := cluster.getSchemaChangeTable(sc, sc.Table)
+	shadow := cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_new")
+	cluster.setSchemaChangeStep(sc, "create shadow table")
+	if _, err = conn.Exec("CREATE TABLE " + shadow + " LIKE " + table); err != nil {
+		return err
+	}
+	err = cluster.shadowCopyTable(conn, sc, pk, columns)
+	if err != nil {
+		cluster.dropShadowTable(conn, sc)
+	}
+	return err
+}
+
+func (cluster *Cluster) shadowCopyTable(conn *sqlx.DB, sc *SchemaChange, pk []string, columns []string) error {
+	table := cluster.getSchemaChangeTable(sc, sc.Table)
+	shadow := cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_new")
+	if _, err := conn.Exec("ALTER TABLE " + shadow + " " + sc.Alter); err != nil {
+		return err
+	}
+	newColumns, _, err := dbhelper.GetTableColumns(conn, sc.Schema, "_"+sc.Table+"_new")
+	if err != nil {
+		return err
+	}
+	newPk, _, err := dbhelper.GetTablePrimaryKey(conn, sc.Schema, "_"+sc.Table+"_new")
+	if err != nil {
+		return err
+	}
+	if strings.Join(newPk, ",") != strings.Join(pk, ",") {
+		return errors.New("Shadow method can not change the primary key")
+	}
+	// copy the columns kept by the change
+	var cols, pkOld []string
+	for _, c := range columns {
+		for _, n := range newColumns {
+			if c == n {
+				cols = append(cols, dbhelper.QuoteIdentifier(c))
+			}
+		}
+	}
+	for _, c := range pk {
+		pkOld = append(pkOld, dbhelper.QuoteIdentifier(c))
+	}
+	colList := strings.Join(cols, ",")
+
+	cluster.setSchemaChangeStep(sc, "create triggers")
+	for _, trigger := range cluster.getShadowTriggers(sc, cols, pkOld) {
+		if _, err := conn.Exec(trigger); err != nil {
+			return err
+		}
+	}
+
+	rows, _, err := dbhelper.GetTableRows(conn, sc.Schema, sc.Table)
+	if err != nil {
+		return err
+	}
+	cluster.updateSchemaChange(sc, true, func() { sc.RowsTotal = rows })
+	cluster.setSchemaChangeStep(sc, "copy rows")
+	pkList := strings.Join(pkOld, ",")
+	chunk := cluster.Conf.SchemaChangeChunkSize
+	if chunk <= 0 {
+		chunk = 1000
+	}
+	var last []interface{}
+	saved := time.Now()
+	for {
+		if err := cluster.waitSchemaChangeDelay(sc); err != nil {
+			return err
+		}
+		// the last key of the chunk, keyset pagination on the primary key
+		args := append([]interface{}{}, last...)
+		upper, err := conn.Queryx("SELECT "+pkList+" FROM "+table+getShadowChunkWhere(pkList, len(pk), last != nil, false)+" ORDER BY "+pkList+" LIMIT 1 OFFSET ?", append(args, chunk-1)...)
+		if err != nil {
+			return err
+		}
+		var next []interface{}
+		if upper.Next() {
+			next, err = upper.SliceScan()
+		}
+		upper.Close()
+		if err != nil {
+			return err
+		}
+		copyQuery := "INSERT IGNORE INTO " + shadow + " (" + colList + ") SELECT " + colList + " FROM " + table + " FORCE INDEX(PRIMARY)" + getShadowChunkWhere(pkList, len(pk), last != nil, next != nil)
+		args = append(args, next...)
+		res, err := conn.Exec(copyQuery+" LOCK IN SHARE MODE", args...)
+		if err != nil {
+			return err
+		}
+		copied, _ := res.RowsAffected()
+		save := time.Since(saved) > 10*time.Second
+		if save {
+			saved = time.Now()
+		}
+		cluster.updateSchemaChange(sc, save, func() {
+			sc.RowsCopied += copied
+			if sc.RowsTotal > 0 {
+				sc.Progress = int(sc.RowsCopied * 99 / sc.RowsTotal)
+				if sc.Progress > 99 {
+					sc.Progress = 99
+				}
+			}
+		})
+		if next == nil {
+			break
+		}
+		last = next
+	}
+
+	cluster.setSchemaChangeStep(sc, "swap tables")
+	if _, err := conn.Exec("RENAME TABLE " + table + " TO " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_old") + ", " + shadow + " TO " + table); err != nil {
+		return err
+	}
+	cluster.setSchemaChangeStep(sc, "drop old table")
+	cluster.dropShadowTriggers(conn, sc)
+	if _, err := conn.Exec("DROP TABLE IF EXISTS " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_old")); err != nil {
+		cluster.LogPrintf(LvlWarn, "Schema change %s could not drop the old table: %s", sc.Id, err)
+	}
+	return nil
+}
+
+// getShadowTriggers return the triggers that replay the changes of the table
+// on the shadow table, cols are the quoted columns kept by the change and pk
+// the quoted primary key
+func (cluster *Cluster) getShadowTriggers(sc *SchemaChange, cols []string, pk []string) []string {
+	table := cluster.getSchemaChangeTable(sc, sc.Table)
+	shadow := cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_new")
+	var newValues, pkMatch []string
+	for _, c := range cols {
+		newValues = append(newValues, "NEW."+c)
+	}
+	for _, c := range pk {
+		pkMatch = append(pkMatch, shadow+"."+c+" <=> OLD."+c)
+	}
+	replace := "REPLACE INTO " + shadow + " (" + strings.Join(cols, ",") + ") VALUES (" + strings.Join(newValues, ",") + ")"
+	remove := "DELETE IGNORE FROM " + shadow + " WHERE " + strings.Join(pkMatch, " AND ")
+	return []string{
+		"CREATE TRIGGER " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_ins") + " AFTER INSERT ON " + table + " FOR EACH ROW " + replace,
+		"CREATE TRIGGER " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_upd") + " AFTER UPDATE ON " + table + " FOR EACH ROW BEGIN " + remove + "; " + replace + "; END",
+		"CREATE TRIGGER " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_del") + " AFTER DELETE ON " + table + " FOR EACH ROW " + remove,
+	}
+}
+
+// getShadowChunkWhere return the keyset bounds of a chunk of the primary key
+// as placeholders, the lower key is excluded and the upper one included
+func getShadowChunkWhere(pkList string, pkLen int, lower bool, upper bool) string {
+	key := "(" + strings.TrimSuffix(strings.Repeat("?,", pkLen), ",") + ")"
+	var where []string
+	if lower {
+		where = append(where, "("+pkList+") > "+key)
+	}
+	if upper {
+		where = append(where, "("+pkList+") <= "+key)
+	}
+	if len(where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(where, " AND ")
+}
+
+func (cluster *Cluster) dropShadowTriggers(conn *sqlx.DB, sc *SchemaChange) {
+	for _, trigger := range []string{"_ins", "_upd", "_del"} {
+		if _, err := conn.Exec("DROP TRIGGER IF EXISTS " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+trigger)); err != nil {
+			cluster.LogPrintf(LvlErr, "Schema change %s could not drop trigger %s: %s", sc.Id, sc.Table+trigger, err)
+		}
+	}
+}
+
+// dropShadowTable remove what a failed shadow copy left on the master
+func (cluster *Cluster) dropShadowTable(conn *sqlx.DB, sc *SchemaChange) {
+	cluster.dropShadowTriggers(conn, sc)
+	if _, err := conn.Exec("DROP TABLE IF EXISTS " + cluster.getSchemaChangeTable(sc, "_"+sc.Table+"_new")); err != nil {
+		cluster.LogPrintf(LvlErr, "Schema change %s could not drop the shadow table: %s", sc.Id, err)
+	}
+}
@@ -0,0 +1,200 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signal18/replication-manager/cluster/nbc"
+)
+
+func newSchemaChangeTestCluster(t *testing.T) (*Cluster, func()) {
+	dir, err := ioutil.TempDir("", "schemachange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := &Cluster{WorkingDir: dir, altertableCond: nbc.New()}
+	cluster.master = &ServerMonitor{Id: "db1", URL: "db1:3306"}
+	return cluster, func() { os.RemoveAll(dir) }
+}
+
+func receiveSchemaChange(t *testing.T, cluster *Cluster) *SchemaChange {
+	select {
+	case item := <-cluster.altertableCond.Recv:
+		return item.(*SchemaChange)
+	case <-time.After(time.Second):
+		t.Fatal("Expected a queued schema change")
+	}
+	return nil
+}
+
+func TestSchemaChangeQueue(t *testing.T) {
+	cluster, cleanup := newSchemaChangeTestCluster(t)
+	defer cleanup()
+
+	first, err := cluster.AlterTable("s", "t", "ADD COLUMN c INT", ConstSchemaChangeRolling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cluster.AlterTable("s", "t", "ADD COLUMN d INT", ConstSchemaChangeShadow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Id == second.Id {
+		t.Errorf("Expected distinct schema change ids, got %s twice", first.Id)
+	}
+	if got := receiveSchemaChange(t, cluster); got != first {
+		t.Errorf("Expected the first schema change to run first, got %s", got.Id)
+	}
+	if got := receiveSchemaChange(t, cluster); got != second {
+		t.Errorf("Expected the second schema change next, got %s", got.Id)
+	}
+	changes := cluster.GetSchemaChanges()
+	if len(changes) != 2 || changes[0].Id != second.Id || changes[1].State != ConstSchemaChangeQueued {
+		t.Errorf("Expected both changes queued, latest first, got %+v", changes)
+	}
+
+	// a queued change is cancelled at once, a running one before its next step
+	if err := cluster.CancelSchemaChange(first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if first.State != ConstSchemaChangeCancelled {
+		t.Errorf("Expected the queued change cancelled, got %s", first.State)
+	}
+	if err := cluster.CancelSchemaChange(first.Id); err == nil {
+		t.Error("Expected a cancelled change not to be cancelled again")
+	}
+	cluster.updateSchemaChange(second, false, func() { second.State = ConstSchemaChangeRunning })
+	if err := cluster.CancelSchemaChange(second.Id); err != nil {
+		t.Fatal(err)
+	}
+	if second.State != ConstSchemaChangeRunning || !cluster.isSchemaChangeCancelled(second) {
+		t.Errorf("Expected the running change to stop at its next step, got %s", second.State)
+	}
+	if err := cluster.waitSchemaChangeDelay(second); err != errSchemaChangeCancelled {
+		t.Errorf("Expected the cancelled change to stop, got %v", err)
+	}
+	if err := cluster.CancelSchemaChange("unknown"); err == nil {
+		t.Error("Expected an unknown change not to be cancelled")
+	}
+}
+
+func TestSchemaChangeRefused(t *testing.T) {
+	cluster, cleanup := newSchemaChangeTestCluster(t)
+	defer cleanup()
+	validate := func(server *ServerMonitor) error { return nil }
+	tests := []struct {
+		name   string
+		submit func() (*SchemaChange, error)
+	}{
+		{"no alter", func() (*SchemaChange, error) { return cluster.AlterTable("s", "t", " ", "") }},
+		{"several statements", func() (*SchemaChange, error) {
+			return cluster.AlterTable("s", "t", "ADD COLUMN c INT; DROP TABLE u", ConstSchemaChangeRolling)
+		}},
+		{"unknown method", func() (*SchemaChange, error) { return cluster.AlterTable("s", "t", "ADD COLUMN c INT", "copy") }},
+		{"long shadow table", func() (*SchemaChange, error) {
+			return cluster.AlterTable("s", strings.Repeat("t", 60), "ADD COLUMN c INT", ConstSchemaChangeShadow)
+		}},
+		{"no rollback", func() (*SchemaChange, error) {
+			return cluster.AlterTableWithValidation("s", "t", "ADD COLUMN c INT", " ", validate)
+		}},
+		{"no validation", func() (*SchemaChange, error) {
+			return cluster.AlterTableWithValidation("s", "t", "ADD COLUMN c INT", "DROP COLUMN c", nil)
+		}},
+		{"several rollback statements", func() (*SchemaChange, error) {
+			return cluster.AlterTableWithValidation("s", "t", "ADD COLUMN c INT", "DROP COLUMN c; DROP TABLE u", validate)
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.submit(); err == nil {
+			t.Errorf("%s: expected the schema change refused", tt.name)
+		}
+	}
+	if changes := cluster.GetSchemaChanges(); len(changes) != 0 {
+		t.Errorf("Expected no change queued, got %d", len(changes))
+	}
+
+	// 59 characters leave room for the shadow table and trigger names
+	sc, err := cluster.AlterTable("s", strings.Repeat("t", 59), "ADD COLUMN c INT", ConstSchemaChangeShadow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveSchemaChange(t, cluster)
+	for _, trigger := range cluster.getShadowTriggers(sc, []string{"`a`"}, []string{"`a`"}) {
+		name := strings.Fields(trigger)[2]
+		if len(name) != len("`s`.``")+64 {
+			t.Errorf("Expected a trigger name of 64 characters, got %s", name)
+		}
+	}
+}
+
+func TestIsInSchemaChange(t *testing.T) {
+	cluster, cleanup := newSchemaChangeTestCluster(t)
+	defer cleanup()
+	sc, err := cluster.AlterTable("s", "t", "ADD COLUMN c INT", ConstSchemaChangeRolling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveSchemaChange(t, cluster)
+	if cluster.IsInSchemaChange() {
+		t.Error("Expected a queued change not to block switchovers")
+	}
+	cluster.updateSchemaChange(sc, false, func() { sc.State = ConstSchemaChangeRunning })
+	if !cluster.IsInSchemaChange() {
+		t.Error("Expected a running change to block switchovers")
+	}
+	// the switchover of the rolling change itself is allowed
+	cluster.updateSchemaChange(sc, false, func() { sc.switchover = true })
+	if cluster.IsInSchemaChange() {
+		t.Error("Expected the switchover of a rolling change to be allowed")
+	}
+	cluster.updateSchemaChange(sc, false, func() {
+		sc.switchover = false
+		sc.State = ConstSchemaChangeDone
+	})
+	if cluster.IsInSchemaChange() {
+		t.Error("Expected a finished change not to block switchovers")
+	}
+}
+
+func TestShadowCopySQL(t *testing.T) {
+	cluster := &Cluster{}
+	sc := &SchemaChange{Schema: "s", Table: "t"}
+	triggers := cluster.getShadowTriggers(sc, []string{"`a`", "`b`", "`c`"}, []string{"`a`", "`b`"})
+	expected := []string{
+		"CREATE TRIGGER `s`.`_t_ins` AFTER INSERT ON `s`.`t` FOR EACH ROW REPLACE INTO `s`.`_t_new` (`a`,`b`,`c`) VALUES (NEW.`a`,NEW.`b`,NEW.`c`)",
+		"CREATE TRIGGER `s`.`_t_upd` AFTER UPDATE ON `s`.`t` FOR EACH ROW BEGIN DELETE IGNORE FROM `s`.`_t_new` WHERE `s`.`_t_new`.`a` <=> OLD.`a` AND `s`.`_t_new`.`b` <=> OLD.`b`; REPLACE INTO `s`.`_t_new` (`a`,`b`,`c`) VALUES (NEW.`a`,NEW.`b`,NEW.`c`); END",
+		"CREATE TRIGGER `s`.`_t_del` AFTER DELETE ON `s`.`t` FOR EACH ROW DELETE IGNORE FROM `s`.`_t_new` WHERE `s`.`_t_new`.`a` <=> OLD.`a` AND `s`.`_t_new`.`b` <=> OLD.`b`",
+	}
+	for i := range expected {
+		if i >= len(triggers) || triggers[i] != expected[i] {
+			t.Errorf("Expected trigger\n%s\ngot\n%v", expected[i], triggers)
+		}
+	}
+
+	tests := []struct {
+		lower, upper bool
+		where        string
+	}{
+		{false, false, ""},
+		{false, true, " WHERE (`a`,`b`) <= (?,?)"},
+		{true, true, " WHERE (`a`,`b`) > (?,?) AND (`a`,`b`) <= (?,?)"},
+		{true, false, " WHERE (`a`,`b`) > (?,?)"},
+	}
+	for _, tt := range tests {
+		if where := getShadowChunkWhere("`a`,`b`", 2, tt.lower, tt.upper); where != tt.where {
+			t.Errorf("Expected chunk bounds %q, got %q", tt.where, where)
+		}
+	}
+}
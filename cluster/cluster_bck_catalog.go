@@ -0,0 +1,495 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/crypto"
+	"github.com/signal18/replication-manager/utils/journal"
+)
+
+const (
+	ConstBackupCatalogRunning = "running"
+	ConstBackupCatalogDone    = "done"
+	ConstBackupCatalogFailed  = "failed"
+
+	ConstBackupTypeLogical  = "logical"
+	ConstBackupTypePhysical = "physical"
+
+	ConstBackupStorageLocal  = "local"
+	ConstBackupStorageRestic = "restic"
+)
+
+// BackupCatalogEntry describe one backup. The most recent backup of a tool
+// stays in the backup directory of its server where reseed and
+// point-in-time recovery find it, older ones are moved to the catalog
+// directory of the cluster until the retention removes them. Files are
+// relative to the location, the checksum is the sha256 of the files in
+// order and the duration is in seconds. The binlog coordinates are those of
+// the master at BinLogTime, Replica is set when they were read from the
+// replication coordinates of a replica.
+type BackupCatalogEntry struct {
+	Id           string    `json:"id"`
+	Type         string    `json:"type"`
+	Tool         string    `json:"tool"`
+	Source       string    `json:"source"`
+	Storage      string    `json:"storage"`
+	Location     string    `json:"location"`
+	Files        []string  `json:"files"`
+	BinLogFile   string    `json:"binLogFile"`
+	BinLogPos    uint64    `json:"binLogPos"`
+	Gtid         string    `json:"gtid"`
+	BinLogTime   time.Time `json:"binLogTime"`
+	Replica      bool      `json:"replica,omitempty"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum"`
+	Compressed   bool      `json:"compressed"`
+	Encrypted    bool      `json:"encrypted"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Duration     int64     `json:"duration"`
+	State        string    `json:"state"`
+	Verification string    `json:"verification,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// getPath return the path of the backup as listed for point-in-time
+// recovery, the directory for mydumper and the stream or dump file otherwise
+func (e *BackupCatalogEntry) getPath() string {
+	if e.Tool == config.ConstBackupLogicalTypeMydumper || len(e.Files) == 0 {
+		return e.Location + "/"
+	}
+	return e.Location + "/" + e.Files[0]
+}
+
+func (cluster *Cluster) getBackupCatalogFile() string {
+	return cluster.WorkingDir + "/backupcatalog.json"
+}
+
+func (cluster *Cluster) getBackupCatalogDir() string {
+	return cluster.Conf.WorkingDir + "/" + config.ConstStreamingSubDir + "/" + cluster.Name + "/catalog"
+}
+
+// loadBackupCatalog read the catalog, the caller hold backupCatalogMutex
+func (cluster *Cluster) loadBackupCatalog() []*BackupCatalogEntry {
+	var entries []*BackupCatalogEntry
+	content, err := ioutil.ReadFile(cluster.getBackupCatalogFile())
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not read backup catalog: %s", err)
+	}
+	return entries
+}
+
+func (cluster *Cluster) saveBackupCatalog(entries []*BackupCatalogEntry) {
+	saveJson, _ := json.MarshalIndent(entries, "", "\t")
+	if err := ioutil.WriteFile(cluster.getBackupCatalogFile(), saveJson, 0644); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save backup catalog: %s", err)
+	}
+}
+
+// GetBackupCatalog return the backups of the catalog and the restic
+// snapshots of the cluster, most recent first
+func (cluster *Cluster) GetBackupCatalog() []*BackupCatalogEntry {
+	cluster.backupCatalogMutex.Lock()
+	entries := cluster.loadBackupCatalog()
+	cluster.backupCatalogMutex.Unlock()
+	entries = append(entries, cluster.getResticBackupCatalog()...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Start.After(entries[j].Start) })
+	return entries
+}
+
+// GetBackupCatalogEntry return the backup or the restic snapshot with id
+func (cluster *Cluster) GetBackupCatalogEntry(id string) (*BackupCatalogEntry, error) {
+	for _, e := range cluster.GetBackupCatalog() {
+		if e.Id == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("Backup %s not found", id)
+}
+
+// getResticBackupCatalog map the restic snapshots of the cluster to catalog
+// entries, the snapshot paths are the backup directories of the servers
+func (cluster *Cluster) getResticBackupCatalog() []*BackupCatalogEntry {
+	var entries []*BackupCatalogEntry
+	backups := cluster.GetBackups()
+	for i := range backups {
+		bck := &backups[i]
+		e := &BackupCatalogEntry{Id: bck.ShortId, Tool: ConstBackupStorageRestic, Storage: ConstBackupStorageRestic, Location: cluster.Conf.BackupResticRepository, Files: bck.Paths, State: ConstBackupCatalogDone}
+		e.Start, _ = time.Parse(time.RFC3339Nano, bck.Time)
+		e.End = e.Start
+		for _, server := range cluster.Servers {
+			for _, path := range bck.Paths {
+				if strings.HasSuffix(strings.TrimSuffix(path, "/"), "/"+server.Host+"_"+server.Port) {
+					e.Source = server.URL
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// startBackupCatalogEntry register a running backup of the server. The
+// previous backup of the same tool is moved to the catalog directory before
+// the new one overwrites it, or removed when it did not complete.
+func (cluster *Cluster) startBackupCatalogEntry(server *ServerMonitor, tool string, files ...string) *BackupCatalogEntry {
+	e := &BackupCatalogEntry{
+		Tool:     tool,
+		Source:   server.URL,
+		Storage:  ConstBackupStorageLocal,
+		Location: strings.TrimSuffix(server.GetMyBackupDirectory(), "/"),
+		Files:    files,
+		Start:    time.Now(),
+		State:    ConstBackupCatalogRunning,
+	}
+	e.Id = e.Start.Format("20060102150405") + "-" + tool + "-" + server.Id
+	if tool == config.ConstBackupLogicalTypeMysqldump || tool == config.ConstBackupLogicalTypeMydumper {
+		e.Type = ConstBackupTypeLogical
+	} else {
+		e.Type = ConstBackupTypePhysical
+	}
+
+	cluster.backupCatalogMutex.Lock()
+	defer cluster.backupCatalogMutex.Unlock()
+	var entries []*BackupCatalogEntry
+	for _, prev := range cluster.loadBackupCatalog() {
+		if prev.Tool != tool || prev.Source != server.URL || prev.Location != e.Location {
+			entries = append(entries, prev)
+			continue
+		}
+		if prev.State != ConstBackupCatalogDone {
+			cluster.LogPrintf(LvlInfo, "Removing incomplete backup %s", prev.Id)
+			cluster.removeBackupCatalogFiles(prev)
+			continue
+		}
+		if err := cluster.archiveBackupCatalogEntry(prev); err != nil {
+			cluster.LogPrintf(LvlErr, "Could not move backup %s to the catalog: %s", prev.Id, err)
+		}
+		entries = append(entries, prev)
+	}
+	entries = append(entries, e)
+	cluster.saveBackupCatalog(entries)
+	return e
+}
+
+// archiveBackupCatalogEntry move the files of the backup to its own
+// directory in the catalog
+func (cluster *Cluster) archiveBackupCatalogEntry(e *BackupCatalogEntry) error {
+	dir := cluster.getBackupCatalogDir() + "/" + e.Id
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, file := range e.Files {
+		if err := os.Rename(e.Location+"/"+file, dir+"/"+file); err != nil {
+			return err
+		}
+		cluster.renameBackupStorageFile(e.Location+"/"+file, dir+"/"+file)
+	}
+	e.Location = dir
+	return nil
+}
+
+func (cluster *Cluster) removeBackupCatalogFiles(e *BackupCatalogEntry) {
+	for _, file := range e.Files {
+		cluster.removeBackupStorageFile(e.Location + "/" + file)
+	}
+	if strings.HasPrefix(e.Location, cluster.getBackupCatalogDir()+"/") {
+		os.RemoveAll(e.Location)
+		return
+	}
+	for _, file := range e.Files {
+		os.Remove(e.Location + "/" + file)
+	}
+}
+
+// getBackupCatalogFiles list the files written by mydumper in the backup
+// directory of the server
+func getBackupCatalogFiles(dir string) []string {
+	var files []string
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || name == "mysqldump.sql.gz" {
+			continue
+		}
+		if name == "metadata" || strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql.gz") {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// finishBackupCatalogEntry record the size, checksum and binlog coordinates
+// of the backup and apply the retention
+func (cluster *Cluster) finishBackupCatalogEntry(e *BackupCatalogEntry, err error) {
+	e.End = time.Now()
+	e.Duration = int64(e.End.Sub(e.Start).Seconds())
+	if e.Tool == config.ConstBackupLogicalTypeMydumper {
+		e.Files = getBackupCatalogFiles(e.Location)
+	}
+	if err == nil {
+		err = cluster.readBackupCatalogFiles(e)
+	}
+	if err == nil {
+		b := &PitrBackup{Type: e.Tool, Path: e.getPath(), Source: e.Source, Time: e.End}
+		if cerr := cluster.readBackupCoordinates(b); cerr != nil {
+			// xtrabackup_binlog_info is written last, a stream without it
+			// did not complete
+			if e.Type == ConstBackupTypePhysical {
+				err = fmt.Errorf("incomplete backup: %s", cerr)
+			} else {
+				e.Error = cerr.Error()
+			}
+		}
+		e.BinLogFile = b.BinLogFile
+		e.BinLogPos = b.BinLogPos
+		e.Gtid = b.Gtid
+		e.BinLogTime = b.Time
+		e.Replica = b.Replica
+	}
+	if err != nil {
+		e.State = ConstBackupCatalogFailed
+		e.Error = err.Error()
+		cluster.LogPrintf(LvlErr, "Backup %s %s of %s failed: %s", e.Tool, e.Id, e.Source, err)
+		cluster.LogEvent(journal.ConstEventJob, "backup-failed", e.Source, "", "Backup %s of %s failed: %s", e.Tool, e.Source, err)
+	} else {
+		e.State = ConstBackupCatalogDone
+		cluster.LogPrintf(LvlInfo, "Backup %s %s of %s done, %d bytes in %d s", e.Tool, e.Id, e.Source, e.Size, e.Duration)
+		cluster.LogEvent(journal.ConstEventJob, "backup-done", e.Source, "", "Backup %s of %s done, %d bytes in %d s", e.Tool, e.Source, e.Size, e.Duration)
+	}
+
+	cluster.backupCatalogMutex.Lock()
+	entries := cluster.loadBackupCatalog()
+	for i := range entries {
+		if entries[i].Id == e.Id {
+			entries[i] = e
+		}
+	}
+	cluster.saveBackupCatalog(entries)
+	cluster.backupCatalogMutex.Unlock()
+
+	if e.State == ConstBackupCatalogDone {
+		cluster.purgeBackupCatalog()
+	}
+}
+
+// getPitrCatalogBackups return the backups moved to the catalog directory
+// with the binlog coordinates recorded when they completed, the latest
+// backup of each tool stays in the server directory and is listed by
+// listBackups
+func (cluster *Cluster) getPitrCatalogBackups() []*PitrBackup {
+	var backups []*PitrBackup
+	cluster.backupCatalogMutex.Lock()
+	entries := cluster.loadBackupCatalog()
+	cluster.backupCatalogMutex.Unlock()
+	for _, e := range entries {
+		if e.State != ConstBackupCatalogDone || e.Storage != ConstBackupStorageLocal || e.BinLogFile == "" || !strings.HasPrefix(e.Location, cluster.getBackupCatalogDir()+"/") {
+			continue
+		}
+		b := &PitrBackup{Type: e.Tool, Path: e.getPath(), Source: e.Source, Time: e.BinLogTime, BinLogFile: e.BinLogFile, BinLogPos: e.BinLogPos, Gtid: e.Gtid, Replica: e.Replica}
+		// catalogs saved before the time of the coordinates was recorded
+		if b.Time.IsZero() {
+			b.Time = e.End
+		}
+		backups = append(backups, b)
+	}
+	return backups
+}
+
+func (cluster *Cluster) readBackupCatalogFiles(e *BackupCatalogEntry) error {
+	if len(e.Files) == 0 {
+		return errors.New("no backup file")
+	}
+	e.Size = 0
+	h := sha256.New()
+	for _, file := range e.Files {
+		f, err := os.Open(e.Location + "/" + file)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		e.Size += n
+		if strings.HasSuffix(file, ".gz") {
+			e.Compressed = true
+		}
+		if crypto.IsEncryptedFile(e.Location + "/" + file) {
+			e.Encrypted = true
+		}
+	}
+	if e.Size == 0 {
+		return errors.New("empty backup")
+	}
+	e.Checksum = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// setBackupCatalogVerification record the result of the verification of
+// the backup at path
+func (cluster *Cluster) setBackupCatalogVerification(path string, result string) {
+	cluster.backupCatalogMutex.Lock()
+	defer cluster.backupCatalogMutex.Unlock()
+	entries := cluster.loadBackupCatalog()
+	for _, e := range entries {
+		if e.getPath() == path {
+			e.Verification = result
+			cluster.saveBackupCatalog(entries)
+			return
+		}
+	}
+}
+
+// getBackupRetention return the ids of the backups kept by the hourly,
+// daily, weekly, monthly and yearly policies, counted per tool and server
+// the way restic forget does. The last backup of each tool and server is
+// always kept.
+func getBackupRetention(entries []*BackupCatalogEntry, hourly int, daily int, weekly int, monthly int, yearly int) map[string]bool {
+	policies := []struct {
+		keep   int
+		bucket func(t time.Time) string
+	}{
+		{hourly, func(t time.Time) string { return t.Format("2006010215") }},
+		{daily, func(t time.Time) string { return t.Format("20060102") }},
+		{weekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", y, w)
+		}},
+		{monthly, func(t time.Time) string { return t.Format("200601") }},
+		{yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	groups := make(map[string][]*BackupCatalogEntry)
+	for _, e := range entries {
+		if e.State == ConstBackupCatalogDone {
+			groups[e.Tool+"/"+e.Source] = append(groups[e.Tool+"/"+e.Source], e)
+		}
+	}
+	kept := make(map[string]bool)
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].Start.After(group[j].Start) })
+		kept[group[0].Id] = true
+		for _, p := range policies {
+			count := 0
+			last := ""
+			for _, e := range group {
+				if count >= p.keep {
+					break
+				}
+				if b := p.bucket(e.Start); b != last {
+					kept[e.Id] = true
+					last = b
+					count++
+				}
+			}
+		}
+	}
+	return kept
+}
+
+// purgeBackupCatalog remove the backups not kept by the retention, restic
+// snapshots are purged by ResticPurgeRepo
+func (cluster *Cluster) purgeBackupCatalog() {
+	cluster.backupCatalogMutex.Lock()
+	defer cluster.backupCatalogMutex.Unlock()
+	entries := cluster.loadBackupCatalog()
+	kept := getBackupRetention(entries, cluster.Conf.BackupKeepHourly, cluster.Conf.BackupKeepDaily, cluster.Conf.BackupKeepWeekly, cluster.Conf.BackupKeepMonthly, cluster.Conf.BackupKeepYearly)
+	var remaining []*BackupCatalogEntry
+	for _, e := range entries {
+		if e.State != ConstBackupCatalogDone || kept[e.Id] {
+			remaining = append(remaining, e)
+			continue
+		}
+		cluster.LogPrintf(LvlInfo, "Removing backup %s of %s from %s, not kept by retention", e.Id, e.Source, e.Start.Format("2006-01-02 15:04:05"))
+		cluster.removeBackupCatalogFiles(e)
+	}
+	if len(remaining) != len(entries) {
+		cluster.saveBackupCatalog(remaining)
+	}
+}
+
+// DeleteBackupCatalogEntry remove the files of a backup and its entry in the
+// catalog
+func (cluster *Cluster) DeleteBackupCatalogEntry(id string) error {
+	cluster.backupCatalogMutex.Lock()
+	defer cluster.backupCatalogMutex.Unlock()
+	entries := cluster.loadBackupCatalog()
+	for i, e := range entries {
+		if e.Id != id {
+			continue
+		}
+		if e.State == ConstBackupCatalogRunning {
+			return fmt.Errorf("Backup %s is running", id)
+		}
+		cluster.removeBackupCatalogFiles(e)
+		cluster.saveBackupCatalog(append(entries[:i], entries[i+1:]...))
+		cluster.LogPrintf(LvlInfo, "Deleted backup %s of %s", e.Id, e.Source)
+		return nil
+	}
+	for _, e := range cluster.getResticBackupCatalog() {
+		if e.Id == id {
+			return fmt.Errorf("Backup %s is a restic snapshot, it is purged by restic retention", id)
+		}
+	}
+	return fmt.Errorf("Backup %s not found", id)
+}
+
+// WriteBackupCatalogArchive write the files of a backup to w as a tar.gz
+// archive
+func (cluster *Cluster) WriteBackupCatalogArchive(e *BackupCatalogEntry, w io.Writer) error {
+	if e.Storage != ConstBackupStorageLocal {
+		return fmt.Errorf("Backup %s is not stored locally", e.Id)
+	}
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, file := range e.Files {
+		f, err := os.Open(e.Location + "/" + file)
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err == nil {
+			err = tw.WriteHeader(&tar.Header{Name: e.Id + "/" + file, Mode: 0600, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
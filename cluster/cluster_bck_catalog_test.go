@@ -0,0 +1,46 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackupRetention(t *testing.T) {
+	var entries []*BackupCatalogEntry
+	start := time.Date(2021, 6, 30, 23, 0, 0, 0, time.UTC)
+	// one backup every 12 hours for 60 days
+	for i := 0; i < 120; i++ {
+		e := &BackupCatalogEntry{Id: fmt.Sprintf("m%d", i), Tool: "mysqldump", Source: "db1:3306", State: ConstBackupCatalogDone, Start: start.Add(-time.Duration(i) * 12 * time.Hour)}
+		entries = append(entries, e)
+	}
+	entries = append(entries,
+		&BackupCatalogEntry{Id: "failed", Tool: "mysqldump", Source: "db1:3306", State: ConstBackupCatalogFailed, Start: start.Add(time.Hour)},
+		&BackupCatalogEntry{Id: "other", Tool: "mariabackup", Source: "db2:3306", State: ConstBackupCatalogDone, Start: start.AddDate(-1, 0, 0)},
+	)
+
+	kept := getBackupRetention(entries, 1, 2, 2, 2, 1)
+	// last of the hour and of 2 days, of the week of June 27th and of May
+	for _, id := range []string{"m0", "m2", "m6", "m60", "other"} {
+		if !kept[id] {
+			t.Errorf("Backup %s should be kept", id)
+		}
+	}
+	if len(kept) != 5 {
+		t.Errorf("Unexpected backups kept %v", kept)
+	}
+
+	kept = getBackupRetention(entries, 0, 0, 0, 0, 0)
+	if len(kept) != 2 || !kept["m0"] || !kept["other"] {
+		t.Errorf("Only the last backup of each tool should be kept, got %v", kept)
+	}
+}
@@ -0,0 +1,345 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/crypto"
+	"github.com/signal18/replication-manager/utils/journal"
+)
+
+// backupKeyWrapper wrap the data keys of the backups with the Vault transit
+// key when Vault can be reached, with the local keyring otherwise. Data keys
+// wrapped by either of them are unwrapped whatever the active one.
+type backupKeyWrapper struct {
+	cluster *Cluster
+	keyring *crypto.Keyring
+	vault   *vault.Client
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type backupReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (cluster *Cluster) getBackupKeyringPath() string {
+	if cluster.Conf.BackupEncryptKeyring != "" {
+		return cluster.Conf.BackupEncryptKeyring
+	}
+	return cluster.Conf.WorkingDir + "/backup.keyring"
+}
+
+// getBackupTransitKeyId return the key id of the Vault transit key stored in
+// the header of the encrypted files
+func (cluster *Cluster) getBackupTransitKeyId() string {
+	return "vault:" + cluster.Conf.BackupEncryptVaultMount + "/" + cluster.Conf.BackupEncryptVaultKey
+}
+
+func (cluster *Cluster) useBackupVault() bool {
+	return cluster.Conf.BackupEncryptVaultKey != "" && cluster.Conf.IsVaultUsed() && cluster.CanConnectVault && crypto.CheckKeyId(cluster.getBackupTransitKeyId()) == nil
+}
+
+// checkBackupEncryptConfig report at load a Vault transit key whose id does
+// not fit in the header of the encrypted files, the keyring wraps the data
+// keys instead
+func (cluster *Cluster) checkBackupEncryptConfig() {
+	if cluster.Conf.BackupEncryptVaultKey == "" {
+		return
+	}
+	if err := crypto.CheckKeyId(cluster.getBackupTransitKeyId()); err != nil {
+		cluster.LogPrintf(LvlErr, "Invalid backup-encrypt-vault-transit-key, backups are wrapped by the keyring: %s", err)
+	}
+}
+
+// InitBackupKeyring create the local keyring with a first key, an existing
+// keyring is never replaced
+func (cluster *Cluster) InitBackupKeyring() error {
+	cluster.backupKeyMutex.Lock()
+	defer cluster.backupKeyMutex.Unlock()
+	keyring, err := crypto.InitKeyring(cluster.getBackupKeyringPath())
+	if err != nil {
+		return fmt.Errorf("Init backup keyring: %s", err)
+	}
+	cluster.LogEvent(journal.ConstEventJob, "backup-key-init", "", "", "Backup keyring %s initialized with key %s", cluster.getBackupKeyringPath(), keyring.ActiveKey())
+	return nil
+}
+
+// getBackupKeyWrapper load the keyring, it may be missing when Vault wraps
+// the data keys
+func (cluster *Cluster) getBackupKeyWrapper() (*backupKeyWrapper, error) {
+	cluster.backupKeyMutex.Lock()
+	defer cluster.backupKeyMutex.Unlock()
+	keyring, err := crypto.LoadKeyring(cluster.getBackupKeyringPath())
+	if os.IsNotExist(err) {
+		if !cluster.useBackupVault() {
+			return nil, fmt.Errorf("No backup keyring %s, initialize it with the backup-key-init action", cluster.getBackupKeyringPath())
+		}
+		keyring, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	kw := &backupKeyWrapper{cluster: cluster, keyring: keyring}
+	if cluster.useBackupVault() {
+		kw.vault, err = cluster.GetVaultConnection()
+		if err != nil || kw.vault == nil {
+			kw.vault = nil
+			if keyring == nil {
+				return nil, fmt.Errorf("Backup encryption can not connect Vault and there is no keyring: %v", err)
+			}
+			cluster.LogPrintf(LvlWarn, "Backup encryption can not connect Vault, using the keyring: %v", err)
+		}
+	}
+	return kw, nil
+}
+
+func (kw *backupKeyWrapper) WrapKey(key []byte) (string, []byte, error) {
+	if kw.vault != nil {
+		secret, err := kw.vault.Logical().Write(kw.cluster.Conf.BackupEncryptVaultMount+"/encrypt/"+kw.cluster.Conf.BackupEncryptVaultKey, map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(key),
+		})
+		if err == nil && secret != nil {
+			if ciphertext, ok := secret.Data["ciphertext"].(string); ok {
+				return kw.cluster.getBackupTransitKeyId(), []byte(ciphertext), nil
+			}
+			err = errors.New("no ciphertext in response")
+		}
+		kw.cluster.LogPrintf(LvlWarn, "Vault transit key %s can not wrap the backup key, using the keyring: %s", kw.cluster.Conf.BackupEncryptVaultKey, err)
+	}
+	if kw.keyring == nil {
+		return "", nil, fmt.Errorf("No backup keyring %s to wrap the backup key", kw.cluster.getBackupKeyringPath())
+	}
+	return kw.keyring.WrapKey(key)
+}
+
+// UnwrapKey decrypt the data key with the transit key named in the id, a
+// Vault connection is opened for backups wrapped by Vault
+func (kw *backupKeyWrapper) UnwrapKey(id string, wrapped []byte) ([]byte, error) {
+	if !strings.HasPrefix(id, "vault:") {
+		if kw.keyring == nil {
+			return nil, fmt.Errorf("Backup key wrapped by %s needs the keyring %s", id, kw.cluster.getBackupKeyringPath())
+		}
+		return kw.keyring.UnwrapKey(id, wrapped)
+	}
+	if kw.vault == nil {
+		client, err := kw.cluster.GetVaultConnection()
+		if err != nil || client == nil {
+			return nil, fmt.Errorf("Backup key wrapped by %s needs Vault: %v", id, err)
+		}
+		kw.vault = client
+	}
+	path := strings.TrimPrefix(id, "vault:")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("Invalid transit key %s", id)
+	}
+	secret, err := kw.vault.Logical().Write(path[:i]+"/decrypt/"+path[i+1:], map[string]interface{}{
+		"ciphertext": string(wrapped),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("Vault transit decrypt returned nothing")
+	}
+	plaintext, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("no plaintext in Vault transit response")
+	}
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// NewBackupWriter return a writer encrypting to w when backup-encrypt is
+// set, the writer must be closed before w
+func (cluster *Cluster) NewBackupWriter(w io.Writer) (io.WriteCloser, error) {
+	if !cluster.Conf.BackupEncrypt {
+		return nopWriteCloser{w}, nil
+	}
+	kw, err := cluster.getBackupKeyWrapper()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewEncryptWriter(w, kw)
+}
+
+// OpenBackupFile open a backup file for reading, encrypted files are
+// decrypted whatever backup-encrypt
+func (cluster *Cluster) OpenBackupFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !crypto.IsEncryptedFile(path) {
+		return f, nil
+	}
+	kw, err := cluster.getBackupKeyWrapper()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := crypto.NewDecryptReader(f, kw)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("decrypt %s: %s", path, err)
+	}
+	return backupReadCloser{Reader: r, Closer: f}, nil
+}
+
+// encryptBackupFile encrypt in place a file written by an external tool,
+// mydumper files and binlogs, keeping its modification time. The file is in
+// clear on disk until then, the tools can not write to a stream.
+func (cluster *Cluster) encryptBackupFile(path string) error {
+	if !cluster.Conf.BackupEncrypt || crypto.IsEncryptedFile(path) {
+		return nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w, err := cluster.NewBackupWriter(out)
+	if err == nil {
+		_, err = io.Copy(w, in)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	os.Chtimes(path+".tmp", fi.ModTime(), fi.ModTime())
+	return os.Rename(path+".tmp", path)
+}
+
+// getClearBackupFiles return a directory where the files can be read in
+// clear by tools like myloader or mysqlbinlog. Encrypted files are decrypted
+// in a temporary directory with links to the others, removed by the returned
+// function.
+func (cluster *Cluster) getClearBackupFiles(dir string, files []string) (string, func(), error) {
+	encrypted := false
+	for _, file := range files {
+		if crypto.IsEncryptedFile(dir + file) {
+			encrypted = true
+		}
+	}
+	if !encrypted {
+		return dir, func() {}, nil
+	}
+	tmp, err := ioutil.TempDir(cluster.WorkingDir, "decrypt")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	for _, file := range files {
+		if !crypto.IsEncryptedFile(dir + file) {
+			if err := os.Symlink(dir+file, tmp+"/"+file); err != nil {
+				cleanup()
+				return "", nil, err
+			}
+			continue
+		}
+		if err := cluster.decryptBackupFile(dir+file, tmp+"/"+file); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return tmp + "/", cleanup, nil
+}
+
+func (cluster *Cluster) decryptBackupFile(src string, dst string) error {
+	in, err := cluster.OpenBackupFile(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// RotateBackupKey make a new key encryption key active, a new keyring key or
+// a new version of the Vault transit key, and wrap again the data keys of
+// every encrypted backup and binlog of the cluster. Older keys stay in the
+// keyring until removed by hand. It return the number of files rewrapped.
+func (cluster *Cluster) RotateBackupKey() (int, error) {
+	if _, err := os.Stat(cluster.getBackupKeyringPath()); os.IsNotExist(err) && !cluster.Conf.BackupEncrypt {
+		return 0, errors.New("Backup encryption is not enabled")
+	}
+	kw, err := cluster.getBackupKeyWrapper()
+	if err != nil {
+		return 0, err
+	}
+	if kw.vault != nil {
+		_, err = kw.vault.Logical().Write(cluster.Conf.BackupEncryptVaultMount+"/keys/"+cluster.Conf.BackupEncryptVaultKey+"/rotate", nil)
+	} else {
+		cluster.backupKeyMutex.Lock()
+		_, err = kw.keyring.AddKey(cluster.getBackupKeyringPath())
+		cluster.backupKeyMutex.Unlock()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Rotate backup key: %s", err)
+	}
+
+	count := 0
+	var failed []string
+	root := cluster.Conf.WorkingDir + "/" + config.ConstStreamingSubDir + "/" + cluster.Name
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		ok, err := crypto.RewrapFile(path, kw)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not rewrap backup key of %s: %s", path, err)
+			failed = append(failed, path)
+		} else if ok {
+			count++
+		}
+		return nil
+	})
+	cluster.LogEvent(journal.ConstEventJob, "backup-key-rotate", "", "", "Backup key rotated, %d files rewrapped, %d failed", count, len(failed))
+	if len(failed) > 0 {
+		return count, fmt.Errorf("Could not rewrap %d files: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return count, nil
+}
@@ -0,0 +1,78 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/crypto"
+)
+
+func TestBackupKeyringInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backupkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{}
+	cluster.Conf.WorkingDir = dir
+	cluster.Conf.BackupEncrypt = true
+
+	if _, err := cluster.NewBackupWriter(ioutil.Discard); err == nil {
+		t.Error("Expected encrypted backups refused without a keyring")
+	}
+	if _, err := os.Stat(cluster.getBackupKeyringPath()); !os.IsNotExist(err) {
+		t.Fatalf("Expected no keyring created on first use, got %v", err)
+	}
+	if err := cluster.InitBackupKeyring(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.InitBackupKeyring(); err == nil {
+		t.Error("Expected an existing keyring not to be replaced")
+	}
+
+	var buf bytes.Buffer
+	w, err := cluster.NewBackupWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("dump"))
+	w.Close()
+	kw, err := cluster.getBackupKeyWrapper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := crypto.NewDecryptReader(bytes.NewReader(buf.Bytes()), kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || string(got) != "dump" {
+		t.Errorf("Expected the backup decrypted with the initialized keyring, got %q %v", got, err)
+	}
+}
+
+func TestBackupTransitKeyId(t *testing.T) {
+	cluster := &Cluster{CanConnectVault: true}
+	cluster.Conf.VaultServerAddr = "https://vault:8200"
+	cluster.Conf.BackupEncryptVaultMount = "transit"
+	cluster.Conf.BackupEncryptVaultKey = "backup"
+	if !cluster.useBackupVault() {
+		t.Errorf("Expected Vault to wrap the keys with %s", cluster.getBackupTransitKeyId())
+	}
+	// the key id must fit in the header of the encrypted files
+	cluster.Conf.BackupEncryptVaultKey = strings.Repeat("k", 64)
+	if cluster.useBackupVault() {
+		t.Errorf("Expected the transit key %s refused", cluster.getBackupTransitKeyId())
+	}
+}
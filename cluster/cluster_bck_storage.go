@@ -0,0 +1,155 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	goofys "github.com/signal18/replication-manager/goofys/api"
+	common "github.com/signal18/replication-manager/goofys/api/common"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/storage"
+)
+
+// The backup storage mirror the backups and the crash files of the working
+// dir, keys are the paths relative to the working dir. Local copies are kept
+// for reseed and point-in-time recovery.
+func (cluster *Cluster) initBackupStorage() {
+	var err error
+	partSize := cluster.Conf.BackupStoragePartSize * 1024 * 1024
+	switch cluster.Conf.BackupStorage {
+	case "":
+		return
+	case config.ConstBackupStorageTypeLocal:
+		cluster.BackupStorage, err = storage.NewLocal(cluster.Conf.BackupStoragePath)
+	case config.ConstBackupStorageTypeS3:
+		conf := (&common.S3Config{
+			AccessKey: cluster.Conf.BackupStreamingAwsAccessKeyId,
+			SecretKey: cluster.Conf.GetDecryptedValue("backup-streaming-aws-access-secret"),
+			Region:    cluster.Conf.BackupStreamingRegion,
+			RegionSet: cluster.Conf.BackupStreamingRegion != "",
+		}).Init()
+		flags := &common.FlagStorage{
+			Endpoint:    cluster.Conf.BackupStreamingEndpoint,
+			HTTPTimeout: 30 * time.Second,
+			DebugS3:     cluster.Conf.BackupStreamingDebug,
+		}
+		cluster.BackupStorage, err = goofys.NewS3Storage(cluster.Conf.BackupStreamingBucket, flags, conf, partSize)
+	case config.ConstBackupStorageTypeAzure:
+		endpoint := cluster.Conf.BackupStorageAzureEndpoint
+		if endpoint == "" {
+			endpoint = "https://" + cluster.Conf.BackupStorageAzureAccount + ".blob.core.windows.net/"
+		}
+		cluster.BackupStorage, err = goofys.NewAzureStorage(cluster.Conf.BackupStorageAzureContainer, &common.AZBlobConfig{
+			Endpoint:    endpoint,
+			AccountName: cluster.Conf.BackupStorageAzureAccount,
+			AccountKey:  cluster.Conf.GetDecryptedValue("backup-storage-azure-key"),
+		}, partSize)
+	default:
+		err = fmt.Errorf("unknown storage type %s", cluster.Conf.BackupStorage)
+	}
+	if err != nil {
+		cluster.BackupStorage = nil
+		cluster.LogPrintf(LvlErr, "Backup storage %s disabled: %s", cluster.Conf.BackupStorage, err)
+		return
+	}
+	cluster.LogPrintf(LvlInfo, "Backup storage %s", cluster.BackupStorage)
+}
+
+func (cluster *Cluster) getBackupStorageKey(path string) string {
+	return cluster.Conf.BackupStoragePrefix + strings.TrimPrefix(path, cluster.Conf.WorkingDir+"/")
+}
+
+func (cluster *Cluster) setBackupStorageError(path string, err error) {
+	cluster.LogPrintf(LvlErr, "Backup storage copy of %s failed: %s", path, err)
+	cluster.SetState("WARN0107", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["WARN0107"], cluster.BackupStorage, path, err), ErrFrom: "BACKUP"})
+}
+
+// backupStorageWriter is the storage copy of a stream, a storage failure
+// does not fail the local file
+type backupStorageWriter struct {
+	cluster *Cluster
+	path    string
+	w       storage.Writer
+	err     error
+}
+
+// createBackupStorageWriter return the writer of the storage copy of a file
+// written by a stream, nil without storage
+func (cluster *Cluster) createBackupStorageWriter(path string) *backupStorageWriter {
+	if cluster.BackupStorage == nil {
+		return nil
+	}
+	w, err := cluster.BackupStorage.Create(cluster.getBackupStorageKey(path))
+	if err != nil {
+		cluster.setBackupStorageError(path, err)
+		return nil
+	}
+	return &backupStorageWriter{cluster: cluster, path: path, w: w}
+}
+
+func (sw *backupStorageWriter) Write(p []byte) (int, error) {
+	if sw.err == nil {
+		if _, sw.err = sw.w.Write(p); sw.err != nil {
+			sw.w.Abort()
+			sw.cluster.setBackupStorageError(sw.path, sw.err)
+		}
+	}
+	return len(p), nil
+}
+
+// finish commit the storage copy when the stream succeeded
+func (sw *backupStorageWriter) finish(err error) {
+	if sw == nil || sw.err != nil {
+		return
+	}
+	if err != nil {
+		sw.w.Abort()
+		return
+	}
+	if err := sw.w.Close(); err != nil {
+		sw.cluster.setBackupStorageError(sw.path, err)
+	}
+}
+
+// uploadBackupStorageFile copy a file written by an external tool, mydumper
+// files, binlogs and crash files
+func (cluster *Cluster) uploadBackupStorageFile(path string) {
+	if cluster.BackupStorage == nil {
+		return
+	}
+	if err := storage.Upload(cluster.BackupStorage, path, cluster.getBackupStorageKey(path)); err != nil {
+		cluster.setBackupStorageError(path, err)
+	}
+}
+
+func (cluster *Cluster) renameBackupStorageFile(from string, to string) {
+	if cluster.BackupStorage == nil {
+		return
+	}
+	err := cluster.BackupStorage.Rename(cluster.getBackupStorageKey(from), cluster.getBackupStorageKey(to))
+	if err != nil && !os.IsNotExist(err) {
+		cluster.setBackupStorageError(from, err)
+	}
+}
+
+func (cluster *Cluster) removeBackupStorageFile(path string) {
+	if cluster.BackupStorage == nil {
+		return
+	}
+	err := cluster.BackupStorage.Remove(cluster.getBackupStorageKey(path))
+	if err != nil && !os.IsNotExist(err) {
+		cluster.LogPrintf(LvlWarn, "Backup storage remove of %s failed: %s", path, err)
+	}
+}
@@ -0,0 +1,498 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	ConstBackupVerifyPassed = "passed"
+	ConstBackupVerifyFailed = "failed"
+)
+
+// BackupVerifyTable is the result of the checks of one restored table, the
+// checksum is the one of CheckTableChecksum over the whole table, the source
+// rows and checksum are the ones of the replica it is compared with
+type BackupVerifyTable struct {
+	Schema         string `json:"schema"`
+	Table          string `json:"table"`
+	Status         string `json:"status"`
+	Check          string `json:"check"`
+	Rows           int64  `json:"rows"`
+	Checksum       string `json:"checksum"`
+	SourceRows     int64  `json:"sourceRows"`
+	SourceChecksum string `json:"sourceChecksum"`
+	Message        string `json:"message,omitempty"`
+}
+
+// BackupVerification is the result of the test restore of a backup in a
+// local sandbox instance, timings are in milliseconds
+type BackupVerification struct {
+	Id          string              `json:"id"`
+	Cluster     string              `json:"cluster"`
+	Backup      *PitrBackup         `json:"backup"`
+	Sandbox     string              `json:"sandbox"`
+	Replica     string              `json:"replica,omitempty"`
+	State       string              `json:"state"`
+	Tables      []BackupVerifyTable `json:"tables"`
+	RestoreTime int64               `json:"restoreTime"`
+	CheckTime   int64               `json:"checkTime"`
+	Start       time.Time           `json:"start"`
+	End         time.Time           `json:"end"`
+	Error       string              `json:"error,omitempty"`
+}
+
+func (cluster *Cluster) saveBackupVerification(v *BackupVerification) {
+	dir := cluster.getPitrReportDir()
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		saveJson, _ := json.MarshalIndent(v, "", "\t")
+		err = ioutil.WriteFile(dir+"/backupverify."+v.Id+".json", saveJson, 0644)
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save backup verification: %s", err)
+	}
+}
+
+// GetBackupVerifications return the backup verifications, most recent first
+func (cluster *Cluster) GetBackupVerifications() []*BackupVerification {
+	verifications := []*BackupVerification{}
+	dir := cluster.getPitrReportDir()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return verifications
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "backupverify.") {
+			continue
+		}
+		content, err := ioutil.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			continue
+		}
+		v := new(BackupVerification)
+		if json.Unmarshal(content, v) == nil {
+			verifications = append(verifications, v)
+		}
+	}
+	sort.Slice(verifications, func(i, j int) bool { return verifications[i].Start.After(verifications[j].Start) })
+	return verifications
+}
+
+// getVerifyBackups return the most recent logical and physical backups
+func (cluster *Cluster) getVerifyBackups() []*PitrBackup {
+	var logical, physical *PitrBackup
+	for _, b := range cluster.listBackups() {
+		if b.Type == config.ConstBackupLogicalTypeMysqldump || b.Type == config.ConstBackupLogicalTypeMydumper {
+			if logical == nil || b.Time.After(logical.Time) {
+				logical = b
+			}
+		} else if physical == nil || b.Time.After(physical.Time) {
+			physical = b
+		}
+	}
+	var backups []*PitrBackup
+	if logical != nil {
+		backups = append(backups, logical)
+	}
+	if physical != nil {
+		backups = append(backups, physical)
+	}
+	return backups
+}
+
+// VerifyBackups restore the latest logical and the latest physical backup
+// one after the other in a local sandbox instance, check the tables and
+// compare them with the server the backup was taken from
+func (cluster *Cluster) VerifyBackups() ([]*BackupVerification, error) {
+	cluster.Lock()
+	if cluster.backupVerifyRunning {
+		cluster.Unlock()
+		return nil, errors.New("Backup verification is running")
+	}
+	cluster.backupVerifyRunning = true
+	cluster.Unlock()
+	defer func() {
+		cluster.Lock()
+		cluster.backupVerifyRunning = false
+		cluster.Unlock()
+	}()
+
+	backups := cluster.getVerifyBackups()
+	if len(backups) == 0 {
+		cluster.LogPrintf(LvlWarn, "No backup to verify")
+		return nil, errors.New("No backup to verify")
+	}
+	var verifications []*BackupVerification
+	for _, b := range backups {
+		verifications = append(verifications, cluster.verifyBackup(b))
+	}
+	return verifications, nil
+}
+
+func (cluster *Cluster) verifyBackup(b *PitrBackup) *BackupVerification {
+	v := &BackupVerification{Cluster: cluster.Name, Backup: b, Start: time.Now()}
+	v.Id = v.Start.Format("20060102150405") + "." + b.Type
+	_, span := cluster.StartSpan("Job.backup-verify")
+	cluster.LogPrintf(LvlInfo, "Verifying %s backup %s of %s", b.Type, b.Path, b.Source)
+	err := cluster.runBackupVerify(v)
+	endSpan(span, err)
+	v.End = time.Now()
+	if err != nil {
+		v.State = ConstBackupVerifyFailed
+		v.Error = err.Error()
+		cluster.LogPrintf(LvlErr, "Verification of %s backup %s failed: %s", b.Type, b.Path, err)
+		cluster.SetState("ERR00096", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00096"], b.Type, b.Path, err), ErrFrom: "BACKUP", ServerUrl: b.Source})
+		cluster.LogEvent(journal.ConstEventJob, "backup-verify-failed", b.Source, "", "Verification of %s backup %s failed: %s", b.Type, b.Path, err)
+	} else {
+		v.State = ConstBackupVerifyPassed
+		cluster.LogPrintf(LvlInfo, "Verification of %s backup %s passed, %d tables restored in %d ms and checked in %d ms", b.Type, b.Path, len(v.Tables), v.RestoreTime, v.CheckTime)
+		cluster.LogEvent(journal.ConstEventJob, "backup-verify-passed", b.Source, "", "Verification of %s backup %s passed, %d tables", b.Type, b.Path, len(v.Tables))
+	}
+	cluster.saveBackupVerification(v)
+	cluster.setBackupCatalogVerification(b.Path, v.State)
+	return v
+}
+
+func (cluster *Cluster) runBackupVerify(v *BackupVerification) error {
+	if cluster.Conf.TunnelHost != "" {
+		return errors.New("sandbox is not supported through an ssh tunnel")
+	}
+	tools := []string{cluster.Conf.ProvDBBinaryBasedir + "/mysqld"}
+	switch v.Backup.Type {
+	case config.ConstBackupLogicalTypeMysqldump:
+		tools = append(tools, cluster.GetMysqlclientPath())
+	case config.ConstBackupLogicalTypeMydumper:
+		tools = append(tools, cluster.GetMyLoaderPath())
+	default:
+		tools = append(tools, cluster.getBackupStreamPath(v.Backup.Type), cluster.Conf.ProvDBClientBasedir+"/"+v.Backup.Type)
+	}
+	for _, tool := range tools {
+		if _, err := os.Stat(tool); err != nil {
+			return err
+		}
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(cluster.Conf.BackupVerifyPort)
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("sandbox port %s is already in use", addr)
+	}
+
+	sandbox, err := cluster.newServerMonitor(addr, cluster.GetDbUser(), cluster.GetDbPass(), false, "")
+	if err != nil {
+		return err
+	}
+	sandbox.TLSConfigUsed = ConstTLSNoConfig
+	sandbox.SetDSN()
+	v.Sandbox = sandbox.URL
+	defer cluster.dropBackupVerifySandbox(sandbox)
+	os.RemoveAll(sandbox.Datadir + "/var")
+	os.MkdirAll(sandbox.Datadir+"/var", os.ModePerm)
+
+	start := time.Now()
+	switch v.Backup.Type {
+	case config.ConstBackupLogicalTypeMysqldump:
+		if err = cluster.provisionBackupVerifySandbox(sandbox); err == nil {
+			err = cluster.restoreMysqldump(v.Backup.Path, sandbox)
+		}
+	case config.ConstBackupLogicalTypeMydumper:
+		if err = cluster.provisionBackupVerifySandbox(sandbox); err == nil {
+			err = cluster.restoreMydumper(v.Backup.Path, sandbox)
+		}
+	default:
+		err = cluster.restoreBackupVerifyPhysical(v.Backup, sandbox)
+	}
+	v.RestoreTime = time.Since(start).Milliseconds()
+	if err != nil {
+		return fmt.Errorf("restore: %s", err)
+	}
+
+	start = time.Now()
+	err = cluster.checkBackupVerify(v, sandbox)
+	v.CheckTime = time.Since(start).Milliseconds()
+	return err
+}
+
+// getBackupStreamPath return the xbstream extractor shipped with the tool
+func (cluster *Cluster) getBackupStreamPath(tool string) string {
+	if tool == config.ConstBackupPhysicalTypeMariaBackup {
+		return cluster.Conf.ProvDBClientBasedir + "/mbstream"
+	}
+	return cluster.Conf.ProvDBClientBasedir + "/xbstream"
+}
+
+// provisionBackupVerifySandbox initialize a fresh datadir and start the
+// sandbox with the localhost orchestrator
+func (cluster *Cluster) provisionBackupVerifySandbox(sandbox *ServerMonitor) error {
+	go cluster.LocalhostProvisionDatabaseService(sandbox)
+	select {
+	case err := <-cluster.errorChan:
+		if err != nil {
+			return err
+		}
+	case <-time.After(time.Duration(cluster.Conf.BackupVerifyTimeout) * time.Second):
+		return errors.New("timeout provisioning the sandbox")
+	}
+	return cluster.waitBackupVerifySandbox(sandbox)
+}
+
+// restoreBackupVerifyPhysical extract and prepare the backup in the datadir
+// of the sandbox before starting it
+func (cluster *Cluster) restoreBackupVerifyPhysical(b *PitrBackup, sandbox *ServerMonitor) error {
+	sandbox.GetDatabaseConfig()
+	datadir := sandbox.Datadir + "/var"
+	f, err := cluster.OpenBackupFile(b.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(b.Path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	extractCmd := exec.Command(cluster.getBackupStreamPath(b.Type), "-x", "-C", datadir)
+	extractCmd.Stdin = r
+	cluster.LogPrintf(LvlInfo, "Command: %s", extractCmd.String())
+	if out, err := extractCmd.CombinedOutput(); err != nil {
+		cluster.LogPrintf(LvlErr, "%s", out)
+		return fmt.Errorf("extract: %s", err)
+	}
+	prepareCmd := exec.Command(cluster.Conf.ProvDBClientBasedir+"/"+b.Type, "--prepare", "--target-dir="+datadir)
+	cluster.LogPrintf(LvlInfo, "Command: %s", prepareCmd.String())
+	if out, err := prepareCmd.CombinedOutput(); err != nil {
+		cluster.LogPrintf(LvlErr, "%s", out)
+		return fmt.Errorf("prepare: %s", err)
+	}
+	if err := cluster.LocalhostStartDatabaseService(sandbox); err != nil {
+		return err
+	}
+	return cluster.waitBackupVerifySandbox(sandbox)
+}
+
+func (cluster *Cluster) waitBackupVerifySandbox(sandbox *ServerMonitor) error {
+	err := cluster.waitUntil(cluster.Conf.BackupVerifyTimeout, func() bool {
+		conn, err := sqlx.Connect("mysql", sandbox.DSN)
+		if err != nil {
+			return false
+		}
+		sandbox.Conn = conn
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("waiting sandbox %s: %s", sandbox.URL, err)
+	}
+	return nil
+}
+
+// dropBackupVerifySandbox stop the sandbox and remove its datadir
+func (cluster *Cluster) dropBackupVerifySandbox(sandbox *ServerMonitor) {
+	if sandbox.Conn != nil {
+		sandbox.Shutdown()
+		sandbox.Conn.Close()
+	}
+	err := cluster.waitUntil(cluster.Conf.BackupVerifyTimeout, func() bool {
+		conn, err := sqlx.Connect("mysql", sandbox.DSN)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	})
+	if err != nil && sandbox.Process != nil {
+		cluster.LogPrintf(LvlWarn, "Killing sandbox %s: %s", sandbox.URL, err)
+		sandbox.Process.Kill()
+	}
+	if sandbox.ErrorLogTailer != nil {
+		sandbox.ErrorLogTailer.Stop()
+	}
+	if sandbox.SlowLogTailer != nil {
+		sandbox.SlowLogTailer.Stop()
+	}
+	if err := os.RemoveAll(sandbox.Datadir); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not remove sandbox datadir %s: %s", sandbox.Datadir, err)
+	}
+}
+
+// checkBackupVerify run CHECK TABLE and count the rows of every restored
+// table. With backup-verify-checksum the rows and checksums are compared
+// with a replica, a table differs legitimately when it was modified after
+// the backup, it fails when its last update on the replica is older.
+func (cluster *Cluster) checkBackupVerify(v *BackupVerification, sandbox *ServerMonitor) error {
+	rows, err := sandbox.Conn.Queryx("SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE='BASE TABLE' AND TABLE_SCHEMA NOT IN ('mysql','information_schema','performance_schema','sys','replication_manager_schema') ORDER BY TABLE_SCHEMA, TABLE_NAME")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var t BackupVerifyTable
+		if err := rows.Scan(&t.Schema, &t.Table); err != nil {
+			rows.Close()
+			return err
+		}
+		v.Tables = append(v.Tables, t)
+	}
+	rows.Close()
+
+	var replica *sqlx.DB
+	var started int64
+	if cluster.Conf.BackupVerifyChecksum {
+		srv := cluster.getBackupVerifyReplica(v.Backup.Source)
+		if srv != nil {
+			replica, err = srv.GetNewDBConn()
+			if err != nil {
+				cluster.LogPrintf(LvlWarn, "Backup verification can not compare with %s: %s", srv.URL, err)
+				replica = nil
+			} else {
+				defer replica.Close()
+				v.Replica = srv.URL
+				started = getBackupVerifyStartTime(replica)
+			}
+		} else {
+			cluster.LogPrintf(LvlWarn, "Backup verification can not compare the checksums, no running replica")
+		}
+	}
+
+	failed := 0
+	for i := range v.Tables {
+		t := &v.Tables[i]
+		t.Status = ConstPitrCheckOk
+		cluster.checkBackupVerifyTable(t, sandbox.Conn, replica, started, v.Backup.Time)
+		if t.Status == ConstPitrCheckError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tables failed the checks", failed, len(v.Tables))
+	}
+	return nil
+}
+
+// getBackupVerifyReplica return the replica the restored tables are compared
+// with, the backup source when it is a running replica. The master is never
+// used, a checksum reads the whole table.
+func (cluster *Cluster) getBackupVerifyReplica(source string) *ServerMonitor {
+	var replica *ServerMonitor
+	for _, srv := range cluster.Servers {
+		if srv.State != stateSlave || srv.IsIgnored() || srv.IsMaintenance {
+			continue
+		}
+		if srv.URL == source {
+			return srv
+		}
+		if replica == nil {
+			replica = srv
+		}
+	}
+	return replica
+}
+
+// getBackupVerifyStartTime return the unix time a server started at, 0 when
+// unknown
+func getBackupVerifyStartTime(conn *sqlx.DB) int64 {
+	var name string
+	var uptime int64
+	if err := conn.QueryRowx("SHOW GLOBAL STATUS LIKE 'Uptime'").Scan(&name, &uptime); err != nil || uptime <= 0 {
+		return 0
+	}
+	return time.Now().Unix() - uptime
+}
+
+func (cluster *Cluster) checkBackupVerifyTable(t *BackupVerifyTable, sandbox *sqlx.DB, replica *sqlx.DB, started int64, backupTime time.Time) {
+	table := dbhelper.QuoteIdentifier(t.Schema) + "." + dbhelper.QuoteIdentifier(t.Table)
+	rows, err := sandbox.Queryx("CHECK TABLE " + table)
+	if err != nil {
+		t.Status, t.Message = ConstPitrCheckError, err.Error()
+		return
+	}
+	for rows.Next() {
+		var name, op, msgType, msgText string
+		if err := rows.Scan(&name, &op, &msgType, &msgText); err != nil {
+			break
+		}
+		if msgType == "error" {
+			t.Status = ConstPitrCheckError
+		}
+		t.Check = msgText
+	}
+	rows.Close()
+	if t.Status == ConstPitrCheckError {
+		t.Message = "CHECK TABLE: " + t.Check
+		return
+	}
+
+	expr, err := getTableChecksumExpr(sandbox, t.Schema, t.Table)
+	if err != nil {
+		t.Status, t.Message = ConstPitrCheckError, err.Error()
+		return
+	}
+	query := "SELECT COUNT(*), COALESCE(" + expr + ", 0) FROM " + table
+	if err := sandbox.QueryRowx(query).Scan(&t.Rows, &t.Checksum); err != nil {
+		t.Status, t.Message = ConstPitrCheckError, err.Error()
+		return
+	}
+	if replica == nil {
+		return
+	}
+	if err := replica.QueryRowx(query).Scan(&t.SourceRows, &t.SourceChecksum); err != nil {
+		t.Status, t.Message = ConstPitrCheckWarning, "Replica: "+err.Error()
+		return
+	}
+	if t.Rows == t.SourceRows && t.Checksum == t.SourceChecksum {
+		return
+	}
+	var updated int64
+	var engine string
+	replica.QueryRowx("SELECT IFNULL(UNIX_TIMESTAMP(UPDATE_TIME), 0), IFNULL(ENGINE, '') FROM information_schema.TABLES WHERE TABLE_SCHEMA=? AND TABLE_NAME=?", t.Schema, t.Table).Scan(&updated, &engine)
+	t.Status, t.Message = getBackupVerifyDiffStatus(updated, engine, started, backupTime)
+}
+
+// getBackupVerifyDiffStatus tell if a table that differs from the replica
+// was modified after the backup. UPDATE_TIME is not persisted by InnoDB, it
+// is NULL when the table was not modified since the replica started.
+func getBackupVerifyDiffStatus(updated int64, engine string, started int64, backupTime time.Time) (string, string) {
+	if updated > 0 {
+		if updated < backupTime.Unix() {
+			return ConstPitrCheckError, fmt.Sprintf("Differs from the replica not modified since %s", time.Unix(updated, 0).Format("2006-01-02 15:04:05"))
+		}
+		return ConstPitrCheckWarning, "Replica modified since the backup"
+	}
+	switch strings.ToLower(engine) {
+	case "innodb", "myisam", "aria":
+	default:
+		return ConstPitrCheckWarning, "Differs from the replica, last update unknown with engine " + engine
+	}
+	if started > 0 && started < backupTime.Unix() {
+		return ConstPitrCheckError, fmt.Sprintf("Differs from the replica not modified since its start at %s", time.Unix(started, 0).Format("2006-01-02 15:04:05"))
+	}
+	return ConstPitrCheckWarning, "Differs from the replica restarted since the backup, last update unknown"
+}
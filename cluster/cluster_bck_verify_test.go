@@ -0,0 +1,84 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChecksumExpr(t *testing.T) {
+	tests := []struct {
+		columns []string
+		expr    string
+	}{
+		{[]string{"a"}, "SUM(CRC32(CONCAT(IFNULL(`a`,'N'))))"},
+		{[]string{"id", "my col", "b`c"}, "SUM(CRC32(CONCAT(IFNULL(`id`,'N'),IFNULL(`my col`,'N'),IFNULL(`b``c`,'N'))))"},
+	}
+	for _, tt := range tests {
+		if expr := getChecksumExpr(tt.columns); expr != tt.expr {
+			t.Errorf("Expected %s, got %s", tt.expr, expr)
+		}
+	}
+}
+
+func TestBackupVerifyReplica(t *testing.T) {
+	master := &ServerMonitor{URL: "db1:3306", State: stateMaster}
+	late := &ServerMonitor{URL: "db2:3306", State: stateSlaveLate}
+	replica := &ServerMonitor{URL: "db3:3306", State: stateSlave}
+	source := &ServerMonitor{URL: "db4:3306", State: stateSlave}
+	maintenance := &ServerMonitor{URL: "db5:3306", State: stateSlave, IsMaintenance: true}
+	cluster := &Cluster{Servers: serverList{master, late, replica, source, maintenance}}
+	tests := []struct {
+		source  string
+		replica *ServerMonitor
+	}{
+		{"db4:3306", source},
+		{"db1:3306", replica},
+		{"db2:3306", replica},
+		{"db5:3306", replica},
+	}
+	for _, tt := range tests {
+		if srv := cluster.getBackupVerifyReplica(tt.source); srv != tt.replica {
+			t.Errorf("Backup of %s: expected to compare with %s, got %v", tt.source, tt.replica.URL, srv)
+		}
+	}
+	cluster.Servers = serverList{master, late}
+	if srv := cluster.getBackupVerifyReplica("db1:3306"); srv != nil {
+		t.Errorf("Expected no comparison without a running replica, got %s", srv.URL)
+	}
+}
+
+func TestBackupVerifyDiffStatus(t *testing.T) {
+	backup := time.Date(2021, 6, 5, 1, 0, 0, 0, time.UTC)
+	before := backup.Add(-time.Hour).Unix()
+	after := backup.Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		updated int64
+		engine  string
+		started int64
+		status  string
+	}{
+		{"updated before the backup", before, "InnoDB", before, ConstPitrCheckError},
+		{"updated after the backup", after, "InnoDB", before, ConstPitrCheckWarning},
+		{"not updated since a start before the backup", 0, "InnoDB", before, ConstPitrCheckError},
+		{"not updated since a start after the backup", 0, "InnoDB", after, ConstPitrCheckWarning},
+		{"unknown start", 0, "InnoDB", 0, ConstPitrCheckWarning},
+		{"aria", 0, "Aria", before, ConstPitrCheckError},
+		{"engine without update time", 0, "ROCKSDB", before, ConstPitrCheckWarning},
+		{"unknown engine", 0, "", before, ConstPitrCheckWarning},
+	}
+	for _, tt := range tests {
+		if status, message := getBackupVerifyDiffStatus(tt.updated, tt.engine, tt.started, backup); status != tt.status {
+			t.Errorf("%s: expected %s, got %s: %s", tt.name, tt.status, status, message)
+		}
+	}
+}
@@ -7,7 +7,6 @@
 package cluster
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,10 +18,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/router/maxscale"
 	"github.com/signal18/replication-manager/utils/alert"
+	"github.com/signal18/replication-manager/utils/arbitration"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/state"
 )
 
@@ -61,62 +63,72 @@ func (cluster *Cluster) CheckFailed() {
 }
 
 func (cluster *Cluster) isSlaveElectableForSwitchover(sl *ServerMonitor, forcingLog bool) bool {
+	electable, _ := cluster.checkSlaveElectableForSwitchover(sl, forcingLog, false)
+	return electable
+}
+
+// checkSlaveElectableForSwitchover return if the slave can be promoted while the
+// master is alive and the reason when it can't
+func (cluster *Cluster) checkSlaveElectableForSwitchover(sl *ServerMonitor, forcingLog bool, dryRun bool) (bool, string) {
 	ss, err := sl.GetSlaveStatus(sl.ReplicationSourceName)
 	if err != nil {
-		cluster.LogPrintf(LvlDbg, "Error in getting slave status in testing slave electable for switchover %s: %s  ", sl.URL, err)
-		return false
+		if !dryRun {
+			cluster.LogPrintf(LvlDbg, "Error in getting slave status in testing slave electable for switchover %s: %s  ", sl.URL, err)
+		}
+		return false, "no replication status"
 	}
+	logSkip := !dryRun && (cluster.Conf.LogLevel > 1 || forcingLog)
 	hasBinLogs, err := cluster.IsEqualBinlogFilters(cluster.master, sl)
 	if err != nil {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Could not check binlog filters on %s", sl.URL)
 		}
-		return false
+		return false, "could not check binlog filters"
 	}
 	if (!cluster.Conf.SwitchLowerRelease) && (sl.DBVersion.Major < cluster.master.DBVersion.Major || (sl.DBVersion.Major == cluster.master.DBVersion.Major && sl.DBVersion.Minor < cluster.master.DBVersion.Minor)) {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Could not elect a minor version as leader without enabing switchover-lower-release %s", sl.URL)
 		}
-		return false
+		return false, "lower release than master"
 	}
 	if hasBinLogs == false && cluster.Conf.CheckBinFilter == true && (sl.GetSourceClusterName() == cluster.Name || sl.GetSourceClusterName() == "") {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Binlog filters differ on master and slave %s. Skipping", sl.URL)
 		}
-		return false
+		return false, "binlog filters differ from master"
 	}
 	if cluster.IsEqualReplicationFilters(cluster.master, sl) == false && (sl.GetSourceClusterName() == cluster.Name || sl.GetSourceClusterName() == "") && cluster.Conf.CheckReplFilter == true {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Replication filters differ on master and slave %s. Skipping", sl.URL)
 		}
-		return false
+		return false, "replication filters differ from master"
 	}
 	if cluster.Conf.SwitchGtidCheck && cluster.IsCurrentGTIDSync(sl, cluster.master) == false && cluster.Conf.RplChecks == true {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Equal-GTID option is enabled and GTID position on slave %s differs from master. Skipping", sl.URL)
 		}
-		return false
+		return false, "GTID differs from master with switchover-at-equal-gtid"
 	}
 	if sl.HaveSemiSync && sl.SemiSyncSlaveStatus == false && cluster.Conf.SwitchSync && cluster.Conf.RplChecks {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Semi-sync slave %s is out of sync. Skipping", sl.URL)
 		}
-		return false
+		return false, "semi-sync out of sync with switchover-at-sync"
 	}
 	if ss.SecondsBehindMaster.Valid == false && cluster.Conf.RplChecks == true {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave %s is stopped. Skipping", sl.URL)
 		}
-		return false
+		return false, "replication stopped"
 	}
 
 	if sl.IsMaxscale || sl.IsRelay {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave %s is a relay slave. Skipping", sl.URL)
 		}
-		return false
+		return false, "relay server"
 	}
-	return true
+	return true, ""
 }
 
 func (cluster *Cluster) isAutomaticFailover() bool {
@@ -291,34 +303,28 @@ func (cluster *Cluster) isActiveArbitration() bool {
 	if cluster.Conf.Arbitration == false {
 		return true
 	}
+	if cluster.Conf.ArbitrationRaft {
+		// only the raft leader is active, no external arbitrator to ask
+		if cluster.IsRaftLeader() {
+			return true
+		}
+		cluster.StateMachine.AddState("ERR00022", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00022"]), ErrFrom: "CHECK"})
+		return false
+	}
 	//	cluster.LogPrintf("CHECK: Failover External Arbitration")
 
-	url := "http://" + cluster.Conf.ArbitrationSasHosts + "/arbitrator"
-	var mst string
-	if cluster.master != nil {
-		mst = cluster.master.URL
+	body, err := json.Marshal(cluster.getArbitrationRequest())
+	if err != nil {
+		return false
 	}
-	var jsonStr = []byte(`{"uuid":"` + cluster.runUUID + `","secret":"` + cluster.Conf.ArbitrationSasSecret + `","cluster":"` + cluster.Name + `","master":"` + mst + `","id":` + strconv.Itoa(cluster.Conf.ArbitrationSasUniqueId) + `}`)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
-	req.Header.Set("X-Custom-Header", "myvalue")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	content, err := cluster.newArbitrationClient(time.Duration(cluster.Conf.MonitoringTicker)*time.Second).Post("/arbitrator", body)
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "%s", err.Error())
 		cluster.StateMachine.AddState("ERR00022", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00022"]), ErrFrom: "CHECK"})
 		return false
 	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	type response struct {
-		Arbitration string `json:"arbitration"`
-	}
-	var r response
-	err = json.Unmarshal(body, &r)
+	var r arbitration.Response
+	err = json.Unmarshal(content, &r)
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Arbitrator sent invalid JSON")
 		cluster.StateMachine.AddState("ERR00022", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00022"]), ErrFrom: "CHECK"})
@@ -356,6 +362,13 @@ func (cluster *Cluster) isArbitratorAlive() bool {
 	if !cluster.Conf.Arbitration {
 		return true
 	}
+	if cluster.Conf.ArbitrationRaft {
+		if cluster.Consensus == nil || !cluster.Consensus.HasQuorum() {
+			cluster.StateMachine.AddState("ERR00091", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00091"], cluster.Conf.ArbitrationPeerHosts), ErrFrom: "CHECK"})
+			return false
+		}
+		return true
+	}
 	if cluster.IsFailedArbitrator {
 		cluster.StateMachine.AddState("ERR00055", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00055"], cluster.Conf.ArbitrationSasHosts), ErrFrom: "CHECK"})
 		return false
@@ -476,32 +489,94 @@ func (cluster *Cluster) CheckCapture(state state.State) {
 }
 
 func (cluster *Cluster) CheckAlert(state state.State) {
-	if cluster.Conf.MonitoringAlertTrigger == "" {
-		return
+	cluster.DispatchAlert(cluster.newStateAlert(state))
+}
+
+// CheckTopologyChange emit an event when the topology or the master discovered
+// by the monitor loop differ from the previous loop
+func (cluster *Cluster) CheckTopologyChange() {
+	if cluster.Topology != cluster.eventTopology {
+		if cluster.eventTopology != "" {
+			cluster.LogEvent(journal.ConstEventTopology, "topology", "", "", "Topology changed from %s to %s", cluster.eventTopology, cluster.Topology)
+		}
+		cluster.eventTopology = cluster.Topology
+	}
+	master := ""
+	if cluster.GetMaster() != nil {
+		master = cluster.GetMaster().URL
+	}
+	if master != cluster.eventMaster {
+		if master == "" {
+			cluster.LogEvent(journal.ConstEventTopology, "master-lost", cluster.eventMaster, "", "Master %s lost", cluster.eventMaster)
+		} else {
+			cluster.LogEvent(journal.ConstEventTopology, "master", master, "", "Master is %s, previous %s", master, cluster.eventMaster)
+		}
+		cluster.eventMaster = master
 	}
+}
 
-	// exit even earlier
-	if cluster.Conf.MailTo == "" && cluster.Conf.AlertScript == "" {
+// CheckAlertResolved notify the destinations that a state triggering an alert have left the current states
+func (cluster *Cluster) CheckAlertResolved(state state.State) {
+	if !cluster.Conf.AlertSendResolved {
 		return
 	}
+	a := cluster.newStateAlert(state)
+	a.Resolved = true
+	cluster.DispatchAlert(a)
+}
 
-	if strings.Contains(cluster.Conf.MonitoringAlertTrigger, state.ErrKey) {
-		a := alert.Alert{
-			State:   state.ErrDesc,
-			Cluster: cluster.Name,
-		}
+func (cluster *Cluster) newStateAlert(state state.State) alert.Alert {
+	return alert.Alert{
+		State:     state.ErrDesc,
+		Cluster:   cluster.Name,
+		Host:      state.ServerUrl,
+		ErrKey:    state.ErrKey,
+		ErrType:   state.ErrType,
+		ErrFrom:   state.ErrFrom,
+		ServerUrl: state.ServerUrl,
+		Monitor:   cluster.Conf.MonitorAddress,
+		Timestamp: time.Now(),
+	}
+}
 
-		err := cluster.SendAlert(a)
-		if err != nil {
-			cluster.LogPrintf("ERROR", "Could not send alert: %s ", err)
+// DispatchAlert send a state alert to the destinations selected by the alert
+// router after silences, deduplication and rate limiting
+func (cluster *Cluster) DispatchAlert(a alert.Alert) {
+	if cluster.AlertRouter == nil {
+		return
+	}
+	for _, dest := range cluster.AlertRouter.Dispatch(a, time.Now()) {
+		switch dest {
+		case alert.ConstDestinationMail:
+			// mail and script do not know about resolution
+			if !a.Resolved && cluster.Conf.MailTo != "" {
+				go a.EmailMessage("", "", cluster.Conf)
+			}
+		case alert.ConstDestinationScript:
+			if !a.Resolved && cluster.Conf.AlertScript != "" {
+				cluster.runAlertScript(a)
+			}
+		default:
+			n := cluster.GetNotifier(dest)
+			if n == nil {
+				cluster.LogPrintf(LvlErr, "Alert route destination %s not found for %s", dest, a.ErrKey)
+				continue
+			}
+			go func(n alert.Notifier) {
+				err := n.Notify(a)
+				if err != nil {
+					cluster.LogPrintf(LvlErr, "Could not send %s %s alert %s: %s", n.GetName(), a.GetStatus(), a.ErrKey, err)
+				} else if cluster.Conf.LogLevel > 2 {
+					cluster.LogPrintf(LvlDbg, "Sent %s %s alert %s", n.GetName(), a.GetStatus(), a.ErrKey)
+				}
+			}(n)
 		}
-
 	}
 }
 
 func (cluster *Cluster) SendAlert(alert alert.Alert) error {
-	if cluster.IsAlertDisable {
-		cluster.LogPrintf(LvlInfo, "Cancel alert caused by alert disabled from scheduler")
+	if cluster.AlertRouter != nil && cluster.AlertRouter.IsSilenced(alert, time.Now()) {
+		cluster.LogPrintf(LvlInfo, "Cancel alert caused by alert silence")
 		return nil
 	}
 	if cluster.Conf.MailTo != "" {
@@ -509,19 +584,23 @@ func (cluster *Cluster) SendAlert(alert alert.Alert) error {
 	}
 
 	if cluster.Conf.AlertScript != "" {
-		cluster.LogPrintf("INFO", "Calling alert script")
-		var out []byte
-		out, err := exec.Command(cluster.Conf.AlertScript, alert.Cluster, alert.Host, alert.PrevState, alert.State).CombinedOutput()
-		if err != nil {
-			cluster.LogPrintf("ERROR", "%s", err)
-		}
-
-		cluster.LogPrintf("INFO", "Alert script complete:", string(out))
+		cluster.runAlertScript(alert)
 	}
 
 	return nil
 }
 
+func (cluster *Cluster) runAlertScript(alert alert.Alert) {
+	cluster.LogPrintf("INFO", "Calling alert script")
+	var out []byte
+	out, err := exec.Command(cluster.Conf.AlertScript, alert.Cluster, alert.Host, alert.PrevState, alert.State).CombinedOutput()
+	if err != nil {
+		cluster.LogPrintf("ERROR", "%s", err)
+	}
+
+	cluster.LogPrintf("INFO", "Alert script complete:", string(out))
+}
+
 func (cluster *Cluster) CheckAllTableChecksum() {
 	for _, t := range cluster.master.Tables {
 		cluster.CheckTableChecksum(t.TableSchema, t.TableName)
@@ -563,8 +642,7 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 		cluster.LogPrintf(LvlErr, "ERROR: Could not process chunck %s %s", query, err)
 		return
 	}
-	var md5Sum string
-	err = Conn.QueryRowx("SELECT CONCAT( \"SUM(CRC32(CONCAT(\" , GROUP_CONCAT( CONCAT( \"IFNULL(\" , COLUMN_NAME, \",'N')\")),\")))\") as fields FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA ='" + schema + "' AND TABLE_NAME='" + table + "'").Scan(&md5Sum)
+	md5Sum, err := getTableChecksumExpr(Conn, schema, table)
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "ERROR: Could not get SQL md5Sum", err)
 		return
@@ -662,6 +740,30 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 	}
 }
 
+// getTableChecksumExpr return the sum of the CRC32 of every row of the table,
+// the expression used to checksum the chunks
+func getTableChecksumExpr(conn *sqlx.DB, schema string, table string) (string, error) {
+	var columns []string
+	err := conn.Select(&columns, "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION", schema, table)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("No column found for table %s.%s", schema, table)
+	}
+	return getChecksumExpr(columns), nil
+}
+
+// getChecksumExpr return the sum of the CRC32 of the columns in their table
+// order, so that the same rows give the same checksum on every server
+func getChecksumExpr(columns []string) string {
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = "IFNULL(" + dbhelper.QuoteIdentifier(column) + ",'N')"
+	}
+	return "SUM(CRC32(CONCAT(" + strings.Join(fields, ",") + ")))"
+}
+
 // CheckSameServerID Check against the servers that all server id are differents
 func (cluster *Cluster) CheckSameServerID() {
 	for _, s := range cluster.Servers {
@@ -681,8 +783,13 @@ func (cluster *Cluster) CheckSameServerID() {
 }
 
 func (cluster *Cluster) IsSameWsrepUUID() bool {
+	same, _ := cluster.checkSameWsrepUUID(false)
+	return same
+}
+
+func (cluster *Cluster) checkSameWsrepUUID(dryRun bool) (bool, string) {
 	if cluster.GetTopology() != topoMultiMasterWsrep {
-		return true
+		return true, ""
 	}
 	for _, s := range cluster.Servers {
 		if s.IsFailed() {
@@ -693,20 +800,28 @@ func (cluster *Cluster) IsSameWsrepUUID() bool {
 				continue
 			}
 			if s.Status["WSREP_CLUSTER_STATE_UUID"] != sothers.Status["WSREP_CLUSTER_STATE_UUID"] {
-				cluster.SetState("ERR00083", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00083"], s.URL, s.Status["WSREP_CLUSTER_STATE_UUID"], sothers.URL, sothers.Status["WSREP_CLUSTER_STATE_UUID"]), ErrFrom: "MON", ServerUrl: s.URL})
-				return false
+				desc := fmt.Sprintf(clusterError["ERR00083"], s.URL, s.Status["WSREP_CLUSTER_STATE_UUID"], sothers.URL, sothers.Status["WSREP_CLUSTER_STATE_UUID"])
+				if !dryRun {
+					cluster.SetState("ERR00083", state.State{ErrType: LvlWarn, ErrDesc: desc, ErrFrom: "MON", ServerUrl: s.URL})
+				}
+				return false, desc
 			}
 		}
 	}
-	return true
+	return true, ""
 }
 
 func (cluster *Cluster) IsNotHavingMySQLErrantTransaction() bool {
+	clean, _ := cluster.checkMySQLErrantTransaction(false)
+	return clean
+}
+
+func (cluster *Cluster) checkMySQLErrantTransaction(dryRun bool) (bool, string) {
 	if cluster.GetMaster() == nil {
-		return false
+		return false, "no master"
 	}
 	if !(cluster.GetMaster().HasMySQLGTID()) {
-		return true
+		return true, ""
 	}
 	for _, s := range cluster.slaves {
 		if s.IsFailed() || s.IsIgnored() {
@@ -714,11 +829,14 @@ func (cluster *Cluster) IsNotHavingMySQLErrantTransaction() bool {
 		}
 		hasErrantTrx, _, _ := dbhelper.HaveErrantTransactions(s.Conn, cluster.master.Variables["GTID_EXECUTED"], s.Variables["GTID_EXECUTED"])
 		if hasErrantTrx {
-			cluster.SetState("WARN0091", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["WARN0091"], s.URL), ErrFrom: "MON", ServerUrl: s.URL})
-			return false
+			desc := fmt.Sprintf(clusterError["WARN0091"], s.URL)
+			if !dryRun {
+				cluster.SetState("WARN0091", state.State{ErrType: LvlWarn, ErrDesc: desc, ErrFrom: "MON", ServerUrl: s.URL})
+			}
+			return false, desc
 		}
 	}
-	return true
+	return true, ""
 }
 
 func (cluster *Cluster) CheckCredentialRotation() {
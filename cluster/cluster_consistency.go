@@ -0,0 +1,932 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	ConstConsistencyRepairPending  = "pending"
+	ConstConsistencyRepairApplying = "applying"
+	ConstConsistencyRepairApplied  = "applied"
+	ConstConsistencyRepairInSync   = "in-sync"
+	ConstConsistencyRepairFailed   = "failed"
+)
+
+const (
+	consistencyChunkSize    = 1000
+	consistencyMinChunkSize = 10
+	consistencyMaxChunkSize = 1000000
+	// results kept in the history of a table
+	consistencyHistory = 20
+	// repairs kept in the audit trail
+	consistencyRepairHistory = 200
+	// statements kept in a repair of the audit trail
+	consistencyRepairStatements = 1000
+	// wait of a replica on top of monitoring-consistency-max-delay
+	consistencyReplicaTimeout = 60 * time.Second
+	// wait of a replica while the master rows of a repaired chunk are locked
+	consistencyRepairTimeout = 30 * time.Second
+)
+
+var errConsistencyStopped = errors.New("Stopped")
+
+// ConsistencyCheck is the state of the continuous consistency check, a pass
+// checksums every table of the master by chunks and compare the replicas
+type ConsistencyCheck struct {
+	Running      bool               `json:"running"`
+	Throttled    bool               `json:"throttled"`
+	Pass         int64              `json:"pass"`
+	PassStarted  time.Time          `json:"passStarted"`
+	PassFinished time.Time          `json:"passFinished"`
+	Position     string             `json:"position"`
+	Table        string             `json:"table,omitempty"`
+	Chunk        int64              `json:"chunk,omitempty"`
+	Tables       []ConsistencyTable `json:"tables"`
+}
+
+// ConsistencyTable is the last check of a table, the replicas list their
+// mismatched chunks
+type ConsistencyTable struct {
+	Schema    string               `json:"schema"`
+	Table     string               `json:"table"`
+	Pass      int64                `json:"pass"`
+	Chunks    int64                `json:"chunks"`
+	Rows      int64                `json:"rows"`
+	ChunkSize int64                `json:"chunkSize"`
+	Started   time.Time            `json:"started"`
+	Finished  time.Time            `json:"finished"`
+	Error     string               `json:"error,omitempty"`
+	Replicas  []ConsistencyReplica `json:"replicas"`
+	History   []ConsistencyResult  `json:"history"`
+}
+
+// ConsistencyReplica is the result of a table on a replica
+type ConsistencyReplica struct {
+	URL    string             `json:"url"`
+	Error  string             `json:"error,omitempty"`
+	Chunks []ConsistencyChunk `json:"chunks"`
+}
+
+// ConsistencyChunk is a mismatched chunk, the bounds are SQL literals of the
+// primary key, the lower one excluded and the upper one included
+type ConsistencyChunk struct {
+	Chunk       int64  `json:"chunk"`
+	Lower       string `json:"lower"`
+	Upper       string `json:"upper"`
+	MasterCount int64  `json:"masterCount"`
+	Count       int64  `json:"count"`
+	MasterCrc   string `json:"masterCrc"`
+	Crc         string `json:"crc"`
+	Repair      string `json:"repair,omitempty"`
+}
+
+// ConsistencyResult is a past check of a table
+type ConsistencyResult struct {
+	Pass       int64     `json:"pass"`
+	Time       time.Time `json:"time"`
+	Chunks     int64     `json:"chunks"`
+	Rows       int64     `json:"rows"`
+	Mismatches int       `json:"mismatches"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ConsistencyRepair is the audit of the repair of a mismatched chunk on a
+// replica, statements are run on the replica with binlog off
+type ConsistencyRepair struct {
+	Id         string    `json:"id"`
+	Schema     string    `json:"schema"`
+	Table      string    `json:"table"`
+	Chunk      int64     `json:"chunk"`
+	Lower      string    `json:"lower"`
+	Upper      string    `json:"upper"`
+	Server     string    `json:"server"`
+	State      string    `json:"state"`
+	Replaced   int       `json:"replaced"`
+	Deleted    int       `json:"deleted"`
+	Statements []string  `json:"statements"`
+	Truncated  bool      `json:"truncated"`
+	Created    time.Time `json:"created"`
+	Applied    time.Time `json:"applied"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (cluster *Cluster) getConsistencyFile() string {
+	return cluster.WorkingDir + "/consistency.json"
+}
+
+func (cluster *Cluster) getConsistencyRepairsFile() string {
+	return cluster.WorkingDir + "/consistency-repairs.json"
+}
+
+// loadConsistencyCheck is called with the consistency mutex
+func (cluster *Cluster) loadConsistencyCheck() {
+	if cluster.consistency != nil {
+		return
+	}
+	cluster.consistency = &ConsistencyCheck{Tables: []ConsistencyTable{}}
+	cluster.consistencyRepairs = []*ConsistencyRepair{}
+	if file, err := ioutil.ReadFile(cluster.getConsistencyFile()); err == nil {
+		if err := json.Unmarshal(file, cluster.consistency); err != nil {
+			cluster.LogPrintf(LvlErr, "Could not parse consistency check: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		cluster.LogPrintf(LvlErr, "Could not read consistency check: %s", err)
+	}
+	cluster.consistency.Running = false
+	cluster.consistency.Throttled = false
+	cluster.consistency.Table = ""
+	cluster.consistency.Chunk = 0
+	if file, err := ioutil.ReadFile(cluster.getConsistencyRepairsFile()); err == nil {
+		if err := json.Unmarshal(file, &cluster.consistencyRepairs); err != nil {
+			cluster.LogPrintf(LvlErr, "Could not parse consistency repairs: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		cluster.LogPrintf(LvlErr, "Could not read consistency repairs: %s", err)
+	}
+	for _, r := range cluster.consistencyRepairs {
+		if r.State == ConstConsistencyRepairApplying {
+			r.State = ConstConsistencyRepairFailed
+			r.Error = "Interrupted by a monitor restart"
+		}
+	}
+}
+
+// saveConsistencyCheck is called with the consistency mutex
+func (cluster *Cluster) saveConsistencyCheck() {
+	saveJson, _ := json.MarshalIndent(cluster.consistency, "", "\t")
+	if err := ioutil.WriteFile(cluster.getConsistencyFile(), saveJson, 0644); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save consistency check: %s", err)
+	}
+}
+
+// saveConsistencyRepairs is called with the consistency mutex
+func (cluster *Cluster) saveConsistencyRepairs() {
+	saveJson, _ := json.MarshalIndent(cluster.consistencyRepairs, "", "\t")
+	if err := ioutil.WriteFile(cluster.getConsistencyRepairsFile(), saveJson, 0644); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save consistency repairs: %s", err)
+	}
+}
+
+// GetConsistencyCheck return the state of the consistency check and the last
+// result of every table
+func (cluster *Cluster) GetConsistencyCheck() ConsistencyCheck {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	cluster.loadConsistencyCheck()
+	cc := *cluster.consistency
+	cc.Tables = append([]ConsistencyTable{}, cluster.consistency.Tables...)
+	return cc
+}
+
+// GetConsistencyRepairs return the repairs of mismatched chunks, latest first
+func (cluster *Cluster) GetConsistencyRepairs() []ConsistencyRepair {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	cluster.loadConsistencyCheck()
+	repairs := []ConsistencyRepair{}
+	for _, r := range cluster.consistencyRepairs {
+		repairs = append(repairs, *r)
+	}
+	return repairs
+}
+
+func (cluster *Cluster) updateConsistencyCheck(update func(cc *ConsistencyCheck)) {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	cluster.loadConsistencyCheck()
+	update(cluster.consistency)
+}
+
+func (cluster *Cluster) isConsistencyCheckStopped(master *ServerMonitor) bool {
+	return cluster.exit || !cluster.Conf.MonitorConsistency || !cluster.IsActive() || cluster.IsInFailover() || cluster.IsInSchemaChange() || cluster.GetMaster() != master
+}
+
+// startConsistencyCheck resume an interrupted pass, or start a new one when
+// monitoring-consistency-interval is elapsed since the end of the last one
+func (cluster *Cluster) startConsistencyCheck() {
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() || master.DBVersion == nil || master.DBVersion.IsPPostgreSQL() || len(cluster.slaves) == 0 {
+		return
+	}
+	if cluster.isConsistencyCheckStopped(master) {
+		return
+	}
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	cluster.loadConsistencyCheck()
+	cc := cluster.consistency
+	if cc.Running {
+		return
+	}
+	inPass := cc.PassStarted.After(cc.PassFinished)
+	if !inPass && time.Since(cc.PassFinished) < time.Duration(cluster.Conf.MonitorConsistencyInterval)*time.Second {
+		return
+	}
+	cc.Running = true
+	go cluster.checkConsistencyPass(master)
+}
+
+func (cluster *Cluster) checkConsistencyPass(master *ServerMonitor) {
+	defer cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) {
+		cc.Running = false
+		cc.Throttled = false
+		cc.Table = ""
+		cc.Chunk = 0
+		cluster.saveConsistencyCheck()
+	})
+	var pass int64
+	var position string
+	cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) {
+		if !cc.PassStarted.After(cc.PassFinished) {
+			cc.Pass++
+			cc.PassStarted = time.Now()
+			cc.Position = ""
+			cluster.saveConsistencyCheck()
+		}
+		pass = cc.Pass
+		position = cc.Position
+	})
+	if position == "" {
+		cluster.LogPrintf(LvlInfo, "Consistency check pass %d started on master %s", pass, master.URL)
+	} else {
+		cluster.LogPrintf(LvlInfo, "Consistency check pass %d resumed after %s on master %s", pass, position, master.URL)
+	}
+
+	_, tablelist, logs, err := dbhelper.GetTables(master.Conn, master.DBVersion)
+	cluster.LogSQL(logs, err, master.URL, "Monitor", LvlErr, "Could not fetch master tables %s", err)
+	if err != nil {
+		return
+	}
+	var tables [][2]string
+	for i := range tablelist {
+		if tablelist[i].TableSchema == "replication_manager_schema" {
+			continue
+		}
+		tables = append(tables, [2]string{tablelist[i].TableSchema, tablelist[i].TableName})
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i][0]+"."+tables[i][1] < tables[j][0]+"."+tables[j][1]
+	})
+
+	var checked, mismatched int
+	for _, t := range tables {
+		name := t[0] + "." + t[1]
+		if position != "" && name <= position {
+			continue
+		}
+		if cluster.isConsistencyCheckStopped(master) {
+			cluster.LogPrintf(LvlInfo, "Consistency check pass %d interrupted before %s", pass, name)
+			return
+		}
+		ct := cluster.checkConsistencyTable(master, pass, t[0], t[1])
+		if ct == nil {
+			cluster.LogPrintf(LvlInfo, "Consistency check pass %d interrupted at %s", pass, name)
+			return
+		}
+		checked++
+		for _, r := range ct.Replicas {
+			mismatched += len(r.Chunks)
+		}
+		cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) {
+			cc.setTable(ct)
+			cc.Position = name
+			cluster.saveConsistencyCheck()
+		})
+	}
+	cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) {
+		cc.PassFinished = time.Now()
+		cc.Position = ""
+	})
+	cluster.LogPrintf(LvlInfo, "Consistency check pass %d finished, %d tables checked, %d mismatched chunks", pass, checked, mismatched)
+	cluster.LogEvent(journal.ConstEventJob, "consistency-pass", master.URL, "", "Consistency check pass %d finished, %d tables checked, %d mismatched chunks", pass, checked, mismatched)
+}
+
+// setTable replace the result of a table, the previous results are kept in
+// its history
+func (cc *ConsistencyCheck) setTable(ct *ConsistencyTable) {
+	result := ConsistencyResult{Pass: ct.Pass, Time: ct.Finished, Chunks: ct.Chunks, Rows: ct.Rows, Error: ct.Error}
+	for _, r := range ct.Replicas {
+		result.Mismatches += len(r.Chunks)
+	}
+	for i := range cc.Tables {
+		if cc.Tables[i].Schema == ct.Schema && cc.Tables[i].Table == ct.Table {
+			ct.History = append(cc.Tables[i].History, result)
+			if len(ct.History) > consistencyHistory {
+				ct.History = ct.History[len(ct.History)-consistencyHistory:]
+			}
+			cc.Tables[i] = *ct
+			return
+		}
+	}
+	ct.History = []ConsistencyResult{result}
+	cc.Tables = append(cc.Tables, *ct)
+	sort.Slice(cc.Tables, func(i, j int) bool {
+		return cc.Tables[i].Schema+"."+cc.Tables[i].Table < cc.Tables[j].Schema+"."+cc.Tables[j].Table
+	})
+}
+
+// waitConsistencyDelay throttle the consistency check while the replication
+// delay of a replica is above monitoring-consistency-max-delay
+func (cluster *Cluster) waitConsistencyDelay(master *ServerMonitor) error {
+	for {
+		if cluster.isConsistencyCheckStopped(master) {
+			return errConsistencyStopped
+		}
+		var lagging *ServerMonitor
+		for _, s := range cluster.slaves {
+			if !s.IsDown() && s.GetReplicationDelay() > cluster.Conf.MonitorConsistencyMaxDelay {
+				lagging = s
+				break
+			}
+		}
+		throttled := lagging != nil
+		cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) { cc.Throttled = throttled })
+		if !throttled {
+			return nil
+		}
+		cluster.LogPrintf(LvlDbg, "Consistency check throttled, replication delay of %s is %d", lagging.URL, lagging.GetReplicationDelay())
+		time.Sleep(time.Duration(cluster.Conf.MonitoringTicker) * time.Second)
+	}
+}
+
+func getConsistencyChunkWhere(pk string, lower string, upper string) string {
+	var where []string
+	if lower != "" {
+		where = append(where, "("+pk+") > ("+lower+")")
+	}
+	if upper != "" {
+		where = append(where, "("+pk+") <= ("+upper+")")
+	}
+	if len(where) == 0 {
+		return "1=1"
+	}
+	return strings.Join(where, " AND ")
+}
+
+func getConsistencyBound(values []interface{}) string {
+	var literals []string
+	for _, v := range values {
+		literals = append(literals, dbhelper.QuoteValue(v))
+	}
+	return strings.Join(literals, ",")
+}
+
+// getConsistencyChunkSize return the size of the next chunk, it follows the
+// rows checked in the time budget
+func getConsistencyChunkSize(size int64, count int64, elapsed time.Duration, budget time.Duration) int64 {
+	if count <= 0 || elapsed <= 0 || budget <= 0 {
+		return size
+	}
+	target := int64(float64(count) * float64(budget) / float64(elapsed))
+	size = (size + target) / 2
+	if size < consistencyMinChunkSize {
+		size = consistencyMinChunkSize
+	}
+	if size > consistencyMaxChunkSize {
+		size = consistencyMaxChunkSize
+	}
+	return size
+}
+
+// getConsistencyTableColumns return the quoted primary key and columns of a
+// table
+func (cluster *Cluster) getConsistencyTableColumns(server *ServerMonitor, conn *sqlx.DB, schema string, table string) ([]string, []string, error) {
+	pk, logs, err := dbhelper.GetTablePrimaryKey(conn, schema, table)
+	cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "GetTablePrimaryKey")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pk) == 0 {
+		return nil, nil, errors.New("No primary key")
+	}
+	columns, logs, err := dbhelper.GetTableColumns(conn, schema, table)
+	cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "GetTableColumns")
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range pk {
+		pk[i] = dbhelper.QuoteIdentifier(pk[i])
+	}
+	for i := range columns {
+		columns[i] = dbhelper.QuoteIdentifier(columns[i])
+	}
+	return pk, columns, nil
+}
+
+// checkConsistencyTable checksum a table on the master and compare the
+// replicas, nil when the check is stopped
+func (cluster *Cluster) checkConsistencyTable(master *ServerMonitor, pass int64, schema string, table string) *ConsistencyTable {
+	ct := &ConsistencyTable{Schema: schema, Table: table, Pass: pass, ChunkSize: consistencyChunkSize, Started: time.Now(), Replicas: []ConsistencyReplica{}}
+	cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) {
+		cc.Table = schema + "." + table
+		cc.Chunk = 0
+		for _, t := range cc.Tables {
+			if t.Schema == schema && t.Table == table && t.ChunkSize > 0 {
+				ct.ChunkSize = t.ChunkSize
+			}
+		}
+	})
+	chunks, err := cluster.checksumConsistencyTable(master, ct)
+	if err == errConsistencyStopped {
+		return nil
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlWarn, "Consistency check of %s.%s failed: %s", schema, table, err)
+		ct.Error = err.Error()
+		ct.Finished = time.Now()
+		return ct
+	}
+
+	for _, s := range cluster.slaves {
+		r := ConsistencyReplica{URL: s.URL, Chunks: []ConsistencyChunk{}}
+		if s.IsDown() || s.IsReplicationBroken() || s.Conn == nil {
+			r.Error = "Replication is not running"
+			ct.Replicas = append(ct.Replicas, r)
+			continue
+		}
+		mismatches, err := cluster.compareConsistencyReplica(master, s, ct, chunks)
+		if err == errConsistencyStopped {
+			return nil
+		}
+		if err != nil {
+			r.Error = err.Error()
+			cluster.LogPrintf(LvlWarn, "Consistency check of %s.%s on %s failed: %s", schema, table, s.URL, err)
+		}
+		for _, c := range mismatches {
+			cluster.LogPrintf(LvlWarn, "Consistency check of %s.%s chunk %d mismatch on %s, %d rows instead of %d", schema, table, c.Chunk, s.URL, c.Count, c.MasterCount)
+			repair := cluster.repairConsistencyChunk(master, s, schema, table, c, cluster.Conf.MonitorConsistencyRepair)
+			c.Repair = repair.Id
+			r.Chunks = append(r.Chunks, c)
+		}
+		ct.Replicas = append(ct.Replicas, r)
+	}
+	ct.Finished = time.Now()
+	return ct
+}
+
+// checksumConsistencyTable run the chunk checksums on the master in
+// statement binlog format so that every replica computes its own checksum,
+// the master checksum is then replicated with an update
+func (cluster *Cluster) checksumConsistencyTable(master *ServerMonitor, ct *ConsistencyTable) (map[int64]ConsistencyChunk, error) {
+	conn, err := master.GetNewDBConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// session variables need a single connection
+	conn.SetMaxOpenConns(1)
+	pk, columns, err := cluster.getConsistencyTableColumns(master, conn, ct.Schema, ct.Table)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range []string{
+		"SET SESSION binlog_format='STATEMENT'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"CREATE DATABASE IF NOT EXISTS replication_manager_schema",
+		"CREATE TABLE IF NOT EXISTS replication_manager_schema.consistency_checksum (db CHAR(64) NOT NULL, tbl CHAR(64) NOT NULL, chunk INT NOT NULL, pass BIGINT NOT NULL, chunk_time FLOAT NULL, lower_boundary TEXT NULL, upper_boundary TEXT NULL, this_crc CHAR(40) NOT NULL, this_cnt INT NOT NULL, master_crc CHAR(40) NULL, master_cnt INT NULL, ts TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, PRIMARY KEY (db, tbl, chunk)) ENGINE=InnoDB",
+		"CREATE TABLE IF NOT EXISTS replication_manager_schema.consistency_sync (id INT NOT NULL PRIMARY KEY, marker BIGINT NOT NULL) ENGINE=InnoDB",
+	} {
+		if _, err := conn.Exec(query); err != nil {
+			return nil, fmt.Errorf("%s: %s", query, err)
+		}
+	}
+	if _, err := conn.Exec("DELETE FROM replication_manager_schema.consistency_checksum WHERE db=? AND tbl=?", ct.Schema, ct.Table); err != nil {
+		return nil, err
+	}
+
+	// null columns are added so that NULL and an empty string differ
+	var isNull []string
+	for _, c := range columns {
+		isNull = append(isNull, "ISNULL("+c+")")
+	}
+	crc := "COALESCE(LOWER(CONV(BIT_XOR(CAST(CRC32(CONCAT_WS('#'," + strings.Join(columns, ",") + ",CONCAT(" + strings.Join(isNull, ",") + "))) AS UNSIGNED)), 10, 16)), '0')"
+	table := dbhelper.QuoteIdentifier(ct.Schema) + "." + dbhelper.QuoteIdentifier(ct.Table)
+	pkList := strings.Join(pk, ",")
+	budget := time.Duration(cluster.Conf.MonitorConsistencyChunkTime) * time.Millisecond
+	chunks := make(map[int64]ConsistencyChunk)
+	lower := ""
+	for chunk := int64(1); ; chunk++ {
+		if err := cluster.waitConsistencyDelay(master); err != nil {
+			return nil, err
+		}
+		cluster.updateConsistencyCheck(func(cc *ConsistencyCheck) { cc.Chunk = chunk })
+		start := time.Now()
+		where := ""
+		if lower != "" {
+			where = " WHERE " + getConsistencyChunkWhere(pkList, lower, "")
+		}
+		var next []interface{}
+		rows, err := conn.Queryx("SELECT "+pkList+" FROM "+table+" FORCE INDEX(PRIMARY)"+where+" ORDER BY "+pkList+" LIMIT 1 OFFSET ?", ct.ChunkSize-1)
+		if err != nil {
+			return nil, err
+		}
+		if rows.Next() {
+			next, err = rows.SliceScan()
+		}
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		upper := ""
+		if next != nil {
+			upper = getConsistencyBound(next)
+		}
+		_, err = conn.Exec("REPLACE INTO replication_manager_schema.consistency_checksum (db, tbl, chunk, pass, lower_boundary, upper_boundary, this_cnt, this_crc) SELECT ?, ?, ?, ?, ?, ?, COUNT(*), "+crc+" FROM "+table+" FORCE INDEX(PRIMARY) WHERE "+getConsistencyChunkWhere(pkList, lower, upper),
+			ct.Schema, ct.Table, chunk, ct.Pass, lower, upper)
+		if err != nil {
+			return nil, err
+		}
+		c := ConsistencyChunk{Chunk: chunk, Lower: lower, Upper: upper}
+		err = conn.QueryRowx("SELECT this_cnt, this_crc FROM replication_manager_schema.consistency_checksum WHERE db=? AND tbl=? AND chunk=?", ct.Schema, ct.Table, chunk).Scan(&c.MasterCount, &c.MasterCrc)
+		if err != nil {
+			return nil, err
+		}
+		elapsed := time.Since(start)
+		_, err = conn.Exec("UPDATE replication_manager_schema.consistency_checksum SET master_cnt=?, master_crc=?, chunk_time=? WHERE db=? AND tbl=? AND chunk=?",
+			c.MasterCount, c.MasterCrc, elapsed.Seconds(), ct.Schema, ct.Table, chunk)
+		if err != nil {
+			return nil, err
+		}
+		chunks[chunk] = c
+		ct.Chunks = chunk
+		ct.Rows += c.MasterCount
+
+		ct.ChunkSize = getConsistencyChunkSize(ct.ChunkSize, c.MasterCount, elapsed, budget)
+		if next == nil {
+			break
+		}
+		lower = upper
+	}
+	return chunks, nil
+}
+
+type consistencyChecksum struct {
+	Chunk       int64          `db:"chunk"`
+	Count       int64          `db:"this_cnt"`
+	Crc         string         `db:"this_crc"`
+	MasterCount sql.NullInt64  `db:"master_cnt"`
+	MasterCrc   sql.NullString `db:"master_crc"`
+}
+
+// compareConsistencyReplica wait for the replica to apply the checksum of
+// the last chunk and return its mismatched chunks
+func (cluster *Cluster) compareConsistencyReplica(master *ServerMonitor, s *ServerMonitor, ct *ConsistencyTable, chunks map[int64]ConsistencyChunk) ([]ConsistencyChunk, error) {
+	timeout := time.Now().Add(time.Duration(cluster.Conf.MonitorConsistencyMaxDelay)*time.Second + consistencyReplicaTimeout)
+	for {
+		var count sql.NullInt64
+		err := s.Conn.QueryRowx("SELECT master_cnt FROM replication_manager_schema.consistency_checksum WHERE db=? AND tbl=? AND chunk=? AND pass=?", ct.Schema, ct.Table, ct.Chunks, ct.Pass).Scan(&count)
+		if err == nil && count.Valid {
+			break
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if cluster.isConsistencyCheckStopped(master) {
+			return nil, errConsistencyStopped
+		}
+		if time.Now().After(timeout) {
+			return nil, fmt.Errorf("Checksum of pass %d not replicated in time", ct.Pass)
+		}
+		time.Sleep(time.Second)
+	}
+
+	var checksums []consistencyChecksum
+	query := "SELECT chunk, this_cnt, this_crc, master_cnt, master_crc FROM replication_manager_schema.consistency_checksum WHERE db=? AND tbl=? AND pass=? AND (master_cnt <> this_cnt OR master_crc <> this_crc OR ISNULL(master_crc) <> ISNULL(this_crc)) ORDER BY chunk"
+	err := s.Conn.Select(&checksums, query, ct.Schema, ct.Table, ct.Pass)
+	cluster.LogSQL(query, err, s.URL, "Monitor", LvlDbg, "Could not fetch consistency checksums %s", err)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []ConsistencyChunk
+	for _, cs := range checksums {
+		c := chunks[cs.Chunk]
+		c.Chunk = cs.Chunk
+		c.Count = cs.Count
+		c.Crc = cs.Crc
+		mismatches = append(mismatches, c)
+	}
+	return mismatches, nil
+}
+
+// repairConsistencyChunk generate the repair of a mismatched chunk and apply
+// it when asked, the repair is added to the audit trail
+func (cluster *Cluster) repairConsistencyChunk(master *ServerMonitor, s *ServerMonitor, schema string, table string, c ConsistencyChunk, apply bool) *ConsistencyRepair {
+	r := &ConsistencyRepair{
+		Schema:  schema,
+		Table:   table,
+		Chunk:   c.Chunk,
+		Lower:   c.Lower,
+		Upper:   c.Upper,
+		Server:  s.URL,
+		State:   ConstConsistencyRepairApplying,
+		Created: time.Now(),
+	}
+	cluster.addConsistencyRepair(r, s.Id)
+	cluster.runConsistencyRepair(master, s, r, apply)
+	return r
+}
+
+// addConsistencyRepair give the repair an unique id and add it to the audit
+// trail
+func (cluster *Cluster) addConsistencyRepair(r *ConsistencyRepair, serverId string) {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	cluster.loadConsistencyCheck()
+	now := r.Created
+	for r.Id == "" || cluster.getConsistencyRepair(r.Id) != nil {
+		r.Id = fmt.Sprintf("%s-%s.%s-%d-%s", now.Format("20060102150405.000000"), r.Schema, r.Table, r.Chunk, serverId)
+		now = now.Add(time.Microsecond)
+	}
+	cluster.consistencyRepairs = append([]*ConsistencyRepair{r}, cluster.consistencyRepairs...)
+	if len(cluster.consistencyRepairs) > consistencyRepairHistory {
+		cluster.consistencyRepairs = cluster.consistencyRepairs[:consistencyRepairHistory]
+	}
+}
+
+// getConsistencyRepair is called with the consistency mutex
+func (cluster *Cluster) getConsistencyRepair(id string) *ConsistencyRepair {
+	for _, r := range cluster.consistencyRepairs {
+		if r.Id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// runConsistencyRepair generate the REPLACE and DELETE statements that make
+// the replica chunk like the master one once the replica caught up, applied
+// repairs lock the rows of the chunk on the master and run the statements
+// with binlog off before the master rows are unlocked
+func (cluster *Cluster) runConsistencyRepair(master *ServerMonitor, s *ServerMonitor, r *ConsistencyRepair, apply bool) {
+	statements, replaced, deleted, err := cluster.syncConsistencyChunk(master, s, r, apply)
+	cluster.consistencyMutex.Lock()
+	r.Replaced = replaced
+	r.Deleted = deleted
+	r.Statements = statements
+	r.Truncated = false
+	if len(r.Statements) > consistencyRepairStatements {
+		r.Statements = r.Statements[:consistencyRepairStatements]
+		r.Truncated = true
+	}
+	r.Error = ""
+	switch {
+	case err != nil:
+		r.State = ConstConsistencyRepairFailed
+		r.Error = err.Error()
+	case len(statements) == 0:
+		r.State = ConstConsistencyRepairInSync
+	case apply:
+		r.State = ConstConsistencyRepairApplied
+		r.Applied = time.Now()
+	default:
+		r.State = ConstConsistencyRepairPending
+	}
+	cluster.saveConsistencyRepairs()
+	cluster.consistencyMutex.Unlock()
+
+	switch r.State {
+	case ConstConsistencyRepairFailed:
+		cluster.LogPrintf(LvlErr, "Consistency repair %s failed: %s", r.Id, err)
+		cluster.LogEvent(journal.ConstEventJob, "consistency-repair-failed", s.URL, "", "Consistency repair %s of %s.%s chunk %d failed: %s", r.Id, r.Schema, r.Table, r.Chunk, err)
+	case ConstConsistencyRepairApplied:
+		cluster.LogPrintf(LvlInfo, "Consistency repair %s applied on %s, %d rows replaced, %d rows deleted", r.Id, s.URL, replaced, deleted)
+		cluster.LogEvent(journal.ConstEventJob, "consistency-repair-applied", s.URL, "", "Consistency repair %s of %s.%s chunk %d applied, %d rows replaced, %d rows deleted", r.Id, r.Schema, r.Table, r.Chunk, replaced, deleted)
+	case ConstConsistencyRepairPending:
+		cluster.LogPrintf(LvlInfo, "Consistency repair %s generated for %s, %d rows to replace, %d rows to delete", r.Id, s.URL, replaced, deleted)
+	case ConstConsistencyRepairInSync:
+		cluster.LogPrintf(LvlInfo, "Consistency repair %s found chunk %d of %s.%s in sync on %s", r.Id, r.Chunk, r.Schema, r.Table, s.URL)
+	}
+}
+
+// readConsistencyRows return the SQL literals of the rows of a chunk, keyed
+// by the literals of their primary key
+func readConsistencyRows(q sqlx.Queryer, query string, pkIndex []int) (map[string][]string, []string, error) {
+	rows, err := q.Queryx(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	values := make(map[string][]string)
+	var keys []string
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return nil, nil, err
+		}
+		literals := make([]string, len(row))
+		for i, v := range row {
+			literals[i] = dbhelper.QuoteValue(v)
+		}
+		var key []string
+		for _, i := range pkIndex {
+			key = append(key, literals[i])
+		}
+		values[strings.Join(key, ",")] = literals
+		keys = append(keys, strings.Join(key, ","))
+	}
+	return values, keys, rows.Err()
+}
+
+// diffConsistencyRows return the statements that make the replica rows like
+// the master ones, with the count of replaced and deleted rows
+func diffConsistencyRows(table string, columns []string, pkList string, masterRows map[string][]string, masterKeys []string, replicaRows map[string][]string, replicaKeys []string) ([]string, int, int) {
+	var statements []string
+	var replaced, deleted int
+	for _, key := range masterKeys {
+		if row, ok := replicaRows[key]; ok && strings.Join(row, ",") == strings.Join(masterRows[key], ",") {
+			continue
+		}
+		statements = append(statements, "REPLACE INTO "+table+" ("+strings.Join(columns, ",")+") VALUES ("+strings.Join(masterRows[key], ",")+")")
+		replaced++
+	}
+	for _, key := range replicaKeys {
+		if _, ok := masterRows[key]; ok {
+			continue
+		}
+		statements = append(statements, "DELETE FROM "+table+" WHERE ("+pkList+") = ("+key+")")
+		deleted++
+	}
+	return statements, replaced, deleted
+}
+
+func (cluster *Cluster) syncConsistencyChunk(master *ServerMonitor, s *ServerMonitor, r *ConsistencyRepair, apply bool) ([]string, int, int, error) {
+	mconn, err := master.GetNewDBConn()
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("%s: %s", master.URL, err)
+	}
+	defer mconn.Close()
+	pk, columns, err := cluster.getConsistencyTableColumns(master, mconn, r.Schema, r.Table)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var pkIndex []int
+	for _, p := range pk {
+		for i, c := range columns {
+			if c == p {
+				pkIndex = append(pkIndex, i)
+			}
+		}
+	}
+	table := dbhelper.QuoteIdentifier(r.Schema) + "." + dbhelper.QuoteIdentifier(r.Table)
+	pkList := strings.Join(pk, ",")
+	query := "SELECT " + strings.Join(columns, ",") + " FROM " + table + " FORCE INDEX(PRIMARY) WHERE " + getConsistencyChunkWhere(pkList, r.Lower, r.Upper) + " ORDER BY " + pkList
+
+	// generated statements are only read, the rows are locked to be applied
+	var masterRows map[string][]string
+	var masterKeys []string
+	var tx *sqlx.Tx
+	if apply {
+		tx, err = mconn.Beginx()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		defer tx.Rollback()
+		masterRows, masterKeys, err = readConsistencyRows(tx, query+" LOCK IN SHARE MODE", pkIndex)
+	} else {
+		masterRows, masterKeys, err = readConsistencyRows(mconn, query, pkIndex)
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	// the replica has the master rows once it has the marker, locked rows can
+	// not change until the end of the transaction
+	marker := time.Now().UnixNano()
+	if _, err := mconn.Exec("REPLACE INTO replication_manager_schema.consistency_sync (id, marker) VALUES (1, ?)", marker); err != nil {
+		return nil, 0, 0, err
+	}
+	timeout := time.Now().Add(consistencyRepairTimeout)
+	for {
+		var replicated int64
+		err := s.Conn.QueryRowx("SELECT marker FROM replication_manager_schema.consistency_sync WHERE id=1").Scan(&replicated)
+		if err == nil && replicated >= marker {
+			break
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return nil, 0, 0, err
+		}
+		if time.Now().After(timeout) {
+			return nil, 0, 0, fmt.Errorf("Replica %s did not catch up with the master in %s", s.URL, consistencyRepairTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	replicaRows, replicaKeys, err := readConsistencyRows(s.Conn, query, pkIndex)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	statements, replaced, deleted := diffConsistencyRows(table, columns, pkList, masterRows, masterKeys, replicaRows, replicaKeys)
+	if !apply || len(statements) == 0 {
+		return statements, replaced, deleted, nil
+	}
+
+	rconn, err := s.GetNewDBConn()
+	if err != nil {
+		return statements, replaced, deleted, fmt.Errorf("%s: %s", s.URL, err)
+	}
+	defer rconn.Close()
+	rconn.SetMaxOpenConns(1)
+	// foreign keys are not checked so that a REPLACE does not cascade
+	for _, query := range []string{"SET SESSION sql_log_bin=0", "SET SESSION foreign_key_checks=0"} {
+		if _, err := rconn.Exec(query); err != nil {
+			return statements, replaced, deleted, fmt.Errorf("%s: %s", query, err)
+		}
+	}
+	rtx, err := rconn.Beginx()
+	if err != nil {
+		return statements, replaced, deleted, err
+	}
+	defer rtx.Rollback()
+	for _, statement := range statements {
+		if _, err := rtx.Exec(statement); err != nil {
+			return statements, replaced, deleted, fmt.Errorf("%s: %s", statement, err)
+		}
+	}
+	if err := rtx.Commit(); err != nil {
+		return statements, replaced, deleted, err
+	}
+	return statements, replaced, deleted, tx.Commit()
+}
+
+// ApplyConsistencyRepair apply a pending or failed repair, its statements
+// are generated again as the chunk may have changed since
+func (cluster *Cluster) ApplyConsistencyRepair(id string) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		return errors.New("No master")
+	}
+	cluster.consistencyMutex.Lock()
+	cluster.loadConsistencyCheck()
+	r := cluster.getConsistencyRepair(id)
+	if r == nil {
+		cluster.consistencyMutex.Unlock()
+		return fmt.Errorf("Repair %s not found", id)
+	}
+	if r.State != ConstConsistencyRepairPending && r.State != ConstConsistencyRepairFailed {
+		cluster.consistencyMutex.Unlock()
+		return fmt.Errorf("Repair %s is %s", id, r.State)
+	}
+	s := cluster.GetServerFromURL(r.Server)
+	if s == nil || s == master || s.IsDown() || s.Conn == nil {
+		cluster.consistencyMutex.Unlock()
+		return fmt.Errorf("Replica %s is not available", r.Server)
+	}
+	r.State = ConstConsistencyRepairApplying
+	cluster.saveConsistencyRepairs()
+	cluster.consistencyMutex.Unlock()
+
+	go cluster.runConsistencyRepair(master, s, r, true)
+	return nil
+}
+
+// setConsistencyStates raise the mismatched chunks of the last results that
+// are not repaired at every monitor tick
+func (cluster *Cluster) setConsistencyStates() {
+	if !cluster.Conf.MonitorConsistency {
+		return
+	}
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	if cluster.consistency == nil {
+		return
+	}
+	repaired := make(map[string]bool)
+	for _, r := range cluster.consistencyRepairs {
+		repaired[r.Id] = r.State == ConstConsistencyRepairApplied || r.State == ConstConsistencyRepairInSync
+	}
+	var inconsistencies []string
+	for _, t := range cluster.consistency.Tables {
+		for _, r := range t.Replicas {
+			n := 0
+			for _, c := range r.Chunks {
+				if !repaired[c.Repair] {
+					n++
+				}
+			}
+			if n > 0 {
+				inconsistencies = append(inconsistencies, fmt.Sprintf("%s.%s on %s (%d chunks)", t.Schema, t.Table, r.URL, n))
+			}
+		}
+	}
+	if len(inconsistencies) > 0 {
+		cluster.SetState("ERR00100", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00100"], strings.Join(inconsistencies, ", ")), ErrFrom: "CHECK"})
+	}
+}
@@ -0,0 +1,164 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestConsistencyChunkWhere(t *testing.T) {
+	tests := []struct {
+		pk, lower, upper, where string
+	}{
+		{"`id`", "", "", "1=1"},
+		{"`id`", "10", "", "(`id`) > (10)"},
+		{"`id`", "", "20", "(`id`) <= (20)"},
+		{"`id`", "10", "20", "(`id`) > (10) AND (`id`) <= (20)"},
+		{"`a`,`b`", "1,'x'", "2,'y'", "(`a`,`b`) > (1,'x') AND (`a`,`b`) <= (2,'y')"},
+	}
+	for _, tt := range tests {
+		if where := getConsistencyChunkWhere(tt.pk, tt.lower, tt.upper); where != tt.where {
+			t.Errorf("Expected %s, got %s", tt.where, where)
+		}
+	}
+}
+
+func TestConsistencyBound(t *testing.T) {
+	tests := []struct {
+		values []interface{}
+		bound  string
+	}{
+		{[]interface{}{int64(42)}, "42"},
+		{[]interface{}{int64(1), "it's"}, `1,'it\'s'`},
+		{[]interface{}{[]byte("a"), nil}, "'a',NULL"},
+		{[]interface{}{[]byte{0xff, 0x00}}, "0xff00"},
+	}
+	for _, tt := range tests {
+		if bound := getConsistencyBound(tt.values); bound != tt.bound {
+			t.Errorf("Expected %s, got %s", tt.bound, bound)
+		}
+	}
+}
+
+func TestConsistencyChunkSize(t *testing.T) {
+	budget := 500 * time.Millisecond
+	tests := []struct {
+		name    string
+		size    int64
+		count   int64
+		elapsed time.Duration
+		budget  time.Duration
+		next    int64
+	}{
+		{"fast chunk grows", 1000, 1000, 100 * time.Millisecond, budget, 3000},
+		{"slow chunk shrinks", 1000, 1000, time.Second, budget, 750},
+		{"on budget", 1000, 1000, budget, budget, 1000},
+		{"minimum", 10, 10, time.Minute, budget, consistencyMinChunkSize},
+		{"maximum", consistencyMaxChunkSize, consistencyMaxChunkSize, time.Millisecond, budget, consistencyMaxChunkSize},
+		{"empty chunk", 1000, 0, time.Millisecond, budget, 1000},
+		{"no budget", 1000, 1000, time.Millisecond, 0, 1000},
+	}
+	for _, tt := range tests {
+		if next := getConsistencyChunkSize(tt.size, tt.count, tt.elapsed, tt.budget); next != tt.next {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.next, next)
+		}
+	}
+}
+
+func newConsistencyTestDB(t *testing.T, rows ...string) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	for _, query := range append([]string{"CREATE TABLE t (a INTEGER, b TEXT, c TEXT, PRIMARY KEY (a, b))"}, rows...) {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestConsistencyRowsDiff(t *testing.T) {
+	master := newConsistencyTestDB(t,
+		"INSERT INTO t VALUES (1, 'x', 'same')",
+		"INSERT INTO t VALUES (2, 'x', 'master')",
+		"INSERT INTO t VALUES (3, 'x', NULL)",
+		"INSERT INTO t VALUES (4, 'x', 'missing')",
+	)
+	defer master.Close()
+	replica := newConsistencyTestDB(t,
+		"INSERT INTO t VALUES (1, 'x', 'same')",
+		"INSERT INTO t VALUES (2, 'x', 'replica')",
+		"INSERT INTO t VALUES (3, 'x', '')",
+		"INSERT INTO t VALUES (5, 'y', 'extra')",
+	)
+	defer replica.Close()
+
+	// the primary key is the first and the second column
+	query := "SELECT a, b, c FROM t ORDER BY a, b"
+	masterRows, masterKeys, err := readConsistencyRows(master, query, []int{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(masterKeys, " ") != "1,'x' 2,'x' 3,'x' 4,'x'" || strings.Join(masterRows["3,'x'"], ",") != "3,'x',NULL" {
+		t.Fatalf("Unexpected master rows %v %v", masterKeys, masterRows)
+	}
+	replicaRows, replicaKeys, err := readConsistencyRows(replica, query, []int{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements, replaced, deleted := diffConsistencyRows("`s`.`t`", []string{"`a`", "`b`", "`c`"}, "`a`,`b`", masterRows, masterKeys, replicaRows, replicaKeys)
+	expected := []string{
+		"REPLACE INTO `s`.`t` (`a`,`b`,`c`) VALUES (2,'x','master')",
+		"REPLACE INTO `s`.`t` (`a`,`b`,`c`) VALUES (3,'x',NULL)",
+		"REPLACE INTO `s`.`t` (`a`,`b`,`c`) VALUES (4,'x','missing')",
+		"DELETE FROM `s`.`t` WHERE (`a`,`b`) = (5,'y')",
+	}
+	if strings.Join(statements, "\n") != strings.Join(expected, "\n") || replaced != 3 || deleted != 1 {
+		t.Errorf("Unexpected repair, %d replaced %d deleted:\n%s", replaced, deleted, strings.Join(statements, "\n"))
+	}
+
+	// a chunk in sync needs no statement
+	statements, replaced, deleted = diffConsistencyRows("`s`.`t`", []string{"`a`", "`b`", "`c`"}, "`a`,`b`", masterRows, masterKeys, masterRows, masterKeys)
+	if len(statements) != 0 || replaced != 0 || deleted != 0 {
+		t.Errorf("Expected no statement for a chunk in sync, got %v", statements)
+	}
+}
+
+func TestConsistencyRepairId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "consistency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{WorkingDir: dir}
+	now := time.Now()
+	ids := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		r := &ConsistencyRepair{Schema: "s", Table: "t", Chunk: 1, Created: now}
+		cluster.addConsistencyRepair(r, "db2")
+		if ids[r.Id] {
+			t.Errorf("Expected unique repair ids, got %s twice", r.Id)
+		}
+		ids[r.Id] = true
+	}
+	if repairs := cluster.GetConsistencyRepairs(); len(repairs) != 3 {
+		t.Errorf("Expected 3 repairs in the audit trail, got %d", len(repairs))
+	}
+}
@@ -6,7 +6,10 @@
 
 package cluster
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 func (cluster *Cluster) RemoveServerFromIndex(index int) {
 	newServers := make([]*ServerMonitor, 0)
@@ -17,6 +20,7 @@ func (cluster *Cluster) RemoveServerFromIndex(index int) {
 
 func (cluster *Cluster) CancelRollingRestart() error {
 	cluster.LogPrintf(LvlInfo, "API receive cancel rolling restart")
+	cluster.CancelWorkflowType("rolling-restart")
 	for _, pr := range cluster.Proxies {
 		pr.DelRestartCookie()
 	}
@@ -28,6 +32,7 @@ func (cluster *Cluster) CancelRollingRestart() error {
 
 func (cluster *Cluster) CancelRollingReprov() error {
 	cluster.LogPrintf(LvlInfo, "API receive cancel rolling re-provision")
+	cluster.CancelWorkflowType("rolling-reprov")
 	for _, pr := range cluster.Proxies {
 		pr.DelReprovisionCookie()
 	}
@@ -75,3 +80,13 @@ func (cluster *Cluster) DropProxyTag(dtag string) {
 	cluster.SetClusterCredentialsFromConfig()
 	cluster.SetProxiesRestartCookie()
 }
+
+func (cluster *Cluster) DeleteAlertSilence(id string) error {
+	err := cluster.AlertRouter.DeleteSilence(id)
+	if err != nil {
+		return err
+	}
+	cluster.LogPrintf(LvlInfo, "Alert silence %s deleted", id)
+	cluster.IsAlertDisable = cluster.AlertRouter.HasGlobalSilence(time.Now())
+	return cluster.saveAlertSilences()
+}
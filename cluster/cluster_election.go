@@ -0,0 +1,181 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	ConstElectionPolicyZone     string = "zone"
+	ConstElectionPolicyWorkload string = "workload"
+	ConstElectionPolicyDelay    string = "delay"
+	ConstElectionPolicyBackup   string = "backup"
+)
+
+// ElectionPolicy score a candidate between 0 and 1, or veto it with a reason.
+// Scores only order candidates sharing the highest GTID or binlog position,
+// data safety stays a hard constraint of the election.
+type ElectionPolicy interface {
+	GetName() string
+	Score(cluster *Cluster, sl *ServerMonitor) (float64, string)
+}
+
+// ElectionScore is the weighted result of one policy for one candidate
+type ElectionScore struct {
+	Policy string  `json:"policy"`
+	Weight float64 `json:"weight"`
+	Score  float64 `json:"score"`
+	Veto   string  `json:"veto,omitempty"`
+}
+
+type weightedElectionPolicy struct {
+	policy ElectionPolicy
+	weight float64
+}
+
+// zoneElectionPolicy prefer candidates in the network locality of the master,
+// the servers of db-servers-locality or the others
+type zoneElectionPolicy struct{}
+
+func (p zoneElectionPolicy) GetName() string {
+	return ConstElectionPolicyZone
+}
+
+func (p zoneElectionPolicy) Score(cluster *Cluster, sl *ServerMonitor) (float64, string) {
+	local := true
+	if cluster.master != nil {
+		local = cluster.IsInLocality(cluster.master)
+	}
+	if cluster.IsInLocality(sl) == local {
+		return 1, ""
+	}
+	return 0, ""
+}
+
+// workloadElectionPolicy avoid candidates with a high average CPU usage, a
+// candidate without measured load gets the worst score
+type workloadElectionPolicy struct{}
+
+func (p workloadElectionPolicy) GetName() string {
+	return ConstElectionPolicyWorkload
+}
+
+func (p workloadElectionPolicy) Score(cluster *Cluster, sl *ServerMonitor) (float64, string) {
+	load, ok := sl.WorkLoad["average"]
+	if !ok {
+		return 0, ""
+	}
+	cpu := load.CpuThreadPool
+	if load.CpuUserStats > cpu {
+		cpu = load.CpuUserStats
+	}
+	if cpu < 0 {
+		// unknown load
+		return 0, ""
+	}
+	if cpu > 100 {
+		cpu = 100
+	}
+	return 1 - cpu/100, ""
+}
+
+// delayElectionPolicy prefer candidates with the lowest replication delay and
+// errors history since monitoring started
+type delayElectionPolicy struct{}
+
+func (p delayElectionPolicy) GetName() string {
+	return ConstElectionPolicyDelay
+}
+
+func (p delayElectionPolicy) Score(cluster *Cluster, sl *ServerMonitor) (float64, string) {
+	if sl.DelayStat == nil {
+		return 0.5, ""
+	}
+	total := sl.DelayStat.Total
+	return 1 / (1 + total.DelayAvg + float64(total.SlaveErrCount)), ""
+}
+
+// backupElectionPolicy never elect the hosts of db-servers-backup-hosts
+type backupElectionPolicy struct{}
+
+func (p backupElectionPolicy) GetName() string {
+	return ConstElectionPolicyBackup
+}
+
+func (p backupElectionPolicy) Score(cluster *Cluster, sl *ServerMonitor) (float64, string) {
+	if cluster.IsInPreferedBackupHosts(sl) {
+		return 0, "backup host"
+	}
+	return 1, ""
+}
+
+func newElectionPolicy(name string) ElectionPolicy {
+	switch name {
+	case ConstElectionPolicyZone:
+		return zoneElectionPolicy{}
+	case ConstElectionPolicyWorkload:
+		return workloadElectionPolicy{}
+	case ConstElectionPolicyDelay:
+		return delayElectionPolicy{}
+	case ConstElectionPolicyBackup:
+		return backupElectionPolicy{}
+	}
+	return nil
+}
+
+// getElectionPolicies parse failover-election-policies, a comma separated list
+// of policy[:weight] with a default weight of 1
+func (cluster *Cluster) getElectionPolicies() []weightedElectionPolicy {
+	var chain []weightedElectionPolicy
+	for _, item := range strings.Split(cluster.Conf.FailoverElectionPolicies, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name := item
+		weight := 1.0
+		if i := strings.Index(item, ":"); i > 0 {
+			name = item[:i]
+			w, err := strconv.ParseFloat(item[i+1:], 64)
+			if err != nil {
+				cluster.LogPrintf(LvlErr, "Invalid weight in election policy %s: %s", item, err)
+				continue
+			}
+			weight = w
+		}
+		policy := newElectionPolicy(name)
+		if policy == nil {
+			cluster.LogPrintf(LvlErr, "Unknown election policy %s", name)
+			continue
+		}
+		chain = append(chain, weightedElectionPolicy{policy: policy, weight: weight})
+	}
+	return chain
+}
+
+// scoreElectionCandidate run the policy chain on a candidate and fill its
+// election row, it returns the first veto
+func (cluster *Cluster) scoreElectionCandidate(chain []weightedElectionPolicy, sl *ServerMonitor, tp *Trackpos) string {
+	veto := ""
+	for _, wp := range chain {
+		score, reason := wp.policy.Score(cluster, sl)
+		tp.Scores = append(tp.Scores, ElectionScore{Policy: wp.policy.GetName(), Weight: wp.weight, Score: score, Veto: reason})
+		tp.Score += wp.weight * score
+		if reason != "" && veto == "" {
+			veto = reason
+		}
+	}
+	if veto != "" {
+		tp.Vetoed = true
+	}
+	return veto
+}
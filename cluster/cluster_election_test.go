@@ -0,0 +1,112 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+)
+
+func newElectionTestServer(name string) *ServerMonitor {
+	return &ServerMonitor{Name: name, Host: name, URL: name + ":3306"}
+}
+
+func TestElectionPolicyScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		locality  string
+		backup    string
+		candidate func(sl *ServerMonitor)
+		score     float64
+		veto      string
+	}{
+		{name: "zone same locality", policy: ConstElectionPolicyZone, locality: "db1,db2", score: 1},
+		{name: "zone other locality", policy: ConstElectionPolicyZone, locality: "db1", score: 0},
+		{name: "zone no locality", policy: ConstElectionPolicyZone, locality: "", score: 1},
+		{name: "workload idle", policy: ConstElectionPolicyWorkload, score: 1, candidate: func(sl *ServerMonitor) {
+			sl.WorkLoad = map[string]WorkLoad{"average": {}}
+		}},
+		{name: "workload busy", policy: ConstElectionPolicyWorkload, score: 0.25, candidate: func(sl *ServerMonitor) {
+			sl.WorkLoad = map[string]WorkLoad{"average": {CpuThreadPool: 40, CpuUserStats: 75}}
+		}},
+		{name: "workload saturated", policy: ConstElectionPolicyWorkload, score: 0, candidate: func(sl *ServerMonitor) {
+			sl.WorkLoad = map[string]WorkLoad{"average": {CpuThreadPool: 250}}
+		}},
+		{name: "workload unknown", policy: ConstElectionPolicyWorkload, score: 0, candidate: func(sl *ServerMonitor) {
+			sl.WorkLoad = map[string]WorkLoad{"average": {CpuThreadPool: -1, CpuUserStats: -1}}
+		}},
+		{name: "workload not measured", policy: ConstElectionPolicyWorkload, score: 0, candidate: func(sl *ServerMonitor) {
+			sl.WorkLoad = map[string]WorkLoad{"current": {}}
+		}},
+		{name: "delay no history", policy: ConstElectionPolicyDelay, score: 0.5},
+		{name: "delay clean", policy: ConstElectionPolicyDelay, score: 1, candidate: func(sl *ServerMonitor) {
+			sl.DelayStat = new(ServerDelayStat)
+		}},
+		{name: "delay lagging", policy: ConstElectionPolicyDelay, score: 0.25, candidate: func(sl *ServerMonitor) {
+			sl.DelayStat = &ServerDelayStat{Total: DelayStat{DelayAvg: 2, SlaveErrCount: 1}}
+		}},
+		{name: "backup host", policy: ConstElectionPolicyBackup, backup: "db2:3306", score: 0, veto: "backup host"},
+		{name: "not a backup host", policy: ConstElectionPolicyBackup, backup: "db3:3306", score: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &Cluster{}
+			cluster.Conf.DBServersLocality = tt.locality
+			cluster.Conf.BackupServers = tt.backup
+			cluster.master = newElectionTestServer("db1")
+			sl := newElectionTestServer("db2")
+			if tt.candidate != nil {
+				tt.candidate(sl)
+			}
+			score, veto := newElectionPolicy(tt.policy).Score(cluster, sl)
+			if score != tt.score || veto != tt.veto {
+				t.Errorf("Expected score %v veto %q, got %v %q", tt.score, tt.veto, score, veto)
+			}
+		})
+	}
+}
+
+func TestElectionPolicyChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies string
+		policy   []string
+		score    float64
+		veto     string
+	}{
+		{name: "empty", policies: "", score: 0},
+		{name: "default weight", policies: "zone, delay", policy: []string{"zone", "delay"}, score: 1.5},
+		{name: "weights", policies: "zone:2,delay:4", policy: []string{"zone", "delay"}, score: 4},
+		{name: "invalid entries skipped", policies: "zone:x,unknown,delay:2", policy: []string{"delay"}, score: 1},
+		{name: "veto", policies: "backup,zone:3", policy: []string{"backup", "zone"}, score: 3, veto: "backup host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &Cluster{}
+			cluster.Conf.FailoverElectionPolicies = tt.policies
+			cluster.Conf.BackupServers = "db2"
+			cluster.master = newElectionTestServer("db1")
+			chain := cluster.getElectionPolicies()
+			if len(chain) != len(tt.policy) {
+				t.Fatalf("Expected policies %v, got %d", tt.policy, len(chain))
+			}
+			for i, wp := range chain {
+				if wp.policy.GetName() != tt.policy[i] {
+					t.Errorf("Expected policy %s at %d, got %s", tt.policy[i], i, wp.policy.GetName())
+				}
+			}
+			tp := new(Trackpos)
+			veto := cluster.scoreElectionCandidate(chain, newElectionTestServer("db2"), tp)
+			if tp.Score != tt.score || veto != tt.veto || tp.Vetoed != (tt.veto != "") || len(tp.Scores) != len(chain) {
+				t.Errorf("Expected score %v veto %q, got %+v", tt.score, tt.veto, tp)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/signal18/replication-manager/utils/dbhelper"
 	"github.com/signal18/replication-manager/utils/gtid"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/state"
 )
 
@@ -31,30 +32,48 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		return res
 	}
 	cluster.StateMachine.SetFailoverState()
+	cluster.failoverReport = newFailoverReport(cluster.Name, fail)
+	cluster.failoverReport.startTrace(cluster.getTraceContext(), &cluster.failoverTraceCtx)
 	// Phase 1: Cleanup and election
 	var err error
 	if fail == false {
 		cluster.LogPrintf(LvlInfo, "--------------------------")
 		cluster.LogPrintf(LvlInfo, "Starting master switchover")
 		cluster.LogPrintf(LvlInfo, "--------------------------")
+		cluster.logFailoverEvent(fail, "start", "", "Starting master switchover")
+		cluster.failoverReport.StartPhase("check-long-writes")
 		cluster.LogPrintf(LvlInfo, "Checking long running updates on master %d", cluster.Conf.SwitchWaitWrite)
 		if cluster.master == nil {
 			cluster.LogPrintf(LvlErr, "Cannot switchover without a master")
+			cluster.logFailoverEvent(fail, "cancel", "", "Cannot switchover without a master")
+			cluster.saveFailoverReport(false, "Cannot switchover without a master")
 			return false
 		}
 		if cluster.master.Conn == nil {
 			cluster.LogPrintf(LvlErr, "Cannot switchover without a master connection")
+			cluster.logFailoverEvent(fail, "cancel", cluster.master.URL, "Cannot switchover without a master connection")
+			cluster.saveFailoverReport(false, "Cannot switchover without a master connection")
+			return false
+		}
+		if cluster.IsInSchemaChange() {
+			cluster.LogPrintf(LvlErr, "Schema change running. Cannot switchover")
+			cluster.logFailoverEvent(fail, "cancel", cluster.master.URL, "Schema change running")
+			cluster.saveFailoverReport(false, "Schema change running")
+			cluster.StateMachine.RemoveFailoverState()
 			return false
 		}
 		qt, logs, err := dbhelper.CheckLongRunningWrites(cluster.master.Conn, cluster.Conf.SwitchWaitWrite)
 		cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlDbg, "CheckLongRunningWrites")
 		if qt > 0 {
 			cluster.LogPrintf(LvlErr, "Long updates running on master. Cannot switchover")
+			cluster.logFailoverEvent(fail, "cancel", cluster.master.URL, "Long updates running on master")
+			cluster.saveFailoverReport(false, "Long updates running on master")
 			cluster.StateMachine.RemoveFailoverState()
 			return false
 		}
 
 		cluster.LogPrintf(LvlInfo, "Flushing tables on master %s", cluster.master.URL)
+		cluster.failoverReport.StartPhase("flush-tables")
 		workerFlushTable := make(chan error, 1)
 		if cluster.master.DBVersion.IsMariaDB() && cluster.master.DBVersion.Major > 10 && cluster.master.DBVersion.Minor >= 1 {
 
@@ -64,6 +83,13 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 				cluster.LogSQL(logs, err2, cluster.master.URL, "MasterFailover", LvlDbg, "MariaDBFlushTablesNoLogTimeout")
 				workerFlushTable <- err2
 			}()
+		} else if cluster.master.DBVersion.IsPPostgreSQL() {
+			go func() {
+				var err2 error
+				logs, err2 = dbhelper.PostgresCheckpoint(cluster.master.Conn)
+				cluster.LogSQL(logs, err2, cluster.master.URL, "MasterFailover", LvlDbg, "PostgresCheckpoint")
+				workerFlushTable <- err2
+			}()
 		} else {
 			go func() {
 				var err2 error
@@ -81,6 +107,8 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 			}
 		case <-time.After(time.Second * time.Duration(cluster.Conf.SwitchWaitTrx)):
 			cluster.LogPrintf(LvlErr, "Long running trx on master at least %d, can not switchover ", cluster.Conf.SwitchWaitTrx)
+			cluster.logFailoverEvent(fail, "cancel", cluster.master.URL, "Long running trx on master at least %d", cluster.Conf.SwitchWaitTrx)
+			cluster.saveFailoverReport(false, "Long running trx on master")
 			cluster.StateMachine.RemoveFailoverState()
 			return false
 		}
@@ -88,14 +116,21 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	} else {
 		if cluster.Conf.MultiMasterGrouprep {
 			// group replication auto elect a new master in case of failure do nothing
+			cluster.failoverReport.Finish(true, "")
+			cluster.failoverReport = nil
 			cluster.StateMachine.RemoveFailoverState()
 			return true
 		}
 		cluster.LogPrintf(LvlInfo, "------------------------")
 		cluster.LogPrintf(LvlInfo, "Starting master failover")
 		cluster.LogPrintf(LvlInfo, "------------------------")
+		cluster.logFailoverEvent(fail, "start", "", "Starting master failover")
 	}
 	cluster.LogPrintf(LvlInfo, "Electing a new master")
+	cluster.failoverReport.StartPhase("election")
+	if cluster.master != nil {
+		cluster.failoverReport.OldMaster = cluster.master.URL
+	}
 	for _, s := range cluster.slaves {
 		s.Refresh()
 	}
@@ -107,14 +142,19 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	}
 	if key == -1 {
 		cluster.LogPrintf(LvlErr, "No candidates found")
+		cluster.logFailoverEvent(fail, "cancel", "", "No candidates found")
+		cluster.saveFailoverReport(false, "No candidates found")
 		cluster.StateMachine.RemoveFailoverState()
 		return false
 	}
 
 	cluster.LogPrintf(LvlInfo, "Slave %s has been elected as a new master", cluster.slaves[key].URL)
+	cluster.logFailoverEvent(fail, "elect", cluster.slaves[key].URL, "Slave %s has been elected as a new master", cluster.slaves[key].URL)
 
 	if fail && !cluster.isSlaveElectable(cluster.slaves[key], true) {
 		cluster.LogPrintf(LvlInfo, "Elected slave have issue cancelling failover", cluster.slaves[key].URL)
+		cluster.logFailoverEvent(fail, "cancel", cluster.slaves[key].URL, "Elected slave have issue cancelling failover")
+		cluster.saveFailoverReport(false, "Elected slave "+cluster.slaves[key].URL+" is not electable")
 		cluster.StateMachine.RemoveFailoverState()
 		return false
 	}
@@ -128,15 +168,23 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	}
 	cluster.oldMaster = cluster.master
 	cluster.master = cluster.Servers[skey]
+	cluster.failoverReport.NewMaster = cluster.master.URL
 	cluster.master.SetMaster()
 	if cluster.Conf.MultiMaster == false {
 		cluster.slaves[key].delete(&cluster.slaves)
 	}
+	cluster.failoverReport.StartPhase("pre-script")
 	cluster.failoverPreScript(fail)
 
 	// Phase 2: Reject updates and sync slaves on switchover
 	if fail == false {
+		cluster.failoverReport.StartPhase("freeze")
+		cluster.failoverReport.BlockWrites()
 		cluster.oldMaster.freeze()
+		if cluster.IsPostgresStreaming() {
+			// streaming has no relay log, wait for the last WAL of the old primary
+			cluster.master.WaitSyncToMaster(cluster.oldMaster)
+		}
 	}
 	// Sync candidate depending on the master status.
 	// If it's a switchover, use MASTER_POS_WAIT to sync.
@@ -144,6 +192,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	// If maxsclale we should wait for relay catch via old style
 
 	cluster.LogPrintf(LvlInfo, "Waiting for candidate master %s to apply relay log", cluster.master.URL)
+	cluster.failoverReport.StartPhase("relay-log-apply")
 	err = cluster.master.ReadAllRelayLogs()
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Error while reading relay logs on candidate %s: %s", cluster.master.URL, err)
@@ -152,6 +201,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	//cluster.failoverCrash()
 
 	cluster.LogPrintf(LvlInfo, "Save replication status and crash infos before opening traffic")
+	cluster.failoverReport.StartPhase("crash-info")
 	ms, err := cluster.master.GetSlaveStatus(cluster.master.ReplicationSourceName)
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Failover can not fetch replication info on new master: %s", err)
@@ -166,7 +216,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	crash.FailoverMasterLogPos = ms.ReadMasterLogPos.String
 	crash.NewMasterLogFile = cluster.master.BinaryLogFile
 	crash.NewMasterLogPos = cluster.master.BinaryLogPos
-	if cluster.master.DBVersion.IsMariaDB() {
+	if cluster.master.DBVersion.IsMariaDB() || cluster.master.DBVersion.IsPPostgreSQL() {
 		if cluster.Conf.MxsBinlogOn {
 			crash.FailoverIOGtid = cluster.master.CurrentGtid
 		} else {
@@ -183,6 +233,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	var relaymaster *ServerMonitor
 	if cluster.Conf.MxsBinlogOn || cluster.Conf.MultiTierSlave {
 		cluster.LogPrintf(LvlInfo, "Candidate master has to catch up with relay server log position")
+		cluster.failoverReport.StartPhase("relay-server-catchup")
 		relaymaster = cluster.GetRelayServer()
 		if relaymaster != nil {
 			rs, err := relaymaster.GetSlaveStatus(relaymaster.ReplicationSourceName)
@@ -214,8 +265,19 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		}
 	} // end relay server
 
+	cluster.failoverReport.FailoverMasterLogFile = crash.FailoverMasterLogFile
+	cluster.failoverReport.FailoverMasterLogPos = crash.FailoverMasterLogPos
+	if crash.FailoverIOGtid != nil {
+		cluster.failoverReport.FailoverIOGtid = crash.FailoverIOGtid.Sprint()
+	}
+
 	// Phase 3: Prepare new master
-	if !cluster.Conf.MultiMaster && !cluster.Conf.MultiMasterGrouprep {
+	cluster.failoverReport.StartPhase("prepare-new-master")
+	if cluster.IsPostgresStreaming() {
+		cluster.LogPrintf(LvlInfo, "Promoting standby %s", cluster.master.URL)
+		logs, err := cluster.master.PromotePostgres()
+		cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlErr, "Failed promoting new master %s %s", cluster.master.URL, err)
+	} else if !cluster.Conf.MultiMaster && !cluster.Conf.MultiMasterGrouprep {
 		cluster.LogPrintf(LvlInfo, "Stopping slave threads on new master")
 		if cluster.master.DBVersion.IsMariaDB() || (cluster.master.DBVersion.IsMariaDB() == false && cluster.master.DBVersion.Minor < 7) {
 			logs, err := cluster.master.StopSlave()
@@ -230,10 +292,12 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	cluster.Crashes = append(cluster.Crashes, crash)
 	t := time.Now()
 	crash.Save(cluster.WorkingDir + "/failover." + t.Format("20060102150405") + ".json")
+	go cluster.uploadBackupStorageFile(cluster.WorkingDir + "/failover." + t.Format("20060102150405") + ".json")
 	crash.Purge(cluster.WorkingDir, cluster.Conf.FailoverLogFileKeep)
 	cluster.Save()
 
-	if !cluster.Conf.MultiMaster && !cluster.Conf.MultiMasterGrouprep {
+	cluster.failoverReport.StartPhase("read-write")
+	if !cluster.Conf.MultiMaster && !cluster.Conf.MultiMasterGrouprep && !cluster.IsPostgresStreaming() {
 		cluster.LogPrintf(LvlInfo, "Resetting slave on new master and set read/write mode on")
 		if cluster.master.DBVersion.IsMySQLOrPercona() {
 			// Need to stop all threads to reset on MySQL
@@ -253,16 +317,36 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		cluster.LogPrintf(LvlErr, "Could not set new master as read-write")
 	}
 	cluster.LogPrintf(LvlInfo, "Failover proxies")
+	cluster.logFailoverEvent(fail, "proxies", cluster.master.URL, "Failover proxies")
+	cluster.failoverReport.StartPhase("proxies")
 	cluster.failoverProxies()
 	cluster.failoverProxiesWaitMonitor()
+	// traffic is routed to the new master from now
+	cluster.failoverReport.UnblockWrites()
+	cluster.failoverReport.StartPhase("post-script")
 	cluster.failoverPostScript(fail)
 	cluster.failoverEnableEventScheduler()
 	// Insert a bogus transaction in order to have a new GTID pos on master
-	cluster.LogPrintf(LvlInfo, "Inject fake transaction on new master %s ", cluster.master.URL)
-	logs, err := dbhelper.FlushTables(cluster.master.Conn)
-	cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlErr, "Could not flush tables on new master for fake trx %s", err)
+	// Postgres promotion already start a new timeline
+	logs := ""
+	if !cluster.master.DBVersion.IsPPostgreSQL() {
+		cluster.LogPrintf(LvlInfo, "Inject fake transaction on new master %s ", cluster.master.URL)
+		logs, err = dbhelper.FlushTables(cluster.master.Conn)
+		cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", LvlErr, "Could not flush tables on new master for fake trx %s", err)
+	}
 
-	if fail == false {
+	if fail == false && cluster.IsPostgresStreaming() {
+		cluster.oldMaster.Refresh()
+		cluster.failoverReport.StartPhase("demote-old-master")
+		cluster.LogPrintf(LvlInfo, "Switching old primary to standby")
+		cluster.logFailoverEvent(fail, "demote", cluster.oldMaster.URL, "Switching old primary to standby")
+		err = cluster.oldMaster.rejoinPostgres(crash)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not restart old primary %s as standby: %s", cluster.oldMaster.URL, err)
+		}
+		cluster.oldMaster.SetState(stateSlave)
+		cluster.slaves = append(cluster.slaves, cluster.oldMaster)
+	} else if fail == false {
 		// Get latest GTID pos
 		//cluster.master.Refresh() moved just before opening writes
 		cluster.oldMaster.Refresh()
@@ -271,8 +355,10 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		// Phase 4: Demote old master to slave
 		// ********
 		cluster.LogPrintf(LvlInfo, "Killing new connections on old master showing before update route")
+		cluster.failoverReport.StartPhase("demote-old-master")
 		dbhelper.KillThreads(cluster.oldMaster.Conn, cluster.oldMaster.DBVersion)
 		cluster.LogPrintf(LvlInfo, "Switching old leader to slave")
+		cluster.logFailoverEvent(fail, "demote", cluster.oldMaster.URL, "Switching old leader to slave")
 		logs, err := dbhelper.UnlockTables(cluster.oldMaster.Conn)
 		cluster.LogSQL(logs, err, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Could not unlock tables on old master %s", err)
 
@@ -373,6 +459,8 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	// ********
 
 	cluster.LogPrintf(LvlInfo, "Switching other slaves to the new master")
+	cluster.logFailoverEvent(fail, "switch-slaves", cluster.master.URL, "Switching other slaves to the new master")
+	cluster.failoverReport.StartPhase("switch-slaves")
 	for _, sl := range cluster.slaves {
 		// Don't switch if slave was the old master or is in a multiple master setup or with relay server.
 		if sl.URL == cluster.oldMaster.URL || sl.State == stateMaster || (sl.IsRelay == false && cluster.Conf.MxsBinlogOn == true) {
@@ -383,6 +471,13 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 		if fail == false && cluster.Conf.MxsBinlogOn == false && cluster.Conf.SwitchSlaveWaitCatch {
 			sl.WaitSyncToMaster(cluster.oldMaster)
 		}
+		if cluster.IsPostgresStreaming() {
+			// the standby follow the new timeline of the promoted primary
+			cluster.LogPrintf(LvlInfo, "Change primary on standby %s", sl.URL)
+			logs, err = sl.SetPostgresPrimary(cluster.master)
+			cluster.LogSQL(logs, err, sl.URL, "MasterFailover", LvlErr, "Change primary failed on standby %s, %s", sl.URL, err)
+			continue
+		}
 		cluster.LogPrintf(LvlInfo, "Change master on slave %s", sl.URL)
 		logs, err = sl.StopSlave()
 		cluster.LogSQL(logs, err, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Could not stop slave on server %s, %s", sl.URL, err)
@@ -527,6 +622,11 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	cluster.backendStateChangeProxies()
 
 	cluster.LogPrintf(LvlInfo, "Master switch on %s complete", cluster.master.URL)
+	cluster.logFailoverEvent(fail, "complete", cluster.master.URL, "Master switch on %s complete", cluster.master.URL)
+	if cluster.master.CurrentGtid != nil {
+		cluster.failoverReport.NewMasterGtid = cluster.master.CurrentGtid.Sprint()
+	}
+	cluster.saveFailoverReport(true, "")
 	cluster.master.FailCount = 0
 	if fail == true {
 		cluster.FailoverCtr++
@@ -546,6 +646,15 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	return true
 }
 
+// logFailoverEvent journal a phase of a failover or of a switchover
+func (cluster *Cluster) logFailoverEvent(fail bool, phase string, server string, format string, args ...interface{}) {
+	evtype := journal.ConstEventSwitchover
+	if fail {
+		evtype = journal.ConstEventFailover
+	}
+	cluster.LogEvent(evtype, phase, server, "", format, args...)
+}
+
 func (cluster *Cluster) failoverPostScript(fail bool) {
 	if cluster.Conf.PostScript != "" {
 
@@ -694,6 +803,14 @@ func (cluster *Cluster) electSwitchoverGroupReplicationCandidate(l []*ServerMoni
 
 // Returns a candidate from a list of slaves. If there's only one slave it will be the de facto candidate.
 func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog bool) int {
+	key, _ := cluster.rankSwitchoverCandidates(l, forcingLog, false)
+	return key
+}
+
+// rankSwitchoverCandidates run the switchover election and return the elected
+// key with the election table, in dry run no state is raised and all preferred
+// candidates are still ranked
+func (cluster *Cluster) rankSwitchoverCandidates(l []*ServerMonitor, forcingLog bool, dryRun bool) (int, []Trackpos) {
 	ll := len(l)
 	seqList := make([]uint64, ll)
 	posList := make([]uint64, ll)
@@ -701,40 +818,74 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 	hiseq := 0
 	var max uint64
 	var maxpos uint64
+	prefered := -1
 
+	trackposList := make([]Trackpos, ll)
+	chain := cluster.getElectionPolicies()
+	if forcingLog {
+		defer func() {
+			if cluster.failoverReport != nil {
+				cluster.failoverReport.Election = trackposList
+			}
+		}()
+	}
 	for i, sl := range l {
+		trackposList[i].URL = sl.URL
+		trackposList[i].Indice = i
+		trackposList[i].Prefered = sl.IsPrefered()
+		trackposList[i].Ignoredconf = sl.IsIgnored()
+		trackposList[i].Ignoredrelay = sl.IsRelay
+		skip := func(reason string) {
+			trackposList[i].SkipReasons = append(trackposList[i].SkipReasons, reason)
+		}
 
 		/* If server is in the ignore list, do not elect it in switchover */
 		if sl.IsIgnored() {
-			cluster.StateMachine.AddState("ERR00037", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00037"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			cluster.addElectionState(dryRun, "ERR00037", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00037"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			skip("ignored by configuration")
 			continue
 		}
 		if sl.IsFull {
+			skip("disk full")
 			continue
 		}
 		//Need comment//
 		if sl.IsRelay {
-			cluster.StateMachine.AddState("ERR00036", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00036"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			cluster.addElectionState(dryRun, "ERR00036", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00036"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			skip("relay server")
 			continue
 		}
 		if !sl.HasBinlog() && !sl.IsIgnored() {
-			cluster.SetState("ERR00013", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00013"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			if !dryRun {
+				cluster.SetState("ERR00013", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00013"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			}
+			skip("binlog disabled")
 			continue
 		}
 		if cluster.Conf.MultiMaster == true && sl.State == stateMaster {
-			cluster.StateMachine.AddState("ERR00035", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00035"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			cluster.addElectionState(dryRun, "ERR00035", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00035"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			trackposList[i].Ignoredmultimaster = true
+			skip("master in multi master")
 			continue
 		}
 
 		// The tests below should run only in case of a switchover as they require the master to be up.
 
-		if cluster.isSlaveElectableForSwitchover(sl, forcingLog) == false {
-			cluster.StateMachine.AddState("ERR00034", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00034"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+		if electable, reason := cluster.checkSlaveElectableForSwitchover(sl, forcingLog, dryRun); !electable {
+			cluster.addElectionState(dryRun, "ERR00034", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00034"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			trackposList[i].Ignoredreplication = true
+			skip(reason)
 			continue
 		}
 		/* binlog + ping  */
-		if cluster.isSlaveElectable(sl, forcingLog) == false {
-			cluster.StateMachine.AddState("ERR00039", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00039"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+		if electable, reason := cluster.checkSlaveElectable(sl, forcingLog, dryRun); !electable {
+			cluster.addElectionState(dryRun, "ERR00039", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00039"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			trackposList[i].Ignoredreplication = true
+			skip(reason)
+			continue
+		}
+		if veto := cluster.scoreElectionCandidate(chain, sl, &trackposList[i]); veto != "" {
+			skip(veto)
 			continue
 		}
 
@@ -743,17 +894,24 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 			if (cluster.Conf.LogLevel > 1 || forcingLog) && cluster.IsInFailover() {
 				cluster.LogPrintf(LvlDbg, "Election rig: %s elected as preferred master", sl.URL)
 			}
-			return i
+			if !dryRun {
+				return i, trackposList
+			}
+			if prefered == -1 {
+				prefered = i
+			}
 		}
 		if sl.HaveNoMasterOnStart == true && cluster.Conf.FailRestartUnsafe == false {
-			cluster.StateMachine.AddState("ERR00084", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00084"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			cluster.addElectionState(dryRun, "ERR00084", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00084"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			skip("no master on start")
 			continue
 		}
 		ss, errss := sl.GetSlaveStatus(sl.ReplicationSourceName)
 		// not a slave
 		if errss != nil && cluster.Conf.FailRestartUnsafe == false {
 			//Skip slave in election %s have no master log file, slave might have failed
-			cluster.StateMachine.AddState("ERR00033", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00033"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			cluster.addElectionState(dryRun, "ERR00033", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00033"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			skip("no replication status")
 			continue
 		}
 		// Fake position if none as new slave
@@ -764,6 +922,7 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 			logfile = ss.MasterLogFile.String
 		}
 		if strings.Contains(logfile, ".") == false {
+			skip("no binlog position")
 			continue
 		}
 		for len(filepos) < 12 {
@@ -774,6 +933,7 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 		binlogposreach, _ := strconv.ParseUint(pos, 10, 64)
 
 		posList[i] = binlogposreach
+		trackposList[i].Pos = binlogposreach
 
 		seqnos := gtid.NewList("1-1-1").GetSeqNos()
 
@@ -789,29 +949,41 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 		for _, v := range seqnos {
 			seqList[i] += v
 		}
-		if seqList[i] > max {
+		trackposList[i].Seq = seqList[i]
+		// among equally up to date candidates the election policies decide
+		if seqList[i] > max || (seqList[i] == max && max > 0 && trackposList[i].Score > trackposList[hiseq].Score) {
 			max = seqList[i]
 			hiseq = i
 		}
-		if posList[i] > maxpos {
+		if posList[i] > maxpos || (posList[i] == maxpos && maxpos > 0 && trackposList[i].Score > trackposList[hipos].Score) {
 			maxpos = posList[i]
 			hipos = i
 		}
 
 	} //end loop all slaves
+	if prefered != -1 {
+		return prefered, trackposList
+	}
 	if max > 0 {
 		/* Return key of slave with the highest seqno. */
-		return hiseq
+		return hiseq, trackposList
 	}
 	if maxpos > 0 {
 		/* Return key of slave with the highest pos. */
-		return hipos
+		return hipos, trackposList
 	}
-	return -1
+	return -1, trackposList
 }
 
 // electFailoverCandidate ound the most up to date and look after a possibility to failover on it
 func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bool) int {
+	key, _ := cluster.rankFailoverCandidates(l, forcingLog, false)
+	return key
+}
+
+// rankFailoverCandidates run the failover election and return the elected key
+// with the election table sorted by preference, in dry run no state is raised
+func (cluster *Cluster) rankFailoverCandidates(l []*ServerMonitor, forcingLog bool, dryRun bool) (int, []Trackpos) {
 
 	ll := len(l)
 	seqList := make([]uint64, ll)
@@ -819,19 +991,6 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 
 	var maxseq uint64
 	var maxpos uint64
-	type Trackpos struct {
-		URL                string
-		Indice             int
-		Pos                uint64
-		Seq                uint64
-		Prefered           bool
-		Ignoredconf        bool
-		Ignoredrelay       bool
-		Ignoredmultimaster bool
-		Ignoredreplication bool
-		Weight             uint
-		DelayStat          DelayStat
-	}
 
 	// HaveOneValidReader is used to state that at least one replicat is available for reading via proxies
 	// In such case it is needed to add the leader in the reader server list
@@ -839,6 +998,7 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 	HaveOneValidReader := false
 
 	trackposList := make([]Trackpos, ll)
+	chain := cluster.getElectionPolicies()
 	for i, sl := range l {
 		trackposList[i].URL = sl.URL
 		trackposList[i].Indice = i
@@ -846,51 +1006,80 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 		trackposList[i].Ignoredconf = sl.IsIgnored()
 		trackposList[i].Ignoredrelay = sl.IsRelay
 		trackposList[i].DelayStat = sl.DelayStat.Total
+		skip := func(reason string) {
+			for _, r := range trackposList[i].SkipReasons {
+				if r == reason {
+					return
+				}
+			}
+			trackposList[i].SkipReasons = append(trackposList[i].SkipReasons, reason)
+		}
+		if sl.IsIgnored() {
+			skip("ignored by configuration")
+		}
 
 		//Need comment//
 		if sl.IsRelay {
-			cluster.StateMachine.AddState("ERR00036", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00036"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			cluster.addElectionState(dryRun, "ERR00036", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00036"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			skip("relay server")
 			continue
 		}
 		if sl.IsFull {
+			skip("disk full")
 			continue
 		}
 		if cluster.Conf.MultiMaster == true && sl.State == stateMaster {
-			cluster.StateMachine.AddState("ERR00035", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00035"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			cluster.addElectionState(dryRun, "ERR00035", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00035"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
 			trackposList[i].Ignoredmultimaster = true
+			skip("master in multi master")
 			continue
 		}
 		if sl.HaveNoMasterOnStart == true && cluster.Conf.FailRestartUnsafe == false {
-			cluster.StateMachine.AddState("ERR00084", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00084"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			cluster.addElectionState(dryRun, "ERR00084", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00084"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
+			skip("no master on start")
 			continue
 		}
 		if !sl.HasBinlog() && !sl.IsIgnored() {
-			cluster.SetState("ERR00013", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00013"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			if !dryRun {
+				cluster.SetState("ERR00013", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00013"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			}
+			skip("binlog disabled")
 			continue
 		}
 		if cluster.GetTopology() == topoMultiMasterWsrep && cluster.vmaster != nil {
 			if cluster.vmaster.URL == sl.URL {
+				skip("virtual master")
 				continue
 			} else if sl.State == stateWsrep {
-				return i
+				return i, trackposList
 			} else {
+				skip("not wsrep synced")
 				continue
 			}
 		}
 		if cluster.master == nil {
+			skip("no master")
 			continue
 		}
 
 		ss, errss := sl.GetSlaveStatus(sl.ReplicationSourceName)
 		// not a slave
 		if errss != nil && cluster.Conf.FailRestartUnsafe == false {
-			cluster.StateMachine.AddState("ERR00033", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00033"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			cluster.addElectionState(dryRun, "ERR00033", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00033"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
 			trackposList[i].Ignoredreplication = true
+			skip("no replication status")
 			continue
 		}
-		trackposList[i].Ignoredreplication = !cluster.isSlaveElectable(sl, false)
+		electable, reason := cluster.checkSlaveElectable(sl, false, dryRun)
+		trackposList[i].Ignoredreplication = !electable
+		if !electable {
+			skip(reason)
+		}
+		if veto := cluster.scoreElectionCandidate(chain, sl, &trackposList[i]); veto != "" {
+			skip(veto)
+		}
 		if !HaveOneValidReader {
-			HaveOneValidReader = cluster.isSlaveValidReader(sl, false)
+			HaveOneValidReader = cluster.isSlaveValidReader(sl, false, dryRun)
 		}
 		// Fake position if none as new slave
 		filepos := "1"
@@ -900,6 +1089,7 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 			logfile = ss.MasterLogFile.String
 		}
 		if strings.Contains(logfile, ".") == false {
+			skip("no binlog position")
 			continue
 		}
 		for len(filepos) < 12 {
@@ -939,18 +1129,24 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 	} //end loop all slaves
 
 	if !HaveOneValidReader {
-		cluster.StateMachine.AddState("ERR00085", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00085"]), ErrFrom: "CHECK"})
+		cluster.addElectionState(dryRun, "ERR00085", state.State{ErrType: LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00085"]), ErrFrom: "CHECK"})
 	}
 
 	if !cluster.Conf.FailoverCheckDelayStat {
 		sort.Slice(trackposList[:], func(i, j int) bool {
-			return trackposList[i].Seq > trackposList[j].Seq
+			if trackposList[i].Seq != trackposList[j].Seq {
+				return trackposList[i].Seq > trackposList[j].Seq
+			}
+			return trackposList[i].Score > trackposList[j].Score
 		})
 	} else {
 		sort.Slice(trackposList[:], func(i, j int) bool {
 			if trackposList[i].Seq != trackposList[j].Seq {
 				return trackposList[i].Seq > trackposList[j].Seq
 			}
+			if trackposList[i].Score != trackposList[j].Score {
+				return trackposList[i].Score > trackposList[j].Score
+			}
 			if trackposList[i].DelayStat.SlaveErrCount != trackposList[j].DelayStat.SlaveErrCount {
 				return trackposList[i].DelayStat.SlaveErrCount < trackposList[j].DelayStat.SlaveErrCount
 			}
@@ -966,6 +1162,9 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 	if forcingLog {
 		data, _ := json.MarshalIndent(trackposList, "", "\t")
 		cluster.LogPrintf(LvlInfo, "Election matrice: %s ", data)
+		if cluster.failoverReport != nil {
+			cluster.failoverReport.Election = trackposList
+		}
 	}
 
 	if maxseq > 0 {
@@ -973,43 +1172,49 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 
 		//send the prefered if equal max
 		for _, p := range trackposList {
-			if p.Seq == maxseq && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false && p.Prefered == true {
-				return p.Indice
+			if p.Seq == maxseq && p.Ignoredrelay == false && p.Vetoed == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false && p.Prefered == true {
+				return p.Indice, trackposList
 			}
 		}
 		//send one with maxseq
 		for _, p := range trackposList {
-			if p.Seq == maxseq && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
-				return p.Indice
+			if p.Seq == maxseq && p.Ignoredrelay == false && p.Vetoed == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
+				return p.Indice, trackposList
 			}
 		}
 		//send one with maxseq but also ignored
 		for _, p := range trackposList {
-			if p.Seq == maxseq && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == true {
+			if p.Seq == maxseq && p.Ignoredrelay == false && p.Vetoed == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == true {
 				if forcingLog {
 					cluster.LogPrintf(LvlInfo, "Ignored server is the most up to date ")
 				}
-				return p.Indice
+				return p.Indice, trackposList
 			}
 
 		}
 
-		if cluster.Conf.LogFailedElection {
+		if cluster.Conf.LogFailedElection && !dryRun {
 			data, _ := json.MarshalIndent(trackposList, "", "\t")
 			cluster.LogPrintf(LvlInfo, "Election matrice maxseq >0: %s ", data)
 		}
-		return -1
+		return -1, trackposList
 	}
 
 	if !cluster.Conf.FailoverCheckDelayStat {
 		sort.Slice(trackposList[:], func(i, j int) bool {
-			return trackposList[i].Pos > trackposList[j].Pos
+			if trackposList[i].Pos != trackposList[j].Pos {
+				return trackposList[i].Pos > trackposList[j].Pos
+			}
+			return trackposList[i].Score > trackposList[j].Score
 		})
 	} else {
 		sort.Slice(trackposList[:], func(i, j int) bool {
 			if trackposList[i].Pos != trackposList[j].Pos {
 				return trackposList[i].Pos > trackposList[j].Pos
 			}
+			if trackposList[i].Score != trackposList[j].Score {
+				return trackposList[i].Score > trackposList[j].Score
+			}
 			if trackposList[i].DelayStat.SlaveErrCount != trackposList[j].DelayStat.SlaveErrCount {
 				return trackposList[i].DelayStat.SlaveErrCount < trackposList[j].DelayStat.SlaveErrCount
 			}
@@ -1026,88 +1231,98 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 	if maxpos > 0 {
 		/* Return key of slave with the highest pos. */
 		for _, p := range trackposList {
-			if p.Pos == maxpos && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false && p.Prefered == true {
-				return p.Indice
+			if p.Pos == maxpos && p.Ignoredrelay == false && p.Vetoed == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false && p.Prefered == true {
+				return p.Indice, trackposList
 			}
 		}
 		//send one with maxpos
 		for _, p := range trackposList {
-			if p.Pos == maxpos && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
-				return p.Indice
+			if p.Pos == maxpos && p.Ignoredrelay == false && p.Vetoed == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == false {
+				return p.Indice, trackposList
 			}
 		}
 		//send one with maxpos and ignored
 		for _, p := range trackposList {
-			if p.Pos == maxpos && p.Ignoredrelay == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == true {
+			if p.Pos == maxpos && p.Ignoredrelay == false && p.Vetoed == false && p.Ignoredmultimaster == false && p.Ignoredreplication == false && p.Ignoredconf == true {
 				if forcingLog {
 					cluster.LogPrintf(LvlInfo, "Ignored server is the most up to date ")
 				}
-				return p.Indice
+				return p.Indice, trackposList
 			}
 		}
-		if cluster.Conf.LogFailedElection {
+		if cluster.Conf.LogFailedElection && !dryRun {
 			data, _ := json.MarshalIndent(trackposList, "", "\t")
 			cluster.LogPrintf(LvlInfo, "Election matrice maxpos>0: %s ", data)
 		}
-		return -1
+		return -1, trackposList
 	}
-	if cluster.Conf.LogFailedElection {
+	if cluster.Conf.LogFailedElection && !dryRun {
 		data, _ := json.MarshalIndent(trackposList, "", "\t")
 		cluster.LogPrintf(LvlInfo, "Election matrice: %s ", data)
 	}
-	return -1
+	return -1, trackposList
 }
 
 func (cluster *Cluster) isSlaveElectable(sl *ServerMonitor, forcingLog bool) bool {
+	electable, _ := cluster.checkSlaveElectable(sl, forcingLog, false)
+	return electable
+}
+
+// checkSlaveElectable return if the slave can be elected and the reason when it
+// can't, in dry run states are not raised and nothing is changed on the slave
+func (cluster *Cluster) checkSlaveElectable(sl *ServerMonitor, forcingLog bool, dryRun bool) (bool, string) {
 	ss, err := sl.GetSlaveStatus(sl.ReplicationSourceName)
 	if err != nil {
-		cluster.LogPrintf(LvlWarn, "Error in getting slave status in testing slave electable %s: %s  ", sl.URL, err)
-		return false
+		if !dryRun {
+			cluster.LogPrintf(LvlWarn, "Error in getting slave status in testing slave electable %s: %s  ", sl.URL, err)
+		}
+		return false, "no replication status"
 	}
+	logSkip := !dryRun && (cluster.Conf.LogLevel > 1 || forcingLog)
 	//if master is alived and IO Thread stops then not a good candidate and not forced
 	if ss.SlaveIORunning.String == "No" && cluster.Conf.RplChecks && !cluster.IsMasterFailed() {
-		cluster.StateMachine.AddState("ERR00087", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00087"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00087", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00087"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Unsafe failover condition. Slave %s IO Thread is stopped %s. Skipping", sl.URL, ss.LastIOError.String)
 		}
-		return false
+		return false, "IO thread stopped"
 	}
 
 	/* binlog + ping  */
 	if dbhelper.CheckSlavePrerequisites(sl.Conn, sl.Host, sl.DBVersion) == false {
-		cluster.StateMachine.AddState("ERR00040", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00040"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00040", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00040"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave %s does not ping or has no binlogs. Skipping", sl.URL)
 		}
-		return false
+		return false, "no ping or no binlogs"
 	}
 	if sl.IsMaintenance {
-		cluster.StateMachine.AddState("ERR00047", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00047"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00047", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00047"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave %s is in maintenance. Skipping", sl.URL)
 		}
-		return false
+		return false, "in maintenance"
 	}
 
 	if ss.SecondsBehindMaster.Int64 > cluster.Conf.FailMaxDelay && cluster.Conf.FailMaxDelay != -1 && cluster.Conf.RplChecks == true {
-		cluster.StateMachine.AddState("ERR00041", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00041"]+" Sql: "+sl.GetProcessListReplicationLongQuery(), sl.URL, cluster.Conf.FailMaxDelay, ss.SecondsBehindMaster.Int64), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00041", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00041"]+" Sql: "+sl.GetProcessListReplicationLongQuery(), sl.URL, cluster.Conf.FailMaxDelay, ss.SecondsBehindMaster.Int64), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Unsafe failover condition. Slave %s has more than failover-max-delay %d seconds with replication delay %d. Skipping", sl.URL, cluster.Conf.FailMaxDelay, ss.SecondsBehindMaster.Int64)
 		}
 
-		return false
+		return false, fmt.Sprintf("replication delay %d over failover-max-delay %d", ss.SecondsBehindMaster.Int64, cluster.Conf.FailMaxDelay)
 	}
 
 	if ss.SlaveSQLRunning.String == "No" && cluster.Conf.RplChecks {
-		cluster.StateMachine.AddState("ERR00042", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00042"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00042", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00042"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Unsafe failover condition. Slave %s SQL Thread is stopped. Skipping", sl.URL)
 		}
-		return false
+		return false, "SQL thread stopped"
 	}
 
 	//if master is alived and connection issues, we have to refetch password from vault
-	if ss.SlaveIORunning.String == "Connecting" && !cluster.IsMasterFailed() {
+	if ss.SlaveIORunning.String == "Connecting" && !cluster.IsMasterFailed() && !dryRun {
 		cluster.LogPrintf(LvlDbg, "isSlaveElect lastIOErrno: %s", ss.LastIOErrno.String)
 		if ss.LastIOErrno.String == "1045" {
 			cluster.StateMachine.AddState("ERR00088", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00088"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
@@ -1116,31 +1331,34 @@ func (cluster *Cluster) isSlaveElectable(sl *ServerMonitor, forcingLog bool) boo
 	}
 
 	if sl.HaveSemiSync && sl.SemiSyncSlaveStatus == false && cluster.Conf.FailSync && cluster.Conf.RplChecks {
-		cluster.StateMachine.AddState("ERR00043", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00043"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00043", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00043"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Semi-sync slave %s is out of sync. Skipping", sl.URL)
 		}
-		return false
+		return false, "semi-sync out of sync"
 	}
 	if sl.IsIgnored() {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave is in ignored list %s", sl.URL)
 		}
-		return false
+		return false, "ignored by configuration"
 	}
-	return true
+	return true, ""
 }
 
-func (cluster *Cluster) isSlaveValidReader(sl *ServerMonitor, forcingLog bool) bool {
+func (cluster *Cluster) isSlaveValidReader(sl *ServerMonitor, forcingLog bool, dryRun bool) bool {
 	ss, err := sl.GetSlaveStatus(sl.ReplicationSourceName)
 	if err != nil {
-		cluster.LogPrintf(LvlWarn, "Error in getting slave status in testing slave electable %s: %s  ", sl.URL, err)
+		if !dryRun {
+			cluster.LogPrintf(LvlWarn, "Error in getting slave status in testing slave electable %s: %s  ", sl.URL, err)
+		}
 		return false
 	}
+	logSkip := !dryRun && (cluster.Conf.LogLevel > 1 || forcingLog)
 
 	if sl.IsMaintenance {
-		cluster.StateMachine.AddState("ERR00047", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00047"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00047", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00047"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave %s is in maintenance. Skipping", sl.URL)
 		}
 		return false
@@ -1163,14 +1381,14 @@ func (cluster *Cluster) isSlaveValidReader(sl *ServerMonitor, forcingLog bool) b
 	}
 	*/
 	if ss.SlaveSQLRunning.String == "No" {
-		cluster.StateMachine.AddState("ERR00042", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00042"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		cluster.addElectionState(dryRun, "ERR00042", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00042"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Unsafe failover condition. Slave %s SQL Thread is stopped. Skipping", sl.URL)
 		}
 		return false
 	}
 	if sl.IsIgnored() {
-		if cluster.Conf.LogLevel > 1 || forcingLog {
+		if logSkip {
 			cluster.LogPrintf(LvlWarn, "Slave is in ignored list %s", sl.URL)
 		}
 		return false
@@ -1178,6 +1396,15 @@ func (cluster *Cluster) isSlaveValidReader(sl *ServerMonitor, forcingLog bool) b
 	return true
 }
 
+// addElectionState raise a state found by the election checks, plans run the
+// same checks in dry run and leave the state machine untouched
+func (cluster *Cluster) addElectionState(dryRun bool, key string, s state.State) {
+	if dryRun {
+		return
+	}
+	cluster.StateMachine.AddState(key, s)
+}
+
 func (cluster *Cluster) foundPreferedMaster(l []*ServerMonitor) *ServerMonitor {
 	for _, sl := range l {
 		if strings.Contains(cluster.Conf.PrefMaster, sl.URL) && cluster.master.State != stateFailed {
@@ -1191,6 +1418,8 @@ func (cluster *Cluster) foundPreferedMaster(l []*ServerMonitor) *ServerMonitor {
 func (cluster *Cluster) VMasterFailover(fail bool) bool {
 
 	cluster.StateMachine.SetFailoverState()
+	cluster.failoverReport = newFailoverReport(cluster.Name, fail)
+	cluster.failoverReport.startTrace(cluster.getTraceContext(), &cluster.failoverTraceCtx)
 	// Phase 1: Cleanup and election
 	var err error
 	cluster.oldMaster = cluster.vmaster
@@ -1198,24 +1427,30 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		cluster.LogPrintf(LvlInfo, "----------------------------------")
 		cluster.LogPrintf(LvlInfo, "Starting virtual master switchover")
 		cluster.LogPrintf(LvlInfo, "----------------------------------")
+		cluster.logFailoverEvent(fail, "start", "", "Starting virtual master switchover")
+		cluster.failoverReport.StartPhase("check-long-writes")
 		cluster.LogPrintf(LvlInfo, "Checking long running updates on virtual master %d", cluster.Conf.SwitchWaitWrite)
 		if cluster.vmaster == nil {
 			cluster.LogPrintf(LvlErr, "Cannot switchover without a virtual master")
+			cluster.saveFailoverReport(false, "Cannot switchover without a virtual master")
 			return false
 		}
 		if cluster.vmaster.Conn == nil {
 			cluster.LogPrintf(LvlErr, "Cannot switchover without a vmaster connection")
+			cluster.saveFailoverReport(false, "Cannot switchover without a virtual master connection")
 			return false
 		}
 		qt, logs, err := dbhelper.CheckLongRunningWrites(cluster.vmaster.Conn, cluster.Conf.SwitchWaitWrite)
 		cluster.LogSQL(logs, err, cluster.vmaster.URL, "MasterFailover", LvlDbg, "CheckLongRunningWrites")
 		if qt > 0 {
 			cluster.LogPrintf(LvlErr, "Long updates running on virtual master. Cannot switchover")
+			cluster.saveFailoverReport(false, "Long updates running on virtual master")
 			cluster.StateMachine.RemoveFailoverState()
 			return false
 		}
 
 		cluster.LogPrintf(LvlInfo, "Flushing tables on virtual master %s", cluster.vmaster.URL)
+		cluster.failoverReport.StartPhase("flush-tables")
 		workerFlushTable := make(chan error, 1)
 
 		go func() {
@@ -1232,6 +1467,7 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 			}
 		case <-time.After(time.Second * time.Duration(cluster.Conf.SwitchWaitTrx)):
 			cluster.LogPrintf(LvlErr, "Long running trx on master at least %d, can not switchover ", cluster.Conf.SwitchWaitTrx)
+			cluster.saveFailoverReport(false, "Long running trx on master")
 			cluster.StateMachine.RemoveFailoverState()
 			return false
 		}
@@ -1240,9 +1476,14 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		cluster.LogPrintf(LvlInfo, "-------------------------------")
 		cluster.LogPrintf(LvlInfo, "Starting virtual master failover")
 		cluster.LogPrintf(LvlInfo, "-------------------------------")
+		cluster.logFailoverEvent(fail, "start", "", "Starting virtual master failover")
 		cluster.oldMaster = cluster.master
 	}
 	cluster.LogPrintf(LvlInfo, "Electing a new virtual master")
+	cluster.failoverReport.StartPhase("election")
+	if cluster.oldMaster != nil {
+		cluster.failoverReport.OldMaster = cluster.oldMaster.URL
+	}
 	for _, s := range cluster.slaves {
 		s.Refresh()
 	}
@@ -1259,10 +1500,12 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 	}
 	if key == -1 {
 		cluster.LogPrintf(LvlErr, "No candidates found")
+		cluster.saveFailoverReport(false, "No candidates found")
 		cluster.StateMachine.RemoveFailoverState()
 		return false
 	}
 	cluster.LogPrintf(LvlInfo, "Server %s has been elected as a new master", cluster.slaves[key].URL)
+	cluster.logFailoverEvent(fail, "elect", cluster.slaves[key].URL, "Server %s has been elected as a new master", cluster.slaves[key].URL)
 
 	// Shuffle the server list
 
@@ -1275,11 +1518,15 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 	}
 	cluster.vmaster = cluster.Servers[skey]
 	cluster.master = cluster.Servers[skey]
+	cluster.failoverReport.NewMaster = cluster.master.URL
+	cluster.failoverReport.StartPhase("pre-script")
 	cluster.failoverPreScript(fail)
 
 	// Phase 2: Reject updates and sync slaves on switchover
 	if fail == false && cluster.GetTopology() != topoMultiMasterWsrep {
 		cluster.LogPrintf(LvlInfo, "Rejecting updates on %s (old master)", cluster.oldMaster.URL)
+		cluster.failoverReport.StartPhase("freeze")
+		cluster.failoverReport.BlockWrites()
 		cluster.oldMaster.freeze()
 	}
 	if !fail && cluster.Conf.MultiMasterGrouprep {
@@ -1300,11 +1547,13 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		// If maxsclale we should wait for relay catch via old style
 
 		cluster.LogPrintf(LvlInfo, "Waiting for candidate master to apply relay log")
+		cluster.failoverReport.StartPhase("relay-log-apply")
 		err = cluster.master.ReadAllRelayLogs()
 		if err != nil {
 			cluster.LogPrintf(LvlErr, "Error while reading relay logs on candidate: %s", err)
 		}
 
+		cluster.failoverReport.StartPhase("crash-info")
 		crash := new(Crash)
 		crash.URL = cluster.oldMaster.URL
 		crash.ElectedMasterURL = cluster.master.URL
@@ -1335,22 +1584,31 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		}
 		cluster.master.FailoverSemiSyncSlaveStatus = cluster.master.SemiSyncSlaveStatus
 		crash.FailoverSemiSyncSlaveStatus = cluster.master.SemiSyncSlaveStatus
+		cluster.failoverReport.FailoverMasterLogFile = crash.FailoverMasterLogFile
+		cluster.failoverReport.FailoverMasterLogPos = crash.FailoverMasterLogPos
+		if crash.FailoverIOGtid != nil {
+			cluster.failoverReport.FailoverIOGtid = crash.FailoverIOGtid.Sprint()
+		}
 		cluster.Crashes = append(cluster.Crashes, crash)
 		cluster.Save()
 		t := time.Now()
 		crash.Save(cluster.WorkingDir + "/failover." + t.Format("20060102150405") + ".json")
+		go cluster.uploadBackupStorageFile(cluster.WorkingDir + "/failover." + t.Format("20060102150405") + ".json")
 		crash.Purge(cluster.WorkingDir, cluster.Conf.FailoverLogFileKeep)
 	}
 
 	// Phase 3: Prepare new master
-
+	cluster.failoverReport.StartPhase("read-write")
 	err = cluster.master.SetReadWrite()
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Could not set new master as read-write %s", err)
 	}
 	// Call post-failover script before unlocking the old master.
+	cluster.failoverReport.StartPhase("proxies")
 	cluster.failoverProxies()
 	cluster.failoverProxiesWaitMonitor()
+	cluster.failoverReport.UnblockWrites()
+	cluster.failoverReport.StartPhase("post-script")
 	cluster.failoverEnableEventScheduler()
 	cluster.failoverPostScript(fail)
 	if cluster.Conf.FailEventStatus {
@@ -1371,6 +1629,7 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		// Phase 4: Demote old master to slave
 		// ********
 		cluster.LogPrintf(LvlInfo, "Switching old master as a slave")
+		cluster.failoverReport.StartPhase("demote-old-master")
 		logs, err := dbhelper.UnlockTables(cluster.oldMaster.Conn)
 		cluster.LogSQL(logs, err, cluster.oldMaster.URL, "MasterFailover", LvlErr, "Could not unlock tables on old master %s", err)
 
@@ -1400,9 +1659,15 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		// ********
 		// Phase 5: Closing loop
 		// ********
+		cluster.failoverReport.StartPhase("close-ring")
 		cluster.CloseRing(cluster.oldMaster)
 	}
 	cluster.LogPrintf(LvlInfo, "Virtual Master switch on %s complete", cluster.vmaster.URL)
+	cluster.logFailoverEvent(fail, "complete", cluster.vmaster.URL, "Virtual Master switch on %s complete", cluster.vmaster.URL)
+	if cluster.vmaster.CurrentGtid != nil {
+		cluster.failoverReport.NewMasterGtid = cluster.vmaster.CurrentGtid.Sprint()
+	}
+	cluster.saveFailoverReport(true, "")
 	cluster.vmaster.FailCount = 0
 	if fail == true {
 		cluster.FailoverCtr++
@@ -23,8 +23,10 @@ import (
 	"github.com/siddontang/go/log"
 	"github.com/signal18/replication-manager/config"
 	v3 "github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/alert"
 	"github.com/signal18/replication-manager/utils/cron"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/state"
 )
@@ -90,6 +92,13 @@ func (cluster *Cluster) GetMysqlclientPath() string {
 	return cluster.Conf.BackupMysqlclientPath
 }
 
+func (cluster *Cluster) GetMysqlUpgradePath() string {
+	if cluster.Conf.ProvDbUpgradeBinaryPath == "" {
+		return cluster.GetShareDir() + "/" + cluster.Conf.GoArch + "/" + cluster.Conf.GoOS + "/mysql_upgrade"
+	}
+	return cluster.Conf.ProvDbUpgradeBinaryPath
+}
+
 func (cluster *Cluster) GetDomain() string {
 	if cluster.Conf.ProvNetCNI {
 		return "." + cluster.Name + ".svc." + cluster.Conf.ProvOrchestratorCluster
@@ -1049,3 +1058,52 @@ func (cluster *Cluster) GetVaultToken() {
 		//cluster.LogPrintf(LvlInfo, "COUCOU test %s", authInfo.Auth.ClientToken)
 	}
 }
+
+func (cluster *Cluster) GetNotifier(name string) alert.Notifier {
+	for _, n := range cluster.Notifiers {
+		if n.GetName() == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func (cluster *Cluster) GetAlertSilences() []alert.Silence {
+	if cluster.AlertRouter == nil {
+		return nil
+	}
+	return cluster.AlertRouter.GetSilences()
+}
+
+func (cluster *Cluster) GetAlertRoutes() []alert.Route {
+	if cluster.AlertRouter == nil {
+		return nil
+	}
+	return cluster.AlertRouter.Routes
+}
+
+func (cluster *Cluster) loadAlertSilences() error {
+	file, err := ioutil.ReadFile(cluster.WorkingDir + "/alertsilences.json")
+	if err != nil {
+		return err
+	}
+	var silences []alert.Silence
+	err = json.Unmarshal(file, &silences)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "File error: %v\n", err)
+		return err
+	}
+	for _, s := range silences {
+		if _, err := cluster.AlertRouter.AddSilence(s); err != nil {
+			cluster.LogPrintf(LvlInfo, "Drop alert silence %s: %s", s.Id, err)
+		}
+	}
+	return nil
+}
+
+func (cluster *Cluster) GetEvents(filter journal.Filter) ([]journal.Event, error) {
+	if cluster.Journal == nil {
+		return []journal.Event{}, errors.New("Events journal is disabled")
+	}
+	return cluster.Journal.Query(filter)
+}
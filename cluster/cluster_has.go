@@ -117,6 +117,16 @@ func (cluster *Cluster) IsInPreferedBackupHosts(server *ServerMonitor) bool {
 	return false
 }
 
+func (cluster *Cluster) IsInLocality(server *ServerMonitor) bool {
+	ihosts := strings.Split(cluster.Conf.DBServersLocality, ",")
+	for _, ihost := range ihosts {
+		if server.URL == ihost || server.Name == ihost || server.Host == ihost {
+			return true
+		}
+	}
+	return false
+}
+
 func (cluster *Cluster) IsInIgnoredReadonly(server *ServerMonitor) bool {
 	ihosts := strings.Split(cluster.Conf.IgnoreSrvRO, ",")
 	for _, ihost := range ihosts {
@@ -359,6 +369,10 @@ func (cluster *Cluster) IsMultiMaster() bool {
 	return false
 }
 
+func (cluster *Cluster) IsPostgresStreaming() bool {
+	return cluster.GetTopology() == topoMasterSlavePgStream
+}
+
 func (cluster *Cluster) HasReplicationCredentialsRotation() bool {
 	if cluster.Conf.IsVaultUsed() && cluster.Conf.IsPath(cluster.Conf.RplUser) {
 		client, err := cluster.GetVaultConnection()
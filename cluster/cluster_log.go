@@ -22,6 +22,7 @@ import (
 	"github.com/atc0005/go-teams-notify/v2/messagecard"
 
 	"github.com/nsf/termbox-go"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/s18log"
 	log "github.com/sirupsen/logrus"
 )
@@ -132,6 +133,30 @@ func (cluster *Cluster) LogUpdate(line int, level string, format string, args ..
 	return line
 }
 
+// LogEvent record an event in the cluster journal when enabled and push it to
+// the live stream subscribers
+func (cluster *Cluster) LogEvent(evtype string, code string, server string, user string, format string, args ...interface{}) {
+	e := journal.Event{
+		Timestamp: time.Now(),
+		Cluster:   cluster.Name,
+		Type:      evtype,
+		Code:      code,
+		Server:    server,
+		User:      user,
+		Message:   fmt.Sprintf(format, args...),
+	}
+	if cluster.Journal != nil {
+		var err error
+		e, err = cluster.Journal.Append(e)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Could not write event to journal: %s", err)
+		}
+	}
+	if cluster.EventBroker != nil {
+		cluster.EventBroker.Publish(e)
+	}
+}
+
 func (cluster *Cluster) LogPrintf(level string, format string, args ...interface{}) int {
 	//fmt.Printf("CLUSTER LOGPRINTF %s :"+format, level, args)
 	line := 0
@@ -0,0 +1,854 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/misc"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/xbstream"
+)
+
+const (
+	ConstPitrTargetTime     = "time"
+	ConstPitrTargetPosition = "position"
+	ConstPitrTargetGtid     = "gtid"
+
+	ConstPitrValidated = "validated"
+	ConstPitrRunning   = "running"
+	ConstPitrDone      = "done"
+	ConstPitrFailed    = "failed"
+
+	ConstPitrCheckOk      = "ok"
+	ConstPitrCheckWarning = "warning"
+	ConstPitrCheckError   = "error"
+)
+
+var (
+	pitrBinlogRegexp       = regexp.MustCompile(`^(.+)\.([0-9]{6,})$`)
+	pitrGtidRegexp         = regexp.MustCompile(`^([0-9]+)-([0-9]+)-([0-9]+)$`)
+	pitrChangeMasterRegexp = regexp.MustCompile(`MASTER_LOG_FILE='([^']+)',\s*MASTER_LOG_POS=([0-9]+)`)
+	pitrGtidSlavePosRegexp = regexp.MustCompile(`gtid_slave_pos\s*=\s*'([^']*)'`)
+	pitrGtidPurgedRegexp   = regexp.MustCompile(`GTID_PURGED=(?:/\*!80000 '\+'\*/ )?'([^']*)'`)
+)
+
+// PitrBackup is a base backup with the binlog coordinates it is consistent
+// with, the binlogs are replayed from there
+type PitrBackup struct {
+	Type       string    `json:"type"`
+	Path       string    `json:"path"`
+	Source     string    `json:"source"`
+	Time       time.Time `json:"time"`
+	BinLogFile string    `json:"binLogFile"`
+	BinLogPos  uint64    `json:"binLogPos"`
+	Gtid       string    `json:"gtid"`
+	// Replica is set when the source was a replica, the coordinates are
+	// those of its master and not of its own binlogs
+	Replica bool `json:"replica"`
+}
+
+type PitrCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// PitrReport is the plan of a point-in-time recovery with the checks done
+// before the restore and after the binlog replay
+type PitrReport struct {
+	Id         string      `json:"id"`
+	Cluster    string      `json:"cluster"`
+	Server     string      `json:"server"`
+	TargetType string      `json:"targetType"`
+	Target     string      `json:"target"`
+	Provision  bool        `json:"provision"`
+	State      string      `json:"state"`
+	Backup     *PitrBackup `json:"backup"`
+	BinlogDir  string      `json:"binlogDir"`
+	Binlogs    []string    `json:"binlogs"`
+	Checks     []PitrCheck `json:"checks"`
+	Start      time.Time   `json:"start"`
+	End        time.Time   `json:"end"`
+	Error      string      `json:"error,omitempty"`
+	targetTime time.Time
+	targetFile string
+	targetPos  uint64
+}
+
+func (r *PitrReport) addCheck(name string, status string, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, PitrCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *PitrReport) HasError() bool {
+	for _, c := range r.Checks {
+		if c.Status == ConstPitrCheckError {
+			return true
+		}
+	}
+	return false
+}
+
+func (cluster *Cluster) getPitrReportDir() string {
+	return cluster.WorkingDir + "/reports"
+}
+
+func (cluster *Cluster) getPitrReportFile(id string) string {
+	return cluster.getPitrReportDir() + "/pitr." + id + ".json"
+}
+
+func (cluster *Cluster) savePitrReport(r *PitrReport) {
+	err := os.MkdirAll(cluster.getPitrReportDir(), 0755)
+	if err == nil {
+		saveJson, _ := json.MarshalIndent(r, "", "\t")
+		err = ioutil.WriteFile(cluster.getPitrReportFile(r.Id), saveJson, 0644)
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save point-in-time recovery report: %s", err)
+	}
+}
+
+func (cluster *Cluster) hasPitrReport(id string) bool {
+	_, err := os.Stat(cluster.getPitrReportFile(id))
+	return err == nil
+}
+
+// GetPitrReports return the point-in-time recovery reports, most recent first
+func (cluster *Cluster) GetPitrReports() []*PitrReport {
+	reports := []*PitrReport{}
+	dir := cluster.getPitrReportDir()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return reports
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "pitr.") {
+			continue
+		}
+		content, err := ioutil.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			continue
+		}
+		r := new(PitrReport)
+		if json.Unmarshal(content, r) == nil {
+			reports = append(reports, r)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Start.After(reports[j].Start) })
+	return reports
+}
+
+// PointInTimeRecovery restore the nearest backup before the target on the
+// server and replay the archived binlogs up to the target. The target is a
+// time, a binlog file:position or a MariaDB GTID. With dryrun only the
+// validation report is returned, the recovery runs in background otherwise.
+func (cluster *Cluster) PointInTimeRecovery(server *ServerMonitor, targetType string, target string, provision bool, dryrun bool) (*PitrReport, error) {
+	cluster.Lock()
+	if cluster.pitrReport != nil {
+		cluster.Unlock()
+		return nil, fmt.Errorf("Point-in-time recovery of %s is running", cluster.pitrReport.Server)
+	}
+	r := &PitrReport{Cluster: cluster.Name, Server: server.URL, TargetType: targetType, Target: target, Provision: provision, Start: time.Now()}
+	// reports started in the same instant get distinct ids, the report is
+	// saved under the lock to reserve its id
+	now := r.Start
+	for r.Id == "" || cluster.hasPitrReport(r.Id) {
+		r.Id = now.Format("20060102150405.000000")
+		now = now.Add(time.Microsecond)
+	}
+	cluster.savePitrReport(r)
+	if !dryrun {
+		cluster.pitrReport = r
+	}
+	cluster.Unlock()
+
+	cluster.planPitr(r, server)
+	if r.HasError() {
+		r.State = ConstPitrFailed
+		r.Error = "Validation failed"
+		r.End = time.Now()
+	} else if dryrun {
+		r.State = ConstPitrValidated
+		r.End = time.Now()
+	} else {
+		r.State = ConstPitrRunning
+	}
+	cluster.savePitrReport(r)
+	if r.State != ConstPitrRunning {
+		cluster.Lock()
+		cluster.pitrReport = nil
+		cluster.Unlock()
+		return r, nil
+	}
+	cluster.LogPrintf(LvlInfo, "Point-in-time recovery of %s to %s %s from %s backup of %s", server.URL, targetType, target, r.Backup.Type, r.Backup.Time.Format("2006-01-02 15:04:05"))
+	go cluster.runPitr(r, server)
+	return r, nil
+}
+
+func (cluster *Cluster) planPitr(r *PitrReport, server *ServerMonitor) {
+	if server.IsMaster() {
+		r.addCheck("server", ConstPitrCheckError, "Can not recover over the master %s", server.URL)
+	} else if server.IsDown() && !r.Provision {
+		r.addCheck("server", ConstPitrCheckError, "Server %s is down, provision it for the recovery", server.URL)
+	} else {
+		r.addCheck("server", ConstPitrCheckOk, "Server %s will be put in maintenance with replication stopped", server.URL)
+	}
+
+	if err := cluster.parsePitrTarget(r, server); err != nil {
+		r.addCheck("target", ConstPitrCheckError, "%s", err)
+		return
+	}
+	r.addCheck("target", ConstPitrCheckOk, "Recover to %s %s", r.TargetType, r.Target)
+
+	backups, skipped := cluster.getPitrBackups()
+	for _, s := range skipped {
+		r.addCheck("backup", ConstPitrCheckWarning, "%s", s)
+	}
+	r.Backup = cluster.getPitrNearestBackup(r, backups)
+	if r.Backup == nil {
+		r.addCheck("backup", ConstPitrCheckError, "No backup with binlog coordinates before the target in %d backups", len(backups))
+		return
+	}
+	r.addCheck("backup", ConstPitrCheckOk, "%s backup of %s taken %s at %s:%d", r.Backup.Type, r.Backup.Source, r.Backup.Time.Format("2006-01-02 15:04:05"), r.Backup.BinLogFile, r.Backup.BinLogPos)
+
+	cluster.planPitrBinlogs(r)
+
+	tools := []string{cluster.GetMysqlBinlogPath(), cluster.GetMysqlclientPath()}
+	if r.Backup.Type == config.ConstBackupLogicalTypeMydumper {
+		tools = append(tools, cluster.GetMyLoaderPath())
+	}
+	for _, tool := range tools {
+		if _, err := os.Stat(tool); err != nil {
+			r.addCheck("tools", ConstPitrCheckError, "%s", err)
+			return
+		}
+	}
+	r.addCheck("tools", ConstPitrCheckOk, "%s", strings.Join(tools, ", "))
+}
+
+func (cluster *Cluster) parsePitrTarget(r *PitrReport, server *ServerMonitor) error {
+	switch r.TargetType {
+	case ConstPitrTargetTime:
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", r.Target, time.Local)
+		if err != nil {
+			t, err = time.Parse(time.RFC3339, r.Target)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid time %s, expect YYYY-MM-DD HH:MM:SS", r.Target)
+		}
+		if t.After(time.Now()) {
+			return fmt.Errorf("Time %s is in the future", r.Target)
+		}
+		r.targetTime = t.Local()
+	case ConstPitrTargetPosition:
+		i := strings.LastIndex(r.Target, ":")
+		if i < 0 || !pitrBinlogRegexp.MatchString(r.Target[:i]) {
+			return fmt.Errorf("Invalid position %s, expect binlog-file:position", r.Target)
+		}
+		pos, err := strconv.ParseUint(r.Target[i+1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid position %s, expect binlog-file:position", r.Target)
+		}
+		r.targetFile, r.targetPos = r.Target[:i], pos
+	case ConstPitrTargetGtid:
+		if !server.IsMariaDB() {
+			return errors.New("GTID target is only supported with MariaDB, use a time or a binlog position")
+		}
+		if !pitrGtidRegexp.MatchString(r.Target) {
+			return fmt.Errorf("Invalid GTID %s, expect domain-server-sequence", r.Target)
+		}
+	default:
+		return fmt.Errorf("Unknown target %s, expect time, position or gtid", r.TargetType)
+	}
+	return nil
+}
+
+// listBackups list the logical backups of every server and the physical
+// backup of the backup server, the one a reseed job receives
+func (cluster *Cluster) listBackups() []*PitrBackup {
+	var backups []*PitrBackup
+	for _, server := range cluster.Servers {
+		dir := server.GetMyBackupDirectory()
+		if fi, err := os.Stat(dir + "mysqldump.sql.gz"); err == nil {
+			backups = append(backups, &PitrBackup{Type: config.ConstBackupLogicalTypeMysqldump, Path: dir + "mysqldump.sql.gz", Source: server.URL, Time: fi.ModTime()})
+		}
+		if fi, err := os.Stat(dir + "metadata"); err == nil {
+			backups = append(backups, &PitrBackup{Type: config.ConstBackupLogicalTypeMydumper, Path: dir, Source: server.URL, Time: fi.ModTime()})
+		}
+	}
+	if bcksrv := cluster.GetBackupServer(); bcksrv != nil {
+		for _, ext := range []string{".xbtream", ".xbtream.gz"} {
+			path := bcksrv.GetMyBackupDirectory() + cluster.Conf.BackupPhysicalType + ext
+			if fi, err := os.Stat(path); err == nil {
+				backups = append(backups, &PitrBackup{Type: cluster.Conf.BackupPhysicalType, Path: path, Source: bcksrv.URL, Time: fi.ModTime()})
+			}
+		}
+	}
+	return backups
+}
+
+// getPitrBackups read the binlog coordinates of the backups, backups without
+// coordinates can not be used and are reported. The older backups of the
+// catalog come with the coordinates recorded when they completed.
+func (cluster *Cluster) getPitrBackups() ([]*PitrBackup, []string) {
+	var backups []*PitrBackup
+	var skipped []string
+	for _, b := range cluster.listBackups() {
+		if err := cluster.readBackupCoordinates(b); err != nil {
+			skipped = append(skipped, fmt.Sprintf("Skip %s: %s", b.Path, err))
+		} else {
+			backups = append(backups, b)
+		}
+	}
+	backups = append(backups, cluster.getPitrCatalogBackups()...)
+	return backups, skipped
+}
+
+// readBackupCoordinates read the binlog coordinates of a backup with the
+// reader of its tool
+func (cluster *Cluster) readBackupCoordinates(b *PitrBackup) error {
+	switch b.Type {
+	case config.ConstBackupLogicalTypeMysqldump:
+		return cluster.readPitrDumpCoordinates(b)
+	case config.ConstBackupLogicalTypeMydumper:
+		return cluster.readPitrMydumperCoordinates(b)
+	default:
+		return cluster.readPitrStreamCoordinates(b)
+	}
+}
+
+// readPitrMydumperCoordinates read the binlog coordinates and the start time
+// of the dump in the mydumper metadata file
+func (cluster *Cluster) readPitrMydumperCoordinates(b *PitrBackup) error {
+	server := cluster.GetServerFromURL(b.Source)
+	if server == nil {
+		return fmt.Errorf("unknown server %s", b.Source)
+	}
+	meta, err := server.JobMyLoaderParseMeta(strings.TrimSuffix(b.Path, "/"))
+	if err != nil {
+		return err
+	}
+	if meta.BinLogFileName == "" {
+		return errors.New("no binlog coordinates in metadata")
+	}
+	b.Time = meta.StartTimestamp
+	b.BinLogFile = meta.BinLogFileName
+	b.BinLogPos = meta.BinLogFilePos
+	b.Gtid = meta.BinLogUuid
+	return nil
+}
+
+// readPitrDumpCoordinates read the binlog coordinates written by
+// --master-data or --dump-slave in the header of a mysqldump
+func (cluster *Cluster) readPitrDumpCoordinates(b *PitrBackup) error {
+	f, err := cluster.OpenBackupFile(b.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	s := bufio.NewScanner(gz)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		if m := pitrChangeMasterRegexp.FindStringSubmatch(line); m != nil {
+			b.BinLogFile = m[1]
+			b.BinLogPos, _ = strconv.ParseUint(m[2], 10, 64)
+		}
+		if m := pitrGtidSlavePosRegexp.FindStringSubmatch(line); m != nil {
+			b.Gtid = m[1]
+		}
+		if m := pitrGtidPurgedRegexp.FindStringSubmatch(line); m != nil {
+			b.Gtid = m[1]
+		}
+		if strings.HasPrefix(line, "CREATE TABLE") || strings.HasPrefix(line, "INSERT INTO") {
+			break
+		}
+	}
+	if b.BinLogFile == "" {
+		return errors.New("no binlog coordinates in the dump header")
+	}
+	return nil
+}
+
+// readPitrStreamCoordinates read the binlog coordinates and the end time of
+// the backup out of the stream
+func (cluster *Cluster) readPitrStreamCoordinates(b *PitrBackup) error {
+	f, err := cluster.OpenBackupFile(b.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(b.Path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	files, err := xbstream.ReadFiles(bufio.NewReader(r), "xtrabackup_binlog_info", "xtrabackup_slave_info", "xtrabackup_info")
+	if err != nil {
+		return err
+	}
+	source := cluster.GetServerFromURL(b.Source)
+	return setPitrStreamCoordinates(b, files, source != nil && source.IsSlave)
+}
+
+// setPitrStreamCoordinates set the coordinates of a physical backup from the
+// files of the stream. xtrabackup_binlog_info holds the coordinates of the
+// binlogs of the source, the archived binlogs are those of the master so a
+// backup of a replica use the master coordinates written by --slave-info in
+// xtrabackup_slave_info. The backup is refused when the coordinates of the
+// master can not be found.
+func setPitrStreamCoordinates(b *PitrBackup, files map[string][]byte, replica bool) error {
+	if slaveInfo := strings.TrimSpace(string(files["xtrabackup_slave_info"])); slaveInfo != "" {
+		m := pitrChangeMasterRegexp.FindStringSubmatch(slaveInfo)
+		if m == nil {
+			return errors.New("no master binlog coordinates in xtrabackup_slave_info, the backup of a replica can not be tied to the archived binlogs")
+		}
+		b.Replica = true
+		b.BinLogFile = m[1]
+		b.BinLogPos, _ = strconv.ParseUint(m[2], 10, 64)
+		if g := pitrGtidSlavePosRegexp.FindStringSubmatch(slaveInfo); g != nil {
+			b.Gtid = g[1]
+		}
+	} else if replica {
+		return errors.New("no xtrabackup_slave_info in the backup of a replica, the binlog coordinates are not those of the archived binlogs")
+	} else {
+		fields := strings.Fields(string(files["xtrabackup_binlog_info"]))
+		if len(fields) < 2 {
+			return errors.New("no binlog coordinates in xtrabackup_binlog_info")
+		}
+		b.BinLogFile = fields[0]
+		b.BinLogPos, _ = strconv.ParseUint(fields[1], 10, 64)
+		if len(fields) > 2 {
+			b.Gtid = strings.Join(fields[2:], "")
+		}
+	}
+	for _, line := range strings.Split(string(files["xtrabackup_info"]), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "end_time" {
+			if t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(kv[1]), time.Local); err == nil {
+				b.Time = t
+			}
+		}
+	}
+	return nil
+}
+
+// comparePitrCoordinates compare binlog coordinates of the same server
+func comparePitrCoordinates(file1 string, pos1 uint64, file2 string, pos2 uint64) int {
+	m1, m2 := pitrBinlogRegexp.FindStringSubmatch(file1), pitrBinlogRegexp.FindStringSubmatch(file2)
+	if m1 != nil && m2 != nil && m1[2] != m2[2] {
+		i1, _ := strconv.Atoi(m1[2])
+		i2, _ := strconv.Atoi(m2[2])
+		if i1 < i2 {
+			return -1
+		}
+		return 1
+	}
+	if pos1 < pos2 {
+		return -1
+	}
+	if pos1 > pos2 {
+		return 1
+	}
+	return 0
+}
+
+// getPitrGtidSeq return the sequence of the domain in a MariaDB GTID list
+func getPitrGtidSeq(list string, domain string) (uint64, bool) {
+	for _, g := range strings.Split(list, ",") {
+		m := pitrGtidRegexp.FindStringSubmatch(strings.TrimSpace(g))
+		if m != nil && m[1] == domain {
+			seq, _ := strconv.ParseUint(m[3], 10, 64)
+			return seq, true
+		}
+	}
+	return 0, false
+}
+
+func (cluster *Cluster) getPitrNearestBackup(r *PitrReport, backups []*PitrBackup) *PitrBackup {
+	var nearest *PitrBackup
+	for _, b := range backups {
+		switch r.TargetType {
+		case ConstPitrTargetTime:
+			if b.Time.After(r.targetTime) {
+				continue
+			}
+		case ConstPitrTargetPosition:
+			if comparePitrCoordinates(b.BinLogFile, b.BinLogPos, r.targetFile, r.targetPos) > 0 {
+				continue
+			}
+		case ConstPitrTargetGtid:
+			m := pitrGtidRegexp.FindStringSubmatch(r.Target)
+			seq, ok := getPitrGtidSeq(b.Gtid, m[1])
+			target, _ := strconv.ParseUint(m[3], 10, 64)
+			if !ok || seq > target {
+				continue
+			}
+		}
+		if nearest == nil || b.Time.After(nearest.Time) {
+			nearest = b
+		}
+	}
+	return nearest
+}
+
+// planPitrBinlogs find the archive holding the binlog of the backup and the
+// chain of binlogs to replay from it
+func (cluster *Cluster) planPitrBinlogs(r *PitrReport) {
+	m := pitrBinlogRegexp.FindStringSubmatch(r.Backup.BinLogFile)
+	if m == nil {
+		r.addCheck("binlogs", ConstPitrCheckError, "Invalid binlog file name %s", r.Backup.BinLogFile)
+		return
+	}
+	prefix := m[1]
+	// binlogs are archived by the master of the time, look first next to
+	// the backup then in the current master archive. The archive of a
+	// replica source hold its own binlogs, not those of the coordinates.
+	dirs := []string{}
+	if source := cluster.GetServerFromURL(r.Backup.Source); source != nil && !r.Backup.Replica {
+		dirs = append(dirs, source.GetMyBackupDirectory())
+	}
+	if master := cluster.GetMaster(); master != nil {
+		dirs = append(dirs, master.GetMyBackupDirectory())
+	}
+	for _, server := range cluster.Servers {
+		if r.Backup.Replica && server.URL == r.Backup.Source {
+			continue
+		}
+		dirs = append(dirs, server.GetMyBackupDirectory())
+	}
+	var found []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir + r.Backup.BinLogFile); err == nil && !misc.Contains(found, dir) {
+			found = append(found, dir)
+		}
+	}
+	if len(found) == 0 {
+		r.addCheck("binlogs", ConstPitrCheckError, "Binlog %s of the backup is not archived, enable backup-binlogs", r.Backup.BinLogFile)
+		return
+	}
+	r.BinlogDir = found[0]
+	if len(found) > 1 {
+		r.addCheck("binlogs", ConstPitrCheckWarning, "Binlog %s is archived in %s, using %s", r.Backup.BinLogFile, strings.Join(found, ", "), r.BinlogDir)
+	}
+
+	index, _ := strconv.Atoi(m[2])
+	digits := len(m[2])
+	var last os.FileInfo
+	for {
+		name := fmt.Sprintf("%s.%0*d", prefix, digits, index)
+		fi, err := os.Stat(r.BinlogDir + name)
+		if err != nil {
+			break
+		}
+		r.Binlogs = append(r.Binlogs, name)
+		last = fi
+		if r.TargetType == ConstPitrTargetPosition && name == r.targetFile {
+			break
+		}
+		index++
+	}
+	if r.TargetType == ConstPitrTargetPosition && !misc.Contains(r.Binlogs, r.targetFile) {
+		r.addCheck("binlogs", ConstPitrCheckError, "Binlog %s of the target is not in the archive chain from %s", r.targetFile, r.Backup.BinLogFile)
+		return
+	}
+	if r.TargetType == ConstPitrTargetTime && last.ModTime().Before(r.targetTime) {
+		r.addCheck("binlogs", ConstPitrCheckWarning, "Last archived binlog %s ends at %s before the target, recovery stops there", last.Name(), last.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	r.addCheck("binlogs", ConstPitrCheckOk, "Replay %d binlogs from %s", len(r.Binlogs), r.BinlogDir)
+}
+
+func (cluster *Cluster) runPitr(r *PitrReport, server *ServerMonitor) {
+	err := cluster.recoverPitr(r, server)
+	r.End = time.Now()
+	if err != nil {
+		r.State = ConstPitrFailed
+		r.Error = err.Error()
+		cluster.LogPrintf(LvlErr, "Point-in-time recovery of %s failed: %s", server.URL, err)
+		cluster.SetState("ERR00095", state.State{ErrType: LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00095"], server.URL, err), ErrFrom: "BACKUP", ServerUrl: server.URL})
+	} else {
+		r.State = ConstPitrDone
+		cluster.LogPrintf(LvlInfo, "Point-in-time recovery of %s to %s %s done", server.URL, r.TargetType, r.Target)
+	}
+	cluster.savePitrReport(r)
+	cluster.Lock()
+	cluster.pitrReport = nil
+	cluster.Unlock()
+}
+
+func (cluster *Cluster) recoverPitr(r *PitrReport, server *ServerMonitor) error {
+	if r.Provision {
+		cluster.LogPrintf(LvlInfo, "Point-in-time recovery provisioning %s", server.URL)
+		if err := cluster.InitDatabaseService(server); err != nil {
+			return fmt.Errorf("provisioning: %s", err)
+		}
+		if err := cluster.waitUntil(cluster.Conf.BackupPitrTimeout, func() bool { return !server.IsDown() }); err != nil {
+			return fmt.Errorf("waiting server after provisioning: %s", err)
+		}
+	}
+	if !server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	logs, err := server.StopSlave()
+	cluster.LogSQL(logs, err, server.URL, "PointInTimeRecovery", LvlErr, "Failed stop slave on server: %s %s", server.URL, err)
+
+	cluster.LogPrintf(LvlInfo, "Point-in-time recovery restoring %s backup %s on %s", r.Backup.Type, r.Backup.Path, server.URL)
+	switch r.Backup.Type {
+	case config.ConstBackupLogicalTypeMysqldump:
+		err = cluster.restoreMysqldump(r.Backup.Path, server)
+	case config.ConstBackupLogicalTypeMydumper:
+		err = cluster.restoreMydumper(r.Backup.Path, server)
+	default:
+		err = cluster.restorePitrPhysical(server)
+	}
+	if err != nil {
+		r.addCheck("restore", ConstPitrCheckError, "%s", err)
+		return err
+	}
+	r.addCheck("restore", ConstPitrCheckOk, "%s backup restored", r.Backup.Type)
+
+	err = cluster.replayPitrBinlogs(r, server)
+	if err != nil {
+		r.addCheck("replay", ConstPitrCheckError, "%s", err)
+		return err
+	}
+	r.addCheck("replay", ConstPitrCheckOk, "%d binlogs replayed", len(r.Binlogs))
+	return cluster.checkPitr(r, server)
+}
+
+// waitUntil poll ready every second for timeout seconds
+func (cluster *Cluster) waitUntil(timeout int64, ready func() bool) error {
+	for i := int64(0); i < timeout; i++ {
+		if ready() {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("timeout after %d seconds", timeout)
+}
+
+// runMysqlClient run the mysql client of the server on the input
+func (cluster *Cluster) runMysqlClient(server *ServerMonitor, input io.Reader) error {
+	file, err := cluster.CreateTmpClientConfFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	clientCmd := exec.Command(cluster.GetMysqlclientPath(), `--defaults-file=`+file, `--host=`+misc.Unbracket(server.Host), `--port=`+server.Port, `--user=`+cluster.GetDbUser(), `--batch`)
+	clientCmd.Stdin = input
+	stderrIn, _ := clientCmd.StderrPipe()
+	if err := clientCmd.Start(); err != nil {
+		return err
+	}
+	server.copyLogs(stderrIn)
+	if err := clientCmd.Wait(); err != nil {
+		return fmt.Errorf("mysql client: %s", err)
+	}
+	return nil
+}
+
+// filterDumpReplication drop the replication statements of the dump, the
+// recovered server must not reconnect to the master
+func filterDumpReplication(r io.Reader) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		br := bufio.NewReaderSize(r, 1024*1024)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 && !bytes.HasPrefix(line, []byte("CHANGE MASTER TO")) && !bytes.HasPrefix(line, []byte("START SLAVE")) && !bytes.HasPrefix(line, []byte("STOP SLAVE")) {
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+func (cluster *Cluster) restoreMysqldump(path string, server *ServerMonitor) error {
+	f, err := cluster.OpenBackupFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	dump := filterDumpReplication(gz)
+	defer dump.Close()
+	return cluster.runMysqlClient(server, io.MultiReader(bytes.NewBufferString("RESET MASTER;SET sql_log_bin=0;\n"), dump))
+}
+
+func (cluster *Cluster) restoreMydumper(path string, server *ServerMonitor) error {
+	if err := server.ExecQueryNoBinLog("RESET MASTER"); err != nil {
+		return err
+	}
+	path, cleanup, err := cluster.getClearBackupFiles(path, getBackupCatalogFiles(path))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	threads := strconv.Itoa(cluster.Conf.BackupLogicalLoadThreads)
+	myargs := strings.Split(strings.ReplaceAll(cluster.Conf.BackupMyLoaderOptions, "  ", " "), " ")
+	myargs = append(myargs, "--directory="+path, "--threads="+threads, "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+cluster.GetDbUser(), "--password="+cluster.GetDbPass())
+	cmd := exec.Command(cluster.GetMyLoaderPath(), myargs...)
+	cluster.LogPrintf(LvlInfo, "Command: %s", strings.Replace(cmd.String(), cluster.GetDbPass(), "XXXX", 1))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MyLoader: %s", out)
+		return fmt.Errorf("myloader: %s", err)
+	}
+	return nil
+}
+
+// getPitrPhysicalBackup return the physical backup of the point-in-time
+// recovery running on the server, the reseed job receives it instead of the
+// latest backup when it comes from the catalog
+func (cluster *Cluster) getPitrPhysicalBackup(server *ServerMonitor) string {
+	cluster.Lock()
+	defer cluster.Unlock()
+	r := cluster.pitrReport
+	if r == nil || server == nil || r.Server != server.URL || r.Backup == nil {
+		return ""
+	}
+	if r.Backup.Type == config.ConstBackupLogicalTypeMysqldump || r.Backup.Type == config.ConstBackupLogicalTypeMydumper {
+		return ""
+	}
+	return r.Backup.Path
+}
+
+// restorePitrPhysical run the reseed job of the server, the backup is sent
+// by the monitor when the job waits for it
+func (cluster *Cluster) restorePitrPhysical(server *ServerMonitor) error {
+	jobid, err := server.JobInsertTaks("reseed"+cluster.Conf.BackupPhysicalType, server.SSTPort, cluster.Conf.MonitorAddress)
+	if err != nil {
+		return err
+	}
+	var result string
+	err = cluster.waitUntil(cluster.Conf.BackupPitrTimeout, func() bool {
+		conn, err := server.GetNewDBConn()
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		var end bool
+		err = conn.QueryRowx("SELECT end IS NOT NULL, IFNULL(result, '') FROM replication_manager_schema.jobs WHERE id=?", jobid).Scan(&end, &result)
+		return err == nil && end
+	})
+	if err != nil {
+		return fmt.Errorf("waiting reseed job %d: %s", jobid, err)
+	}
+	cluster.LogPrintf(LvlInfo, "Point-in-time recovery reseed job %d on %s: %s", jobid, server.URL, result)
+	return nil
+}
+
+func (cluster *Cluster) replayPitrBinlogs(r *PitrReport, server *ServerMonitor) error {
+	args := []string{"--start-position=" + strconv.FormatUint(r.Backup.BinLogPos, 10)}
+	switch r.TargetType {
+	case ConstPitrTargetTime:
+		args = append(args, "--stop-datetime="+r.targetTime.Format("2006-01-02 15:04:05"))
+	case ConstPitrTargetPosition:
+		args = append(args, "--stop-position="+strconv.FormatUint(r.targetPos, 10))
+	case ConstPitrTargetGtid:
+		args = append(args, "--stop-position="+r.Target)
+	}
+	dir, cleanup, err := cluster.getClearBackupFiles(r.BinlogDir, r.Binlogs)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	for _, binlog := range r.Binlogs {
+		args = append(args, dir+binlog)
+	}
+	cmd := exec.Command(cluster.GetMysqlBinlogPath(), args...)
+	cluster.LogPrintf(LvlInfo, "Command: %s", cmd.String())
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderrIn, _ := cmd.StderrPipe()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go server.copyLogs(stderrIn)
+	err = cluster.runMysqlClient(server, out)
+	if werr := cmd.Wait(); werr != nil {
+		return fmt.Errorf("mysqlbinlog: %s", werr)
+	}
+	return err
+}
+
+// checkPitr report the position reached by the replay and that the server
+// does not replicate
+func (cluster *Cluster) checkPitr(r *PitrReport, server *ServerMonitor) error {
+	conn, err := server.GetNewDBConn()
+	if err != nil {
+		r.addCheck("server", ConstPitrCheckError, "%s", err)
+		return err
+	}
+	defer conn.Close()
+	r.addCheck("server", ConstPitrCheckOk, "Server %s is reachable", server.URL)
+
+	var pos string
+	if server.IsMariaDB() {
+		err = conn.QueryRowx("SELECT @@gtid_binlog_pos").Scan(&pos)
+	} else {
+		err = conn.QueryRowx("SELECT @@gtid_executed").Scan(&pos)
+	}
+	if err != nil {
+		r.addCheck("position", ConstPitrCheckWarning, "%s", err)
+	} else if r.TargetType == ConstPitrTargetGtid {
+		if !strings.Contains(","+strings.ReplaceAll(pos, " ", "")+",", ","+r.Target+",") {
+			r.addCheck("position", ConstPitrCheckError, "Replay reached %s not the target", pos)
+			return fmt.Errorf("replay reached %s not %s", pos, r.Target)
+		}
+		r.addCheck("position", ConstPitrCheckOk, "Replay reached %s", pos)
+	} else {
+		r.addCheck("position", ConstPitrCheckOk, "Replay reached %s", pos)
+	}
+
+	server.Refresh()
+	if server.IsSlave && (server.IsIOThreadRunning() || server.IsSQLThreadRunning()) {
+		r.addCheck("replication", ConstPitrCheckError, "Replication is running on %s", server.URL)
+		return errors.New("replication is running")
+	}
+	r.addCheck("replication", ConstPitrCheckOk, "Replication is stopped, %s stays in maintenance", server.URL)
+	return nil
+}
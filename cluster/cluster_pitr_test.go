@@ -0,0 +1,290 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func TestPitrTarget(t *testing.T) {
+	server := &ServerMonitor{URL: "db2:3306"}
+	tests := []struct {
+		targetType, target string
+		valid              bool
+	}{
+		{ConstPitrTargetTime, "2021-03-04 05:06:07", true},
+		{ConstPitrTargetTime, "2021-03-04T05:06:07Z", true},
+		{ConstPitrTargetTime, time.Now().Add(time.Hour).Format("2006-01-02 15:04:05"), false},
+		{ConstPitrTargetTime, "yesterday", false},
+		{ConstPitrTargetPosition, "mysql-bin.000002:120", true},
+		{ConstPitrTargetPosition, "mysql-bin:120", false},
+		{ConstPitrTargetPosition, "mysql-bin.000002", false},
+		{ConstPitrTargetGtid, "0-1-42", true},
+		{ConstPitrTargetGtid, "0-1", false},
+		{"snapshot", "1", false},
+	}
+	for _, tt := range tests {
+		r := &PitrReport{TargetType: tt.targetType, Target: tt.target}
+		if err := new(Cluster).parsePitrTarget(r, server); (err == nil) != tt.valid {
+			t.Errorf("%s %s: expected valid %t, got %v", tt.targetType, tt.target, tt.valid, err)
+		}
+	}
+}
+
+func TestPitrCoordinates(t *testing.T) {
+	tests := []struct {
+		file1 string
+		pos1  uint64
+		file2 string
+		pos2  uint64
+		cmp   int
+	}{
+		{"mysql-bin.000001", 4, "mysql-bin.000001", 4, 0},
+		{"mysql-bin.000001", 400, "mysql-bin.000002", 4, -1},
+		{"mysql-bin.000002", 4, "mysql-bin.000001", 400, 1},
+		{"mysql-bin.000009", 4, "mysql-bin.000010", 4, -1},
+		{"mysql-bin.999999", 4, "mysql-bin.1000000", 4, -1},
+		{"mysql-bin.000003", 500, "mysql-bin.000003", 120, 1},
+	}
+	for _, tt := range tests {
+		if cmp := comparePitrCoordinates(tt.file1, tt.pos1, tt.file2, tt.pos2); cmp != tt.cmp {
+			t.Errorf("%s:%d %s:%d: expected %d, got %d", tt.file1, tt.pos1, tt.file2, tt.pos2, tt.cmp, cmp)
+		}
+	}
+}
+
+func TestPitrNearestBackup(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	first := &PitrBackup{Path: "first", Time: now.Add(-3 * time.Hour), BinLogFile: "mysql-bin.000001", BinLogPos: 4, Gtid: "0-1-10"}
+	second := &PitrBackup{Path: "second", Time: now.Add(-2 * time.Hour), BinLogFile: "mysql-bin.000002", BinLogPos: 500, Gtid: "0-1-20,1-1-5"}
+	third := &PitrBackup{Path: "third", Time: now.Add(-time.Hour), BinLogFile: "mysql-bin.000010", BinLogPos: 4, Gtid: "0-1-30"}
+	backups := []*PitrBackup{third, first, second}
+	tests := []struct {
+		targetType, target string
+		backup             *PitrBackup
+	}{
+		{ConstPitrTargetTime, now.Add(-90 * time.Minute).Format("2006-01-02 15:04:05"), second},
+		{ConstPitrTargetTime, now.Add(-2 * time.Hour).Format("2006-01-02 15:04:05"), second},
+		{ConstPitrTargetTime, now.Format("2006-01-02 15:04:05"), third},
+		{ConstPitrTargetTime, now.Add(-4 * time.Hour).Format("2006-01-02 15:04:05"), nil},
+		{ConstPitrTargetPosition, "mysql-bin.000002:600", second},
+		{ConstPitrTargetPosition, "mysql-bin.000002:400", first},
+		{ConstPitrTargetPosition, "mysql-bin.000009:4", second},
+		{ConstPitrTargetPosition, "mysql-bin.000010:4", third},
+		{ConstPitrTargetGtid, "0-1-25", second},
+		{ConstPitrTargetGtid, "1-1-9", second},
+		{ConstPitrTargetGtid, "0-1-5", nil},
+		{ConstPitrTargetGtid, "2-1-5", nil},
+	}
+	cluster := &Cluster{}
+	for _, tt := range tests {
+		r := &PitrReport{TargetType: tt.targetType, Target: tt.target}
+		if err := cluster.parsePitrTarget(r, &ServerMonitor{}); err != nil {
+			t.Fatal(err)
+		}
+		if backup := cluster.getPitrNearestBackup(r, backups); backup != tt.backup {
+			t.Errorf("%s %s: expected backup %v, got %v", tt.targetType, tt.target, tt.backup, backup)
+		}
+	}
+}
+
+// TestPitrCatalogBackups recover to a time between two backups moved to the
+// catalog, the older one is restored from the catalog with the coordinates
+// recorded when it completed
+func TestPitrCatalogBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pitr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{Name: "c", WorkingDir: dir, StateMachine: new(state.StateMachine)}
+	cluster.Conf.WorkingDir = dir
+	catalog := cluster.getBackupCatalogDir()
+	now := time.Now().Truncate(time.Second)
+	first := &BackupCatalogEntry{Id: "first", Tool: "mysqldump", Source: "db1:3306", Storage: ConstBackupStorageLocal, Location: catalog + "/first", Files: []string{"mysqldump.sql.gz"}, BinLogFile: "mysql-bin.000001", BinLogPos: 4, BinLogTime: now.Add(-3 * time.Hour), End: now.Add(-3 * time.Hour), State: ConstBackupCatalogDone}
+	// saved before the time of the coordinates was recorded
+	second := &BackupCatalogEntry{Id: "second", Tool: "mariabackup", Source: "db2:3306", Storage: ConstBackupStorageLocal, Location: catalog + "/second", Files: []string{"mariabackup.xbtream"}, BinLogFile: "mysql-bin.000002", BinLogPos: 500, Replica: true, End: now.Add(-2 * time.Hour), State: ConstBackupCatalogDone}
+	latest := &BackupCatalogEntry{Id: "latest", Tool: "mysqldump", Source: "db1:3306", Storage: ConstBackupStorageLocal, Location: dir + "/backups/c/db1_3306", Files: []string{"mysqldump.sql.gz"}, BinLogFile: "mysql-bin.000003", BinLogPos: 4, BinLogTime: now.Add(-time.Hour), State: ConstBackupCatalogDone}
+	failed := &BackupCatalogEntry{Id: "failed", Tool: "mysqldump", Source: "db1:3306", Storage: ConstBackupStorageLocal, Location: catalog + "/failed", Files: []string{"mysqldump.sql.gz"}, BinLogFile: "mysql-bin.000002", BinLogPos: 4, BinLogTime: now.Add(-150 * time.Minute), State: ConstBackupCatalogFailed}
+	cluster.saveBackupCatalog([]*BackupCatalogEntry{first, second, latest, failed})
+
+	backups, _ := cluster.getPitrBackups()
+	if len(backups) != 2 {
+		t.Fatalf("Expected the 2 completed backups of the catalog directory, got %d", len(backups))
+	}
+	tests := []struct {
+		target time.Time
+		entry  *BackupCatalogEntry
+	}{
+		{now.Add(-150 * time.Minute), first},
+		{now.Add(-90 * time.Minute), second},
+		{now.Add(-4 * time.Hour), nil},
+	}
+	for _, tt := range tests {
+		r := &PitrReport{TargetType: ConstPitrTargetTime, Target: tt.target.Format("2006-01-02 15:04:05")}
+		if err := cluster.parsePitrTarget(r, &ServerMonitor{}); err != nil {
+			t.Fatal(err)
+		}
+		b := cluster.getPitrNearestBackup(r, backups)
+		if tt.entry == nil {
+			if b != nil {
+				t.Errorf("%s: expected no backup, got %s", r.Target, b.Path)
+			}
+			continue
+		}
+		if b == nil || b.Path != tt.entry.getPath() || b.Type != tt.entry.Tool || b.BinLogFile != tt.entry.BinLogFile || b.BinLogPos != tt.entry.BinLogPos || b.Replica != tt.entry.Replica {
+			t.Errorf("%s: expected backup %s, got %+v", r.Target, tt.entry.Id, b)
+		}
+	}
+}
+
+func TestPitrDumpCoordinates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pitr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		header string
+		file   string
+		pos    uint64
+		gtid   string
+	}{
+		{"-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=1234;\n-- SET GLOBAL gtid_slave_pos='0-1-42';\n", "mysql-bin.000003", 1234, "0-1-42"},
+		{"CHANGE MASTER TO MASTER_LOG_FILE='bin.000007', MASTER_LOG_POS=4;\nSET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ 'uuid:1-5';\n", "bin.000007", 4, "uuid:1-5"},
+		{"-- no coordinates\n", "", 0, ""},
+	}
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		// coordinates after the first table are data, not the dump header
+		gz.Write([]byte(tt.header + "CREATE TABLE t (a int);\n-- CHANGE MASTER TO MASTER_LOG_FILE='late.000001', MASTER_LOG_POS=1;\n"))
+		gz.Close()
+		b := &PitrBackup{Path: dir + "/mysqldump.sql.gz"}
+		if err := ioutil.WriteFile(b.Path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := new(Cluster).readPitrDumpCoordinates(b)
+		if tt.file == "" {
+			if err == nil {
+				t.Errorf("%d: expected a dump without coordinates refused, got %s", i, b.BinLogFile)
+			}
+			continue
+		}
+		if err != nil || b.BinLogFile != tt.file || b.BinLogPos != tt.pos || b.Gtid != tt.gtid {
+			t.Errorf("%d: expected %s:%d %s, got %s:%d %s %v", i, tt.file, tt.pos, tt.gtid, b.BinLogFile, b.BinLogPos, b.Gtid, err)
+		}
+	}
+}
+
+func TestPitrStreamCoordinates(t *testing.T) {
+	binlogInfo := "db2-bin.000042\t777\t0-2-900\n"
+	tests := []struct {
+		name      string
+		slaveInfo string
+		replica   bool
+		file      string
+		pos       uint64
+		gtid      string
+	}{
+		{"master", "", false, "db2-bin.000042", 777, "0-2-900"},
+		{"replica", "SET GLOBAL gtid_slave_pos = '0-1-100';\nCHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=1234;\n", true, "mysql-bin.000003", 1234, "0-1-100"},
+		{"replica now master", "CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=1234\n", false, "mysql-bin.000003", 1234, ""},
+		{"replica without slave info", "", true, "", 0, ""},
+		{"replica with gtid only", "SET GLOBAL gtid_slave_pos = '0-1-100';\nCHANGE MASTER TO master_use_gtid = slave_pos;\n", true, "", 0, ""},
+	}
+	for _, tt := range tests {
+		files := map[string][]byte{"xtrabackup_binlog_info": []byte(binlogInfo), "xtrabackup_slave_info": []byte(tt.slaveInfo), "xtrabackup_info": []byte("end_time = 2021-03-04 05:06:07\n")}
+		b := &PitrBackup{}
+		err := setPitrStreamCoordinates(b, files, tt.replica)
+		if tt.file == "" {
+			if err == nil {
+				t.Errorf("%s: expected the backup refused, got %s:%d", tt.name, b.BinLogFile, b.BinLogPos)
+			}
+			continue
+		}
+		if err != nil || b.BinLogFile != tt.file || b.BinLogPos != tt.pos || b.Gtid != tt.gtid || b.Replica != (tt.slaveInfo != "") {
+			t.Errorf("%s: expected %s:%d %s, got %s:%d %s %v", tt.name, tt.file, tt.pos, tt.gtid, b.BinLogFile, b.BinLogPos, b.Gtid, err)
+		}
+		if b.Time.Format("2006-01-02 15:04:05") != "2021-03-04 05:06:07" {
+			t.Errorf("%s: expected the end time of the backup, got %s", tt.name, b.Time)
+		}
+	}
+}
+
+func TestPitrBinlogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pitr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{Name: "c"}
+	cluster.Conf.WorkingDir = dir
+	db1 := &ServerMonitor{Host: "db1", Port: "3306", URL: "db1:3306", ClusterGroup: cluster}
+	cluster.Servers = serverList{db1}
+	archive := db1.GetMyBackupDirectory()
+	for _, name := range []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"} {
+		if err := ioutil.WriteFile(archive+name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name       string
+		backupFile string
+		targetType string
+		target     string
+		binlogs    string
+		status     string
+	}{
+		{"to a position", "mysql-bin.000001", ConstPitrTargetPosition, "mysql-bin.000002:120", "mysql-bin.000001,mysql-bin.000002", ConstPitrCheckOk},
+		{"from a later backup", "mysql-bin.000002", ConstPitrTargetPosition, "mysql-bin.000003:4", "mysql-bin.000002,mysql-bin.000003", ConstPitrCheckOk},
+		{"to a time", "mysql-bin.000001", ConstPitrTargetTime, "2021-03-04 05:06:07", "mysql-bin.000001,mysql-bin.000002,mysql-bin.000003", ConstPitrCheckOk},
+		{"position not archived", "mysql-bin.000001", ConstPitrTargetPosition, "mysql-bin.000005:4", "", ConstPitrCheckError},
+		{"backup binlog not archived", "mysql-bin.000009", ConstPitrTargetPosition, "mysql-bin.000009:4", "", ConstPitrCheckError},
+		{"invalid binlog", "mysql-bin", ConstPitrTargetPosition, "mysql-bin.000002:120", "", ConstPitrCheckError},
+	}
+	for _, tt := range tests {
+		r := &PitrReport{TargetType: tt.targetType, Target: tt.target, Backup: &PitrBackup{Source: db1.URL, BinLogFile: tt.backupFile}}
+		if err := cluster.parsePitrTarget(r, db1); err != nil {
+			t.Fatal(err)
+		}
+		cluster.planPitrBinlogs(r)
+		check := r.Checks[len(r.Checks)-1]
+		if check.Status != tt.status || strings.Join(r.Binlogs, ",") != tt.binlogs && tt.status == ConstPitrCheckOk {
+			t.Errorf("%s: expected %s %s, got %s %v: %s", tt.name, tt.status, tt.binlogs, check.Status, r.Binlogs, check.Message)
+		}
+		if tt.status == ConstPitrCheckOk && r.BinlogDir != archive {
+			t.Errorf("%s: expected the binlogs of %s, got %s", tt.name, archive, r.BinlogDir)
+		}
+	}
+
+	// a replica archive hold binlogs of the same name that are its own
+	db2 := &ServerMonitor{Host: "db2", Port: "3306", URL: "db2:3306", ClusterGroup: cluster}
+	cluster.Servers = serverList{db2, db1}
+	if err := ioutil.WriteFile(db2.GetMyBackupDirectory()+"mysql-bin.000001", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &PitrReport{TargetType: ConstPitrTargetPosition, Target: "mysql-bin.000002:120", Backup: &PitrBackup{Source: db2.URL, BinLogFile: "mysql-bin.000001", Replica: true}}
+	if err := cluster.parsePitrTarget(r, db2); err != nil {
+		t.Fatal(err)
+	}
+	cluster.planPitrBinlogs(r)
+	if r.BinlogDir != archive || r.HasError() {
+		t.Errorf("Expected the master binlogs of a replica backup, got %s %+v", r.BinlogDir, r.Checks)
+	}
+}
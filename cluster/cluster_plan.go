@@ -0,0 +1,248 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+// FailoverPlanCheck is one condition of a plan, a failed blocking check would
+// cancel the real run
+type FailoverPlanCheck struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Blocking bool   `json:"blocking"`
+	Message  string `json:"message,omitempty"`
+}
+
+type FailoverPlanProxy struct {
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Action string `json:"action"`
+}
+
+// FailoverPlan describe what a switchover or a failover would do now, it is
+// computed from the monitored state without changing anything
+type FailoverPlan struct {
+	Type      string              `json:"type"`
+	Cluster   string              `json:"cluster"`
+	Timestamp time.Time           `json:"timestamp"`
+	Master    string              `json:"master"`
+	Candidate string              `json:"candidate"`
+	Feasible  bool                `json:"feasible"`
+	Checks    []FailoverPlanCheck `json:"checks"`
+	Election  []Trackpos          `json:"election"`
+	Actions   []string            `json:"actions"`
+	Proxies   []FailoverPlanProxy `json:"proxies"`
+}
+
+func (plan *FailoverPlan) addCheck(name string, passed bool, blocking bool, format string, args ...interface{}) {
+	plan.Checks = append(plan.Checks, FailoverPlanCheck{Name: name, Passed: passed, Blocking: blocking, Message: fmt.Sprintf(format, args...)})
+	if !passed && blocking {
+		plan.Feasible = false
+	}
+}
+
+func (plan *FailoverPlan) addAction(format string, args ...interface{}) {
+	plan.Actions = append(plan.Actions, fmt.Sprintf(format, args...))
+}
+
+func (cluster *Cluster) newFailoverPlan(fail bool) *FailoverPlan {
+	plan := &FailoverPlan{
+		Type:      "switchover",
+		Cluster:   cluster.Name,
+		Timestamp: time.Now(),
+		Feasible:  true,
+		Checks:    []FailoverPlanCheck{},
+		Election:  []Trackpos{},
+		Actions:   []string{},
+		Proxies:   []FailoverPlanProxy{},
+	}
+	if fail {
+		plan.Type = "failover"
+	}
+	if cluster.master != nil {
+		plan.Master = cluster.master.URL
+	}
+	return plan
+}
+
+// GetSwitchoverPlan evaluate the switchover checks and election in dry run,
+// prefMaster replace the preferred master list like the switchover API does
+func (cluster *Cluster) GetSwitchoverPlan(prefMaster string) *FailoverPlan {
+	plan := cluster.newFailoverPlan(false)
+	plan.addCheck("not-in-failover", !cluster.StateMachine.IsInFailover(), true, "No failover or switchover in progress")
+	if cluster.master == nil || cluster.master.IsFailed() {
+		plan.addCheck("master-alive", false, true, "Switchover needs a running master")
+		return plan
+	}
+	plan.addCheck("master-alive", true, true, "Master %s is running", cluster.master.URL)
+	if cluster.master.Conn == nil {
+		plan.addCheck("master-connection", false, true, "No connection to master %s", cluster.master.URL)
+		return plan
+	}
+	plan.addCheck("no-schema-change", !cluster.IsInSchemaChange(), true, "No online schema change in progress")
+	qt, _, err := dbhelper.CheckLongRunningWrites(cluster.master.Conn, cluster.Conf.SwitchWaitWrite)
+	if err != nil {
+		plan.addCheck("long-running-writes", false, true, "Could not check long running writes: %s", err)
+	} else {
+		plan.addCheck("long-running-writes", qt == 0, true, "%d writes running longer than switchover-wait-write-query %ds", qt, cluster.Conf.SwitchWaitWrite)
+	}
+	if cluster.GetTopology() == topoMultiMasterRing || cluster.GetTopology() == topoMultiMasterWsrep || cluster.GetTopology() == topoMultiMasterGrouprep {
+		plan.addCheck("virtual-master", true, false, "Multi master topology, the virtual master is moved")
+		return plan
+	}
+
+	key, election := cluster.rankSwitchoverCandidates(cluster.slaves, false, true)
+	if prefMaster != "" {
+		if !cluster.IsInHostList(prefMaster) {
+			plan.addCheck("prefered-master", false, false, "Prefered master %s not found in database servers", prefMaster)
+		} else {
+			for i, sl := range cluster.slaves {
+				if sl.URL == prefMaster && len(election[i].SkipReasons) == 0 {
+					key = i
+				}
+			}
+			plan.addCheck("prefered-master", key != -1 && cluster.slaves[key].URL == prefMaster, false, "Prefered master %s requested", prefMaster)
+		}
+	}
+	cluster.setPlanElection(plan, key, election)
+	if plan.Candidate != "" {
+		cluster.setPlanActions(plan, false, cluster.slaves[key])
+	}
+	return plan
+}
+
+// GetFailoverPlan evaluate the failover checks and election in dry run as if
+// the master was failing now. The external arbitrator and the false positive
+// probes are only reported, they are asked at failover time.
+func (cluster *Cluster) GetFailoverPlan() *FailoverPlan {
+	plan := cluster.newFailoverPlan(true)
+	plan.addCheck("not-in-failover", !cluster.StateMachine.IsInFailover(), true, "No failover or switchover in progress")
+	plan.addCheck("automatic-failover", cluster.isAutomaticFailover(), false, "Failover mode automatic, interactive mode needs a manual failover")
+	plan.addCheck("master-discovered", cluster.master != nil || cluster.Conf.Interactive || cluster.Conf.FailRestartUnsafe, true, "Master discovered or failover-restart-unsafe")
+	if cluster.master != nil {
+		// a failing master reach the counter, a running one is only reported
+		plan.addCheck("falsepositive-ping-counter", cluster.isMaxMasterFailedCountReached(), false, "Master %s failed %d of %d checks before failover", cluster.master.URL, cluster.master.FailCount, cluster.Conf.MaxFail)
+	}
+	plan.addCheck("failover-limit", cluster.isMaxClusterFailoverCountNotReached(), true, "%d failovers of failover-limit %d", cluster.FailoverCtr, cluster.Conf.FailLimit)
+	rem := (cluster.FailoverTs + cluster.Conf.FailTime) - time.Now().Unix()
+	plan.addCheck("failover-time-limit", cluster.isBetweenFailoverTimeValid(), true, "Next failover available in %d seconds", rem)
+	if cluster.master != nil {
+		clean, msg := cluster.checkMySQLErrantTransaction(true)
+		plan.addCheck("errant-transaction", clean, true, "%s", msg)
+	}
+	same, msg := cluster.checkSameWsrepUUID(true)
+	plan.addCheck("wsrep-uuid", same, true, "%s", msg)
+	if cluster.IsRaftArbitration() {
+		plan.addCheck("raft-leader", cluster.IsRaftLeader(), true, "Monitor is the raft leader")
+		plan.addCheck("raft-quorum", cluster.Consensus != nil && cluster.Consensus.HasQuorum(), true, "Raft leader reach a majority of %s", cluster.Conf.ArbitrationPeerHosts)
+	} else if cluster.Conf.Arbitration {
+		plan.addCheck("arbitrator-alive", !cluster.IsFailedArbitrator, true, "Arbitrator %s", cluster.Conf.ArbitrationSasHosts)
+		plan.addCheck("arbitration-majority", !cluster.IsLostMajority, true, "Monitor has the majority, the arbitrator is asked at failover time")
+	}
+	if cluster.Conf.CheckFalsePositiveHeartbeat || cluster.Conf.CheckFalsePositiveMaxscale || cluster.Conf.CheckFalsePositiveExternal {
+		plan.addCheck("false-positive", true, false, "False positive checks heartbeat:%t maxscale:%t external:%t run at failover time", cluster.Conf.CheckFalsePositiveHeartbeat, cluster.Conf.CheckFalsePositiveMaxscale, cluster.Conf.CheckFalsePositiveExternal)
+	}
+	if cluster.Conf.MultiMasterGrouprep {
+		plan.addCheck("group-replication", true, false, "Group replication elects the new master itself")
+		return plan
+	}
+	if cluster.GetTopology() == topoActivePassive {
+		plan.addCheck("active-passive", true, false, "Active passive topology, the passive server is promoted")
+		return plan
+	}
+
+	key, election := cluster.rankFailoverCandidates(cluster.slaves, false, true)
+	cluster.setPlanElection(plan, key, election)
+	if plan.Candidate != "" {
+		cluster.setPlanActions(plan, true, cluster.slaves[key])
+	}
+	return plan
+}
+
+func (cluster *Cluster) setPlanElection(plan *FailoverPlan, key int, election []Trackpos) {
+	sort.SliceStable(election, func(i, j int) bool {
+		if election[i].Indice == key || election[j].Indice == key {
+			return election[i].Indice == key
+		}
+		return len(election[i].SkipReasons) < len(election[j].SkipReasons)
+	})
+	plan.Election = election
+	if key == -1 {
+		plan.addCheck("candidate-found", false, true, "No candidates found")
+		return
+	}
+	plan.Candidate = cluster.slaves[key].URL
+	plan.addCheck("candidate-found", true, true, "Slave %s would be elected", plan.Candidate)
+}
+
+// setPlanActions list the steps MasterFailover would run, keep it in sync
+func (cluster *Cluster) setPlanActions(plan *FailoverPlan, fail bool, candidate *ServerMonitor) {
+	if !fail {
+		plan.addAction("Cancel if a write query runs for switchover-wait-write-query %ds on master %s", cluster.Conf.SwitchWaitWrite, plan.Master)
+		plan.addAction("Flush tables on master %s, cancel after switchover-wait-trx %ds", plan.Master, cluster.Conf.SwitchWaitTrx)
+	}
+	plan.addAction("Elect %s as new master", candidate.URL)
+	if cluster.Conf.PreScript != "" {
+		plan.addAction("Run failover-pre-script %s", cluster.Conf.PreScript)
+	}
+	if !fail {
+		if cluster.Conf.SwitchDecreaseMaxConn {
+			plan.addAction("Freeze old master %s: set read only, decrease max connections to %d, kill connections after %dms", plan.Master, cluster.Conf.SwitchDecreaseMaxConnValue, cluster.Conf.SwitchWaitKill)
+		} else {
+			plan.addAction("Freeze old master %s: set read only, kill connections after %dms", plan.Master, cluster.Conf.SwitchWaitKill)
+		}
+		plan.addAction("Wait for %s to catch up with old master position", candidate.URL)
+	} else {
+		plan.addAction("Wait for %s to apply its relay log", candidate.URL)
+		if plan.Master != "" {
+			plan.addAction("Save crash info of old master %s", plan.Master)
+		}
+	}
+	if cluster.Conf.MxsBinlogOn || cluster.Conf.MultiTierSlave {
+		plan.addAction("Wait for relay servers to catch up")
+	}
+	plan.addAction("Stop replication and reset slave on %s", candidate.URL)
+	if cluster.Conf.FailoverSemiSyncState {
+		plan.addAction("Enable semi-sync master on %s", candidate.URL)
+	}
+	plan.addAction("Set %s read write", candidate.URL)
+	for _, pr := range cluster.Proxies {
+		action := fmt.Sprintf("Route writes to %s", candidate.URL)
+		plan.Proxies = append(plan.Proxies, FailoverPlanProxy{Type: pr.GetType(), URL: pr.GetURL(), Action: action})
+		plan.addAction("Reconfigure %s proxy %s: %s", pr.GetType(), pr.GetURL(), action)
+	}
+	if cluster.Conf.PostScript != "" {
+		plan.addAction("Run failover-post-script %s", cluster.Conf.PostScript)
+	}
+	if cluster.Conf.FailEventScheduler {
+		plan.addAction("Enable event scheduler on %s", candidate.URL)
+	}
+	if !fail {
+		plan.addAction("Demote old master %s as slave of %s", plan.Master, candidate.URL)
+	}
+	for _, sl := range cluster.slaves {
+		if sl.URL == candidate.URL || sl.URL == plan.Master {
+			continue
+		}
+		plan.addAction("Point slave %s to new master %s", sl.URL, candidate.URL)
+	}
+	if fail && cluster.Conf.Autorejoin && plan.Master != "" {
+		plan.addAction("Rejoin old master %s as slave when it comes back", plan.Master)
+	}
+	if fail && cluster.Conf.FailoverSwitchToPrefered && cluster.Conf.PrefMaster != "" && !candidate.IsPrefered() {
+		plan.addAction("Switchover to prefered master %s", cluster.Conf.PrefMaster)
+	}
+}
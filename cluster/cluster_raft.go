@@ -0,0 +1,78 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// ReplicatedState is the cluster state the raft leader replicate to the
+// standby monitors, so that a new leader keeps the failover limits and history
+type ReplicatedState struct {
+	FailoverCounter int         `json:"failoverCounter"`
+	FailoverTs      int64       `json:"failoverLastTime"`
+	SLA             state.Sla   `json:"sla"`
+	Crashes         crashList   `json:"crashes"`
+	Workflows       []*Workflow `json:"workflows"`
+}
+
+func (cluster *Cluster) IsRaftArbitration() bool {
+	return cluster.Conf.Arbitration && cluster.Conf.ArbitrationRaft
+}
+
+func (cluster *Cluster) IsRaftLeader() bool {
+	return cluster.Consensus != nil && cluster.Consensus.IsLeader()
+}
+
+func (cluster *Cluster) GetReplicatedState() ReplicatedState {
+	return ReplicatedState{
+		FailoverCounter: cluster.FailoverCtr,
+		FailoverTs:      cluster.FailoverTs,
+		SLA:             cluster.StateMachine.GetSla(),
+		Crashes:         cluster.Crashes,
+		Workflows:       cluster.getReplicatedWorkflows(),
+	}
+}
+
+// ProposeReplicatedState publish the cluster state to the raft followers, it
+// does nothing on a follower
+func (cluster *Cluster) ProposeReplicatedState() error {
+	if !cluster.IsRaftLeader() {
+		return nil
+	}
+	value, err := json.Marshal(cluster.GetReplicatedState())
+	if err != nil {
+		return err
+	}
+	return cluster.Consensus.Propose(cluster.Name, value)
+}
+
+// SetReplicatedState apply the state received from the raft leader, the
+// active monitor owns its state and ignore it
+func (cluster *Cluster) SetReplicatedState(value json.RawMessage) error {
+	if cluster.Status == ConstMonitorActif {
+		return nil
+	}
+	var rs ReplicatedState
+	err := json.Unmarshal(value, &rs)
+	if err != nil {
+		return fmt.Errorf("Invalid replicated state: %s", err)
+	}
+	cluster.FailoverCtr = rs.FailoverCounter
+	cluster.FailoverTs = rs.FailoverTs
+	cluster.StateMachine.SetSla(rs.SLA)
+	cluster.Crashes = rs.Crashes
+	cluster.setReplicatedWorkflows(rs.Workflows)
+	cluster.LogPrintf(LvlDbg, "Raft state applied: %d failovers, %d crashes", rs.FailoverCounter, len(rs.Crashes))
+	return cluster.Save()
+}
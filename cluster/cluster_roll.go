@@ -7,149 +7,221 @@
 package cluster
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 )
 
+// RollingReprov reprovision the replicas, switchover and reprovision the
+// old master as a workflow
 func (cluster *Cluster) RollingReprov() error {
-
 	cluster.LogPrintf(LvlInfo, "Rolling reprovisionning")
-	masterID := cluster.GetMaster().Id
-	for _, slave := range cluster.slaves {
-		if !slave.IsDown() {
-			if !slave.IsMaintenance {
-				slave.SwitchMaintenance()
-			}
-			err := cluster.UnprovisionDatabaseService(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
-				return err
-			}
-			err = cluster.WaitDatabaseFailed(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling restart slave does not transit suspect %s %s", slave.URL, err)
-				return err
-			}
-			err = cluster.InitDatabaseService(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
-				return err
-			}
-			err = cluster.StartDatabaseWaitRejoin(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
-				return err
-			}
-
-			slave.WaitSyncToMaster(cluster.master)
-			slave.SwitchMaintenance()
-		}
+	wf, err := cluster.NewWorkflow("rolling-reprov", nil)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
+		return err
 	}
-	cluster.SwitchoverWaitTest()
-	master := cluster.GetServerFromName(masterID)
-	if cluster.master.DSN == master.DSN {
-		cluster.LogPrintf(LvlErr, "Cancel rolling restart master is the same after Switchover")
-		return nil
+	return cluster.RunWorkflow(wf)
+}
+
+// RollingRestart restart the replicas, switchover and restart the old master
+// as a workflow
+func (cluster *Cluster) RollingRestart() error {
+	cluster.LogPrintf(LvlInfo, "Rolling restart")
+	wf, err := cluster.NewWorkflow("rolling-restart", nil)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Cancel rolling restart %s", err)
+		return err
 	}
-	if !master.IsDown() {
-		if !master.IsMaintenance {
-			master.SwitchMaintenance()
-		}
-		err := cluster.UnprovisionDatabaseService(master)
-		if err != nil {
-			cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
-			return err
+	return cluster.RunWorkflow(wf)
+}
+
+func buildRollingRestartWorkflow(cluster *Cluster, wf *Workflow) ([]*WorkflowStep, error) {
+	return cluster.getRollingWorkflowSteps(wf, cluster.rollingRestartServer)
+}
+
+func buildRollingReprovWorkflow(cluster *Cluster, wf *Workflow) ([]*WorkflowStep, error) {
+	return cluster.getRollingWorkflowSteps(wf, cluster.rollingReprovServer)
+}
+
+// getRollingWorkflowSteps chain a step per replica, a switchover, a step for
+// the old master and a switchover back, the servers are saved in the params
+// on the first build. A replica found down is skipped unless the workflow
+// stopped it itself.
+func (cluster *Cluster) getRollingWorkflowSteps(wf *Workflow, roll func(ctx context.Context, wf *Workflow, server *ServerMonitor) error) ([]*WorkflowStep, error) {
+	if wf.Params["master"] == "" {
+		master := cluster.GetMaster()
+		if master == nil {
+			return nil, errors.New("No master for rolling operation")
 		}
-		err = cluster.WaitDatabaseFailed(master)
-		if err != nil {
-			cluster.LogPrintf(LvlErr, "Cancel rolling restart slave does not transit suspect %s %s", master.URL, err)
-			return err
+		var slaves []string
+		for _, slave := range cluster.slaves {
+			slaves = append(slaves, slave.Id)
 		}
-		err = cluster.InitDatabaseService(master)
-		if err != nil {
-			cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
-			return err
+		wf.Params["master"] = master.Id
+		wf.Params["slaves"] = strings.Join(slaves, ",")
+	}
+	masterID := wf.Params["master"]
+	var steps []*WorkflowStep
+	var previous []string
+	serverStep := func(name string, id string) *WorkflowStep {
+		return &WorkflowStep{
+			Name:      name,
+			DependsOn: previous,
+			Run: func(ctx context.Context) error {
+				server := cluster.GetServerFromName(id)
+				if server == nil {
+					return fmt.Errorf("Server %s not found", id)
+				}
+				if server.IsDown() && !isRollingStopped(wf, server) {
+					if id == masterID {
+						return fmt.Errorf("Original master %s is down", server.URL)
+					}
+					cluster.LogPrintf(LvlWarn, "Rolling skip replica %s, server is down", server.URL)
+					return nil
+				}
+				return roll(ctx, wf, server)
+			},
+			Rollback: func() error {
+				server := cluster.GetServerFromName(id)
+				if server == nil {
+					return nil
+				}
+				// bring back a server left stopped by an interrupted step
+				if server.IsDown() && isRollingStopped(wf, server) {
+					return roll(context.Background(), wf, server)
+				}
+				if server.IsMaintenance && !server.IsDown() {
+					server.SwitchMaintenance()
+				}
+				return nil
+			},
 		}
-		err = cluster.WaitDatabaseStart(master)
-		if err != nil {
-			cluster.LogPrintf(LvlErr, "Cancel rolling reprov %s", err)
-			return err
+	}
+	for _, id := range strings.Split(wf.Params["slaves"], ",") {
+		if id == "" {
+			continue
 		}
-		master.WaitSyncToMaster(cluster.master)
-		master.SwitchMaintenance()
-		cluster.SwitchOver()
+		steps = append(steps, serverStep("slave-"+id, id))
+		previous = []string{"slave-" + id}
 	}
-	return nil
+	if len(steps) == 0 {
+		return nil, errors.New("No replica for rolling operation")
+	}
+	steps = append(steps, &WorkflowStep{
+		Name:      "switchover",
+		DependsOn: previous,
+		Run: func(ctx context.Context) error {
+			if cluster.master != nil && cluster.master.Id != masterID {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			cluster.withoutFailSync(cluster.SwitchoverWaitTest)
+			if cluster.master == nil || cluster.master.Id == masterID {
+				return errors.New("Master is the same after switchover")
+			}
+			return nil
+		},
+	})
+	previous = []string{"switchover"}
+	steps = append(steps, serverStep("master-"+masterID, masterID))
+	previous = []string{"master-" + masterID}
+	steps = append(steps, &WorkflowStep{
+		Name:      "switchback",
+		DependsOn: previous,
+		Retries:   -1,
+		Run: func(ctx context.Context) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			cluster.withoutFailSync(cluster.SwitchoverWaitTest)
+			return nil
+		},
+	})
+	return steps, nil
 }
 
-func (cluster *Cluster) RollingRestart() error {
-	cluster.LogPrintf(LvlInfo, "Rolling restart")
-	masterID := cluster.GetMaster().Id
+func (cluster *Cluster) withoutFailSync(fn func()) {
 	saveFailoverMode := cluster.Conf.FailSync
 	cluster.SetFailSync(false)
 	defer cluster.SetFailSync(saveFailoverMode)
-	for _, slave := range cluster.slaves {
-
-		if !slave.IsDown() {
-			//slave.SetMaintenance()
-			//proxy.
-			if !slave.IsMaintenance {
-				slave.SwitchMaintenance()
-			}
-			err := cluster.StopDatabaseService(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling restart stop failed on slave %s %s", slave.URL, err)
-				slave.SwitchMaintenance()
-				return err
-			}
+	fn()
+}
 
-			err = cluster.WaitDatabaseFailed(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling stop slave does not transit Failed %s %s", slave.URL, err)
-				slave.SwitchMaintenance()
-				return err
-			}
+// isRollingStopped tell if the server was stopped by the workflow and not
+// started yet, the mark survives a monitor restart in the checkpoint
+func isRollingStopped(wf *Workflow, server *ServerMonitor) bool {
+	return wf.getParam("stopped-"+server.Id) != ""
+}
 
-			err = cluster.StartDatabaseWaitRejoin(slave)
-			if err != nil {
-				cluster.LogPrintf(LvlErr, "Cancel rolling restart slave does not restart %s %s", slave.URL, err)
-				return err
-			}
+// rollingRestartServer check the context between the stop, the start and the
+// sync, each of them is bounded by monitoring-wait-retry
+func (cluster *Cluster) rollingRestartServer(ctx context.Context, wf *Workflow, server *ServerMonitor) error {
+	if !server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	if !server.IsDown() {
+		cluster.setWorkflowParam(wf, "stopped-"+server.Id, "true")
+		err := cluster.StopDatabaseService(server)
+		if err != nil {
+			return fmt.Errorf("Stop failed on %s %s", server.URL, err)
+		}
+		err = cluster.WaitDatabaseFailed(server)
+		if err != nil {
+			return fmt.Errorf("Server %s does not transit failed %s", server.URL, err)
 		}
-		slave.WaitSyncToMaster(cluster.master)
-		slave.SwitchMaintenance()
 	}
-	cluster.SwitchoverWaitTest()
-	master := cluster.GetServerFromName(masterID)
-	if cluster.master.DSN == master.DSN {
-		cluster.LogPrintf(LvlErr, "Cancel rolling original master %s is the same %s after switchover", master.URL, cluster.master.URL)
-		return nil
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	if master.IsDown() {
-		cluster.LogPrintf(LvlErr, "Cancel rolling original master is down %s", master.URL)
-		return errors.New("Cancel rolling restart original master down")
+	err := cluster.StartDatabaseWaitRejoin(server)
+	if err != nil {
+		return fmt.Errorf("Server %s does not restart %s", server.URL, err)
 	}
-	if !master.IsMaintenance {
-		master.SwitchMaintenance()
+	cluster.setWorkflowParam(wf, "stopped-"+server.Id, "")
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	err := cluster.StopDatabaseService(master)
-	if err != nil {
-		cluster.LogPrintf(LvlErr, "Cancel rolling restart old master stop failed %s %s", master.URL, err)
-		return err
+	server.WaitSyncToMaster(cluster.master)
+	server.SwitchMaintenance()
+	return nil
+}
+
+func (cluster *Cluster) rollingReprovServer(ctx context.Context, wf *Workflow, server *ServerMonitor) error {
+	if !server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	if !server.IsDown() {
+		cluster.setWorkflowParam(wf, "stopped-"+server.Id, "true")
+		err := cluster.UnprovisionDatabaseService(server)
+		if err != nil {
+			return fmt.Errorf("Unprovision failed on %s %s", server.URL, err)
+		}
+		err = cluster.WaitDatabaseFailed(server)
+		if err != nil {
+			return fmt.Errorf("Server %s does not transit failed %s", server.URL, err)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	err = cluster.WaitDatabaseFailed(master)
+	err := cluster.InitDatabaseService(server)
 	if err != nil {
-		cluster.LogPrintf(LvlErr, "Cancel rolling restart old master does not transit suspect %s %s", master.URL, err)
-		return err
+		return fmt.Errorf("Provision failed on %s %s", server.URL, err)
 	}
-	err = cluster.StartDatabaseWaitRejoin(master)
+	err = cluster.StartDatabaseWaitRejoin(server)
 	if err != nil {
-		cluster.LogPrintf(LvlErr, "Cancel rolling restart old master does not restart %s %s", master.URL, err)
-		return err
+		return fmt.Errorf("Server %s does not restart %s", server.URL, err)
 	}
-	master.WaitSyncToMaster(cluster.master)
-	master.SwitchMaintenance()
-	cluster.SwitchOver()
-
+	cluster.setWorkflowParam(wf, "stopped-"+server.Id, "")
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	server.WaitSyncToMaster(cluster.master)
+	server.SwitchMaintenance()
 	return nil
 }
 
@@ -0,0 +1,269 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	v3 "github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
+	"github.com/signal18/replication-manager/utils/schemadiff"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// versions kept in the history of a table
+const schemaHistoryVersions = 50
+
+// SchemaDrift is a table that differs between the master and a replica, or
+// between the masters of shard clusters when Cluster is set
+type SchemaDrift struct {
+	Schema      string                  `json:"schema"`
+	Table       string                  `json:"table"`
+	Source      string                  `json:"source"`
+	Target      string                  `json:"target"`
+	Cluster     string                  `json:"cluster,omitempty"`
+	Differences []schemadiff.Difference `json:"differences"`
+	Since       time.Time               `json:"since"`
+}
+
+// SchemaVersion is a definition of a table in its history, the changes are
+// the differences with the previous version
+type SchemaVersion struct {
+	Version  int                     `json:"version"`
+	Time     time.Time               `json:"time"`
+	Checksum string                  `json:"checksum"`
+	DDL      string                  `json:"ddl"`
+	Changes  []schemadiff.Difference `json:"changes,omitempty"`
+}
+
+func (d *SchemaDrift) key() string {
+	return d.Cluster + "/" + d.Target + "/" + d.Schema + "." + d.Table
+}
+
+// GetSchemaDrift return the tables that differ at the last schema monitoring
+func (cluster *Cluster) GetSchemaDrift() []SchemaDrift {
+	cluster.schemaDriftMutex.Lock()
+	defer cluster.schemaDriftMutex.Unlock()
+	return append([]SchemaDrift{}, cluster.schemaDrift...)
+}
+
+// MonitorSchemaDrift compare the tables of the replicas, and of the masters
+// of the shard clusters, with the tables of the master. Tables with the same
+// checksum and engine are not fetched again.
+func (cluster *Cluster) MonitorSchemaDrift(master *ServerMonitor, tables map[string]v3.Table) {
+	if !cluster.Conf.MonitorSchemaDrift || master.DBVersion == nil || master.DBVersion.IsPPostgreSQL() {
+		return
+	}
+	// replicas differ on purpose while a rolling change runs
+	if cluster.IsInSchemaChange() {
+		return
+	}
+	var drifts []SchemaDrift
+	for _, s := range cluster.slaves {
+		if s.IsDown() || s.Conn == nil || s.DBVersion == nil {
+			continue
+		}
+		slaveTables, _, logs, err := dbhelper.GetTables(s.Conn, s.DBVersion)
+		cluster.LogSQL(logs, err, s.URL, "Monitor", LvlDbg, "Could not fetch replica tables %s", err)
+		if err != nil {
+			continue
+		}
+		drifts = append(drifts, cluster.compareSchemaTables(master, tables, s, slaveTables, "")...)
+	}
+	if cluster.Conf.MdbsProxyOn {
+		for _, cl := range cluster.ShardProxyGetShardClusters() {
+			m := cl.GetMaster()
+			if cl.Name == cluster.Name || m == nil || m.Conn == nil || m.DBVersion == nil {
+				continue
+			}
+			// shard clusters only share some of the tables
+			shared := make(map[string]v3.Table)
+			for k, t := range tables {
+				if _, ok := m.DictTables[k]; ok {
+					shared[k] = t
+				}
+			}
+			drifts = append(drifts, cluster.compareSchemaTables(master, shared, m, m.DictTables, cl.Name)...)
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].key() < drifts[j].key() })
+
+	cluster.schemaDriftMutex.Lock()
+	since := make(map[string]time.Time)
+	for _, d := range cluster.schemaDrift {
+		since[d.key()] = d.Since
+	}
+	for i := range drifts {
+		if t, ok := since[drifts[i].key()]; ok {
+			drifts[i].Since = t
+		} else {
+			cluster.LogPrintf(LvlWarn, "Schema drift of %s.%s on %s: %s", drifts[i].Schema, drifts[i].Table, drifts[i].Target, getSchemaDifferences(drifts[i].Differences))
+		}
+	}
+	cluster.schemaDrift = drifts
+	cluster.schemaDriftMutex.Unlock()
+}
+
+// compareSchemaTables return the drift of the target tables, a shard
+// cluster target only compare the shared tables
+func (cluster *Cluster) compareSchemaTables(source *ServerMonitor, sourceTables map[string]v3.Table, target *ServerMonitor, targetTables map[string]v3.Table, shard string) []SchemaDrift {
+	var drifts []SchemaDrift
+	newDrift := func(schema string, table string, diffs []schemadiff.Difference) SchemaDrift {
+		return SchemaDrift{Schema: schema, Table: table, Source: source.URL, Target: target.URL, Cluster: shard, Differences: diffs, Since: time.Now()}
+	}
+	for key, t := range sourceTables {
+		if t.TableSchema == "replication_manager_schema" {
+			continue
+		}
+		tt, ok := targetTables[key]
+		if !ok {
+			if ddl, err := cluster.getSchemaTableDefinition(source, t.TableSchema, t.TableName); err == nil {
+				drifts = append(drifts, newDrift(t.TableSchema, t.TableName, []schemadiff.Difference{{Kind: schemadiff.KindTable, Name: key, Source: ddl.String()}}))
+			}
+			continue
+		}
+		if tt.TableCrc == t.TableCrc && tt.Engine == t.Engine {
+			continue
+		}
+		sourceDDL, err := cluster.getSchemaTableDefinition(source, t.TableSchema, t.TableName)
+		if err != nil {
+			continue
+		}
+		targetDDL, err := cluster.getSchemaTableDefinition(target, t.TableSchema, t.TableName)
+		if err != nil {
+			continue
+		}
+		if diffs := schemadiff.Compare(sourceDDL, targetDDL); len(diffs) > 0 {
+			drifts = append(drifts, newDrift(t.TableSchema, t.TableName, diffs))
+		}
+	}
+	if shard != "" {
+		return drifts
+	}
+	for key, tt := range targetTables {
+		if _, ok := sourceTables[key]; ok || tt.TableSchema == "replication_manager_schema" {
+			continue
+		}
+		if ddl, err := cluster.getSchemaTableDefinition(target, tt.TableSchema, tt.TableName); err == nil {
+			drifts = append(drifts, newDrift(tt.TableSchema, tt.TableName, []schemadiff.Difference{{Kind: schemadiff.KindTable, Name: key, Target: ddl.String()}}))
+		}
+	}
+	return drifts
+}
+
+func (cluster *Cluster) getSchemaTableDefinition(server *ServerMonitor, schema string, table string) (*schemadiff.Table, error) {
+	ddl, logs, err := dbhelper.GetTableDDL(server.Conn, server.DBVersion, schema, table)
+	cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not fetch table definition %s", err)
+	if err != nil {
+		return nil, err
+	}
+	return schemadiff.Parse(ddl), nil
+}
+
+func getSchemaDifferences(diffs []schemadiff.Difference) string {
+	var list []string
+	for _, d := range diffs {
+		list = append(list, d.String())
+	}
+	return strings.Join(list, ", ")
+}
+
+// setSchemaDriftStates raise the drift found by the last schema monitoring
+// at every monitor tick
+func (cluster *Cluster) setSchemaDriftStates() {
+	var replicas, shards []string
+	for _, d := range cluster.GetSchemaDrift() {
+		drift := fmt.Sprintf("%s.%s on %s (%s)", d.Schema, d.Table, d.Target, getSchemaDifferences(d.Differences))
+		if d.Cluster == "" {
+			replicas = append(replicas, drift)
+		} else {
+			shards = append(shards, d.Cluster+" "+drift)
+		}
+	}
+	if len(replicas) > 0 {
+		cluster.SetState("ERR00098", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00098"], strings.Join(replicas, ", ")), ErrFrom: "SCHEMA"})
+	}
+	if len(shards) > 0 {
+		cluster.SetState("ERR00099", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00099"], strings.Join(shards, ", ")), ErrFrom: "SCHEMA"})
+	}
+}
+
+func (cluster *Cluster) getSchemaHistoryFile(schema string, table string) string {
+	return cluster.WorkingDir + "/schemahistory/" + url.PathEscape(schema+"."+table) + ".json"
+}
+
+// GetSchemaHistory return the versions of a table definition, the oldest
+// first
+func (cluster *Cluster) GetSchemaHistory(schema string, table string) ([]SchemaVersion, error) {
+	cluster.schemaDriftMutex.Lock()
+	defer cluster.schemaDriftMutex.Unlock()
+	return cluster.readSchemaHistory(schema, table)
+}
+
+func (cluster *Cluster) readSchemaHistory(schema string, table string) ([]SchemaVersion, error) {
+	var history []SchemaVersion
+	file, err := ioutil.ReadFile(cluster.getSchemaHistoryFile(schema, table))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(file, &history)
+	return history, err
+}
+
+// recordSchemaVersion add the master definition of a table to its history
+// when it differs from the last version
+func (cluster *Cluster) recordSchemaVersion(master *ServerMonitor, schema string, table string) {
+	ddl, logs, err := dbhelper.GetTableDDL(master.Conn, master.DBVersion, schema, table)
+	cluster.LogSQL(logs, err, master.URL, "Monitor", LvlDbg, "Could not fetch table definition %s", err)
+	if err != nil {
+		return
+	}
+	parsed := schemadiff.Parse(ddl)
+
+	cluster.schemaDriftMutex.Lock()
+	defer cluster.schemaDriftMutex.Unlock()
+	history, err := cluster.readSchemaHistory(schema, table)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not read schema history of %s.%s: %s", schema, table, err)
+		return
+	}
+	version := SchemaVersion{Version: 1, Time: time.Now(), Checksum: parsed.Checksum(), DDL: ddl}
+	if n := len(history); n > 0 {
+		last := history[n-1]
+		if last.Checksum == version.Checksum {
+			return
+		}
+		version.Version = last.Version + 1
+		version.Changes = schemadiff.Compare(schemadiff.Parse(last.DDL), parsed)
+		cluster.LogPrintf(LvlInfo, "Schema of %s.%s changed to version %d: %s", schema, table, version.Version, getSchemaDifferences(version.Changes))
+		cluster.LogEvent(journal.ConstEventSchema, "table-version", master.URL, "", "Schema of %s.%s changed to version %d: %s", schema, table, version.Version, getSchemaDifferences(version.Changes))
+	}
+	history = append(history, version)
+	if len(history) > schemaHistoryVersions {
+		history = history[len(history)-schemaHistoryVersions:]
+	}
+	if err := os.MkdirAll(cluster.WorkingDir+"/schemahistory", 0755); err != nil {
+		cluster.LogPrintf(LvlErr, "Could not create schema history directory: %s", err)
+		return
+	}
+	saveJson, _ := json.MarshalIndent(history, "", "\t")
+	err = ioutil.WriteFile(cluster.getSchemaHistoryFile(schema, table), saveJson, 0644)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save schema history of %s.%s: %s", schema, table, err)
+	}
+}
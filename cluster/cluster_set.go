@@ -7,8 +7,8 @@
 package cluster
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -20,6 +20,7 @@ import (
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/opensvc"
+	"github.com/signal18/replication-manager/utils/alert"
 	"github.com/signal18/replication-manager/utils/dbhelper"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/state"
@@ -334,8 +335,14 @@ func (cluster *Cluster) SetSchedulerAlertDisable() {
 		cluster.LogPrintf(LvlInfo, "Schedule disable alert at: %s", cluster.Conf.SchedulerAlertDisableCron)
 		cluster.idSchedulerAlertDisable, err = cluster.scheduler.AddFunc(cluster.Conf.SchedulerAlertDisableCron, func() {
 			cluster.LogPrintf(LvlInfo, "Alerting is disabled from scheduler")
-			cluster.IsAlertDisable = true
-			go cluster.WaitAlertDisable()
+			_, err := cluster.AddAlertSilence(alert.Silence{
+				Comment:   "scheduler-alert-disable",
+				CreatedBy: "scheduler",
+				EndsAt:    time.Now().Add(time.Duration(cluster.Conf.SchedulerAlertDisableTime) * time.Second),
+			})
+			if err != nil {
+				cluster.LogPrintf(LvlErr, "Could not disable alerting from scheduler: %s", err)
+			}
 		})
 		if err == nil {
 			cluster.Schedule["alertdisable"] = cluster.scheduler.Entry(cluster.idSchedulerAlertDisable)
@@ -343,6 +350,28 @@ func (cluster *Cluster) SetSchedulerAlertDisable() {
 	}
 }
 
+func (cluster *Cluster) SetSchedulerBackupVerify() {
+	if cluster.scheduler == nil {
+		cluster.LogPrintf(LvlInfo, "Scheduler is disable cancel")
+		return
+	}
+	if cluster.HasSchedulerEntry("backupverify") {
+		cluster.LogPrintf(LvlInfo, "Disable backup verification")
+		cluster.scheduler.Remove(cluster.idSchedulerBackupVerify)
+		delete(cluster.Schedule, "backupverify")
+	}
+	if cluster.Conf.SchedulerBackupVerify {
+		var err error
+		cluster.LogPrintf(LvlInfo, "Schedule backup verification time at: %s", cluster.Conf.BackupVerifyCron)
+		cluster.idSchedulerBackupVerify, err = cluster.scheduler.AddFunc(cluster.Conf.BackupVerifyCron, func() {
+			cluster.VerifyBackups()
+		})
+		if err == nil {
+			cluster.Schedule["backupverify"] = cluster.scheduler.Entry(cluster.idSchedulerBackupVerify)
+		}
+	}
+}
+
 func (cluster *Cluster) CompressBackups() {
 	//cluster.LogPrintf(LvlInfo, "COUCOU compress backups")
 }
@@ -787,6 +816,10 @@ func (cluster *Cluster) SetBackupLogicalType(backup string) {
 	cluster.Conf.BackupLogicalType = backup
 }
 
+func (cluster *Cluster) SetFailoverElectionPolicies(policies string) {
+	cluster.Conf.FailoverElectionPolicies = policies
+}
+
 func (cluster *Cluster) SetBackupPhysicalType(backup string) {
 	cluster.Conf.BackupPhysicalType = backup
 }
@@ -953,7 +986,12 @@ func (cluster *Cluster) SetUnDiscovered() {
 }
 
 func (cluster *Cluster) SetActiveStatus(status string) {
+	becomeActive := cluster.Status != ConstMonitorActif && status == ConstMonitorActif
 	cluster.Status = status
+	if becomeActive && !cluster.runOnceAfterTopology {
+		// take over the workflows of the previous active monitor
+		go cluster.ResumeWorkflows()
+	}
 	if cluster.Conf.MonitorScheduler {
 		if cluster.Status == ConstMonitorActif {
 			cluster.scheduler.Start()
@@ -987,40 +1025,23 @@ func (cl *Cluster) SetArbitratorReport() error {
 	cl.IsLostMajority = cl.LostMajority()
 	// SplitBrain
 
-	url := "http://" + cl.Conf.ArbitrationSasHosts + "/heartbeat"
-	var mst string
-	if cl.GetMaster() != nil {
-		mst = cl.GetMaster().URL
-	}
-	var jsonStr = []byte(`{"uuid":"` + cl.runUUID + `","secret":"` + cl.Conf.ArbitrationSasSecret + `","cluster":"` + cl.GetName() + `","master":"` + mst + `","id":` + strconv.Itoa(cl.Conf.ArbitrationSasUniqueId) + `,"status":"` + cl.Status + `","hosts":` + strconv.Itoa(len(cl.GetServers())) + `,"failed":` + strconv.Itoa(cl.CountFailed(cl.GetServers())) + `}`)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+	body, err := json.Marshal(cl.getArbitrationRequest())
 	if err != nil {
-		if cl.Conf.LogHeartbeat {
-			cl.LogPrintf("INFO", "Failed to post http new request to arbitrator %s ", jsonStr)
-		}
-		cl.IsFailedArbitrator = true
 		return err
 	}
-	req.Header.Set("X-Custom-Header", "myvalue")
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	//client := &http.Client{Timeout: timeout}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cl.Conf.ArbitrationReadTimout)*time.Millisecond)
-	defer cancel()
-	req = req.WithContext(ctx)
 	startConnect := time.Now()
-	resp, err := client.Do(req)
+	_, err = cl.newArbitrationClient(time.Duration(cl.Conf.ArbitrationReadTimout)*time.Millisecond).Post("/heartbeat", body)
 	if err != nil {
+		if cl.Conf.LogHeartbeat {
+			cl.LogPrintf("INFO", "Failed to report to arbitrator %s", err)
+		}
 		cl.IsFailedArbitrator = true
 		return err
 	}
-	defer client.CloseIdleConnections()
 	stopConnect := time.Now()
 	if cl.GetLogLevel() > 2 {
 		log.Printf(" Report abitrator connect took: %s\n", stopConnect.Sub(startConnect))
 	}
-	ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
 	cl.IsFailedArbitrator = false
 	return nil
 }
@@ -1211,6 +1232,12 @@ func (cluster *Cluster) SetSchedulerDbServersPhysicalBackupCron(value string) er
 	return nil
 }
 
+func (cluster *Cluster) SetSchedulerDbServersBackupVerifyCron(value string) error {
+	cluster.Conf.BackupVerifyCron = value
+	cluster.SetSchedulerBackupVerify()
+	return nil
+}
+
 func (cluster *Cluster) SetSchedulerDbServersOptimizeCron(value string) error {
 	cluster.Conf.BackupDatabaseOptimizeCron = value
 	cluster.SetSchedulerOptimize()
@@ -12,15 +12,12 @@
 package cluster
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
+	"github.com/signal18/replication-manager/utils/arbitration"
 	"github.com/signal18/replication-manager/utils/state"
 )
 
@@ -55,46 +52,26 @@ func (cluster *Cluster) Heartbeat(wg *sync.WaitGroup) {
 func (cl *Cluster) ArbitratorElection() error {
 	timeout := time.Duration(time.Duration(cl.Conf.MonitoringTicker*1000-int64(cl.Conf.ArbitrationReadTimout)) * time.Millisecond)
 
-	url := "http://" + cl.Conf.ArbitrationSasHosts + "/arbitrator"
 	if cl.IsSplitBrainBck != cl.IsSplitBrain {
 		cl.LogPrintf("INFO", "Arbitrator: External check requested")
 	} else {
 		// don't need arbitration if split brain status did not change
 		return nil
 	}
-	var mst string
-	if cl.GetMaster() != nil {
-		mst = cl.GetMaster().URL
-	}
-
-	var jsonStr = []byte(`{"uuid":"` + cl.runUUID + `","secret":"` + cl.Conf.ArbitrationSasSecret + `","cluster":"` + cl.GetName() + `","master":"` + mst + `","id":` + strconv.Itoa(cl.Conf.ArbitrationSasUniqueId) + `,"status":"` + cl.Status + `","hosts":` + strconv.Itoa(len(cl.GetServers())) + `,"failed":` + strconv.Itoa(cl.CountFailed(cl.GetServers())) + `}`)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+	body, err := json.Marshal(cl.getArbitrationRequest())
 	if err != nil {
-		cl.LogPrintf("ERROR", "Could not create http request to arbitrator: %s", err)
-		cl.IsFailedArbitrator = true
 		return err
 	}
-	req.Header.Set("X-Custom-Header", "myvalue")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: timeout}
-	resp, err := client.Do(req)
+	content, err := cl.newArbitrationClient(timeout).Post("/arbitrator", body)
 	if err != nil {
 		cl.LogPrintf("ERROR", "Could not receive http response from arbitration: %s", err)
 		cl.IsFailedArbitrator = true
 		return err
 	}
-	defer resp.Body.Close()
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	type response struct {
-		Arbitration string `json:"arbitration"`
-		Master      string `json:"master"`
-	}
-	var r response
-	err = json.Unmarshal(body, &r)
+	var r arbitration.Response
+	err = json.Unmarshal(content, &r)
 	if err != nil {
-		cl.LogPrintf("ERROR", "Arbitrator sent back invalid JSON, %s", body)
+		cl.LogPrintf("ERROR", "Arbitrator sent back invalid JSON, %s", content)
 		cl.IsFailedArbitrator = true
 		return err
 	}
@@ -107,7 +84,7 @@ func (cl *Cluster) ArbitratorElection() error {
 		cl.SetActiveStatus(ConstMonitorStandby)
 		cl.SetState("ERR00068", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00068"]), ErrFrom: "ARB"})
 		if cl.GetMaster() != nil {
-			mst = cl.GetMaster().URL
+			mst := cl.GetMaster().URL
 			if r.Master != mst {
 				cl.LostArbitration(r.Master)
 				cl.LogPrintf("INFO", "Election Lost - Current master %s different from winner master %s, %s is split brain victim. ", mst, r.Master, mst)
@@ -116,3 +93,31 @@ func (cl *Cluster) ArbitratorElection() error {
 	}
 	return nil
 }
+
+// getArbitrationRequest describe the monitor view of the cluster sent to the
+// arbitrators, the secret is not part of it and only signs the request
+func (cl *Cluster) getArbitrationRequest() arbitration.Request {
+	var mst string
+	if cl.GetMaster() != nil {
+		mst = cl.GetMaster().URL
+	}
+	return arbitration.Request{
+		UUID:    cl.runUUID,
+		Cluster: cl.GetName(),
+		Master:  mst,
+		UID:     cl.Conf.ArbitrationSasUniqueId,
+		Status:  cl.Status,
+		Hosts:   len(cl.GetServers()),
+		Failed:  cl.CountFailed(cl.GetServers()),
+	}
+}
+
+// newArbitrationClient reach the first arbitrator answering among
+// arbitration-external-hosts
+func (cl *Cluster) newArbitrationClient(timeout time.Duration) *arbitration.Client {
+	secret := cl.Conf.GetDecryptedValue("arbitration-external-secret")
+	if secret == "" {
+		secret = cl.Conf.ArbitrationSasSecret
+	}
+	return arbitration.NewClient(cl.Conf.ArbitrationSasHosts, cl.Conf.ArbitrationSasUniqueId, secret, timeout)
+}
@@ -29,8 +29,12 @@ type SST struct {
 	outfilewriter     io.Writer
 	outresticreader   io.WriteCloser
 	outfilegzipwriter *gzip.Writer
+	outencryptwriter  io.WriteCloser
+	outstoragewriter  *backupStorageWriter
 	cluster           *Cluster
 	port              int
+	err               error
+	done              func(error)
 }
 
 type ProtectedSSTconnections struct {
@@ -44,6 +48,17 @@ func (cluster *Cluster) SSTCloseReceiver(destinationPort int) {
 	SSTs.SSTconnections[destinationPort].in.(net.Conn).Close()
 }
 
+// SSTSetReceiverDone register a function called with the stream error once
+// the receiver to file on port has closed its file
+func (cluster *Cluster) SSTSetReceiverDone(port string, done func(error)) {
+	destinationPort, _ := strconv.Atoi(port)
+	SSTs.Lock()
+	defer SSTs.Unlock()
+	if sst, ok := SSTs.SSTconnections[destinationPort]; ok {
+		sst.done = done
+	}
+}
+
 func (cluster *Cluster) SSTWatchRestic(r io.Reader) error {
 	var out []byte
 	buf := make([]byte, 1024, 1024)
@@ -130,8 +145,25 @@ func (cluster *Cluster) SSTRunReceiverToFile(filename string, openfile string) (
 		return "", err
 	}
 	writers = append(writers, sst.file)
+	if openfile == ConstJobCreateFile {
+		sst.outstoragewriter = cluster.createBackupStorageWriter(filename)
+		if sst.outstoragewriter != nil {
+			writers = append(writers, sst.outstoragewriter)
+		}
+	}
 
 	sst.outfilewriter = io.MultiWriter(writers...)
+	// backups are created, logs appended to are left in clear
+	if openfile == ConstJobCreateFile {
+		sst.outencryptwriter, err = cluster.NewBackupWriter(sst.outfilewriter)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Backup encryption failed for job %s %s", filename, err)
+			sst.outstoragewriter.finish(err)
+			sst.file.Close()
+			return "", err
+		}
+		sst.outfilewriter = sst.outencryptwriter
+	}
 
 	sst.listener, err = net.Listen("tcp", cluster.Conf.BindAddr+":"+cluster.SSTGetSenderPort())
 	if err != nil {
@@ -165,15 +197,30 @@ func (cluster *Cluster) SSTRunReceiverToGZip(filename string, openfile string) (
 		sst.file, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
 	}
 
-	gw := gzip.NewWriter(sst.file)
-
-	sst.outfilegzipwriter = gw
-
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Open file failed for job %s %s", filename, err)
 		return "", err
 	}
 
+	var out io.Writer = sst.file
+	if openfile == ConstJobCreateFile {
+		sst.outstoragewriter = cluster.createBackupStorageWriter(filename)
+		if sst.outstoragewriter != nil {
+			out = io.MultiWriter(sst.file, sst.outstoragewriter)
+		}
+		sst.outencryptwriter, err = cluster.NewBackupWriter(out)
+		if err != nil {
+			cluster.LogPrintf(LvlErr, "Backup encryption failed for job %s %s", filename, err)
+			sst.outstoragewriter.finish(err)
+			sst.file.Close()
+			return "", err
+		}
+		out = sst.outencryptwriter
+	}
+	gw := gzip.NewWriter(out)
+
+	sst.outfilegzipwriter = gw
+
 	sst.listener, err = net.Listen("tcp", cluster.Conf.BindAddr+":"+cluster.SSTGetSenderPort())
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "Exiting SST on socket listen %s", err)
@@ -203,19 +250,27 @@ func (sst *SST) tcp_con_handle_to_gzip() {
 		}
 		port := sst.listener.Addr().(*net.TCPAddr).Port
 		sst.tcplistener.Close()
-		sst.outfilegzipwriter.Close()
+		if err := sst.outfilegzipwriter.Close(); err != nil && sst.err == nil {
+			sst.err = err
+		}
+		sst.closeEncryptWriter()
+		sst.outstoragewriter.finish(sst.err)
 		sst.file.Close()
 		sst.listener.Close()
 		SSTs.Lock()
 		delete(SSTs.SSTconnections, port)
 		sst.cluster.SSTSenderFreePort(strconv.Itoa(port))
+		done := sst.done
 		SSTs.Unlock()
+		if done != nil {
+			done(sst.err)
+		}
 	}()
 
 	sst.in, err = sst.listener.Accept()
 
 	if err != nil {
-
+		sst.err = err
 		return
 	}
 
@@ -240,18 +295,24 @@ func (sst *SST) tcp_con_handle_to_file() {
 		}
 		port := sst.listener.Addr().(*net.TCPAddr).Port
 		sst.tcplistener.Close()
+		sst.closeEncryptWriter()
+		sst.outstoragewriter.finish(sst.err)
 		sst.file.Close()
 		sst.listener.Close()
 		SSTs.Lock()
 		delete(SSTs.SSTconnections, port)
 		sst.cluster.SSTSenderFreePort(strconv.Itoa(port))
+		done := sst.done
 		SSTs.Unlock()
+		if done != nil {
+			done(sst.err)
+		}
 	}()
 
 	sst.in, err = sst.listener.Accept()
 
 	if err != nil {
-
+		sst.err = err
 		return
 	}
 
@@ -302,6 +363,17 @@ func (sst *SST) tcp_con_handle_to_restic() {
 	}
 }
 
+// closeEncryptWriter seal the last chunk of an encrypted backup before its
+// file is closed
+func (sst *SST) closeEncryptWriter() {
+	if sst.outencryptwriter == nil {
+		return
+	}
+	if err := sst.outencryptwriter.Close(); err != nil && sst.err == nil {
+		sst.err = err
+	}
+}
+
 // Performs copy operation between streams: os and tcp streams
 func (sst *SST) stream_copy_to_file() <-chan int {
 	//coucou
@@ -329,12 +401,14 @@ func (sst *SST) stream_copy_to_file() <-chan int {
 			if err != nil {
 				if err != io.EOF {
 					sst.cluster.LogPrintf(LvlErr, "Read error: %s", err)
+					sst.err = err
 				}
 				break
 			}
 			_, err = sst.outfilewriter.Write(buf[0:nBytes])
 			if err != nil {
 				sst.cluster.LogPrintf(LvlErr, "Write error: %s", err)
+				sst.err = err
 			}
 		}
 	}()
@@ -368,6 +442,7 @@ func (sst *SST) stream_copy_to_gzip() <-chan int {
 			if err != nil {
 				if err != io.EOF {
 					sst.cluster.LogPrintf(LvlErr, "Read error: %s", err)
+					sst.err = err
 				}
 				break
 			}
@@ -375,6 +450,7 @@ func (sst *SST) stream_copy_to_gzip() <-chan int {
 			_, err = sst.outfilegzipwriter.Write(buf[0:nBytes])
 			if err != nil {
 				sst.cluster.LogPrintf(LvlErr, "Write error: %s", err)
+				sst.err = err
 			}
 		}
 
@@ -432,11 +508,11 @@ func (cluster *Cluster) SSTRunSender(backupfile string, sv *ServerMonitor) {
 	}
 
 	defer client.Close()
-	file, err := os.Open(backupfile)
+	file, err := cluster.OpenBackupFile(backupfile)
 	cluster.LogPrintf(LvlInfo, "SST sending file: %s to node: %s port: %s", backupfile, sv.Host, sv.SSTPort)
 	if os.IsNotExist(err) && cluster.Conf.CompressBackups {
 		backupfile = strings.Replace(backupfile, "xbtream", "gz", 1)
-		file, err = os.Open(backupfile)
+		file, err = cluster.OpenBackupFile(backupfile)
 	}
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "SST failed to open backup file server %s %s ", sv.URL, err)
@@ -446,6 +522,7 @@ func (cluster *Cluster) SSTRunSender(backupfile string, sv *ServerMonitor) {
 	sendBuffer := make([]byte, cluster.Conf.SSTSendBuffer)
 	//fmt.Println("Start sending file!")
 	var total uint64
+	n := len(sendBuffer)
 	for {
 		if strings.Contains(backupfile, "gz") {
 			fz, err := gzip.NewReader(file)
@@ -455,13 +532,13 @@ func (cluster *Cluster) SSTRunSender(backupfile string, sv *ServerMonitor) {
 			defer fz.Close()
 			fz.Read(sendBuffer)
 		} else {
-			_, err = file.Read(sendBuffer)
+			n, err = file.Read(sendBuffer)
 			if err == io.EOF {
 				break
 			}
 		}
 
-		bts, err := client.Write(sendBuffer)
+		bts, err := client.Write(sendBuffer[:n])
 		if err != nil {
 			cluster.LogPrintf(LvlErr, "SST failed to write chunk %s at position %d", err, total)
 		}
@@ -486,20 +563,21 @@ func (cluster *Cluster) SSTRunSenderSSL(backupfile string, sv *ServerMonitor) {
 		return
 	}
 	defer client.Close()
-	file, err := os.Open(backupfile)
+	file, err := cluster.OpenBackupFile(backupfile)
 	cluster.LogPrintf(LvlInfo, "SST sending file via SSL: %s to node: %s port: %s", backupfile, sv.Host, sv.SSTPort)
 	if err != nil {
 		cluster.LogPrintf(LvlErr, "SST failed to open backup file server %s %s ", sv.URL, err)
 		return
 	}
+	defer file.Close()
 	sendBuffer := make([]byte, 16384)
 	var total uint64
 	for {
-		_, err = file.Read(sendBuffer)
+		n, err := file.Read(sendBuffer)
 		if err == io.EOF {
 			break
 		}
-		bts, err := client.Write(sendBuffer)
+		bts, err := client.Write(sendBuffer[:n])
 		if err != nil {
 			cluster.LogPrintf(LvlErr, "SST failed to write chunk %s at position %d", err, total)
 		}
@@ -241,6 +241,19 @@ func (cluster *Cluster) SwitchSchedulerBackupPhysical() {
 	cluster.SetSchedulerBackupPhysical()
 }
 
+func (cluster *Cluster) SwitchSchedulerBackupVerify() {
+	cluster.Conf.SchedulerBackupVerify = !cluster.Conf.SchedulerBackupVerify
+	cluster.SetSchedulerBackupVerify()
+}
+
+func (cluster *Cluster) SwitchBackupVerifyChecksum() {
+	cluster.Conf.BackupVerifyChecksum = !cluster.Conf.BackupVerifyChecksum
+}
+
+func (cluster *Cluster) SwitchBackupEncrypt() {
+	cluster.Conf.BackupEncrypt = !cluster.Conf.BackupEncrypt
+}
+
 func (cluster *Cluster) SwitchSchedulerDbJobsSsh() {
 	cluster.Conf.SchedulerJobsSSH = !cluster.Conf.SchedulerJobsSSH
 	cluster.SetSchedulerDbJobsSsh()
@@ -365,6 +378,10 @@ func (cluster *Cluster) SwitchMonitoringSchemaChange() {
 	cluster.Conf.MonitorSchemaChange = !cluster.Conf.MonitorSchemaChange
 }
 
+func (cluster *Cluster) SwitchMonitoringConsistency() {
+	cluster.Conf.MonitorConsistency = !cluster.Conf.MonitorConsistency
+}
+
 func (cluster *Cluster) SwitchMonitoringCapture() {
 	cluster.Conf.MonitorCapture = !cluster.Conf.MonitorCapture
 	// delete cluster config
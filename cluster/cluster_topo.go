@@ -126,6 +126,8 @@ func (cluster *Cluster) AddChildServers() error {
 // Create a connection to each host and build list of slaves.
 func (cluster *Cluster) TopologyDiscover(wcg *sync.WaitGroup) error {
 	defer wcg.Done()
+	_, span := cluster.StartSpan("TopologyDiscover")
+	defer span.End()
 	//monitor ignored server fist so that their replication position get oldest
 	wg := new(sync.WaitGroup)
 	if cluster.Conf.Hosts == "" {
@@ -0,0 +1,133 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/signal18/replication-manager/cluster")
+
+// traceContext wrap the context of the running monitor loop so that it can
+// be stored in an atomic.Value
+type traceContext struct {
+	ctx context.Context
+}
+
+// startLoopSpan open the root span of one monitor loop, spans started by
+// the cluster until the next loop are its children
+func (cluster *Cluster) startLoopSpan(name string) trace.Span {
+	ctx, span := tracer.Start(context.Background(), name, trace.WithAttributes(
+		attribute.String("cluster", cluster.Name),
+		attribute.Int64("heartbeat", cluster.StateMachine.GetHeartbeats()),
+	))
+	cluster.traceCtx.Store(traceContext{ctx: ctx})
+	return span
+}
+
+// getTraceContext return the context of the running failover phase, or of
+// the current monitor loop. Both are read by the ping and refresh goroutines
+// while the monitor loop or the failover update them.
+func (cluster *Cluster) getTraceContext() context.Context {
+	if tc, ok := cluster.failoverTraceCtx.Load().(traceContext); ok && tc.ctx != nil {
+		return tc.ctx
+	}
+	if tc, ok := cluster.traceCtx.Load().(traceContext); ok {
+		return tc.ctx
+	}
+	return context.Background()
+}
+
+// StartSpan open a span under the current monitor loop or failover phase
+func (cluster *Cluster) StartSpan(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("cluster", cluster.Name))
+	return tracer.Start(cluster.getTraceContext(), name, trace.WithAttributes(attrs...))
+}
+
+func (server *ServerMonitor) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	attrs = append(attrs, attribute.String("server", server.URL))
+	_, span := server.ClusterGroup.StartSpan(name, attrs...)
+	return span
+}
+
+func (server *ServerMonitor) startJobSpan(task string) trace.Span {
+	return server.startSpan("Job."+task, attribute.String("task", task))
+}
+
+// endSpan mark the span failed when the traced call return an error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startTrace open the failover in its own trace linked to the last monitor
+// loop, StartPhase add one child span per phase. The context of the running
+// phase is published in store for the spans of the other goroutines.
+func (r *FailoverReport) startTrace(ctx context.Context, store *atomic.Value) {
+	r.rootCtx, r.span = tracer.Start(ctx, "MasterFailover", trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: trace.SpanContextFromContext(ctx)}),
+		trace.WithAttributes(
+			attribute.String("cluster", r.Cluster),
+			attribute.String("type", r.Type),
+		))
+	r.traceCtx = store
+	r.setTraceContext(r.rootCtx)
+}
+
+func (r *FailoverReport) setTraceContext(ctx context.Context) {
+	if r.traceCtx != nil {
+		r.traceCtx.Store(traceContext{ctx: ctx})
+	}
+}
+
+func (r *FailoverReport) startPhaseTrace(name string) {
+	if r.span == nil {
+		return
+	}
+	var ctx context.Context
+	ctx, r.phaseSpan = tracer.Start(r.rootCtx, "MasterFailover."+name, trace.WithAttributes(attribute.String("cluster", r.Cluster)))
+	r.setTraceContext(ctx)
+}
+
+func (r *FailoverReport) endPhaseTrace() {
+	if r.phaseSpan == nil {
+		return
+	}
+	r.phaseSpan.End()
+	r.phaseSpan = nil
+	r.setTraceContext(r.rootCtx)
+}
+
+func (r *FailoverReport) endTrace() {
+	if r.span == nil {
+		return
+	}
+	r.endPhaseTrace()
+	r.span.SetAttributes(
+		attribute.String("old_master", r.OldMaster),
+		attribute.String("new_master", r.NewMaster),
+		attribute.Int64("write_blocked_ms", r.WriteBlockedMs),
+	)
+	if !r.Success {
+		r.span.SetStatus(codes.Error, r.Error)
+	}
+	r.span.End()
+	r.span = nil
+	r.setTraceContext(nil)
+}
@@ -0,0 +1,347 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/misc"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const ConstWorkflowRollingUpgrade = "rolling-upgrade"
+
+var upgradeVersionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+
+// NewRollingUpgrade plan a rolling upgrade workflow to the target version or
+// package, the replicas are upgraded one by one and the old master last
+func (cluster *Cluster) NewRollingUpgrade(target string) (*Workflow, error) {
+	if target == "" {
+		return nil, errors.New("No target version or package for rolling upgrade")
+	}
+	if cluster.Conf.ProvDbUpgradeScript == "" {
+		return nil, errors.New("No prov-db-upgrade-script to install the target")
+	}
+	return cluster.NewWorkflow(ConstWorkflowRollingUpgrade, map[string]string{"target": target})
+}
+
+// RollingUpgrade run a rolling upgrade to the target and return when it is
+// done, paused or rolled back
+func (cluster *Cluster) RollingUpgrade(target string) error {
+	wf, err := cluster.NewRollingUpgrade(target)
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Cancel rolling upgrade %s", err)
+		return err
+	}
+	return cluster.RunWorkflow(wf)
+}
+
+// GetRollingUpgrade return the most recent rolling upgrade workflow
+func (cluster *Cluster) GetRollingUpgrade() *Workflow {
+	for _, wf := range cluster.GetWorkflows() {
+		if wf.Type == ConstWorkflowRollingUpgrade {
+			return wf
+		}
+	}
+	return nil
+}
+
+// ResumeRollingUpgrade continue a paused rolling upgrade from the failed
+// server
+func (cluster *Cluster) ResumeRollingUpgrade() error {
+	wf := cluster.GetRollingUpgrade()
+	if wf == nil || wf.getState() != ConstWorkflowPaused {
+		return errors.New("No paused rolling upgrade")
+	}
+	return cluster.ResumeWorkflow(wf.Id)
+}
+
+// buildRollingUpgradeWorkflow chain an upgrade step per running replica, a
+// switchover and the upgrade of the old master. The params keep the target,
+// the servers and their version before the upgrade, plus a mark on the
+// servers stopped or with upgraded system tables.
+func buildRollingUpgradeWorkflow(cluster *Cluster, wf *Workflow) ([]*WorkflowStep, error) {
+	if wf.Params["master"] == "" {
+		master := cluster.GetMaster()
+		if master == nil {
+			return nil, errors.New("No master for rolling upgrade")
+		}
+		var slaves []string
+		for _, slave := range cluster.slaves {
+			if slave.IsDown() {
+				cluster.LogPrintf(LvlWarn, "Rolling upgrade skip server down %s", slave.URL)
+				continue
+			}
+			slaves = append(slaves, slave.Id)
+			wf.Params["from-"+slave.Id] = slave.GetDBVersionNumber()
+		}
+		wf.Params["master"] = master.Id
+		wf.Params["from-"+master.Id] = master.GetDBVersionNumber()
+		wf.Params["slaves"] = strings.Join(slaves, ",")
+	}
+	target := wf.Params["target"]
+	masterID := wf.Params["master"]
+	var steps []*WorkflowStep
+	var previous []string
+	upgradeStep := func(id string) *WorkflowStep {
+		return &WorkflowStep{
+			Name:              "upgrade-" + id,
+			DependsOn:         previous,
+			Retries:           -1,
+			RollbackOnFailure: cluster.Conf.ProvDbUpgradeOnFailure == "rollback",
+			Run: func(ctx context.Context) error {
+				return cluster.runRollingUpgradeServer(ctx, wf, id, target)
+			},
+			Rollback: func() error {
+				return cluster.rollbackRollingUpgradeServer(wf, id)
+			},
+		}
+	}
+	for _, id := range strings.Split(wf.Params["slaves"], ",") {
+		if id == "" {
+			continue
+		}
+		steps = append(steps, upgradeStep(id))
+		previous = []string{"upgrade-" + id}
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("No replica for rolling upgrade")
+	}
+	steps = append(steps, &WorkflowStep{
+		Name:      "switchover",
+		DependsOn: previous,
+		Run: func(ctx context.Context) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return cluster.switchoverRollingUpgrade(masterID)
+		},
+	})
+	previous = []string{"switchover"}
+	steps = append(steps, upgradeStep(masterID))
+	return steps, nil
+}
+
+// switchoverRollingUpgrade move the master role away from a server before it
+// is stopped
+func (cluster *Cluster) switchoverRollingUpgrade(id string) error {
+	if cluster.master != nil && cluster.master.Id != id {
+		return nil
+	}
+	cluster.LogPrintf(LvlInfo, "Rolling upgrade switchover away from %s", id)
+	cluster.withoutFailSync(cluster.SwitchoverWaitTest)
+	if cluster.master == nil || cluster.master.Id == id {
+		return errors.New("Master is the same after switchover")
+	}
+	return nil
+}
+
+func (cluster *Cluster) runRollingUpgradeServer(ctx context.Context, wf *Workflow, id string, target string) error {
+	server := cluster.GetServerFromName(id)
+	if server == nil {
+		return fmt.Errorf("Server %s not found", id)
+	}
+	err := cluster.upgradeDatabase(ctx, wf, server, target)
+	if err == nil {
+		err = cluster.checkUpgradedDatabase(ctx, server, target)
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Rolling upgrade failed on %s: %s", server.URL, err)
+		cluster.StateMachine.AddState("ERR00094", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00094"], target, server.URL, err), ErrFrom: "TOPO", ServerUrl: server.URL})
+		return err
+	}
+	if server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	cluster.LogPrintf(LvlInfo, "Rolling upgrade server %s upgraded to %s", server.URL, server.GetDBVersionNumber())
+	return nil
+}
+
+// upgradeDatabase stop the server, install the target with the upgrade
+// script, restart it and upgrade the system tables. The system tables are
+// marked upgraded before mysql_upgrade, or before the start for MySQL that
+// upgrades its data dictionary at startup, a rollback is refused from then.
+func (cluster *Cluster) upgradeDatabase(ctx context.Context, wf *Workflow, server *ServerMonitor, target string) error {
+	if !server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	if !server.IsDown() {
+		cluster.setWorkflowParam(wf, "stopped-"+server.Id, "true")
+		err := cluster.StopDatabaseService(server)
+		if err != nil {
+			return fmt.Errorf("Stop failed %s", err)
+		}
+		err = cluster.WaitDatabaseFailed(server)
+		if err != nil {
+			return fmt.Errorf("Server does not transit failed %s", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	err := cluster.UpgradeDatabaseScript(server, target)
+	if err != nil {
+		return fmt.Errorf("Upgrade script failed %s", err)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if server.DBVersion != nil && server.DBVersion.IsMySQLOrPercona() {
+		cluster.setWorkflowParam(wf, "system-"+server.Id, "true")
+	}
+	err = cluster.StartDatabaseWaitRejoin(server)
+	if err != nil {
+		return fmt.Errorf("Server does not restart %s", err)
+	}
+	cluster.setWorkflowParam(wf, "stopped-"+server.Id, "")
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	cluster.setWorkflowParam(wf, "system-"+server.Id, "true")
+	return cluster.MysqlUpgrade(server)
+}
+
+// MysqlUpgrade run mysql_upgrade or mariadb-upgrade, MySQL 8.0.16 and
+// later upgrade the system tables at startup
+func (cluster *Cluster) MysqlUpgrade(server *ServerMonitor) error {
+	if server.DBVersion != nil && server.DBVersion.IsMySQLOrPercona() && server.DBVersion.Greater(dbhelper.MySQLVersion{Major: 8, Minor: 0, Release: 15}) {
+		cluster.LogPrintf(LvlInfo, "Skip mysql_upgrade on %s, system tables are upgraded at startup", server.URL)
+		return nil
+	}
+	if _, err := os.Stat(cluster.GetMysqlUpgradePath()); os.IsNotExist(err) {
+		return fmt.Errorf("File does not exist %s", cluster.GetMysqlUpgradePath())
+	}
+	// the password is read from a client conf file, not the command line
+	file, err := cluster.CreateTmpClientConfFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	upgradeCmd := exec.Command(cluster.GetMysqlUpgradePath(), `--defaults-extra-file=`+file, `--host=`+misc.Unbracket(server.Host), `--port=`+server.Port, `--user=`+cluster.GetDbUser())
+	cluster.LogPrintf(LvlInfo, "%s", upgradeCmd.String())
+	out, err := upgradeCmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mysql_upgrade failed %s %s", err, out)
+	}
+	return nil
+}
+
+// checkUpgradedDatabase wait for the upgraded server to replicate within
+// prov-db-upgrade-max-delay and to run the target version
+func (cluster *Cluster) checkUpgradedDatabase(ctx context.Context, server *ServerMonitor, target string) error {
+	if cluster.master != nil && server.Id != cluster.master.Id {
+		server.WaitSyncToMaster(cluster.master)
+	}
+	var err error
+	for exitloop := int64(0); exitloop < cluster.Conf.MonitorWaitRetry; exitloop++ {
+		err = cluster.getUpgradeHealthError(server, target)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(cluster.Conf.MonitoringTicker) * time.Second):
+		}
+	}
+	return err
+}
+
+func (cluster *Cluster) getUpgradeHealthError(server *ServerMonitor, target string) error {
+	if server.IsDown() {
+		return errors.New("Server is down")
+	}
+	if upgradeVersionRegexp.MatchString(target) {
+		version := server.GetDBVersionNumber()
+		if version != target && !strings.HasPrefix(version, target+".") {
+			return fmt.Errorf("Server runs %s", version)
+		}
+	}
+	if server.HasReplicationIssueVersion() {
+		server.CheckVersion()
+		return errors.New("Server version has a replication issue")
+	}
+	if cluster.master == nil || server.Id == cluster.master.Id {
+		return nil
+	}
+	if !server.IsIOThreadRunning() || !server.IsSQLThreadRunning() {
+		return errors.New("Replication is not running")
+	}
+	if delay := server.GetReplicationDelay(); delay > cluster.Conf.ProvDbUpgradeMaxDelay {
+		return fmt.Errorf("Replication delay %d is above %d", delay, cluster.Conf.ProvDbUpgradeMaxDelay)
+	}
+	return nil
+}
+
+// rollbackRollingUpgradeServer reinstall the version a server had before the
+// upgrade, once its system tables are upgraded the previous version can not
+// run them and the server has to be restored from a backup
+func (cluster *Cluster) rollbackRollingUpgradeServer(wf *Workflow, id string) error {
+	server := cluster.GetServerFromName(id)
+	if server == nil {
+		return nil
+	}
+	from := wf.getParam("from-" + id)
+	if !server.IsDown() && server.GetDBVersionNumber() == from {
+		// failed before the server was stopped
+		if server.IsMaintenance {
+			server.SwitchMaintenance()
+		}
+		return nil
+	}
+	if wf.getParam("system-"+id) != "" {
+		return fmt.Errorf("System tables of %s are upgraded, restore it from a backup", server.URL)
+	}
+	if from == "" {
+		return fmt.Errorf("No version before upgrade of %s", server.URL)
+	}
+	err := cluster.switchoverRollingUpgrade(id)
+	if err != nil {
+		return err
+	}
+	cluster.LogPrintf(LvlInfo, "Rolling upgrade rollback of %s to %s", server.URL, from)
+	if !server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	if !server.IsDown() {
+		cluster.setWorkflowParam(wf, "stopped-"+id, "true")
+		err = cluster.StopDatabaseService(server)
+		if err != nil {
+			return fmt.Errorf("Stop failed %s", err)
+		}
+		err = cluster.WaitDatabaseFailed(server)
+		if err != nil {
+			return fmt.Errorf("Server does not transit failed %s", err)
+		}
+	}
+	err = cluster.UpgradeDatabaseScript(server, from)
+	if err != nil {
+		return fmt.Errorf("Upgrade script failed %s", err)
+	}
+	err = cluster.StartDatabaseWaitRejoin(server)
+	if err != nil {
+		return fmt.Errorf("Server does not restart %s", err)
+	}
+	cluster.setWorkflowParam(wf, "stopped-"+id, "")
+	err = cluster.checkUpgradedDatabase(context.Background(), server, from)
+	if err != nil {
+		// keep the server in maintenance
+		return err
+	}
+	if server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	return nil
+}
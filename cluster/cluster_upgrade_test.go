@@ -0,0 +1,133 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+func newUpgradeTestServer(cluster *Cluster, id string, state string, release int) *ServerMonitor {
+	return &ServerMonitor{Id: id, URL: id + ":3306", State: state, ClusterGroup: cluster,
+		DBVersion: &dbhelper.MySQLVersion{Flavor: "MariaDB", Major: 10, Minor: 5, Release: release},
+	}
+}
+
+func newUpgradeTestCluster(t *testing.T, dir string) *Cluster {
+	cluster := newWorkflowTestCluster(t, dir)
+	cluster.Conf.ProvDbUpgradeScript = "/bin/true"
+	master := newUpgradeTestServer(cluster, "db1", stateMaster, 9)
+	cluster.slaves = serverList{newUpgradeTestServer(cluster, "db2", stateSlave, 9), newUpgradeTestServer(cluster, "db3", stateFailed, 9)}
+	cluster.master = master
+	cluster.Servers = append(serverList{master}, cluster.slaves...)
+	return cluster
+}
+
+func TestRollingUpgradePlan(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newUpgradeTestCluster(t, dir)
+
+	if _, err := cluster.NewRollingUpgrade(""); err == nil {
+		t.Error("Expected a rolling upgrade without target to be refused")
+	}
+	wf, err := cluster.NewRollingUpgrade("10.6.12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range wf.Snapshot().Steps {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "upgrade-db2,switchover,upgrade-db1" {
+		t.Errorf("Expected the running replica, the switchover and the master, got %v", names)
+	}
+	params := wf.Snapshot().Params
+	if params["target"] != "10.6.12" || params["slaves"] != "db2" || params["from-db2"] != "10.5.9" || params["from-db1"] != "10.5.9" {
+		t.Errorf("Unexpected rolling upgrade params %v", params)
+	}
+	if wf.defs["upgrade-db2"].Retries >= 0 || wf.defs["upgrade-db2"].RollbackOnFailure {
+		t.Errorf("Expected an upgrade step without retry that pauses, got %+v", wf.defs["upgrade-db2"])
+	}
+	if _, err := cluster.NewRollingUpgrade("10.6.12"); err == nil {
+		t.Error("Expected a second rolling upgrade to be refused")
+	}
+	if got := cluster.GetRollingUpgrade(); got != wf {
+		t.Errorf("Expected the last rolling upgrade, got %+v", got)
+	}
+	if err := cluster.ResumeRollingUpgrade(); err == nil {
+		t.Error("Expected a running rolling upgrade not to be resumed")
+	}
+}
+
+// TestRollingUpgradeClaim start concurrent upgrades, a single one is planned
+func TestRollingUpgradeClaim(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newUpgradeTestCluster(t, dir)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var planned []*Workflow
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wf, err := cluster.NewRollingUpgrade("10.6.12"); err == nil {
+				mu.Lock()
+				planned = append(planned, wf)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(planned) != 1 || len(cluster.GetWorkflows()) != 1 {
+		t.Errorf("Expected a single rolling upgrade planned, got %d", len(planned))
+	}
+}
+
+func TestRollingUpgradeRollback(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newUpgradeTestCluster(t, dir)
+	cluster.Conf.ProvDbUpgradeOnFailure = "rollback"
+	wf, err := cluster.NewRollingUpgrade("10.6.12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wf.defs["upgrade-db2"].RollbackOnFailure {
+		t.Error("Expected the upgrade steps to roll back on failure")
+	}
+
+	// failed before the server was stopped, it only leaves maintenance
+	db2 := cluster.GetServerFromName("db2")
+	db2.IsMaintenance = true
+	if err := wf.defs["upgrade-db2"].Rollback(); err != nil || db2.IsMaintenance {
+		t.Errorf("Expected the untouched server out of maintenance, got %v %t", err, db2.IsMaintenance)
+	}
+
+	// upgraded system tables can not run the previous version
+	db2.DBVersion.Minor = 6
+	cluster.setWorkflowParam(wf, "system-db2", "true")
+	err = wf.defs["upgrade-db2"].Rollback()
+	if err == nil || !strings.Contains(err.Error(), "backup") {
+		t.Errorf("Expected the rollback of upgraded system tables refused, got %v", err)
+	}
+
+	// a rollback of the workflow pauses on it
+	wf.Steps[0].State = ConstStepFailed
+	cluster.rollbackWorkflow(wf)
+	if snap := wf.Snapshot(); snap.State != ConstWorkflowPaused || !strings.Contains(snap.Error, "upgrade-db2") {
+		t.Errorf("Expected the rollback paused on db2, got %s %s", snap.State, snap.Error)
+	}
+}
@@ -0,0 +1,656 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConstWorkflowRunning     = "running"
+	ConstWorkflowPaused      = "paused"
+	ConstWorkflowRollingBack = "rollingback"
+	ConstWorkflowCanceled    = "canceled"
+	ConstWorkflowDone        = "done"
+
+	ConstStepPending    = "pending"
+	ConstStepRunning    = "running"
+	ConstStepDone       = "done"
+	ConstStepFailed     = "failed"
+	ConstStepRolledBack = "rolledback"
+)
+
+// WorkflowStep is the definition of a step, Run must be safe to call again
+// when the monitor stopped in the middle of it and must return when its
+// context is done. Retries and Timeout default to the monitoring-workflow-step
+// settings, negative Retries disable retries. A failed step pauses the
+// workflow, or rolls it back with RollbackOnFailure
+type WorkflowStep struct {
+	Name              string
+	DependsOn         []string
+	Retries           int
+	Timeout           time.Duration
+	RollbackOnFailure bool
+	Run               func(ctx context.Context) error
+	Rollback          func() error
+}
+
+// WorkflowStepStatus is the checkpoint of a step
+type WorkflowStepStatus struct {
+	Name      string    `json:"name"`
+	DependsOn []string  `json:"dependsOn"`
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended"`
+}
+
+// Workflow is a long running cluster operation made of a graph of steps,
+// its checkpoint is saved in the workflows directory of the cluster after
+// every step, the builder of its type recreates the steps from the params
+type Workflow struct {
+	Id      string                `json:"id"`
+	Type    string                `json:"type"`
+	Cluster string                `json:"cluster"`
+	Params  map[string]string     `json:"params"`
+	State   string                `json:"state"`
+	Error   string                `json:"error,omitempty"`
+	Started time.Time             `json:"started"`
+	Updated time.Time             `json:"updated"`
+	Ended   time.Time             `json:"ended"`
+	Steps   []*WorkflowStepStatus `json:"steps"`
+	defs    map[string]*WorkflowStep
+	request string
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+// WorkflowBuilder return the steps of a workflow type, params are filled on
+// the first call and are the only input on a resume
+type WorkflowBuilder func(cluster *Cluster, wf *Workflow) ([]*WorkflowStep, error)
+
+// workflowBuilders are the operations run as workflows, reseed and bootstrap
+// stay jobs of the donor and of the orchestrator and resharding a sequence of
+// proxy queries, they are not resumable yet
+var workflowBuilders = map[string]WorkflowBuilder{
+	"rolling-restart": buildRollingRestartWorkflow,
+	"rolling-reprov":  buildRollingReprovWorkflow,
+	"rolling-upgrade": buildRollingUpgradeWorkflow,
+}
+
+var errWorkflowInterrupted = errors.New("Workflow interrupted")
+
+func (cluster *Cluster) getWorkflowDir() string {
+	return cluster.WorkingDir + "/workflows"
+}
+
+// NewWorkflow build the steps of a workflow and save its first checkpoint,
+// a single workflow of a type is in progress at a time
+func (cluster *Cluster) NewWorkflow(typ string, params map[string]string) (*Workflow, error) {
+	if _, ok := workflowBuilders[typ]; !ok {
+		return nil, fmt.Errorf("Unknown workflow type %s", typ)
+	}
+	cluster.Lock()
+	err := cluster.checkWorkflowType(typ)
+	cluster.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = make(map[string]string)
+	}
+	now := time.Now()
+	wf := &Workflow{
+		Type:    typ,
+		Cluster: cluster.Name,
+		Params:  params,
+		State:   ConstWorkflowRunning,
+		Started: now,
+	}
+	err = cluster.buildWorkflow(wf)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Lock()
+	// claimed by a concurrent request while building
+	if err := cluster.checkWorkflowType(typ); err != nil {
+		cluster.Unlock()
+		return nil, err
+	}
+	if cluster.workflows == nil {
+		cluster.workflows = make(map[string]*Workflow)
+	}
+	for wf.Id == "" || cluster.workflows[wf.Id] != nil {
+		wf.Id = typ + "." + now.Format("20060102150405.000000")
+		now = now.Add(time.Microsecond)
+	}
+	cluster.workflows[wf.Id] = wf
+	cluster.Unlock()
+	cluster.saveWorkflow(wf)
+	return wf, nil
+}
+
+// checkWorkflowType return an error when a workflow of the type is in
+// progress, the cluster lock is held by the caller
+func (cluster *Cluster) checkWorkflowType(typ string) error {
+	for _, w := range cluster.workflows {
+		if w.Type == typ && w.IsInProgress() {
+			return fmt.Errorf("Workflow %s %s is %s", typ, w.Id, w.getState())
+		}
+	}
+	return nil
+}
+
+func (cluster *Cluster) buildWorkflow(wf *Workflow) error {
+	steps, err := workflowBuilders[wf.Type](cluster, wf)
+	if err != nil {
+		return err
+	}
+	wf.defs = make(map[string]*WorkflowStep)
+	status := make(map[string]*WorkflowStepStatus)
+	for _, s := range wf.Steps {
+		status[s.Name] = s
+	}
+	var list []*WorkflowStepStatus
+	for _, step := range steps {
+		if step.Retries == 0 {
+			step.Retries = cluster.Conf.MonitorWorkflowStepRetries
+		}
+		if step.Timeout == 0 {
+			step.Timeout = time.Duration(cluster.Conf.MonitorWorkflowStepTimeout) * time.Second
+		}
+		wf.defs[step.Name] = step
+		s, ok := status[step.Name]
+		if !ok {
+			s = &WorkflowStepStatus{Name: step.Name, DependsOn: step.DependsOn, State: ConstStepPending}
+		}
+		list = append(list, s)
+	}
+	wf.Steps = list
+	return nil
+}
+
+// RunWorkflow execute the workflow and return when it is done, paused,
+// canceled or interrupted by a standby transition of the monitor
+func (cluster *Cluster) RunWorkflow(wf *Workflow) error {
+	wf.mu.Lock()
+	if wf.done != nil {
+		wf.mu.Unlock()
+		return fmt.Errorf("Workflow %s is already executing", wf.Id)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wf.cancel = cancel
+	wf.done = make(chan struct{})
+	wf.request = ""
+	wf.mu.Unlock()
+	defer func() {
+		cancel()
+		wf.mu.Lock()
+		close(wf.done)
+		wf.done = nil
+		wf.cancel = nil
+		wf.mu.Unlock()
+	}()
+
+	if wf.getState() == ConstWorkflowRollingBack {
+		return cluster.rollbackWorkflow(wf)
+	}
+	cluster.LogPrintf(LvlInfo, "Workflow %s running", wf.Id)
+	for {
+		switch wf.getRequest() {
+		case ConstWorkflowPaused:
+			cluster.setWorkflowState(wf, ConstWorkflowPaused, "")
+			cluster.LogPrintf(LvlInfo, "Workflow %s paused", wf.Id)
+			return nil
+		case ConstWorkflowCanceled:
+			return cluster.rollbackWorkflow(wf)
+		}
+		if !cluster.IsActive() {
+			// the checkpoint stay running for the monitor taking over
+			cluster.LogPrintf(LvlInfo, "Workflow %s interrupted, monitor is not active", wf.Id)
+			return errWorkflowInterrupted
+		}
+		step, err := wf.nextStep()
+		if err != nil {
+			cluster.setWorkflowState(wf, ConstWorkflowPaused, err.Error())
+			return err
+		}
+		if step == nil {
+			cluster.setWorkflowState(wf, ConstWorkflowDone, "")
+			cluster.LogPrintf(LvlInfo, "Workflow %s done", wf.Id)
+			cluster.purgeWorkflows()
+			return nil
+		}
+		err = cluster.runWorkflowStep(ctx, wf, step)
+		if err != nil && wf.getRequest() != ConstWorkflowCanceled && wf.defs[step.Name].RollbackOnFailure {
+			cluster.LogPrintf(LvlErr, "Workflow %s failed on step %s: %s", wf.Id, step.Name, err)
+			cluster.rollbackWorkflow(wf)
+			return err
+		}
+		if err != nil && wf.getRequest() != ConstWorkflowCanceled {
+			cluster.setWorkflowState(wf, ConstWorkflowPaused, fmt.Sprintf("Step %s: %s", step.Name, err))
+			cluster.LogPrintf(LvlErr, "Workflow %s paused on step %s: %s", wf.Id, step.Name, err)
+			return err
+		}
+	}
+}
+
+func (cluster *Cluster) runWorkflowStep(ctx context.Context, wf *Workflow, status *WorkflowStepStatus) error {
+	def := wf.defs[status.Name]
+	retries := def.Retries
+	if retries < 0 {
+		retries = 0
+	}
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		wf.mu.Lock()
+		status.State = ConstStepRunning
+		status.Attempts++
+		status.Error = ""
+		status.Started = time.Now()
+		wf.mu.Unlock()
+		cluster.saveWorkflow(wf)
+		cluster.LogPrintf(LvlInfo, "Workflow %s step %s attempt %d", wf.Id, status.Name, status.Attempts)
+
+		err = runStepAttempt(ctx, def)
+
+		wf.mu.Lock()
+		status.Ended = time.Now()
+		if err == nil {
+			status.State = ConstStepDone
+		} else {
+			status.State = ConstStepFailed
+			status.Error = err.Error()
+		}
+		wf.mu.Unlock()
+		cluster.saveWorkflow(wf)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		cluster.LogPrintf(LvlWarn, "Workflow %s step %s failed: %s", wf.Id, status.Name, err)
+	}
+	return err
+}
+
+// runStepAttempt run a step with a context done after its timeout, the
+// attempt ends when the step returns so that a retry or a rollback never
+// overlaps a step still running
+func runStepAttempt(ctx context.Context, def *WorkflowStep) error {
+	sctx, cancel := context.WithTimeout(ctx, def.Timeout)
+	defer cancel()
+	err := def.Run(sctx)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if sctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timeout after %s: %s", def.Timeout, err)
+	}
+	return err
+}
+
+// rollbackWorkflow undo the done steps in reverse order
+func (cluster *Cluster) rollbackWorkflow(wf *Workflow) error {
+	cluster.setWorkflowState(wf, ConstWorkflowRollingBack, "")
+	cluster.LogPrintf(LvlInfo, "Workflow %s rolling back", wf.Id)
+	for i := len(wf.Steps) - 1; i >= 0; i-- {
+		status := wf.Steps[i]
+		if status.State != ConstStepDone && status.State != ConstStepFailed {
+			continue
+		}
+		def := wf.defs[status.Name]
+		if def.Rollback != nil {
+			err := def.Rollback()
+			if err != nil {
+				cluster.setWorkflowState(wf, ConstWorkflowPaused, fmt.Sprintf("Rollback step %s: %s", status.Name, err))
+				cluster.LogPrintf(LvlErr, "Workflow %s rollback of step %s failed: %s", wf.Id, status.Name, err)
+				return err
+			}
+		}
+		wf.mu.Lock()
+		status.State = ConstStepRolledBack
+		wf.mu.Unlock()
+		cluster.saveWorkflow(wf)
+	}
+	cluster.setWorkflowState(wf, ConstWorkflowCanceled, "")
+	cluster.LogPrintf(LvlInfo, "Workflow %s canceled", wf.Id)
+	cluster.purgeWorkflows()
+	return nil
+}
+
+// nextStep return the first pending step with all its dependencies done
+func (wf *Workflow) nextStep() (*WorkflowStepStatus, error) {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	done := make(map[string]bool)
+	for _, s := range wf.Steps {
+		done[s.Name] = s.State == ConstStepDone
+	}
+	pending := false
+	for _, s := range wf.Steps {
+		if s.State == ConstStepDone {
+			continue
+		}
+		pending = true
+		ready := true
+		for _, d := range s.DependsOn {
+			if !done[d] {
+				ready = false
+			}
+		}
+		if ready {
+			return s, nil
+		}
+	}
+	if pending {
+		return nil, errors.New("No step can run, dependencies are not done")
+	}
+	return nil, nil
+}
+
+func (wf *Workflow) getState() string {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	return wf.State
+}
+
+func (wf *Workflow) getRequest() string {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	return wf.request
+}
+
+func (wf *Workflow) getParam(key string) string {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	return wf.Params[key]
+}
+
+// setWorkflowParam save a value of a step in the checkpoint, an empty value
+// delete it
+func (cluster *Cluster) setWorkflowParam(wf *Workflow, key string, value string) {
+	wf.mu.Lock()
+	if value == "" {
+		delete(wf.Params, key)
+	} else {
+		wf.Params[key] = value
+	}
+	wf.mu.Unlock()
+	cluster.saveWorkflow(wf)
+}
+
+func (wf *Workflow) IsInProgress() bool {
+	state := wf.getState()
+	return state == ConstWorkflowRunning || state == ConstWorkflowPaused || state == ConstWorkflowRollingBack
+}
+
+func (wf *Workflow) IsExecuting() bool {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	return wf.done != nil
+}
+
+// Snapshot return a copy of the checkpoint for the API and replication
+func (wf *Workflow) Snapshot() *Workflow {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	s := &Workflow{
+		Id:      wf.Id,
+		Type:    wf.Type,
+		Cluster: wf.Cluster,
+		Params:  make(map[string]string),
+		State:   wf.State,
+		Error:   wf.Error,
+		Started: wf.Started,
+		Updated: wf.Updated,
+		Ended:   wf.Ended,
+	}
+	for k, v := range wf.Params {
+		s.Params[k] = v
+	}
+	for _, step := range wf.Steps {
+		st := *step
+		s.Steps = append(s.Steps, &st)
+	}
+	return s
+}
+
+func (cluster *Cluster) setWorkflowState(wf *Workflow, state string, reason string) {
+	wf.mu.Lock()
+	wf.State = state
+	wf.Error = reason
+	if state == ConstWorkflowDone || state == ConstWorkflowCanceled {
+		wf.Ended = time.Now()
+	}
+	wf.mu.Unlock()
+	cluster.saveWorkflow(wf)
+}
+
+func (cluster *Cluster) saveWorkflow(wf *Workflow) {
+	wf.mu.Lock()
+	wf.Updated = time.Now()
+	wf.mu.Unlock()
+	cluster.writeWorkflow(wf.Snapshot())
+}
+
+func (cluster *Cluster) writeWorkflow(s *Workflow) {
+	dir := cluster.getWorkflowDir()
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		saveJson, _ := json.MarshalIndent(s, "", "\t")
+		err = ioutil.WriteFile(dir+"/"+s.Id+".json", saveJson, 0644)
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save workflow %s: %s", s.Id, err)
+	}
+}
+
+// loadWorkflows read the checkpoints of the working dir at startup
+func (cluster *Cluster) loadWorkflows() {
+	files, err := ioutil.ReadDir(cluster.getWorkflowDir())
+	if err != nil {
+		return
+	}
+	cluster.Lock()
+	defer cluster.Unlock()
+	cluster.workflows = make(map[string]*Workflow)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		content, err := ioutil.ReadFile(cluster.getWorkflowDir() + "/" + file.Name())
+		if err != nil {
+			continue
+		}
+		wf := new(Workflow)
+		if json.Unmarshal(content, wf) == nil {
+			cluster.workflows[wf.Id] = wf
+		}
+	}
+}
+
+// purgeWorkflows keep the monitoring-workflow-keep most recent finished
+// workflows
+func (cluster *Cluster) purgeWorkflows() {
+	var finished []*Workflow
+	for _, wf := range cluster.GetWorkflows() {
+		if !wf.IsInProgress() {
+			finished = append(finished, wf)
+		}
+	}
+	if len(finished) <= cluster.Conf.MonitorWorkflowKeep {
+		return
+	}
+	cluster.Lock()
+	defer cluster.Unlock()
+	for _, wf := range finished[cluster.Conf.MonitorWorkflowKeep:] {
+		delete(cluster.workflows, wf.Id)
+		os.Remove(cluster.getWorkflowDir() + "/" + wf.Id + ".json")
+	}
+}
+
+// GetWorkflows return the workflows, most recent first
+func (cluster *Cluster) GetWorkflows() []*Workflow {
+	cluster.Lock()
+	list := make([]*Workflow, 0, len(cluster.workflows))
+	for _, wf := range cluster.workflows {
+		list = append(list, wf)
+	}
+	cluster.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.After(list[j].Started) })
+	return list
+}
+
+func (cluster *Cluster) GetWorkflow(id string) *Workflow {
+	cluster.Lock()
+	defer cluster.Unlock()
+	return cluster.workflows[id]
+}
+
+// ResumeWorkflows restart the workflows left running or rolling back by a
+// monitor restart or by the previous raft leader
+func (cluster *Cluster) ResumeWorkflows() {
+	if !cluster.IsActive() {
+		return
+	}
+	for _, wf := range cluster.GetWorkflows() {
+		state := wf.getState()
+		if (state != ConstWorkflowRunning && state != ConstWorkflowRollingBack) || wf.IsExecuting() {
+			continue
+		}
+		cluster.LogPrintf(LvlInfo, "Resume workflow %s", wf.Id)
+		go cluster.resumeWorkflow(wf)
+	}
+}
+
+func (cluster *Cluster) resumeWorkflow(wf *Workflow) error {
+	if wf.defs == nil {
+		err := cluster.buildWorkflow(wf)
+		if err != nil {
+			cluster.setWorkflowState(wf, ConstWorkflowPaused, err.Error())
+			return err
+		}
+	}
+	wf.mu.Lock()
+	for _, s := range wf.Steps {
+		// interrupted in the middle of a step, run it again
+		if s.State == ConstStepRunning {
+			s.State = ConstStepPending
+		}
+	}
+	wf.mu.Unlock()
+	return cluster.RunWorkflow(wf)
+}
+
+// PauseWorkflow stop the workflow after the running step
+func (cluster *Cluster) PauseWorkflow(id string) error {
+	wf := cluster.GetWorkflow(id)
+	if wf == nil {
+		return fmt.Errorf("Workflow %s not found", id)
+	}
+	if wf.getState() != ConstWorkflowRunning {
+		return fmt.Errorf("Workflow %s is %s", id, wf.getState())
+	}
+	wf.mu.Lock()
+	wf.request = ConstWorkflowPaused
+	wf.mu.Unlock()
+	if !wf.IsExecuting() {
+		cluster.setWorkflowState(wf, ConstWorkflowPaused, "")
+	}
+	return nil
+}
+
+func (cluster *Cluster) ResumeWorkflow(id string) error {
+	wf := cluster.GetWorkflow(id)
+	if wf == nil {
+		return fmt.Errorf("Workflow %s not found", id)
+	}
+	if wf.getState() != ConstWorkflowPaused || wf.IsExecuting() {
+		return fmt.Errorf("Workflow %s is %s", id, wf.getState())
+	}
+	cluster.setWorkflowState(wf, ConstWorkflowRunning, "")
+	go cluster.resumeWorkflow(wf)
+	return nil
+}
+
+// CancelWorkflow interrupt the running step and roll back the done steps
+func (cluster *Cluster) CancelWorkflow(id string) error {
+	wf := cluster.GetWorkflow(id)
+	if wf == nil {
+		return fmt.Errorf("Workflow %s not found", id)
+	}
+	if !wf.IsInProgress() {
+		return fmt.Errorf("Workflow %s is %s", id, wf.getState())
+	}
+	wf.mu.Lock()
+	wf.request = ConstWorkflowCanceled
+	if wf.cancel != nil {
+		wf.cancel()
+	}
+	executing := wf.done != nil
+	wf.mu.Unlock()
+	if !executing {
+		if wf.defs == nil {
+			err := cluster.buildWorkflow(wf)
+			if err != nil {
+				return err
+			}
+		}
+		go cluster.rollbackWorkflow(wf)
+	}
+	return nil
+}
+
+// CancelWorkflowType cancel the workflows in progress of a type
+func (cluster *Cluster) CancelWorkflowType(typ string) {
+	for _, wf := range cluster.GetWorkflows() {
+		if wf.Type == typ && wf.IsInProgress() {
+			cluster.CancelWorkflow(wf.Id)
+		}
+	}
+}
+
+// setReplicatedWorkflows save the checkpoints received from the raft leader
+// when they changed
+func (cluster *Cluster) setReplicatedWorkflows(workflows []*Workflow) {
+	for _, rwf := range workflows {
+		wf := cluster.GetWorkflow(rwf.Id)
+		if wf != nil && (wf.IsExecuting() || !wf.Snapshot().Updated.Before(rwf.Updated)) {
+			continue
+		}
+		cluster.Lock()
+		if cluster.workflows == nil {
+			cluster.workflows = make(map[string]*Workflow)
+		}
+		cluster.workflows[rwf.Id] = rwf
+		cluster.Unlock()
+		cluster.writeWorkflow(rwf)
+	}
+}
+
+// getReplicatedWorkflows return the checkpoints of all the workflows, the
+// finished ones tell the followers not to resume them
+func (cluster *Cluster) getReplicatedWorkflows() []*Workflow {
+	var list []*Workflow
+	for _, wf := range cluster.GetWorkflows() {
+		list = append(list, wf.Snapshot())
+	}
+	return list
+}
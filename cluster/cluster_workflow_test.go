@@ -0,0 +1,322 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWorkflowSteps are the steps of the test workflow type
+var testWorkflowSteps func(wf *Workflow) []*WorkflowStep
+
+func init() {
+	workflowBuilders["test"] = func(cluster *Cluster, wf *Workflow) ([]*WorkflowStep, error) {
+		return testWorkflowSteps(wf), nil
+	}
+}
+
+func newWorkflowTestCluster(t *testing.T, dir string) *Cluster {
+	cluster := &Cluster{Name: "c1", WorkingDir: dir, Status: ConstMonitorActif}
+	cluster.Conf.MonitorWorkflowStepRetries = 1
+	cluster.Conf.MonitorWorkflowStepTimeout = 3600
+	cluster.Conf.MonitorWorkflowKeep = 20
+	return cluster
+}
+
+func newWorkflowTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "workflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// stepRecorder keep the order of the calls of the steps
+type stepRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *stepRecorder) add(name string) {
+	r.mu.Lock()
+	r.calls = append(r.calls, name)
+	r.mu.Unlock()
+}
+
+func (r *stepRecorder) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.calls, ",")
+}
+
+func (r *stepRecorder) step(name string, dependsOn ...string) *WorkflowStep {
+	return &WorkflowStep{
+		Name:      name,
+		DependsOn: dependsOn,
+		Run: func(ctx context.Context) error {
+			r.add(name)
+			return nil
+		},
+		Rollback: func() error {
+			r.add("rollback-" + name)
+			return nil
+		},
+	}
+}
+
+func getStepStatus(wf *Workflow, name string) *WorkflowStepStatus {
+	for _, s := range wf.Snapshot().Steps {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestWorkflowOrder(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newWorkflowTestCluster(t, dir)
+	r := new(stepRecorder)
+	testWorkflowSteps = func(wf *Workflow) []*WorkflowStep {
+		return []*WorkflowStep{r.step("c", "a", "b"), r.step("b", "a"), r.step("a")}
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		wf, err := cluster.NewWorkflow("test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cluster.RunWorkflow(wf); err != nil {
+			t.Fatal(err)
+		}
+		if wf.getState() != ConstWorkflowDone {
+			t.Fatalf("Expected workflow done, got %s", wf.getState())
+		}
+		ids = append(ids, wf.Id)
+	}
+	if calls := r.get(); calls != "a,b,c,a,b,c,a,b,c" {
+		t.Errorf("Expected the steps to run after their dependencies, got %s", calls)
+	}
+	if ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Errorf("Expected distinct workflow ids, got %v", ids)
+	}
+	for _, id := range ids {
+		if _, err := os.Stat(cluster.getWorkflowDir() + "/" + id + ".json"); err != nil {
+			t.Errorf("Expected a checkpoint of %s: %s", id, err)
+		}
+	}
+}
+
+func TestWorkflowRetry(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newWorkflowTestCluster(t, dir)
+	failures := 1
+	r := new(stepRecorder)
+	testWorkflowSteps = func(wf *Workflow) []*WorkflowStep {
+		flaky := r.step("flaky")
+		flaky.Run = func(ctx context.Context) error {
+			r.add("flaky")
+			if failures > 0 {
+				failures--
+				return errors.New("flaky failure")
+			}
+			return nil
+		}
+		return []*WorkflowStep{flaky, r.step("next", "flaky")}
+	}
+	wf, err := cluster.NewWorkflow("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.RunWorkflow(wf); err != nil {
+		t.Fatal(err)
+	}
+	if s := getStepStatus(wf, "flaky"); s.State != ConstStepDone || s.Attempts != 2 {
+		t.Errorf("Expected the step done on its second attempt, got %+v", s)
+	}
+
+	// out of retries the workflow pauses before the next step
+	failures = 2
+	r = new(stepRecorder)
+	wf, err = cluster.NewWorkflow("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.RunWorkflow(wf); err == nil {
+		t.Fatal("Expected the workflow to fail")
+	}
+	snap := wf.Snapshot()
+	if snap.State != ConstWorkflowPaused || !strings.Contains(snap.Error, "flaky failure") {
+		t.Errorf("Expected the workflow paused on the step error, got %s %s", snap.State, snap.Error)
+	}
+	if calls := r.get(); calls != "flaky,flaky" {
+		t.Errorf("Expected one retry and no next step, got %s", calls)
+	}
+
+	// resumed, the step gets its retries again
+	if err := cluster.resumeWorkflow(wf); err != nil {
+		t.Fatal(err)
+	}
+	if wf.getState() != ConstWorkflowDone || r.get() != "flaky,flaky,flaky,next" {
+		t.Errorf("Expected the resumed workflow done, got %s %s", wf.getState(), r.get())
+	}
+}
+
+func TestWorkflowTimeout(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newWorkflowTestCluster(t, dir)
+	var mu sync.Mutex
+	running, overlap, attempts := 0, false, 0
+	testWorkflowSteps = func(wf *Workflow) []*WorkflowStep {
+		return []*WorkflowStep{{
+			Name:    "slow",
+			Timeout: 20 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				mu.Lock()
+				running++
+				overlap = overlap || running > 1
+				attempts++
+				first := attempts == 1
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					running--
+					mu.Unlock()
+				}()
+				if !first {
+					return nil
+				}
+				// the step ends its current phase before it returns
+				<-ctx.Done()
+				time.Sleep(50 * time.Millisecond)
+				return ctx.Err()
+			},
+		}}
+	}
+	wf, err := cluster.NewWorkflow("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.RunWorkflow(wf); err != nil {
+		t.Fatal(err)
+	}
+	if overlap {
+		t.Error("Expected the retry to wait for the timed out attempt")
+	}
+	if s := getStepStatus(wf, "slow"); s.State != ConstStepDone || s.Attempts != 2 {
+		t.Errorf("Expected the step done after a timeout, got %+v", s)
+	}
+}
+
+func TestWorkflowResume(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newWorkflowTestCluster(t, dir)
+	r := new(stepRecorder)
+	testWorkflowSteps = func(wf *Workflow) []*WorkflowStep {
+		first := r.step("first")
+		first.Run = func(ctx context.Context) error {
+			r.add("first")
+			// the monitor leaves the active state
+			cluster.Status = ConstMonitorStandby
+			return nil
+		}
+		return []*WorkflowStep{first, r.step("second", "first"), r.step("third", "second")}
+	}
+	wf, err := cluster.NewWorkflow("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.RunWorkflow(wf); err != errWorkflowInterrupted {
+		t.Fatalf("Expected the workflow interrupted, got %v", err)
+	}
+	// the monitor stopped in the middle of the second step
+	snap := wf.Snapshot()
+	snap.Steps[1].State = ConstStepRunning
+	cluster.writeWorkflow(snap)
+
+	restarted := newWorkflowTestCluster(t, dir)
+	restarted.loadWorkflows()
+	resumed := restarted.GetWorkflow(wf.Id)
+	if resumed == nil || resumed.getState() != ConstWorkflowRunning {
+		t.Fatalf("Expected the running workflow loaded from its checkpoint, got %+v", resumed)
+	}
+	if err := restarted.resumeWorkflow(resumed); err != nil {
+		t.Fatal(err)
+	}
+	if calls := r.get(); calls != "first,second,third" {
+		t.Errorf("Expected the resume to start at the interrupted step, got %s", calls)
+	}
+	if s := getStepStatus(resumed, "second"); s.State != ConstStepDone || s.Attempts != 1 {
+		t.Errorf("Expected the interrupted step run again, got %+v", s)
+	}
+	if resumed.getState() != ConstWorkflowDone {
+		t.Errorf("Expected the resumed workflow done, got %s", resumed.getState())
+	}
+}
+
+func TestWorkflowCancel(t *testing.T) {
+	dir := newWorkflowTestDir(t)
+	defer os.RemoveAll(dir)
+	cluster := newWorkflowTestCluster(t, dir)
+	r := new(stepRecorder)
+	started := make(chan struct{})
+	testWorkflowSteps = func(wf *Workflow) []*WorkflowStep {
+		block := r.step("block", "first")
+		block.Run = func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return []*WorkflowStep{r.step("first"), block, r.step("last", "block")}
+	}
+	wf, err := cluster.NewWorkflow("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make(chan error, 1)
+	go func() {
+		res <- cluster.RunWorkflow(wf)
+	}()
+	<-started
+	if err := cluster.CancelWorkflow(wf.Id); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-res:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the canceled workflow to return")
+	}
+	if calls := r.get(); calls != "first,rollback-block,rollback-first" {
+		t.Errorf("Expected the steps rolled back in reverse order, got %s", calls)
+	}
+	if s := getStepStatus(wf, "last"); s.State != ConstStepPending {
+		t.Errorf("Expected the last step not run, got %+v", s)
+	}
+	if wf.getState() != ConstWorkflowCanceled {
+		t.Errorf("Expected workflow canceled, got %s", wf.getState())
+	}
+	if err := cluster.CancelWorkflow(wf.Id); err == nil {
+		t.Error("Expected a finished workflow not to be canceled again")
+	}
+}
@@ -9,12 +9,17 @@
 package cluster
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/signal18/replication-manager/utils/gtid"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Crash will store informations on a crash based on the replication stream
@@ -85,6 +90,10 @@ func (crash *Crash) Save(path string) error {
 }
 
 func (crash *Crash) Purge(path string, keep int) error {
+	return purgeFailoverFiles(path, keep)
+}
+
+func purgeFailoverFiles(path string, keep int) error {
 	drop := make(map[string]int)
 
 	files, err := ioutil.ReadDir(path)
@@ -107,3 +116,206 @@ func (crash *Crash) Purge(path string, keep int) error {
 	}
 	return nil
 }
+
+// Trackpos is one row of the failover election table, SkipReasons tell why a
+// candidate was not considered
+type Trackpos struct {
+	URL                string
+	Indice             int
+	Pos                uint64
+	Seq                uint64
+	Prefered           bool
+	Ignoredconf        bool
+	Ignoredrelay       bool
+	Ignoredmultimaster bool
+	Ignoredreplication bool
+	Weight             uint
+	DelayStat          DelayStat
+	SkipReasons        []string
+	Vetoed             bool
+	Score              float64
+	Scores             []ElectionScore
+}
+
+// FailoverPhase time one step of a failover or switchover
+type FailoverPhase struct {
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+type FailoverProxyResult struct {
+	Type       string `json:"type"`
+	URL        string `json:"url"`
+	State      string `json:"state"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// FailoverReport describe a failover or switchover once it is over
+// swagger:response failoverReport
+type FailoverReport struct {
+	Id                    string                `json:"id"`
+	Type                  string                `json:"type"`
+	Cluster               string                `json:"cluster"`
+	Start                 time.Time             `json:"start"`
+	End                   time.Time             `json:"end"`
+	DurationMs            int64                 `json:"durationMs"`
+	WriteBlockedMs        int64                 `json:"writeBlockedMs"`
+	Success               bool                  `json:"success"`
+	Error                 string                `json:"error,omitempty"`
+	OldMaster             string                `json:"oldMaster"`
+	NewMaster             string                `json:"newMaster"`
+	FailoverMasterLogFile string                `json:"failoverMasterLogFile"`
+	FailoverMasterLogPos  string                `json:"failoverMasterLogPos"`
+	FailoverIOGtid        string                `json:"failoverIOGtid"`
+	NewMasterGtid         string                `json:"newMasterGtid"`
+	Phases                []FailoverPhase       `json:"phases"`
+	Election              []Trackpos            `json:"election"`
+	Proxies               []FailoverProxyResult `json:"proxies"`
+	blockStart            time.Time
+	blockEnd              time.Time
+	rootCtx               context.Context
+	traceCtx              *atomic.Value
+	span                  trace.Span
+	phaseSpan             trace.Span
+}
+
+func newFailoverReport(cluster string, fail bool) *FailoverReport {
+	r := &FailoverReport{Cluster: cluster, Type: "switchover", Start: time.Now()}
+	if fail {
+		r.Type = "failover"
+		// the master is gone, writes are blocked since before the report starts
+		r.blockStart = r.Start
+	}
+	return r
+}
+
+// StartPhase close the running phase and open a new one
+func (r *FailoverReport) StartPhase(name string) {
+	r.endPhase()
+	r.Phases = append(r.Phases, FailoverPhase{Name: name, Start: time.Now()})
+	r.startPhaseTrace(name)
+}
+
+func (r *FailoverReport) endPhase() {
+	if len(r.Phases) == 0 {
+		return
+	}
+	p := &r.Phases[len(r.Phases)-1]
+	if p.DurationMs == 0 {
+		p.DurationMs = time.Since(p.Start).Milliseconds()
+	}
+	r.endPhaseTrace()
+}
+
+// BlockWrites and UnblockWrites mark the window where no master accept writes
+func (r *FailoverReport) BlockWrites() {
+	if r.blockStart.IsZero() {
+		r.blockStart = time.Now()
+	}
+}
+
+func (r *FailoverReport) UnblockWrites() {
+	if !r.blockStart.IsZero() && r.blockEnd.IsZero() {
+		r.blockEnd = time.Now()
+	}
+}
+
+func (r *FailoverReport) Finish(success bool, reason string) {
+	r.endPhase()
+	r.End = time.Now()
+	r.DurationMs = r.End.Sub(r.Start).Milliseconds()
+	r.Success = success
+	r.Error = reason
+	if !r.blockStart.IsZero() {
+		end := r.blockEnd
+		if end.IsZero() {
+			end = r.End
+		}
+		r.WriteBlockedMs = end.Sub(r.blockStart).Milliseconds()
+	}
+	r.endTrace()
+}
+
+func (r *FailoverReport) Save(path string) error {
+	saveJson, _ := json.MarshalIndent(r, "", "\t")
+	return ioutil.WriteFile(path, saveJson, 0644)
+}
+
+func (r *FailoverReport) Purge(path string, keep int) error {
+	return purgeFailoverFiles(path, keep)
+}
+
+// GetFailoverReports return the reports, most recent first
+func (cluster *Cluster) GetFailoverReports() []*FailoverReport {
+	cluster.Lock()
+	defer cluster.Unlock()
+	reports := make([]*FailoverReport, len(cluster.FailoverReports))
+	copy(reports, cluster.FailoverReports)
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Start.After(reports[j].Start) })
+	return reports
+}
+
+func (cluster *Cluster) loadFailoverReports() {
+	dir := cluster.WorkingDir + "/reports"
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "failover") {
+			continue
+		}
+		content, err := ioutil.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			continue
+		}
+		r := new(FailoverReport)
+		if json.Unmarshal(content, r) == nil {
+			cluster.FailoverReports = append(cluster.FailoverReports, r)
+		}
+	}
+}
+
+// getFailoverReport is called with the cluster lock
+func (cluster *Cluster) getFailoverReport(id string) *FailoverReport {
+	for _, r := range cluster.FailoverReports {
+		if r.Id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// saveFailoverReport close the report of the running failover, keep it in
+// memory and on disk next to the crash files
+func (cluster *Cluster) saveFailoverReport(success bool, reason string) {
+	r := cluster.failoverReport
+	if r == nil {
+		return
+	}
+	cluster.failoverReport = nil
+	r.Finish(success, reason)
+	cluster.Lock()
+	// reports started in the same instant get distinct ids
+	now := r.Start
+	for r.Id == "" || cluster.getFailoverReport(r.Id) != nil {
+		r.Id = now.Format("20060102150405.000000")
+		now = now.Add(time.Microsecond)
+	}
+	cluster.FailoverReports = append(cluster.FailoverReports, r)
+	if keep := cluster.Conf.FailoverLogFileKeep; keep > 0 && len(cluster.FailoverReports) > keep {
+		cluster.FailoverReports = cluster.FailoverReports[len(cluster.FailoverReports)-keep:]
+	}
+	cluster.Unlock()
+	dir := cluster.WorkingDir + "/reports"
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = r.Save(dir + "/failover." + r.Id + ".json")
+	}
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save failover report: %s", err)
+	}
+	r.Purge(dir, cluster.Conf.FailoverLogFileKeep)
+	cluster.LogPrintf(LvlInfo, "%s report: %d ms total, writes blocked %d ms", r.Type, r.DurationMs, r.WriteBlockedMs)
+}
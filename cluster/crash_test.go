@@ -0,0 +1,51 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFailoverReportId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := &Cluster{WorkingDir: dir}
+	cluster.Conf.FailoverLogFileKeep = 5
+	first := newFailoverReport("c", true)
+	for i := 0; i < 3; i++ {
+		r := newFailoverReport("c", true)
+		r.Start = first.Start
+		cluster.failoverReport = r
+		cluster.saveFailoverReport(true, "")
+	}
+	ids := make(map[string]bool)
+	for _, r := range cluster.GetFailoverReports() {
+		if ids[r.Id] {
+			t.Errorf("Expected unique report ids, got %s twice", r.Id)
+		}
+		ids[r.Id] = true
+	}
+	files, err := ioutil.ReadDir(dir + "/reports")
+	if err != nil || len(ids) != 3 || len(files) != 3 {
+		t.Errorf("Expected 3 reports saved, got %d in memory %d on disk: %v", len(ids), len(files), err)
+	}
+
+	// reports are kept after a restart
+	restarted := &Cluster{WorkingDir: dir}
+	restarted.loadFailoverReports()
+	if reports := restarted.GetFailoverReports(); len(reports) != 3 || !ids[reports[0].Id] {
+		t.Errorf("Expected the 3 reports loaded, got %d", len(reports))
+	}
+}
@@ -100,6 +100,16 @@ var clusterError = map[string]string{
 	"ERR00088": "Authentification error in replication IO thread",
 	"ERR00089": "Authentification error to Vault %s",
 	"ERR00090": "Monitoring save config enable but no encryption key for password, see the keygen command",
+	"ERR00091": "Raft leader lost the quorum of monitors (%s)",
+	"ERR00092": "MySQL Router connection error: %s",
+	"ERR00093": "MySQL Router %s does not route writes to master %s",
+	"ERR00094": "Rolling upgrade to %s paused on %s: %s",
+	"ERR00095": "Point-in-time recovery of %s failed: %s",
+	"ERR00096": "Verification of %s backup %s failed: %s",
+	"ERR00097": "Schema change of %s.%s failed: %s",
+	"ERR00098": "Schema drift between master and replicas: %s",
+	"ERR00099": "Schema drift between shard clusters: %s",
+	"ERR00100": "Data inconsistency found by the consistency check: %s",
 	"WARN0022": "Rejoining standalone server %s to master %s",
 	"WARN0023": "Number of failed master ping has been reached",
 	"WARN0045": "Provision task is in queue",
@@ -161,4 +171,8 @@ var clusterError = map[string]string{
 	"WARN0102": "The config file must be merge because an immutable parameter has been changed. Use the config-merge command to save your changes.",
 	"WARN0103": "Enforce replication mode idempotent but  strict on server %s",
 	"WARN0104": "Enforce replication mode strict but idempotent on server %s",
+	"WARN0105": "MySQL Router %s route %s has no available destination",
+	"WARN0106": "MySQL Router %s metadata cache %s refresh failed",
+	"WARN0107": "Backup storage %s copy of %s failed: %s",
+	"WARN0108": "Query regression found by the digest history: %s",
 }
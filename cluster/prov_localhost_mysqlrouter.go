@@ -0,0 +1,92 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func (cluster *Cluster) LocalhostUnprovisionMysqlRouterService(prx *MysqlRouterProxy) error {
+	cluster.LocalhostStopMysqlRouterService(prx)
+	os.RemoveAll(prx.Datadir + "/var")
+	cluster.errorChan <- nil
+	return nil
+}
+
+// LocalhostProvisionMysqlRouterService bootstrap the router against the
+// InnoDB Cluster master, bootstrap writes the config and the start and stop
+// scripts in the datadir
+func (cluster *Cluster) LocalhostProvisionMysqlRouterService(prx *MysqlRouterProxy) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		err := errors.New("No master to bootstrap MySQL Router")
+		cluster.errorChan <- err
+		return err
+	}
+	path := prx.Datadir + "/var"
+	os.RemoveAll(path)
+
+	bootstrapCmd := exec.Command(cluster.Conf.MysqlRouterBinaryPath,
+		"--bootstrap", cluster.GetDbUser()+":"+cluster.GetDbPass()+"@"+master.Host+":"+master.Port,
+		"--directory", path,
+		"--conf-bind-address", prx.GetBindAddress(),
+		"--conf-base-port", strconv.Itoa(prx.WritePort),
+		"--https-port", prx.Port,
+		"--account-create", "if-not-exists",
+		"--force")
+	cluster.LogPrintf(LvlInfo, "%s --bootstrap %s@%s:%s --directory %s", bootstrapCmd.Path, cluster.GetDbUser(), master.Host, master.Port, path)
+	out := &bytes.Buffer{}
+	bootstrapCmd.Stdout = out
+	bootstrapCmd.Stderr = out
+	err := bootstrapCmd.Run()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MySQL Router bootstrap failed: %s %s", err, out.String())
+		cluster.errorChan <- err
+		return err
+	}
+
+	// REST API user for the file auth backend
+	passwdCmd := exec.Command(filepath.Join(filepath.Dir(cluster.Conf.MysqlRouterBinaryPath), "mysqlrouter_passwd"), "set", path+"/mysqlrouter.pwd", prx.User)
+	passwdCmd.Stdin = strings.NewReader(prx.Pass + "\n")
+	err = passwdCmd.Run()
+	if err != nil {
+		cluster.LogPrintf(LvlWarn, "MySQL Router could not set REST API user %s: %s", prx.User, err)
+	}
+
+	err = cluster.LocalhostStartMysqlRouterService(prx)
+	if err != nil {
+		cluster.errorChan <- err
+		return err
+	}
+	cluster.errorChan <- nil
+	return nil
+}
+
+func (cluster *Cluster) LocalhostStopMysqlRouterService(prx *MysqlRouterProxy) error {
+	stopCmd := exec.Command(prx.Datadir + "/var/stop.sh")
+	err := stopCmd.Run()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MySQL Router stop failed: %s", err)
+	}
+	return err
+}
+
+func (cluster *Cluster) LocalhostStartMysqlRouterService(prx *MysqlRouterProxy) error {
+	startCmd := exec.Command(prx.Datadir + "/var/start.sh")
+	cluster.LogPrintf(LvlInfo, "%s", startCmd.Path)
+	err := startCmd.Run()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MySQL Router start failed: %s", err)
+	}
+	return err
+}
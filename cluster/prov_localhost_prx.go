@@ -45,6 +45,10 @@ func (cluster *Cluster) LocalhostProvisionProxyService(pri DatabaseProxy) error
 		return err
 	}
 
+	if prx, ok := pri.(*MysqlRouterProxy); ok {
+		return cluster.LocalhostProvisionMysqlRouterService(prx)
+	}
+
 	cluster.errorChan <- nil
 	return nil
 }
@@ -62,6 +66,10 @@ func (cluster *Cluster) LocalhostUnprovisionProxyService(pri DatabaseProxy) erro
 		cluster.LocalhostUnprovisionProxySQLService(prx)
 	}
 
+	if prx, ok := pri.(*MysqlRouterProxy); ok {
+		return cluster.LocalhostUnprovisionMysqlRouterService(prx)
+	}
+
 	cluster.errorChan <- nil
 	return nil
 }
@@ -79,6 +87,10 @@ func (cluster *Cluster) LocalhostStartProxyService(pri DatabaseProxy) error {
 		cluster.LocalhostStartProxySQLService(prx)
 	}
 
+	if prx, ok := pri.(*MysqlRouterProxy); ok {
+		cluster.LocalhostStartMysqlRouterService(prx)
+	}
+
 	cluster.errorChan <- nil
 	return nil
 }
@@ -90,6 +102,9 @@ func (cluster *Cluster) LocalhostStopProxyService(pri DatabaseProxy) error {
 	if prx, ok := pri.(*ProxySQLProxy); ok {
 		cluster.LocalhostStopProxySQLService(prx)
 	}
+	if prx, ok := pri.(*MysqlRouterProxy); ok {
+		cluster.LocalhostStopMysqlRouterService(prx)
+	}
 
 	return nil
 }
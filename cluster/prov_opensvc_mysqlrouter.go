@@ -0,0 +1,36 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"strconv"
+)
+
+// OpenSVCGetMysqlRouterContainerSection run the MySQL Router image, its
+// entrypoint bootstrap the router against the InnoDB Cluster master
+func (cluster *Cluster) OpenSVCGetMysqlRouterContainerSection(server *MysqlRouterProxy) map[string]string {
+	svccontainer := make(map[string]string)
+	if server.ClusterGroup.Conf.ProvProxType == "docker" || server.ClusterGroup.Conf.ProvProxType == "podman" || server.ClusterGroup.Conf.ProvProxType == "oci" {
+		masterHost, masterPort := "", "3306"
+		if master := cluster.GetMaster(); master != nil {
+			masterHost, masterPort = master.Host, master.Port
+		}
+		svccontainer["tags"] = ""
+		svccontainer["netns"] = "container#01"
+		svccontainer["image"] = "{env.mysqlrouter_img}"
+		svccontainer["rm"] = "true"
+		svccontainer["type"] = server.ClusterGroup.Conf.ProvType
+		svccontainer["secrets_environment"] = "MYSQL_PASSWORD=env/MYSQL_ROOT_PASSWORD"
+		svccontainer["run_args"] = "--ulimit nofile=262144:262144 -e MYSQL_HOST=" + masterHost + " -e MYSQL_PORT=" + masterPort + " -e MYSQL_USER=" + cluster.GetDbUser() + " -e MYSQL_INNODB_CLUSTER_MEMBERS=" + strconv.Itoa(len(cluster.Servers))
+		if server.ClusterGroup.Conf.ProvProxDiskType == "volume" {
+			svccontainer["volume_mounts"] = `/etc/localtime:/etc/localtime:ro`
+		} else {
+			svccontainer["run_args"] += " -v /etc/localtime:/etc/localtime:ro"
+		}
+	}
+	return svccontainer
+}
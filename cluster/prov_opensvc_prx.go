@@ -327,6 +327,23 @@ func (cluster *Cluster) OpenSVCProvisionProxyService(pri DatabaseProxy) error {
 			}
 		}
 	}
+	if prx, ok := pri.(*MysqlRouterProxy); ok {
+		if cluster.Conf.ProvOpensvcUseCollectorAPI {
+			err := errors.New("No MySQL Router template in Collector API")
+			cluster.errorChan <- err
+			return err
+		}
+		res, err := cluster.OpenSVCGetProxyTemplateV2(strings.Join(srvlist, " "), prx)
+		if err != nil {
+			cluster.errorChan <- err
+			return err
+		}
+		err = svc.CreateTemplateV2(cluster.Name, prx.ServiceName, prx.Agent, res)
+		if err != nil {
+			cluster.errorChan <- err
+			return err
+		}
+	}
 	cluster.errorChan <- nil
 	return nil
 }
@@ -378,6 +395,10 @@ func (cluster *Cluster) OpenSVCGetProxyTemplateV2(servers string, pri DatabasePr
 		svcsection["container#prx"] = cluster.OpenSVCGetMaxscaleContainerSection(prx)
 	}
 
+	if prx, ok := pri.(*MysqlRouterProxy); ok {
+		svcsection["container#prx"] = cluster.OpenSVCGetMysqlRouterContainerSection(prx)
+	}
+
 	svcsection["env"] = cluster.OpenSVCGetProxyEnvSection(servers, pri)
 
 	svcsectionJson, err := json.MarshalIndent(svcsection, "", "\t")
@@ -450,6 +471,7 @@ func (cluster *Cluster) OpenSVCGetProxyEnvSection(servers string, prx DatabasePr
 	svcenv["proxysql_img"] = cluster.Conf.ProvProxProxysqlImg
 	svcenv["maxscale_img"] = cluster.Conf.ProvProxMaxscaleImg
 	svcenv["shardproxy_img"] = cluster.Conf.ProvProxShardingImg
+	svcenv["mysqlrouter_img"] = cluster.Conf.ProvProxMysqlRouterImg
 	svcenv["maxscale_maxinfo_port"] = strconv.Itoa(cluster.Conf.MxsMaxinfoPort)
 	svcenv["vip_addr"] = cluster.Conf.ProvProxRouteAddr
 	svcenv["vip_port"] = cluster.Conf.ProvProxRoutePort
@@ -128,6 +128,36 @@ func (cluster *Cluster) StartDatabaseScript(server *ServerMonitor) error {
 	return nil
 }
 
+// UpgradeDatabaseScript install the target version or package of a rolling
+// upgrade on a stopped database
+func (cluster *Cluster) UpgradeDatabaseScript(server *ServerMonitor, target string) error {
+	if cluster.Conf.ProvDbUpgradeScript == "" {
+		return nil
+	}
+	scriptCmd := exec.Command(cluster.Conf.ProvDbUpgradeScript, misc.Unbracket(server.Host), server.Port, cluster.GetDbUser(), cluster.GetDbPass(), cluster.Name, target)
+	cluster.LogPrintf(LvlInfo, "%s", strings.Replace(scriptCmd.String(), cluster.GetDbPass(), "XXXX", 1))
+
+	stdoutIn, _ := scriptCmd.StdoutPipe()
+	stderrIn, _ := scriptCmd.StderrPipe()
+	scriptCmd.Start()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		server.copyLogs(stdoutIn)
+	}()
+	go func() {
+		defer wg.Done()
+		server.copyLogs(stderrIn)
+	}()
+	wg.Wait()
+	if err := scriptCmd.Wait(); err != nil {
+		cluster.LogPrintf(LvlErr, " %s", err)
+		return err
+	}
+	return nil
+}
+
 func (cluster *Cluster) UnprovisionProxyScript(server DatabaseProxy) error {
 	if cluster.Conf.ProvProxyCleanupScript == "" {
 		return nil
@@ -22,11 +22,14 @@ import (
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/graphite"
 	"github.com/signal18/replication-manager/router/myproxy"
+	"github.com/signal18/replication-manager/router/mysqlrouter"
 	"github.com/signal18/replication-manager/router/proxysql"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/state"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Proxy defines a proxy
@@ -56,6 +59,7 @@ type Proxy struct {
 	ClusterGroup    *Cluster             `json:"-"`
 	Datadir         string               `json:"datadir"`
 	QueryRules      []proxysql.QueryRule `json:"queryRules"`
+	Routes          []mysqlrouter.Route  `json:"routes"`
 	State           string               `json:"state"`
 	PrevState       string               `json:"prevState"`
 	FailCount       int                  `json:"failCount"`
@@ -94,6 +98,8 @@ type DatabaseProxy interface {
 	GetReadPort() int
 	GetId() string
 	GetState() string
+	GetBackendsWrite() []Backend
+	GetBackendsRead() []Backend
 	SetState(v string)
 	GetUser() string
 	GetPass() string
@@ -222,6 +228,12 @@ func (cluster *Cluster) newProxyList() error {
 			cluster.LogPrintf(LvlDbg, "New SphinxSearch proxy created: %s %s", prx.GetHost(), prx.GetPort())
 		}
 	}
+	if cluster.Conf.MysqlRouterOn {
+		for k, proxyHost := range strings.Split(cluster.Conf.MysqlRouterHosts, ",") {
+			prx := NewMysqlRouterProxy(k, cluster, proxyHost)
+			cluster.AddProxy(prx)
+		}
+	}
 	if cluster.Conf.MyproxyOn {
 		prx := NewMyProxyProxy(0, cluster, "")
 		cluster.AddProxy(prx)
@@ -319,6 +331,7 @@ func (cluster *Cluster) SetProxyServerMaintenance(serverid uint64) {
 // called  by server monitor if state change
 func (cluster *Cluster) backendStateChangeProxies() {
 	for _, pr := range cluster.Proxies {
+		cluster.LogEvent(journal.ConstEventProxy, "backends-state-change", pr.GetURL(), "", "Proxy %s backends state change", pr.GetType())
 		pr.BackendsStateChange()
 	}
 }
@@ -373,7 +386,20 @@ func (cluster *Cluster) refreshProxies(wcg *sync.WaitGroup) {
 func (cluster *Cluster) failoverProxies() {
 	for _, pr := range cluster.Proxies {
 		cluster.LogPrintf(LvlInfo, "Failover Proxy Type: %s Host: %s Port: %s", pr.GetType(), pr.GetHost(), pr.GetPort())
+		cluster.LogEvent(journal.ConstEventProxy, "failover", pr.GetURL(), "", "Failover proxy %s", pr.GetType())
+		start := time.Now()
+		_, span := cluster.StartSpan("DatabaseProxy.Failover", attribute.String("proxy", pr.GetURL()), attribute.String("type", pr.GetType()))
 		pr.Failover()
+		span.SetAttributes(attribute.String("state", pr.GetState()))
+		span.End()
+		if cluster.failoverReport != nil {
+			cluster.failoverReport.Proxies = append(cluster.failoverReport.Proxies, FailoverProxyResult{
+				Type:       pr.GetType(),
+				URL:        pr.GetURL(),
+				State:      pr.GetState(),
+				DurationMs: time.Since(start).Milliseconds(),
+			})
+		}
 	}
 
 }
@@ -165,6 +165,14 @@ func (proxy *Proxy) GetName() string {
 	return proxy.Name
 }
 
+func (proxy *Proxy) GetBackendsWrite() []Backend {
+	return proxy.BackendsWrite
+}
+
+func (proxy *Proxy) GetBackendsRead() []Backend {
+	return proxy.BackendsRead
+}
+
 func (proxy *ProxySQLProxy) GetEnv() map[string]string {
 	env := proxy.GetBaseEnv()
 	return env
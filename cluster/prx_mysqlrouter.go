@@ -0,0 +1,350 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//
+//	Stephane Varoqui  <svaroqui@gmail.com>
+//
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/graphite"
+	"github.com/signal18/replication-manager/router/mysqlrouter"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/spf13/pflag"
+)
+
+const (
+	mysqlRouterRouteWrite     = "rw"
+	mysqlRouterRouteRead      = "ro"
+	mysqlRouterRouteReadWrite = "rw_split"
+)
+
+type MysqlRouterProxy struct {
+	Proxy
+	MetadataCaches map[string]mysqlrouter.MetadataStatus `json:"metadataCaches"`
+}
+
+func NewMysqlRouterProxy(placement int, cluster *Cluster, proxyHost string) *MysqlRouterProxy {
+	conf := cluster.Conf
+	prx := new(MysqlRouterProxy)
+	prx.Type = config.ConstProxyMysqlrouter
+	prx.SetPlacement(placement, conf.ProvProxAgents, "", conf.MysqlRouterHostsIPV6, conf.MysqlRouterJanitorWeights)
+	prx.Port = conf.MysqlRouterPort
+	prx.User = conf.MysqlRouterUser
+	prx.Pass = cluster.Conf.GetDecryptedValue("mysqlrouter-pass")
+	prx.ReadPort = conf.MysqlRouterReadPort
+	prx.WritePort = conf.MysqlRouterWritePort
+	prx.ReadWritePort = conf.MysqlRouterReadWritePort
+	prx.Name = proxyHost
+	prx.Host = proxyHost
+	if cluster.Conf.ProvNetCNI {
+		prx.Host = prx.Host + "." + cluster.Name + ".svc." + conf.ProvOrchestratorCluster
+	}
+	prx.MetadataCaches = make(map[string]mysqlrouter.MetadataStatus)
+
+	return prx
+}
+
+func (proxy *MysqlRouterProxy) AddFlags(flags *pflag.FlagSet, conf *config.Config) {
+	flags.BoolVar(&conf.MysqlRouterOn, "mysqlrouter", false, "MySQL Router proxy server is query for backend status")
+	flags.StringVar(&conf.MysqlRouterHosts, "mysqlrouter-servers", "127.0.0.1", "MySQL Router hosts")
+	flags.StringVar(&conf.MysqlRouterHostsIPV6, "mysqlrouter-servers-ipv6", "", "ipv6 bind address ")
+	flags.StringVar(&conf.MysqlRouterJanitorWeights, "mysqlrouter-janitor-weights", "100", "Weight of each MySQL Router host inside janitor proxy")
+	flags.StringVar(&conf.MysqlRouterPort, "mysqlrouter-port", "8443", "MySQL Router REST API port")
+	flags.BoolVar(&conf.MysqlRouterApiSSL, "mysqlrouter-api-ssl", true, "MySQL Router REST API use https")
+	flags.StringVar(&conf.MysqlRouterUser, "mysqlrouter-user", "admin", "MySQL Router REST API user")
+	flags.StringVar(&conf.MysqlRouterPass, "mysqlrouter-pass", "mariadb", "MySQL Router REST API password")
+	flags.IntVar(&conf.MysqlRouterWritePort, "mysqlrouter-write-port", 6446, "MySQL Router read-write port to leader")
+	flags.IntVar(&conf.MysqlRouterReadPort, "mysqlrouter-read-port", 6447, "MySQL Router load balance read port to all nodes")
+	flags.IntVar(&conf.MysqlRouterReadWritePort, "mysqlrouter-read-write-port", 6450, "MySQL Router read write splitting port")
+	flags.IntVar(&conf.MysqlRouterFailoverTimeout, "mysqlrouter-failover-timeout", 10, "Seconds to wait for MySQL Router to route writes to the new master after failover")
+	flags.BoolVar(&conf.MysqlRouterMaintenanceHidden, "mysqlrouter-maintenance-hidden", true, "Hide servers in maintenance from MySQL Router using the InnoDB Cluster _hidden tag")
+	flags.StringVar(&conf.MysqlRouterBinaryPath, "mysqlrouter-binary-path", "/usr/bin/mysqlrouter", "MySQL Router binary location")
+}
+
+func (proxy *MysqlRouterProxy) Connect() (mysqlrouter.MySQLRouter, error) {
+	r := mysqlrouter.MySQLRouter{
+		Host:   proxy.Host,
+		Port:   proxy.Port,
+		User:   proxy.User,
+		Pass:   proxy.Pass,
+		UseSSL: proxy.ClusterGroup.Conf.MysqlRouterApiSSL,
+	}
+	if proxy.Tunnel {
+		r.Host = "localhost"
+		r.Port = strconv.Itoa(proxy.TunnelPort)
+	}
+	err := r.Connect()
+	return r, err
+}
+
+// getRouteRole match a route to the write, read or read write splitting port,
+// bootstrap names classic routes after their role
+func (proxy *MysqlRouterProxy) getRouteRole(route mysqlrouter.Route) string {
+	if route.Protocol == "x" {
+		return ""
+	}
+	switch route.BindPort {
+	case proxy.WritePort:
+		return mysqlRouterRouteWrite
+	case proxy.ReadPort:
+		return mysqlRouterRouteRead
+	case proxy.ReadWritePort:
+		return mysqlRouterRouteReadWrite
+	}
+	switch {
+	case strings.HasSuffix(route.Name, "_rw_split"):
+		return mysqlRouterRouteReadWrite
+	case strings.HasSuffix(route.Name, "_rw"):
+		return mysqlRouterRouteWrite
+	case strings.HasSuffix(route.Name, "_ro"):
+		return mysqlRouterRouteRead
+	}
+	return ""
+}
+
+func (proxy *MysqlRouterProxy) Init() {
+	cluster := proxy.ClusterGroup
+	if cluster.Conf.MysqlRouterOn == false {
+		return
+	}
+	r, err := proxy.Connect()
+	if err != nil {
+		cluster.StateMachine.AddState("ERR00092", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00092"], err), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+		return
+	}
+	status, err := r.GetRouterStatus()
+	if err == nil {
+		proxy.Version = status.Version
+	}
+	caches, err := r.GetMetadataCaches()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MySQL Router %s could not list metadata caches: %s", proxy.Name, err)
+		return
+	}
+	if len(caches) == 0 {
+		cluster.LogPrintf(LvlWarn, "MySQL Router %s has no metadata cache, static routes do not follow failover", proxy.Name)
+	}
+	for _, name := range caches {
+		mdconf, err := r.GetMetadataConfig(name)
+		if err == nil {
+			cluster.LogPrintf(LvlInfo, "MySQL Router %s metadata cache %s of cluster %s with %d nodes", proxy.Name, name, mdconf.ClusterName, len(mdconf.Nodes))
+		}
+	}
+	routes, err := r.GetRoutesInfo()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "MySQL Router %s could not list routes: %s", proxy.Name, err)
+		return
+	}
+	proxy.Routes = routes
+	master := cluster.GetMaster()
+	if master != nil && !proxy.isRoutingWritesTo(master) {
+		cluster.LogPrintf(LvlWarn, "MySQL Router %s does not route writes to master %s", proxy.Name, master.URL)
+	}
+}
+
+// isRoutingWritesTo check that the first destination of every write route is
+// the server, the metadata cache only list the primary in read write routes
+func (proxy *MysqlRouterProxy) isRoutingWritesTo(server *ServerMonitor) bool {
+	found := false
+	for _, route := range proxy.Routes {
+		if proxy.getRouteRole(route) != mysqlRouterRouteWrite {
+			continue
+		}
+		if len(route.Destinations) == 0 {
+			return false
+		}
+		d := route.Destinations[0]
+		if strconv.Itoa(d.Port) != server.Port || (d.Address != server.Host && d.Address != server.IP) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func (proxy *MysqlRouterProxy) Refresh() error {
+	cluster := proxy.ClusterGroup
+	if cluster.Conf.MysqlRouterOn == false {
+		return nil
+	}
+	r, err := proxy.Connect()
+	if err != nil {
+		cluster.StateMachine.AddState("ERR00092", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00092"], err), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+		cluster.StateMachine.CopyOldStateFromUnknowServer(proxy.Name)
+		return err
+	}
+	status, err := r.GetRouterStatus()
+	if err == nil {
+		proxy.Version = status.Version
+	}
+	routes, err := r.GetRoutesInfo()
+	if err != nil {
+		cluster.StateMachine.AddState("ERR00092", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00092"], err), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+		return err
+	}
+	proxy.Routes = routes
+	proxy.BackendsWrite = nil
+	proxy.BackendsRead = nil
+	for _, route := range routes {
+		role := proxy.getRouteRole(route)
+		if role == "" {
+			continue
+		}
+		if !route.Alive {
+			cluster.StateMachine.AddState("WARN0105", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0105"], proxy.Name, route.Name), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+		}
+		for _, d := range route.Destinations {
+			bke := proxy.newBackend(route, d)
+			if role == mysqlRouterRouteWrite {
+				proxy.BackendsWrite = append(proxy.BackendsWrite, bke)
+			} else {
+				proxy.BackendsRead = append(proxy.BackendsRead, bke)
+			}
+		}
+	}
+
+	caches, err := r.GetMetadataCaches()
+	if err != nil {
+		return nil
+	}
+	for _, name := range caches {
+		mdstatus, err := r.GetMetadataStatus(name)
+		if err != nil {
+			continue
+		}
+		if prev, ok := proxy.MetadataCaches[name]; ok && mdstatus.RefreshFailed > prev.RefreshFailed {
+			cluster.StateMachine.AddState("WARN0106", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0106"], proxy.Name, name), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+		}
+		proxy.MetadataCaches[name] = mdstatus
+	}
+	return nil
+}
+
+func (proxy *MysqlRouterProxy) newBackend(route mysqlrouter.Route, d mysqlrouter.Destination) Backend {
+	cluster := proxy.ClusterGroup
+	connections, bytesTo, bytesFrom := route.GetDestinationStats(d)
+	bke := Backend{
+		Host:           d.Address,
+		Port:           strconv.Itoa(d.Port),
+		PrxName:        route.Name + "/" + d.Address + ":" + strconv.Itoa(d.Port),
+		PrxStatus:      "DOWN",
+		PrxConnections: strconv.Itoa(connections),
+		PrxHostgroup:   route.Name,
+		PrxByteOut:     strconv.FormatInt(bytesTo, 10),
+		PrxByteIn:      strconv.FormatInt(bytesFrom, 10),
+		PrxLatency:     "0",
+	}
+	if route.Alive {
+		bke.PrxStatus = "UP"
+	}
+	server := cluster.GetServerFromURL(bke.Host + ":" + bke.Port)
+	if server != nil {
+		bke.Status = server.State
+		bke.PrxMaintenance = server.IsMaintenance
+	}
+	return bke
+}
+
+func (proxy *MysqlRouterProxy) BackendsStateChange() {
+	return
+}
+
+// Failover wait for the metadata cache to route writes to the new master, the
+// REST API is read only and MySQL Router follows the group by itself
+func (proxy *MysqlRouterProxy) Failover() {
+	cluster := proxy.ClusterGroup
+	if cluster.Conf.MysqlRouterOn == false {
+		return
+	}
+	master := cluster.GetMaster()
+	if master == nil {
+		return
+	}
+	r, err := proxy.Connect()
+	if err != nil {
+		cluster.StateMachine.AddState("ERR00092", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00092"], err), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+		return
+	}
+	deadline := time.Now().Add(time.Duration(cluster.Conf.MysqlRouterFailoverTimeout) * time.Second)
+	for {
+		routes, err := r.GetRoutesInfo()
+		if err == nil {
+			proxy.Routes = routes
+			if proxy.isRoutingWritesTo(master) {
+				cluster.LogPrintf(LvlInfo, "MySQL Router %s routes writes to new master %s", proxy.Name, master.URL)
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	cluster.StateMachine.AddState("ERR00093", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00093"], proxy.Name, master.URL), ErrFrom: "PROXY", ServerUrl: proxy.Name})
+}
+
+// SetMaintenance hide the server in the InnoDB Cluster metadata, MySQL Router
+// can not drain a destination through its REST API
+func (proxy *MysqlRouterProxy) SetMaintenance(server *ServerMonitor) {
+	cluster := proxy.ClusterGroup
+	if cluster.Conf.MysqlRouterOn == false || cluster.Conf.MysqlRouterMaintenanceHidden == false {
+		return
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.Conn == nil {
+		return
+	}
+	if server == master && server.IsMaintenance {
+		cluster.LogPrintf(LvlWarn, "MySQL Router %s hiding master %s stop the writes routing", proxy.Name, server.URL)
+	}
+	logs, err := dbhelper.SetInnoDBClusterInstanceHidden(master.Conn, server.Host+":"+server.Port, server.IsMaintenance)
+	cluster.LogSQL(logs, err, master.URL, "Proxy", LvlErr, "Could not set server %s in maintenance for MySQL Router: %s", server.URL, err)
+}
+
+func (proxy *MysqlRouterProxy) SendStats() error {
+	cluster := proxy.ClusterGroup
+	err := proxy.Proxy.SendStats()
+	if err != nil {
+		return err
+	}
+	graph, err := graphite.NewGraphite(cluster.Conf.GraphiteCarbonHost, cluster.Conf.GraphiteCarbonPort)
+	if err != nil {
+		return err
+	}
+	for _, route := range proxy.Routes {
+		alive := "0"
+		if route.Alive {
+			alive = "1"
+		}
+		var metrics = make([]graphite.Metric, 4)
+		metrics[0] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.route.%s.alive", proxy.Type, proxy.Id, route.Name), alive, time.Now().Unix())
+		metrics[1] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.route.%s.active_connections", proxy.Type, proxy.Id, route.Name), strconv.Itoa(route.ActiveConnections), time.Now().Unix())
+		metrics[2] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.route.%s.total_connections", proxy.Type, proxy.Id, route.Name), strconv.Itoa(route.TotalConnections), time.Now().Unix())
+		metrics[3] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.route.%s.blocked_hosts", proxy.Type, proxy.Id, route.Name), strconv.Itoa(route.BlockedHosts), time.Now().Unix())
+		graph.SendMetrics(metrics)
+	}
+	for name, mdstatus := range proxy.MetadataCaches {
+		var metrics = make([]graphite.Metric, 2)
+		metrics[0] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.metadata.%s.refresh_succeeded", proxy.Type, proxy.Id, name), strconv.Itoa(mdstatus.RefreshSucceeded), time.Now().Unix())
+		metrics[1] = graphite.NewMetric(fmt.Sprintf("proxy.%s%s.metadata.%s.refresh_failed", proxy.Type, proxy.Id, name), strconv.Itoa(mdstatus.RefreshFailed), time.Now().Unix())
+		graph.SendMetrics(metrics)
+	}
+	graph.Disconnect()
+	return nil
+}
+
+func (proxy *MysqlRouterProxy) CertificatesReload() error {
+	return nil
+}
@@ -33,10 +33,12 @@ import (
 	"github.com/signal18/replication-manager/config"
 	v3 "github.com/signal18/replication-manager/repmanv3"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/digest"
 	"github.com/signal18/replication-manager/utils/gtid"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/s18log"
 	"github.com/signal18/replication-manager/utils/state"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ServerMonitor defines a server to monitor.
@@ -159,6 +161,8 @@ type ServerMonitor struct {
 	SlowLog                     s18log.SlowLog               `json:"-"`
 	Status                      map[string]string            `json:"-"`
 	PrevStatus                  map[string]string            `json:"-"`
+	JobsRunning                 map[string]int               `json:"-"`
+	JobDurations                map[string]int64             `json:"-"`
 	PFSQueries                  map[string]dbhelper.PFSQuery `json:"-"` //PFS queries
 	SlowPFSQueries              map[string]dbhelper.PFSQuery `json:"-"` //PFS queries from slow
 	DictTables                  map[string]v3.Table          `json:"-"`
@@ -184,6 +188,11 @@ type ServerMonitor struct {
 	DelayStat                   *ServerDelayStat             `json:"delayStat"`
 	IsInSlowQueryCapture        bool
 	IsInPFSQueryCapture         bool
+	IsInDigestCapture           bool
+	digestTracker               *digest.Tracker
+	digestStore                 *digest.Store
+	digestTime                  time.Time
+	digestMutex                 sync.Mutex
 }
 
 type serverList []*ServerMonitor
@@ -320,6 +329,11 @@ func (cluster *Cluster) newServerMonitor(url string, user string, pass string, c
 func (server *ServerMonitor) Ping(wg *sync.WaitGroup) {
 
 	defer wg.Done()
+	span := server.startSpan("ServerMonitor.Ping")
+	defer func() {
+		span.SetAttributes(attribute.String("state", server.State))
+		span.End()
+	}()
 
 	if server.ClusterGroup.vmaster != nil {
 		if server.ClusterGroup.vmaster.ServerID == server.ServerID {
@@ -596,6 +610,13 @@ var start_time time.Time
 
 // Refresh a server object
 func (server *ServerMonitor) Refresh() error {
+	span := server.startSpan("ServerMonitor.Refresh")
+	err := server.refresh()
+	endSpan(span, err)
+	return err
+}
+
+func (server *ServerMonitor) refresh() error {
 	var err error
 
 	var cpu_usage_dt int64
@@ -742,6 +763,17 @@ func (server *ServerMonitor) Refresh() error {
 			server.AvgWorkLoad()
 			server.MaxWorkLoad()
 
+		} else {
+			server.ReadOnly = server.Variables["DEFAULT_TRANSACTION_READ_ONLY"]
+			server.HaveReadOnly = server.HasReadOnly()
+			server.HaveBinlog = server.HasBinlog()
+			// the WAL position is the pseudo GTID in domain 0 used for election
+			lsn, logs, err := dbhelper.GetPostgresLSN(server.Conn)
+			server.ClusterGroup.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not get WAL position %s %s", server.URL, err)
+			if err == nil {
+				server.CurrentGtid = gtid.NewList("0-0-" + strconv.FormatUint(lsn, 10))
+				server.GTIDBinlogPos = server.CurrentGtid
+			}
 		} // end not postgress
 
 		// get Users
@@ -804,6 +836,7 @@ func (server *ServerMonitor) Refresh() error {
 			server.ClusterGroup.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not get engine innodb status %s %s", server.URL, err)
 		}
 		go server.GetPFSQueries()
+		go server.MonitorDigestHistory()
 		go server.GetSlowLogTable()
 		if server.HaveDiskMonitor {
 			server.Disks, logs, err = dbhelper.GetDisks(server.Conn, server.DBVersion)
@@ -941,6 +974,9 @@ func (server *ServerMonitor) Refresh() error {
 
 /* Handles write freeze and shoot existing transactions on a server */
 func (server *ServerMonitor) freeze() bool {
+	if server.DBVersion.IsPPostgreSQL() {
+		return server.freezePostgres()
+	}
 	if server.ClusterGroup.Conf.FailEventScheduler {
 		server.ClusterGroup.LogPrintf(LvlInfo, "Freezing writes from Event Scheduler on %s", server.URL)
 		logs, err := server.SetEventScheduler(false)
@@ -1005,6 +1041,23 @@ func (server *ServerMonitor) freeze() bool {
 	return true
 }
 
+// freezePostgres reject writes on a primary and checkpoint so that the
+// standbys receive the last WAL records
+func (server *ServerMonitor) freezePostgres() bool {
+	server.ClusterGroup.LogPrintf(LvlInfo, "Freezing writes set default transaction read only on %s", server.URL)
+	logs, err := dbhelper.PostgresSetReadOnly(server.Conn, true)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Freeze", LvlErr, "Could not set %s as read-only: %s", server.URL, err)
+	if err != nil {
+		return false
+	}
+	server.ClusterGroup.LogPrintf(LvlInfo, "Freezing writes killing all other remaining sessions on %s", server.URL)
+	logs, err = dbhelper.KillThreads(server.Conn, server.DBVersion)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Freeze", LvlErr, "Could not kill sessions on %s: %s", server.URL, err)
+	logs, err = dbhelper.PostgresCheckpoint(server.Conn)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Freeze", LvlErr, "Could not checkpoint on %s: %s", server.URL, err)
+	return true
+}
+
 func (server *ServerMonitor) ReadAllRelayLogs() error {
 
 	server.ClusterGroup.LogPrintf(LvlInfo, "Reading all relay logs on %s", server.URL)
@@ -1180,6 +1233,14 @@ func (server *ServerMonitor) ResetSlave() (string, error) {
 	return dbhelper.ResetSlave(server.Conn, true, server.ClusterGroup.Conf.MasterConn, server.DBVersion)
 }
 
+// PromotePostgres turn a streaming standby into a primary
+func (server *ServerMonitor) PromotePostgres() (string, error) {
+	if server.Conn == nil {
+		return "", errors.New("No database connection pool")
+	}
+	return dbhelper.PostgresPromote(server.Conn, server.ClusterGroup.Conf.MasterSlavePgPromoteTimeout)
+}
+
 func (server *ServerMonitor) FlushLogs() (string, error) {
 	if server.Conn == nil {
 		return "", errors.New("No database connection pool")
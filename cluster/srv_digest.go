@@ -0,0 +1,257 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/digest"
+	"github.com/signal18/replication-manager/utils/journal"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// most time consuming digests of a snapshot explained to follow their plan
+const digestTopExplain = 5
+
+// DigestHistory is the trend of the statement digests of a server over a
+// period, with the regressions of the last snapshot
+type DigestHistory struct {
+	Server      string              `json:"server"`
+	Since       time.Time           `json:"since"`
+	Until       time.Time           `json:"until"`
+	Regressions []digest.Regression `json:"regressions"`
+	Trends      []digest.Trend      `json:"trends"`
+}
+
+// getDigestStore open the digest history of the server and restore the
+// baseline of the known statements on first use
+func (server *ServerMonitor) getDigestStore() (*digest.Store, error) {
+	server.digestMutex.Lock()
+	defer server.digestMutex.Unlock()
+	if server.digestStore != nil {
+		return server.digestStore, nil
+	}
+	conf := server.ClusterGroup.Conf
+	store, err := digest.NewStore(server.ClusterGroup.WorkingDir+"/digests/"+server.Id, conf.MonitorDigestHistoryRetention)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := store.LoadStatements()
+	if err != nil {
+		return nil, err
+	}
+	server.digestTracker = digest.NewTracker(conf.MonitorDigestRegressionFactor, time.Duration(conf.MonitorDigestHistoryRetention)*24*time.Hour)
+	server.digestTracker.Statements = statements
+	server.digestStore = store
+	return store, nil
+}
+
+// MonitorDigestHistory snapshot the statement digests at every interval,
+// store the activity since the previous snapshot and report the regressions
+func (server *ServerMonitor) MonitorDigestHistory() {
+	cluster := server.ClusterGroup
+	if !(cluster.Conf.MonitorDigestHistory && cluster.Conf.MonitorPFS && server.HavePFS) || server.DBVersion == nil || server.DBVersion.IsPPostgreSQL() {
+		return
+	}
+	// the capture is claimed under the lock, monitor loops may overlap
+	server.digestMutex.Lock()
+	if server.IsInDigestCapture || time.Since(server.digestTime) < time.Duration(cluster.Conf.MonitorDigestHistoryInterval)*time.Second {
+		server.digestMutex.Unlock()
+		return
+	}
+	server.IsInDigestCapture = true
+	server.digestTime = time.Now()
+	server.digestMutex.Unlock()
+	defer func() {
+		server.digestMutex.Lock()
+		server.IsInDigestCapture = false
+		server.digestMutex.Unlock()
+	}()
+
+	store, err := server.getDigestStore()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not open digest history of %s: %s", server.URL, err)
+		return
+	}
+	counters, logs, err := dbhelper.GetDigestCounters(server.Conn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not get statement digests %s %s", server.URL, err)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	server.digestMutex.Lock()
+	snap, regressions := server.digestTracker.Update(now, counters)
+	server.digestMutex.Unlock()
+	if snap != nil {
+		if err := store.Append(snap); err != nil {
+			cluster.LogPrintf(LvlErr, "Could not save digest snapshot of %s: %s", server.URL, err)
+		}
+		if err := store.Purge(now); err != nil {
+			cluster.LogPrintf(LvlErr, "Could not purge digest history of %s: %s", server.URL, err)
+		}
+		regressions = append(regressions, server.explainDigests(now, snap, regressions)...)
+	}
+	for _, r := range regressions {
+		cluster.LogPrintf(LvlWarn, "Query regression on %s: %s", server.URL, r)
+		cluster.LogEvent(journal.ConstEventQuery, "digest-"+r.Kind, server.URL, "", "Query regression: %s", r)
+	}
+	server.digestMutex.Lock()
+	err = store.SaveStatements(server.digestTracker.Statements)
+	server.digestMutex.Unlock()
+	if err != nil {
+		cluster.LogPrintf(LvlErr, "Could not save digest statements of %s: %s", server.URL, err)
+	}
+}
+
+// explainDigests record the plan of the regressed and most time consuming
+// SELECT of the snapshot and return the plan changes. Explains run on a
+// dedicated connection to keep the default database of the sample.
+func (server *ServerMonitor) explainDigests(now time.Time, snap *digest.Snapshot, regressions []digest.Regression) []digest.Regression {
+	cluster := server.ClusterGroup
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, r := range regressions {
+		add(digest.Key(r.Schema, r.Digest))
+	}
+	for i, s := range snap.Samples {
+		if i >= digestTopExplain {
+			break
+		}
+		add(s.Key())
+	}
+	var plans []digest.Regression
+	var conn *sqlx.DB
+	for _, key := range keys {
+		server.digestMutex.Lock()
+		st, ok := server.digestTracker.Statements[key]
+		var schema, dig, text string
+		if ok {
+			schema, dig, text = st.Schema, st.Digest, st.Text
+		}
+		server.digestMutex.Unlock()
+		text = strings.ToUpper(strings.TrimSpace(text))
+		if !ok || !(strings.HasPrefix(text, "SELECT") || strings.HasPrefix(text, "WITH")) {
+			continue
+		}
+		if conn == nil {
+			var err error
+			conn, err = server.getExplainConn()
+			if err != nil {
+				cluster.LogPrintf(LvlDbg, "Could not connect to explain digests of %s: %s", server.URL, err)
+				return plans
+			}
+			defer conn.Close()
+		}
+		sample, logs, err := dbhelper.GetDigestSampleQuery(conn, server.DBVersion, schema, dig)
+		cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not get sample of digest %s %s", dig, err)
+		// samples longer than performance_schema_max_sql_text_length are cut
+		if err != nil || strings.HasSuffix(sample, "...") {
+			continue
+		}
+		plan, err := server.getConnExplain(conn, schema, sample)
+		if err != nil {
+			continue
+		}
+		server.digestMutex.Lock()
+		r := server.digestTracker.SetPlan(now, key, getExplainSignature(plan))
+		server.digestMutex.Unlock()
+		if r != nil {
+			plans = append(plans, *r)
+		}
+	}
+	return plans
+}
+
+// getExplainConn open a single connection so that the default database of
+// an explain stays on it
+func (server *ServerMonitor) getExplainConn() (*sqlx.DB, error) {
+	conn, err := server.GetNewDBConn()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+	return conn, nil
+}
+
+// getConnExplain explain a statement on a connection of getExplainConn in
+// the default database schema
+func (server *ServerMonitor) getConnExplain(conn *sqlx.DB, schema string, query string) ([]dbhelper.Explain, error) {
+	if schema != "" {
+		schema = dbhelper.QuoteIdentifier(schema)
+	}
+	plan, logs, err := dbhelper.GetQueryExplain(conn.Unsafe(), server.DBVersion, schema, query)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not explain %s %s", query, err)
+	return plan, err
+}
+
+// getExplainSignature identify a plan by the access type and key of each table
+func getExplainSignature(plan []dbhelper.Explain) string {
+	var rows []string
+	for _, p := range plan {
+		rows = append(rows, p.Table.String+":"+p.Type.String+":"+p.Key.String)
+	}
+	return strings.Join(rows, ",")
+}
+
+// GetDigestRegressions return the regressions of the last snapshot
+func (server *ServerMonitor) GetDigestRegressions() []digest.Regression {
+	server.digestMutex.Lock()
+	defer server.digestMutex.Unlock()
+	if server.digestTracker == nil {
+		return []digest.Regression{}
+	}
+	return append([]digest.Regression{}, server.digestTracker.Regressions...)
+}
+
+// GetDigestHistory return the trends of the digests between since and until,
+// only the one of dig when set
+func (server *ServerMonitor) GetDigestHistory(since time.Time, until time.Time, dig string) (DigestHistory, error) {
+	history := DigestHistory{Server: server.URL, Since: since, Until: until, Regressions: []digest.Regression{}, Trends: []digest.Trend{}}
+	if !server.ClusterGroup.Conf.MonitorDigestHistory {
+		return history, nil
+	}
+	store, err := server.getDigestStore()
+	if err != nil {
+		return history, err
+	}
+	snapshots, err := store.Query(since, until, dig)
+	if err != nil {
+		return history, err
+	}
+	history.Regressions = server.GetDigestRegressions()
+	server.digestMutex.Lock()
+	history.Trends = digest.Trends(snapshots, server.digestTracker.Statements)
+	server.digestMutex.Unlock()
+	return history, nil
+}
+
+// setDigestStates raise the regressions of the last snapshot of each server
+// at every monitor tick
+func (cluster *Cluster) setDigestStates() {
+	if !cluster.Conf.MonitorDigestHistory {
+		return
+	}
+	var regressions []string
+	for _, s := range cluster.Servers {
+		for _, r := range s.GetDigestRegressions() {
+			regressions = append(regressions, fmt.Sprintf("%s %s", s.URL, r))
+		}
+	}
+	if len(regressions) > 0 {
+		cluster.SetState("WARN0108", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0108"], strings.Join(regressions, ", ")), ErrFrom: "MON"})
+	}
+}
@@ -149,6 +149,9 @@ func (server *ServerMonitor) HasBackupPhysicalCookie() bool {
 }
 
 func (server *ServerMonitor) HasReadOnly() bool {
+	if server.DBVersion.IsPPostgreSQL() {
+		return server.Variables["DEFAULT_TRANSACTION_READ_ONLY"] == "ON"
+	}
 	return server.Variables["READ_ONLY"] == "ON"
 }
 
@@ -157,6 +160,9 @@ func (server *ServerMonitor) HasGtidStrictMode() bool {
 }
 
 func (server *ServerMonitor) HasBinlog() bool {
+	if server.DBVersion.IsPPostgreSQL() {
+		return server.Variables["WAL_LEVEL"] != "MINIMAL"
+	}
 	return server.Variables["LOG_BIN"] == "ON"
 }
 
@@ -464,6 +470,11 @@ func (server *ServerMonitor) IsInStateFailed() bool {
 	return false
 }
 
+// HasReplicationIssueVersion returns true for MariaDB versions affected by MDEV-20821
+func (server *ServerMonitor) HasReplicationIssueVersion() bool {
+	return server.DBVersion.IsMariaDB() && ((server.DBVersion.Major == 10 && server.DBVersion.Minor == 4 && server.DBVersion.Release < 12) || (server.DBVersion.Major == 10 && server.DBVersion.Minor == 5 && server.DBVersion.Release < 1))
+}
+
 func (server *ServerMonitor) IsReplicationBroken() bool {
 	if server.IsSQLThreadRunning() == false || server.IsIOThreadRunning() == false {
 		return true
@@ -0,0 +1,326 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/indexadvisor"
+	"github.com/signal18/replication-manager/utils/s18log"
+	"github.com/signal18/replication-manager/utils/schemadiff"
+)
+
+const (
+	ConstIndexAdviceMissing   = "missing"
+	ConstIndexAdviceRedundant = "redundant"
+)
+
+const (
+	// tables with less rows are read fast enough without index
+	indexAdvisorMinRows = 1000
+	// captured statements kept as samples of an advice
+	indexAdviceSamples = 3
+)
+
+// IndexAdviceSample is a captured statement an advice is based on
+type IndexAdviceSample struct {
+	Db    string `json:"db"`
+	Query string `json:"query"`
+}
+
+// IndexAdvice is an index to add or to drop on a table. The benefit of a
+// missing index is estimated by the executions, query time and rows examined
+// of the captured statements that read the table without a selective index.
+type IndexAdvice struct {
+	Id           string              `json:"id"`
+	Kind         string              `json:"kind"`
+	Schema       string              `json:"schema"`
+	Table        string              `json:"table"`
+	Index        string              `json:"index"`
+	Columns      []string            `json:"columns"`
+	CoveredBy    string              `json:"coveredBy,omitempty"`
+	DDL          string              `json:"ddl"`
+	TableRows    int64               `json:"tableRows"`
+	Queries      int                 `json:"queries"`
+	Executions   int                 `json:"executions"`
+	QueryTime    float64             `json:"queryTime"`
+	RowsExamined uint64              `json:"rowsExamined"`
+	ExplainRows  int64               `json:"explainRows"`
+	Samples      []IndexAdviceSample `json:"samples"`
+	alter        string
+	rollback     string
+}
+
+func (advice *IndexAdvice) addSample(msg s18log.SlowMessage) {
+	if len(advice.Samples) < indexAdviceSamples {
+		advice.Samples = append(advice.Samples, IndexAdviceSample{Db: msg.Db, Query: msg.Query})
+	}
+}
+
+// indexAdvisorCapture is a digest of the captured slow queries
+type indexAdvisorCapture struct {
+	sample       s18log.SlowMessage
+	executions   int
+	queryTime    float64
+	rowsExamined uint64
+}
+
+// getIndexAdvisorCaptures group the captured slow queries by digest
+func (server *ServerMonitor) getIndexAdvisorCaptures() []*indexAdvisorCapture {
+	server.SlowLog.L.Lock()
+	buffer := append([]s18log.SlowMessage{}, server.SlowLog.Buffer...)
+	server.SlowLog.L.Unlock()
+	digests := make(map[string]*indexAdvisorCapture)
+	var captures []*indexAdvisorCapture
+	for _, msg := range buffer {
+		if msg.Query == "" || msg.Admin {
+			continue
+		}
+		digest := msg.Digest
+		if digest == "" {
+			digest = dbhelper.GetQueryDigest(msg.Query)
+		}
+		c, ok := digests[digest]
+		if !ok {
+			c = &indexAdvisorCapture{sample: msg}
+			digests[digest] = c
+			captures = append(captures, c)
+		}
+		c.executions++
+		c.queryTime += msg.TimeMetrics["queryTime"]
+		c.rowsExamined += msg.NumberMetrics["rowsExamined"]
+	}
+	return captures
+}
+
+// getExplainRow return the explain row of a table of the statement
+func getExplainRow(plan []dbhelper.Explain, a *indexadvisor.Access) (dbhelper.Explain, bool) {
+	for _, p := range plan {
+		if p.Table.String == a.Name() {
+			return p, true
+		}
+	}
+	return dbhelper.Explain{}, false
+}
+
+// GetIndexAdvice parse the captured slow queries, explain them and compare
+// the columns each table is read on with its indexes. A missing index is
+// suggested for the tables read without a selective index, redundant
+// indexes are reported for the tables of the captured statements.
+func (server *ServerMonitor) GetIndexAdvice() ([]IndexAdvice, error) {
+	cluster := server.ClusterGroup
+	if server.DBVersion == nil || server.DBVersion.IsPPostgreSQL() {
+		return nil, errors.New("Index advisor needs a MariaDB or MySQL server")
+	}
+	captures := server.getIndexAdvisorCaptures()
+	advices := []IndexAdvice{}
+	if len(captures) == 0 {
+		return advices, nil
+	}
+	tables := server.DictTables
+	if len(tables) == 0 {
+		var logs string
+		var err error
+		tables, _, logs, err = dbhelper.GetTables(server.Conn, server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not fetch tables %s", err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	conn, err := server.getExplainConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	definitions := make(map[string]*schemadiff.Table)
+	getDefinition := func(key string, schema string, table string) *schemadiff.Table {
+		if t, ok := definitions[key]; ok {
+			return t
+		}
+		ddl, logs, err := dbhelper.GetTableDDL(conn, server.DBVersion, schema, table)
+		cluster.LogSQL(logs, err, server.URL, "Monitor", LvlDbg, "Could not fetch table definition %s", err)
+		var t *schemadiff.Table
+		if err == nil {
+			t = schemadiff.Parse(ddl)
+		}
+		definitions[key] = t
+		return t
+	}
+
+	missing := make(map[string]*IndexAdvice)
+	samples := make(map[string][]s18log.SlowMessage)
+	var keys []string
+	for _, c := range captures {
+		stmt, err := indexadvisor.Parse(c.sample.Query, c.sample.Db)
+		if err != nil {
+			continue
+		}
+		resolved := make(map[string]*schemadiff.Table)
+		for _, a := range stmt.Tables {
+			if _, ok := tables[a.Key()]; !ok {
+				continue
+			}
+			if t := getDefinition(a.Key(), a.Schema, a.Table); t != nil {
+				resolved[a.Key()] = t
+				if len(samples[a.Key()]) == 0 {
+					keys = append(keys, a.Key())
+				}
+				samples[a.Key()] = append(samples[a.Key()], c.sample)
+			}
+		}
+		stmt.Resolve(resolved)
+		plan, err := server.getConnExplain(conn, c.sample.Db, c.sample.Query)
+		if err != nil {
+			continue
+		}
+		for _, a := range stmt.Tables {
+			t, ok := resolved[a.Key()]
+			meta := tables[a.Key()]
+			if !ok || meta.TableRows < indexAdvisorMinRows {
+				continue
+			}
+			row, ok := getExplainRow(plan, a)
+			if !ok {
+				continue
+			}
+			rows, _ := strconv.ParseInt(row.Rows.String, 10, 64)
+			scan := row.Type.String == "ALL" || row.Type.String == "index" || row.Key.String == ""
+			if !scan && rows*10 < meta.TableRows {
+				continue
+			}
+			columns, equality := indexadvisor.Candidate(a, t)
+			indexes := indexadvisor.TableIndexes(t)
+			if len(columns) == 0 || indexadvisor.Covered(columns, equality, indexes) {
+				continue
+			}
+			name := indexadvisor.IndexName(columns, indexes)
+			id := ConstIndexAdviceMissing + "-" + a.Key() + "-" + name
+			advice, ok := missing[id]
+			if !ok {
+				alter := indexadvisor.AddIndex(name, columns)
+				advice = &IndexAdvice{
+					Id:        id,
+					Kind:      ConstIndexAdviceMissing,
+					Schema:    a.Schema,
+					Table:     a.Table,
+					Index:     name,
+					Columns:   columns,
+					DDL:       "ALTER TABLE " + dbhelper.QuoteIdentifier(a.Schema) + "." + dbhelper.QuoteIdentifier(a.Table) + " " + alter,
+					TableRows: meta.TableRows,
+					alter:     alter,
+					rollback:  indexadvisor.DropIndex(name),
+				}
+				missing[id] = advice
+			}
+			advice.Queries++
+			advice.Executions += c.executions
+			advice.QueryTime += c.queryTime
+			advice.RowsExamined += c.rowsExamined
+			if rows > advice.ExplainRows {
+				advice.ExplainRows = rows
+			}
+			advice.addSample(c.sample)
+		}
+	}
+	for _, advice := range missing {
+		advices = append(advices, *advice)
+	}
+	sort.Slice(advices, func(i, j int) bool { return advices[i].QueryTime > advices[j].QueryTime })
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		t := definitions[key]
+		meta := tables[key]
+		for _, r := range indexadvisor.Redundant(indexadvisor.TableIndexes(t)) {
+			alter := indexadvisor.DropIndex(r.Index.Name)
+			advice := IndexAdvice{
+				Id:        ConstIndexAdviceRedundant + "-" + key + "-" + r.Index.Name,
+				Kind:      ConstIndexAdviceRedundant,
+				Schema:    meta.TableSchema,
+				Table:     meta.TableName,
+				Index:     r.Index.Name,
+				Columns:   r.Index.Columns,
+				CoveredBy: r.CoveredBy.Name,
+				DDL:       "ALTER TABLE " + dbhelper.QuoteIdentifier(meta.TableSchema) + "." + dbhelper.QuoteIdentifier(meta.TableName) + " " + alter,
+				TableRows: meta.TableRows,
+				alter:     alter,
+				rollback:  "ADD " + r.Index.Definition,
+			}
+			for _, msg := range samples[key] {
+				advice.addSample(msg)
+			}
+			advices = append(advices, advice)
+		}
+	}
+	return advices, nil
+}
+
+// validateIndexAdvice explain the samples of the advice on a server where it
+// was applied, an added index has to be used by a sample and a dropped index
+// must not leave a sample reading the whole table
+func (server *ServerMonitor) validateIndexAdvice(advice IndexAdvice) error {
+	conn, err := server.getExplainConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	used := false
+	for _, sample := range advice.Samples {
+		plan, err := server.getConnExplain(conn, sample.Db, sample.Query)
+		if err != nil {
+			return err
+		}
+		stmt, err := indexadvisor.Parse(sample.Query, sample.Db)
+		if err != nil {
+			continue
+		}
+		for _, a := range stmt.Tables {
+			if a.Schema != advice.Schema || a.Table != advice.Table {
+				continue
+			}
+			row, ok := getExplainRow(plan, a)
+			if !ok {
+				continue
+			}
+			if row.Key.String == advice.Index {
+				used = true
+			}
+			if advice.Kind == ConstIndexAdviceRedundant && row.Type.String == "ALL" {
+				return fmt.Errorf("Statement reads the whole table %s.%s without index %s: %s", advice.Schema, advice.Table, advice.Index, sample.Query)
+			}
+		}
+	}
+	if advice.Kind == ConstIndexAdviceMissing && !used {
+		return fmt.Errorf("Index %s is not used by the captured statements", advice.Index)
+	}
+	return nil
+}
+
+// ApplyIndexAdvice queue the index change of an advice as a rolling schema
+// change validated on the first altered replica
+func (server *ServerMonitor) ApplyIndexAdvice(id string) (*SchemaChange, error) {
+	advices, err := server.GetIndexAdvice()
+	if err != nil {
+		return nil, err
+	}
+	for _, advice := range advices {
+		if advice.Id != id {
+			continue
+		}
+		advice := advice
+		server.ClusterGroup.LogPrintf(LvlInfo, "Applying index advice %s: %s", id, advice.DDL)
+		return server.ClusterGroup.AlterTableWithValidation(advice.Schema, advice.Table, advice.alter, advice.rollback, func(s *ServerMonitor) error {
+			return s.validateIndexAdvice(advice)
+		})
+	}
+	return nil, fmt.Errorf("Index advice %s not found", id)
+}
@@ -31,6 +31,7 @@ import (
 	dumplingext "github.com/pingcap/dumpling/v4/export"
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/misc"
 	river "github.com/signal18/replication-manager/utils/river"
 	"github.com/signal18/replication-manager/utils/s18log"
@@ -81,6 +82,7 @@ func (server *ServerMonitor) JobInsertTaks(task string, port string, repmanhost
 	if task != "" {
 		res, err := conn.Exec("INSERT INTO replication_manager_schema.jobs(task, port,server,start) VALUES('" + task + "'," + port + ",'" + repmanhost + "', NOW())")
 		if err == nil {
+			server.ClusterGroup.LogEvent(journal.ConstEventJob, "start", server.URL, "", "Job %s requested", task)
 			return res.LastInsertId()
 		}
 		server.ClusterGroup.LogPrintf(LvlErr, "Job can't insert job %s", err)
@@ -114,16 +116,24 @@ func (server *ServerMonitor) JobBackupPhysical() (int64, error) {
 	var backupext string = ".xbtream"
 	if server.ClusterGroup.Conf.CompressBackups {
 		backupext = backupext + ".gz"
+	}
+	bck := server.ClusterGroup.startBackupCatalogEntry(server, server.ClusterGroup.Conf.BackupPhysicalType, server.ClusterGroup.Conf.BackupPhysicalType+backupext)
+	if server.ClusterGroup.Conf.CompressBackups {
 		port, err = server.ClusterGroup.SSTRunReceiverToGZip(server.GetMyBackupDirectory()+server.ClusterGroup.Conf.BackupPhysicalType+backupext, ConstJobCreateFile)
 		if err != nil {
+			server.ClusterGroup.finishBackupCatalogEntry(bck, err)
 			return 0, nil
 		}
 	} else {
 		port, err = server.ClusterGroup.SSTRunReceiverToFile(server.GetMyBackupDirectory()+server.ClusterGroup.Conf.BackupPhysicalType+backupext, ConstJobCreateFile)
 		if err != nil {
+			server.ClusterGroup.finishBackupCatalogEntry(bck, err)
 			return 0, nil
 		}
 	}
+	server.ClusterGroup.SSTSetReceiverDone(port, func(err error) {
+		server.ClusterGroup.finishBackupCatalogEntry(bck, err)
+	})
 
 	jobid, err := server.JobInsertTaks(server.ClusterGroup.Conf.BackupPhysicalType, port, server.ClusterGroup.Conf.MonitorAddress)
 
@@ -388,11 +398,20 @@ func (server *ServerMonitor) JobZFSSnapBack() (int64, error) {
 }
 
 func (server *ServerMonitor) JobReseedMyLoader() {
+	span := server.startJobSpan("reseed-myloader")
+	defer span.End()
 
 	threads := strconv.Itoa(server.ClusterGroup.Conf.BackupLogicalLoadThreads)
+	dir := server.ClusterGroup.master.GetMasterBackupDirectory()
+	dir, cleanup, err := server.ClusterGroup.getClearBackupFiles(dir, getBackupCatalogFiles(dir))
+	if err != nil {
+		server.ClusterGroup.LogPrintf(LvlErr, "MyLoader backup decryption: %s", err)
+		return
+	}
+	defer cleanup()
 
 	myargs := strings.Split(strings.ReplaceAll(server.ClusterGroup.Conf.BackupMyLoaderOptions, "  ", " "), " ")
-	myargs = append(myargs, "--directory="+server.ClusterGroup.master.GetMasterBackupDirectory(), "--threads="+threads, "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+server.ClusterGroup.GetDbUser(), "--password="+server.ClusterGroup.GetDbPass())
+	myargs = append(myargs, "--directory="+dir, "--threads="+threads, "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+server.ClusterGroup.GetDbUser(), "--password="+server.ClusterGroup.GetDbPass())
 	dumpCmd := exec.Command(server.ClusterGroup.GetMyLoaderPath(), myargs...)
 
 	server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s", strings.Replace(dumpCmd.String(), server.ClusterGroup.GetDbPass(), "XXXX", 1))
@@ -433,6 +452,8 @@ func (server *ServerMonitor) JobReseedMyLoader() {
 }
 
 func (server *ServerMonitor) JobReseedBackupScript() {
+	span := server.startJobSpan("reseed-script")
+	defer span.End()
 
 	cmd := exec.Command(server.ClusterGroup.Conf.BackupLoadScript, misc.Unbracket(server.Host), misc.Unbracket(server.ClusterGroup.master.Host))
 
@@ -533,9 +554,11 @@ func (server *ServerMonitor) JobsCheckRunning() error {
 		return err
 	}
 	defer rows.Close()
+	running := make(map[string]int)
 	for rows.Next() {
 		var task DBTask
 		rows.Scan(&task.task, &task.ct)
+		running[task.task] = task.ct
 		if task.ct > 0 {
 			if task.ct > 10 {
 				server.ClusterGroup.StateMachine.AddState("ERR00060", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(server.ClusterGroup.GetErrorList()["ERR00060"], server.URL), ErrFrom: "JOB", ServerUrl: server.URL})
@@ -578,6 +601,27 @@ func (server *ServerMonitor) JobsCheckRunning() error {
 
 	}
 
+	server.JobsRunning = running
+	server.JobsGetDurations()
+	return nil
+}
+
+// JobsGetDurations keep the duration of the last finished job of each task
+func (server *ServerMonitor) JobsGetDurations() error {
+	rows, err := server.Conn.Queryx("SELECT j.task, TIMESTAMPDIFF(SECOND, j.start, j.end) FROM replication_manager_schema.jobs j JOIN (SELECT task, max(id) as id FROM replication_manager_schema.jobs WHERE done=1 AND end IS NOT NULL GROUP BY task) l ON j.id=l.id")
+	if err != nil {
+		server.ClusterGroup.LogPrintf(LvlDbg, "Scheduler error fetching job durations %s", err)
+		return err
+	}
+	defer rows.Close()
+	durations := make(map[string]int64)
+	for rows.Next() {
+		var task string
+		var duration int64
+		rows.Scan(&task, &duration)
+		durations[task] = duration
+	}
+	server.JobDurations = durations
 	return nil
 }
 
@@ -632,11 +676,13 @@ func (server *ServerMonitor) GetMasterBackupDirectory() string {
 
 }
 
-func (server *ServerMonitor) JobBackupLogical() error {
+func (server *ServerMonitor) JobBackupLogical() (err error) {
 	//server can be nil as no dicovered master
 	if server == nil {
 		return errors.New("No server define")
 	}
+	span := server.startJobSpan("logical-backup")
+	defer func() { endSpan(span, err) }()
 	server.ClusterGroup.LogPrintf(LvlInfo, "Request logical backup %s for: %s", server.ClusterGroup.Conf.BackupLogicalType, server.URL)
 	if server.IsDown() {
 		return errors.New("Can't backup when server down")
@@ -710,6 +756,23 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		river.NewRiver(cfg)
 	}
 
+	// mydumper files are listed when the dump ends
+	var dumperr error
+	if server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeMysqldump || server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeMydumper {
+		var files []string
+		if server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeMysqldump {
+			files = append(files, "mysqldump.sql.gz")
+		}
+		bck := server.ClusterGroup.startBackupCatalogEntry(server, server.ClusterGroup.Conf.BackupLogicalType, files...)
+		defer func() {
+			bckerr := err
+			if bckerr == nil {
+				bckerr = dumperr
+			}
+			server.ClusterGroup.finishBackupCatalogEntry(bck, bckerr)
+		}()
+	}
+
 	// Blocking DDL
 	if server.ClusterGroup.Conf.BackupLogicalType == config.ConstBackupLogicalTypeMysqldump {
 		file, err2 := server.ClusterGroup.CreateTmpClientConfFile()
@@ -738,12 +801,25 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		dumpCmd := exec.Command(server.ClusterGroup.GetMysqlDumpPath(), dumpargs...)
 
 		server.ClusterGroup.LogPrintf(LvlInfo, "Command: %s ", strings.Replace(dumpCmd.String(), server.ClusterGroup.GetDbPass(), "XXXX", -1))
-		f, err := os.Create(server.GetMyBackupDirectory() + "mysqldump.sql.gz")
+		dumpfile := server.GetMyBackupDirectory() + "mysqldump.sql.gz"
+		f, err := os.Create(dumpfile)
 		if err != nil {
 			server.ClusterGroup.LogPrintf(LvlErr, "Error mysqldump backup request: %s", err)
 			return err
 		}
-		wf := bufio.NewWriter(f)
+		var out io.Writer = f
+		sw := server.ClusterGroup.createBackupStorageWriter(dumpfile)
+		if sw != nil {
+			out = io.MultiWriter(f, sw)
+		}
+		ew, err := server.ClusterGroup.NewBackupWriter(out)
+		if err != nil {
+			server.ClusterGroup.LogPrintf(LvlErr, "Error mysqldump backup encryption: %s", err)
+			sw.finish(err)
+			f.Close()
+			return err
+		}
+		wf := bufio.NewWriter(ew)
 		gw := gzip.NewWriter(wf)
 		//fw := bufio.NewWriter(gw)
 		dumpCmd.Stdout = gw
@@ -751,6 +827,8 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		err = dumpCmd.Start()
 		if err != nil {
 			server.ClusterGroup.LogPrintf(LvlErr, "Error backup request: %s", err)
+			sw.finish(err)
+			f.Close()
 			return err
 		}
 		var wg sync.WaitGroup
@@ -765,12 +843,18 @@ func (server *ServerMonitor) JobBackupLogical() error {
 
 			if err != nil {
 				server.ClusterGroup.LogPrintf(LvlErr, "mysqldump: %s", err)
+				dumperr = err
 			} else {
 				server.SetBackupLogicalCookie()
 			}
 			gw.Flush()
 			gw.Close()
 			wf.Flush()
+			if err := ew.Close(); err != nil && dumperr == nil {
+				server.ClusterGroup.LogPrintf(LvlErr, "mysqldump encryption: %s", err)
+				dumperr = err
+			}
+			sw.finish(dumperr)
 			f.Close()
 		}()
 		wg.Wait()
@@ -828,8 +912,15 @@ func (server *ServerMonitor) JobBackupLogical() error {
 		wg.Wait()
 		if err := dumpCmd.Wait(); err != nil {
 			server.ClusterGroup.LogPrintf(LvlErr, "MyDumper: %s", err)
+			dumperr = err
+		} else if err := server.encryptMyDumperFiles(); err != nil {
+			server.ClusterGroup.LogPrintf(LvlErr, "MyDumper encryption: %s", err)
+			dumperr = err
 		} else {
 			server.SetBackupLogicalCookie()
+			for _, file := range getBackupCatalogFiles(server.GetMyBackupDirectory()) {
+				server.ClusterGroup.uploadBackupStorageFile(server.GetMyBackupDirectory() + file)
+			}
 		}
 	}
 
@@ -838,6 +929,24 @@ func (server *ServerMonitor) JobBackupLogical() error {
 	return nil
 }
 
+// encryptMyDumperFiles encrypt the table files of the last mydumper backup,
+// metadata stays in clear for the binlog coordinates
+func (server *ServerMonitor) encryptMyDumperFiles() error {
+	if !server.ClusterGroup.Conf.BackupEncrypt {
+		return nil
+	}
+	dir := server.GetMyBackupDirectory()
+	for _, file := range getBackupCatalogFiles(dir) {
+		if file == "metadata" {
+			continue
+		}
+		if err := server.ClusterGroup.encryptBackupFile(dir + file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (server *ServerMonitor) copyLogs(r io.Reader) {
 	//	buf := make([]byte, 1024)
 	s := bufio.NewScanner(r)
@@ -850,7 +959,9 @@ func (server *ServerMonitor) copyLogs(r io.Reader) {
 	}
 }
 
-func (server *ServerMonitor) BackupRestic() error {
+func (server *ServerMonitor) BackupRestic() (err error) {
+	span := server.startJobSpan("restic-backup")
+	defer func() { endSpan(span, err) }()
 
 	var stdout, stderr []byte
 	var errStdout, errStderr error
@@ -922,7 +1033,9 @@ func (server *ServerMonitor) copyAndCapture(w io.Writer, r io.Reader) ([]byte, e
 
 }
 
-func (server *ServerMonitor) JobRunViaSSH() error {
+func (server *ServerMonitor) JobRunViaSSH() (err error) {
+	span := server.startJobSpan("ssh")
+	defer func() { endSpan(span, err) }()
 	if server.ClusterGroup.IsInFailover() {
 		return errors.New("Cancel dbjob via ssh during failover")
 	}
@@ -988,7 +1101,9 @@ func (server *ServerMonitor) JobRunViaSSH() error {
 	return nil
 }
 
-func (server *ServerMonitor) JobBackupBinlog(binlogfile string) error {
+func (server *ServerMonitor) JobBackupBinlog(binlogfile string) (err error) {
+	span := server.startJobSpan("binlog-backup")
+	defer func() { endSpan(span, err) }()
 	if !server.IsMaster() {
 		return errors.New("Copy only master binlog")
 	}
@@ -1015,7 +1130,11 @@ func (server *ServerMonitor) JobBackupBinlog(binlogfile string) error {
 		return cmdrunErr
 	}
 
-	// Get
+	if err := server.ClusterGroup.encryptBackupFile(server.GetMyBackupDirectory() + binlogfile); err != nil {
+		server.ClusterGroup.LogPrintf(LvlErr, "Failed to encrypt binlog %s of %s: %s", binlogfile, server.URL, err)
+		return err
+	}
+	server.ClusterGroup.uploadBackupStorageFile(server.GetMyBackupDirectory() + binlogfile)
 
 	return nil
 }
@@ -1054,6 +1173,7 @@ func (server *ServerMonitor) JobBackupBinlogPurge(binlogfile string) error {
 		if strings.HasPrefix(file.Name(), prefix) && !ok {
 			server.ClusterGroup.LogPrintf(LvlInfo, "Purging binlog file %s", file.Name())
 			os.Remove(server.GetMyBackupDirectory() + "/" + file.Name())
+			server.ClusterGroup.removeBackupStorageFile(server.GetMyBackupDirectory() + file.Name())
 		}
 	}
 	return nil
@@ -1114,7 +1234,9 @@ func (cluster *Cluster) CreateTmpClientConfFile() (string, error) {
 
 }
 
-func (cluster *Cluster) JobRejoinMysqldumpFromSource(source *ServerMonitor, dest *ServerMonitor) error {
+func (cluster *Cluster) JobRejoinMysqldumpFromSource(source *ServerMonitor, dest *ServerMonitor) (err error) {
+	span := dest.startJobSpan("rejoin-mysqldump")
+	defer func() { endSpan(span, err) }()
 	cluster.LogPrintf(LvlInfo, "Rejoining from direct mysqldump from %s", source.URL)
 	dest.StopSlave()
 	usegtid := dest.JobGetDumpGtidParameter()
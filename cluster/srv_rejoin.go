@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/journal"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/state"
 )
@@ -61,8 +62,15 @@ func (server *ServerMonitor) RejoinMaster() error {
 	if server.ClusterGroup.master != nil {
 		if server.URL != server.ClusterGroup.master.URL {
 			server.ClusterGroup.SetState("WARN0022", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0022"], server.URL, server.ClusterGroup.master.URL), ErrFrom: "REJOIN"})
+			server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "start", server.URL, "", "Rejoining %s to master %s", server.URL, server.ClusterGroup.master.URL)
 			server.RejoinScript()
-			if server.ClusterGroup.Conf.MultiMasterGrouprep {
+			if server.ClusterGroup.IsPostgresStreaming() {
+				err := server.rejoinPostgres(server.ClusterGroup.getCrashFromJoiner(server.URL))
+				if err != nil {
+					server.ClusterGroup.LogPrintf(LvlErr, "Postgres rejoin failed on %s: %s", server.URL, err)
+					server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "failed", server.URL, "", "Postgres rejoin failed: %s", err)
+				}
+			} else if server.ClusterGroup.Conf.MultiMasterGrouprep {
 				server.ClusterGroup.LogPrintf("INFO", "Group replication rejoin  %s server to PRIMARY ", server.URL)
 				server.StartGroupReplication()
 
@@ -77,15 +85,18 @@ func (server *ServerMonitor) RejoinMaster() error {
 					server.ClusterGroup.SetState("ERR00066", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00066"], server.URL, server.ClusterGroup.master.URL), ErrFrom: "REJOIN"})
 					if server.ClusterGroup.oldMaster != nil {
 						if server.ClusterGroup.oldMaster.URL == server.URL {
+							server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "sst", server.URL, "", "No crash info, rejoin old master via state transfer")
 							server.RejoinMasterSST()
 							return nil
 						}
 					}
 					if server.ClusterGroup.Conf.Autoseed {
+						server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "reseed", server.URL, "", "No crash info, reseed from master")
 						server.ReseedMasterSST()
 						return nil
 					} else {
 						server.ClusterGroup.LogPrintf("INFO", "No auto seeding %s", server.URL)
+						server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "cancel", server.URL, "", "No crash info and no auto seeding")
 						return errors.New("No Autoseed")
 					}
 				} //crash info is available
@@ -99,7 +110,12 @@ func (server *ServerMonitor) RejoinMaster() error {
 					err := server.RejoinMasterSST()
 					if err != nil {
 						server.ClusterGroup.LogPrintf("ERROR", "State transfer rejoin failed")
+						server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "failed", server.URL, "", "Incremental and state transfer rejoin failed")
+					} else {
+						server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "sst", server.URL, "", "Rejoined via state transfer after incremental failure")
 					}
+				} else {
+					server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "incremental", server.URL, "", "Rejoined incrementally")
 				}
 				if server.ClusterGroup.Conf.AutorejoinBackupBinlog == true {
 					server.saveBinlog(crash)
@@ -115,6 +131,7 @@ func (server *ServerMonitor) RejoinMaster() error {
 		if server.ClusterGroup.lastmaster != nil {
 			if server.ClusterGroup.lastmaster.ServerID == server.ServerID {
 				server.ClusterGroup.LogPrintf("INFO", "Rediscovering same master from last seen master: %s", server.URL)
+				server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "rediscover", server.URL, "", "Rediscovering same master from last seen master")
 				server.ClusterGroup.master = server
 				server.SetMaster()
 				server.SetReadWrite()
@@ -122,6 +139,7 @@ func (server *ServerMonitor) RejoinMaster() error {
 			} else {
 				if server.ClusterGroup.Conf.FailRestartUnsafe == false {
 					server.ClusterGroup.LogPrintf("INFO", "Rediscovering not the master from last seen master: %s", server.URL)
+					server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "as-slave", server.URL, "", "Rediscovering not the master from last seen master")
 					server.rejoinMasterAsSlave()
 					// if consul or internal proxy need to adapt read only route to new slaves
 					server.ClusterGroup.backendStateChangeProxies()
@@ -494,6 +512,9 @@ func (server *ServerMonitor) rejoinSlave(ss dbhelper.SlaveStatus) error {
 		if server.ClusterGroup.master.IsDown() && server.ClusterGroup.Conf.FailRestartUnsafe == false {
 			server.HaveNoMasterOnStart = true
 		}
+		if server.ClusterGroup.IsPostgresStreaming() {
+			return server.rejoinPostgres(server.ClusterGroup.getCrashFromMaster(server.ClusterGroup.master.URL))
+		}
 		if mycurrentmaster.IsMaxscale == false && server.ClusterGroup.Conf.MultiTierSlave == false && server.ClusterGroup.Conf.ReplicationNoRelay {
 
 			if server.HasGTIDReplication() {
@@ -743,3 +764,52 @@ func (server *ServerMonitor) UsedGtidAtElection(crash *Crash) bool {
 	return false
 
 }
+
+// rejoinPostgres make a server a streaming standby of the current primary. A
+// server that did not write WAL past the promotion of the primary follow the
+// new timeline, a diverged one is rewound or cloned by the rejoin script
+func (server *ServerMonitor) rejoinPostgres(crash *Crash) error {
+	master := server.ClusterGroup.master
+	diverged := true
+	if crash != nil && crash.FailoverIOGtid != nil && server.CurrentGtid != nil {
+		diverged = server.CurrentGtid.GetSeqServerIdNos(0) > crash.FailoverIOGtid.GetSeqServerIdNos(0)
+	}
+	server.ClusterGroup.LogPrintf(LvlInfo, "Rejoining %s as standby of %s, diverged %t", server.URL, master.URL, diverged)
+	logs, err := server.SetPostgresPrimary(master)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Rejoin", LvlErr, "Failed to set primary_conninfo on %s, %s", server.URL, err)
+	if !diverged && server.IsSlave {
+		if err == nil {
+			server.ClusterGroup.LogEvent(journal.ConstEventRejoin, "standby", server.URL, "", "Standby follow new primary %s", master.URL)
+		}
+		return err
+	}
+	method := "standby"
+	if diverged {
+		method = server.ClusterGroup.Conf.MasterSlavePgRejoinMethod
+	}
+	err = server.rejoinPostgresScript(method, master)
+	if err != nil && method == "rewind" {
+		server.ClusterGroup.LogPrintf(LvlErr, "Rewind failed on %s, rejoin with a base backup: %s", server.URL, err)
+		err = server.rejoinPostgresScript("basebackup", master)
+	}
+	return err
+}
+
+// rejoinPostgresScript run the script that restart a server in recovery, with
+// method standby, rewind or basebackup
+func (server *ServerMonitor) rejoinPostgresScript(method string, master *ServerMonitor) error {
+	script := server.ClusterGroup.Conf.MasterSlavePgRejoinScript
+	if script == "" {
+		return errors.New("No replication-master-slave-pg-rejoin-script to restart the server as standby")
+	}
+	server.ClusterGroup.LogPrintf(LvlInfo, "Calling Postgres rejoin script with method %s on %s", method, server.URL)
+	cmd := exec.Command(script, method, misc.Unbracket(server.Host), server.Port, misc.Unbracket(master.Host), master.Port)
+	cmd.Env = append(os.Environ(), "REPLICATION_USER="+server.ClusterGroup.GetRplUser(), "REPLICATION_PASSWORD="+server.ClusterGroup.GetRplPass())
+	out, err := cmd.CombinedOutput()
+	server.ClusterGroup.LogPrintf(LvlInfo, "Postgres rejoin script complete: %s", string(out))
+	if err != nil {
+		return err
+	}
+	server.ClusterGroup.LogEvent(journal.ConstEventRejoin, method, server.URL, "", "Rejoined as standby of %s with %s", master.URL, method)
+	return nil
+}
@@ -0,0 +1,112 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/signal18/replication-manager/cluster/nbc"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/gtid"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// rejoinTestProxy count the backend state changes of a proxy
+type rejoinTestProxy struct {
+	DatabaseProxy
+	changes int
+}
+
+func (proxy *rejoinTestProxy) GetType() string { return config.ConstProxyHaproxy }
+
+func (proxy *rejoinTestProxy) GetURL() string { return "haproxy:3306" }
+
+func (proxy *rejoinTestProxy) BackendsStateChange() { proxy.changes++ }
+
+// newPostgresRejoinTestCluster return a streaming cluster with a primary db1
+// and a rejoin script that record its calls and fail the methods of fail
+func newPostgresRejoinTestCluster(t *testing.T, fail string) (*Cluster, *ServerMonitor, func() []string, func()) {
+	dir, err := ioutil.TempDir("", "pgrejoin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := dir + "/rejoin.sh"
+	calls := dir + "/calls"
+	content := "#!/bin/sh\necho \"$*\" \"$REPLICATION_USER\" \"$REPLICATION_PASSWORD\" >> " + calls + "\ncase \"" + fail + "\" in *\"$1\"*) exit 1;; esac\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &Cluster{StateMachine: new(state.StateMachine), rejoinCond: nbc.New()}
+	cluster.StateMachine.Init()
+	cluster.Conf.MasterSlavePgStream = true
+	cluster.Conf.MasterSlavePgRejoinScript = script
+	cluster.Conf.MasterSlavePgRejoinMethod = "rewind"
+	cluster.Conf.Secrets = map[string]config.Secret{"replication-credential": {Value: "repl:secret"}}
+	cluster.master = &ServerMonitor{Id: "db1", URL: "db1:5432", Host: "db1", Port: "5432", ClusterGroup: cluster}
+	server := &ServerMonitor{Id: "db2", URL: "db2:5432", Host: "db2", Port: "5432", ClusterGroup: cluster}
+	cluster.Servers = serverList{cluster.master, server}
+	readCalls := func() []string {
+		out, _ := ioutil.ReadFile(calls)
+		return strings.Fields(strings.Replace(strings.TrimSpace(string(out)), " ", "_", -1))
+	}
+	return cluster, server, readCalls, func() { os.RemoveAll(dir) }
+}
+
+func TestRejoinPostgres(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		slave   bool
+		fail    string
+		calls   []string
+	}{
+		{"diverged", "0-0-120", false, "", []string{"rewind_db2_5432_db1_5432_repl_secret"}},
+		{"unknown position", "", false, "", []string{"rewind_db2_5432_db1_5432_repl_secret"}},
+		{"rewind failed", "0-0-120", false, "rewind", []string{"rewind_db2_5432_db1_5432_repl_secret", "basebackup_db2_5432_db1_5432_repl_secret"}},
+		{"not diverged", "0-0-100", false, "", []string{"standby_db2_5432_db1_5432_repl_secret"}},
+		{"following standby", "0-0-100", true, "", nil},
+	}
+	for _, tt := range tests {
+		_, server, readCalls, cleanup := newPostgresRejoinTestCluster(t, tt.fail)
+		if tt.current != "" {
+			server.CurrentGtid = gtid.NewList(tt.current)
+		}
+		server.IsSlave = tt.slave
+		server.rejoinPostgres(&Crash{URL: server.URL, FailoverIOGtid: gtid.NewList("0-0-100")})
+		calls := readCalls()
+		if strings.Join(calls, ",") != strings.Join(tt.calls, ",") {
+			t.Errorf("%s: expected script calls %v, got %v", tt.name, tt.calls, calls)
+		}
+		cleanup()
+	}
+}
+
+func TestRejoinMasterPostgresProxies(t *testing.T) {
+	cluster, server, readCalls, cleanup := newPostgresRejoinTestCluster(t, "")
+	defer cleanup()
+	proxy := &rejoinTestProxy{}
+	cluster.Proxies = proxyList{proxy}
+	cluster.Crashes = crashList{{URL: server.URL, FailoverIOGtid: gtid.NewList("0-0-100")}}
+	server.CurrentGtid = gtid.NewList("0-0-120")
+
+	if err := server.RejoinMaster(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := readCalls(); len(calls) != 1 || !strings.HasPrefix(calls[0], "rewind_db2") {
+		t.Errorf("Expected the old primary rewound, got %v", calls)
+	}
+	// the read routes of the proxies include the rejoined standby
+	if proxy.changes != 1 {
+		t.Errorf("Expected the proxies notified of the rejoin once, got %d", proxy.changes)
+	}
+}
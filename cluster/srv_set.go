@@ -122,6 +122,12 @@ func (server *ServerMonitor) SetSemiSyncLeader() (string, error) {
 
 func (server *ServerMonitor) SetReadOnly() (string, error) {
 	logs := ""
+	if server.DBVersion.IsPPostgreSQL() {
+		if server.IsReadOnly() {
+			return logs, nil
+		}
+		return dbhelper.PostgresSetReadOnly(server.Conn, true)
+	}
 	if !server.IsReadOnly() {
 		logs, err := dbhelper.SetReadOnly(server.Conn, true)
 		if err != nil {
@@ -137,6 +143,20 @@ func (server *ServerMonitor) SetReadOnly() (string, error) {
 	return logs, nil
 }
 
+// SetPostgresPrimary point the streaming replication of a standby to a primary
+func (server *ServerMonitor) SetPostgresPrimary(master *ServerMonitor) (string, error) {
+	if server.Conn == nil {
+		return "", errors.New("No database connection pool")
+	}
+	return dbhelper.PostgresSetPrimaryConnInfo(server.Conn, dbhelper.ChangeMasterOpt{
+		Host:     master.Host,
+		Port:     master.Port,
+		User:     server.ClusterGroup.GetRplUser(),
+		Password: server.ClusterGroup.GetRplPass(),
+		SSL:      server.ClusterGroup.Conf.ReplicationSSL,
+	}, server.Id)
+}
+
 func (server *ServerMonitor) SetLongQueryTime(queryTime string) (string, error) {
 
 	log, err := dbhelper.SetLongQueryTime(server.Conn, queryTime)
@@ -154,6 +174,14 @@ func (server *ServerMonitor) SetReadWrite() error {
 		server.ClusterGroup.LogPrintf(LvlErr, "Cancel ReadWrite on %s caused by arbitration failed ", server.URL)
 		return errors.New("Arbitration is Failed")
 	}
+	if server.DBVersion.IsPPostgreSQL() {
+		if server.IsReadOnly() {
+			logs, err := dbhelper.PostgresSetReadOnly(server.Conn, false)
+			server.ClusterGroup.LogSQL(logs, err, server.URL, "Rejoin", LvlErr, "Failed Set Read Write on %s : %s", server.URL, err)
+			return err
+		}
+		return nil
+	}
 	if server.IsReadOnly() {
 		logs, err := dbhelper.SetReadOnly(server.Conn, false)
 		server.ClusterGroup.LogSQL(logs, err, server.URL, "Rejoin", LvlErr, "Failed Set Read Write on %s : %s", server.URL, err)
@@ -105,6 +105,7 @@ func (server *ServerMonitor) SendAlert() error {
 		State:     server.State,
 		PrevState: server.PrevState,
 		Host:      server.URL,
+		ServerUrl: server.URL,
 		Cluster:   server.GetCluster().Name,
 	}
 
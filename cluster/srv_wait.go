@@ -11,6 +11,7 @@ package cluster
 
 import (
 	"errors"
+	"strconv"
 	"sync"
 	"time"
 
@@ -23,6 +24,11 @@ func (server *ServerMonitor) WaitSyncToMaster(master *ServerMonitor) {
 		logs, err := dbhelper.MasterWaitGTID(server.Conn, master.GTIDBinlogPos.Sprint(), 30)
 		server.ClusterGroup.LogSQL(logs, err, server.URL, "MasterFailover", LvlErr, "Failed MasterWaitGTID, %s", err)
 
+	} else if server.DBVersion.IsPPostgreSQL() {
+		err := server.waitPostgresLSN(master, 30)
+		if err != nil {
+			server.ClusterGroup.LogPrintf(LvlErr, "Failed waiting WAL position on %s, %s", server.URL, err)
+		}
 	} else {
 		logs, err := dbhelper.MasterPosWait(server.Conn, server.DBVersion, master.BinaryLogFile, master.BinaryLogPos, 30, server.ClusterGroup.Conf.MasterConn)
 		server.ClusterGroup.LogSQL(logs, err, server.URL, "MasterFailover", LvlErr, "Failed MasterPosWait, %s", err)
@@ -33,6 +39,30 @@ func (server *ServerMonitor) WaitSyncToMaster(master *ServerMonitor) {
 	}
 }
 
+// waitPostgresLSN wait for a standby to receive the WAL written on a frozen
+// primary
+func (server *ServerMonitor) waitPostgresLSN(master *ServerMonitor, timeout int) error {
+	lsn, logs, err := dbhelper.GetPostgresLSN(master.Conn)
+	server.ClusterGroup.LogSQL(logs, err, master.URL, "MasterFailover", LvlErr, "Could not get WAL position on %s, %s", master.URL, err)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < timeout*2; i++ {
+		ss, logs, err := dbhelper.GetSlaveStatus(server.Conn, "", server.DBVersion)
+		server.ClusterGroup.LogSQL(logs, err, server.URL, "MasterFailover", LvlErr, "Could not get slave status %s %s", server.URL, err)
+		if err != nil {
+			return err
+		}
+		received, _ := strconv.ParseUint(ss.ReadMasterLogPos.String, 10, 64)
+		if received >= lsn {
+			return nil
+		}
+		server.ClusterGroup.LogPrintf(LvlInfo, "Waiting sync received WAL %d of %d on %s", received, lsn, server.URL)
+		time.Sleep(500 * time.Millisecond)
+	}
+	return errors.New("Timeout waiting WAL position")
+}
+
 func (server *ServerMonitor) WaitDatabaseStart() error {
 	exitloop := 0
 	server.GetCluster().LogPrintf(LvlInfo, "Waiting database start on %s", server.URL)
@@ -68,6 +68,19 @@ type Config struct {
 	MonitorSchemaChange                       bool                   `mapstructure:"monitoring-schema-change" toml:"monitoring-schema-change" json:"monitoringSchemaChange"`
 	MonitorQueryRules                         bool                   `mapstructure:"monitoring-query-rules" toml:"monitoring-query-rules" json:"monitoringQueryRules"`
 	MonitorSchemaChangeScript                 string                 `mapstructure:"monitoring-schema-change-script" toml:"monitoring-schema-change-script" json:"monitoringSchemaChangeScript"`
+	MonitorSchemaDrift                        bool                   `mapstructure:"monitoring-schema-drift" toml:"monitoring-schema-drift" json:"monitoringSchemaDrift"`
+	SchemaChangeMethod                        string                 `mapstructure:"schema-change-method" toml:"schema-change-method" json:"schemaChangeMethod"`
+	SchemaChangeMaxDelay                      int64                  `mapstructure:"schema-change-max-delay" toml:"schema-change-max-delay" json:"schemaChangeMaxDelay"`
+	SchemaChangeChunkSize                     int64                  `mapstructure:"schema-change-chunk-size" toml:"schema-change-chunk-size" json:"schemaChangeChunkSize"`
+	MonitorConsistency                        bool                   `mapstructure:"monitoring-consistency" toml:"monitoring-consistency" json:"monitoringConsistency"`
+	MonitorConsistencyInterval                int64                  `mapstructure:"monitoring-consistency-interval" toml:"monitoring-consistency-interval" json:"monitoringConsistencyInterval"`
+	MonitorConsistencyChunkTime               int64                  `mapstructure:"monitoring-consistency-chunk-time" toml:"monitoring-consistency-chunk-time" json:"monitoringConsistencyChunkTime"`
+	MonitorConsistencyMaxDelay                int64                  `mapstructure:"monitoring-consistency-max-delay" toml:"monitoring-consistency-max-delay" json:"monitoringConsistencyMaxDelay"`
+	MonitorConsistencyRepair                  bool                   `mapstructure:"monitoring-consistency-repair" toml:"monitoring-consistency-repair" json:"monitoringConsistencyRepair"`
+	MonitorDigestHistory                      bool                   `mapstructure:"monitoring-digest-history" toml:"monitoring-digest-history" json:"monitoringDigestHistory"`
+	MonitorDigestHistoryInterval              int64                  `mapstructure:"monitoring-digest-history-interval" toml:"monitoring-digest-history-interval" json:"monitoringDigestHistoryInterval"`
+	MonitorDigestHistoryRetention             int                    `mapstructure:"monitoring-digest-history-retention" toml:"monitoring-digest-history-retention" json:"monitoringDigestHistoryRetention"`
+	MonitorDigestRegressionFactor             float64                `mapstructure:"monitoring-digest-regression-factor" toml:"monitoring-digest-regression-factor" json:"monitoringDigestRegressionFactor"`
 	MonitorCheckGrants                        bool                   `mapstructure:"monitoring-check-grants" toml:"monitoring-check-grants" json:"monitoringCheckGrants"`
 	MonitorProcessList                        bool                   `mapstructure:"monitoring-processlist" toml:"monitoring-processlist" json:"monitoringProcesslist"`
 	MonitorQueries                            bool                   `mapstructure:"monitoring-queries" toml:"monitoring-queries" json:"monitoringQueries"`
@@ -103,6 +116,8 @@ type Config struct {
 	LogFailedElection                         bool                   `mapstructure:"log-failed-election"  toml:"log-failed-election" json:"logFailedElection"`
 	LogGit                                    bool                   `mapstructure:"log-git" toml:"log-git" json:"logGit"`
 	LogConfigLoad                             bool                   `mapstructure:"log-config-load" toml:"log-config-load" json:"logConfigLoad"`
+	EventsJournal                             bool                   `mapstructure:"events-journal" toml:"events-journal" json:"eventsJournal"`
+	EventsRetentionDays                       int                    `mapstructure:"events-retention-days" toml:"events-retention-days" json:"eventsRetentionDays"`
 	User                                      string                 `mapstructure:"db-servers-credential" toml:"db-servers-credential" json:"dbServersCredential"`
 	Hosts                                     string                 `mapstructure:"db-servers-hosts" toml:"db-servers-hosts" json:"dbServersHosts"`
 	HostsDelayed                              string                 `mapstructure:"replication-delayed-hosts" toml:"replication-delayed-hosts" json:"replicationDelayedHosts"`
@@ -143,6 +158,9 @@ type Config struct {
 	MultiTierSlave                            bool                   `mapstructure:"replication-multi-tier-slave" toml:"replication-multi-tier-slave" json:"replicationMultiTierSlave"`
 	MasterSlavePgStream                       bool                   `mapstructure:"replication-master-slave-pg-stream" toml:"replication-master-slave-pg-stream" json:"replicationMasterSlavePgStream"`
 	MasterSlavePgLogical                      bool                   `mapstructure:"replication-master-slave-pg-logical" toml:"replication-master-slave-pg-logical" json:"replicationMasterSlavePgLogical"`
+	MasterSlavePgRejoinMethod                 string                 `mapstructure:"replication-master-slave-pg-rejoin-method" toml:"replication-master-slave-pg-rejoin-method" json:"replicationMasterSlavePgRejoinMethod"`
+	MasterSlavePgRejoinScript                 string                 `mapstructure:"replication-master-slave-pg-rejoin-script" toml:"replication-master-slave-pg-rejoin-script" json:"replicationMasterSlavePgRejoinScript"`
+	MasterSlavePgPromoteTimeout               int                    `mapstructure:"replication-master-slave-pg-promote-timeout" toml:"replication-master-slave-pg-promote-timeout" json:"replicationMasterSlavePgPromoteTimeout"`
 	ReplicationNoRelay                        bool                   `mapstructure:"replication-master-slave-never-relay" toml:"replication-master-slave-never-relay" json:"replicationMasterSlaveNeverRelay"`
 	ReplicationRestartOnSQLErrorMatch         string                 `mapstructure:"replication-restart-on-sqlerror-match" toml:"replication-restart-on-sqlerror-match" json:"eeplicationRestartOnSqlLErrorMatch"`
 	SwitchWaitKill                            int64                  `mapstructure:"switchover-wait-kill" toml:"switchover-wait-kill" json:"switchoverWaitKill"`
@@ -185,6 +203,7 @@ type Config struct {
 	PrintDelayStatInterval                    int                    `mapstructure:"print-delay-stat-interval" toml:"print-delay-stat-interval" json:"printDelayStatInterval"`
 	DelayStatRotate                           int                    `mapstructure:"delay-stat-rotate" toml:"delay-stat-rotate" json:"delayStatRotate"`
 	FailoverCheckDelayStat                    bool                   `mapstructure:"failover-check-delay-stat" toml:"failover-check-delay-stat" json:"failoverCheckDelayStat"`
+	FailoverElectionPolicies                  string                 `mapstructure:"failover-election-policies" toml:"failover-election-policies" json:"failoverElectionPolicies"`
 	Autorejoin                                bool                   `mapstructure:"autorejoin" toml:"autorejoin" json:"autorejoin"`
 	Autoseed                                  bool                   `mapstructure:"autoseed" toml:"autoseed" json:"autoseed"`
 	AutorejoinForceRestore                    bool                   `mapstructure:"autorejoin-force-restore" toml:"autorejoin-force-restore" json:"autorejoinForceRestore"`
@@ -249,6 +268,18 @@ type Config struct {
 	TeamsUrl                                  string                 `mapstructure:"alert-teams-url" toml:"alert-teams-url" json:"alertTeamsUrl"`
 	TeamsProxyUrl                             string                 `mapstructure:"alert-teams-proxy-url" toml:"alert-teams-proxy-url" json:"alertTeamsProxyUrl"`
 	TeamsAlertState                           string                 `mapstructure:"alert-teams-state" toml:"alert-teams-state" json:"alertTeamsState"`
+	AlertWebhookUrl                           string                 `mapstructure:"alert-webhook-url" toml:"alert-webhook-url" json:"alertWebhookUrl"`
+	AlertWebhookTemplate                      string                 `mapstructure:"alert-webhook-template" toml:"alert-webhook-template" json:"alertWebhookTemplate"`
+	AlertIncidentUrl                          string                 `mapstructure:"alert-incident-url" toml:"alert-incident-url" json:"alertIncidentUrl"`
+	AlertIncidentRoutingKey                   string                 `mapstructure:"alert-incident-routing-key" toml:"alert-incident-routing-key" json:"alertIncidentRoutingKey"`
+	AlertChatUrl                              string                 `mapstructure:"alert-chat-url" toml:"alert-chat-url" json:"alertChatUrl"`
+	AlertChatFormat                           string                 `mapstructure:"alert-chat-format" toml:"alert-chat-format" json:"alertChatFormat"`
+	AlertNotifierProxyUrl                     string                 `mapstructure:"alert-notifier-proxy-url" toml:"alert-notifier-proxy-url" json:"alertNotifierProxyUrl"`
+	AlertSendResolved                         bool                   `mapstructure:"alert-send-resolved" toml:"alert-send-resolved" json:"alertSendResolved"`
+	AlertDestinationsFile                     string                 `mapstructure:"alert-destinations-file" toml:"alert-destinations-file" json:"alertDestinationsFile"`
+	AlertRoutesFile                           string                 `mapstructure:"alert-routes-file" toml:"alert-routes-file" json:"alertRoutesFile"`
+	AlertDedupWindow                          int                    `mapstructure:"alert-dedup-window" toml:"alert-dedup-window" json:"alertDedupWindow"`
+	AlertRateLimit                            int                    `mapstructure:"alert-rate-limit" toml:"alert-rate-limit" json:"alertRateLimit"`
 	Heartbeat                                 bool                   `mapstructure:"heartbeat-table" toml:"heartbeat-table" json:"heartbeatTable"`
 	ExtProxyOn                                bool                   `mapstructure:"extproxy" toml:"extproxy" json:"extproxy"`
 	ExtProxyVIP                               string                 `mapstructure:"extproxy-address" toml:"extproxy-address" json:"extproxyAddress"`
@@ -335,6 +366,11 @@ type Config struct {
 	MysqlRouterWritePort                      int                    `mapstructure:"mysqlrouter-write-port" toml:"mysqlrouter-write-port" json:"mysqlrouterWritePort"`
 	MysqlRouterReadPort                       int                    `mapstructure:"mysqlrouter-read-port" toml:"mysqlrouter-read-port" json:"mysqlrouterReadPort"`
 	MysqlRouterReadWritePort                  int                    `mapstructure:"mysqlrouter-read-write-port" toml:"mysqlrouter-read-write-port" json:"mysqlrouterReadWritePort"`
+	MysqlRouterHostsIPV6                      string                 `mapstructure:"mysqlrouter-servers-ipv6" toml:"mysqlrouter-servers-ipv6" json:"mysqlrouterServers-ipv6"`
+	MysqlRouterApiSSL                         bool                   `mapstructure:"mysqlrouter-api-ssl" toml:"mysqlrouter-api-ssl" json:"mysqlrouterApiSsl"`
+	MysqlRouterFailoverTimeout                int                    `mapstructure:"mysqlrouter-failover-timeout" toml:"mysqlrouter-failover-timeout" json:"mysqlrouterFailoverTimeout"`
+	MysqlRouterMaintenanceHidden              bool                   `mapstructure:"mysqlrouter-maintenance-hidden" toml:"mysqlrouter-maintenance-hidden" json:"mysqlrouterMaintenanceHidden"`
+	MysqlRouterBinaryPath                     string                 `mapstructure:"mysqlrouter-binary-path" toml:"mysqlrouter-binary-path" json:"mysqlrouterBinaryPath"`
 	SphinxOn                                  bool                   `mapstructure:"sphinx" toml:"sphinx" json:"sphinx"`
 	SphinxHosts                               string                 `mapstructure:"sphinx-servers" toml:"sphinx-servers" json:"sphinxServers"`
 	SphinxHostsIPV6                           string                 `mapstructure:"sphinx-servers-ipv6" toml:"sphinx-servers-ipv6" json:"sphinxServers-ipv6"`
@@ -358,6 +394,12 @@ type Config struct {
 	GraphiteCarbonLinkPort                    int                    `mapstructure:"graphite-carbon-link-port" toml:"graphite-carbon-link-port" json:"graphiteCarbonLinkPort"`
 	GraphiteCarbonPicklePort                  int                    `mapstructure:"graphite-carbon-pickle-port" toml:"graphite-carbon-pickle-port" json:"graphiteCarbonPicklePort"`
 	GraphiteCarbonPprofPort                   int                    `mapstructure:"graphite-carbon-pprof-port" toml:"graphite-carbon-pprof-port" json:"graphiteCarbonPprofPort"`
+	OtelExporter                              string                 `mapstructure:"otel-exporter" toml:"otel-exporter" json:"otelExporter"`
+	OtelEndpoint                              string                 `mapstructure:"otel-endpoint" toml:"otel-endpoint" json:"otelEndpoint"`
+	OtelProtocol                              string                 `mapstructure:"otel-protocol" toml:"otel-protocol" json:"otelProtocol"`
+	OtelInsecure                              bool                   `mapstructure:"otel-insecure" toml:"otel-insecure" json:"otelInsecure"`
+	OtelFile                                  string                 `mapstructure:"otel-file" toml:"otel-file" json:"otelFile"`
+	OtelSampleRatio                           float64                `mapstructure:"otel-sample-ratio" toml:"otel-sample-ratio" json:"otelSampleRatio"`
 	SysbenchBinaryPath                        string                 `mapstructure:"sysbench-binary-path" toml:"sysbench-binary-path" json:"sysbenchBinaryPath"`
 	SysbenchTest                              string                 `mapstructure:"sysbench-test" toml:"sysbench-test" json:"sysbenchBinaryTest"`
 	SysbenchV1                                bool                   `mapstructure:"sysbench-v1" toml:"sysbench-v1" json:"sysbenchV1"`
@@ -373,7 +415,12 @@ type Config struct {
 	ArbitrationFailedMasterScript             string                 `mapstructure:"arbitration-failed-master-script" toml:"arbitration-failed-master-script" json:"arbitrationFailedMasterScript"`
 	ArbitratorAddress                         string                 `mapstructure:"arbitrator-bind-address" toml:"arbitrator-bind-address" json:"arbitratorBindAddress"`
 	ArbitratorDriver                          string                 `mapstructure:"arbitrator-driver" toml:"arbitrator-driver" json:"arbitratorDriver"`
+	ArbitratorPeers                           string                 `mapstructure:"arbitrator-peers" toml:"arbitrator-peers" json:"arbitratorPeers"`
 	ArbitrationReadTimout                     int                    `mapstructure:"arbitration-read-timeout" toml:"arbitration-read-timeout" json:"arbitrationReadTimout"`
+	ArbitrationRaft                           bool                   `mapstructure:"arbitration-raft" toml:"arbitration-raft" json:"arbitrationRaft"`
+	ArbitrationRaftAddress                    string                 `mapstructure:"arbitration-raft-address" toml:"arbitration-raft-address" json:"arbitrationRaftAddress"`
+	ArbitrationRaftElectionTimeout            int                    `mapstructure:"arbitration-raft-election-timeout" toml:"arbitration-raft-election-timeout" json:"arbitrationRaftElectionTimeout"`
+	ArbitrationRaftSecret                     string                 `mapstructure:"arbitration-raft-secret" toml:"arbitration-raft-secret" json:"arbitrationRaftSecret"`
 	SwitchoverCopyOldLeaderGtid               bool                   `toml:"-" json:"-"` //suspicious code
 	Test                                      bool                   `mapstructure:"test" toml:"test" json:"test"`
 	TestInjectTraffic                         bool                   `mapstructure:"test-inject-traffic" toml:"test-inject-traffic" json:"testInjectTraffic"`
@@ -499,6 +546,10 @@ type Config struct {
 	ProvProxyStartScript                      string                 `mapstructure:"prov-proxy-start-script" toml:"prov-proxy-start-script" json:"provProxyStartScript"`
 	ProvDbStopScript                          string                 `mapstructure:"prov-db-stop-script" toml:"prov-db-stop-script" json:"provDbStopScript"`
 	ProvProxyStopScript                       string                 `mapstructure:"prov-proxy-stop-script" toml:"prov-proxy-stop-script" json:"provProxyStopScript"`
+	ProvDbUpgradeScript                       string                 `mapstructure:"prov-db-upgrade-script" toml:"prov-db-upgrade-script" json:"provDbUpgradeScript"`
+	ProvDbUpgradeBinaryPath                   string                 `mapstructure:"prov-db-upgrade-binary-path" toml:"prov-db-upgrade-binary-path" json:"provDbUpgradeBinaryPath"`
+	ProvDbUpgradeMaxDelay                     int64                  `mapstructure:"prov-db-upgrade-max-delay" toml:"prov-db-upgrade-max-delay" json:"provDbUpgradeMaxDelay"`
+	ProvDbUpgradeOnFailure                    string                 `mapstructure:"prov-db-upgrade-on-failure" toml:"prov-db-upgrade-on-failure" json:"provDbUpgradeOnFailure"`
 	ProvDBCompliance                          string                 `mapstructure:"prov-db-compliance" toml:"prov-db-compliance" json:"provDBCompliance"`
 	ProvProxyCompliance                       string                 `mapstructure:"prov-proxy-compliance" toml:"prov-proxy-compliance" json:"provProxyCompliance"`
 	APIUsers                                  string                 `mapstructure:"api-credentials" toml:"api-credentials" json:"apiCredentials"`
@@ -513,6 +564,9 @@ type Config struct {
 	AlertScript                               string                 `mapstructure:"alert-script" toml:"alert-script" json:"alertScript"`
 	ConfigFile                                string                 `mapstructure:"config" toml:"-" json:"-"`
 	MonitorScheduler                          bool                   `mapstructure:"monitoring-scheduler" toml:"monitoring-scheduler" json:"monitoringScheduler"`
+	MonitorWorkflowStepRetries                int                    `mapstructure:"monitoring-workflow-step-retries" toml:"monitoring-workflow-step-retries" json:"monitoringWorkflowStepRetries"`
+	MonitorWorkflowStepTimeout                int                    `mapstructure:"monitoring-workflow-step-timeout" toml:"monitoring-workflow-step-timeout" json:"monitoringWorkflowStepTimeout"`
+	MonitorWorkflowKeep                       int                    `mapstructure:"monitoring-workflow-keep" toml:"monitoring-workflow-keep" json:"monitoringWorkflowKeep"`
 	SchedulerReceiverPorts                    string                 `mapstructure:"scheduler-db-servers-receiver-ports" toml:"scheduler-db-servers-receiver-ports" json:"schedulerDbServersReceiverPorts"`
 	SchedulerSenderPorts                      string                 `mapstructure:"scheduler-db-servers-sender-ports" toml:"scheduler-db-servers-sender-ports" json:"schedulerDbServersSenderPorts"`
 	SchedulerReceiverUseSSL                   bool                   `mapstructure:"scheduler-db-servers-receiver-use-ssl" toml:"scheduler-db-servers-receiver-use-ssl" json:"schedulerDbServersReceiverUseSSL"`
@@ -569,6 +623,14 @@ type Config struct {
 	BackupStreamingEndpoint                   string                 `mapstructure:"backup-streaming-endpoint" toml:"backup-streaming-endpoint" json:"backupStreamingEndpoint"`
 	BackupStreamingRegion                     string                 `mapstructure:"backup-streaming-region" toml:"backup-streaming-region" json:"backupStreamingRegion"`
 	BackupStreamingBucket                     string                 `mapstructure:"backup-streaming-bucket" toml:"backup-streaming-bucket" json:"backupStreamingBucket"`
+	BackupStorage                             string                 `mapstructure:"backup-storage" toml:"backup-storage" json:"backupStorage"`
+	BackupStoragePath                         string                 `mapstructure:"backup-storage-path" toml:"backup-storage-path" json:"backupStoragePath"`
+	BackupStoragePrefix                       string                 `mapstructure:"backup-storage-prefix" toml:"backup-storage-prefix" json:"backupStoragePrefix"`
+	BackupStoragePartSize                     int                    `mapstructure:"backup-storage-part-size" toml:"backup-storage-part-size" json:"backupStoragePartSize"`
+	BackupStorageAzureAccount                 string                 `mapstructure:"backup-storage-azure-account" toml:"backup-storage-azure-account" json:"backupStorageAzureAccount"`
+	BackupStorageAzureKey                     string                 `mapstructure:"backup-storage-azure-key" toml:"backup-storage-azure-key" json:"-"`
+	BackupStorageAzureContainer               string                 `mapstructure:"backup-storage-azure-container" toml:"backup-storage-azure-container" json:"backupStorageAzureContainer"`
+	BackupStorageAzureEndpoint                string                 `mapstructure:"backup-storage-azure-endpoint" toml:"backup-storage-azure-endpoint" json:"backupStorageAzureEndpoint"`
 	BackupMysqldumpPath                       string                 `mapstructure:"backup-mysqldump-path" toml:"backup-mysqldump-path" json:"backupMysqldumpPath"`
 	BackupMysqldumpOptions                    string                 `mapstructure:"backup-mysqldump-options" toml:"backup-mysqldump-options" json:"backupMysqldumpOptions"`
 	BackupMyDumperPath                        string                 `mapstructure:"backup-mydumper-path" toml:"backup-mydumper-path" json:"backupMydumperPath"`
@@ -579,6 +641,16 @@ type Config struct {
 	BackupMysqlclientPath                     string                 `mapstructure:"backup-mysqlclient-path" toml:"backup-mysqlclient-path" json:"backupMysqlclientgPath"`
 	BackupBinlogs                             bool                   `mapstructure:"backup-binlogs" toml:"backup-binlogs" json:"backupBinlogs"`
 	BackupBinlogsKeep                         int                    `mapstructure:"backup-binlogs-keep" toml:"backup-binlogs-keep" json:"backupBinlogsKeep"`
+	BackupPitrTimeout                         int64                  `mapstructure:"backup-pitr-timeout" toml:"backup-pitr-timeout" json:"backupPitrTimeout"`
+	SchedulerBackupVerify                     bool                   `mapstructure:"scheduler-db-servers-backup-verify" toml:"scheduler-db-servers-backup-verify" json:"schedulerDbServersBackupVerify"`
+	BackupVerifyCron                          string                 `mapstructure:"scheduler-db-servers-backup-verify-cron" toml:"scheduler-db-servers-backup-verify-cron" json:"schedulerDbServersBackupVerifyCron"`
+	BackupVerifyPort                          int                    `mapstructure:"backup-verify-port" toml:"backup-verify-port" json:"backupVerifyPort"`
+	BackupVerifyChecksum                      bool                   `mapstructure:"backup-verify-checksum" toml:"backup-verify-checksum" json:"backupVerifyChecksum"`
+	BackupVerifyTimeout                       int64                  `mapstructure:"backup-verify-timeout" toml:"backup-verify-timeout" json:"backupVerifyTimeout"`
+	BackupEncrypt                             bool                   `mapstructure:"backup-encrypt" toml:"backup-encrypt" json:"backupEncrypt"`
+	BackupEncryptKeyring                      string                 `mapstructure:"backup-encrypt-keyring" toml:"backup-encrypt-keyring" json:"backupEncryptKeyring"`
+	BackupEncryptVaultKey                     string                 `mapstructure:"backup-encrypt-vault-transit-key" toml:"backup-encrypt-vault-transit-key" json:"backupEncryptVaultTransitKey"`
+	BackupEncryptVaultMount                   string                 `mapstructure:"backup-encrypt-vault-transit-mount" toml:"backup-encrypt-vault-transit-mount" json:"backupEncryptVaultTransitMount"`
 	BackupLockDDL                             bool                   `mapstructure:"backup-lockddl" toml:"backup-lockddl" json:"backupLockDDL"`
 	ClusterConfigPath                         string                 `mapstructure:"cluster-config-file" toml:"-" json:"-"`
 	VaultServerAddr                           string                 `mapstructure:"vault-server-addr" toml:"vault-server-addr" json:"vaultServerAddr"`
@@ -826,6 +898,12 @@ const (
 	ConstBackupPhysicalTypeMariaBackup string = "mariabackup"
 )
 
+const (
+	ConstBackupStorageTypeLocal string = "local"
+	ConstBackupStorageTypeS3    string = "s3"
+	ConstBackupStorageTypeAzure string = "azure"
+)
+
 func (conf *Config) GetSecrets() map[string]Secret {
 	// to store the flags to encrypt in the git (in Save() function)
 	return conf.Secrets
@@ -842,6 +920,7 @@ func (conf *Config) DecryptSecretsFromConfig() {
 		"shardproxy-credential":                 {"", ""},
 		"haproxy-password":                      {"", ""},
 		"maxscale-pass":                         {"", ""},
+		"mysqlrouter-pass":                      {"", ""},
 		"myproxy-password":                      {"", ""},
 		"proxysql-password":                     {"", ""},
 		"proxyjanitor-password":                 {"", ""},
@@ -849,10 +928,13 @@ func (conf *Config) DecryptSecretsFromConfig() {
 		"opensvc-p12-secret":                    {"", ""},
 		"backup-restic-aws-access-secret":       {"", ""},
 		"backup-streaming-aws-access-secret":    {"", ""},
+		"backup-storage-azure-key":              {"", ""},
 		"backup-restic-password":                {"", ""},
 		"arbitration-external-secret":           {"", ""},
+		"arbitration-raft-secret":               {"", ""},
 		"alert-pushover-user-token":             {"", ""},
 		"alert-pushover-app-token":              {"", ""},
+		"alert-incident-routing-key":            {"", ""},
 		"git-acces-token":                       {"", ""},
 		"mail-smtp-password":                    {"", ""},
 		"cloud18-gitlab-password":               {"", ""},
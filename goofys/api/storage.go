@@ -0,0 +1,148 @@
+package goofys
+
+import (
+	"io"
+	"strings"
+
+	common "github.com/signal18/replication-manager/goofys/api/common"
+	"github.com/signal18/replication-manager/goofys/internal"
+	"github.com/signal18/replication-manager/utils/storage"
+)
+
+// NewS3Storage return a storage writing to the bucket with S3 multipart
+// uploads, without a FUSE mount. The endpoint of flags is set for S3
+// compatible stores like MinIO.
+func NewS3Storage(bucket string, flags *common.FlagStorage, config *common.S3Config, partSize int) (storage.Storage, error) {
+	s3, err := internal.NewS3(bucket, flags, config)
+	if err != nil {
+		return nil, err
+	}
+	return newBlobStorage("s3://"+bucket, s3, partSize)
+}
+
+// NewAzureStorage return a storage writing to the container of the Azure
+// blob account, parts are staged blocks limited to 100MB
+func NewAzureStorage(container string, config *common.AZBlobConfig, partSize int) (storage.Storage, error) {
+	config.Init()
+	az, err := internal.NewAZBlob(container, config)
+	if err != nil {
+		return nil, err
+	}
+	if max := int(az.Capabilities().MaxMultipartSize); partSize > max {
+		partSize = max
+	}
+	return newBlobStorage("wasb://"+container, az, partSize)
+}
+
+func newBlobStorage(name string, backend internal.StorageBackend, partSize int) (storage.Storage, error) {
+	// the key does not need to exist, it checks the bucket and credentials
+	if err := backend.Init("replication-manager-" + internal.RandStringBytesMaskImprSrc(16)); err != nil {
+		return nil, err
+	}
+	return storage.NewBlob(name, &blobBackend{backend: backend}, partSize), nil
+}
+
+// blobBackend adapt a goofys backend to the storage package
+type blobBackend struct {
+	backend internal.StorageBackend
+}
+
+type blobUpload struct {
+	backend internal.StorageBackend
+	commit  *internal.MultipartBlobCommitInput
+	offset  uint64
+}
+
+func (b *blobBackend) Put(key string, body io.ReadSeeker, size int64) error {
+	_, err := b.backend.PutBlob(&internal.PutBlobInput{Key: key, Body: body, Size: internal.PUInt64(uint64(size))})
+	return err
+}
+
+func (b *blobBackend) Get(key string) (io.ReadCloser, error) {
+	resp, err := b.backend.GetBlob(&internal.GetBlobInput{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *blobBackend) Head(key string) (*storage.Object, error) {
+	resp, err := b.backend.HeadBlob(&internal.HeadBlobInput{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return blobObject(resp.BlobItemOutput), nil
+}
+
+func (b *blobBackend) List(prefix string, token string) ([]storage.Object, string, error) {
+	param := &internal.ListBlobsInput{Prefix: &prefix}
+	if token != "" {
+		param.ContinuationToken = &token
+	}
+	resp, err := b.backend.ListBlobs(param)
+	if err != nil {
+		return nil, "", err
+	}
+	var objects []storage.Object
+	for _, item := range resp.Items {
+		// directory markers of FUSE mounts
+		if strings.HasSuffix(*item.Key, "/") {
+			continue
+		}
+		objects = append(objects, *blobObject(item))
+	}
+	next := ""
+	if resp.IsTruncated && resp.NextContinuationToken != nil {
+		next = *resp.NextContinuationToken
+	}
+	return objects, next, nil
+}
+
+func (b *blobBackend) Copy(from string, to string) error {
+	_, err := b.backend.CopyBlob(&internal.CopyBlobInput{Source: from, Destination: to})
+	return err
+}
+
+func (b *blobBackend) Delete(key string) error {
+	_, err := b.backend.DeleteBlob(&internal.DeleteBlobInput{Key: key})
+	return err
+}
+
+func (b *blobBackend) MultipartBegin(key string) (storage.BlobUpload, error) {
+	commit, err := b.backend.MultipartBlobBegin(&internal.MultipartBlobBeginInput{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return &blobUpload{backend: b.backend, commit: commit}, nil
+}
+
+func (u *blobUpload) Add(part uint32, body io.ReadSeeker, size int64, last bool) error {
+	_, err := u.backend.MultipartBlobAdd(&internal.MultipartBlobAddInput{
+		Commit:     u.commit,
+		PartNumber: part,
+		Body:       body,
+		Size:       uint64(size),
+		Last:       last,
+		Offset:     u.offset,
+	})
+	u.offset += uint64(size)
+	return err
+}
+
+func (u *blobUpload) Commit() error {
+	_, err := u.backend.MultipartBlobCommit(u.commit)
+	return err
+}
+
+func (u *blobUpload) Abort() error {
+	_, err := u.backend.MultipartBlobAbort(u.commit)
+	return err
+}
+
+func blobObject(item internal.BlobItemOutput) *storage.Object {
+	o := &storage.Object{Key: *item.Key, Size: int64(item.Size)}
+	if item.LastModified != nil {
+		o.ModTime = *item.LastModified
+	}
+	return o
+}
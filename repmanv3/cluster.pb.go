@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.26.0
-// 	protoc        v3.17.3
+// 	protoc-gen-go v1.27.1
+// 	protoc        (unknown)
 // source: cluster.proto
 
 package repmanv3
@@ -54,7 +54,7 @@ var file_cluster_proto_rawDesc = []byte{
 	0xd3, 0xe4, 0x93, 0x02, 0x34, 0x12, 0x32, 0x2f, 0x76, 0x33, 0x2f, 0x63, 0x6c, 0x75, 0x73, 0x74,
 	0x65, 0x72, 0x73, 0x2f, 0x7b, 0x6e, 0x61, 0x6d, 0x65, 0x7d, 0x2f, 0x61, 0x63, 0x74, 0x69, 0x6f,
 	0x6e, 0x73, 0x2f, 0x6d, 0x61, 0x73, 0x74, 0x65, 0x72, 0x2d, 0x70, 0x68, 0x79, 0x73, 0x69, 0x63,
-	0x61, 0x6c, 0x2d, 0x62, 0x61, 0x63, 0x6b, 0x75, 0x70, 0x32, 0x83, 0x10, 0x0a, 0x0e, 0x43, 0x6c,
+	0x61, 0x6c, 0x2d, 0x62, 0x61, 0x63, 0x6b, 0x75, 0x70, 0x32, 0xd9, 0x10, 0x0a, 0x0e, 0x43, 0x6c,
 	0x75, 0x73, 0x74, 0x65, 0x72, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x6c, 0x0a, 0x0a,
 	0x47, 0x65, 0x74, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x12, 0x28, 0x2e, 0x73, 0x69, 0x67,
 	0x6e, 0x61, 0x6c, 0x31, 0x38, 0x2e, 0x72, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f,
@@ -182,11 +182,17 @@ var file_cluster_proto_rawDesc = []byte{
 	0x6c, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72,
 	0x2e, 0x76, 0x33, 0x2e, 0x54, 0x61, 0x62, 0x6c, 0x65, 0x22, 0x22, 0x82, 0xd3, 0xe4, 0x93, 0x02,
 	0x1c, 0x12, 0x1a, 0x2f, 0x76, 0x33, 0x2f, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x73, 0x2f,
-	0x7b, 0x6e, 0x61, 0x6d, 0x65, 0x7d, 0x2f, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x30, 0x01, 0x42,
-	0x32, 0x5a, 0x30, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x69,
-	0x67, 0x6e, 0x61, 0x6c, 0x31, 0x38, 0x2f, 0x72, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x69,
-	0x6f, 0x6e, 0x2d, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x3b, 0x72, 0x65, 0x70, 0x6d, 0x61,
-	0x6e, 0x76, 0x33, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x7b, 0x6e, 0x61, 0x6d, 0x65, 0x7d, 0x2f, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x30, 0x01, 0x12,
+	0x54, 0x0a, 0x0b, 0x57, 0x61, 0x74, 0x63, 0x68, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x28,
+	0x2e, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x31, 0x38, 0x2e, 0x72, 0x65, 0x70, 0x6c, 0x69, 0x63,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x2e, 0x76, 0x33,
+	0x2e, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x1a, 0x17, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x75, 0x63,
+	0x74, 0x22, 0x00, 0x30, 0x01, 0x42, 0x32, 0x5a, 0x30, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x31, 0x38, 0x2f, 0x72, 0x65, 0x70,
+	0x6c, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2d, 0x6d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72,
+	0x3b, 0x72, 0x65, 0x70, 0x6d, 0x61, 0x6e, 0x76, 0x33, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
 }
 
 var file_cluster_proto_goTypes = []interface{}{
@@ -215,20 +221,22 @@ var file_cluster_proto_depIdxs = []int32{
 	0,  // 9: signal18.replication_manager.v3.ClusterService.GetTags:input_type -> signal18.replication_manager.v3.Cluster
 	0,  // 10: signal18.replication_manager.v3.ClusterService.GetQueryRules:input_type -> signal18.replication_manager.v3.Cluster
 	0,  // 11: signal18.replication_manager.v3.ClusterService.GetSchema:input_type -> signal18.replication_manager.v3.Cluster
-	4,  // 12: signal18.replication_manager.v3.ClusterPublicService.ClusterStatus:output_type -> signal18.replication_manager.v3.StatusMessage
-	5,  // 13: signal18.replication_manager.v3.ClusterPublicService.MasterPhysicalBackup:output_type -> google.protobuf.Empty
-	6,  // 14: signal18.replication_manager.v3.ClusterService.GetCluster:output_type -> google.protobuf.Struct
-	6,  // 15: signal18.replication_manager.v3.ClusterService.GetSettingsForCluster:output_type -> google.protobuf.Struct
-	5,  // 16: signal18.replication_manager.v3.ClusterService.SetActionForClusterSettings:output_type -> google.protobuf.Empty
-	5,  // 17: signal18.replication_manager.v3.ClusterService.PerformClusterAction:output_type -> google.protobuf.Empty
-	6,  // 18: signal18.replication_manager.v3.ClusterService.RetrieveFromTopology:output_type -> google.protobuf.Struct
-	7,  // 19: signal18.replication_manager.v3.ClusterService.GetClientCertificates:output_type -> signal18.replication_manager.v3.Certificate
-	8,  // 20: signal18.replication_manager.v3.ClusterService.GetBackups:output_type -> signal18.replication_manager.v3.Backup
-	9,  // 21: signal18.replication_manager.v3.ClusterService.GetTags:output_type -> signal18.replication_manager.v3.Tag
-	6,  // 22: signal18.replication_manager.v3.ClusterService.GetQueryRules:output_type -> google.protobuf.Struct
-	10, // 23: signal18.replication_manager.v3.ClusterService.GetSchema:output_type -> signal18.replication_manager.v3.Table
-	12, // [12:24] is the sub-list for method output_type
-	0,  // [0:12] is the sub-list for method input_type
+	0,  // 12: signal18.replication_manager.v3.ClusterService.WatchEvents:input_type -> signal18.replication_manager.v3.Cluster
+	4,  // 13: signal18.replication_manager.v3.ClusterPublicService.ClusterStatus:output_type -> signal18.replication_manager.v3.StatusMessage
+	5,  // 14: signal18.replication_manager.v3.ClusterPublicService.MasterPhysicalBackup:output_type -> google.protobuf.Empty
+	6,  // 15: signal18.replication_manager.v3.ClusterService.GetCluster:output_type -> google.protobuf.Struct
+	6,  // 16: signal18.replication_manager.v3.ClusterService.GetSettingsForCluster:output_type -> google.protobuf.Struct
+	5,  // 17: signal18.replication_manager.v3.ClusterService.SetActionForClusterSettings:output_type -> google.protobuf.Empty
+	5,  // 18: signal18.replication_manager.v3.ClusterService.PerformClusterAction:output_type -> google.protobuf.Empty
+	6,  // 19: signal18.replication_manager.v3.ClusterService.RetrieveFromTopology:output_type -> google.protobuf.Struct
+	7,  // 20: signal18.replication_manager.v3.ClusterService.GetClientCertificates:output_type -> signal18.replication_manager.v3.Certificate
+	8,  // 21: signal18.replication_manager.v3.ClusterService.GetBackups:output_type -> signal18.replication_manager.v3.Backup
+	9,  // 22: signal18.replication_manager.v3.ClusterService.GetTags:output_type -> signal18.replication_manager.v3.Tag
+	6,  // 23: signal18.replication_manager.v3.ClusterService.GetQueryRules:output_type -> google.protobuf.Struct
+	10, // 24: signal18.replication_manager.v3.ClusterService.GetSchema:output_type -> signal18.replication_manager.v3.Table
+	6,  // 25: signal18.replication_manager.v3.ClusterService.WatchEvents:output_type -> google.protobuf.Struct
+	13, // [13:26] is the sub-list for method output_type
+	0,  // [0:13] is the sub-list for method input_type
 	0,  // [0:0] is the sub-list for extension type_name
 	0,  // [0:0] is the sub-list for extension extendee
 	0,  // [0:0] is the sub-list for field type_name
@@ -1,4 +1,8 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: cluster.proto
 
 package repmanv3
 
@@ -152,6 +156,10 @@ type ClusterServiceClient interface {
 	GetTags(ctx context.Context, in *Cluster, opts ...grpc.CallOption) (ClusterService_GetTagsClient, error)
 	GetQueryRules(ctx context.Context, in *Cluster, opts ...grpc.CallOption) (ClusterService_GetQueryRulesClient, error)
 	GetSchema(ctx context.Context, in *Cluster, opts ...grpc.CallOption) (ClusterService_GetSchemaClient, error)
+	// WatchEvents stream the live cluster events until the client cancels, the
+	// HTTP counterpart is the server-sent events endpoint
+	// /api/clusters/{clusterName}/events/stream
+	WatchEvents(ctx context.Context, in *Cluster, opts ...grpc.CallOption) (ClusterService_WatchEventsClient, error)
 }
 
 type clusterServiceClient struct {
@@ -367,6 +375,38 @@ func (x *clusterServiceGetSchemaClient) Recv() (*Table, error) {
 	return m, nil
 }
 
+func (c *clusterServiceClient) WatchEvents(ctx context.Context, in *Cluster, opts ...grpc.CallOption) (ClusterService_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ClusterService_ServiceDesc.Streams[5], "/signal18.replication_manager.v3.ClusterService/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &clusterServiceWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ClusterService_WatchEventsClient interface {
+	Recv() (*structpb.Struct, error)
+	grpc.ClientStream
+}
+
+type clusterServiceWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *clusterServiceWatchEventsClient) Recv() (*structpb.Struct, error) {
+	m := new(structpb.Struct)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ClusterServiceServer is the server API for ClusterService service.
 // All implementations must embed UnimplementedClusterServiceServer
 // for forward compatibility
@@ -381,6 +421,10 @@ type ClusterServiceServer interface {
 	GetTags(*Cluster, ClusterService_GetTagsServer) error
 	GetQueryRules(*Cluster, ClusterService_GetQueryRulesServer) error
 	GetSchema(*Cluster, ClusterService_GetSchemaServer) error
+	// WatchEvents stream the live cluster events until the client cancels, the
+	// HTTP counterpart is the server-sent events endpoint
+	// /api/clusters/{clusterName}/events/stream
+	WatchEvents(*Cluster, ClusterService_WatchEventsServer) error
 	mustEmbedUnimplementedClusterServiceServer()
 }
 
@@ -418,6 +462,9 @@ func (UnimplementedClusterServiceServer) GetQueryRules(*Cluster, ClusterService_
 func (UnimplementedClusterServiceServer) GetSchema(*Cluster, ClusterService_GetSchemaServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetSchema not implemented")
 }
+func (UnimplementedClusterServiceServer) WatchEvents(*Cluster, ClusterService_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
 func (UnimplementedClusterServiceServer) mustEmbedUnimplementedClusterServiceServer() {}
 
 // UnsafeClusterServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -626,6 +673,27 @@ func (x *clusterServiceGetSchemaServer) Send(m *Table) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _ClusterService_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Cluster)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ClusterServiceServer).WatchEvents(m, &clusterServiceWatchEventsServer{stream})
+}
+
+type ClusterService_WatchEventsServer interface {
+	Send(*structpb.Struct) error
+	grpc.ServerStream
+}
+
+type clusterServiceWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *clusterServiceWatchEventsServer) Send(m *structpb.Struct) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // ClusterService_ServiceDesc is the grpc.ServiceDesc for ClusterService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -680,6 +748,11 @@ var ClusterService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ClusterService_GetSchema_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _ClusterService_WatchEvents_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "cluster.proto",
 }
@@ -0,0 +1,306 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// mysqlrouter.go client of the MySQL Router REST API
+
+package mysqlrouter
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const apiPath = "/api/20190715"
+
+type MySQLRouter struct {
+	Host    string
+	Port    string
+	User    string
+	Pass    string
+	UseSSL  bool
+	Timeout time.Duration
+	client  *http.Client
+}
+
+type RouterStatus struct {
+	ProcessId      int    `json:"processId"`
+	ProductEdition string `json:"productEdition"`
+	TimeStarted    string `json:"timeStarted"`
+	Version        string `json:"version"`
+	Hostname       string `json:"hostname"`
+}
+
+type RouteConfig struct {
+	BindAddress     string `json:"bindAddress"`
+	BindPort        int    `json:"bindPort"`
+	Socket          string `json:"socket"`
+	Protocol        string `json:"protocol"`
+	RoutingStrategy string `json:"routingStrategy"`
+	Mode            string `json:"mode"`
+	MaxConnections  int    `json:"maxActiveConnections"`
+	MaxConnectError int    `json:"maxConnectErrors"`
+}
+
+type RouteStatus struct {
+	ActiveConnections int `json:"activeConnections"`
+	TotalConnections  int `json:"totalConnections"`
+	BlockedHosts      int `json:"blockedHosts"`
+}
+
+type Destination struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+type Connection struct {
+	BytesFromServer    int64  `json:"bytesFromServer"`
+	BytesToServer      int64  `json:"bytesToServer"`
+	SourceAddress      string `json:"sourceAddress"`
+	DestinationAddress string `json:"destinationAddress"`
+	TimeStarted        string `json:"timeStarted"`
+}
+
+type MetadataNode struct {
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+}
+
+type MetadataConfig struct {
+	ClusterName        string         `json:"clusterName"`
+	TimeRefreshInMs    int            `json:"timeRefreshInMs"`
+	GroupReplicationId string         `json:"groupReplicationId"`
+	Nodes              []MetadataNode `json:"nodes"`
+}
+
+type MetadataStatus struct {
+	RefreshFailed            int    `json:"refreshFailed"`
+	RefreshSucceeded         int    `json:"refreshSucceeded"`
+	TimeLastRefreshSucceeded string `json:"timeLastRefreshSucceeded"`
+	TimeLastRefreshFailed    string `json:"timeLastRefreshFailed"`
+	LastRefreshHostname      string `json:"lastRefreshHostname"`
+	LastRefreshPort          int    `json:"lastRefreshPort"`
+}
+
+// Route is the health of a route as reported in the proxy topology
+type Route struct {
+	Name              string        `json:"name"`
+	Protocol          string        `json:"protocol"`
+	BindPort          int           `json:"bindPort"`
+	RoutingStrategy   string        `json:"routingStrategy"`
+	Alive             bool          `json:"alive"`
+	ActiveConnections int           `json:"activeConnections"`
+	TotalConnections  int           `json:"totalConnections"`
+	BlockedHosts      int           `json:"blockedHosts"`
+	Destinations      []Destination `json:"destinations"`
+	Connections       []Connection  `json:"-"`
+}
+
+type itemList struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+}
+
+func (r *MySQLRouter) Connect() error {
+	if r.Timeout == 0 {
+		r.Timeout = 5 * time.Second
+	}
+	r.client = &http.Client{
+		Timeout: r.Timeout,
+		// Router bootstrap generates a self signed certificate
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	_, err := r.GetRouterStatus()
+	if err != nil {
+		return fmt.Errorf("Could not connect to MySQL Router REST API (%s)", err)
+	}
+	return nil
+}
+
+func (r *MySQLRouter) url(path string) string {
+	scheme := "http"
+	if r.UseSSL {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + ":" + r.Port + apiPath + path
+}
+
+func (r *MySQLRouter) get(path string, v interface{}) error {
+	if r.client == nil {
+		return errors.New("Not connected")
+	}
+	req, err := http.NewRequest("GET", r.url(path), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.User, r.Pass)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (r *MySQLRouter) getNames(path string) ([]string, error) {
+	var list itemList
+	err := r.get(path, &list)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+	return names, nil
+}
+
+func (r *MySQLRouter) GetRouterStatus() (RouterStatus, error) {
+	var status RouterStatus
+	err := r.get("/router/status", &status)
+	return status, err
+}
+
+func (r *MySQLRouter) GetRoutes() ([]string, error) {
+	return r.getNames("/routes")
+}
+
+func (r *MySQLRouter) GetRouteConfig(name string) (RouteConfig, error) {
+	var config RouteConfig
+	err := r.get("/routes/"+url.PathEscape(name)+"/config", &config)
+	return config, err
+}
+
+func (r *MySQLRouter) GetRouteStatus(name string) (RouteStatus, error) {
+	var status RouteStatus
+	err := r.get("/routes/"+url.PathEscape(name)+"/status", &status)
+	return status, err
+}
+
+func (r *MySQLRouter) GetRouteHealth(name string) (bool, error) {
+	var health struct {
+		IsAlive bool `json:"isAlive"`
+	}
+	err := r.get("/routes/"+url.PathEscape(name)+"/health", &health)
+	return health.IsAlive, err
+}
+
+func (r *MySQLRouter) GetRouteDestinations(name string) ([]Destination, error) {
+	var list struct {
+		Items []Destination `json:"items"`
+	}
+	err := r.get("/routes/"+url.PathEscape(name)+"/destinations", &list)
+	return list.Items, err
+}
+
+func (r *MySQLRouter) GetRouteConnections(name string) ([]Connection, error) {
+	var list struct {
+		Items []Connection `json:"items"`
+	}
+	err := r.get("/routes/"+url.PathEscape(name)+"/connections", &list)
+	return list.Items, err
+}
+
+func (r *MySQLRouter) GetMetadataCaches() ([]string, error) {
+	return r.getNames("/metadata")
+}
+
+func (r *MySQLRouter) GetMetadataConfig(name string) (MetadataConfig, error) {
+	var config MetadataConfig
+	err := r.get("/metadata/"+url.PathEscape(name)+"/config", &config)
+	return config, err
+}
+
+func (r *MySQLRouter) GetMetadataStatus(name string) (MetadataStatus, error) {
+	var status MetadataStatus
+	err := r.get("/metadata/"+url.PathEscape(name)+"/status", &status)
+	return status, err
+}
+
+// GetRouteInfo collect the config, the health and the destinations of a route
+func (r *MySQLRouter) GetRouteInfo(name string) (Route, error) {
+	route := Route{Name: name}
+	config, err := r.GetRouteConfig(name)
+	if err != nil {
+		return route, err
+	}
+	route.Protocol = config.Protocol
+	route.BindPort = config.BindPort
+	route.RoutingStrategy = config.RoutingStrategy
+	if route.RoutingStrategy == "" {
+		route.RoutingStrategy = config.Mode
+	}
+	route.Alive, err = r.GetRouteHealth(name)
+	if err != nil {
+		return route, err
+	}
+	status, err := r.GetRouteStatus(name)
+	if err != nil {
+		return route, err
+	}
+	route.ActiveConnections = status.ActiveConnections
+	route.TotalConnections = status.TotalConnections
+	route.BlockedHosts = status.BlockedHosts
+	route.Destinations, err = r.GetRouteDestinations(name)
+	if err != nil {
+		return route, err
+	}
+	route.Connections, err = r.GetRouteConnections(name)
+	return route, err
+}
+
+func (r *MySQLRouter) GetRoutesInfo() ([]Route, error) {
+	names, err := r.GetRoutes()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]Route, 0, len(names))
+	for _, name := range names {
+		route, err := r.GetRouteInfo(name)
+		if err != nil {
+			return routes, fmt.Errorf("Route %s: %s", name, err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// HasDestination return true if the route sends connections to host:port
+func (route *Route) HasDestination(host string, port string) bool {
+	for _, d := range route.Destinations {
+		if d.Address == host && strconv.Itoa(d.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDestinationStats sum the connections and bytes of the route to a destination
+func (route *Route) GetDestinationStats(d Destination) (connections int, bytesTo int64, bytesFrom int64) {
+	addr := d.Address + ":" + strconv.Itoa(d.Port)
+	for _, c := range route.Connections {
+		if c.DestinationAddress == addr {
+			connections++
+			bytesTo += c.BytesToServer
+			bytesFrom += c.BytesFromServer
+		}
+	}
+	return connections, bytesTo, bytesFrom
+}
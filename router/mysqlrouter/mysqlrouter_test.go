@@ -0,0 +1,101 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package mysqlrouter
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testResponses = map[string]string{
+	"/router/status":                    `{"processId":1,"version":"8.0.35","hostname":"router1"}`,
+	"/routes":                           `{"items":[{"name":"bootstrap_rw"}]}`,
+	"/routes/bootstrap_rw/config":       `{"bindAddress":"0.0.0.0","bindPort":6446,"protocol":"classic","routingStrategy":"first-available"}`,
+	"/routes/bootstrap_rw/health":       `{"isAlive":true}`,
+	"/routes/bootstrap_rw/status":       `{"activeConnections":2,"totalConnections":10,"blockedHosts":0}`,
+	"/routes/bootstrap_rw/destinations": `{"items":[{"address":"db1","port":3306}]}`,
+	"/routes/bootstrap_rw/connections":  `{"items":[{"bytesFromServer":100,"bytesToServer":10,"destinationAddress":"db1:3306"},{"bytesFromServer":50,"bytesToServer":5,"destinationAddress":"db1:3306"}]}`,
+	"/metadata":                         `{"items":[{"name":"bootstrap"}]}`,
+	"/metadata/bootstrap/status":        `{"refreshFailed":1,"refreshSucceeded":42}`,
+	"/metadata/bootstrap/config":        `{"clusterName":"cluster1","nodes":[{"hostname":"db1","port":3306}]}`,
+}
+
+func newTestRouter(t *testing.T) (*MySQLRouter, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		resp, ok := testResponses[r.URL.Path[len(apiPath):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(resp))
+	}))
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	return &MySQLRouter{Host: host, Port: port, User: "admin", Pass: "secret"}, ts.Close
+}
+
+func TestConnect(t *testing.T) {
+	r, stop := newTestRouter(t)
+	defer stop()
+	err := r.Connect()
+	if err != nil {
+		t.Fatal("Could not establish a connection:", err)
+	}
+	r.Pass = "wrong"
+	_, err = r.GetRouterStatus()
+	if err == nil {
+		t.Error("Expected an error with a wrong password")
+	}
+}
+
+func TestGetRoutesInfo(t *testing.T) {
+	r, stop := newTestRouter(t)
+	defer stop()
+	r.Connect()
+	routes, err := r.GetRoutesInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("Expected 1 route, got %d", len(routes))
+	}
+	route := routes[0]
+	if !route.Alive || route.BindPort != 6446 || route.RoutingStrategy != "first-available" || route.ActiveConnections != 2 {
+		t.Errorf("Unexpected route %+v", route)
+	}
+	if !route.HasDestination("db1", "3306") || route.HasDestination("db2", "3306") {
+		t.Errorf("Unexpected destinations %+v", route.Destinations)
+	}
+	conns, to, from := route.GetDestinationStats(route.Destinations[0])
+	if conns != 2 || to != 15 || from != 150 {
+		t.Errorf("Unexpected stats %d %d %d", conns, to, from)
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	r, stop := newTestRouter(t)
+	defer stop()
+	r.Connect()
+	caches, err := r.GetMetadataCaches()
+	if err != nil || len(caches) != 1 {
+		t.Fatalf("Unexpected metadata caches %v %v", caches, err)
+	}
+	status, err := r.GetMetadataStatus(caches[0])
+	if err != nil || status.RefreshFailed != 1 || status.RefreshSucceeded != 42 {
+		t.Errorf("Unexpected metadata status %+v %v", status, err)
+	}
+	_, err = r.GetRouteConfig("missing")
+	if err == nil {
+		t.Error("Expected an error on a missing route")
+	}
+}
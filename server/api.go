@@ -36,6 +36,8 @@ import (
 	"github.com/signal18/replication-manager/regtest"
 	"github.com/signal18/replication-manager/share"
 	"github.com/signal18/replication-manager/utils/githelper"
+	"github.com/signal18/replication-manager/utils/journal"
+	"github.com/signal18/replication-manager/utils/tracing"
 )
 
 //RSA KEYS AND INITIALISATION
@@ -137,6 +139,7 @@ func (repman *ReplicationManager) apiserver() {
 	repman.initKeys()
 	//PUBLIC ENDPOINTS
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware("replication-manager"))
 	//router.HandleFunc("/", repman.handlerApp)
 	// page to view which does not need authorization
 	if repman.Conf.Test {
@@ -266,8 +269,18 @@ func (repman *ReplicationManager) isValidRequest(r *http.Request) bool {
 }
 
 func (repman *ReplicationManager) IsValidClusterACL(r *http.Request, cluster *cluster.Cluster) bool {
+	return repman.isValidClusterACLToken(r, cluster, request.AuthorizationHeaderExtractor)
+}
 
-	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
+// IsValidClusterStreamACL also read the token of the access_token argument
+// accepted by validateStreamTokenMiddleware
+func (repman *ReplicationManager) IsValidClusterStreamACL(r *http.Request, cluster *cluster.Cluster) bool {
+	return repman.isValidClusterACLToken(r, cluster, request.OAuth2Extractor)
+}
+
+func (repman *ReplicationManager) isValidClusterACLToken(r *http.Request, cluster *cluster.Cluster, extractor request.Extractor) bool {
+
+	token, err := request.ParseFromRequest(r, extractor, func(token *jwt.Token) (interface{}, error) {
 		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
 		return vk, nil
 	})
@@ -290,6 +303,36 @@ func (repman *ReplicationManager) IsValidClusterACL(r *http.Request, cluster *cl
 	return false
 }
 
+// GetUserFromRequest return the API user name carried by the request token
+func (repman *ReplicationManager) GetUserFromRequest(r *http.Request) string {
+	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
+		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
+		return vk, nil
+	})
+	if err != nil {
+		return ""
+	}
+	return repman.getUserFromToken(token)
+}
+
+func (repman *ReplicationManager) getUserFromToken(token *jwt.Token) string {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	mycutinfo, ok := claims["CustomUserInfo"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if profile, ok := mycutinfo["profile"].(string); ok && strings.Contains(profile, repman.Conf.OAuthProvider) {
+		if email, ok := mycutinfo["email"].(string); ok {
+			return email
+		}
+	}
+	user, _ := mycutinfo["Name"].(string)
+	return user
+}
+
 func (repman *ReplicationManager) loginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	var user userCredentials
@@ -571,7 +614,12 @@ func (repman *ReplicationManager) validateTokenMiddleware(w http.ResponseWriter,
 
 	if err == nil {
 		if token.Valid {
-			next(w, r)
+			// journal once the handler checked the cluster ACL
+			sw := &apiStatusWriter{ResponseWriter: w}
+			next(sw, r)
+			if sw.status < 400 {
+				repman.journalApiAction(r, token)
+			}
 		} else {
 			w.WriteHeader(http.StatusUnauthorized)
 			fmt.Fprint(w, "Token is not valid")
@@ -582,6 +630,70 @@ func (repman *ReplicationManager) validateTokenMiddleware(w http.ResponseWriter,
 	}
 }
 
+// validateStreamTokenMiddleware also accept the token as access_token argument
+// as browsers EventSource can not set an Authorization header
+func (repman *ReplicationManager) validateStreamTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	token, err := request.ParseFromRequest(r, request.OAuth2Extractor,
+		func(token *jwt.Token) (interface{}, error) {
+			vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
+			return vk, nil
+		})
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "Unauthorised access to this resource"+err.Error())
+		return
+	}
+	if !token.Valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "Token is not valid")
+		return
+	}
+	next(w, r)
+}
+
+// apiStatusWriter keep the status code of the response, an unset status is
+// a 200, Flush is forwarded for the event streams
+type apiStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *apiStatusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *apiStatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// journalApiAction record cluster actions and settings changes in the cluster
+// events journal with the user issuing them, it is called for the requests
+// the handler authorized
+func (repman *ReplicationManager) journalApiAction(r *http.Request, token *jwt.Token) {
+	if r.Method == "GET" && !strings.Contains(r.URL.Path, "/actions/") {
+		return
+	}
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		return
+	}
+	server := ""
+	if vars["serverName"] != "" {
+		server = vars["serverName"]
+		if vars["serverPort"] != "" {
+			server = server + ":" + vars["serverPort"]
+		}
+	}
+	mycluster.LogEvent(journal.ConstEventApi, r.Method, server, repman.getUserFromToken(token), "%s", r.URL.Path)
+}
+
 //HELPER FUNCTIONS
 
 func (repman *ReplicationManager) jsonResponse(apiresponse interface{}, w http.ResponseWriter) {
@@ -631,12 +743,7 @@ func (repman *ReplicationManager) handlerMuxClusterDelete(w http.ResponseWriter,
 func (repman *ReplicationManager) handlerMuxPrometheus(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	for _, cluster := range repman.Clusters {
-		for _, server := range cluster.Servers {
-			res := server.GetPrometheusMetrics()
-			w.Write([]byte(res))
-		}
-	}
+	repman.getPrometheusHandler().ServeHTTP(w, r)
 }
 
 func (repman *ReplicationManager) handlerMuxClustersOld(w http.ResponseWriter, r *http.Request) {
@@ -711,7 +818,6 @@ func (repman *ReplicationManager) handlerMuxMonitorHeartbeat(w http.ResponseWrit
 	var send Heartbeat
 	send.UUID = repman.UUID
 	send.UID = repman.Conf.ArbitrationSasUniqueId
-	send.Secret = repman.Conf.ArbitrationSasSecret
 	send.Status = repman.Status
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	if err := json.NewEncoder(w).Encode(send); err != nil {
@@ -11,8 +11,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/negroni"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +22,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/signal18/replication-manager/cluster"
 	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/alert"
+	"github.com/signal18/replication-manager/utils/journal"
 )
 
 func (repman *ReplicationManager) apiClusterUnprotectedHandler(router *mux.Router) {
@@ -54,6 +58,42 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackups)),
 	))
+	router.Handle("/api/clusters/{clusterName}/backups/verifications", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupVerifications)),
+	))
+	router.Handle("/api/clusters/{clusterName}/backups/catalog", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupCatalog)),
+	))
+	router.Handle("/api/clusters/{clusterName}/backups/catalog/{backupId}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupCatalogEntry)),
+	))
+	router.Handle("/api/clusters/{clusterName}/backups/catalog/{backupId}/actions/delete", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupCatalogDelete)),
+	))
+	router.Handle("/api/clusters/{clusterName}/backups/catalog/{backupId}/actions/download", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupCatalogDownload)),
+	))
+	router.Handle("/api/clusters/{clusterName}/actions/backup-verify", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupVerify)),
+	))
+	router.Handle("/api/clusters/{clusterName}/actions/backup-key-init", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupKeyInit)),
+	))
+	router.Handle("/api/clusters/{clusterName}/actions/backup-key-rotate", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterBackupKeyRotate)),
+	))
+	router.Handle("/api/clusters/{clusterName}/pitr", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterPitrReports)),
+	))
 
 	router.Handle("/api/clusters/{clusterName}/certificates", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
@@ -128,6 +168,14 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailover)),
 	))
+	router.Handle("/api/clusters/{clusterName}/actions/switchover/plan", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSwitchoverPlan)),
+	))
+	router.Handle("/api/clusters/{clusterName}/actions/failover/plan", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailoverPlan)),
+	))
 	router.Handle("/api/clusters/{clusterName}/actions/certificates-rotate", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRotateKeys)),
@@ -204,6 +252,30 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRolling)),
 	))
+	router.Handle("/api/clusters/{clusterName}/actions/rolling-upgrade", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRollingUpgrade)),
+	))
+	router.Handle("/api/clusters/{clusterName}/actions/rolling-upgrade/resume", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRollingUpgradeResume)),
+	))
+	router.Handle("/api/clusters/{clusterName}/rolling-upgrade", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRollingUpgradeStatus)),
+	))
+	router.Handle("/api/clusters/{clusterName}/workflows", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxWorkflows)),
+	))
+	router.Handle("/api/clusters/{clusterName}/workflows/{workflowId}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxWorkflow)),
+	))
+	router.Handle("/api/clusters/{clusterName}/workflows/{workflowId}/actions/{action}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxWorkflowAction)),
+	))
 	router.Handle("/api/clusters/{clusterName}/actions/rotate-passwords", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerRotatePasswords)),
@@ -230,10 +302,43 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaChecksumTable)),
 	))
 
+	router.Handle("/api/clusters/{clusterName}/schema/{schemaName}/{tableName}/actions/alter", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaAlterTable)),
+	))
+	router.Handle("/api/clusters/{clusterName}/schema/drift", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaDrift)),
+	))
+	router.Handle("/api/clusters/{clusterName}/schema/{schemaName}/{tableName}/history", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaHistory)),
+	))
+	router.Handle("/api/clusters/{clusterName}/schema-changes", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaChanges)),
+	))
+	router.Handle("/api/clusters/{clusterName}/schema-changes/{changeId}/actions/cancel", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaChangeCancel)),
+	))
+
 	router.Handle("/api/clusters/{clusterName}/actions/checksum-all-tables", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterSchemaChecksumAllTable)),
 	))
+	router.Handle("/api/clusters/{clusterName}/consistency", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterConsistency)),
+	))
+	router.Handle("/api/clusters/{clusterName}/consistency/repairs", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterConsistencyRepairs)),
+	))
+	router.Handle("/api/clusters/{clusterName}/consistency/repairs/{repairId}/actions/apply", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterConsistencyRepairApply)),
+	))
 
 	router.Handle("/api/clusters/{clusterName}/schema", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
@@ -280,6 +385,18 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxCrashes)),
 	))
+	router.Handle("/api/clusters/{clusterName}/topology/failovers", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailoverReports)),
+	))
+	router.Handle("/api/clusters/{clusterName}/events", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterEvents)),
+	))
+	router.Handle("/api/clusters/{clusterName}/events/stream", negroni.New(
+		negroni.HandlerFunc(repman.validateStreamTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterEventsStream)),
+	))
 	//PROTECTED ENDPOINTS FOR TESTS
 
 	router.Handle("/api/clusters/{clusterName}/tests/actions/run/all", negroni.New(
@@ -296,6 +413,23 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxOneTest)),
 	))
 
+	router.Handle("/api/clusters/{clusterName}/alerts/routes", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterAlertRoutes)),
+	))
+	router.Handle("/api/clusters/{clusterName}/alerts/silences", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterAlertSilences)),
+	))
+	router.Handle("/api/clusters/{clusterName}/alerts/silences/actions/add", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterAlertSilenceAdd)),
+	))
+	router.Handle("/api/clusters/{clusterName}/alerts/silences/actions/delete/{silenceId}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterAlertSilenceDelete)),
+	))
+
 	// endpoint to fetch Cluster.DiffVariables
 	router.Handle("/api/clusters/{clusterName}/diffvariables", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
@@ -516,6 +650,178 @@ func (repman *ReplicationManager) handlerMuxRolling(w http.ResponseWriter, r *ht
 	return
 }
 
+// handlerMuxRollingUpgrade start a rolling upgrade workflow to the target
+// version or package and return its first checkpoint, follow it on the
+// rolling-upgrade endpoint
+func (repman *ReplicationManager) handlerMuxRollingUpgrade(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		wf, err := mycluster.NewRollingUpgrade(r.URL.Query().Get("target"))
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		go func() {
+			// the error is kept in the checkpoint of the paused workflow
+			if err := mycluster.RunWorkflow(wf); err != nil {
+				mycluster.LogPrintf(cluster.LvlErr, "Rolling upgrade %s: %s", wf.Id, err)
+			}
+		}()
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(wf.Snapshot())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxRollingUpgradeResume(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.ResumeRollingUpgrade()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	return
+}
+
+func (repman *ReplicationManager) handlerMuxRollingUpgradeStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		wf := mycluster.GetRollingUpgrade()
+		if wf == nil {
+			http.Error(w, "No rolling upgrade", 404)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(wf.Snapshot())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxWorkflows(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var workflows []*cluster.Workflow
+		for _, wf := range mycluster.GetWorkflows() {
+			workflows = append(workflows, wf.Snapshot())
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(workflows)
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxWorkflow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		wf := mycluster.GetWorkflow(vars["workflowId"])
+		if wf == nil {
+			http.Error(w, "Workflow Not Found", 404)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(wf.Snapshot())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxWorkflowAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var err error
+		switch vars["action"] {
+		case "pause":
+			err = mycluster.PauseWorkflow(vars["workflowId"])
+		case "resume":
+			err = mycluster.ResumeWorkflow(vars["workflowId"])
+		case "cancel":
+			err = mycluster.CancelWorkflow(vars["workflowId"])
+		default:
+			http.Error(w, "Unknown action", 500)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxStartTraffic(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -817,6 +1123,53 @@ func (repman *ReplicationManager) handlerMuxSwitchover(w http.ResponseWriter, r
 	return
 }
 
+// handlerMuxSwitchoverPlan return what a switchover would do without running it
+func (repman *ReplicationManager) handlerMuxSwitchoverPlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		r.ParseForm()
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetSwitchoverPlan(r.Form.Get("prefmaster")))
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxFailoverPlan return what a failover would do if the master died now
+func (repman *ReplicationManager) handlerMuxFailoverPlan(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetFailoverPlan())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxMaster(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -917,7 +1270,7 @@ func (repman *ReplicationManager) handlerMuxClusterBackups(w http.ResponseWriter
 	}
 }
 
-func (repman *ReplicationManager) handlerMuxClusterShardClusters(w http.ResponseWriter, r *http.Request) {
+func (repman *ReplicationManager) handlerMuxClusterBackupCatalog(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
 	mycluster := repman.getClusterByName(vars["clusterName"])
@@ -928,7 +1281,7 @@ func (repman *ReplicationManager) handlerMuxClusterShardClusters(w http.Response
 		}
 		e := json.NewEncoder(w)
 		e.SetIndent("", "\t")
-		err := e.Encode(mycluster.ShardProxyGetShardClusters())
+		err := e.Encode(mycluster.GetBackupCatalog())
 		if err != nil {
 			http.Error(w, "Encoding error", 500)
 			return
@@ -939,7 +1292,7 @@ func (repman *ReplicationManager) handlerMuxClusterShardClusters(w http.Response
 	}
 }
 
-func (repman *ReplicationManager) handlerMuxClusterQueryRules(w http.ResponseWriter, r *http.Request) {
+func (repman *ReplicationManager) handlerMuxClusterBackupCatalogEntry(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
 	mycluster := repman.getClusterByName(vars["clusterName"])
@@ -948,9 +1301,14 @@ func (repman *ReplicationManager) handlerMuxClusterQueryRules(w http.ResponseWri
 			http.Error(w, "No valid ACL", 403)
 			return
 		}
+		bck, err := mycluster.GetBackupCatalogEntry(vars["backupId"])
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
 		e := json.NewEncoder(w)
 		e.SetIndent("", "\t")
-		err := e.Encode(mycluster.GetQueryRules())
+		err = e.Encode(bck)
 		if err != nil {
 			http.Error(w, "Encoding error", 500)
 			return
@@ -961,8 +1319,7 @@ func (repman *ReplicationManager) handlerMuxClusterQueryRules(w http.ResponseWri
 	}
 }
 
-func (repman *ReplicationManager) handlerMuxSwitchSettings(w http.ResponseWriter, r *http.Request) {
-
+func (repman *ReplicationManager) handlerMuxClusterBackupCatalogDelete(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
 	mycluster := repman.getClusterByName(vars["clusterName"])
@@ -971,17 +1328,237 @@ func (repman *ReplicationManager) handlerMuxSwitchSettings(w http.ResponseWriter
 			http.Error(w, "No valid ACL", 403)
 			return
 		}
-		setting := vars["settingName"]
-		mycluster.LogPrintf("INFO", "API receive switch setting %s", setting)
-		repman.switchSettings(mycluster, setting)
+		err := mycluster.DeleteBackupCatalogEntry(vars["backupId"])
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
 	} else {
 		http.Error(w, "No cluster", 500)
 		return
 	}
-	return
 }
 
-func (repman *ReplicationManager) switchSettings(mycluster *cluster.Cluster, setting string) {
+// handlerMuxClusterBackupCatalogDownload send a single file backup as is and
+// the files of a mydumper backup as a tar.gz archive
+func (repman *ReplicationManager) handlerMuxClusterBackupCatalogDownload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		bck, err := mycluster.GetBackupCatalogEntry(vars["backupId"])
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		if bck.Storage != cluster.ConstBackupStorageLocal || bck.State != cluster.ConstBackupCatalogDone {
+			http.Error(w, "Backup "+bck.Id+" can not be downloaded", 500)
+			return
+		}
+		if len(bck.Files) == 1 {
+			f, err := os.Open(bck.Location + "/" + bck.Files[0])
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			w.Header().Set("Content-Disposition", "attachment; filename=\""+bck.Id+"-"+bck.Files[0]+"\"")
+			http.ServeContent(w, r, bck.Files[0], fi.ModTime(), f)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+bck.Id+".tar.gz\"")
+		err = mycluster.WriteBackupCatalogArchive(bck, w)
+		if err != nil {
+			mycluster.LogPrintf(cluster.LvlErr, "Download of backup %s failed: %s", bck.Id, err)
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterBackupVerifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetBackupVerifications())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterBackupVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		go mycluster.VerifyBackups()
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterBackupKeyInit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.InitBackupKeyring()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterBackupKeyRotate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		count, err := mycluster.RotateBackupKey()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(map[string]int{"rewrapped": count})
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterPitrReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetPitrReports())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterShardClusters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.ShardProxyGetShardClusters())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterQueryRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetQueryRules())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxSwitchSettings(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		setting := vars["settingName"]
+		mycluster.LogPrintf("INFO", "API receive switch setting %s", setting)
+		repman.switchSettings(mycluster, setting)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	return
+}
+
+func (repman *ReplicationManager) switchSettings(mycluster *cluster.Cluster, setting string) {
 	switch setting {
 	case "verbose":
 		mycluster.SwitchVerbosity()
@@ -1040,6 +1617,12 @@ func (repman *ReplicationManager) switchSettings(mycluster *cluster.Cluster, set
 		mycluster.SwitchSchedulerBackupLogical()
 	case "scheduler-db-servers-physical-backup":
 		mycluster.SwitchSchedulerBackupPhysical()
+	case "scheduler-db-servers-backup-verify":
+		mycluster.SwitchSchedulerBackupVerify()
+	case "backup-verify-checksum":
+		mycluster.SwitchBackupVerifyChecksum()
+	case "backup-encrypt":
+		mycluster.SwitchBackupEncrypt()
 	case "scheduler-db-servers-logs":
 		mycluster.SwitchSchedulerDatabaseLogs()
 	case "scheduler-jobs-ssh":
@@ -1109,6 +1692,8 @@ func (repman *ReplicationManager) switchSettings(mycluster *cluster.Cluster, set
 		mycluster.SwitchMonitoringScheduler()
 	case "monitoring-schema-change":
 		mycluster.SwitchMonitoringSchemaChange()
+	case "monitoring-consistency":
+		mycluster.SwitchMonitoringConsistency()
 	case "monitoring-capture":
 		mycluster.SwitchMonitoringCapture()
 	case "monitoring-innodb-status":
@@ -1192,6 +1777,8 @@ func (repman *ReplicationManager) setSetting(mycluster *cluster.Cluster, name st
 		mycluster.SetRplMaxDelay(val)
 	case "switchover-wait-route-change":
 		mycluster.SetSwitchoverWaitRouteChange(value)
+	case "failover-election-policies":
+		mycluster.SetFailoverElectionPolicies(value)
 	case "failover-limit":
 		val, _ := strconv.Atoi(value)
 		mycluster.SetFailLimit(val)
@@ -1302,6 +1889,8 @@ func (repman *ReplicationManager) setSetting(mycluster *cluster.Cluster, name st
 		mycluster.SetSchedulerDbServersAnalyzeCron(value)
 	case "scheduler-db-servers-physical-backup-cron":
 		mycluster.SetSchedulerDbServersPhysicalBackupCron(value)
+	case "scheduler-db-servers-backup-verify-cron":
+		mycluster.SetSchedulerDbServersBackupVerifyCron(value)
 	case "scheduler-rolling-reprov-cron":
 		mycluster.SetSchedulerRollingReprovCron(value)
 	case "scheduler-rolling-restart-cron":
@@ -1441,6 +2030,188 @@ func (repman *ReplicationManager) handlerMuxCrashes(w http.ResponseWriter, r *ht
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxFailoverReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetFailoverReports())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// parseEventTime accept RFC3339 or unix seconds
+func parseEventTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handlerMuxClusterEvents page through the events journal, use the returned
+// next id as after parameter to fetch the following page
+func (repman *ReplicationManager) handlerMuxClusterEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+	if !repman.IsValidClusterACL(r, mycluster) {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	q := r.URL.Query()
+	var err error
+	filter := journal.Filter{Type: q.Get("type"), Server: q.Get("server"), Limit: 100}
+	filter.Since, err = parseEventTime(q.Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Until, err = parseEventTime(q.Get("until"))
+	if err != nil {
+		http.Error(w, "Invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Get("after") != "" {
+		filter.After, err = strconv.ParseInt(q.Get("after"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid after: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if q.Get("limit") != "" {
+		filter.Limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || filter.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if filter.Limit > 1000 {
+			filter.Limit = 1000
+		}
+	}
+	events, err := mycluster.GetEvents(filter)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	page := struct {
+		Events []journal.Event `json:"events"`
+		Next   int64           `json:"next"`
+	}{Events: events, Next: filter.After}
+	if len(events) > 0 {
+		page.Next = events[len(events)-1].Id
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(page)
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+		return
+	}
+}
+
+// handlerMuxClusterEventsStream push live cluster events as server-sent events.
+// With an after parameter or a Last-Event-ID header the journal is replayed
+// first so that a reconnecting client does not miss events.
+func (repman *ReplicationManager) handlerMuxClusterEventsStream(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil || mycluster.EventBroker == nil {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+	if !repman.IsValidClusterStreamACL(r, mycluster) {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", 500)
+		return
+	}
+	q := r.URL.Query()
+	filter := journal.Filter{Type: q.Get("type"), Server: q.Get("server")}
+	after := q.Get("after")
+	if r.Header.Get("Last-Event-ID") != "" {
+		after = r.Header.Get("Last-Event-ID")
+	}
+	// subscribe before replaying to not lose events published in between
+	sub := mycluster.EventBroker.Subscribe(filter, 256)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e journal.Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if e.Id > 0 {
+			fmt.Fprintf(w, "id: %d\n", e.Id)
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		flusher.Flush()
+		return err
+	}
+	var last int64
+	if after != "" && mycluster.Journal != nil {
+		filter.After, _ = strconv.ParseInt(after, 10, 64)
+		filter.Limit = 1000
+		events, _ := mycluster.GetEvents(filter)
+		for _, e := range events {
+			if send(e) != nil {
+				return
+			}
+			last = e.Id
+		}
+	}
+	flusher.Flush()
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if e.Id > 0 && e.Id <= last {
+				continue
+			}
+			if send(e) != nil {
+				return
+			}
+		}
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxOneTest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -1893,6 +2664,207 @@ func (repman *ReplicationManager) handlerMuxClusterSchemaChecksumTable(w http.Re
 
 }
 
+// handlerMuxClusterSchemaAlterTable queue an online schema change, the body
+// is {"alter": "ADD COLUMN c INT", "method": "rolling|shadow"}
+func (repman *ReplicationManager) handlerMuxClusterSchemaAlterTable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var req struct {
+			Alter  string `json:"alter"`
+			Method string `json:"method"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Decode error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		sc, err := mycluster.AlterTable(vars["schemaName"], vars["tableName"], req.Alter, req.Method)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(sc)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterSchemaChanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetSchemaChanges())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterConsistency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetConsistencyCheck())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterConsistencyRepairs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetConsistencyRepairs())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterConsistencyRepairApply(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.ApplyConsistencyRepair(vars["repairId"])
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterSchemaDrift(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetSchemaDrift())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterSchemaHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		history, err := mycluster.GetSchemaHistory(vars["schemaName"], vars["tableName"])
+		if err != nil {
+			http.Error(w, "Error reading schema history: "+err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(history)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterSchemaChangeCancel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.CancelSchemaChange(vars["changeId"])
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxClusterSchemaUniversalTable(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -2052,3 +3024,110 @@ func (repman *ReplicationManager) handlerRotatePasswords(w http.ResponseWriter,
 	}
 	return
 }
+
+func (repman *ReplicationManager) handlerMuxClusterAlertRoutes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetAlertRoutes())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxClusterAlertSilences list silences on GET and create one on POST
+func (repman *ReplicationManager) handlerMuxClusterAlertSilences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "POST" {
+		repman.handlerMuxClusterAlertSilenceAdd(w, r)
+		return
+	}
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetAlertSilences())
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxClusterAlertSilenceAdd create a silence from a JSON body, the expiry
+// can be given as endsAt or as a duration in seconds
+func (repman *ReplicationManager) handlerMuxClusterAlertSilenceAdd(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var req struct {
+			alert.Silence
+			Duration int64 `json:"duration"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Decode error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		silence := req.Silence
+		if silence.StartsAt.IsZero() {
+			silence.StartsAt = time.Now()
+		}
+		if silence.EndsAt.IsZero() && req.Duration > 0 {
+			silence.EndsAt = silence.StartsAt.Add(time.Duration(req.Duration) * time.Second)
+		}
+		silence.CreatedBy = repman.GetUserFromRequest(r)
+		silence, err = mycluster.AddAlertSilence(silence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(silence)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxClusterAlertSilenceDelete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.DeleteAlertSilence(vars["silenceId"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
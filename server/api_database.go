@@ -12,6 +12,8 @@ import (
 	"strings"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/codegangsta/negroni"
 	"github.com/gorilla/mux"
@@ -104,6 +106,18 @@ func (repman *ReplicationManager) apiDatabaseProtectedHandler(router *mux.Router
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerPFSStatementsSlowLog)),
 	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/digests/history", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerDigestHistory)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/index-advisor", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerIndexAdvisor)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/index-advisor/{adviceId}/actions/apply", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerIndexAdvisorApply)),
+	))
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/tables", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerTables)),
@@ -207,6 +221,11 @@ func (repman *ReplicationManager) apiDatabaseProtectedHandler(router *mux.Router
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerReseed)),
 	))
 
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/pitr", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerPitr)),
+	))
+
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/toogle-innodb-monitor", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSetInnoDBMonitor)),
@@ -571,6 +590,50 @@ func (repman *ReplicationManager) handlerMuxServerReseed(w http.ResponseWriter,
 	}
 }
 
+func (repman *ReplicationManager) handlerMuxServerPitr(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if !repman.IsValidClusterACL(r, mycluster) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		var targetType, target string
+		for _, t := range []string{cluster.ConstPitrTargetTime, cluster.ConstPitrTargetPosition, cluster.ConstPitrTargetGtid} {
+			if v := r.URL.Query().Get(t); v != "" {
+				targetType, target = t, v
+			}
+		}
+		if targetType == "" {
+			http.Error(w, "Missing time, position or gtid target", 500)
+			return
+		}
+		provision := r.URL.Query().Get("provision") == "true"
+		dryrun := r.URL.Query().Get("dryrun") == "true"
+		report, err := mycluster.PointInTimeRecovery(node, targetType, target, provision, dryrun)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(report)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxServerBackupErrorLog(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -1923,6 +1986,131 @@ func (repman *ReplicationManager) handlerMuxServerPFSStatementsSlowLog(w http.Re
 	}
 }
 
+// handlerMuxServerDigestHistory return the trends of the statement digests
+// between since and until, the last 24 hours by default, the most time
+// consuming first
+func (repman *ReplicationManager) handlerMuxServerDigestHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if !repman.IsValidClusterACL(r, mycluster) {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	node := mycluster.GetServerFromName(vars["serverName"])
+	if node == nil {
+		http.Error(w, "Server Not Found", 500)
+		return
+	}
+	q := r.URL.Query()
+	since, err := parseEventTime(q.Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if since.IsZero() {
+		since = time.Now().Add(-24 * time.Hour)
+	}
+	until, err := parseEventTime(q.Get("until"))
+	if err != nil {
+		http.Error(w, "Invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 20
+	if q.Get("limit") != "" {
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	history, err := node.GetDigestHistory(since, until, q.Get("digest"))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if len(history.Trends) > limit {
+		history.Trends = history.Trends[:limit]
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(history)
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+		return
+	}
+}
+
+// handlerMuxServerIndexAdvisor return the missing and redundant indexes
+// found from the captured slow queries of the server
+func (repman *ReplicationManager) handlerMuxServerIndexAdvisor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if !repman.IsValidClusterACL(r, mycluster) {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	node := mycluster.GetServerFromName(vars["serverName"])
+	if node == nil {
+		http.Error(w, "Server Not Found", 500)
+		return
+	}
+	advices, err := node.GetIndexAdvice()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(advices)
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+		return
+	}
+}
+
+// handlerMuxServerIndexAdvisorApply queue the index change of an advice as a
+// rolling schema change validated on the first replica
+func (repman *ReplicationManager) handlerMuxServerIndexAdvisorApply(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if !repman.IsValidClusterACL(r, mycluster) {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	node := mycluster.GetServerFromName(vars["serverName"])
+	if node == nil {
+		http.Error(w, "Server Not Found", 500)
+		return
+	}
+	sc, err := node.ApplyIndexAdvice(vars["adviceId"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(sc)
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+		return
+	}
+}
+
 func (repman *ReplicationManager) handlerMuxServerVariables(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	vars := mux.Vars(r)
@@ -42,6 +42,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/iu0v1/gelada"
 	"github.com/iu0v1/gelada/authguard"
+	"github.com/signal18/replication-manager/utils/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -66,6 +67,7 @@ func (repman *ReplicationManager) httpserver() {
 	repman.initKeys()
 	//PUBLIC ENDPOINTS
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware("replication-manager"))
 	router.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
 	//router.HandleFunc("/", repman.handlerApp)
 	// page to view which does not need authorization
@@ -105,6 +107,15 @@ func (repman *ReplicationManager) httpserver() {
 	router.Handle("/api/heartbeat", negroni.New(
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxMonitorHeartbeat)),
 	))
+	router.Handle("/api/raft", negroni.New(
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRaftStatus)),
+	))
+	router.Handle("/api/raft/vote", negroni.New(
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRaftVote)),
+	))
+	router.Handle("/api/raft/append", negroni.New(
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRaftAppend)),
+	))
 
 	router.Handle("/api/clusters/{clusterName}/status", negroni.New(
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterStatus)),
@@ -213,7 +224,6 @@ func (repman *ReplicationManager) handlerHeartbeat(w http.ResponseWriter, r *htt
 	var send Heartbeat
 	send.UUID = repman.UUID
 	send.UID = repman.Conf.ArbitrationSasUniqueId
-	send.Secret = repman.Conf.ArbitrationSasSecret
 	send.Status = repman.Status
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	if err := json.NewEncoder(w).Encode(send); err != nil {
@@ -0,0 +1,190 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+var (
+	promServerLabels  = []string{"cluster", "instance", "role"}
+	promBackendLabels = []string{"cluster", "proxy", "type", "backend", "route"}
+
+	promServerUp             = prometheus.NewDesc("replication_manager_server_up", "Database server is reachable.", promServerLabels, nil)
+	promServerState          = prometheus.NewDesc("replication_manager_server_state", "Database server state seen by the monitor.", append(promServerLabels, "state"), nil)
+	promServerMaintenance    = prometheus.NewDesc("replication_manager_server_maintenance", "Database server is in maintenance.", promServerLabels, nil)
+	promServerDelay          = prometheus.NewDesc("replication_manager_server_replication_delay_seconds", "Replication delay of the replica.", promServerLabels, nil)
+	promServerIOThread       = prometheus.NewDesc("replication_manager_server_replication_io_running", "Replication IO thread is running.", promServerLabels, nil)
+	promServerSQLThread      = prometheus.NewDesc("replication_manager_server_replication_sql_running", "Replication SQL thread is running.", promServerLabels, nil)
+	promServerGtidSeqno      = prometheus.NewDesc("replication_manager_server_gtid_seqno", "Sequence of the current GTID per domain.", append(promServerLabels, "domain", "server_id"), nil)
+	promServerJobRunning     = prometheus.NewDesc("replication_manager_server_jobs_running", "Jobs waiting or running on the server.", append(promServerLabels, "task"), nil)
+	promServerJobDuration    = prometheus.NewDesc("replication_manager_server_job_last_duration_seconds", "Duration of the last finished job of the task.", append(promServerLabels, "task"), nil)
+	promClusterFailovers     = prometheus.NewDesc("replication_manager_cluster_failovers_total", "Failovers since the last reset of the failover counter.", []string{"cluster"}, nil)
+	promClusterFailoverTime  = prometheus.NewDesc("replication_manager_cluster_last_failover_timestamp_seconds", "Time of the last failover.", []string{"cluster"}, nil)
+	promClusterUptime        = prometheus.NewDesc("replication_manager_cluster_sla_uptime_percent", "Cluster SLA uptime.", []string{"cluster"}, nil)
+	promClusterUptimeFail    = prometheus.NewDesc("replication_manager_cluster_sla_uptime_failable_percent", "Cluster SLA uptime with a failover possible.", []string{"cluster"}, nil)
+	promClusterUptimeSemi    = prometheus.NewDesc("replication_manager_cluster_sla_uptime_semisync_percent", "Cluster SLA uptime with semisync replication.", []string{"cluster"}, nil)
+	promClusterState         = prometheus.NewDesc("replication_manager_cluster_state", "Open state of the cluster.", []string{"cluster", "key", "type", "from", "server"}, nil)
+	promProxyUp              = prometheus.NewDesc("replication_manager_proxy_up", "Proxy is reachable.", []string{"cluster", "proxy", "type"}, nil)
+	promBackendUp            = prometheus.NewDesc("replication_manager_proxy_backend_up", "Backend is online in the proxy.", promBackendLabels, nil)
+	promBackendConnections   = prometheus.NewDesc("replication_manager_proxy_backend_connections", "Connections of the proxy to the backend.", promBackendLabels, nil)
+	promBackendBytesSent     = prometheus.NewDesc("replication_manager_proxy_backend_bytes_sent_total", "Bytes sent by the proxy to the backend.", promBackendLabels, nil)
+	promBackendBytesReceived = prometheus.NewDesc("replication_manager_proxy_backend_bytes_received_total", "Bytes received by the proxy from the backend.", promBackendLabels, nil)
+	promBackendLatency       = prometheus.NewDesc("replication_manager_proxy_backend_latency", "Latency of the backend as reported by the proxy.", promBackendLabels, nil)
+
+	promInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// clusterCollector build the metrics of every cluster at scrape time from the
+// monitored state, global status and variables give one series per numeric
+// value so it does not describe its metrics
+type clusterCollector struct {
+	repman *ReplicationManager
+}
+
+func (c *clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, cl := range c.repman.getClusterList() {
+		c.collectCluster(ch, cl)
+		for _, srv := range cl.GetServers() {
+			c.collectServer(ch, cl, srv)
+		}
+		for _, prx := range cl.GetProxies() {
+			c.collectProxy(ch, cl, prx)
+		}
+	}
+}
+
+func (c *clusterCollector) collectCluster(ch chan<- prometheus.Metric, cl *cluster.Cluster) {
+	ch <- prometheus.MustNewConstMetric(promClusterFailovers, prometheus.CounterValue, float64(cl.FailoverCtr), cl.Name)
+	ch <- prometheus.MustNewConstMetric(promClusterFailoverTime, prometheus.GaugeValue, float64(cl.FailoverTs), cl.Name)
+	sla := cl.StateMachine.GetSla()
+	if sla.Lasttime > sla.Firsttime {
+		ch <- prometheus.MustNewConstMetric(promClusterUptime, prometheus.GaugeValue, sla.GetUptime(), cl.Name)
+		ch <- prometheus.MustNewConstMetric(promClusterUptimeFail, prometheus.GaugeValue, sla.GetUptimeFailable(), cl.Name)
+		ch <- prometheus.MustNewConstMetric(promClusterUptimeSemi, prometheus.GaugeValue, sla.GetUptimeSemiSync(), cl.Name)
+	}
+	for _, s := range cl.StateMachine.GetOpenErrorsAndWarnings() {
+		ch <- prometheus.MustNewConstMetric(promClusterState, prometheus.GaugeValue, 1, cl.Name, s.ErrKey, getStateType(s.ErrType), s.ErrFrom, s.ServerUrl)
+	}
+}
+
+// getStateType fold the state types the way the open errors and warnings of
+// the api do
+func getStateType(errType string) string {
+	if errType == "ERROR" {
+		return "ERROR"
+	}
+	return "WARNING"
+}
+
+func getServerRole(srv *cluster.ServerMonitor) string {
+	if srv.IsMaster() {
+		return "master"
+	}
+	if srv.IsSlave {
+		return "slave"
+	}
+	return "standalone"
+}
+
+func (c *clusterCollector) collectServer(ch chan<- prometheus.Metric, cl *cluster.Cluster, srv *cluster.ServerMonitor) {
+	labels := []string{cl.Name, srv.URL, getServerRole(srv)}
+	ch <- prometheus.MustNewConstMetric(promServerUp, prometheus.GaugeValue, boolToFloat(!srv.IsDown()), labels...)
+	ch <- prometheus.MustNewConstMetric(promServerState, prometheus.GaugeValue, 1, append(labels, srv.State)...)
+	ch <- prometheus.MustNewConstMetric(promServerMaintenance, prometheus.GaugeValue, boolToFloat(srv.IsMaintenance), labels...)
+	if srv.IsDown() {
+		return
+	}
+	if srv.IsSlave {
+		ch <- prometheus.MustNewConstMetric(promServerDelay, prometheus.GaugeValue, float64(srv.GetReplicationDelay()), labels...)
+		ch <- prometheus.MustNewConstMetric(promServerIOThread, prometheus.GaugeValue, boolToFloat(srv.IsIOThreadRunning()), labels...)
+		ch <- prometheus.MustNewConstMetric(promServerSQLThread, prometheus.GaugeValue, boolToFloat(srv.IsSQLThreadRunning()), labels...)
+	}
+	if srv.CurrentGtid != nil {
+		for _, g := range *srv.CurrentGtid {
+			ch <- prometheus.MustNewConstMetric(promServerGtidSeqno, prometheus.GaugeValue, float64(g.SeqNo), append(labels, strconv.FormatUint(g.DomainID, 10), strconv.FormatUint(g.ServerID, 10))...)
+		}
+	}
+	for task, ct := range srv.JobsRunning {
+		ch <- prometheus.MustNewConstMetric(promServerJobRunning, prometheus.GaugeValue, float64(ct), append(labels, task)...)
+	}
+	for task, duration := range srv.JobDurations {
+		ch <- prometheus.MustNewConstMetric(promServerJobDuration, prometheus.GaugeValue, float64(duration), append(labels, task)...)
+	}
+	collectGlobals(ch, "mysql_global_status_", "Generic metric from SHOW GLOBAL STATUS.", srv.Status, labels)
+	collectGlobals(ch, "mysql_global_variables_", "Generic gauge metric from SHOW GLOBAL VARIABLES.", srv.Variables, labels)
+}
+
+// collectGlobals expose the numeric status and variables as untyped, the
+// server does not tell counters from gauges
+func collectGlobals(ch chan<- prometheus.Metric, prefix string, help string, values map[string]string, labels []string) {
+	for k, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		desc := prometheus.NewDesc(prefix+promInvalidChars.ReplaceAllString(strings.ToLower(k), "_"), help, promServerLabels, nil)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.UntypedValue, f, labels...)
+	}
+}
+
+func (c *clusterCollector) collectProxy(ch chan<- prometheus.Metric, cl *cluster.Cluster, prx cluster.DatabaseProxy) {
+	ch <- prometheus.MustNewConstMetric(promProxyUp, prometheus.GaugeValue, boolToFloat(prx.GetState() != "Failed"), cl.Name, prx.GetURL(), prx.GetType())
+	for _, b := range prx.GetBackendsWrite() {
+		collectBackend(ch, cl, prx, b, "write")
+	}
+	for _, b := range prx.GetBackendsRead() {
+		collectBackend(ch, cl, prx, b, "read")
+	}
+}
+
+func collectBackend(ch chan<- prometheus.Metric, cl *cluster.Cluster, prx cluster.DatabaseProxy, b cluster.Backend, route string) {
+	labels := []string{cl.Name, prx.GetURL(), prx.GetType(), b.Host + ":" + b.Port, route}
+	status := strings.ToUpper(b.PrxStatus)
+	ch <- prometheus.MustNewConstMetric(promBackendUp, prometheus.GaugeValue, boolToFloat(status == "UP" || status == "ONLINE"), labels...)
+	collectBackendValue(ch, promBackendConnections, prometheus.GaugeValue, b.PrxConnections, labels)
+	collectBackendValue(ch, promBackendBytesSent, prometheus.CounterValue, b.PrxByteOut, labels)
+	collectBackendValue(ch, promBackendBytesReceived, prometheus.CounterValue, b.PrxByteIn, labels)
+	collectBackendValue(ch, promBackendLatency, prometheus.GaugeValue, b.PrxLatency, labels)
+}
+
+func collectBackendValue(ch chan<- prometheus.Metric, desc *prometheus.Desc, vt prometheus.ValueType, value string, labels []string) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, vt, f, labels...)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (repman *ReplicationManager) initPrometheus() {
+	repman.promRegistry = prometheus.NewRegistry()
+	repman.promRegistry.MustRegister(&clusterCollector{repman: repman})
+	repman.promRegistry.MustRegister(prometheus.NewGoCollector())
+	repman.promRegistry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+func (repman *ReplicationManager) getPrometheusHandler() http.Handler {
+	repman.promOnce.Do(repman.initPrometheus)
+	return promhttp.HandlerFor(repman.promRegistry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
@@ -0,0 +1,93 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func newPromTestCluster(name string) *cluster.Cluster {
+	cl := &cluster.Cluster{Name: name, StateMachine: new(state.StateMachine)}
+	cl.StateMachine.Init()
+	cl.Servers = []*cluster.ServerMonitor{
+		{Id: "db1", URL: "db1:3306", State: "Slave", IsSlave: true, ClusterGroup: cl,
+			Status:    map[string]string{"THREADS_CONNECTED": "12", "WSREP_PROVIDER_NAME": "none"},
+			Variables: map[string]string{"MAX_CONNECTIONS": "100"},
+		},
+		{Id: "db2", URL: "db2:3306", State: "Failed", ClusterGroup: cl},
+	}
+	return cl
+}
+
+func newPromTestCollector(clusters ...*cluster.Cluster) *clusterCollector {
+	repman := &ReplicationManager{Clusters: make(map[string]*cluster.Cluster)}
+	for _, cl := range clusters {
+		repman.Clusters[cl.Name] = cl
+	}
+	return &clusterCollector{repman: repman}
+}
+
+func TestPrometheusClusterState(t *testing.T) {
+	c1 := newPromTestCluster("c1")
+	c1.StateMachine.AddState("ERR00080", state.State{ErrType: "ERROR", ErrFrom: "TOPO", ServerUrl: "db2:3306"})
+	c1.StateMachine.AddState("WARN0091", state.State{ErrType: "WARNING", ErrFrom: "CHECK", ServerUrl: "db1:3306"})
+	c1.StateMachine.AddState("WARN0084", state.State{ErrType: "INFO", ErrFrom: "MON"})
+	c2 := newPromTestCluster("c2")
+	c2.StateMachine.AddState("ERR00080", state.State{ErrType: "ERROR", ErrFrom: "TOPO", ServerUrl: "db2:3306"})
+
+	expected := `
+# HELP replication_manager_cluster_state Open state of the cluster.
+# TYPE replication_manager_cluster_state gauge
+replication_manager_cluster_state{cluster="c1",from="CHECK",key="WARN0091",server="db1:3306",type="WARNING"} 1
+replication_manager_cluster_state{cluster="c1",from="MON",key="WARN0084",server="",type="WARNING"} 1
+replication_manager_cluster_state{cluster="c1",from="TOPO",key="ERR00080",server="db2:3306",type="ERROR"} 1
+replication_manager_cluster_state{cluster="c2",from="TOPO",key="ERR00080",server="db2:3306",type="ERROR"} 1
+`
+	if err := testutil.CollectAndCompare(newPromTestCollector(c1, c2), strings.NewReader(expected), "replication_manager_cluster_state"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrometheusServers(t *testing.T) {
+	expected := `
+# HELP replication_manager_server_up Database server is reachable.
+# TYPE replication_manager_server_up gauge
+replication_manager_server_up{cluster="c1",instance="db1:3306",role="slave"} 1
+replication_manager_server_up{cluster="c1",instance="db2:3306",role="standalone"} 0
+# HELP mysql_global_status_threads_connected Generic metric from SHOW GLOBAL STATUS.
+# TYPE mysql_global_status_threads_connected untyped
+mysql_global_status_threads_connected{cluster="c1",instance="db1:3306",role="slave"} 12
+`
+	collector := newPromTestCollector(newPromTestCluster("c1"))
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "replication_manager_server_up", "mysql_global_status_threads_connected"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector, "mysql_global_status_wsrep_provider_name"); n != 0 {
+		t.Errorf("Expected non numeric status to be skipped, got %d series", n)
+	}
+}
+
+// TestPrometheusGather check that a scrape of several clusters sharing server
+// names and state keys does not give twice the same series
+func TestPrometheusGather(t *testing.T) {
+	c1 := newPromTestCluster("c1")
+	c2 := newPromTestCluster("c2")
+	for _, cl := range []*cluster.Cluster{c1, c2} {
+		cl.StateMachine.AddState("ERR00080", state.State{ErrType: "ERROR", ErrFrom: "TOPO", ServerUrl: "db2:3306"})
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(newPromTestCollector(c1, c2))
+	if _, err := registry.Gather(); err != nil {
+		t.Error(err)
+	}
+}
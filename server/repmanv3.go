@@ -19,6 +19,8 @@ import (
 	"github.com/signal18/replication-manager/cluster"
 	"github.com/signal18/replication-manager/config"
 	v3 "github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/journal"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
@@ -85,20 +87,22 @@ func (s *ReplicationManager) StartServerV3(debug bool, router *mux.Router) error
 	if debug {
 		serverOpts = append(serverOpts, grpc.UnaryInterceptor(
 			grpc_middleware.ChainUnaryServer(
+				otelgrpc.UnaryServerInterceptor(),
 				s.unaryInterceptor,
 				// grpc_zap.UnaryServerInterceptor(s.log),
 			),
 		))
 		serverOpts = append(serverOpts, grpc.StreamInterceptor(
 			grpc_middleware.ChainStreamServer(
+				otelgrpc.StreamServerInterceptor(),
 				s.streamInterceptor,
 				// grpc_zap.StreamServerInterceptor(s.log),
 			),
 		))
 	} else {
 		serverOpts = append(serverOpts,
-			grpc.UnaryInterceptor(s.unaryInterceptor),
-			grpc.StreamInterceptor(s.streamInterceptor),
+			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(otelgrpc.UnaryServerInterceptor(), s.unaryInterceptor)),
+			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(otelgrpc.StreamServerInterceptor(), s.streamInterceptor)),
 		)
 	}
 
@@ -923,3 +927,34 @@ func (s *ReplicationManager) GetSchema(in *v3.Cluster, stream v3.ClusterService_
 
 	return nil
 }
+
+func (s *ReplicationManager) WatchEvents(in *v3.Cluster, stream v3.ClusterService_WatchEventsServer) error {
+	user, mycluster, err := s.getClusterAndUser(stream.Context(), in)
+	if err != nil {
+		return err
+	}
+
+	if err = user.Granted(config.GrantClusterSettings); err != nil {
+		return err
+	}
+
+	if mycluster.EventBroker == nil {
+		return status.Error(codes.Unavailable, "events stream not initialized")
+	}
+
+	sub := mycluster.EventBroker.Subscribe(journal.Filter{}, 256)
+	defer sub.Close()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := marshalAndSend(e, stream.Send); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -21,7 +21,7 @@ import (
 )
 
 func (repman *ReplicationManager) UnMountS3() {
-	if !repman.Conf.BackupStreaming {
+	if !repman.Conf.BackupStreaming || repman.Conf.BackupStorage != "" {
 		return
 	}
 
@@ -38,6 +38,10 @@ func (repman *ReplicationManager) MountS3() {
 	if !repman.Conf.BackupStreaming {
 		return
 	}
+	if repman.Conf.BackupStorage != "" {
+		log.Warnf("Not mounting S3 to %s, backups are copied to backup-storage %s", repman.Conf.WorkingDir+"/"+config.ConstStreamingSubDir, repman.Conf.BackupStorage)
+		return
+	}
 	if _, err := os.Stat(repman.Conf.WorkingDir + "/" + config.ConstStreamingSubDir); os.IsNotExist(err) {
 		os.MkdirAll(repman.Conf.WorkingDir+"/"+config.ConstStreamingSubDir, os.ModePerm)
 	}
@@ -8,6 +8,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
@@ -29,6 +30,7 @@ import (
 	"time"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
@@ -45,9 +47,11 @@ import (
 	"github.com/signal18/replication-manager/opensvc"
 	"github.com/signal18/replication-manager/regtest"
 	"github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/consensus"
 	"github.com/signal18/replication-manager/utils/githelper"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/s18log"
+	"github.com/signal18/replication-manager/utils/tracing"
 )
 
 var RepMan *ReplicationManager
@@ -103,6 +107,11 @@ type ReplicationManager struct {
 	V3Up                                             chan bool                  `json:"-"`
 	v3Config                                         Repmanv3Config             `json:"-"`
 	cloud18CheckSum                                  hash.Hash                  `json:"-"`
+	Raft                                             *consensus.Node            `json:"-"`
+	raftTransport                                    *consensus.HTTPTransport   `json:"-"`
+	promRegistry                                     *prometheus.Registry       `json:"-"`
+	promOnce                                         sync.Once                  `json:"-"`
+	traceShutdown                                    func(context.Context) error
 	repmanv3.UnimplementedClusterPublicServiceServer `json:"-"`
 	repmanv3.UnimplementedClusterServiceServer       `json:"-"`
 	sync.Mutex
@@ -810,6 +819,20 @@ func (repman *ReplicationManager) Run() error {
 		log.AddHook(hook)
 	}
 
+	repman.traceShutdown, err = tracing.Init(tracing.Options{
+		Exporter:    repman.Conf.OtelExporter,
+		Endpoint:    repman.Conf.OtelEndpoint,
+		Protocol:    repman.Conf.OtelProtocol,
+		Insecure:    repman.Conf.OtelInsecure,
+		File:        repman.Conf.OtelFile,
+		SampleRatio: repman.Conf.OtelSampleRatio,
+		ServiceName: "replication-manager",
+		Version:     repman.Version,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("OpenTelemetry tracing initialization error")
+	}
+
 	if !repman.Conf.Daemon {
 		err := termbox.Init()
 		if err != nil {
@@ -889,6 +912,13 @@ func (repman *ReplicationManager) Run() error {
 
 	// If there's an existing encryption key, decrypt the passwords
 
+	if repman.Conf.Arbitration && repman.Conf.ArbitrationRaft {
+		err = repman.InitRaft()
+		if err != nil {
+			log.WithError(err).Fatal("Raft arbitration initialization failed")
+		}
+	}
+
 	for _, gl := range repman.ClusterList {
 		repman.StartCluster(gl)
 	}
@@ -1050,6 +1080,9 @@ func (repman *ReplicationManager) Run() error {
 		s := <-sigs
 		log.Printf("RECEIVED SIGNAL: %s", s)
 		repman.UnMountS3()
+		if repman.Raft != nil {
+			repman.Raft.Stop()
+		}
 		for _, cl := range repman.Clusters {
 			cl.Stop()
 		}
@@ -1060,7 +1093,11 @@ func (repman *ReplicationManager) Run() error {
 
 	for repman.exit == false {
 		if repman.Conf.Arbitration {
-			repman.Heartbeat()
+			if repman.Conf.ArbitrationRaft {
+				repman.ProposeRaftState()
+			} else {
+				repman.Heartbeat()
+			}
 		}
 		if repman.Conf.Enterprise {
 			//			agents = svc.GetNodes()
@@ -1105,8 +1142,11 @@ func (repman *ReplicationManager) StartCluster(clusterName string) (*cluster.Clu
 	repman.VersionConfs[clusterName].ConfInit = myClusterConf
 
 	repman.currentCluster.Init(repman.VersionConfs[clusterName], clusterName, &repman.tlog, &repman.Logs, repman.termlength, repman.UUID, repman.Version, repman.Hostname)
+	repman.Lock()
 	repman.Clusters[clusterName] = repman.currentCluster
+	repman.Unlock()
 	repman.currentCluster.SetCertificate(repman.OpenSVC)
+	repman.initClusterRaft(repman.currentCluster)
 	go repman.currentCluster.Run()
 	return repman.currentCluster, nil
 }
@@ -1240,6 +1280,13 @@ func (repman *ReplicationManager) Stop() {
 		pprof.WriteHeapProfile(f)
 		f.Close()
 	}
+	if repman.traceShutdown != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := repman.traceShutdown(ctx); err != nil {
+			log.WithError(err).Error("Can't flush traces")
+		}
+	}
 
 }
 
@@ -40,7 +40,7 @@ var (
 	WithOpenSVC           string = "OFF"
 	WithTarball           string
 	WithEmbed             string = "OFF"
-	WithMySQLRouter       string
+	WithMySQLRouter       string = "OFF"
 	WithSphinx            string = "ON"
 	WithBackup            string = "ON"
 	// FullVersion is the semantic version number + git commit hash
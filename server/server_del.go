@@ -38,10 +38,9 @@ func (repman *ReplicationManager) DeleteCluster(clusterName string) error {
 	}
 
 	repman.ClusterList = newClusterList
-	_, ok := repman.Clusters[clusterName]
-	if ok {
-		delete(repman.Clusters, clusterName)
-	}
+	repman.Lock()
+	delete(repman.Clusters, clusterName)
+	repman.Unlock()
 
 	err := os.RemoveAll(repman.Conf.WorkingDir + "/" + clusterName)
 	if err != nil {
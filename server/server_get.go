@@ -6,7 +6,11 @@
 
 package server
 
-import "github.com/signal18/replication-manager/cluster"
+import (
+	"sort"
+
+	"github.com/signal18/replication-manager/cluster"
+)
 
 func (repman *ReplicationManager) getClusterByName(clname string) *cluster.Cluster {
 	var c *cluster.Cluster
@@ -15,3 +19,16 @@ func (repman *ReplicationManager) getClusterByName(clname string) *cluster.Clust
 	repman.Unlock()
 	return c
 }
+
+// getClusterList return the monitored clusters sorted by name, taken under
+// the lock so that a cluster added by the api does not race the iteration
+func (repman *ReplicationManager) getClusterList() []*cluster.Cluster {
+	repman.Lock()
+	clusters := make([]*cluster.Cluster, 0, len(repman.Clusters))
+	for _, cl := range repman.Clusters {
+		clusters = append(clusters, cl)
+	}
+	repman.Unlock()
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters
+}
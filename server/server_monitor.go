@@ -73,6 +73,19 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.MonitorIgnoreError, "monitoring-ignore-errors", "", "Comma separated list of error or warning to ignore")
 	monitorCmd.Flags().BoolVar(&conf.MonitorSchemaChange, "monitoring-schema-change", true, "Monitor schema change")
 	monitorCmd.Flags().StringVar(&conf.MonitorSchemaChangeScript, "monitoring-schema-change-script", "", "Monitor schema change external script")
+	monitorCmd.Flags().BoolVar(&conf.MonitorSchemaDrift, "monitoring-schema-drift", true, "Compare the tables of the replicas and of the shard clusters with the master")
+	monitorCmd.Flags().StringVar(&conf.SchemaChangeMethod, "schema-change-method", "rolling", "Default method of online schema changes rolling|shadow, rolling alter the replicas without binlog then switchover, shadow copy the table on the master with triggers")
+	monitorCmd.Flags().Int64Var(&conf.SchemaChangeMaxDelay, "schema-change-max-delay", 30, "Online schema change pause while the replication delay in seconds of a replica is above")
+	monitorCmd.Flags().Int64Var(&conf.SchemaChangeChunkSize, "schema-change-chunk-size", 1000, "Rows copied per statement by the shadow method of online schema changes")
+	monitorCmd.Flags().BoolVar(&conf.MonitorConsistency, "monitoring-consistency", false, "Continuously checksum the tables of the master by chunks and compare the replicas")
+	monitorCmd.Flags().Int64Var(&conf.MonitorConsistencyInterval, "monitoring-consistency-interval", 3600, "Seconds between the end of a consistency check pass over all tables and the next one")
+	monitorCmd.Flags().Int64Var(&conf.MonitorConsistencyChunkTime, "monitoring-consistency-chunk-time", 500, "Time budget in milliseconds of a consistency check chunk, the chunk size adapts to it")
+	monitorCmd.Flags().Int64Var(&conf.MonitorConsistencyMaxDelay, "monitoring-consistency-max-delay", 10, "Consistency check pause while the replication delay in seconds of a replica is above")
+	monitorCmd.Flags().BoolVar(&conf.MonitorConsistencyRepair, "monitoring-consistency-repair", false, "Apply the repair of mismatched chunks on the replica with binlog off, repairs are only generated when disabled")
+	monitorCmd.Flags().BoolVar(&conf.MonitorDigestHistory, "monitoring-digest-history", false, "Snapshot the performance schema statement digests of each server to track their trends and detect regressions")
+	monitorCmd.Flags().Int64Var(&conf.MonitorDigestHistoryInterval, "monitoring-digest-history-interval", 300, "Seconds between two snapshots of the statement digests")
+	monitorCmd.Flags().IntVar(&conf.MonitorDigestHistoryRetention, "monitoring-digest-history-retention", 7, "Days of statement digest snapshots kept, 0 keep everything")
+	monitorCmd.Flags().Float64Var(&conf.MonitorDigestRegressionFactor, "monitoring-digest-regression-factor", 2, "Ratio of the latency or rows examined per call of a digest to its baseline that is a regression")
 	monitorCmd.Flags().StringVar(&conf.MonitoringSSLCert, "monitoring-ssl-cert", "", "HTTPS & API TLS certificate")
 	monitorCmd.Flags().StringVar(&conf.MonitoringSSLKey, "monitoring-ssl-key", "", "HTTPS & API TLS key")
 	monitorCmd.Flags().StringVar(&conf.MonitoringKeyPath, "monitoring-key-path", "/etc/replication-manager/.replication-manager.key", "Encryption key file path")
@@ -86,6 +99,9 @@ func init() {
 	monitorCmd.Flags().IntVar(&conf.MonitorLongQueryLogLength, "monitoring-long-query-log-length", 200, "Number of slow queries to keep in monitor")
 	monitorCmd.Flags().IntVar(&conf.MonitorErrorLogLength, "monitoring-erreur-log-length", 20, "Number of error log line to keep in monitor")
 	monitorCmd.Flags().BoolVar(&conf.MonitorScheduler, "monitoring-scheduler", false, "Enable internal scheduler")
+	monitorCmd.Flags().IntVar(&conf.MonitorWorkflowStepRetries, "monitoring-workflow-step-retries", 1, "Number of retries of a failed workflow step before the workflow pause")
+	monitorCmd.Flags().IntVar(&conf.MonitorWorkflowStepTimeout, "monitoring-workflow-step-timeout", 3600, "Timeout in seconds of a workflow step")
+	monitorCmd.Flags().IntVar(&conf.MonitorWorkflowKeep, "monitoring-workflow-keep", 20, "Number of finished workflows kept in the working dir")
 	monitorCmd.Flags().BoolVar(&conf.MonitorCheckGrants, "monitoring-check-grants", true, "Check grants for replication and monitoring users, it use DNS Lookup")
 	monitorCmd.Flags().BoolVar(&conf.MonitorPause, "monitoring-pause", false, "Disable monitoring")
 	monitorCmd.Flags().BoolVar(&conf.MonitorProcessList, "monitoring-processlist", true, "Enable capture 50 longuest process via processlist")
@@ -98,6 +114,8 @@ func init() {
 	monitorCmd.Flags().BoolVar(&conf.LogHeartbeat, "log-heartbeat", false, "Log Heartbeat")
 	monitorCmd.Flags().BoolVar(&conf.LogFailedElection, "log-failed-election", false, "Log failed election")
 	monitorCmd.Flags().BoolVar(&conf.LogSQLInMonitoring, "log-sql-in-monitoring", false, "Log SQL queries send to servers in monitoring")
+	monitorCmd.Flags().BoolVar(&conf.EventsJournal, "events-journal", true, "Record state transitions, failovers and API actions in an on disk journal under the working directory")
+	monitorCmd.Flags().IntVar(&conf.EventsRetentionDays, "events-retention-days", 30, "Number of days of events to keep in the journal, 0 for no purge")
 	monitorCmd.Flags().BoolVar(&conf.MonitorCapture, "monitoring-capture", true, "Enable capture on error for 5 monitor loops")
 	monitorCmd.Flags().StringVar(&conf.MonitorCaptureTrigger, "monitoring-capture-trigger", "ERR00076,ERR00041", "List of errno triggering capture mode")
 	monitorCmd.Flags().IntVar(&conf.MonitorCaptureFileKeep, "monitoring-capture-file-keep", 5, "Purge capture file keep that number of them")
@@ -147,6 +165,9 @@ func init() {
 	monitorCmd.Flags().BoolVar(&conf.MultiTierSlave, "replication-multi-tier-slave", false, "Relay slaves topology")
 	monitorCmd.Flags().BoolVar(&conf.MasterSlavePgStream, "replication-master-slave-pg-stream", false, "Postgres streaming replication")
 	monitorCmd.Flags().BoolVar(&conf.MasterSlavePgLogical, "replication-master-slave-pg-locgical", false, "Postgres logical replication")
+	monitorCmd.Flags().StringVar(&conf.MasterSlavePgRejoinMethod, "replication-master-slave-pg-rejoin-method", "rewind", "Postgres streaming rejoin of a diverged old primary rewind|basebackup")
+	monitorCmd.Flags().StringVar(&conf.MasterSlavePgRejoinScript, "replication-master-slave-pg-rejoin-script", "", "Path of the script turning an old Postgres primary into a standby, called with method host port primary-host primary-port")
+	monitorCmd.Flags().IntVar(&conf.MasterSlavePgPromoteTimeout, "replication-master-slave-pg-promote-timeout", 60, "Seconds to wait for pg_promote on the new Postgres primary")
 	monitorCmd.Flags().BoolVar(&conf.ReplicationNoRelay, "replication-master-slave-never-relay", true, "Do not allow relay server MSS MXS XXM RSM")
 	monitorCmd.Flags().StringVar(&conf.ReplicationErrorScript, "replication-error-script", "", "Replication error script")
 	monitorCmd.Flags().StringVar(&conf.ReplicationRestartOnSQLErrorMatch, "replication-restart-on-sqlerror-match", "", "Auto restart replication on SQL Error regexep")
@@ -176,6 +197,7 @@ func init() {
 	monitorCmd.Flags().IntVar(&conf.PrintDelayStatInterval, "print-delay-stat-interval", 1, "Interval for printing delay stat (in minutes)")
 	monitorCmd.Flags().IntVar(&conf.DelayStatRotate, "delay-stat-rotate", 72, "Number of hours before rotating the delay stat")
 	monitorCmd.Flags().BoolVar(&conf.FailoverCheckDelayStat, "failover-check-delay-stat", false, "Use delay avg statistic for failover decision")
+	monitorCmd.Flags().StringVar(&conf.FailoverElectionPolicies, "failover-election-policies", "", "Weighted election policies among the most up to date candidates, comma separated list of policy[:weight] within zone, workload, delay, backup")
 	monitorCmd.Flags().BoolVar(&conf.Autoseed, "autoseed", false, "Automatic join a standalone node")
 	monitorCmd.Flags().BoolVar(&conf.Autorejoin, "autorejoin", true, "Automatic rejoin a failed master")
 	monitorCmd.Flags().BoolVar(&conf.AutorejoinBackupBinlog, "autorejoin-backup-binlog", true, "backup ahead binlogs events when old master rejoin")
@@ -204,6 +226,19 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.TeamsProxyUrl, "alert-teams-proxy-url", "", "Proxy url for Teams Webhook")
 	monitorCmd.Flags().StringVar(&conf.TeamsAlertState, "alert-teams-state", "", "State Code for Teams Alert : ERR|WARN|INFO")
 
+	monitorCmd.Flags().StringVar(&conf.AlertWebhookUrl, "alert-webhook-url", "", "Generic webhook URL receiving a JSON body for each alert")
+	monitorCmd.Flags().StringVar(&conf.AlertWebhookTemplate, "alert-webhook-template", "", "Path to a Go text template rendering the webhook JSON body, empty for default")
+	monitorCmd.Flags().StringVar(&conf.AlertIncidentUrl, "alert-incident-url", "https://events.pagerduty.com/v2/enqueue", "Incident API URL receiving trigger and resolve events")
+	monitorCmd.Flags().StringVar(&conf.AlertIncidentRoutingKey, "alert-incident-routing-key", "", "Incident API routing or integration key")
+	monitorCmd.Flags().StringVar(&conf.AlertChatUrl, "alert-chat-url", "", "Chat incoming webhook URL for alerts")
+	monitorCmd.Flags().StringVar(&conf.AlertChatFormat, "alert-chat-format", "slack", "Chat webhook message format slack|mattermost|teams")
+	monitorCmd.Flags().StringVar(&conf.AlertNotifierProxyUrl, "alert-notifier-proxy-url", "", "Proxy url for webhook, incident and chat notifiers")
+	monitorCmd.Flags().BoolVar(&conf.AlertSendResolved, "alert-send-resolved", true, "Send a resolved notification when an alerting state is closed")
+	monitorCmd.Flags().StringVar(&conf.AlertDestinationsFile, "alert-destinations-file", "", "Path to a JSON file of named webhook, incident, chat and mail destinations usable in alert routes")
+	monitorCmd.Flags().StringVar(&conf.AlertRoutesFile, "alert-routes-file", "", "Path to a JSON file of alert routes matching state codes to destinations, empty to route monitoring-alert-trigger to all destinations")
+	monitorCmd.Flags().IntVar(&conf.AlertDedupWindow, "alert-dedup-window", 300, "Time in seconds during which a repeated alert is not sent again to a destination")
+	monitorCmd.Flags().IntVar(&conf.AlertRateLimit, "alert-rate-limit", 10, "Maximum alerts per minute sent to a destination, 0 for unlimited")
+
 	conf.CheckType = "tcp"
 	monitorCmd.Flags().BoolVar(&conf.CheckReplFilter, "check-replication-filters", true, "Check that possible master have equal replication filters")
 	monitorCmd.Flags().BoolVar(&conf.CheckBinFilter, "check-binlog-filters", true, "Check that possible master have equal binlog filters")
@@ -303,19 +338,10 @@ func init() {
 	proxyjanitorprx := new(cluster.ProxyJanitor)
 	proxyjanitorprx.AddFlags(monitorCmd.Flags(), &conf)
 
-	// TODO: this seems dead code / unimplemented
-	// start
 	if WithMySQLRouter == "ON" {
-		monitorCmd.Flags().BoolVar(&conf.MysqlRouterOn, "mysqlrouter", false, "MySQLRouter proxy server is query for backend status")
-		monitorCmd.Flags().StringVar(&conf.MysqlRouterHosts, "mysqlrouter-servers", "127.0.0.1", "MaxScale hosts ")
-		monitorCmd.Flags().StringVar(&conf.MysqlRouterPort, "mysqlrouter-port", "6603", "MySQLRouter admin port")
-		monitorCmd.Flags().StringVar(&conf.MysqlRouterUser, "mysqlrouter-user", "admin", "MySQLRouter admin user")
-		monitorCmd.Flags().StringVar(&conf.MysqlRouterPass, "mysqlrouter-pass", "mariadb", "MySQLRouter admin password")
-		monitorCmd.Flags().IntVar(&conf.MysqlRouterWritePort, "mysqlrouter-write-port", 3306, "MySQLRouter read-write port to leader")
-		monitorCmd.Flags().IntVar(&conf.MysqlRouterReadPort, "mysqlrouter-read-port", 3307, "MySQLRouter load balance read port to all nodes")
-		monitorCmd.Flags().IntVar(&conf.MysqlRouterReadWritePort, "mysqlrouter-read-write-port", 3308, "MySQLRouter load balance read port to all nodes")
+		mysqlrouterprx := new(cluster.MysqlRouterProxy)
+		mysqlrouterprx.AddFlags(monitorCmd.Flags(), &conf)
 	}
-	// end of dead code
 
 	if WithMariadbshardproxy == "ON" {
 		mdbsprx := new(cluster.MariadbShardProxy)
@@ -355,16 +381,26 @@ func init() {
 		monitorCmd.Flags().BoolVar(&conf.GraphiteMetrics, "graphite-metrics", false, "Enable Graphite monitoring")
 		monitorCmd.Flags().BoolVar(&conf.GraphiteEmbedded, "graphite-embedded", false, "Enable Internal Graphite Carbon Server")
 	}
+	monitorCmd.Flags().StringVar(&conf.OtelExporter, "otel-exporter", "", "OpenTelemetry trace exporter (otlp|file), tracing disabled when empty")
+	monitorCmd.Flags().StringVar(&conf.OtelEndpoint, "otel-endpoint", "localhost:4317", "OpenTelemetry OTLP collector host:port")
+	monitorCmd.Flags().StringVar(&conf.OtelProtocol, "otel-protocol", "grpc", "OpenTelemetry OTLP protocol (grpc|http)")
+	monitorCmd.Flags().BoolVar(&conf.OtelInsecure, "otel-insecure", false, "OpenTelemetry OTLP collector without TLS")
+	monitorCmd.Flags().StringVar(&conf.OtelFile, "otel-file", "/var/lib/replication-manager/traces.json", "OpenTelemetry file exporter path, one JSON span per line")
+	monitorCmd.Flags().Float64Var(&conf.OtelSampleRatio, "otel-sample-ratio", 1.0, "OpenTelemetry ratio of sampled traces")
 	//	monitorCmd.Flags().BoolVar(&conf.Heartbeat, "heartbeat-table", false, "Heartbeat for active/passive or multi mrm setup")
 	if WithArbitrationClient == "ON" {
 		monitorCmd.Flags().BoolVar(&conf.Arbitration, "arbitration-external", false, "Multi moninitor sas arbitration")
-		monitorCmd.Flags().StringVar(&conf.ArbitrationSasSecret, "arbitration-external-secret", "", "Secret for arbitration")
-		monitorCmd.Flags().StringVar(&conf.ArbitrationSasHosts, "arbitration-external-hosts", "88.191.151.84:80", "Arbitrator address")
+		monitorCmd.Flags().StringVar(&conf.ArbitrationSasSecret, "arbitration-external-secret", "", "Secret signing the requests to the arbitrators, monitors sharing it form one arbitration group")
+		monitorCmd.Flags().StringVar(&conf.ArbitrationSasHosts, "arbitration-external-hosts", "88.191.151.84:80", "Arbitrator addresses, comma separated list of the arbitrators of a quorum")
 		monitorCmd.Flags().IntVar(&conf.ArbitrationSasUniqueId, "arbitration-external-unique-id", 0, "Unique replication-manager instance idententifier")
 		monitorCmd.Flags().StringVar(&conf.ArbitrationPeerHosts, "arbitration-peer-hosts", "127.0.0.1:10001", "Peer replication-manager hosts http port")
 		monitorCmd.Flags().StringVar(&conf.DBServersLocality, "db-servers-locality", "127.0.0.1", "List database servers that are in same network locality")
 		monitorCmd.Flags().StringVar(&conf.ArbitrationFailedMasterScript, "arbitration-failed-master-script", "", "External script when a master lost arbitration during split brain")
 		monitorCmd.Flags().IntVar(&conf.ArbitrationReadTimout, "arbitration-read-timeout", 800, "Read timeout for arbotration response in millisec don't woveload monitoring ticker in second")
+		monitorCmd.Flags().BoolVar(&conf.ArbitrationRaft, "arbitration-raft", false, "Elect the active monitor with raft among arbitration-peer-hosts instead of the external arbitrator")
+		monitorCmd.Flags().StringVar(&conf.ArbitrationRaftAddress, "arbitration-raft-address", "", "Address of this monitor http server as listed in arbitration-peer-hosts, default to http-bind-address:http-port")
+		monitorCmd.Flags().IntVar(&conf.ArbitrationRaftElectionTimeout, "arbitration-raft-election-timeout", 2000, "Raft election timeout in millisec, leader heartbeats are sent every fifth of it")
+		monitorCmd.Flags().StringVar(&conf.ArbitrationRaftSecret, "arbitration-raft-secret", "", "Secret shared by raft peers")
 	}
 
 	monitorCmd.Flags().StringVar(&conf.SchedulerReceiverPorts, "scheduler-db-servers-receiver-ports", "4444", "Scheduler TCP port to send data to db node, if list port affection is modulo db nodes")
@@ -415,6 +451,14 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.BackupStreamingEndpoint, "backup-streaming-endpoint", "https://s3.signal18.io/", "Backup AWS endpoint")
 	monitorCmd.Flags().StringVar(&conf.BackupStreamingRegion, "backup-streaming-region", "fr-1", "Backup AWS region")
 	monitorCmd.Flags().StringVar(&conf.BackupStreamingBucket, "backup-streaming-bucket", "repman", "Backup AWS bucket")
+	monitorCmd.Flags().StringVar(&conf.BackupStorage, "backup-storage", "", "Copy backups, binlogs and crash files to storage without FUSE mount: local|s3|azure, s3 use the backup-streaming settings")
+	monitorCmd.Flags().StringVar(&conf.BackupStoragePath, "backup-storage-path", "", "Directory of the local backup storage")
+	monitorCmd.Flags().StringVar(&conf.BackupStoragePrefix, "backup-storage-prefix", "", "Prefix of the keys in the backup storage")
+	monitorCmd.Flags().IntVar(&conf.BackupStoragePartSize, "backup-storage-part-size", 16, "Part size in MB of the multipart uploads to the backup storage")
+	monitorCmd.Flags().StringVar(&conf.BackupStorageAzureAccount, "backup-storage-azure-account", "", "Azure storage account of the backup storage")
+	monitorCmd.Flags().StringVar(&conf.BackupStorageAzureKey, "backup-storage-azure-key", "", "Azure storage account key of the backup storage")
+	monitorCmd.Flags().StringVar(&conf.BackupStorageAzureContainer, "backup-storage-azure-container", "repman", "Azure blob container of the backup storage")
+	monitorCmd.Flags().StringVar(&conf.BackupStorageAzureEndpoint, "backup-storage-azure-endpoint", "", "Azure blob endpoint, default is https://<account>.blob.core.windows.net/")
 
 	//monitorCmd.Flags().StringVar(&conf.BackupResticStoragePolicy, "backup-restic-storage-policy", "--prune --keep-last 10 --keep-hourly 24 --keep-daily 7 --keep-weekly 52 --keep-monthly 120 --keep-yearly 102", "Restic keep backup policy")
 	monitorCmd.Flags().IntVar(&conf.BackupKeepHourly, "backup-keep-hourly", 1, "Keep this number of hourly backup")
@@ -437,6 +481,16 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.BackupMysqlclientPath, "backup-mysqlclient-path", "", "Path to mysql client binary")
 	monitorCmd.Flags().BoolVar(&conf.BackupBinlogs, "backup-binlogs", false, "Archive binlogs")
 	monitorCmd.Flags().IntVar(&conf.BackupBinlogsKeep, "backup-binlogs-keep", 10, "Number of master binlog to keep")
+	monitorCmd.Flags().Int64Var(&conf.BackupPitrTimeout, "backup-pitr-timeout", 3600, "Seconds to wait for the provisioning and the physical restore of a point-in-time recovery")
+	monitorCmd.Flags().BoolVar(&conf.SchedulerBackupVerify, "scheduler-db-servers-backup-verify", false, "Schedule verification of the latest logical and physical backups by restoring them in a local sandbox")
+	monitorCmd.Flags().StringVar(&conf.BackupVerifyCron, "scheduler-db-servers-backup-verify-cron", "0 0 5 * * 6", "Backup verification cron expression represents a set of times, using 6 space-separated fields.")
+	monitorCmd.Flags().IntVar(&conf.BackupVerifyPort, "backup-verify-port", 3399, "Port of the local sandbox instance restoring the backups to verify")
+	monitorCmd.Flags().BoolVar(&conf.BackupVerifyChecksum, "backup-verify-checksum", true, "Compare row counts and checksums of the restored tables with a replica, the backup source when it is one")
+	monitorCmd.Flags().Int64Var(&conf.BackupVerifyTimeout, "backup-verify-timeout", 600, "Seconds to wait for the sandbox instance to start and stop")
+	monitorCmd.Flags().BoolVar(&conf.BackupEncrypt, "backup-encrypt", false, "Encrypt physical and logical backups and archived binlogs with AES-256-GCM")
+	monitorCmd.Flags().StringVar(&conf.BackupEncryptKeyring, "backup-encrypt-keyring", "", "Keyring file of the keys wrapping the backup data keys, created by the backup-key-init action, default is backup.keyring in the working directory")
+	monitorCmd.Flags().StringVar(&conf.BackupEncryptVaultKey, "backup-encrypt-vault-transit-key", "", "Vault transit key wrapping the backup data keys instead of the keyring when Vault is used")
+	monitorCmd.Flags().StringVar(&conf.BackupEncryptVaultMount, "backup-encrypt-vault-transit-mount", "transit", "Mount path of the Vault transit secrets engine")
 	monitorCmd.Flags().BoolVar(&conf.ProvBinaryInTarball, "prov-db-binary-in-tarball", false, "Add prov-db-binary-tarball-name binaries to init tarball")
 	monitorCmd.Flags().StringVar(&conf.ProvBinaryTarballName, "prov-db-binary-tarball-name", "mysql-8.0.17-macos10.14-x86_64.tar.gz", "Name of binary tarball to put in tarball")
 
@@ -496,6 +550,10 @@ func init() {
 	monitorCmd.Flags().StringVar(&conf.ProvProxyStartScript, "prov-proxy-start-script", "", "Proxy start script")
 	monitorCmd.Flags().StringVar(&conf.ProvDbStopScript, "prov-db-stop-script", "", "Database stop script")
 	monitorCmd.Flags().StringVar(&conf.ProvProxyStopScript, "prov-proxy-stop-script", "", "Proxy stop script")
+	monitorCmd.Flags().StringVar(&conf.ProvDbUpgradeScript, "prov-db-upgrade-script", "", "Database upgrade script called with host port user password cluster and the target version or package of a rolling upgrade")
+	monitorCmd.Flags().StringVar(&conf.ProvDbUpgradeBinaryPath, "prov-db-upgrade-binary-path", "", "Path to mysql_upgrade or mariadb-upgrade binary")
+	monitorCmd.Flags().Int64Var(&conf.ProvDbUpgradeMaxDelay, "prov-db-upgrade-max-delay", 30, "Rolling upgrade max replication delay in seconds of an upgraded replica")
+	monitorCmd.Flags().StringVar(&conf.ProvDbUpgradeOnFailure, "prov-db-upgrade-on-failure", "pause", "Rolling upgrade action when a node fails its checks pause|rollback")
 
 	monitorCmd.Flags().BoolVar(&conf.OnPremiseSSH, "onpremise-ssh", false, "Connect to host via SSH using user private key")
 	monitorCmd.Flags().StringVar(&conf.OnPremiseSSHPrivateKey, "onpremise-ssh-private-key", "", "Private key for ssh if none use the user HOME directory")
@@ -545,7 +603,7 @@ func init() {
 		monitorCmd.Flags().StringVar(&conf.ProvProxProxysqlImg, "prov-proxy-docker-proxysql-img", "signal18/proxysql:1.4", "Docker image for proxysql")
 		monitorCmd.Flags().StringVar(&conf.ProvProxMaxscaleImg, "prov-proxy-docker-maxscale-img", "mariadb/maxscale:2.2", "Docker image for maxscale proxy")
 		monitorCmd.Flags().StringVar(&conf.ProvProxHaproxyImg, "prov-proxy-docker-haproxy-img", "haproxytech/haproxy-alpine:2.4", "Docker image for haproxy")
-		monitorCmd.Flags().StringVar(&conf.ProvProxMysqlRouterImg, "prov-proxy-docker-mysqlrouter-img", "pulsepointinc/mysql-router", "Docker image for MySQLRouter")
+		monitorCmd.Flags().StringVar(&conf.ProvProxMysqlRouterImg, "prov-proxy-docker-mysqlrouter-img", "mysql/mysql-router:8.0", "Docker image for MySQLRouter")
 		monitorCmd.Flags().StringVar(&conf.ProvProxShardingImg, "prov-proxy-docker-shardproxy-img", "signal18/mariadb104-spider", "Docker image for sharding proxy")
 		monitorCmd.Flags().StringVar(&conf.ProvSphinxImg, "prov-sphinx-docker-img", "leodido/sphinxsearch", "Docker image for SphinxSearch")
 		monitorCmd.Flags().StringVar(&conf.ProvSphinxTags, "prov-sphinx-tags", "masterslave", "playbook configuration tags wsrep,multimaster,masterslave")
@@ -0,0 +1,171 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/consensus"
+	log "github.com/sirupsen/logrus"
+)
+
+// InitRaft start the raft node of the monitor, the group is made of
+// arbitration-peer-hosts and the node id is its own entry in that list
+func (repman *ReplicationManager) InitRaft() error {
+	id := repman.Conf.ArbitrationRaftAddress
+	if id == "" {
+		id = repman.Conf.BindAddr + ":" + repman.Conf.HttpPort
+	}
+	var peers []string
+	for _, peer := range strings.Split(repman.Conf.ArbitrationPeerHosts, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" && peer != id {
+			peers = append(peers, peer)
+		}
+	}
+	timeout := time.Duration(repman.Conf.ArbitrationRaftElectionTimeout) * time.Millisecond
+	transport, err := consensus.NewHTTPTransport(repman.Conf.GetDecryptedValue("arbitration-raft-secret"), timeout/2)
+	if err != nil {
+		return err
+	}
+	node, err := consensus.NewNode(id, peers, repman.Conf.WorkingDir+"/raft", timeout, transport)
+	if err != nil {
+		return err
+	}
+	node.OnLeaderChange = repman.raftLeaderChange
+	node.OnApply = repman.raftApply
+	repman.raftTransport = transport
+	repman.Raft = node
+	node.Start()
+	log.WithFields(log.Fields{"id": id, "peers": strings.Join(peers, ",")}).Info("Raft arbitration started")
+	return nil
+}
+
+// raftLeaderChange make the raft leader the only active monitor
+func (repman *ReplicationManager) raftLeaderChange(leader bool) {
+	status := ConstMonitorStandby
+	if leader {
+		status = ConstMonitorActif
+	}
+	repman.Lock()
+	repman.Status = status
+	repman.Unlock()
+	for _, cl := range repman.getClusterList() {
+		cl.SetActiveStatus(status)
+	}
+	log.Infof("Raft leadership %t, monitor status set to %s", leader, status)
+}
+
+func (repman *ReplicationManager) raftApply(key string, value json.RawMessage) {
+	cl := repman.getClusterByName(key)
+	if cl == nil {
+		return
+	}
+	err := cl.SetReplicatedState(value)
+	if err != nil {
+		cl.LogPrintf(cluster.LvlErr, "Could not apply raft state: %s", err)
+	}
+}
+
+// initClusterRaft attach a started cluster to the raft node
+func (repman *ReplicationManager) initClusterRaft(cl *cluster.Cluster) {
+	if repman.Raft == nil {
+		return
+	}
+	cl.Consensus = repman.Raft
+	if value, ok := repman.Raft.Get(cl.Name); ok {
+		repman.raftApply(cl.Name, value)
+	}
+	if repman.Raft.IsLeader() {
+		cl.SetActiveStatus(ConstMonitorActif)
+	}
+}
+
+// ProposeRaftState replicate the state of every cluster when leader
+func (repman *ReplicationManager) ProposeRaftState() {
+	if repman.Raft == nil || !repman.Raft.IsLeader() {
+		return
+	}
+	for _, cl := range repman.getClusterList() {
+		err := cl.ProposeReplicatedState()
+		if err != nil {
+			cl.LogPrintf(cluster.LvlErr, "Could not replicate raft state: %s", err)
+		}
+	}
+}
+
+// readRaftRequest authenticate the signed request of a peer and decode it
+func (repman *ReplicationManager) readRaftRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if repman.Raft == nil {
+		http.Error(w, "Raft arbitration disabled", 503)
+		return false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 16777216))
+	if err != nil {
+		http.Error(w, "Read error :"+err.Error(), 500)
+		return false
+	}
+	err = repman.raftTransport.Verify(r, body)
+	if err != nil {
+		log.Warnf("Refused raft request %s from %s: %s", r.URL.Path, r.RemoteAddr, err)
+		http.Error(w, "Invalid raft signature", 403)
+		return false
+	}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		http.Error(w, "Decode error :"+err.Error(), 500)
+		return false
+	}
+	return true
+}
+
+func (repman *ReplicationManager) handlerMuxRaftVote(w http.ResponseWriter, r *http.Request) {
+	var req consensus.VoteRequest
+	if !repman.readRaftRequest(w, r, &req) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err := json.NewEncoder(w).Encode(repman.Raft.HandleVote(req))
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxRaftAppend(w http.ResponseWriter, r *http.Request) {
+	var req consensus.AppendRequest
+	if !repman.readRaftRequest(w, r, &req) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	err := json.NewEncoder(w).Encode(repman.Raft.HandleAppend(req))
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+	}
+}
+
+func (repman *ReplicationManager) handlerMuxRaftStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if repman.Raft == nil {
+		http.Error(w, "Raft arbitration disabled", 503)
+		return
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err := e.Encode(repman.Raft.GetStatus())
+	if err != nil {
+		http.Error(w, "Encoding error", 500)
+	}
+}
@@ -0,0 +1,46 @@
+#!/bin/bash
+# Sample replication-master-slave-pg-rejoin-script
+# Restart a PostgreSQL server as a streaming standby of the primary
+# usage: pg_rejoin.sh standby|rewind|basebackup host port primary-host primary-port
+# REPLICATION_USER and REPLICATION_PASSWORD are set by replication-manager
+
+METHOD=$1
+HOST=$2
+PORT=$3
+PRIMARY_HOST=$4
+PRIMARY_PORT=$5
+
+PGDATA=${PGDATA:-/var/lib/postgresql/data}
+PGBIN=${PGBIN:-/usr/lib/postgresql/14/bin}
+# password file of the replication user on the server, kept for the standby
+PGPASSFILE=${PGPASSFILE:-/var/lib/postgresql/.pgpass_replication}
+SSH="ssh -o BatchMode=yes postgres@$HOST"
+SOURCE="host=$PRIMARY_HOST port=$PRIMARY_PORT user=$REPLICATION_USER passfile=$PGPASSFILE dbname=postgres"
+
+# the password is sent on stdin so that it never shows in a command line
+pgpass_escape() {
+  printf '%s' "$1" | sed -e 's/[\\:]/\\&/g'
+}
+if [ "$METHOD" != "standby" ]; then
+  printf '%s:%s:*:%s:%s\n' "$(pgpass_escape "$PRIMARY_HOST")" "$PRIMARY_PORT" "$(pgpass_escape "$REPLICATION_USER")" "$(pgpass_escape "$REPLICATION_PASSWORD")" |
+    $SSH "umask 077 && cat > $PGPASSFILE" || exit 1
+fi
+
+$SSH "$PGBIN/pg_ctl -D $PGDATA -m fast -w stop"
+
+case $METHOD in
+  standby)
+    ;;
+  rewind)
+    $SSH "$PGBIN/pg_rewind -D $PGDATA --source-server='$SOURCE' --write-recovery-conf --progress" || exit 1
+    ;;
+  basebackup)
+    $SSH "rm -rf $PGDATA.old && mv $PGDATA $PGDATA.old && PGPASSFILE=$PGPASSFILE $PGBIN/pg_basebackup -h $PRIMARY_HOST -p $PRIMARY_PORT -U $REPLICATION_USER -D $PGDATA -X stream --write-recovery-conf --progress" || exit 1
+    ;;
+  *)
+    echo "Unknown method $METHOD"
+    exit 1
+    ;;
+esac
+
+$SSH "touch $PGDATA/standby.signal && $PGBIN/pg_ctl -D $PGDATA -o '-p $PORT' -w start"
@@ -17,6 +17,7 @@ import (
 	"log"
 	"net/smtp"
 	"strings"
+	"time"
 
 	"github.com/jordan-wright/email"
 	"github.com/signal18/replication-manager/config"
@@ -34,6 +35,13 @@ type Alert struct {
 	User        string
 	Password    string
 	TlsVerify   bool
+	ErrKey      string
+	ErrType     string
+	ErrFrom     string
+	ServerUrl   string
+	Monitor     string
+	Resolved    bool
+	Timestamp   time.Time
 }
 
 func (a *Alert) EmailMessage(msg string, subj string, Conf config.Config) error {
@@ -0,0 +1,417 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// notifier.go
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+const (
+	ConstNotifierWebhook  string = "webhook"
+	ConstNotifierIncident string = "incident"
+	ConstNotifierChat     string = "chat"
+	ConstNotifierMail     string = "mail"
+)
+
+const (
+	ConstChatFormatSlack      string = "slack"
+	ConstChatFormatMattermost string = "mattermost"
+	ConstChatFormatTeams      string = "teams"
+)
+
+const (
+	ConstAlertFiring   string = "firing"
+	ConstAlertResolved string = "resolved"
+)
+
+// DefaultWebhookTemplate is used by the webhook notifier when no template is configured
+const DefaultWebhookTemplate string = `{"status":{{json .GetStatus}},"cluster":{{json .Cluster}},"monitor":{{json .Monitor}},"code":{{json .ErrKey}},"type":{{json .ErrType}},"from":{{json .ErrFrom}},"server":{{json .ServerUrl}},"desc":{{json .State}},"timestamp":{{json .Timestamp}}}`
+
+// Notifier is implemented by all alert backends. The same Notify call is used
+// to open and to resolve an alert, backends read Alert.Resolved to know which.
+// Routes address a notifier by its name, the notifiers of the alert flags are
+// named after their type.
+type Notifier interface {
+	GetName() string
+	GetType() string
+	Notify(a Alert) error
+}
+
+// Destination is a named notifier of the destinations file, so that routes
+// can send to several endpoints of the same type
+type Destination struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Url        string            `json:"url"`
+	Template   string            `json:"template"`
+	Headers    map[string]string `json:"headers"`
+	RoutingKey string            `json:"routingKey"`
+	Format     string            `json:"format"`
+	To         string            `json:"to"`
+}
+
+// LoadDestinations read a JSON array of destinations, names must be unique
+// and can not be one of the built-in mail and script destinations
+func LoadDestinations(filename string) ([]Destination, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var dests []Destination
+	err = json.Unmarshal(content, &dests)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i, d := range dests {
+		if d.Name == "" {
+			return nil, fmt.Errorf("Destination %d has no name", i)
+		}
+		if d.Name == ConstDestinationMail || d.Name == ConstDestinationScript {
+			return nil, fmt.Errorf("Destination name %s is reserved", d.Name)
+		}
+		if names[d.Name] {
+			return nil, fmt.Errorf("Duplicate destination %s", d.Name)
+		}
+		names[d.Name] = true
+	}
+	return dests, nil
+}
+
+// NewNotifier build the notifier of a destination, the template of a webhook
+// is a file path
+func NewNotifier(d Destination, proxy string, conf *config.Config) (Notifier, error) {
+	switch d.Type {
+	case ConstNotifierWebhook:
+		tmpl := ""
+		if d.Template != "" {
+			content, err := ioutil.ReadFile(d.Template)
+			if err != nil {
+				return nil, err
+			}
+			tmpl = string(content)
+		}
+		n, err := NewWebhookNotifier(d.Url, tmpl, proxy)
+		if err != nil {
+			return nil, err
+		}
+		n.Name = d.Name
+		for k, v := range d.Headers {
+			n.Headers[k] = v
+		}
+		return n, nil
+	case ConstNotifierIncident:
+		endpoint := d.Url
+		if endpoint == "" {
+			endpoint = conf.AlertIncidentUrl
+		}
+		n, err := NewIncidentNotifier(endpoint, d.RoutingKey, proxy)
+		if err != nil {
+			return nil, err
+		}
+		n.Name = d.Name
+		return n, nil
+	case ConstNotifierChat:
+		n, err := NewChatNotifier(d.Url, d.Format, proxy)
+		if err != nil {
+			return nil, err
+		}
+		n.Name = d.Name
+		return n, nil
+	case ConstNotifierMail:
+		return NewMailNotifier(d.Name, d.To, conf)
+	}
+	return nil, fmt.Errorf("Unsupported destination type %s", d.Type)
+}
+
+func (a Alert) GetStatus() string {
+	if a.Resolved {
+		return ConstAlertResolved
+	}
+	return ConstAlertFiring
+}
+
+// GetDedupKey identify the incident an alert belongs to, so that the resolve
+// message closes the matching trigger
+func (a Alert) GetDedupKey() string {
+	if a.ServerUrl != "" {
+		return a.Cluster + "/" + a.ErrKey + "/" + a.ServerUrl
+	}
+	return a.Cluster + "/" + a.ErrKey
+}
+
+func (a Alert) GetText() string {
+	text := fmt.Sprintf("[%s] %s %s: %s", a.Cluster, a.GetStatus(), a.ErrKey, a.State)
+	if a.ServerUrl != "" {
+		text = text + " (" + a.ServerUrl + ")"
+	}
+	return text
+}
+
+func newHttpClient(proxy string) *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if proxy != "" {
+		proxyUrl, err := url.Parse(proxy)
+		if err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyUrl)}
+		}
+	}
+	return client
+}
+
+func postJSON(client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Notifier post to %s returned %d: %s", url, resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+// WebhookNotifier post a JSON body rendered from a text template
+type WebhookNotifier struct {
+	Name     string
+	Url      string
+	Headers  map[string]string
+	template *template.Template
+	client   *http.Client
+}
+
+func NewWebhookNotifier(url string, tmpl string, proxy string) (*WebhookNotifier, error) {
+	if url == "" {
+		return nil, errors.New("Empty webhook url")
+	}
+	if tmpl == "" {
+		tmpl = DefaultWebhookTemplate
+	}
+	t, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookNotifier{Name: ConstNotifierWebhook, Url: url, Headers: make(map[string]string), template: t, client: newHttpClient(proxy)}, nil
+}
+
+func (n *WebhookNotifier) GetName() string {
+	return n.Name
+}
+
+func (n *WebhookNotifier) GetType() string {
+	return ConstNotifierWebhook
+}
+
+func (n *WebhookNotifier) Render(a Alert) ([]byte, error) {
+	var buf bytes.Buffer
+	err := n.template.Execute(&buf, a)
+	return buf.Bytes(), err
+}
+
+func (n *WebhookNotifier) Notify(a Alert) error {
+	body, err := n.Render(a)
+	if err != nil {
+		return err
+	}
+	return postJSON(n.client, n.Url, body, n.Headers)
+}
+
+// IncidentNotifier speak the PagerDuty events v2 protocol, trigger and resolve
+// are keyed by cluster, state code and server
+type IncidentNotifier struct {
+	Name       string
+	Url        string
+	RoutingKey string
+	client     *http.Client
+}
+
+type incidentPayload struct {
+	Summary   string `json:"summary"`
+	Source    string `json:"source"`
+	Severity  string `json:"severity"`
+	Component string `json:"component,omitempty"`
+	Group     string `json:"group,omitempty"`
+	Class     string `json:"class,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type incidentEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     *incidentPayload `json:"payload,omitempty"`
+}
+
+func NewIncidentNotifier(url string, routingKey string, proxy string) (*IncidentNotifier, error) {
+	if url == "" {
+		return nil, errors.New("Empty incident url")
+	}
+	if routingKey == "" {
+		return nil, errors.New("Empty incident routing key")
+	}
+	return &IncidentNotifier{Name: ConstNotifierIncident, Url: url, RoutingKey: routingKey, client: newHttpClient(proxy)}, nil
+}
+
+func (n *IncidentNotifier) GetName() string {
+	return n.Name
+}
+
+func (n *IncidentNotifier) GetType() string {
+	return ConstNotifierIncident
+}
+
+func (n *IncidentNotifier) Notify(a Alert) error {
+	ev := incidentEvent{
+		RoutingKey:  n.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    a.GetDedupKey(),
+	}
+	if a.Resolved {
+		ev.EventAction = "resolve"
+	} else {
+		severity := "warning"
+		if a.ErrType == "ERROR" {
+			severity = "error"
+		}
+		source := a.ServerUrl
+		if source == "" {
+			source = a.Monitor
+		}
+		ev.Payload = &incidentPayload{
+			Summary:   a.GetText(),
+			Source:    source,
+			Severity:  severity,
+			Component: a.ErrFrom,
+			Group:     a.Cluster,
+			Class:     a.ErrKey,
+			Timestamp: a.Timestamp.Format(time.RFC3339),
+		}
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return postJSON(n.client, n.Url, body, nil)
+}
+
+// ChatNotifier post a short text message to Slack, Mattermost or Teams incoming webhooks
+type ChatNotifier struct {
+	Name   string
+	Url    string
+	Format string
+	client *http.Client
+}
+
+func NewChatNotifier(url string, format string, proxy string) (*ChatNotifier, error) {
+	if url == "" {
+		return nil, errors.New("Empty chat url")
+	}
+	switch format {
+	case ConstChatFormatSlack, ConstChatFormatMattermost, ConstChatFormatTeams:
+	case "":
+		format = ConstChatFormatSlack
+	default:
+		return nil, fmt.Errorf("Unsupported chat format %s", format)
+	}
+	return &ChatNotifier{Name: ConstNotifierChat, Url: url, Format: format, client: newHttpClient(proxy)}, nil
+}
+
+func (n *ChatNotifier) GetName() string {
+	return n.Name
+}
+
+func (n *ChatNotifier) GetType() string {
+	return ConstNotifierChat
+}
+
+func (n *ChatNotifier) Notify(a Alert) error {
+	var msg interface{}
+	switch n.Format {
+	case ConstChatFormatTeams:
+		color := "#b22222"
+		if a.Resolved {
+			color = "#2e8b57"
+		} else if a.ErrType != "ERROR" {
+			color = "#112233"
+		}
+		msg = map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"themeColor": color,
+			"title":      "Replication-Manager alert. Monitor: " + a.Monitor,
+			"text":       a.GetText(),
+		}
+	default:
+		msg = map[string]string{"text": a.GetText()}
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return postJSON(n.client, n.Url, body, nil)
+}
+
+// MailNotifier send the alert to its own recipients with the mail server of
+// the configuration
+type MailNotifier struct {
+	Name string
+	To   string
+	conf *config.Config
+}
+
+func NewMailNotifier(name string, to string, conf *config.Config) (*MailNotifier, error) {
+	if to == "" {
+		return nil, errors.New("Empty mail recipients")
+	}
+	return &MailNotifier{Name: name, To: to, conf: conf}, nil
+}
+
+func (n *MailNotifier) GetName() string {
+	return n.Name
+}
+
+func (n *MailNotifier) GetType() string {
+	return ConstNotifierMail
+}
+
+func (n *MailNotifier) Notify(a Alert) error {
+	conf := *n.conf
+	conf.MailTo = n.To
+	if a.Resolved {
+		return a.EmailMessage(a.GetText(), fmt.Sprintf("Replication-Manager@%s Alert - Cluster %s state resolved", conf.MonitorAddress, a.Cluster), conf)
+	}
+	return a.EmailMessage("", "", conf)
+}
@@ -0,0 +1,196 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+// recorder is an http endpoint keeping the bodies posted to each path
+type recorder struct {
+	server *httptest.Server
+	bodies map[string][]map[string]interface{}
+	status int
+}
+
+func newRecorder(t *testing.T) *recorder {
+	r := &recorder{bodies: make(map[string][]map[string]interface{}), status: http.StatusOK}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		content, _ := ioutil.ReadAll(req.Body)
+		if err := json.Unmarshal(content, &body); err != nil {
+			t.Errorf("Invalid JSON body %s: %s", content, err)
+		}
+		r.bodies[req.URL.Path] = append(r.bodies[req.URL.Path], body)
+		w.WriteHeader(r.status)
+	}))
+	return r
+}
+
+var testAlert = Alert{Cluster: "c1", ErrKey: "ERR00042", ErrType: "ERROR", ErrFrom: "TOPO", ServerUrl: "db1:3306", State: "Master down", Monitor: "repman1", Timestamp: time.Unix(1600000000, 0).UTC()}
+
+func TestWebhookNotifier(t *testing.T) {
+	r := newRecorder(t)
+	defer r.server.Close()
+	n, err := NewWebhookNotifier(r.server.URL+"/hook", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.GetName() != ConstNotifierWebhook {
+		t.Errorf("Expected webhook notifier to be named after its type, got %s", n.GetName())
+	}
+	if err := n.Notify(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	body := r.bodies["/hook"][0]
+	if body["status"] != ConstAlertFiring || body["code"] != "ERR00042" || body["server"] != "db1:3306" {
+		t.Errorf("Unexpected webhook body %v", body)
+	}
+	r.status = http.StatusInternalServerError
+	if err := n.Notify(testAlert); err == nil {
+		t.Error("Expected an error on a failed post")
+	}
+	if _, err := NewWebhookNotifier(r.server.URL, "{{.Missing", ""); err == nil {
+		t.Error("Expected an invalid template to be refused")
+	}
+}
+
+func TestIncidentNotifier(t *testing.T) {
+	r := newRecorder(t)
+	defer r.server.Close()
+	n, err := NewIncidentNotifier(r.server.URL+"/enqueue", "key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	resolved := testAlert
+	resolved.Resolved = true
+	if err := n.Notify(resolved); err != nil {
+		t.Fatal(err)
+	}
+	events := r.bodies["/enqueue"]
+	if len(events) != 2 || events[0]["event_action"] != "trigger" || events[1]["event_action"] != "resolve" {
+		t.Fatalf("Unexpected incident events %v", events)
+	}
+	if events[0]["dedup_key"] != events[1]["dedup_key"] || events[0]["dedup_key"] != "c1/ERR00042/db1:3306" {
+		t.Errorf("Expected trigger and resolve to share the dedup key, got %v", events)
+	}
+	if payload := events[0]["payload"].(map[string]interface{}); payload["severity"] != "error" || payload["source"] != "db1:3306" {
+		t.Errorf("Unexpected incident payload %v", payload)
+	}
+	if _, err := NewIncidentNotifier(r.server.URL, "", ""); err == nil {
+		t.Error("Expected an empty routing key to be refused")
+	}
+}
+
+func TestChatNotifier(t *testing.T) {
+	r := newRecorder(t)
+	defer r.server.Close()
+	slack, err := NewChatNotifier(r.server.URL+"/slack", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	teams, err := NewChatNotifier(r.server.URL+"/teams", ConstChatFormatTeams, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := slack.Notify(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if err := teams.Notify(testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if text := r.bodies["/slack"][0]["text"]; text != testAlert.GetText() {
+		t.Errorf("Unexpected slack text %v", text)
+	}
+	if card := r.bodies["/teams"][0]; card["@type"] != "MessageCard" || card["themeColor"] != "#b22222" {
+		t.Errorf("Unexpected teams card %v", card)
+	}
+	if _, err := NewChatNotifier(r.server.URL, "irc", ""); err == nil {
+		t.Error("Expected an unknown chat format to be refused")
+	}
+}
+
+func TestDestinations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	load := func(content string) ([]Destination, error) {
+		filename := filepath.Join(dir, "destinations.json")
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadDestinations(filename)
+	}
+	r := newRecorder(t)
+	defer r.server.Close()
+	dests, err := load(`[{"name": "slack-dba", "type": "chat", "url": "` + r.server.URL + `/dba"},
+		{"name": "slack-ops", "type": "chat", "url": "` + r.server.URL + `/ops"},
+		{"name": "hook", "type": "webhook", "url": "` + r.server.URL + `/hook", "headers": {"X-Token": "secret"}},
+		{"name": "mail-oncall", "type": "mail", "to": "oncall@example.com"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &config.Config{}
+	notifiers := make(map[string]Notifier)
+	for _, d := range dests {
+		n, err := NewNotifier(d, "", conf)
+		if err != nil {
+			t.Fatalf("Could not build destination %s: %s", d.Name, err)
+		}
+		if n.GetName() != d.Name || n.GetType() != d.Type {
+			t.Errorf("Expected notifier %s of type %s, got %s %s", d.Name, d.Type, n.GetName(), n.GetType())
+		}
+		notifiers[n.GetName()] = n
+	}
+	if notifiers["hook"].(*WebhookNotifier).Headers["X-Token"] != "secret" {
+		t.Error("Expected the destination headers on the webhook")
+	}
+
+	// two destinations of the same type stay distinct through the router
+	router := NewRouter([]Route{{Name: "dba", Match: Matcher{ErrKey: "ERR*"}, Destinations: []string{"slack-dba"}, Continue: true}, {Name: "ops", Destinations: []string{"slack-ops"}}}, 0, 0)
+	for _, d := range router.Dispatch(testAlert, time.Now()) {
+		if err := notifiers[d].Notify(testAlert); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.bodies["/dba"]) != 1 || len(r.bodies["/ops"]) != 1 {
+		t.Errorf("Expected one message on each chat destination, got %v", r.bodies)
+	}
+
+	for _, content := range []string{
+		`[{"type": "chat", "url": "http://localhost"}]`,
+		`[{"name": "mail", "type": "mail", "to": "dba@example.com"}]`,
+		`[{"name": "a", "type": "chat", "url": "http://localhost"}, {"name": "a", "type": "webhook", "url": "http://localhost"}]`,
+	} {
+		if _, err := load(content); err == nil {
+			t.Errorf("Expected destinations %s to be refused", content)
+		}
+	}
+	if _, err := NewNotifier(Destination{Name: "x", Type: "pager"}, "", conf); err == nil {
+		t.Error("Expected an unknown destination type to be refused")
+	}
+	if _, err := NewNotifier(Destination{Name: "x", Type: ConstNotifierMail}, "", conf); err == nil {
+		t.Error("Expected a mail destination without recipients to be refused")
+	}
+}
@@ -0,0 +1,296 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// router.go
+
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConstDestinationMail   string = "mail"
+	ConstDestinationScript string = "script"
+)
+
+// Matcher select alerts on state fields, each field is a comma separated list
+// of shell patterns, an empty field match everything
+type Matcher struct {
+	ErrKey    string `json:"errKey"`
+	ErrType   string `json:"errType"`
+	ErrFrom   string `json:"errFrom"`
+	ServerUrl string `json:"serverUrl"`
+}
+
+func matchPatterns(patterns string, value string) bool {
+	if patterns == "" {
+		return true
+	}
+	for _, p := range strings.Split(patterns, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if ok, err := path.Match(p, value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Matcher) Match(a Alert) bool {
+	return matchPatterns(m.ErrKey, a.ErrKey) &&
+		matchPatterns(m.ErrType, a.ErrType) &&
+		matchPatterns(m.ErrFrom, a.ErrFrom) &&
+		matchPatterns(m.ServerUrl, a.ServerUrl)
+}
+
+func (m Matcher) IsEmpty() bool {
+	return m.ErrKey == "" && m.ErrType == "" && m.ErrFrom == "" && m.ServerUrl == ""
+}
+
+// Route send the alerts matching to the named destinations, routes are
+// evaluated in order and the first match wins unless Continue is set
+type Route struct {
+	Name         string   `json:"name"`
+	Match        Matcher  `json:"match"`
+	Destinations []string `json:"destinations"`
+	Continue     bool     `json:"continue"`
+}
+
+type Silence struct {
+	Id        string    `json:"id"`
+	Match     Matcher   `json:"match"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"createdBy"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+}
+
+func (s Silence) IsActive(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Router hold routes, silences and the deduplication and rate limiting memory
+type Router struct {
+	Routes      []Route
+	DedupWindow time.Duration
+	RateLimit   int
+	RatePeriod  time.Duration
+	silences    map[string]Silence
+	lastSent    map[string]time.Time
+	firing      map[string]bool
+	sent        map[string][]time.Time
+	silenceSeq  int64
+	sync.Mutex
+}
+
+func NewRouter(routes []Route, dedupWindow time.Duration, rateLimit int) *Router {
+	return &Router{
+		Routes:      routes,
+		DedupWindow: dedupWindow,
+		RateLimit:   rateLimit,
+		RatePeriod:  time.Minute,
+		silences:    make(map[string]Silence),
+		lastSent:    make(map[string]time.Time),
+		firing:      make(map[string]bool),
+		sent:        make(map[string][]time.Time),
+	}
+}
+
+// LoadRoutes read a JSON array of routes
+func LoadRoutes(filename string) ([]Route, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	err = json.Unmarshal(content, &routes)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range routes {
+		if len(r.Destinations) == 0 {
+			return nil, fmt.Errorf("Route %d %s has no destination", i, r.Name)
+		}
+	}
+	return routes, nil
+}
+
+// Resolve return the destinations the routes send the alert to, without
+// applying silences, deduplication or rate limit
+func (r *Router) Resolve(a Alert) []string {
+	var dests []string
+	seen := make(map[string]bool)
+	for _, route := range r.Routes {
+		if !route.Match.Match(a) {
+			continue
+		}
+		for _, d := range route.Destinations {
+			if !seen[d] {
+				seen[d] = true
+				dests = append(dests, d)
+			}
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	return dests
+}
+
+// Dispatch return the destinations an alert must be sent to now. A firing alert
+// is dropped when silenced, already sent to the destination within the
+// deduplication window, or when the destination exceeded its rate limit. A
+// resolved alert is only sent to destinations that received the firing one
+// and end the deduplication, the alert firing again is a new notification.
+func (r *Router) Dispatch(a Alert, now time.Time) []string {
+	r.Lock()
+	defer r.Unlock()
+	var dests []string
+	if !a.Resolved && r.isSilenced(a, now) {
+		return dests
+	}
+	for _, d := range r.Resolve(a) {
+		key := d + "/" + a.GetDedupKey()
+		if a.Resolved {
+			if r.firing[key] {
+				delete(r.firing, key)
+				delete(r.lastSent, key)
+				dests = append(dests, d)
+			}
+			continue
+		}
+		if last, ok := r.lastSent[key]; ok && now.Sub(last) < r.DedupWindow {
+			continue
+		}
+		if !r.allow(d, now) {
+			continue
+		}
+		r.lastSent[key] = now
+		r.firing[key] = true
+		dests = append(dests, d)
+	}
+	return dests
+}
+
+func (r *Router) allow(dest string, now time.Time) bool {
+	if r.RateLimit <= 0 {
+		return true
+	}
+	var recent []time.Time
+	for _, t := range r.sent[dest] {
+		if now.Sub(t) < r.RatePeriod {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= r.RateLimit {
+		r.sent[dest] = recent
+		return false
+	}
+	r.sent[dest] = append(recent, now)
+	return true
+}
+
+func (r *Router) isSilenced(a Alert, now time.Time) bool {
+	for _, s := range r.silences {
+		if s.IsActive(now) && s.Match.Match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) IsSilenced(a Alert, now time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.isSilenced(a, now)
+}
+
+// HasGlobalSilence report a silence without matcher currently active
+func (r *Router) HasGlobalSilence(now time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+	for _, s := range r.silences {
+		if s.IsActive(now) && s.Match.IsEmpty() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) AddSilence(s Silence) (Silence, error) {
+	if s.EndsAt.IsZero() {
+		return s, errors.New("Silence requires an expiry")
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return s, errors.New("Silence expiry before start")
+	}
+	r.Lock()
+	defer r.Unlock()
+	if s.Id == "" {
+		r.silenceSeq++
+		s.Id = fmt.Sprintf("%d-%d", s.StartsAt.Unix(), r.silenceSeq)
+	}
+	r.silences[s.Id] = s
+	return s, nil
+}
+
+func (r *Router) DeleteSilence(id string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.silences[id]; !ok {
+		return errors.New("Silence not found")
+	}
+	delete(r.silences, id)
+	return nil
+}
+
+func (r *Router) GetSilences() []Silence {
+	r.Lock()
+	defer r.Unlock()
+	silences := make([]Silence, 0, len(r.silences))
+	for _, s := range r.silences {
+		silences = append(silences, s)
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].StartsAt.Before(silences[j].StartsAt) })
+	return silences
+}
+
+// PurgeSilences drop expired silences and forget deduplication entries older
+// than the window, it returns true when silences were removed
+func (r *Router) PurgeSilences(now time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+	purged := false
+	for id, s := range r.silences {
+		if !now.Before(s.EndsAt) {
+			delete(r.silences, id)
+			purged = true
+		}
+	}
+	for key, t := range r.lastSent {
+		if now.Sub(t) >= r.DedupWindow {
+			delete(r.lastSent, key)
+		}
+	}
+	return purged
+}
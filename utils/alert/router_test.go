@@ -0,0 +1,88 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package alert
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRouterDispatch(t *testing.T) {
+	r := NewRouter([]Route{{Name: "errors", Match: Matcher{ErrKey: "ERR*"}, Destinations: []string{"mail", "chat"}}}, 300*time.Second, 1)
+	now := time.Now()
+	a := Alert{Cluster: "c1", ErrKey: "ERR00001"}
+	if d := r.Dispatch(a, now); len(d) != 2 {
+		t.Fatalf("Expected 2 destinations, got %v", d)
+	}
+	if d := r.Dispatch(a, now.Add(time.Second)); len(d) != 0 {
+		t.Fatalf("Expected duplicate to be dropped, got %v", d)
+	}
+	b := Alert{Cluster: "c1", ErrKey: "ERR00002"}
+	if d := r.Dispatch(b, now.Add(2*time.Second)); len(d) != 0 {
+		t.Fatalf("Expected rate limit to drop alert, got %v", d)
+	}
+	if d := r.Dispatch(Alert{Cluster: "c1", ErrKey: "WARN0001"}, now); len(d) != 0 {
+		t.Fatalf("Expected no route to match, got %v", d)
+	}
+	a.Resolved = true
+	if d := r.Dispatch(a, now.Add(3*time.Second)); len(d) != 2 {
+		t.Fatalf("Expected resolve to reach firing destinations, got %v", d)
+	}
+}
+
+// TestRouterDispatchRefire fire, resolve and fire again within the
+// deduplication window, each notification reach the destination
+func TestRouterDispatchRefire(t *testing.T) {
+	r := NewRouter([]Route{{Name: "errors", Match: Matcher{ErrKey: "ERR*"}, Destinations: []string{"mail"}}}, 300*time.Second, 0)
+	now := time.Now()
+	a := Alert{Cluster: "c1", ErrKey: "ERR00001"}
+	resolved := a
+	resolved.Resolved = true
+	steps := []struct {
+		alert Alert
+		sent  int
+	}{
+		{a, 1},
+		{resolved, 1},
+		{a, 1},
+		{a, 0},
+		{resolved, 1},
+		{resolved, 0},
+	}
+	for i, step := range steps {
+		if d := r.Dispatch(step.alert, now.Add(time.Duration(i)*time.Second)); len(d) != step.sent {
+			t.Errorf("Step %d resolved %t: expected %d destinations, got %v", i, step.alert.Resolved, step.sent, d)
+		}
+	}
+}
+
+func TestRouterSilence(t *testing.T) {
+	r := NewRouter([]Route{{Name: "all", Destinations: []string{"mail"}}}, 0, 0)
+	now := time.Now()
+	if _, err := r.AddSilence(Silence{Match: Matcher{ErrKey: "ERR00001"}}); err == nil {
+		t.Fatal("Expected silence without expiry to be refused")
+	}
+	s, err := r.AddSilence(Silence{Match: Matcher{ErrKey: "ERR00001"}, StartsAt: now, EndsAt: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := r.Dispatch(Alert{Cluster: "c1", ErrKey: "ERR00001"}, now.Add(time.Second)); len(d) != 0 {
+		t.Fatalf("Expected silenced alert to be dropped, got %v", d)
+	}
+	if r.HasGlobalSilence(now) {
+		t.Fatal("Expected no global silence")
+	}
+	if !r.PurgeSilences(now.Add(2 * time.Minute)) {
+		t.Fatal("Expected expired silence to be purged")
+	}
+	if err := r.DeleteSilence(s.Id); err == nil {
+		t.Fatal("Expected purged silence to be gone")
+	}
+}
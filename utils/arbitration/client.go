@@ -0,0 +1,154 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// client.go
+
+package arbitration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Request is the payload of monitor heartbeats and elections
+type Request struct {
+	UUID    string `json:"uuid"`
+	Cluster string `json:"cluster"`
+	Master  string `json:"master"`
+	UID     int    `json:"id"`
+	Status  string `json:"status"`
+	Hosts   int    `json:"hosts"`
+	Failed  int    `json:"failed"`
+}
+
+type Response struct {
+	Arbitration string `json:"arbitration"`
+	Master      string `json:"master"`
+	Votes       int    `json:"votes"`
+	Quorum      int    `json:"quorum"`
+}
+
+// Vote is the answer of an arbitrator asked by a peer for an election
+type Vote struct {
+	Granted bool `json:"granted"`
+}
+
+// Decision close an election on the peers, those that granted release their
+// vote when the election was lost
+type Decision struct {
+	Request Request `json:"request"`
+	Winner  bool    `json:"winner"`
+	Votes   int     `json:"votes"`
+	Quorum  int     `json:"quorum"`
+}
+
+// Lease is the monitor elected for a cluster of a group
+type Lease struct {
+	Group         string    `json:"group"`
+	Cluster       string    `json:"cluster"`
+	UID           int       `json:"id"`
+	UUID          string    `json:"uuid"`
+	Master        string    `json:"master"`
+	ElectedAt     time.Time `json:"electedAt"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+}
+
+// DecisionRecord is the persistent history of elections
+type DecisionRecord struct {
+	Group   string    `json:"group"`
+	Cluster string    `json:"cluster"`
+	UID     int       `json:"id"`
+	UUID    string    `json:"uuid"`
+	Master  string    `json:"master"`
+	Winner  bool      `json:"winner"`
+	Votes   int       `json:"votes"`
+	Quorum  int       `json:"quorum"`
+	Date    time.Time `json:"date"`
+}
+
+// Client send signed requests to a list of arbitrators
+type Client struct {
+	Hosts  []string
+	Id     int
+	Secret string
+	Peer   bool
+	client *http.Client
+}
+
+func NewClient(hosts string, id int, secret string, timeout time.Duration) *Client {
+	c := &Client{Id: id, Secret: secret, client: &http.Client{Timeout: timeout}}
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" {
+			c.Hosts = append(c.Hosts, h)
+		}
+	}
+	return c
+}
+
+// PostHost send body to one arbitrator
+func (c *Client) PostHost(host string, path string, body []byte) ([]byte, error) {
+	return c.do(host, "POST", path, body)
+}
+
+func (c *Client) do(host string, method string, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, "http://"+host+path, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Peer {
+		req.Header.Set(ConstHeaderPeer, "true")
+	}
+	Sign(req, c.Id, c.Secret, body, time.Now())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return content, fmt.Errorf("Arbitrator %s answered %s", host, resp.Status)
+	}
+	return content, nil
+}
+
+// Post send body to the first arbitrator answering, any node of the quorum
+// can coordinate a request
+func (c *Client) Post(path string, body []byte) ([]byte, error) {
+	return c.first("POST", path, body)
+}
+
+// Get read path, it may carry a query string that is not signed
+func (c *Client) Get(path string) ([]byte, error) {
+	return c.first("GET", path, nil)
+}
+
+func (c *Client) first(method string, path string, body []byte) ([]byte, error) {
+	var errs []string
+	for _, host := range c.Hosts {
+		content, err := c.do(host, method, path, body)
+		if err == nil {
+			return content, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("No arbitrator host")
+	}
+	return nil, errors.New(strings.Join(errs, ", "))
+}
@@ -0,0 +1,142 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package arbitration hold the protocol shared by monitors and arbitrators:
+// signed requests, the arbitration payloads and the quorum arithmetic. The
+// secret never leaves the hosts, requests carry an HMAC of the path, the body,
+// a timestamp and a nonce the receiver remembers to refuse replays.
+package arbitration
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConstHeaderId        string = "X-Arbitration-Id"
+	ConstHeaderTimestamp string = "X-Arbitration-Timestamp"
+	ConstHeaderSignature string = "X-Arbitration-Signature"
+	ConstHeaderNonce     string = "X-Arbitration-Nonce"
+	// ConstHeaderPeer mark a request forwarded by another arbitrator
+	ConstHeaderPeer string = "X-Arbitration-Peer"
+)
+
+var (
+	ErrMissingSignature = errors.New("Missing arbitration signature")
+	ErrInvalidSignature = errors.New("Invalid arbitration signature")
+	ErrExpiredSignature = errors.New("Arbitration signature timestamp out of window")
+	ErrReplayedRequest  = errors.New("Arbitration request replayed")
+)
+
+// signature cover the peer header so that a monitor request can not be
+// presented as forwarded by an arbitrator
+func signature(secret string, timestamp string, nonce string, peer string, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + peer + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sign set the authentication headers of a request carrying body, the peer
+// header has to be set before
+func Sign(req *http.Request, id int, secret string, body []byte, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	nonce := newNonce()
+	req.Header.Set(ConstHeaderId, strconv.Itoa(id))
+	req.Header.Set(ConstHeaderTimestamp, ts)
+	req.Header.Set(ConstHeaderNonce, nonce)
+	req.Header.Set(ConstHeaderSignature, signature(secret, ts, nonce, req.Header.Get(ConstHeaderPeer), req.URL.Path, body))
+}
+
+// NonceCache remember the nonces of the accepted requests as long as their
+// timestamp is in the window, a request seen twice is a replay
+type NonceCache struct {
+	sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func NewNonceCache(window time.Duration) *NonceCache {
+	return &NonceCache{window: window, seen: make(map[string]time.Time)}
+}
+
+// Add record the nonce and return false when it was already recorded
+func (c *NonceCache) Add(nonce string, now time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+	for n, expire := range c.seen {
+		if now.After(expire) {
+			delete(c.seen, n)
+		}
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	// a timestamp is accepted up to window on both sides of now
+	c.seen[nonce] = now.Add(2 * c.window)
+	return true
+}
+
+// Verify check the request against a comma separated list of secrets and
+// return the secret that signed it, timestamps older or newer than window are
+// refused and the nonce of an authenticated request is recorded in nonces
+func Verify(r *http.Request, secrets string, body []byte, now time.Time, window time.Duration, nonces *NonceCache) (string, error) {
+	ts := r.Header.Get(ConstHeaderTimestamp)
+	sig := r.Header.Get(ConstHeaderSignature)
+	nonce := r.Header.Get(ConstHeaderNonce)
+	if ts == "" || sig == "" || nonce == "" {
+		return "", ErrMissingSignature
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	skew := now.Sub(time.Unix(sec, 0))
+	if skew > window || skew < -window {
+		return "", ErrExpiredSignature
+	}
+	for _, secret := range strings.Split(secrets, ",") {
+		if secret == "" {
+			continue
+		}
+		if hmac.Equal([]byte(sig), []byte(signature(secret, ts, nonce, r.Header.Get(ConstHeaderPeer), r.URL.Path, body))) {
+			if nonces != nil && !nonces.Add(nonce, now) {
+				return "", ErrReplayedRequest
+			}
+			return secret, nil
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+// GroupKey derive the key arbitrators store in place of the secret, monitors
+// sharing a secret form one arbitration group
+func GroupKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Quorum is the majority of a group of nodes
+func Quorum(nodes int) int {
+	return nodes/2 + 1
+}
@@ -0,0 +1,131 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package arbitration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"cluster":"cluster1","id":1}`)
+	now := time.Now()
+	req, _ := http.NewRequest("POST", "http://arbitrator:10001/arbitrator", nil)
+	Sign(req, 1, "s2", body, now)
+
+	secret, err := Verify(req, "s1,s2", body, now, 30*time.Second, nil)
+	if err != nil || secret != "s2" {
+		t.Fatalf("Expected secret s2, got %q %v", secret, err)
+	}
+	if _, err := Verify(req, "s1", body, now, 30*time.Second, nil); err != ErrInvalidSignature {
+		t.Fatalf("Expected invalid signature, got %v", err)
+	}
+	if _, err := Verify(req, "s2", []byte(`{"cluster":"cluster2","id":1}`), now, 30*time.Second, nil); err != ErrInvalidSignature {
+		t.Fatalf("Expected tampered body refused, got %v", err)
+	}
+	if _, err := Verify(req, "s2", body, now.Add(time.Minute), 30*time.Second, nil); err != ErrExpiredSignature {
+		t.Fatalf("Expected replay refused, got %v", err)
+	}
+	other, _ := http.NewRequest("POST", "http://arbitrator:10001/heartbeat", nil)
+	other.Header = req.Header
+	if _, err := Verify(other, "s2", body, now, 30*time.Second, nil); err != ErrInvalidSignature {
+		t.Fatalf("Expected signature bound to the path, got %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	body := []byte(`{"cluster":"cluster1","id":1}`)
+	now := time.Now()
+	nonces := NewNonceCache(30 * time.Second)
+	req, _ := http.NewRequest("POST", "http://arbitrator:10001/arbitrator", nil)
+	Sign(req, 1, "s1", body, now)
+	if _, err := Verify(req, "s1", body, now, 30*time.Second, nonces); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(req, "s1", body, now.Add(time.Second), 30*time.Second, nonces); err != ErrReplayedRequest {
+		t.Fatalf("Expected replay in the window refused, got %v", err)
+	}
+	again, _ := http.NewRequest("POST", "http://arbitrator:10001/arbitrator", nil)
+	Sign(again, 1, "s1", body, now)
+	if again.Header.Get(ConstHeaderNonce) == req.Header.Get(ConstHeaderNonce) {
+		t.Fatal("Expected a nonce per request")
+	}
+	if _, err := Verify(again, "s1", body, now, 30*time.Second, nonces); err != nil {
+		t.Fatalf("Expected same payload with a new nonce accepted, got %v", err)
+	}
+	forged, _ := http.NewRequest("POST", "http://arbitrator:10001/arbitrator", nil)
+	Sign(forged, 1, "wrong", body, now)
+	if _, err := Verify(forged, "s1", body, now, 30*time.Second, nonces); err != ErrInvalidSignature {
+		t.Fatalf("Expected invalid signature, got %v", err)
+	}
+	if len(nonces.seen) != 2 {
+		t.Fatalf("Expected only authenticated nonces recorded, got %d", len(nonces.seen))
+	}
+	nonces.Add("other", now.Add(2*time.Minute))
+	if len(nonces.seen) != 1 {
+		t.Fatalf("Expected nonces out of the window purged, got %d", len(nonces.seen))
+	}
+	req.Header.Del(ConstHeaderNonce)
+	if _, err := Verify(req, "s1", body, now, 30*time.Second, nil); err != ErrMissingSignature {
+		t.Fatalf("Expected missing nonce refused, got %v", err)
+	}
+}
+
+func TestPeerHeaderSigned(t *testing.T) {
+	body := []byte(`{"request":{"cluster":"cluster1","id":1},"winner":true}`)
+	now := time.Now()
+	req, _ := http.NewRequest("POST", "http://arbitrator:10001/decide", nil)
+	Sign(req, 1, "s1", body, now)
+	req.Header.Set(ConstHeaderPeer, "true")
+	if _, err := Verify(req, "s1", body, now, 30*time.Second, nil); err != ErrInvalidSignature {
+		t.Fatalf("Expected peer header added after signing refused, got %v", err)
+	}
+	peer, _ := http.NewRequest("POST", "http://arbitrator:10001/decide", nil)
+	peer.Header.Set(ConstHeaderPeer, "true")
+	Sign(peer, 1, "s1", body, now)
+	if _, err := Verify(peer, "s1", body, now, 30*time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientFailover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		if _, err := Verify(r, "secret", body, time.Now(), 30*time.Second, nil); err != nil {
+			http.Error(w, err.Error(), 401)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"arbitration":"winner"}`))
+	}))
+	defer ts.Close()
+	host := ts.Listener.Addr().String()
+
+	c := NewClient("127.0.0.1:1,"+host, 1, "secret", time.Second)
+	content, err := c.Post("/arbitrator", []byte(`{}`))
+	if err != nil || string(content) != `{"arbitration":"winner"}` {
+		t.Fatalf("Expected answer from second host, got %s %v", content, err)
+	}
+	c = NewClient(host, 1, "wrong", time.Second)
+	if _, err := c.Post("/arbitrator", []byte(`{}`)); err == nil {
+		t.Fatal("Expected wrong secret refused")
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	for nodes, q := range map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 3} {
+		if Quorum(nodes) != q {
+			t.Fatalf("Quorum of %d expected %d, got %d", nodes, q, Quorum(nodes))
+		}
+	}
+}
@@ -0,0 +1,558 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package consensus elects a leader among replication-manager monitors with
+// the Raft election rules. Instead of a log, the leader owns a small key value
+// state that it sends as a versioned snapshot with its heartbeats, followers
+// replace their copy when the version differ. The state is what a monitor needs
+// to take over: failover counters, SLA and crashes of each cluster.
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ConstStateFollower  string = "follower"
+	ConstStateCandidate string = "candidate"
+	ConstStateLeader    string = "leader"
+)
+
+const stateFile = "raft.json"
+
+var ErrNotLeader = errors.New("Not the raft leader")
+
+type VoteRequest struct {
+	Term        uint64 `json:"term"`
+	CandidateId string `json:"candidateId"`
+	Index       uint64 `json:"index"`
+	IndexTerm   uint64 `json:"indexTerm"`
+}
+
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest is the leader heartbeat, Data is only sent to peers that did
+// not acknowledge the current version
+type AppendRequest struct {
+	Term      uint64                     `json:"term"`
+	LeaderId  string                     `json:"leaderId"`
+	Index     uint64                     `json:"index"`
+	IndexTerm uint64                     `json:"indexTerm"`
+	Data      map[string]json.RawMessage `json:"data,omitempty"`
+}
+
+type AppendResponse struct {
+	Term      uint64 `json:"term"`
+	Success   bool   `json:"success"`
+	Index     uint64 `json:"index"`
+	IndexTerm uint64 `json:"indexTerm"`
+}
+
+// Transport deliver the requests to a peer
+type Transport interface {
+	RequestVote(peer string, req VoteRequest) (VoteResponse, error)
+	AppendEntries(peer string, req AppendRequest) (AppendResponse, error)
+}
+
+// Status is the node view exposed by the API
+type Status struct {
+	Id        string           `json:"id"`
+	State     string           `json:"state"`
+	Term      uint64           `json:"term"`
+	Leader    string           `json:"leader"`
+	Index     uint64           `json:"index"`
+	IndexTerm uint64           `json:"indexTerm"`
+	Quorum    int              `json:"quorum"`
+	HasQuorum bool             `json:"hasQuorum"`
+	Peers     map[string]int64 `json:"peers"`
+}
+
+type persistentState struct {
+	Term      uint64                     `json:"term"`
+	VotedFor  string                     `json:"votedFor"`
+	Index     uint64                     `json:"index"`
+	IndexTerm uint64                     `json:"indexTerm"`
+	Data      map[string]json.RawMessage `json:"data"`
+}
+
+type peerVersion struct {
+	index     uint64
+	indexTerm uint64
+}
+
+type Node struct {
+	Id                string
+	Peers             []string
+	Dir               string
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	Transport         Transport
+	// OnLeaderChange is called from the node loop when the node win or lose
+	// the leadership
+	OnLeaderChange func(leader bool)
+	// OnApply is called for each key changed by a snapshot of the leader
+	OnApply   func(key string, value json.RawMessage)
+	state     string
+	term      uint64
+	votedFor  string
+	leader    string
+	index     uint64
+	indexTerm uint64
+	data      map[string]json.RawMessage
+	deadline  time.Time
+	heard     time.Time
+	lastAck   map[string]time.Time
+	acked     map[string]peerVersion
+	notified  bool
+	stop      chan bool
+	sync.Mutex
+}
+
+// NewNode restore the node term, vote and state from dir, peers must not
+// contain the node id
+func NewNode(id string, peers []string, dir string, electionTimeout time.Duration, transport Transport) (*Node, error) {
+	n := &Node{
+		Id:                id,
+		Peers:             peers,
+		Dir:               dir,
+		ElectionTimeout:   electionTimeout,
+		HeartbeatInterval: electionTimeout / 5,
+		Transport:         transport,
+		state:             ConstStateFollower,
+		data:              make(map[string]json.RawMessage),
+		lastAck:           make(map[string]time.Time),
+		acked:             make(map[string]peerVersion),
+	}
+	if dir != "" {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+		err = n.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+	n.resetDeadline(time.Now())
+	return n, nil
+}
+
+func (n *Node) load() error {
+	content, err := ioutil.ReadFile(filepath.Join(n.Dir, stateFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ps persistentState
+	err = json.Unmarshal(content, &ps)
+	if err != nil {
+		return err
+	}
+	n.term = ps.Term
+	n.votedFor = ps.VotedFor
+	n.index = ps.Index
+	n.indexTerm = ps.IndexTerm
+	if ps.Data != nil {
+		n.data = ps.Data
+	}
+	return nil
+}
+
+// persist must be called with the lock held before answering a peer, a vote
+// must survive a restart
+func (n *Node) persist() error {
+	if n.Dir == "" {
+		return nil
+	}
+	content, err := json.Marshal(persistentState{Term: n.term, VotedFor: n.votedFor, Index: n.index, IndexTerm: n.indexTerm, Data: n.data})
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(n.Dir, stateFile+".tmp")
+	err = ioutil.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(n.Dir, stateFile))
+}
+
+func (n *Node) quorum() int {
+	return (len(n.Peers)+1)/2 + 1
+}
+
+// resetDeadline pick a random election timeout between 1 and 2 times
+// ElectionTimeout so that candidates rarely split the votes
+func (n *Node) resetDeadline(now time.Time) {
+	n.deadline = now.Add(n.ElectionTimeout + time.Duration(rand.Int63n(int64(n.ElectionTimeout)+1)))
+}
+
+func (n *Node) stepDown(term uint64) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+	}
+	if n.state == ConstStateLeader {
+		n.leader = ""
+	}
+	n.state = ConstStateFollower
+}
+
+func (n *Node) Start() {
+	n.Lock()
+	if n.stop != nil {
+		n.Unlock()
+		return
+	}
+	n.stop = make(chan bool)
+	stop := n.stop
+	n.Unlock()
+	go func() {
+		ticker := time.NewTicker(n.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				n.Tick(time.Now())
+			}
+		}
+	}()
+}
+
+func (n *Node) Stop() {
+	n.Lock()
+	if n.stop != nil {
+		close(n.stop)
+		n.stop = nil
+	}
+	if n.state == ConstStateLeader {
+		n.state = ConstStateFollower
+		n.leader = ""
+	}
+	n.Unlock()
+	n.notify()
+}
+
+// Tick run one step of the node: a leader send its heartbeats, a follower
+// without leader contact past its deadline start an election
+func (n *Node) Tick(now time.Time) {
+	n.Lock()
+	state := n.state
+	expired := now.After(n.deadline)
+	n.Unlock()
+	if state == ConstStateLeader {
+		n.heartbeat(now)
+	} else if expired {
+		n.campaign(now)
+	}
+	n.notify()
+}
+
+// notify call OnLeaderChange outside of the lock when the leadership changed
+// since the last call
+func (n *Node) notify() {
+	n.Lock()
+	leader := n.state == ConstStateLeader
+	changed := leader != n.notified
+	n.notified = leader
+	n.Unlock()
+	if changed && n.OnLeaderChange != nil {
+		n.OnLeaderChange(leader)
+	}
+}
+
+func (n *Node) campaign(now time.Time) {
+	n.Lock()
+	n.state = ConstStateCandidate
+	n.term++
+	n.votedFor = n.Id
+	n.leader = ""
+	n.resetDeadline(now)
+	n.persist()
+	req := VoteRequest{Term: n.term, CandidateId: n.Id, Index: n.index, IndexTerm: n.indexTerm}
+	votes := 1
+	voters := make(map[string]time.Time)
+	if votes >= n.quorum() {
+		n.becomeLeader(voters)
+		n.Unlock()
+		return
+	}
+	n.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range n.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			resp, err := n.Transport.RequestVote(peer, req)
+			if err != nil {
+				return
+			}
+			n.Lock()
+			defer n.Unlock()
+			if resp.Term > n.term {
+				n.stepDown(resp.Term)
+				n.persist()
+				return
+			}
+			if !resp.Granted || n.state != ConstStateCandidate || n.term != req.Term {
+				return
+			}
+			votes++
+			// the lease start when the request was sent, not answered
+			voters[peer] = now
+			if votes >= n.quorum() {
+				n.becomeLeader(voters)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// becomeLeader start the lease from the votes, only the peers that granted
+// count as a contact
+func (n *Node) becomeLeader(voters map[string]time.Time) {
+	n.state = ConstStateLeader
+	n.leader = n.Id
+	n.lastAck = make(map[string]time.Time)
+	n.acked = make(map[string]peerVersion)
+	for peer, t := range voters {
+		n.lastAck[peer] = t
+	}
+}
+
+func (n *Node) heartbeat(now time.Time) {
+	n.Lock()
+	// a leader cut from the majority step down before doing anything, the
+	// majority side can elect a new leader once the followers deadline is
+	// passed and two monitors must never be active together
+	if !n.hasLease(now) {
+		n.stepDown(n.term)
+		n.resetDeadline(now)
+		n.Unlock()
+		return
+	}
+	term := n.term
+	reqs := make(map[string]AppendRequest)
+	for _, peer := range n.Peers {
+		req := AppendRequest{Term: n.term, LeaderId: n.Id, Index: n.index, IndexTerm: n.indexTerm}
+		if n.acked[peer] != (peerVersion{index: n.index, indexTerm: n.indexTerm}) {
+			req.Data = n.data
+		}
+		reqs[peer] = req
+	}
+	n.Unlock()
+
+	var wg sync.WaitGroup
+	for peer, req := range reqs {
+		wg.Add(1)
+		go func(peer string, req AppendRequest) {
+			defer wg.Done()
+			resp, err := n.Transport.AppendEntries(peer, req)
+			if err != nil {
+				return
+			}
+			n.Lock()
+			defer n.Unlock()
+			if resp.Term > n.term {
+				n.stepDown(resp.Term)
+				n.persist()
+				return
+			}
+			if n.state != ConstStateLeader || n.term != term || !resp.Success {
+				return
+			}
+			n.lastAck[peer] = now
+			n.acked[peer] = peerVersion{index: resp.Index, indexTerm: resp.IndexTerm}
+		}(peer, req)
+	}
+	wg.Wait()
+}
+
+// getQuorumAck return the time of the last contact with a majority, the
+// node counts as one
+func (n *Node) getQuorumAck(now time.Time) time.Time {
+	acks := []time.Time{now}
+	for _, peer := range n.Peers {
+		if t, ok := n.lastAck[peer]; ok {
+			acks = append(acks, t)
+		}
+	}
+	if len(acks) < n.quorum() {
+		return time.Time{}
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].After(acks[j]) })
+	return acks[n.quorum()-1]
+}
+
+// hasLease report a leader that heard from a majority within the election
+// timeout, measured from the send time of the acknowledged requests. A
+// follower does not start an election before that time since its last
+// heartbeat, so a new leader can not be elected while the lease is valid.
+func (n *Node) hasLease(now time.Time) bool {
+	if n.state != ConstStateLeader {
+		return false
+	}
+	return now.Sub(n.getQuorumAck(now)) < n.ElectionTimeout
+}
+
+// HandleVote answer a candidate, the vote is granted once per term and only
+// to a candidate with a state at least as recent as ours. A node that heard
+// from the leader within the election timeout or that holds the lease refuse
+// without moving to the candidate term: a candidate cut from the leader only
+// would win with the votes of peers still acknowledging the leader, while the
+// old leader keep its lease until its next heartbeat round.
+func (n *Node) HandleVote(req VoteRequest) VoteResponse {
+	now := time.Now()
+	n.Lock()
+	defer n.notify()
+	defer n.Unlock()
+	if req.Term < n.term || n.hasLease(now) || now.Sub(n.heard) < n.ElectionTimeout {
+		return VoteResponse{Term: n.term, Granted: false}
+	}
+	if req.Term > n.term {
+		n.stepDown(req.Term)
+	}
+	upToDate := req.IndexTerm > n.indexTerm || (req.IndexTerm == n.indexTerm && req.Index >= n.index)
+	granted := (n.votedFor == "" || n.votedFor == req.CandidateId) && upToDate
+	if granted {
+		n.votedFor = req.CandidateId
+		n.resetDeadline(now)
+	}
+	n.persist()
+	return VoteResponse{Term: n.term, Granted: granted}
+}
+
+// HandleAppend accept the leader heartbeat and replace the state when the
+// snapshot version differ from ours
+func (n *Node) HandleAppend(req AppendRequest) AppendResponse {
+	n.Lock()
+	if req.Term < n.term {
+		resp := AppendResponse{Term: n.term, Success: false, Index: n.index, IndexTerm: n.indexTerm}
+		n.Unlock()
+		return resp
+	}
+	if req.Term > n.term || n.state != ConstStateFollower {
+		n.stepDown(req.Term)
+	}
+	now := time.Now()
+	n.leader = req.LeaderId
+	n.heard = now
+	n.resetDeadline(now)
+	changed := make(map[string]json.RawMessage)
+	if req.Data != nil && (req.Index != n.index || req.IndexTerm != n.indexTerm) {
+		for k, v := range req.Data {
+			if !bytes.Equal(n.data[k], v) {
+				changed[k] = v
+			}
+		}
+		n.data = req.Data
+		n.index = req.Index
+		n.indexTerm = req.IndexTerm
+	}
+	n.persist()
+	resp := AppendResponse{Term: n.term, Success: true, Index: n.index, IndexTerm: n.indexTerm}
+	n.Unlock()
+	n.notify()
+	if n.OnApply != nil {
+		for k, v := range changed {
+			n.OnApply(k, v)
+		}
+	}
+	return resp
+}
+
+// Propose set a key of the replicated state, the followers receive it with
+// the next heartbeat
+func (n *Node) Propose(key string, value json.RawMessage) error {
+	n.Lock()
+	defer n.Unlock()
+	if !n.hasLease(time.Now()) {
+		return ErrNotLeader
+	}
+	if bytes.Equal(n.data[key], value) {
+		return nil
+	}
+	data := make(map[string]json.RawMessage, len(n.data)+1)
+	for k, v := range n.data {
+		data[k] = v
+	}
+	data[key] = value
+	n.data = data
+	n.index++
+	n.indexTerm = n.term
+	return n.persist()
+}
+
+func (n *Node) Get(key string) (json.RawMessage, bool) {
+	n.Lock()
+	defer n.Unlock()
+	v, ok := n.data[key]
+	return v, ok
+}
+
+// IsLeader report a leader with a valid lease
+func (n *Node) IsLeader() bool {
+	n.Lock()
+	defer n.Unlock()
+	return n.hasLease(time.Now())
+}
+
+// HasQuorum report a leader that heard from a majority within the election
+// timeout
+func (n *Node) HasQuorum() bool {
+	n.Lock()
+	defer n.Unlock()
+	return n.hasLease(time.Now())
+}
+
+func (n *Node) GetLeader() string {
+	n.Lock()
+	defer n.Unlock()
+	return n.leader
+}
+
+func (n *Node) GetStatus() Status {
+	n.Lock()
+	defer n.Unlock()
+	st := Status{
+		Id:        n.Id,
+		State:     n.state,
+		Term:      n.term,
+		Leader:    n.leader,
+		Index:     n.index,
+		IndexTerm: n.indexTerm,
+		Quorum:    n.quorum(),
+		HasQuorum: n.hasLease(time.Now()),
+		Peers:     make(map[string]int64),
+	}
+	for _, peer := range n.Peers {
+		if t, ok := n.lastAck[peer]; ok && n.state == ConstStateLeader {
+			st.Peers[peer] = t.Unix()
+		} else {
+			st.Peers[peer] = 0
+		}
+	}
+	return st
+}
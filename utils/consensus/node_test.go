@@ -0,0 +1,281 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// memTransport route requests to nodes of the same process, a node listed in
+// down is unreachable and a pair of nodes listed in cut can not reach each
+// other
+type memTransport struct {
+	nodes map[string]*Node
+	down  map[string]bool
+	cut   map[[2]string]bool
+}
+
+func (t *memTransport) isCut(from string, to string) bool {
+	return t.down[from] || t.down[to] || t.cut[[2]string{from, to}] || t.cut[[2]string{to, from}]
+}
+
+func (t *memTransport) RequestVote(peer string, req VoteRequest) (VoteResponse, error) {
+	if t.isCut(req.CandidateId, peer) {
+		return VoteResponse{}, errors.New("down")
+	}
+	return t.nodes[peer].HandleVote(req), nil
+}
+
+func (t *memTransport) AppendEntries(peer string, req AppendRequest) (AppendResponse, error) {
+	if t.isCut(req.LeaderId, peer) {
+		return AppendResponse{}, errors.New("down")
+	}
+	return t.nodes[peer].HandleAppend(req), nil
+}
+
+// loseLeader forget the last heartbeat of the nodes, the tests move the clock
+// of Tick while the handlers use the real one
+func loseLeader(nodes ...*Node) {
+	for _, n := range nodes {
+		n.Lock()
+		n.heard = time.Time{}
+		n.Unlock()
+	}
+}
+
+func newTestGroup(t *testing.T, ids []string) (*memTransport, []*Node) {
+	tr := &memTransport{nodes: make(map[string]*Node), down: make(map[string]bool), cut: make(map[[2]string]bool)}
+	var nodes []*Node
+	for _, id := range ids {
+		var peers []string
+		for _, p := range ids {
+			if p != id {
+				peers = append(peers, p)
+			}
+		}
+		n, err := NewNode(id, peers, "", time.Second, tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.nodes[id] = n
+		nodes = append(nodes, n)
+	}
+	return tr, nodes
+}
+
+func TestElectionAndReplication(t *testing.T) {
+	tr, nodes := newTestGroup(t, []string{"a:10001", "b:10001", "c:10001"})
+	applied := make(map[string]string)
+	nodes[1].OnApply = func(key string, value json.RawMessage) {
+		applied[key] = string(value)
+	}
+	now := time.Now()
+	nodes[0].Tick(now.Add(3 * time.Second))
+	if !nodes[0].IsLeader() {
+		t.Fatalf("Expected a:10001 leader, got %s", nodes[0].GetStatus().State)
+	}
+	if err := nodes[1].Propose("cluster1", json.RawMessage(`{"failoverCounter":1}`)); err != ErrNotLeader {
+		t.Fatalf("Expected follower proposal to fail, got %v", err)
+	}
+	if err := nodes[0].Propose("cluster1", json.RawMessage(`{"failoverCounter":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	nodes[0].Tick(now.Add(3 * time.Second))
+	if applied["cluster1"] != `{"failoverCounter":1}` {
+		t.Fatalf("State not applied on follower: %v", applied)
+	}
+	if nodes[2].GetLeader() != "a:10001" {
+		t.Fatalf("Expected follower to know the leader, got %s", nodes[2].GetLeader())
+	}
+
+	// the leader is cut from the group, it must step down and the majority
+	// elect a leader that kept the state
+	tr.down["a:10001"] = true
+	nodes[0].Lock()
+	for peer := range nodes[0].lastAck {
+		nodes[0].lastAck[peer] = now.Add(-time.Minute)
+	}
+	nodes[0].Unlock()
+	nodes[0].Tick(now.Add(4 * time.Second))
+	if nodes[0].IsLeader() {
+		t.Fatal("Expected isolated leader to step down")
+	}
+	loseLeader(nodes[1], nodes[2])
+	nodes[1].Tick(now.Add(10 * time.Second))
+	if !nodes[1].IsLeader() {
+		t.Fatalf("Expected b:10001 leader, got %s", nodes[1].GetStatus().State)
+	}
+	if v, _ := nodes[1].Get("cluster1"); string(v) != `{"failoverCounter":1}` {
+		t.Fatalf("New leader lost the state: %s", v)
+	}
+}
+
+func TestVoteRestriction(t *testing.T) {
+	_, nodes := newTestGroup(t, []string{"a:10001", "b:10001", "c:10001"})
+	nodes[0].Tick(time.Now().Add(3 * time.Second))
+	nodes[0].Propose("cluster1", json.RawMessage(`{}`))
+	nodes[0].Tick(time.Now())
+	resp := nodes[1].HandleVote(VoteRequest{Term: 10, CandidateId: "a:10001", Index: 1, IndexTerm: 1})
+	if resp.Granted || resp.Term != 1 {
+		t.Fatalf("Expected vote refused and term kept within the election timeout of the leader heartbeat, got %+v", resp)
+	}
+	loseLeader(nodes[1])
+	resp = nodes[1].HandleVote(VoteRequest{Term: 10, CandidateId: "c:10001"})
+	if resp.Granted {
+		t.Fatal("Expected vote refused to a candidate with an older state")
+	}
+	resp = nodes[1].HandleVote(VoteRequest{Term: 10, CandidateId: "a:10001", Index: 1, IndexTerm: 1})
+	if !resp.Granted {
+		t.Fatal("Expected vote granted to an up to date candidate")
+	}
+	resp = nodes[1].HandleVote(VoteRequest{Term: 10, CandidateId: "c:10001", Index: 1, IndexTerm: 1})
+	if resp.Granted {
+		t.Fatal("Expected a single vote per term")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n, err := NewNode("a:10001", nil, dir, time.Second, &memTransport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Tick(time.Now().Add(3 * time.Second))
+	if !n.IsLeader() {
+		t.Fatal("Expected single node leader")
+	}
+	n.Propose("cluster1", json.RawMessage(`{"sla":1}`))
+	n, err = NewNode("a:10001", nil, dir, time.Second, &memTransport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := n.GetStatus()
+	if st.Term != 1 || st.Index != 1 || st.State != ConstStateFollower {
+		t.Fatalf("Unexpected restored status %+v", st)
+	}
+	if v, _ := n.Get("cluster1"); string(v) != `{"sla":1}` {
+		t.Fatalf("Unexpected restored state %s", v)
+	}
+}
+
+// TestPartition cut the leader from the majority without touching its acks,
+// its lease run out at the election timeout after the last acknowledged
+// heartbeat and the majority elects a new leader only after
+func TestPartition(t *testing.T) {
+	tr, nodes := newTestGroup(t, []string{"a:10001", "b:10001", "c:10001"})
+	a, b, c := nodes[0], nodes[1], nodes[2]
+	now := time.Now().Add(time.Hour)
+	a.Tick(now)
+	if !a.IsLeader() {
+		t.Fatalf("Expected a:10001 leader, got %s", a.GetStatus().State)
+	}
+	a.Tick(now.Add(500 * time.Millisecond))
+	if err := a.Propose("cluster1", json.RawMessage(`{"failoverCounter":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tr.down["a:10001"] = true
+	a.Tick(now.Add(1400 * time.Millisecond))
+	if !a.IsLeader() {
+		t.Fatal("Expected the leader to keep its lease within the election timeout of the last ack")
+	}
+	if b.GetLeader() != "a:10001" || c.GetLeader() != "a:10001" {
+		t.Fatal("Expected the followers to keep the leader within the lease")
+	}
+	a.Tick(now.Add(1600 * time.Millisecond))
+	if a.IsLeader() || a.GetStatus().State != ConstStateFollower {
+		t.Fatalf("Expected the partitioned leader to step down when its lease expired, got %s", a.GetStatus().State)
+	}
+	if err := a.Propose("cluster1", json.RawMessage(`{"failoverCounter":2}`)); err != ErrNotLeader {
+		t.Fatalf("Expected a proposal without lease refused, got %v", err)
+	}
+
+	// the majority side elect a leader, the partitioned node can not
+	loseLeader(b, c)
+	b.Tick(now.Add(5 * time.Second))
+	b.Tick(now.Add(5200 * time.Millisecond))
+	if !b.IsLeader() || c.GetLeader() != "b:10001" {
+		t.Fatalf("Expected b:10001 elected by the majority, got %s", b.GetStatus().State)
+	}
+	a.Tick(now.Add(6 * time.Second))
+	if a.IsLeader() {
+		t.Fatal("Expected the partitioned node to lose its election")
+	}
+	if a.IsLeader() && b.IsLeader() {
+		t.Fatal("Expected a single leader")
+	}
+
+	// the partition heal, the old leader follow the higher term
+	delete(tr.down, "a:10001")
+	b.Tick(now.Add(6100 * time.Millisecond))
+	if a.GetLeader() != "b:10001" || a.GetStatus().Term != b.GetStatus().Term {
+		t.Fatalf("Expected a:10001 to follow b:10001, got %+v", a.GetStatus())
+	}
+	if v, _ := a.Get("cluster1"); string(v) != `{"failoverCounter":1}` {
+		t.Fatalf("Expected the committed state kept, got %s", v)
+	}
+}
+
+// TestLeaseFromVoters check that a peer that did not vote does not extend
+// the lease of a new leader
+func TestLeaseFromVoters(t *testing.T) {
+	tr, nodes := newTestGroup(t, []string{"a:10001", "b:10001", "c:10001", "d:10001", "e:10001"})
+	tr.down["d:10001"] = true
+	tr.down["e:10001"] = true
+	now := time.Now().Add(time.Hour)
+	nodes[0].Tick(now)
+	if !nodes[0].IsLeader() {
+		t.Fatal("Expected a:10001 elected with 3 votes of 5")
+	}
+	tr.down["c:10001"] = true
+	nodes[0].Tick(now.Add(500 * time.Millisecond))
+	nodes[0].Tick(now.Add(1100 * time.Millisecond))
+	if nodes[0].IsLeader() {
+		t.Fatal("Expected the lease to expire without a majority of acks")
+	}
+}
+
+// TestPartitionedCandidate cut a follower from the leader only, its election
+// must fail while the leader still heartbeats a majority
+func TestPartitionedCandidate(t *testing.T) {
+	tr, nodes := newTestGroup(t, []string{"a:10001", "b:10001", "c:10001"})
+	a, b, c := nodes[0], nodes[1], nodes[2]
+	now := time.Now().Add(time.Hour)
+	a.Tick(now)
+	if !a.IsLeader() {
+		t.Fatalf("Expected a:10001 leader, got %s", a.GetStatus().State)
+	}
+	tr.cut[[2]string{"a:10001", "b:10001"}] = true
+	a.Tick(now.Add(500 * time.Millisecond))
+
+	b.Tick(now.Add(5 * time.Second))
+	if b.IsLeader() || b.GetStatus().State == ConstStateLeader {
+		t.Fatal("Expected the candidate cut from the leader to lose its election")
+	}
+	if st := c.GetStatus(); st.Term != a.GetStatus().Term || st.Leader != "a:10001" {
+		t.Fatalf("Expected c:10001 to keep the term and the leader, got %+v", st)
+	}
+	if resp := a.HandleVote(VoteRequest{Term: 10, CandidateId: "b:10001", Index: 10, IndexTerm: 10}); resp.Granted {
+		t.Fatal("Expected the leader to refuse a vote within its lease")
+	}
+	a.Tick(now.Add(time.Second))
+	if !a.IsLeader() || a.GetStatus().State != ConstStateLeader {
+		t.Fatalf("Expected a:10001 to stay the single leader, got %s", a.GetStatus().State)
+	}
+}
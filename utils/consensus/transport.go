@@ -0,0 +1,93 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// transport.go
+
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/utils/arbitration"
+)
+
+const (
+	ConstVotePath   string = "/api/raft/vote"
+	ConstAppendPath string = "/api/raft/append"
+)
+
+// signatureWindow is the clock skew accepted between peers
+const signatureWindow = 30 * time.Second
+
+var ErrInvalidSecret = errors.New("Raft arbitration requires a secret without comma")
+
+// HTTPTransport post the requests as JSON to the http server of the peers,
+// peers are host:port of the replication-manager http server. The secret is
+// never sent, requests are signed like the arbitration requests with an HMAC
+// of the path, the body, a timestamp and a nonce.
+type HTTPTransport struct {
+	Secret string
+	client *http.Client
+	nonces *arbitration.NonceCache
+}
+
+func NewHTTPTransport(secret string, timeout time.Duration) (*HTTPTransport, error) {
+	// the arbitration signature accept a list of comma separated secrets
+	if secret == "" || strings.Contains(secret, ",") {
+		return nil, ErrInvalidSecret
+	}
+	return &HTTPTransport{Secret: secret, client: &http.Client{Timeout: timeout}, nonces: arbitration.NewNonceCache(signatureWindow)}, nil
+}
+
+// Verify authenticate a request of a peer carrying body, a request is
+// accepted once
+func (t *HTTPTransport) Verify(r *http.Request, body []byte) error {
+	_, err := arbitration.Verify(r, t.Secret, body, time.Now(), signatureWindow, t.nonces)
+	return err
+}
+
+func (t *HTTPTransport) post(peer string, path string, req interface{}, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequest("POST", "http://"+peer+path, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	arbitration.Sign(hreq, 0, t.Secret, body, time.Now())
+	hresp, err := t.client.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Peer %s answered %s", peer, hresp.Status)
+	}
+	return json.NewDecoder(hresp.Body).Decode(resp)
+}
+
+func (t *HTTPTransport) RequestVote(peer string, req VoteRequest) (VoteResponse, error) {
+	var resp VoteResponse
+	err := t.post(peer, ConstVotePath, req, &resp)
+	return resp, err
+}
+
+func (t *HTTPTransport) AppendEntries(peer string, req AppendRequest) (AppendResponse, error) {
+	var resp AppendResponse
+	err := t.post(peer, ConstAppendPath, req, &resp)
+	return resp, err
+}
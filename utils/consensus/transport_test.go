@@ -0,0 +1,61 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package consensus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	if _, err := NewHTTPTransport("", time.Second); err != ErrInvalidSecret {
+		t.Fatalf("Expected an empty secret refused, got %v", err)
+	}
+	if _, err := NewHTTPTransport("a,b", time.Second); err != ErrInvalidSecret {
+		t.Fatalf("Expected a secret list refused, got %v", err)
+	}
+	server, _ := NewHTTPTransport("secret", time.Second)
+	var last *http.Request
+	var lastBody []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		last, lastBody = r, body
+		if err := server.Verify(r, body); err != nil {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		if r.Header.Get("X-Raft-Secret") != "" || string(body) == "" {
+			t.Error("Expected the secret not to be sent")
+		}
+		json.NewEncoder(w).Encode(VoteResponse{Term: 1, Granted: true})
+	}))
+	defer ts.Close()
+	peer := ts.Listener.Addr().String()
+
+	client, _ := NewHTTPTransport("secret", time.Second)
+	resp, err := client.RequestVote(peer, VoteRequest{Term: 1, CandidateId: "a:10001"})
+	if err != nil || !resp.Granted {
+		t.Fatalf("Expected the vote granted, got %+v %v", resp, err)
+	}
+	if err := server.Verify(last, lastBody); err == nil {
+		t.Error("Expected a replayed request refused")
+	}
+	if err := server.Verify(last, []byte(`{"term":9,"candidateId":"c:10001"}`)); err == nil {
+		t.Error("Expected a tampered body refused")
+	}
+	wrong, _ := NewHTTPTransport("wrong", time.Second)
+	if _, err := wrong.RequestVote(peer, VoteRequest{Term: 1, CandidateId: "c:10001"}); err == nil {
+		t.Error("Expected a request signed with another secret refused")
+	}
+}
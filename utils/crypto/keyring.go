@@ -0,0 +1,134 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Keyring is a local file of AES-256 key encryption keys, one "id hexkey"
+// per line. The last key is the active one, older keys are kept to unwrap
+// the data keys of streams not yet wrapped again.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// InitKeyring create the keyring at path with a first key, it fails when
+// the file exists so that the keys of existing backups are never lost
+func InitKeyring(path string) (*Keyring, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	k := &Keyring{keys: make(map[string][]byte)}
+	if _, err := k.AddKey(path); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKeyring read the keyring at path, it fails when the file does not
+// exist, a missing keyring is created by InitKeyring only
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte)}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("Invalid key %s in keyring %s", fields[0], path)
+		}
+		k.keys[fields[0]] = key
+		k.active = fields[0]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if k.active == "" {
+		return nil, fmt.Errorf("No key in keyring %s", path)
+	}
+	return k, nil
+}
+
+// AddKey generate a new key, append it to the existing keyring file at path
+// and make it the active key
+func (k *Keyring) AddKey(path string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(key)
+	id := hex.EncodeToString(sum[:8])
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(file, "%s %s\n", id, hex.EncodeToString(key))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	k.keys[id] = key
+	k.active = id
+	return id, nil
+}
+
+// ActiveKey return the id of the key wrapping new data keys
+func (k *Keyring) ActiveKey() string {
+	return k.active
+}
+
+// WrapKey seal the data key with the active key
+func (k *Keyring) WrapKey(key []byte) (string, []byte, error) {
+	aead, err := newStreamCipher(k.keys[k.active])
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.active, aead.Seal(nonce, nonce, key, []byte(k.active)), nil
+}
+
+// UnwrapKey open a data key sealed by the key id
+func (k *Keyring) UnwrapKey(id string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Key %s is not in the keyring", id)
+	}
+	aead, err := newStreamCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("Invalid wrapped key")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(id))
+}
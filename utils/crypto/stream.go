@@ -0,0 +1,333 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Streams are cut in chunks sealed with AES-256-GCM under a random data key,
+// the nonce is a random prefix, the chunk counter and a last chunk flag so
+// that chunks can not be reordered nor the stream truncated. The data key is
+// wrapped by a KeyWrapper and stored in a fixed size header that can be
+// rewritten in place when the key encryption key is rotated.
+const (
+	streamChunkSize   = 64 * 1024
+	streamHeaderSize  = 512
+	streamNoncePrefix = 7
+	streamMaxKeyId    = 64
+	streamMaxWrapped  = streamHeaderSize - 8 - streamNoncePrefix - 1 - streamMaxKeyId - 2
+)
+
+var streamMagic = []byte("RPLMENC1")
+
+var ErrTruncated = errors.New("Encrypted stream is truncated")
+
+// KeyWrapper wrap the data key of a stream with the active key encryption
+// key and unwrap data keys wrapped by any known key
+type KeyWrapper interface {
+	WrapKey(key []byte) (string, []byte, error)
+	UnwrapKey(id string, wrapped []byte) ([]byte, error)
+}
+
+// CheckKeyId tell if the id of a key encryption key fits in the stream header
+func CheckKeyId(id string) error {
+	if len(id) > streamMaxKeyId {
+		return fmt.Errorf("Key id %s is longer than %d characters", id, streamMaxKeyId)
+	}
+	return nil
+}
+
+type streamHeader struct {
+	keyId   string
+	wrapped []byte
+	nonce   []byte
+}
+
+func (h *streamHeader) marshal() ([]byte, error) {
+	if len(h.keyId) > streamMaxKeyId || len(h.wrapped) > streamMaxWrapped {
+		return nil, errors.New("Wrapped key does not fit in the stream header")
+	}
+	b := make([]byte, streamHeaderSize)
+	copy(b, streamMagic)
+	copy(b[8:], h.nonce)
+	p := 8 + streamNoncePrefix
+	b[p] = byte(len(h.keyId))
+	copy(b[p+1:], h.keyId)
+	p += 1 + streamMaxKeyId
+	binary.BigEndian.PutUint16(b[p:], uint16(len(h.wrapped)))
+	copy(b[p+2:], h.wrapped)
+	return b, nil
+}
+
+func unmarshalStreamHeader(b []byte) (*streamHeader, error) {
+	if len(b) < streamHeaderSize || !bytes.Equal(b[:8], streamMagic) {
+		return nil, errors.New("Not an encrypted stream")
+	}
+	h := &streamHeader{nonce: append([]byte{}, b[8:8+streamNoncePrefix]...)}
+	p := 8 + streamNoncePrefix
+	if int(b[p]) > streamMaxKeyId {
+		return nil, errors.New("Invalid stream header")
+	}
+	h.keyId = string(b[p+1 : p+1+int(b[p])])
+	p += 1 + streamMaxKeyId
+	l := int(binary.BigEndian.Uint16(b[p:]))
+	if l > streamMaxWrapped {
+		return nil, errors.New("Invalid stream header")
+	}
+	h.wrapped = append([]byte{}, b[p+2:p+2+l]...)
+	return h, nil
+}
+
+func newStreamCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type streamNonce struct {
+	nonce   [12]byte
+	counter uint32
+}
+
+func (n *streamNonce) next(last bool) ([]byte, error) {
+	if n.counter == ^uint32(0) {
+		return nil, errors.New("Encrypted stream too large")
+	}
+	binary.BigEndian.PutUint32(n.nonce[streamNoncePrefix:], n.counter)
+	n.nonce[11] = 0
+	if last {
+		n.nonce[11] = 1
+	}
+	n.counter++
+	return n.nonce[:], nil
+}
+
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce streamNonce
+	buf   []byte
+}
+
+// NewEncryptWriter return a writer encrypting to w under a new data key.
+// Close must be called to write the last chunk, it does not close w.
+func NewEncryptWriter(w io.Writer, kw KeyWrapper) (io.WriteCloser, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	h := &streamHeader{nonce: make([]byte, streamNoncePrefix)}
+	if _, err := rand.Read(h.nonce); err != nil {
+		return nil, err
+	}
+	var err error
+	h.keyId, h.wrapped, err = kw.WrapKey(key)
+	if err != nil {
+		return nil, err
+	}
+	header, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	e := &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, streamChunkSize)}
+	copy(e.nonce.nonce[:], h.nonce)
+	return e, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		// a full chunk is sealed only when more data comes, the last one
+		// is sealed by Close
+		if len(e.buf) == streamChunkSize {
+			if err := e.seal(false); err != nil {
+				return total - len(p), err
+			}
+		}
+		n := copy(e.buf[len(e.buf):streamChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	nonce, err := e.nonce.next(last)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(e.aead.Seal(nil, nonce, e.buf, nil))
+	e.buf = e.buf[:0]
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	if e.buf == nil {
+		return nil
+	}
+	err := e.seal(true)
+	e.buf = nil
+	return err
+}
+
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	nonce streamNonce
+	chunk []byte
+	buf   []byte
+	done  bool
+}
+
+// NewDecryptReader return a reader of the clear content of an encrypted
+// stream
+func NewDecryptReader(r io.Reader, kw KeyWrapper) (io.Reader, error) {
+	b := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	h, err := unmarshalStreamHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	key, err := kw.UnwrapKey(h.keyId, h.wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	d := &decryptReader{r: bufio.NewReaderSize(r, streamChunkSize+aead.Overhead()+1), aead: aead, chunk: make([]byte, streamChunkSize+aead.Overhead())}
+	copy(d.nonce.nonce[:], h.nonce)
+	return d, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	last := false
+	switch err {
+	case nil:
+		_, perr := d.r.Peek(1)
+		last = perr == io.EOF
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return ErrTruncated
+	default:
+		return err
+	}
+	nonce, err := d.nonce.next(last)
+	if err != nil {
+		return err
+	}
+	buf, err := d.aead.Open(nil, nonce, d.chunk[:n], nil)
+	if err != nil {
+		// a stream cut after a full chunk ends on a chunk not sealed as last
+		nonce[11] = 0
+		if _, cerr := d.aead.Open(nil, nonce, d.chunk[:n], nil); last && cerr == nil {
+			return ErrTruncated
+		}
+		return errors.New("Encrypted stream authentication failed")
+	}
+	d.buf = buf
+	d.done = last
+	return nil
+}
+
+// OpenStream return the clear content of r, decrypted when r is an
+// encrypted stream and as is otherwise
+func OpenStream(r io.Reader, kw KeyWrapper) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(streamMagic))
+	if err != nil || !bytes.Equal(magic, streamMagic) {
+		return br, false, nil
+	}
+	d, err := NewDecryptReader(br, kw)
+	return d, true, err
+}
+
+// IsEncryptedFile tell if the file at path is an encrypted stream
+func IsEncryptedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, streamMagic)
+}
+
+// RewrapFile wrap again the data key of the encrypted file at path with the
+// active key, the content is left untouched. It return false for files in
+// clear.
+func RewrapFile(path string, kw KeyWrapper) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	b := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(f, b); err != nil || !bytes.Equal(b[:8], streamMagic) {
+		return false, nil
+	}
+	h, err := unmarshalStreamHeader(b)
+	if err != nil {
+		return false, err
+	}
+	key, err := kw.UnwrapKey(h.keyId, h.wrapped)
+	if err != nil {
+		return false, err
+	}
+	h.keyId, h.wrapped, err = kw.WrapKey(key)
+	if err != nil {
+		return false, err
+	}
+	if b, err = h.marshal(); err != nil {
+		return false, err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return false, err
+	}
+	return true, f.Sync()
+}
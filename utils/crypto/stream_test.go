@@ -0,0 +1,154 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamEncryptDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.keyring")
+	kr, err := InitKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 10, streamChunkSize, 3*streamChunkSize + 17} {
+		clear := bytes.Repeat([]byte("replication"), size/11+1)[:size]
+		var enc bytes.Buffer
+		w, err := NewEncryptWriter(&enc, kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(clear[:size/2])
+		w.Write(clear[size/2:])
+		w.Close()
+
+		r, encrypted, err := OpenStream(bytes.NewReader(enc.Bytes()), kr)
+		if err != nil || !encrypted {
+			t.Fatalf("OpenStream of %d bytes: %t %v", size, encrypted, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, clear) {
+			t.Fatalf("Decrypt of %d bytes failed: %v", size, err)
+		}
+
+		if size > streamChunkSize {
+			_, err = ioutil.ReadAll(mustDecrypt(t, enc.Bytes()[:streamHeaderSize+streamChunkSize+16], kr))
+			if err != ErrTruncated {
+				t.Errorf("Truncated stream of %d bytes should fail, got %v", size, err)
+			}
+		}
+	}
+
+	r, encrypted, err := OpenStream(bytes.NewReader([]byte("clear dump")), kr)
+	got, _ := ioutil.ReadAll(r)
+	if err != nil || encrypted || string(got) != "clear dump" {
+		t.Errorf("Clear stream should be read as is")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.keyring")
+	kr, _ := InitKeyring(path)
+	old := kr.ActiveKey()
+
+	file := filepath.Join(dir, "dump.enc")
+	f, _ := os.Create(file)
+	w, _ := NewEncryptWriter(f, kr)
+	w.Write([]byte("rotate me"))
+	w.Close()
+	f.Close()
+
+	if _, err := kr.AddKey(path); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := RewrapFile(file, kr); !ok || err != nil {
+		t.Fatalf("RewrapFile: %t %v", ok, err)
+	}
+
+	// the new key alone decrypts the file
+	reloaded, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(reloaded.keys, old)
+	content, _ := ioutil.ReadFile(file)
+	got, err := ioutil.ReadAll(mustDecrypt(t, content, reloaded))
+	if err != nil || string(got) != "rotate me" {
+		t.Errorf("Rewrapped file should decrypt with the new key: %v", err)
+	}
+}
+
+func TestKeyringInit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.keyring")
+	if _, err := LoadKeyring(path); !os.IsNotExist(err) {
+		t.Fatalf("Loading a missing keyring should fail, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Loading a missing keyring should not create it")
+	}
+	kr, err := InitKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitKeyring(path); err == nil {
+		t.Error("An existing keyring should not be initialized again")
+	}
+	reloaded, err := LoadKeyring(path)
+	if err != nil || reloaded.ActiveKey() != kr.ActiveKey() {
+		t.Errorf("Expected the initialized key %s, got %v", kr.ActiveKey(), err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected a keyring readable by its owner only: %v", err)
+	}
+}
+
+func TestCheckKeyId(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"0123456789abcdef", true},
+		{"vault:transit/backup", true},
+		{"vault:" + strings.Repeat("k", 58), true},
+		{"vault:" + strings.Repeat("k", 59), false},
+	}
+	for _, tt := range tests {
+		if err := CheckKeyId(tt.id); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %t, got %v", tt.id, tt.valid, err)
+		}
+	}
+}
+
+func mustDecrypt(t *testing.T, b []byte, kw KeyWrapper) *decryptReader {
+	r, err := NewDecryptReader(bytes.NewReader(b), kw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(*decryptReader)
+}
@@ -1,7 +1,12 @@
 package dbhelper
 
-import "github.com/jmoiron/sqlx"
-import log "github.com/sirupsen/logrus"
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/arbitration"
+	log "github.com/sirupsen/logrus"
+)
 
 func SetHeartbeatTable(db *sqlx.DB) error {
 
@@ -22,6 +27,11 @@ func SetHeartbeatTable(db *sqlx.DB) error {
 		if err != nil {
 			return err
 		}
+		stmt = "CREATE TABLE IF NOT EXISTS replication_manager_schema.arbitration_decision(id bigint AUTO_INCREMENT, secret varchar(64), cluster varchar(128), uid int, uuid varchar(128), master varchar(128), winner tinyint, votes int, quorum int, date timestamp, PRIMARY KEY(id), KEY(secret,cluster)) engine=innodb"
+		_, err = db.Exec(stmt)
+		if err != nil {
+			return err
+		}
 		return nil
 	}
 	if db.DriverName() == "sqlite3" {
@@ -42,6 +52,22 @@ func SetHeartbeatTable(db *sqlx.DB) error {
 		if err != nil {
 			return err
 		}
+		stmt = `CREATE TABLE IF NOT EXISTS arbitration_decision(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			secret varchar(64),
+			cluster varchar(128),
+			uid int,
+			uuid varchar(128),
+			master varchar(128),
+			winner int,
+			votes int,
+			quorum int,
+			date timestamp
+		)`
+		_, err = db.Exec(stmt)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -104,7 +130,7 @@ func RequestArbitration(db *sqlx.DB, uuid string, secret string, cluster string,
 			// stmt = "INSERT INTO heartbeat(secret,uuid,uid,master,date,arbitration_date,cluster, hosts, failed ) VALUES('" + secret + "','" + uuid + "'," + uid + ",'" + master + "', DATETIME('now'), DATETIME('now'),'" + cluster + "'," + hosts + "," + failed + ") ON DUPLICATE KEY UPDATE arbitration_date=DATETIME('now'),date=DATETIME('now'),master='" + master + "',status='E', uuid='" + uuid + "',hosts=" + hosts + ",failed=" + failed
 			stmt = `INSERT OR REPLACE INTO heartbeat (secret,uuid,uid,master,date,arbitration_date,cluster,hosts,failed,status)
       VALUES(?,?,?,?,DATETIME('now'),DATETIME('now'),?,?,?,'E')`
-			_, err = tx.Exec(stmt, secret, uuid, uid, master, cluster, hosts, failed, secret, cluster, uid)
+			_, err = tx.Exec(stmt, secret, uuid, uid, master, cluster, hosts, failed)
 			if err != nil {
 				log.Error("(dbhelper.RequestArbitration) Error executing transaction: ", err)
 				tx.Rollback()
@@ -136,6 +162,75 @@ func GetArbitrationMaster(db *sqlx.DB, secret string, cluster string) string {
 	return ""
 }
 
+// ReleaseArbitration drop the election flag of a monitor, a quorum member
+// release its vote when the election did not reach the majority
+func ReleaseArbitration(db *sqlx.DB, secret string, cluster string, uid int) error {
+	stmt := "UPDATE heartbeat SET status='U' WHERE status='E' AND cluster=? AND secret=? AND uid=?"
+	_, err := db.Exec(stmt, cluster, secret, uid)
+	return err
+}
+
+// SetArbitrationWinner apply the election decided by the quorum, the winner
+// is the only elected monitor of the cluster
+func SetArbitrationWinner(db *sqlx.DB, secret string, cluster string, uid int, uuid string, master string) error {
+	stmt := "UPDATE heartbeat SET status='U' WHERE status='E' AND cluster=? AND secret=? AND uid<>?"
+	_, err := db.Exec(stmt, cluster, secret, uid)
+	if err != nil {
+		return err
+	}
+	stmt = "UPDATE heartbeat SET status='E', arbitration_date=?, uuid=?, master=? WHERE cluster=? AND secret=? AND uid=? AND status<>'E'"
+	_, err = db.Exec(stmt, time.Now().UTC(), uuid, master, cluster, secret, uid)
+	return err
+}
+
+// WriteArbitrationDecision keep the history of elections
+func WriteArbitrationDecision(db *sqlx.DB, secret string, cluster string, uid int, uuid string, master string, winner bool, votes int, quorum int) error {
+	stmt := "INSERT INTO arbitration_decision (secret,cluster,uid,uuid,master,winner,votes,quorum,date) VALUES(?,?,?,?,?,?,?,?,?)"
+	_, err := db.Exec(stmt, secret, cluster, uid, uuid, master, winner, votes, quorum, time.Now().UTC())
+	return err
+}
+
+// GetArbitrationLeases return the elected monitor of each cluster
+func GetArbitrationLeases(db *sqlx.DB, secret string) ([]arbitration.Lease, error) {
+	leases := []arbitration.Lease{}
+	stmt := "SELECT secret, cluster, uid, COALESCE(uuid,''), COALESCE(master,''), COALESCE(arbitration_date,date), date FROM heartbeat WHERE status='E' AND secret=? ORDER BY cluster"
+	rows, err := db.Queryx(stmt, secret)
+	if err != nil {
+		return leases, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l arbitration.Lease
+		err = rows.Scan(&l.Group, &l.Cluster, &l.UID, &l.UUID, &l.Master, &l.ElectedAt, &l.LastHeartbeat)
+		if err != nil {
+			return leases, err
+		}
+		leases = append(leases, l)
+	}
+	return leases, rows.Err()
+}
+
+// GetArbitrationDecisions return the last elections, of all clusters when
+// cluster is empty
+func GetArbitrationDecisions(db *sqlx.DB, secret string, cluster string, limit int) ([]arbitration.DecisionRecord, error) {
+	decisions := []arbitration.DecisionRecord{}
+	stmt := "SELECT secret, cluster, uid, uuid, master, winner, votes, quorum, date FROM arbitration_decision WHERE secret=? AND (cluster=? OR ?='') ORDER BY id DESC LIMIT ?"
+	rows, err := db.Queryx(stmt, secret, cluster, cluster, limit)
+	if err != nil {
+		return decisions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d arbitration.DecisionRecord
+		err = rows.Scan(&d.Group, &d.Cluster, &d.UID, &d.UUID, &d.Master, &d.Winner, &d.Votes, &d.Quorum, &d.Date)
+		if err != nil {
+			return decisions, err
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
+
 // SetStatusActiveHeartbeat arbitrator can set or remove election flag "E"
 func SetStatusActiveHeartbeat(db *sqlx.DB, uuid string, status string, master string, secret string, uid int) error {
 
@@ -11,6 +11,7 @@ package dbhelper
 
 import (
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"hash/crc64"
@@ -21,10 +22,13 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/percona/go-mysql/query"
 	v3 "github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/digest"
 	"github.com/signal18/replication-manager/utils/misc"
 )
 
@@ -955,6 +959,10 @@ func GetSlaveStatus(db *sqlx.DB, Channel string, myver *MySQLVersion) (SlaveStat
 									ON ss.subname =s.subname
 							) ON ros.external_id='pg_' || ss.subid::text ,
 							(SELECT count(*) as nbrep FROM pg_stat_subscription) AS sqt `
+			// a streaming standby can not have subscriptions
+			if standby, _, _ := IsPostgresInRecovery(db); standby {
+				query = pgStreamingSlaveStatus
+			}
 		}
 
 		err = udb.Get(&ss, query)
@@ -1102,6 +1110,11 @@ func GetAllSlavesStatus(db *sqlx.DB, myver *MySQLVersion) ([]SlaveStatus, string
 	query := "SHOW ALL SLAVES STATUS"
 	//		CASE WHEN sqt.nbrep=1 THEN	 ss.subname ELSE '' END as "Connection_name",
 	if myver.IsPPostgreSQL() {
+		// a streaming standby can not have subscriptions
+		ss, query, err = GetPostgresStreamingStatus(db)
+		if err != nil || len(ss) > 0 {
+			return ss, query, err
+		}
 		query = `SELECT
 								ss.subname as "Connection_name",
 								ltrim((regexp_split_to_array(s.subconninfo, '\s+'))[2],'host=') as "Master_Host",
@@ -1649,6 +1662,96 @@ func GetQueries(db *sqlx.DB) (map[string]PFSQuery, string, error) {
 	return vars, query, nil
 }
 
+// GetDigestCounters return the cumulative counters of the statement digests
+// keyed by schema and digest, with their latency histogram on MySQL 8.0.19
+// and newer
+func GetDigestCounters(db *sqlx.DB, myver *MySQLVersion) (map[string]digest.Counters, string, error) {
+	counters := make(map[string]digest.Counters)
+	query := `SELECT /*replication-manager*/
+	COALESCE(SCHEMA_NAME,'') AS schema_name,
+	DIGEST AS digest,
+	DIGEST_TEXT AS digest_text,
+	COUNT_STAR AS calls,
+	SUM_TIMER_WAIT AS latency,
+	SUM_ROWS_EXAMINED AS rows_examined,
+	SUM_ROWS_SENT AS rows_sent,
+	SUM_ERRORS AS errors,
+	SUM_NO_INDEX_USED + SUM_NO_GOOD_INDEX_USED AS no_index,
+	SUM_CREATED_TMP_DISK_TABLES AS tmp_disk
+	FROM performance_schema.events_statements_summary_by_digest
+	WHERE DIGEST IS NOT NULL AND DIGEST_TEXT IS NOT NULL`
+	rows, err := db.Queryx(query)
+	if err != nil {
+		return counters, query, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c digest.Counters
+		err = rows.Scan(&c.Schema, &c.Digest, &c.Text, &c.Calls, &c.Latency, &c.RowsExamined, &c.RowsSent, &c.Errors, &c.NoIndex, &c.TmpDisk)
+		if err != nil {
+			return counters, query, err
+		}
+		counters[c.Key()] = c
+	}
+	if err = rows.Err(); err != nil {
+		return counters, query, err
+	}
+	if !(myver.IsMySQLOrPercona() && myver.Greater(MySQLVersion{Major: 8, Minor: 0, Release: 18})) {
+		return counters, query, nil
+	}
+	query = `SELECT /*replication-manager*/ COALESCE(SCHEMA_NAME,'') AS schema_name, DIGEST AS digest, BUCKET_TIMER_HIGH AS bucket, COUNT_BUCKET AS count
+	FROM performance_schema.events_statements_histogram_by_digest
+	WHERE COUNT_BUCKET > 0`
+	hrows, err := db.Queryx(query)
+	if err != nil {
+		return counters, query, err
+	}
+	defer hrows.Close()
+	for hrows.Next() {
+		var schema, dig string
+		var bucket, count uint64
+		err = hrows.Scan(&schema, &dig, &bucket, &count)
+		if err != nil {
+			return counters, query, err
+		}
+		c, ok := counters[digest.Key(schema, dig)]
+		if !ok {
+			continue
+		}
+		if c.Buckets == nil {
+			c.Buckets = make(map[uint64]uint64)
+		}
+		c.Buckets[bucket] = count
+		counters[c.Key()] = c
+	}
+	return counters, query, hrows.Err()
+}
+
+// GetDigestSampleQuery return a statement of a digest, the sample of the
+// summary on MySQL 8 or the last one in the statements history
+func GetDigestSampleQuery(db *sqlx.DB, myver *MySQLVersion, schema string, dig string) (string, string, error) {
+	var sample string
+	query := "SELECT /*replication-manager*/ COALESCE(QUERY_SAMPLE_TEXT,'') FROM performance_schema.events_statements_summary_by_digest WHERE COALESCE(SCHEMA_NAME,'') = ? AND DIGEST = ?"
+	if myver.IsMySQLOrPercona() && myver.Major >= 8 {
+		err := db.QueryRowx(query, schema, dig).Scan(&sample)
+		if err == nil && sample != "" {
+			return sample, query, nil
+		}
+	}
+	var err error
+	for _, table := range []string{"events_statements_history_long", "events_statements_history"} {
+		query = "SELECT /*replication-manager*/ COALESCE(SQL_TEXT,'') FROM performance_schema." + table + " WHERE COALESCE(CURRENT_SCHEMA,'') = ? AND DIGEST = ? ORDER BY EVENT_ID DESC LIMIT 1"
+		err = db.QueryRowx(query, schema, dig).Scan(&sample)
+		if err == nil && sample != "" {
+			return sample, query, nil
+		}
+	}
+	if err == nil || err == sql.ErrNoRows {
+		err = errors.New("No sample statement for digest " + dig)
+	}
+	return "", query, err
+}
+
 func GetTableChecksumResult(db *sqlx.DB) (map[uint64]chunk, string, error) {
 	vars := make(map[uint64]chunk)
 	query := "SELECT /*replication-manager*/ * from replication_manager_schema.table_checksum"
@@ -2706,6 +2809,103 @@ func ChecksumTable(db *sqlx.DB, table string) (string, error) {
 	return checkres, err
 }
 
+// QuoteIdentifier quote a schema, table or column name with backticks
+func QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// QuoteValue return the SQL literal of a value scanned from a row, strings
+// that are not valid UTF-8 are written in hexadecimal
+func QuoteValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case []byte:
+		return QuoteValue(string(v))
+	case string:
+		if !utf8.ValidString(v) {
+			return "0x" + hex.EncodeToString([]byte(v))
+		}
+		var b strings.Builder
+		b.WriteByte('\'')
+		for i := 0; i < len(v); i++ {
+			switch v[i] {
+			case 0:
+				b.WriteString("\\0")
+			case '\n':
+				b.WriteString("\\n")
+			case '\r':
+				b.WriteString("\\r")
+			case 26:
+				b.WriteString("\\Z")
+			case '\'', '\\':
+				b.WriteByte('\\')
+				b.WriteByte(v[i])
+			default:
+				b.WriteByte(v[i])
+			}
+		}
+		b.WriteByte('\'')
+		return b.String()
+	}
+	return QuoteValue(fmt.Sprint(value))
+}
+
+// GetTableColumns return the column names of a table in ordinal order
+func GetTableColumns(db *sqlx.DB, schema string, table string) ([]string, string, error) {
+	var columns []string
+	query := "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION"
+	err := db.Select(&columns, query, schema, table)
+	return columns, query + "(" + schema + "," + table + ")", err
+}
+
+// GetTablePrimaryKey return the primary key columns of a table in index order
+func GetTablePrimaryKey(db *sqlx.DB, schema string, table string) ([]string, string, error) {
+	var columns []string
+	query := "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE WHERE CONSTRAINT_NAME='PRIMARY' AND TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION"
+	err := db.Select(&columns, query, schema, table)
+	return columns, query + "(" + schema + "," + table + ")", err
+}
+
+// GetTableTriggers return the names of the triggers of a table
+func GetTableTriggers(db *sqlx.DB, schema string, table string) ([]string, string, error) {
+	var triggers []string
+	query := "SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE EVENT_OBJECT_SCHEMA=? AND EVENT_OBJECT_TABLE=?"
+	err := db.Select(&triggers, query, schema, table)
+	return triggers, query + "(" + schema + "," + table + ")", err
+}
+
+// GetTableRows return the estimated number of rows of a table
+func GetTableRows(db *sqlx.DB, schema string, table string) (int64, string, error) {
+	var rows sql.NullInt64
+	query := "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
+	err := db.QueryRowx(query, schema, table).Scan(&rows)
+	return rows.Int64, query + "(" + schema + "," + table + ")", err
+}
+
+// GetTableDDL return the SHOW CREATE TABLE of a table
+func GetTableDDL(db *sqlx.DB, myver *MySQLVersion, schema string, table string) (string, string, error) {
+	var tbl, ddl string
+	query := GetNoBlockOnMedataLock(db, myver) + "SHOW CREATE TABLE " + QuoteIdentifier(schema) + "." + QuoteIdentifier(table)
+	err := db.QueryRowx(query).Scan(&tbl, &ddl)
+	return ddl, query, err
+}
+
 func InjectTrxWithoutCommit(db *sqlx.DB) error {
 	benchWarmup(db)
 	_, err := db.Exec("START TRANSACTION")
@@ -0,0 +1,63 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package dbhelper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuoteValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		literal string
+	}{
+		{"null", nil, "NULL"},
+		{"true", true, "1"},
+		{"false", false, "0"},
+		{"int", int64(-42), "-42"},
+		{"uint", uint64(18446744073709551615), "18446744073709551615"},
+		{"float", float64(1.5), "1.5"},
+		{"float32", float32(0.25), "0.25"},
+		{"time", time.Date(2021, 3, 4, 5, 6, 7, 891000000, time.UTC), "'2021-03-04 05:06:07.891'"},
+		{"string", "abc", "'abc'"},
+		{"empty", "", "''"},
+		{"bytes", []byte("abc"), "'abc'"},
+		{"quotes", `it's "quoted"`, `'it\'s "quoted"'`},
+		{"backslashes", `C:\dir\`, `'C:\\dir\\'`},
+		{"control characters", "a\x00b\nc\rd\x1a", `'a\0b\nc\rd\Z'`},
+		{"utf8", "été", "'été'"},
+		{"binary", []byte{0x00, 0xff, 0x27}, "0x00ff27"},
+		{"latin1", "caf\xe9", "0x636166e9"},
+		{"other", int32(7), "'7'"},
+	}
+	for _, tt := range tests {
+		if literal := QuoteValue(tt.value); literal != tt.literal {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.literal, literal)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name, quoted string
+	}{
+		{"t", "`t`"},
+		{"my table", "`my table`"},
+		{"a`b", "`a``b`"},
+		{"`", "````"},
+	}
+	for _, tt := range tests {
+		if quoted := QuoteIdentifier(tt.name); quoted != tt.quoted {
+			t.Errorf("Expected %s, got %s", tt.quoted, quoted)
+		}
+	}
+}
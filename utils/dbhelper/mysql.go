@@ -21,3 +21,16 @@ func HaveErrantTransactions(db *sqlx.DB, gtidMaster string, gtidSlave string) (b
 	}
 	return false, query, nil
 }
+
+// SetInnoDBClusterInstanceHidden set the _hidden tag of an InnoDB Cluster
+// member in the metadata, MySQL Router stop routing new connections to hidden
+// members on its next metadata refresh
+func SetInnoDBClusterInstanceHidden(db *sqlx.DB, address string, hidden bool) (string, error) {
+	tag := `{"tags":{"_hidden":false}}`
+	if hidden {
+		tag = `{"tags":{"_hidden":true}}`
+	}
+	query := "UPDATE mysql_innodb_cluster_metadata.instances SET attributes = JSON_MERGE_PATCH(COALESCE(attributes, '{}'), ?) WHERE address = ?"
+	_, err := db.Exec(query, tag, address)
+	return query, err
+}
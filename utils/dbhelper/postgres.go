@@ -0,0 +1,136 @@
+// PostgreSQL streaming replication related functions
+
+package dbhelper
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/misc"
+)
+
+// pgStreamingSlaveStatus mimic SHOW SLAVE STATUS on a streaming standby, the
+// timeline is the log file, received and replayed LSN are the positions and
+// the pseudo GTID in domain 0
+const pgStreamingSlaveStatus = `WITH l AS (
+		SELECT (COALESCE(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn()) - '0/0'::pg_lsn)::bigint AS received,
+			(pg_last_wal_replay_lsn() - '0/0'::pg_lsn)::bigint AS replayed,
+			'master.' || lpad((SELECT timeline_id FROM pg_control_checkpoint())::text, 6, '0') AS logfile
+	)
+	SELECT
+		'' as "Connection_name",
+		COALESCE(substring(r.conninfo from 'host=([^ ]+)'), substring(current_setting('primary_conninfo') from 'host=([^ ]+)'), '') as "Master_Host",
+		COALESCE(substring(r.conninfo from 'port=([^ ]+)'), substring(current_setting('primary_conninfo') from 'port=([^ ]+)'), '5432') as "Master_Port",
+		COALESCE(substring(r.conninfo from 'user=([^ ]+)'), substring(current_setting('primary_conninfo') from 'user=([^ ]+)'), '') as "Master_User",
+		l.logfile as "Master_Log_File",
+		l.received::text as "Read_Master_Log_Pos",
+		l.logfile as "Relay_Master_Log_File",
+		CASE WHEN r.status = 'streaming' THEN 'Yes' WHEN r.status IS NULL THEN 'No' ELSE 'Connecting' END as "Slave_IO_Running",
+		CASE WHEN pg_is_wal_replay_paused() THEN 'No' ELSE 'Yes' END as "Slave_SQL_Running",
+		l.replayed::text as "Exec_Master_Log_Pos",
+		CASE WHEN l.received = l.replayed THEN 0 ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)::bigint END as "Seconds_Behind_Master",
+		'' as "Last_IO_Errno",
+		'' as "Last_IO_Error",
+		'' as "Last_SQL_Errno",
+		'' as "Last_SQL_Error",
+		0 as "Master_Server_Id",
+		'Slave_Pos' as "Using_Gtid",
+		'0-0-' || l.received::text as "Gtid_IO_Pos",
+		'0-0-' || l.replayed::text as "Gtid_Slave_Pos",
+		1 as "Slave_Heartbeat_Period",
+		CASE WHEN l.received = l.replayed THEN 'Slave has read all relay log' ELSE 'Replaying WAL' END as "Slave_SQL_Running_State"
+	FROM l LEFT JOIN pg_stat_wal_receiver r ON true
+	WHERE pg_is_in_recovery()`
+
+// GetPostgresStreamingStatus return the streaming replication of a standby,
+// the list is empty on a primary
+func GetPostgresStreamingStatus(db *sqlx.DB) ([]SlaveStatus, string, error) {
+	udb := db.Unsafe()
+	ss := []SlaveStatus{}
+	err := udb.Select(&ss, pgStreamingSlaveStatus)
+	return ss, pgStreamingSlaveStatus, err
+}
+
+func IsPostgresInRecovery(db *sqlx.DB) (bool, string, error) {
+	var recovery bool
+	query := "SELECT pg_is_in_recovery()"
+	err := db.QueryRowx(query).Scan(&recovery)
+	return recovery, query, err
+}
+
+// GetPostgresLSN return the WAL position written on a primary or replayed on
+// a standby
+func GetPostgresLSN(db *sqlx.DB) (uint64, string, error) {
+	var lsn uint64
+	query := "SELECT (CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END - '0/0'::pg_lsn)::bigint"
+	err := db.QueryRowx(query).Scan(&lsn)
+	return lsn, query, err
+}
+
+// PostgresPromote end the recovery of a standby and wait for it to accept
+// writes
+func PostgresPromote(db *sqlx.DB, timeout int) (string, error) {
+	var promoted bool
+	query := "SELECT pg_promote(true, " + strconv.Itoa(timeout) + ")"
+	err := db.QueryRowx(query).Scan(&promoted)
+	if err != nil {
+		return query, err
+	}
+	if !promoted {
+		return query, errors.New("Promotion not completed in " + strconv.Itoa(timeout) + " seconds")
+	}
+	return query, nil
+}
+
+// PostgresSetPrimaryConnInfo point a standby to a new primary, the WAL
+// receiver restart on reload since PostgreSQL 13
+func PostgresSetPrimaryConnInfo(db *sqlx.DB, opt ChangeMasterOpt, appname string) (string, error) {
+	stmt := getPostgresPrimaryConnInfoStmt(opt, opt.Password, appname)
+	logs := getPostgresPrimaryConnInfoStmt(opt, "XXXX", appname)
+	_, err := db.Exec(stmt)
+	if err != nil {
+		return logs, err
+	}
+	logs += "\nSELECT pg_reload_conf()"
+	_, err = db.Exec("SELECT pg_reload_conf()")
+	return logs, err
+}
+
+// getPostgresPrimaryConnInfoStmt build the ALTER SYSTEM of primary_conninfo,
+// the password is quoted for libpq before the statement is quoted for SQL
+func getPostgresPrimaryConnInfoStmt(opt ChangeMasterOpt, password string, appname string) string {
+	conninfo := "host=" + misc.Unbracket(opt.Host) + " port=" + opt.Port + " user=" + opt.User + " password=" + quotePostgresConnInfoValue(password) + " application_name=" + appname
+	if opt.SSL {
+		conninfo += " sslmode=require"
+	}
+	return "ALTER SYSTEM SET primary_conninfo = '" + strings.Replace(conninfo, "'", "''", -1) + "'"
+}
+
+// quotePostgresConnInfoValue quote a keyword value of a libpq connection
+// string so that spaces, quotes and backslashes are kept
+func quotePostgresConnInfoValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	return "'" + strings.Replace(value, "'", `\'`, -1) + "'"
+}
+
+// PostgresSetReadOnly reject new writes on a primary, it is persisted so that
+// a restarted old primary does not accept writes before rejoin
+func PostgresSetReadOnly(db *sqlx.DB, flag bool) (string, error) {
+	stmt := "ALTER SYSTEM SET default_transaction_read_only = off"
+	if flag {
+		stmt = "ALTER SYSTEM SET default_transaction_read_only = on"
+	}
+	_, err := db.Exec(stmt)
+	if err != nil {
+		return stmt, err
+	}
+	_, err = db.Exec("SELECT pg_reload_conf()")
+	return stmt + "\nSELECT pg_reload_conf()", err
+}
+
+func PostgresCheckpoint(db *sqlx.DB) (string, error) {
+	_, err := db.Exec("CHECKPOINT")
+	return "CHECKPOINT", err
+}
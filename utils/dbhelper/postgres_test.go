@@ -0,0 +1,37 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package dbhelper
+
+import "testing"
+
+func TestPostgresPrimaryConnInfoStmt(t *testing.T) {
+	tests := []struct {
+		name     string
+		opt      ChangeMasterOpt
+		password string
+		stmt     string
+	}{
+		{"plain", ChangeMasterOpt{Host: "db1", Port: "5432", User: "repl"}, "secret",
+			`ALTER SYSTEM SET primary_conninfo = 'host=db1 port=5432 user=repl password=''secret'' application_name=db2'`},
+		{"ipv6 and ssl", ChangeMasterOpt{Host: "[::1]", Port: "5433", User: "repl", SSL: true}, "secret",
+			`ALTER SYSTEM SET primary_conninfo = 'host=::1 port=5433 user=repl password=''secret'' application_name=db2 sslmode=require'`},
+		{"space", ChangeMasterOpt{Host: "db1", Port: "5432", User: "repl"}, "a b",
+			`ALTER SYSTEM SET primary_conninfo = 'host=db1 port=5432 user=repl password=''a b'' application_name=db2'`},
+		{"quote and backslash", ChangeMasterOpt{Host: "db1", Port: "5432", User: "repl"}, `it's\`,
+			`ALTER SYSTEM SET primary_conninfo = 'host=db1 port=5432 user=repl password=''it\''s\\'' application_name=db2'`},
+		{"empty", ChangeMasterOpt{Host: "db1", Port: "5432", User: "repl"}, "",
+			`ALTER SYSTEM SET primary_conninfo = 'host=db1 port=5432 user=repl password='''' application_name=db2'`},
+	}
+	for _, tt := range tests {
+		if stmt := getPostgresPrimaryConnInfoStmt(tt.opt, tt.password, "db2"); stmt != tt.stmt {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, tt.stmt, stmt)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package digest turns the cumulative counters of the performance schema
+// statement digests into the activity of each interval between two
+// snapshots, keeps a baseline of every known digest and reports the digests
+// that depart from it.
+package digest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	KindNew          = "new"
+	KindLatency      = "latency"
+	KindRowsExamined = "rows-examined"
+	KindPlan         = "plan"
+)
+
+const (
+	// intervals averaged by the baseline before it becomes a moving average
+	baselineWindow = 20
+	// regressions below these absolute increases are noise
+	minLatencyIncreaseMs = 1.0
+	minRowsIncrease      = 100.0
+	picoToMs             = 1e9
+)
+
+// Counters are the cumulative counters of a digest in
+// events_statements_summary_by_digest. Buckets are the counts of the latency
+// histogram indexed by the bucket upper bound in picoseconds, only MySQL 8.0.19
+// and newer have it.
+type Counters struct {
+	Schema       string
+	Digest       string
+	Text         string
+	Calls        uint64
+	Latency      uint64
+	RowsExamined uint64
+	RowsSent     uint64
+	Errors       uint64
+	NoIndex      uint64
+	TmpDisk      uint64
+	Buckets      map[uint64]uint64
+}
+
+func Key(schema string, digest string) string {
+	return schema + "/" + digest
+}
+
+func (c Counters) Key() string {
+	return Key(c.Schema, c.Digest)
+}
+
+// Sample is the activity of a digest between two snapshots, percentiles are
+// 0 without histogram
+type Sample struct {
+	Schema       string  `json:"schema"`
+	Digest       string  `json:"digest"`
+	Calls        uint64  `json:"calls"`
+	LatencyMs    float64 `json:"latencyMs"`
+	AvgMs        float64 `json:"avgMs"`
+	P50Ms        float64 `json:"p50Ms,omitempty"`
+	P95Ms        float64 `json:"p95Ms,omitempty"`
+	P99Ms        float64 `json:"p99Ms,omitempty"`
+	RowsExamined uint64  `json:"rowsExamined"`
+	RowsSent     uint64  `json:"rowsSent"`
+	Errors       uint64  `json:"errors"`
+	NoIndex      uint64  `json:"noIndex"`
+	TmpDisk      uint64  `json:"tmpDisk"`
+}
+
+func (s Sample) Key() string {
+	return Key(s.Schema, s.Digest)
+}
+
+func (s Sample) RowsPerCall() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.RowsExamined) / float64(s.Calls)
+}
+
+// Snapshot is the activity of the digests called in an interval of Seconds
+// ending at Time
+type Snapshot struct {
+	Time    time.Time `json:"time"`
+	Seconds float64   `json:"seconds"`
+	Samples []Sample  `json:"samples"`
+}
+
+// Statement is a digest known on a server with the baseline of its activity
+// per call, Plan is the signature of its last explain
+type Statement struct {
+	Schema      string    `json:"schema"`
+	Digest      string    `json:"digest"`
+	Text        string    `json:"text"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Samples     int       `json:"samples"`
+	AvgMs       float64   `json:"avgMs"`
+	RowsPerCall float64   `json:"rowsPerCall"`
+	Plan        string    `json:"plan,omitempty"`
+}
+
+// Regression is a digest which activity departs from its baseline
+type Regression struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Schema   string    `json:"schema"`
+	Digest   string    `json:"digest"`
+	Text     string    `json:"text"`
+	Baseline float64   `json:"baseline,omitempty"`
+	Value    float64   `json:"value,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+	Current  string    `json:"current,omitempty"`
+}
+
+func (r Regression) String() string {
+	text := r.Text
+	if len(text) > 64 {
+		text = text[:64] + "..."
+	}
+	switch r.Kind {
+	case KindNew:
+		return fmt.Sprintf("new digest %s %s", r.Digest, text)
+	case KindLatency:
+		return fmt.Sprintf("latency %.2fms over %.2fms of %s %s", r.Value, r.Baseline, r.Digest, text)
+	case KindRowsExamined:
+		return fmt.Sprintf("rows examined %.0f over %.0f of %s %s", r.Value, r.Baseline, r.Digest, text)
+	case KindPlan:
+		return fmt.Sprintf("plan changed from %s to %s of %s %s", r.Previous, r.Current, r.Digest, text)
+	}
+	return r.Kind + " " + r.Digest
+}
+
+// Tracker compute the snapshots of a server and compare them to the baseline
+// of the statements. A digest is compared once its baseline has MinSamples
+// intervals and when it has MinCalls calls in the interval.
+type Tracker struct {
+	Factor      float64
+	MinCalls    uint64
+	MinSamples  int
+	Expire      time.Duration
+	Statements  map[string]*Statement
+	Regressions []Regression
+	last        map[string]Counters
+	lastTime    time.Time
+}
+
+func NewTracker(factor float64, expire time.Duration) *Tracker {
+	return &Tracker{
+		Factor:     factor,
+		MinCalls:   10,
+		MinSamples: 5,
+		Expire:     expire,
+		Statements: make(map[string]*Statement),
+	}
+}
+
+func delta(cur uint64, prev uint64, reset bool) uint64 {
+	if reset || cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// Percentile return the upper bound in ms of the bucket holding the
+// percentile p of the calls
+func Percentile(buckets map[uint64]uint64, p float64) float64 {
+	var bounds []uint64
+	var total uint64
+	for b, n := range buckets {
+		if n > 0 {
+			bounds = append(bounds, b)
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	rank := p * float64(total)
+	var count uint64
+	for _, b := range bounds {
+		count += buckets[b]
+		if float64(count) >= rank {
+			return float64(b) / picoToMs
+		}
+	}
+	return float64(bounds[len(bounds)-1]) / picoToMs
+}
+
+// sample return the activity of a digest since its previous counters, a
+// digest absent from the previous snapshot or with lower counters after a
+// truncate of the summary counts from zero
+func sample(cur Counters, prev Counters, found bool) Sample {
+	reset := !found || cur.Calls < prev.Calls
+	s := Sample{
+		Schema:       cur.Schema,
+		Digest:       cur.Digest,
+		Calls:        delta(cur.Calls, prev.Calls, reset),
+		LatencyMs:    float64(delta(cur.Latency, prev.Latency, reset)) / picoToMs,
+		RowsExamined: delta(cur.RowsExamined, prev.RowsExamined, reset),
+		RowsSent:     delta(cur.RowsSent, prev.RowsSent, reset),
+		Errors:       delta(cur.Errors, prev.Errors, reset),
+		NoIndex:      delta(cur.NoIndex, prev.NoIndex, reset),
+		TmpDisk:      delta(cur.TmpDisk, prev.TmpDisk, reset),
+	}
+	if s.Calls > 0 {
+		s.AvgMs = s.LatencyMs / float64(s.Calls)
+	}
+	if len(cur.Buckets) > 0 {
+		buckets := make(map[uint64]uint64)
+		for b, n := range cur.Buckets {
+			buckets[b] = delta(n, prev.Buckets[b], reset)
+		}
+		s.P50Ms = Percentile(buckets, 0.50)
+		s.P95Ms = Percentile(buckets, 0.95)
+		s.P99Ms = Percentile(buckets, 0.99)
+	}
+	return s
+}
+
+func (t *Tracker) regression(now time.Time, kind string, st *Statement) Regression {
+	return Regression{Time: now, Kind: kind, Schema: st.Schema, Digest: st.Digest, Text: st.Text}
+}
+
+// Update return the snapshot of the activity since the previous counters and
+// the regressions found in it. The first update after a start is a warm-up
+// that only records the counters and the digests and return a nil snapshot.
+func (t *Tracker) Update(now time.Time, counters map[string]Counters) (*Snapshot, []Regression) {
+	var snap *Snapshot
+	var regressions []Regression
+	warmup := t.last == nil
+	if !warmup {
+		snap = &Snapshot{Time: now, Seconds: now.Sub(t.lastTime).Seconds()}
+	}
+	for key, cur := range counters {
+		st, known := t.Statements[key]
+		if !known {
+			st = &Statement{Schema: cur.Schema, Digest: cur.Digest, Text: cur.Text, FirstSeen: now}
+			t.Statements[key] = st
+			if !warmup {
+				regressions = append(regressions, t.regression(now, KindNew, st))
+			}
+		}
+		if warmup {
+			st.LastSeen = now
+			continue
+		}
+		prev, found := t.last[key]
+		s := sample(cur, prev, found)
+		if s.Calls == 0 {
+			continue
+		}
+		st.LastSeen = now
+		snap.Samples = append(snap.Samples, s)
+		if known && st.Samples >= t.MinSamples && s.Calls >= t.MinCalls {
+			if st.AvgMs > 0 && s.AvgMs > t.Factor*st.AvgMs && s.AvgMs-st.AvgMs >= minLatencyIncreaseMs {
+				r := t.regression(now, KindLatency, st)
+				r.Baseline, r.Value = st.AvgMs, s.AvgMs
+				regressions = append(regressions, r)
+			}
+			if rows := s.RowsPerCall(); rows > t.Factor*st.RowsPerCall && rows-st.RowsPerCall >= minRowsIncrease {
+				r := t.regression(now, KindRowsExamined, st)
+				r.Baseline, r.Value = st.RowsPerCall, rows
+				regressions = append(regressions, r)
+			}
+		}
+		// running mean over the first intervals then moving average
+		n := st.Samples + 1
+		if n > baselineWindow {
+			n = baselineWindow
+		}
+		st.AvgMs += (s.AvgMs - st.AvgMs) / float64(n)
+		st.RowsPerCall += (s.RowsPerCall() - st.RowsPerCall) / float64(n)
+		st.Samples++
+	}
+	if t.Expire > 0 {
+		for key, st := range t.Statements {
+			if now.Sub(st.LastSeen) > t.Expire {
+				delete(t.Statements, key)
+			}
+		}
+	}
+	if snap != nil {
+		sort.Slice(snap.Samples, func(i, j int) bool { return snap.Samples[i].LatencyMs > snap.Samples[j].LatencyMs })
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		return regressions[i].Kind+regressions[i].Digest < regressions[j].Kind+regressions[j].Digest
+	})
+	t.last = counters
+	t.lastTime = now
+	t.Regressions = regressions
+	return snap, regressions
+}
+
+// SetPlan record the plan signature of a statement, a change of a known plan
+// is a regression added to the ones of the last update
+func (t *Tracker) SetPlan(now time.Time, key string, plan string) *Regression {
+	st, ok := t.Statements[key]
+	if !ok || plan == "" || st.Plan == plan {
+		return nil
+	}
+	previous := st.Plan
+	st.Plan = plan
+	if previous == "" {
+		return nil
+	}
+	r := t.regression(now, KindPlan, st)
+	r.Previous, r.Current = previous, plan
+	t.Regressions = append(t.Regressions, r)
+	return &r
+}
+
+// Point is the activity of a digest in one snapshot
+type Point struct {
+	Time         time.Time `json:"time"`
+	Calls        uint64    `json:"calls"`
+	CallsPerSec  float64   `json:"callsPerSec"`
+	AvgMs        float64   `json:"avgMs"`
+	P50Ms        float64   `json:"p50Ms,omitempty"`
+	P95Ms        float64   `json:"p95Ms,omitempty"`
+	P99Ms        float64   `json:"p99Ms,omitempty"`
+	RowsExamined float64   `json:"rowsExaminedPerCall"`
+	RowsSent     float64   `json:"rowsSentPerCall"`
+	Errors       uint64    `json:"errors"`
+}
+
+// Trend is the series of points of a digest with its totals over the period
+type Trend struct {
+	Statement
+	Calls     uint64  `json:"calls"`
+	LatencyMs float64 `json:"latencyMs"`
+	Points    []Point `json:"points"`
+}
+
+// Trends group the samples of the snapshots by digest, the most time
+// consuming first. Digests no longer known only have their schema and digest.
+func Trends(snapshots []Snapshot, statements map[string]*Statement) []Trend {
+	trends := make(map[string]*Trend)
+	for _, snap := range snapshots {
+		for _, s := range snap.Samples {
+			tr, ok := trends[s.Key()]
+			if !ok {
+				tr = &Trend{Statement: Statement{Schema: s.Schema, Digest: s.Digest}}
+				if st, ok := statements[s.Key()]; ok {
+					tr.Statement = *st
+				}
+				trends[s.Key()] = tr
+			}
+			p := Point{Time: snap.Time, Calls: s.Calls, AvgMs: s.AvgMs, P50Ms: s.P50Ms, P95Ms: s.P95Ms, P99Ms: s.P99Ms, RowsExamined: s.RowsPerCall(), Errors: s.Errors}
+			if snap.Seconds > 0 {
+				p.CallsPerSec = float64(s.Calls) / snap.Seconds
+			}
+			if s.Calls > 0 {
+				p.RowsSent = float64(s.RowsSent) / float64(s.Calls)
+			}
+			tr.Points = append(tr.Points, p)
+			tr.Calls += s.Calls
+			tr.LatencyMs += s.LatencyMs
+		}
+	}
+	list := []Trend{}
+	for _, tr := range trends {
+		list = append(list, *tr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LatencyMs > list[j].LatencyMs })
+	return list
+}
@@ -0,0 +1,131 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package digest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// counters of a digest after calls of avgMs each examining rows
+func counters(digest string, calls uint64, avgMs uint64, rows uint64) Counters {
+	return Counters{Schema: "app", Digest: digest, Text: "SELECT * FROM `t` WHERE `id` = ?", Calls: calls, Latency: calls * avgMs * picoToMs, RowsExamined: calls * rows}
+}
+
+func TestPercentile(t *testing.T) {
+	buckets := map[uint64]uint64{1e9: 50, 2e9: 45, 10e9: 4, 100e9: 1}
+	if p := Percentile(buckets, 0.5); p != 1 {
+		t.Errorf("Expected p50 1ms, got %v", p)
+	}
+	if p := Percentile(buckets, 0.95); p != 2 {
+		t.Errorf("Expected p95 2ms, got %v", p)
+	}
+	if p := Percentile(buckets, 0.99); p != 10 {
+		t.Errorf("Expected p99 10ms, got %v", p)
+	}
+	if p := Percentile(map[uint64]uint64{}, 0.99); p != 0 {
+		t.Errorf("Expected 0 without histogram, got %v", p)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(2, 0)
+	now := time.Now()
+	snap, regressions := tr.Update(now, map[string]Counters{"app/a": counters("a", 100, 2, 10)})
+	if snap != nil || len(regressions) != 0 {
+		t.Fatalf("Expected warm-up, got %v %v", snap, regressions)
+	}
+	var calls uint64 = 100
+	for i := 1; i <= 6; i++ {
+		calls += 100
+		snap, regressions = tr.Update(now.Add(time.Duration(i)*time.Minute), map[string]Counters{"app/a": counters("a", calls, 2, 10)})
+		if len(regressions) != 0 {
+			t.Fatalf("Unexpected regressions %v", regressions)
+		}
+	}
+	if len(snap.Samples) != 1 || snap.Samples[0].Calls != 100 || snap.Samples[0].AvgMs != 2 || snap.Seconds != 60 {
+		t.Fatalf("Unexpected snapshot %v", snap)
+	}
+
+	// the next 100 calls take 8ms and examine 1000 rows, and a new digest appears
+	cur := counters("a", calls, 2, 10)
+	cur.Calls += 100
+	cur.Latency += 100 * 8 * picoToMs
+	cur.RowsExamined += 100 * 1000
+	snap, regressions = tr.Update(now.Add(7*time.Minute), map[string]Counters{"app/a": cur, "app/b": counters("b", 5, 1, 1)})
+	if len(regressions) != 3 || regressions[0].Kind != KindLatency || regressions[1].Kind != KindNew || regressions[2].Kind != KindRowsExamined {
+		t.Fatalf("Unexpected regressions %v", regressions)
+	}
+	if regressions[0].Baseline != 2 || regressions[0].Value != 8 {
+		t.Errorf("Unexpected latency regression %v", regressions[0])
+	}
+	if len(snap.Samples) != 2 || snap.Samples[0].Digest != "a" {
+		t.Errorf("Expected the most time consuming sample first, got %v", snap.Samples)
+	}
+
+	// a truncate of the summary counts from zero
+	snap, _ = tr.Update(now.Add(8*time.Minute), map[string]Counters{"app/a": counters("a", 30, 2, 10)})
+	if len(snap.Samples) != 1 || snap.Samples[0].Calls != 30 {
+		t.Errorf("Unexpected snapshot after reset %v", snap.Samples)
+	}
+
+	if r := tr.SetPlan(now, "app/a", "t:ref:idx_id"); r != nil {
+		t.Errorf("First plan is not a regression, got %v", r)
+	}
+	if r := tr.SetPlan(now, "app/a", "t:ALL:"); r == nil || r.Previous != "t:ref:idx_id" || len(tr.Regressions) != 1 {
+		t.Errorf("Expected plan regression, got %v", r)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewStore(dir, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, d := range []int{-10, -1, 0} {
+		err = s.Append(&Snapshot{Time: now.AddDate(0, 0, d), Seconds: 60, Samples: []Sample{{Schema: "app", Digest: "a", Calls: 10, LatencyMs: 20}, {Schema: "app", Digest: "b", Calls: 1, LatencyMs: 50}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots, _ := s.Query(now.AddDate(0, 0, -2), time.Time{}, "a")
+	if len(snapshots) != 2 || len(snapshots[0].Samples) != 1 {
+		t.Fatalf("Expected 2 snapshots of digest a, got %v", snapshots)
+	}
+	if err = s.Purge(now); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, _ = s.Query(time.Time{}, time.Time{}, "")
+	if len(snapshots) != 2 {
+		t.Errorf("Expected 2 snapshots after purge, got %d", len(snapshots))
+	}
+	trends := Trends(snapshots, map[string]*Statement{"app/a": {Schema: "app", Digest: "a", Text: "SELECT 1"}})
+	if len(trends) != 2 || trends[0].Digest != "b" || trends[1].Text != "SELECT 1" || len(trends[1].Points) != 2 || trends[1].Points[0].CallsPerSec != 10.0/60 {
+		t.Errorf("Unexpected trends %v", trends)
+	}
+
+	tr := NewTracker(2, 0)
+	tr.Update(now, map[string]Counters{"app/a": counters("a", 1, 1, 1)})
+	if err = s.SaveStatements(tr.Statements); err != nil {
+		t.Fatal(err)
+	}
+	statements, err := s.LoadStatements()
+	if err != nil || statements["app/a"] == nil || statements["app/a"].Digest != "a" {
+		t.Errorf("Unexpected statements %v %v", statements, err)
+	}
+}
@@ -0,0 +1,180 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package digest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentPrefix  = "snapshots-"
+	segmentSuffix  = ".jsonl"
+	segmentLayout  = "20060102"
+	statementsFile = "statements.json"
+)
+
+// Store keeps the snapshots of a server as JSON lines in one segment file per
+// day, and the known statements with their baseline
+type Store struct {
+	Dir           string
+	RetentionDays int
+	sync.Mutex
+}
+
+func NewStore(dir string, retentionDays int) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Dir: dir, RetentionDays: retentionDays}, nil
+}
+
+// segments return the segment files sorted from the oldest
+func (s *Store) segments() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func segmentDay(file string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), segmentPrefix), segmentSuffix)
+}
+
+// Append write the snapshot to the segment of its day
+func (s *Store) Append(snap *Snapshot) error {
+	s.Lock()
+	defer s.Unlock()
+	line, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.Dir, segmentPrefix+snap.Time.UTC().Format(segmentLayout)+segmentSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Query return the snapshots between since and until, a zero time is not a
+// bound. When digest is set only its samples are kept.
+func (s *Store) Query(since time.Time, until time.Time, digest string) ([]Snapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+	snapshots := []Snapshot{}
+	segments, err := s.segments()
+	if err != nil {
+		return snapshots, err
+	}
+	for _, file := range segments {
+		day := segmentDay(file)
+		if !since.IsZero() && day < since.UTC().Format(segmentLayout) {
+			continue
+		}
+		if !until.IsZero() && day > until.UTC().Format(segmentLayout) {
+			break
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return snapshots, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var snap Snapshot
+			// a truncated last line left by a crash is skipped
+			if json.Unmarshal(scanner.Bytes(), &snap) != nil {
+				continue
+			}
+			if (!since.IsZero() && snap.Time.Before(since)) || (!until.IsZero() && !snap.Time.Before(until)) {
+				continue
+			}
+			if digest != "" {
+				var samples []Sample
+				for _, sample := range snap.Samples {
+					if sample.Digest == digest {
+						samples = append(samples, sample)
+					}
+				}
+				snap.Samples = samples
+			}
+			snapshots = append(snapshots, snap)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return snapshots, err
+		}
+	}
+	return snapshots, nil
+}
+
+// Purge remove the segments older than the retention, 0 keep everything
+func (s *Store) Purge(now time.Time) error {
+	if s.RetentionDays <= 0 {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	limit := now.UTC().AddDate(0, 0, -s.RetentionDays).Format(segmentLayout)
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, file := range segments {
+		if segmentDay(file) >= limit {
+			continue
+		}
+		err = os.Remove(file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadStatements return the statements saved by SaveStatements, empty when
+// the store is new
+func (s *Store) LoadStatements() (map[string]*Statement, error) {
+	s.Lock()
+	defer s.Unlock()
+	statements := make(map[string]*Statement)
+	file, err := ioutil.ReadFile(filepath.Join(s.Dir, statementsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return statements, nil
+		}
+		return statements, err
+	}
+	err = json.Unmarshal(file, &statements)
+	return statements, err
+}
+
+func (s *Store) SaveStatements(statements map[string]*Statement) error {
+	s.Lock()
+	defer s.Unlock()
+	saveJson, err := json.Marshal(statements)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.Dir, statementsFile), saveJson, 0644)
+}
@@ -0,0 +1,371 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package indexadvisor finds the columns a statement filters, joins and
+// sorts each table on, and compares them with the indexes of the table to
+// suggest a missing index or the indexes made redundant by another one.
+package indexadvisor
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/signal18/replication-manager/utils/schemadiff"
+)
+
+const (
+	// columns of a suggested index
+	maxIndexColumns = 5
+	maxIndexName    = 64
+)
+
+// column types that can only be indexed on a prefix
+var unindexableTypes = []string{"tinytext", "text", "mediumtext", "longtext", "tinyblob", "blob", "mediumblob", "longblob", "json", "geometry"}
+
+// Index is a BTREE index of a table, a column indexed on a prefix keeps its
+// length as in name(10)
+type Index struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	Unique     bool     `json:"unique"`
+	Definition string   `json:"definition"`
+}
+
+// Redundancy is an index which columns start the columns of another index
+type Redundancy struct {
+	Index     Index `json:"index"`
+	CoveredBy Index `json:"coveredBy"`
+}
+
+// Access is the use of a table by a statement, the columns compared to a
+// constant or joined, compared to a range and sorted on
+type Access struct {
+	Schema   string   `json:"schema"`
+	Table    string   `json:"table"`
+	Alias    string   `json:"alias,omitempty"`
+	Equality []string `json:"equality"`
+	Range    []string `json:"range"`
+	Order    []string `json:"order"`
+}
+
+// Name return the name of the table in the explain of the statement
+func (a *Access) Name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	return a.Table
+}
+
+func (a *Access) Key() string {
+	return a.Schema + "." + a.Table
+}
+
+type columnRef struct {
+	qualifier string
+	column    string
+}
+
+// Statement is a parsed SELECT, its columns are attributed to the tables by
+// Resolve
+type Statement struct {
+	Tables   []*Access
+	equality []columnRef
+	ranges   []columnRef
+	order    []columnRef
+}
+
+func hasColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendColumn(columns []string, column string) []string {
+	if hasColumn(columns, column) {
+		return columns
+	}
+	return append(columns, column)
+}
+
+// Resolve attribute the columns to the tables of the statement, tables are
+// keyed by schema.table. A column without qualifier belongs to the first
+// table having it, the order is only kept when all its columns belong to
+// the same table.
+func (s *Statement) Resolve(tables map[string]*schemadiff.Table) {
+	find := func(r columnRef) (*Access, string) {
+		for _, a := range s.Tables {
+			if r.qualifier != "" && !strings.EqualFold(r.qualifier, a.Name()) {
+				continue
+			}
+			t, ok := tables[a.Key()]
+			if !ok {
+				continue
+			}
+			for _, c := range t.Columns {
+				if strings.EqualFold(c.Name, r.column) {
+					return a, c.Name
+				}
+			}
+		}
+		return nil, ""
+	}
+	for _, r := range s.equality {
+		if a, c := find(r); a != nil {
+			a.Equality = appendColumn(a.Equality, c)
+		}
+	}
+	for _, r := range s.ranges {
+		if a, c := find(r); a != nil {
+			a.Range = appendColumn(a.Range, c)
+		}
+	}
+	var sorted *Access
+	var order []string
+	for _, r := range s.order {
+		a, c := find(r)
+		if a == nil || (sorted != nil && a != sorted) {
+			return
+		}
+		sorted = a
+		order = appendColumn(order, c)
+	}
+	if sorted != nil {
+		sorted.Order = order
+	}
+}
+
+// columnName strip the prefix length of an index column
+func columnName(column string) string {
+	if i := strings.Index(column, "("); i > 0 {
+		return column[:i]
+	}
+	return column
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "`") && strings.HasSuffix(s, "`") && len(s) > 1 {
+		return strings.Replace(s[1:len(s)-1], "``", "`", -1)
+	}
+	return s
+}
+
+// indexColumns return the columns of the first parenthesis of an index
+// definition, backquoted names may contain any character
+func indexColumns(def string) []string {
+	var columns []string
+	var column strings.Builder
+	depth := 0
+	quoted := false
+	for _, c := range def {
+		switch {
+		case c == '`':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return append(columns, columnDefinition(column.String()))
+			}
+		case c == ',' && depth == 1:
+			columns = append(columns, columnDefinition(column.String()))
+			column.Reset()
+			continue
+		}
+		if depth > 0 {
+			column.WriteRune(c)
+		}
+	}
+	return columns
+}
+
+// columnDefinition turn `name`(10) DESC into name(10)
+func columnDefinition(def string) string {
+	def = strings.TrimSpace(def)
+	length := ""
+	if i := strings.LastIndex(def, "("); i > 0 && strings.HasSuffix(strings.Fields(def[i:])[0], ")") {
+		length = strings.Fields(def[i:])[0]
+		def = def[:i]
+	} else if f := strings.Fields(def); len(f) > 1 && (strings.EqualFold(f[len(f)-1], "ASC") || strings.EqualFold(f[len(f)-1], "DESC")) {
+		def = strings.Join(f[:len(f)-1], " ")
+	}
+	return unquote(def) + length
+}
+
+// TableIndexes return the BTREE indexes of a table, full text and spatial
+// indexes are skipped
+func TableIndexes(t *schemadiff.Table) []Index {
+	var indexes []Index
+	for _, d := range t.Indexes {
+		def := strings.ToUpper(d.Definition)
+		if strings.HasPrefix(def, "FULLTEXT") || strings.HasPrefix(def, "SPATIAL") {
+			continue
+		}
+		indexes = append(indexes, Index{
+			Name:       d.Name,
+			Columns:    indexColumns(d.Definition),
+			Unique:     strings.HasPrefix(def, "PRIMARY") || strings.HasPrefix(def, "UNIQUE"),
+			Definition: d.Definition,
+		})
+	}
+	return indexes
+}
+
+func hasPrefix(columns []string, prefix []string) bool {
+	if len(prefix) > len(columns) {
+		return false
+	}
+	for i := range prefix {
+		if !strings.EqualFold(columns[i], prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Redundant return the non unique indexes starting another index, of two
+// indexes with the same columns the second one is redundant
+func Redundant(indexes []Index) []Redundancy {
+	var redundant []Redundancy
+	for i, a := range indexes {
+		if a.Unique || len(a.Columns) == 0 {
+			continue
+		}
+		for j, b := range indexes {
+			if i == j || !hasPrefix(b.Columns, a.Columns) {
+				continue
+			}
+			if len(a.Columns) == len(b.Columns) && !b.Unique && j > i {
+				continue
+			}
+			redundant = append(redundant, Redundancy{Index: a, CoveredBy: b})
+			break
+		}
+	}
+	return redundant
+}
+
+func indexable(t *schemadiff.Table, column string) bool {
+	for _, c := range t.Columns {
+		if !strings.EqualFold(c.Name, column) {
+			continue
+		}
+		fields := strings.Fields(c.Definition)
+		if len(fields) < 2 {
+			return false
+		}
+		for _, u := range unindexableTypes {
+			if strings.EqualFold(fields[1], u) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Candidate return the columns of the index serving the access, the
+// equality columns first then a range or the sort columns, and the number of
+// equality columns
+func Candidate(a *Access, t *schemadiff.Table) ([]string, int) {
+	var columns []string
+	for _, c := range a.Equality {
+		if len(columns) < maxIndexColumns-1 && indexable(t, c) {
+			columns = appendColumn(columns, c)
+		}
+	}
+	equality := len(columns)
+	for _, c := range a.Range {
+		if indexable(t, c) && !hasColumn(columns, c) {
+			return append(columns, c), equality
+		}
+	}
+	for _, c := range a.Order {
+		if len(columns) >= maxIndexColumns || !indexable(t, c) {
+			break
+		}
+		columns = appendColumn(columns, c)
+	}
+	return columns, equality
+}
+
+// Covered is true when an index starts with the equality columns in any
+// order followed by the other columns of the candidate
+func Covered(columns []string, equality int, indexes []Index) bool {
+	for _, idx := range indexes {
+		if len(idx.Columns) < len(columns) {
+			continue
+		}
+		covered := true
+		for i, c := range columns {
+			if i < equality {
+				found := false
+				for _, ic := range idx.Columns[:equality] {
+					if strings.EqualFold(columnName(ic), c) {
+						found = true
+					}
+				}
+				covered = covered && found
+			} else {
+				covered = covered && strings.EqualFold(columnName(idx.Columns[i]), c)
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexName return a name for an index on columns not used by the indexes
+func IndexName(columns []string, indexes []Index) string {
+	name := "idx_" + strings.ToLower(strings.Join(columns, "_"))
+	if len(name) > maxIndexName-3 {
+		name = name[:maxIndexName-3]
+	}
+	candidate := name
+	for n := 2; ; n++ {
+		used := false
+		for _, idx := range indexes {
+			if strings.EqualFold(idx.Name, candidate) {
+				used = true
+			}
+		}
+		if !used {
+			return candidate
+		}
+		candidate = name + "_" + strconv.Itoa(n)
+	}
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// AddIndex return the ALTER TABLE specification adding the index
+func AddIndex(name string, columns []string) string {
+	var quoted []string
+	for _, c := range columns {
+		quoted = append(quoted, quoteIdentifier(c))
+	}
+	return "ADD INDEX " + quoteIdentifier(name) + " (" + strings.Join(quoted, ",") + ")"
+}
+
+// DropIndex return the ALTER TABLE specification dropping the index
+func DropIndex(name string) string {
+	return "DROP INDEX " + quoteIdentifier(name)
+}
@@ -0,0 +1,92 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package indexadvisor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/schemadiff"
+)
+
+var orders = schemadiff.Parse("CREATE TABLE `orders` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `customer_id` int(11) NOT NULL,\n" +
+	"  `status` varchar(16) NOT NULL,\n" +
+	"  `created` datetime NOT NULL,\n" +
+	"  `note` text,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_status` (`status`),\n" +
+	"  KEY `idx_status_created` (`status`,`created`),\n" +
+	"  KEY `idx_note` (`note`(32)) USING BTREE,\n" +
+	"  FULLTEXT KEY `ft_note` (`note`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=latin1")
+
+var customers = schemadiff.Parse("CREATE TABLE `customers` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `name` varchar(64) NOT NULL,\n" +
+	"  `country` char(2) NOT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=latin1")
+
+func TestTableIndexes(t *testing.T) {
+	indexes := TableIndexes(orders)
+	if len(indexes) != 4 {
+		t.Fatalf("Expected 4 BTREE indexes, got %v", indexes)
+	}
+	if !indexes[0].Unique || indexes[0].Name != "PRIMARY" || !reflect.DeepEqual(indexes[2].Columns, []string{"status", "created"}) || !reflect.DeepEqual(indexes[3].Columns, []string{"note(32)"}) {
+		t.Errorf("Unexpected indexes %v", indexes)
+	}
+	redundant := Redundant(indexes)
+	if len(redundant) != 1 || redundant[0].Index.Name != "idx_status" || redundant[0].CoveredBy.Name != "idx_status_created" {
+		t.Errorf("Unexpected redundant indexes %v", redundant)
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	stmt, err := Parse("SELECT o.id, c.name FROM orders o JOIN customers c ON c.id = o.customer_id WHERE c.country = 'FR' AND o.created > '2021-01-01' AND (o.status = 'new' OR o.status = 'paid') AND o.note LIKE '%gift%' ORDER BY o.created", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt.Resolve(map[string]*schemadiff.Table{"shop.orders": orders, "shop.customers": customers})
+	if len(stmt.Tables) != 2 {
+		t.Fatalf("Expected 2 tables, got %v", stmt.Tables)
+	}
+	o, c := stmt.Tables[0], stmt.Tables[1]
+	if o.Name() != "o" || o.Key() != "shop.orders" || !reflect.DeepEqual(o.Equality, []string{"customer_id"}) || !reflect.DeepEqual(o.Range, []string{"created"}) || !reflect.DeepEqual(o.Order, []string{"created"}) {
+		t.Errorf("Unexpected orders access %+v", o)
+	}
+	if !reflect.DeepEqual(c.Equality, []string{"id", "country"}) {
+		t.Errorf("Unexpected customers access %+v", c)
+	}
+
+	columns, equality := Candidate(o, orders)
+	if !reflect.DeepEqual(columns, []string{"customer_id", "created"}) || equality != 1 {
+		t.Errorf("Unexpected candidate %v %d", columns, equality)
+	}
+	indexes := TableIndexes(orders)
+	if Covered(columns, equality, indexes) {
+		t.Errorf("Candidate %v covered by %v", columns, indexes)
+	}
+	if !Covered([]string{"status", "created"}, 1, indexes) || Covered([]string{"created", "status"}, 1, indexes) {
+		t.Errorf("Unexpected coverage of idx_status_created")
+	}
+	name := IndexName(columns, indexes)
+	if AddIndex(name, columns) != "ADD INDEX `idx_customer_id_created` (`customer_id`,`created`)" {
+		t.Errorf("Unexpected DDL %s", AddIndex(name, columns))
+	}
+	if IndexName([]string{"status"}, indexes) != "idx_status_2" {
+		t.Errorf("Expected a free index name, got %s", IndexName([]string{"status"}, indexes))
+	}
+
+	if _, err := Parse("UPDATE orders SET status = 'paid' WHERE id = 1", "shop"); err == nil {
+		t.Errorf("Expected an error on UPDATE")
+	}
+}
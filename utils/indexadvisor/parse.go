@@ -0,0 +1,128 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package indexadvisor
+
+import (
+	"errors"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+func newColumnRef(col *sqlparser.ColName) columnRef {
+	return columnRef{qualifier: col.Qualifier.Name.String(), column: col.Name.String()}
+}
+
+// addComparison record the column compared to a constant, both columns of
+// a join condition are equality columns of their table
+func (s *Statement) addComparison(n *sqlparser.ComparisonExpr) {
+	left, leftCol := n.Left.(*sqlparser.ColName)
+	right, rightCol := n.Right.(*sqlparser.ColName)
+	operator := n.Operator
+	if !leftCol && rightCol {
+		left, right, leftCol, rightCol = right, left, true, false
+		switch operator {
+		case "<":
+			operator = ">"
+		case ">":
+			operator = "<"
+		case "<=":
+			operator = ">="
+		case ">=":
+			operator = "<="
+		}
+	}
+	if !leftCol {
+		return
+	}
+	switch operator {
+	case "=", "<=>", "in":
+		s.equality = append(s.equality, newColumnRef(left))
+		if rightCol && operator != "in" {
+			s.equality = append(s.equality, newColumnRef(right))
+		}
+	case "<", ">", "<=", ">=":
+		if !rightCol {
+			s.ranges = append(s.ranges, newColumnRef(left))
+		}
+	case "like":
+		// only a constant prefix can use an index
+		if val, ok := n.Right.(*sqlparser.SQLVal); ok && len(val.Val) > 0 && val.Val[0] != '%' && val.Val[0] != '_' {
+			s.ranges = append(s.ranges, newColumnRef(left))
+		}
+	}
+}
+
+// Parse return the tables of a SELECT with the columns of its WHERE, join
+// conditions and ORDER BY, schema is the default database of the statement.
+// Conditions under OR or NOT and subqueries are ignored.
+func Parse(query string, schema string) (*Statement, error) {
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, errors.New("Not a SELECT statement")
+	}
+	s := &Statement{}
+	visit := func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case *sqlparser.Subquery, *sqlparser.OrExpr, *sqlparser.NotExpr:
+			return false, nil
+		case *sqlparser.AliasedTableExpr:
+			name, ok := n.Expr.(sqlparser.TableName)
+			if !ok {
+				return false, nil
+			}
+			a := &Access{Schema: schema, Table: name.Name.String(), Alias: n.As.String()}
+			if !name.Qualifier.IsEmpty() {
+				a.Schema = name.Qualifier.String()
+			}
+			s.Tables = append(s.Tables, a)
+			return false, nil
+		case *sqlparser.ComparisonExpr:
+			s.addComparison(n)
+			return false, nil
+		case *sqlparser.RangeCond:
+			if col, ok := n.Left.(*sqlparser.ColName); ok && n.Operator == "between" {
+				s.ranges = append(s.ranges, newColumnRef(col))
+			}
+			return false, nil
+		case *sqlparser.IsExpr:
+			if col, ok := n.Expr.(*sqlparser.ColName); ok && n.Operator == "is null" {
+				s.equality = append(s.equality, newColumnRef(col))
+			}
+			return false, nil
+		}
+		return true, nil
+	}
+	err = sqlparser.Walk(visit, sel.From)
+	if err != nil {
+		return nil, err
+	}
+	if sel.Where != nil {
+		err = sqlparser.Walk(visit, sel.Where)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range sel.OrderBy {
+		col, ok := o.Expr.(*sqlparser.ColName)
+		if !ok {
+			s.order = nil
+			break
+		}
+		s.order = append(s.order, newColumnRef(col))
+	}
+	if len(s.Tables) == 0 {
+		return nil, errors.New("No table in statement")
+	}
+	return s, nil
+}
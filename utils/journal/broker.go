@@ -0,0 +1,78 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// broker.go
+
+package journal
+
+import "sync"
+
+// Subscription receive the live events matching its filter, a subscriber too
+// slow to drain C lose events rather than block the monitor, Dropped count them
+type Subscription struct {
+	C       chan Event
+	Filter  Filter
+	Dropped int64
+	broker  *Broker
+}
+
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// Broker fan out published events to live subscribers
+type Broker struct {
+	subscribers map[*Subscription]bool
+	sync.Mutex
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[*Subscription]bool)}
+}
+
+// Subscribe register a subscriber, Limit and After of the filter are ignored
+func (b *Broker) Subscribe(f Filter, size int) *Subscription {
+	f.Limit = 0
+	f.After = 0
+	s := &Subscription{C: make(chan Event, size), Filter: f, broker: b}
+	b.Lock()
+	b.subscribers[s] = true
+	b.Unlock()
+	return s
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.Lock()
+	defer b.Unlock()
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.C)
+	}
+}
+
+func (b *Broker) Publish(e Event) {
+	b.Lock()
+	defer b.Unlock()
+	for s := range b.subscribers {
+		if !s.Filter.Match(e) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			s.Dropped++
+		}
+	}
+}
+
+func (b *Broker) CountSubscribers() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.subscribers)
+}
@@ -0,0 +1,274 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package journal keeps an append-only history of cluster events on disk. Events
+// are written as JSON lines in one segment file per day so that retention only
+// has to drop whole files, and the history survives monitor restarts.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConstEventStateOpen  string = "state-open"
+	ConstEventStateClose string = "state-close"
+	ConstEventFailover   string = "failover"
+	ConstEventSwitchover string = "switchover"
+	ConstEventRejoin     string = "rejoin"
+	ConstEventProxy      string = "proxy"
+	ConstEventApi        string = "api"
+	ConstEventTopology   string = "topology"
+	ConstEventJob        string = "job"
+	ConstEventSchema     string = "schema"
+	ConstEventQuery      string = "query"
+)
+
+const (
+	segmentPrefix = "events-"
+	segmentSuffix = ".jsonl"
+	segmentLayout = "20060102"
+)
+
+// Event is one journal entry, Id is increasing across segments and is used as
+// a paging cursor
+type Event struct {
+	Id        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Cluster   string    `json:"cluster"`
+	Type      string    `json:"type"`
+	Code      string    `json:"code,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// Filter select events, empty fields match everything. Type and Server accept
+// a comma separated list.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	After  int64
+	Type   string
+	Server string
+	Limit  int
+}
+
+func matchList(list string, value string) bool {
+	if list == "" {
+		return true
+	}
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) Match(e Event) bool {
+	if f.After > 0 && e.Id <= f.After {
+		return false
+	}
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Timestamp.Before(f.Until) {
+		return false
+	}
+	return matchList(f.Type, e.Type) && matchList(f.Server, e.Server)
+}
+
+type Journal struct {
+	Dir           string
+	RetentionDays int
+	seq           int64
+	file          *os.File
+	day           string
+	sync.Mutex
+}
+
+// NewJournal open the journal stored in dir and restore the event sequence
+// from the last segment
+func NewJournal(dir string, retentionDays int) (*Journal, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{Dir: dir, RetentionDays: retentionDays}
+	segments, err := j.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		err = j.scan(segments[len(segments)-1], func(e Event) bool {
+			if e.Id > j.seq {
+				j.seq = e.Id
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// segments return the segment files sorted from the oldest
+func (j *Journal) segments() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(j.Dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func segmentDay(file string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), segmentPrefix), segmentSuffix)
+}
+
+// scan decode each line of a segment until fn return false, a truncated last
+// line left by a crash is skipped
+func (j *Journal) scan(file string, fn func(e Event) bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Append write the event to the segment of the day and return it with its Id
+func (j *Journal) Append(e Event) (Event, error) {
+	j.Lock()
+	defer j.Unlock()
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	day := e.Timestamp.UTC().Format(segmentLayout)
+	if j.file == nil || j.day != day {
+		if j.file != nil {
+			j.file.Close()
+		}
+		f, err := os.OpenFile(filepath.Join(j.Dir, segmentPrefix+day+segmentSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			j.file = nil
+			return e, err
+		}
+		j.file = f
+		j.day = day
+	}
+	j.seq++
+	e.Id = j.seq
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	_, err = j.file.Write(append(line, '\n'))
+	return e, err
+}
+
+// Query return at most Limit events matching the filter in Id order. The
+// segments are listed under the lock and scanned without it so that a long
+// query does not hold the appends, events appended meanwhile are left to the
+// next query.
+func (j *Journal) Query(f Filter) ([]Event, error) {
+	j.Lock()
+	seq := j.seq
+	segments, err := j.segments()
+	j.Unlock()
+	events := []Event{}
+	if err != nil {
+		return events, err
+	}
+	for _, file := range segments {
+		day := segmentDay(file)
+		if !f.Since.IsZero() && day < f.Since.UTC().Format(segmentLayout) {
+			continue
+		}
+		if !f.Until.IsZero() && day > f.Until.UTC().Format(segmentLayout) {
+			break
+		}
+		err = j.scan(file, func(e Event) bool {
+			if e.Id > seq {
+				return false
+			}
+			if f.Match(e) {
+				events = append(events, e)
+			}
+			return f.Limit <= 0 || len(events) < f.Limit
+		})
+		// a segment removed by the retention meanwhile
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return events, err
+		}
+		if f.Limit > 0 && len(events) >= f.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// Purge remove the segments older than the retention, 0 keep everything
+func (j *Journal) Purge(now time.Time) error {
+	if j.RetentionDays <= 0 {
+		return nil
+	}
+	j.Lock()
+	defer j.Unlock()
+	limit := now.UTC().AddDate(0, 0, -j.RetentionDays).Format(segmentLayout)
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+	for _, file := range segments {
+		day := segmentDay(file)
+		if day >= limit || day == j.day {
+			continue
+		}
+		err = os.Remove(file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,122 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := NewJournal(dir, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	old := now.AddDate(0, 0, -10)
+	j.Append(Event{Timestamp: old, Cluster: "c1", Type: ConstEventStateOpen, Code: "ERR00012", Server: "db1:3306"})
+	j.Append(Event{Timestamp: now, Cluster: "c1", Type: ConstEventFailover, Message: "Failover started"})
+	j.Append(Event{Timestamp: now, Cluster: "c1", Type: ConstEventStateClose, Code: "ERR00012", Server: "db1:3306"})
+	j.Close()
+
+	// reopen to check the sequence survives a restart
+	j, err = NewJournal(dir, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := j.Append(Event{Timestamp: now, Cluster: "c1", Type: ConstEventApi, User: "admin"})
+	if err != nil || e.Id != 4 {
+		t.Fatalf("Expected event id 4, got %d %v", e.Id, err)
+	}
+	events, _ := j.Query(Filter{Server: "db1:3306"})
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 server events, got %d", len(events))
+	}
+	events, _ = j.Query(Filter{After: 1, Limit: 2})
+	if len(events) != 2 || events[0].Id != 2 {
+		t.Fatalf("Expected page starting at id 2, got %v", events)
+	}
+	events, _ = j.Query(Filter{Since: now.Add(-time.Hour), Type: "state-open,state-close"})
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 recent state event, got %d", len(events))
+	}
+	if err = j.Purge(now); err != nil {
+		t.Fatal(err)
+	}
+	events, _ = j.Query(Filter{})
+	if len(events) != 3 {
+		t.Fatalf("Expected old segment purged, got %d events", len(events))
+	}
+	j.Close()
+}
+
+// TestJournalQueryAppend query while events are appended, every page is a
+// gapless prefix of the journal
+func TestJournalQueryAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := NewJournal(dir, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 500; i++ {
+			j.Append(Event{Cluster: "c1", Type: ConstEventJob, Message: "backup-done"})
+		}
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		events, err := j.Query(Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range events {
+			if e.Id != int64(i+1) {
+				t.Fatalf("Expected event id %d, got %d", i+1, e.Id)
+			}
+		}
+	}
+	if events, _ := j.Query(Filter{}); len(events) != 500 {
+		t.Fatalf("Expected 500 events, got %d", len(events))
+	}
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(Filter{Type: ConstEventFailover}, 1)
+	b.Publish(Event{Type: ConstEventStateOpen})
+	b.Publish(Event{Type: ConstEventFailover, Code: "start"})
+	b.Publish(Event{Type: ConstEventFailover, Code: "elect"})
+	e := <-s.C
+	if e.Code != "start" || s.Dropped != 1 {
+		t.Fatalf("Expected start event and 1 dropped, got %s %d", e.Code, s.Dropped)
+	}
+	s.Close()
+	if _, ok := <-s.C; ok || b.CountSubscribers() != 0 {
+		t.Fatal("Expected subscription closed")
+	}
+}
@@ -0,0 +1,203 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package schemadiff compares the SHOW CREATE TABLE of a table on different
+// servers. Definitions are normalized so that the output of different MariaDB
+// and MySQL versions compare equal when the table is the same.
+package schemadiff
+
+import (
+	"fmt"
+	"hash/crc64"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	KindTable       = "table"
+	KindColumn      = "column"
+	KindColumnOrder = "column-order"
+	KindIndex       = "index"
+	KindConstraint  = "constraint"
+	KindEngine      = "engine"
+	KindOptions     = "options"
+)
+
+var (
+	autoIncrementRegexp  = regexp.MustCompile(`\s*AUTO_INCREMENT=\d+`)
+	engineRegexp         = regexp.MustCompile(`ENGINE=(\w+)`)
+	intWidthRegexp       = regexp.MustCompile(`\b(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+	versionCommentRegexp = regexp.MustCompile(`/\*!\d*\s*(.*?)\s*\*/`)
+	crc64Table           = crc64.MakeTable(crc64.ECMA)
+)
+
+// Definition is a named column, index or constraint
+type Definition struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// Table is a parsed SHOW CREATE TABLE
+type Table struct {
+	Columns     []Definition `json:"columns"`
+	Indexes     []Definition `json:"indexes"`
+	Constraints []Definition `json:"constraints"`
+	Engine      string       `json:"engine"`
+	Options     string       `json:"options"`
+}
+
+// Difference is a definition that is not the same on the source and the
+// target, empty on the side missing it
+type Difference struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Source == "":
+		return fmt.Sprintf("extra %s %s", d.Kind, d.Name)
+	case d.Target == "":
+		return fmt.Sprintf("missing %s %s", d.Kind, d.Name)
+	}
+	return fmt.Sprintf("%s %s", d.Kind, d.Name)
+}
+
+func normalize(def string) string {
+	def = strings.TrimSuffix(strings.TrimSpace(def), ",")
+	def = versionCommentRegexp.ReplaceAllString(def, "$1")
+	// display width is dropped by MySQL 8.0.19 and utf8 renamed utf8mb3
+	def = intWidthRegexp.ReplaceAllString(def, "$1")
+	def = strings.Replace(def, "utf8mb3", "utf8", -1)
+	return strings.Join(strings.Fields(def), " ")
+}
+
+// quotedName return the first backquoted identifier of s
+func quotedName(s string) string {
+	start := strings.Index(s, "`")
+	if start < 0 {
+		return ""
+	}
+	var name strings.Builder
+	for i := start + 1; i < len(s); i++ {
+		if s[i] == '`' {
+			if i+1 < len(s) && s[i+1] == '`' {
+				name.WriteByte('`')
+				i++
+				continue
+			}
+			break
+		}
+		name.WriteByte(s[i])
+	}
+	return name.String()
+}
+
+// Parse split a SHOW CREATE TABLE in columns, indexes, constraints, engine
+// and table options, the AUTO_INCREMENT counter is ignored
+func Parse(ddl string) *Table {
+	t := &Table{}
+	lines := strings.Split(strings.TrimSpace(ddl), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case i == 0 || line == "":
+			continue
+		case strings.HasPrefix(line, ")"):
+			options := strings.TrimPrefix(strings.Join(lines[i:], " "), ")")
+			options = autoIncrementRegexp.ReplaceAllString(options, "")
+			if m := engineRegexp.FindStringSubmatch(options); m != nil {
+				t.Engine = m[1]
+				options = strings.Replace(options, m[0], "", 1)
+			}
+			t.Options = normalize(options)
+			return t
+		case strings.HasPrefix(line, "`"):
+			t.Columns = append(t.Columns, Definition{Name: quotedName(line), Definition: normalize(line)})
+		case strings.HasPrefix(line, "PRIMARY KEY"):
+			t.Indexes = append(t.Indexes, Definition{Name: "PRIMARY", Definition: normalize(line)})
+		case strings.HasPrefix(line, "CONSTRAINT"):
+			t.Constraints = append(t.Constraints, Definition{Name: quotedName(line), Definition: normalize(line)})
+		default:
+			t.Indexes = append(t.Indexes, Definition{Name: quotedName(line), Definition: normalize(line)})
+		}
+	}
+	return t
+}
+
+// String return the normalized definition, indexes and constraints sorted
+func (t *Table) String() string {
+	var lines []string
+	for _, c := range t.Columns {
+		lines = append(lines, c.Definition)
+	}
+	for _, defs := range [][]Definition{t.Indexes, t.Constraints} {
+		var sorted []string
+		for _, d := range defs {
+			sorted = append(sorted, d.Definition)
+		}
+		sort.Strings(sorted)
+		lines = append(lines, sorted...)
+	}
+	return "(\n  " + strings.Join(lines, ",\n  ") + "\n) ENGINE=" + t.Engine + " " + t.Options
+}
+
+// Checksum identify a version of the normalized definition
+func (t *Table) Checksum() string {
+	return fmt.Sprintf("%016x", crc64.Checksum([]byte(t.String()), crc64Table))
+}
+
+func compareDefinitions(kind string, source []Definition, target []Definition) []Difference {
+	var diffs []Difference
+	targets := make(map[string]string)
+	for _, d := range target {
+		targets[d.Name] = d.Definition
+	}
+	sources := make(map[string]bool)
+	for _, d := range source {
+		sources[d.Name] = true
+		if def, ok := targets[d.Name]; !ok || def != d.Definition {
+			diffs = append(diffs, Difference{Kind: kind, Name: d.Name, Source: d.Definition, Target: def})
+		}
+	}
+	for _, d := range target {
+		if !sources[d.Name] {
+			diffs = append(diffs, Difference{Kind: kind, Name: d.Name, Target: d.Definition})
+		}
+	}
+	return diffs
+}
+
+func columnNames(columns []Definition) string {
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Compare return the differences of the target with the source
+func Compare(source *Table, target *Table) []Difference {
+	diffs := compareDefinitions(KindColumn, source.Columns, target.Columns)
+	if len(diffs) == 0 && columnNames(source.Columns) != columnNames(target.Columns) {
+		diffs = append(diffs, Difference{Kind: KindColumnOrder, Source: columnNames(source.Columns), Target: columnNames(target.Columns)})
+	}
+	diffs = append(diffs, compareDefinitions(KindIndex, source.Indexes, target.Indexes)...)
+	diffs = append(diffs, compareDefinitions(KindConstraint, source.Constraints, target.Constraints)...)
+	if source.Engine != target.Engine {
+		diffs = append(diffs, Difference{Kind: KindEngine, Source: source.Engine, Target: target.Engine})
+	}
+	if source.Options != target.Options {
+		diffs = append(diffs, Difference{Kind: KindOptions, Source: source.Options, Target: target.Options})
+	}
+	return diffs
+}
@@ -0,0 +1,108 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package schemadiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+const mariadbOrders = "CREATE TABLE `orders` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `customer` varchar(64) CHARACTER SET utf8mb3 DEFAULT NULL,\n" +
+	"  `total` decimal(10,2) NOT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_customer` (`customer`),\n" +
+	"  CONSTRAINT `fk_customer` FOREIGN KEY (`customer`) REFERENCES `customers` (`name`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=1204 DEFAULT CHARSET=latin1\n" +
+	"/*!50100 PARTITION BY HASH (`id`)\nPARTITIONS 4 */"
+
+const mysqlOrders = "CREATE TABLE `orders` (\n" +
+	"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+	"  `customer` varchar(64) CHARACTER SET utf8 DEFAULT NULL,\n" +
+	"  `total` decimal(10,2) NOT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  CONSTRAINT `fk_customer` FOREIGN KEY (`customer`) REFERENCES `customers` (`name`),\n" +
+	"  KEY `idx_customer` (`customer`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=98 DEFAULT CHARSET=latin1\n" +
+	"/*!50100 PARTITION BY HASH (`id`)\nPARTITIONS 4 */"
+
+const driftOrders = "CREATE TABLE `orders` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `total` decimal(12,2) NOT NULL,\n" +
+	"  `customer` varchar(64) DEFAULT NULL,\n" +
+	"  `discount` decimal(5,2) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_total` (`total`)\n" +
+	") ENGINE=MyISAM DEFAULT CHARSET=latin1"
+
+func TestParse(t *testing.T) {
+	table := Parse(mariadbOrders)
+	if len(table.Columns) != 3 || table.Columns[1].Name != "customer" {
+		t.Fatalf("Unexpected columns %v", table.Columns)
+	}
+	if table.Columns[0].Definition != "`id` int NOT NULL AUTO_INCREMENT" {
+		t.Errorf("Unexpected column definition %q", table.Columns[0].Definition)
+	}
+	if len(table.Indexes) != 2 || table.Indexes[0].Name != "PRIMARY" || table.Indexes[1].Name != "idx_customer" {
+		t.Errorf("Unexpected indexes %v", table.Indexes)
+	}
+	if len(table.Constraints) != 1 || table.Constraints[0].Name != "fk_customer" {
+		t.Errorf("Unexpected constraints %v", table.Constraints)
+	}
+	if table.Engine != "InnoDB" || table.Options != "DEFAULT CHARSET=latin1 PARTITION BY HASH (`id`) PARTITIONS 4" {
+		t.Errorf("Unexpected engine %q options %q", table.Engine, table.Options)
+	}
+	if quotedName("KEY `a``b` (`a``b`)") != "a`b" {
+		t.Errorf("Escaped backquote not unquoted")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	mariadb, mysql := Parse(mariadbOrders), Parse(mysqlOrders)
+	if diffs := Compare(mariadb, mysql); len(diffs) != 0 {
+		t.Errorf("Same table on MariaDB and MySQL differ: %v", diffs)
+	}
+	if mariadb.Checksum() != mysql.Checksum() {
+		t.Errorf("Same table has checksums %s and %s", mariadb.Checksum(), mysql.Checksum())
+	}
+}
+
+func TestCompareDrift(t *testing.T) {
+	source, target := Parse(mariadbOrders), Parse(driftOrders)
+	diffs := Compare(source, target)
+	var got []string
+	for _, d := range diffs {
+		got = append(got, d.String())
+	}
+	expected := []string{
+		"column customer",
+		"column total",
+		"extra column discount",
+		"missing index idx_customer",
+		"extra index idx_total",
+		"missing constraint fk_customer",
+		"engine ",
+		"options ",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if source.Checksum() == target.Checksum() {
+		t.Errorf("Drifted table has the same checksum")
+	}
+
+	// same columns in another order
+	reordered := Parse("CREATE TABLE `orders` (\n  `total` decimal(10,2) NOT NULL,\n  `id` int(11) NOT NULL AUTO_INCREMENT,\n  `customer` varchar(64) CHARACTER SET utf8mb3 DEFAULT NULL,\n  PRIMARY KEY (`id`),\n  KEY `idx_customer` (`customer`),\n  CONSTRAINT `fk_customer` FOREIGN KEY (`customer`) REFERENCES `customers` (`name`)\n) ENGINE=InnoDB DEFAULT CHARSET=latin1\n/*!50100 PARTITION BY HASH (`id`)\nPARTITIONS 4 */")
+	diffs = Compare(source, reordered)
+	if len(diffs) != 1 || diffs[0].Kind != KindColumnOrder || diffs[0].Target != "total,id,customer" {
+		t.Errorf("Unexpected column order difference %v", diffs)
+	}
+}
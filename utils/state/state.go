@@ -391,6 +391,20 @@ func (SM *StateMachine) GetOpenWarnings() []StateHttp {
 	return log
 }
 
+// GetOpenErrorsAndWarnings return a copy of the open errors and warnings with
+// the server they were raised for
+func (SM *StateMachine) GetOpenErrorsAndWarnings() []State {
+	var states []State
+	SM.Lock()
+	for key, value := range *SM.OldState {
+		value.ErrKey = key
+		states = append(states, value)
+	}
+	SM.Unlock()
+	sort.SliceStable(states, func(i, j int) bool { return states[i].ErrKey < states[j].ErrKey })
+	return states
+}
+
 func (SM *StateMachine) CopyOldStateFromUnknowServer(Url string) {
 
 	for key, value := range *SM.OldState {
@@ -0,0 +1,176 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultPartSize keep the 10000 parts of a multipart upload above 150GB
+const DefaultPartSize = 16 * 1024 * 1024
+
+// BlobBackend is the object store API behind a Blob, S3 or Azure blob
+type BlobBackend interface {
+	Put(key string, body io.ReadSeeker, size int64) error
+	Get(key string) (io.ReadCloser, error)
+	Head(key string) (*Object, error)
+	// List return a page of keys starting by prefix and the token of the
+	// next page, empty on the last one
+	List(prefix string, token string) ([]Object, string, error)
+	Copy(from string, to string) error
+	Delete(key string) error
+	MultipartBegin(key string) (BlobUpload, error)
+}
+
+// BlobUpload is a multipart upload in progress, parts are numbered from 1
+type BlobUpload interface {
+	Add(part uint32, body io.ReadSeeker, size int64, last bool) error
+	Commit() error
+	Abort() error
+}
+
+// Blob is a Storage in an object store bucket. Files are streamed by parts
+// of partSize, a file smaller than one part is sent with a single put.
+type Blob struct {
+	name     string
+	backend  BlobBackend
+	partSize int
+}
+
+func NewBlob(name string, backend BlobBackend, partSize int) *Blob {
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	return &Blob{name: name, backend: backend, partSize: partSize}
+}
+
+type blobWriter struct {
+	blob   *Blob
+	key    string
+	buf    []byte
+	upload BlobUpload
+	part   uint32
+	err    error
+	closed bool
+}
+
+func (b *Blob) Create(key string) (Writer, error) {
+	return &blobWriter{blob: b, key: key, buf: make([]byte, 0, b.partSize)}, nil
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, errors.New("write on closed upload")
+	}
+	total := len(p)
+	for len(p) > 0 {
+		// a full part is sent only when more data comes, so that the
+		// last part is flagged
+		if len(w.buf) == w.blob.partSize {
+			if err := w.flush(false); err != nil {
+				return total - len(p), err
+			}
+		}
+		n := copy(w.buf[len(w.buf):w.blob.partSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (w *blobWriter) flush(last bool) error {
+	if w.upload == nil {
+		w.upload, w.err = w.blob.backend.MultipartBegin(w.key)
+		if w.err != nil {
+			return w.err
+		}
+	}
+	w.part++
+	w.err = w.upload.Add(w.part, bytes.NewReader(w.buf), int64(len(w.buf)), last)
+	w.buf = w.buf[:0]
+	if w.err != nil {
+		w.upload.Abort()
+	}
+	return w.err
+}
+
+func (w *blobWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if w.upload == nil {
+		w.err = w.blob.backend.Put(w.key, bytes.NewReader(w.buf), int64(len(w.buf)))
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	if w.err = w.upload.Commit(); w.err != nil {
+		w.upload.Abort()
+	}
+	return w.err
+}
+
+func (w *blobWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.upload != nil && w.err == nil {
+		return w.upload.Abort()
+	}
+	return nil
+}
+
+func (b *Blob) Open(key string) (io.ReadCloser, error) {
+	return b.backend.Get(key)
+}
+
+func (b *Blob) Stat(key string) (*Object, error) {
+	return b.backend.Head(key)
+}
+
+func (b *Blob) List(prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		page, next, err := b.backend.List(prefix, token)
+		if err != nil {
+			return objects, err
+		}
+		objects = append(objects, page...)
+		if next == "" {
+			return objects, nil
+		}
+		token = next
+	}
+}
+
+// Rename copy then delete, object stores have no rename
+func (b *Blob) Rename(from string, to string) error {
+	if err := b.backend.Copy(from, to); err != nil {
+		return err
+	}
+	return b.backend.Delete(from)
+}
+
+func (b *Blob) Remove(key string) error {
+	return b.backend.Delete(key)
+}
+
+func (b *Blob) String() string {
+	return b.name
+}
@@ -0,0 +1,164 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package storage is where backups, binlog archives and crash files are
+// copied out of the monitor host, a directory or an object store bucket.
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Storage store files under slash separated keys. Errors on missing keys
+// satisfy os.IsNotExist.
+type Storage interface {
+	Create(key string) (Writer, error)
+	Open(key string) (io.ReadCloser, error)
+	Stat(key string) (*Object, error)
+	List(prefix string) ([]Object, error)
+	Rename(from string, to string) error
+	Remove(key string) error
+	String() string
+}
+
+// Writer is the content of a new key, visible once closed without error.
+// Abort drop what was written.
+type Writer interface {
+	io.WriteCloser
+	Abort() error
+}
+
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Upload copy a local file to key
+func Upload(s Storage, path string, key string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := s.Create(key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// Local is a Storage in a directory, a mounted network filesystem or a
+// second disk
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{root: strings.TrimSuffix(root, "/")}, nil
+}
+
+func (l *Local) path(key string) string {
+	return l.root + "/" + strings.TrimPrefix(filepath.Clean("/"+key), "/")
+}
+
+type localWriter struct {
+	*os.File
+	path string
+}
+
+// Create write to a temporary file renamed to the key on Close
+func (l *Local) Create(key string) (Writer, error) {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{File: f, path: path}, nil
+}
+
+func (w *localWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	return os.Rename(w.Name(), w.path)
+}
+
+func (w *localWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.Name())
+}
+
+func (l *Local) Open(key string) (io.ReadCloser, error) {
+	return os.Open(l.path(key))
+}
+
+func (l *Local) Stat(key string) (*Object, error) {
+	fi, err := os.Stat(l.path(key))
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// List return the files with keys starting by prefix, sorted by key
+func (l *Local) List(prefix string) ([]Object, error) {
+	var objects []Object
+	dir := l.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = l.path(prefix[:i])
+	}
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+		key := strings.TrimPrefix(path, l.root+"/")
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, Object{Key: key, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, err
+}
+
+func (l *Local) Rename(from string, to string) error {
+	if err := os.MkdirAll(filepath.Dir(l.path(to)), 0755); err != nil {
+		return err
+	}
+	return os.Rename(l.path(from), l.path(to))
+}
+
+func (l *Local) Remove(key string) error {
+	return os.Remove(l.path(key))
+}
+
+func (l *Local) String() string {
+	return "file://" + l.root
+}
@@ -0,0 +1,229 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryBackend stand for a MinIO bucket, parts but the last must have the
+// minimum part size like on S3
+type memoryBackend struct {
+	sync.Mutex
+	minPart int64
+	objects map[string][]byte
+	uploads int
+}
+
+type memoryUpload struct {
+	b     *memoryBackend
+	key   string
+	parts [][]byte
+	last  bool
+}
+
+func (m *memoryBackend) Put(key string, body io.ReadSeeker, size int64) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("put %s: %d bytes for size %d", key, len(data), size)
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memoryBackend) Get(key string) (io.ReadCloser, error) {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memoryBackend) Head(key string) (*Object, error) {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &Object{Key: key, Size: int64(len(data)), ModTime: time.Now()}, nil
+}
+
+func (m *memoryBackend) List(prefix string, token string) ([]Object, string, error) {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) && k > token {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	next := ""
+	if len(keys) > 2 {
+		keys = keys[:2]
+		next = keys[1]
+	}
+	var objects []Object
+	for _, k := range keys {
+		objects = append(objects, Object{Key: k, Size: int64(len(m.objects[k]))})
+	}
+	return objects, next, nil
+}
+
+func (m *memoryBackend) Copy(from string, to string) error {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.objects[from]
+	if !ok {
+		return os.ErrNotExist
+	}
+	m.objects[to] = data
+	return nil
+}
+
+func (m *memoryBackend) Delete(key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryBackend) MultipartBegin(key string) (BlobUpload, error) {
+	m.Lock()
+	m.uploads++
+	m.Unlock()
+	return &memoryUpload{b: m, key: key}, nil
+}
+
+func (u *memoryUpload) Add(part uint32, body io.ReadSeeker, size int64, last bool) error {
+	if int(part) != len(u.parts)+1 || u.last {
+		return fmt.Errorf("part %d out of order", part)
+	}
+	if !last && size < u.b.minPart {
+		return fmt.Errorf("part %d too small: %d", part, size)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	u.parts = append(u.parts, data)
+	u.last = last
+	return nil
+}
+
+func (u *memoryUpload) Commit() error {
+	if !u.last {
+		return fmt.Errorf("commit %s without last part", u.key)
+	}
+	return u.b.Put(u.key, bytes.NewReader(bytes.Join(u.parts, nil)), int64(len(bytes.Join(u.parts, nil))))
+}
+
+func (u *memoryUpload) Abort() error {
+	u.parts = nil
+	return nil
+}
+
+func testStorage(t *testing.T, s Storage, sizes []int) {
+	for _, size := range sizes {
+		key := fmt.Sprintf("backups/cluster1/db1_3306/dump.%d", size)
+		data := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+		w, err := s.Create(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// odd writes so that parts are cut inside a write
+		for p := data; len(p) > 0; {
+			n := 333
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close %s: %v", key, err)
+		}
+		r, err := s.Open(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := ioutil.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: read %d bytes, wrote %d", key, len(got), len(data))
+		}
+		if o, err := s.Stat(key); err != nil || o.Size != int64(size) {
+			t.Errorf("Stat %s: %v %v", key, o, err)
+		}
+	}
+
+	w, _ := s.Create("backups/cluster1/db1_3306/aborted")
+	w.Write([]byte("partial"))
+	w.Abort()
+	if _, err := s.Stat("backups/cluster1/db1_3306/aborted"); !os.IsNotExist(err) {
+		t.Errorf("Aborted upload should not exist: %v", err)
+	}
+
+	objects, err := s.List("backups/cluster1/")
+	if err != nil || len(objects) != len(sizes) {
+		t.Fatalf("List: %v %v", objects, err)
+	}
+	if err := s.Rename(objects[0].Key, "backups/cluster1/catalog/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(objects[0].Key); !os.IsNotExist(err) {
+		t.Errorf("Renamed key should not exist: %v", err)
+	}
+	if err := s.Remove("backups/cluster1/catalog/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ = s.List("backups/"); len(objects) != len(sizes)-1 {
+		t.Errorf("Unexpected objects after remove %v", objects)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s, []int{0, 100, 5000})
+}
+
+func TestBlobStorage(t *testing.T) {
+	m := &memoryBackend{minPart: 1024, objects: make(map[string][]byte)}
+	s := NewBlob("s3://repman", m, 1024)
+	testStorage(t, s, []int{0, 1000, 1024, 1025, 5000})
+	// single put up to one part
+	if m.uploads != 2 {
+		t.Errorf("Expected 2 multipart uploads, got %d", m.uploads)
+	}
+}
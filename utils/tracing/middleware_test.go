@@ -0,0 +1,88 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	router := mux.NewRouter()
+	router.Use(Middleware("replication-manager"))
+	router.HandleFunc("/api/clusters/{clusterName}/status", func(w http.ResponseWriter, r *http.Request) {
+		if !trace.SpanContextFromContext(r.Context()).IsValid() {
+			t.Error("Expected the request context to carry the span")
+		}
+		w.(http.Flusher).Flush()
+		w.Write([]byte("{}"))
+	})
+	router.HandleFunc("/api/clusters/{clusterName}/settings", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "No valid ACL", http.StatusForbidden)
+	})
+	router.HandleFunc("/api/clusters/{clusterName}/topology", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, parent := otel.Tracer("test").Start(context.Background(), "client")
+	req := httptest.NewRequest("GET", "/api/clusters/c1/status", nil)
+	otel.GetTextMapPropagator().Inject(trace.ContextWithSpan(context.Background(), parent), propagation.HeaderCarrier(req.Header))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if !rec.Flushed {
+		t.Error("Expected the flush to reach the response writer")
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/clusters/c2/settings", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/clusters/c3/topology", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 server spans, got %d", len(spans))
+	}
+	for _, s := range spans {
+		if s.SpanKind() != trace.SpanKindServer {
+			t.Errorf("Expected a server span, got %s", s.SpanKind())
+		}
+	}
+	if spans[0].Name() != "/api/clusters/{clusterName}/status" {
+		t.Errorf("Expected the span to be named after the route template, got %s", spans[0].Name())
+	}
+	if spans[0].Parent().TraceID() != parent.SpanContext().TraceID() || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the span to be a child of the propagated context")
+	}
+	for i, expected := range []int64{http.StatusOK, http.StatusForbidden, http.StatusInternalServerError} {
+		found := false
+		for _, a := range spans[i].Attributes() {
+			if a.Key == "http.status_code" {
+				found = a.Value.AsInt64() == expected
+			}
+		}
+		if !found {
+			t.Errorf("Expected status %d on span %s, got %v", expected, spans[i].Name(), spans[i].Attributes())
+		}
+	}
+	if spans[0].Status().Code == codes.Error || spans[2].Status().Code != codes.Error {
+		t.Errorf("Unexpected span status %v %v", spans[0].Status(), spans[2].Status())
+	}
+}
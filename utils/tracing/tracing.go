@@ -0,0 +1,119 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+const (
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+)
+
+type Options struct {
+	Exporter    string
+	Endpoint    string
+	Protocol    string
+	Insecure    bool
+	File        string
+	SampleRatio float64
+	ServiceName string
+	Version     string
+}
+
+// Init install the global tracer provider, spans are dropped when no exporter
+// is configured. The returned function flush and close the exporter.
+func Init(opts Options) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	closeFile := func() error { return nil }
+
+	switch opts.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = newOTLPExporter(opts)
+	case ExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		closeFile = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %s", opts.Exporter)
+	}
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	// schemaless so that the merge does not depend on the semconv version
+	// of the sdk default resource
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceNameKey.String(opts.ServiceName),
+		semconv.ServiceVersionKey.String(opts.Version),
+	))
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if cerr := closeFile(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+func newOTLPExporter(opts Options) (*otlptrace.Exporter, error) {
+	var client otlptrace.Client
+	switch opts.Protocol {
+	case "", "grpc":
+		copts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			copts = append(copts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(copts...)
+	case "http":
+		copts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			copts = append(copts, otlptracehttp.WithInsecure())
+		}
+		client = otlptracehttp.NewClient(copts...)
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol %s", opts.Protocol)
+	}
+	return otlptrace.New(context.Background(), client)
+}
@@ -0,0 +1,70 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestInitNoExporter(t *testing.T) {
+	shutdown, err := Init(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInitInvalid(t *testing.T) {
+	if _, err := Init(Options{Exporter: "zipkin"}); err == nil {
+		t.Error("Expected an unknown exporter to be refused")
+	}
+	if _, err := Init(Options{Exporter: ExporterOTLP, Protocol: "udp"}); err == nil {
+		t.Error("Expected an unknown otlp protocol to be refused")
+	}
+	if _, err := Init(Options{Exporter: ExporterFile, File: filepath.Join(os.DevNull, "traces.json")}); err == nil {
+		t.Error("Expected an unwritable trace file to be refused")
+	}
+}
+
+func TestInitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "traces.json")
+	shutdown, err := Init(Options{Exporter: ExporterFile, File: filename, SampleRatio: 1, ServiceName: "replication-manager", Version: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "MonitorLoop")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"Name":"MonitorLoop"`, "replication-manager"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in the exported spans, got %s", expected, content)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package xbstream read files out of the xbstream archives written by
+// xtrabackup and mariabackup without extracting the whole backup
+package xbstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var chunkMagic = []byte("XBSTCK01")
+
+const (
+	chunkTypePayload = 'P'
+	chunkTypeSparse  = 'S'
+	chunkTypeEOF     = 'E'
+)
+
+// ReadFiles return the content of the named files found in the stream. The
+// binlog coordinates are written at the end of a backup so the stream is read
+// until every file is complete or the stream ends.
+func ReadFiles(r io.Reader, names ...string) (map[string][]byte, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	files := make(map[string][]byte)
+	header := make([]byte, 10)
+	for len(wanted) > 0 {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		if !bytes.Equal(header[:8], chunkMagic) {
+			return files, errors.New("Invalid xbstream chunk magic")
+		}
+		chunkType := header[9]
+		var pathLen uint32
+		if err := binary.Read(r, binary.LittleEndian, &pathLen); err != nil {
+			return files, err
+		}
+		path := make([]byte, pathLen)
+		if _, err := io.ReadFull(r, path); err != nil {
+			return files, err
+		}
+		name := string(path)
+		if chunkType == chunkTypeEOF {
+			delete(wanted, name)
+			continue
+		}
+		if chunkType != chunkTypePayload && chunkType != chunkTypeSparse {
+			return files, fmt.Errorf("Unknown xbstream chunk type %q", chunkType)
+		}
+		var sparseLen uint32
+		if chunkType == chunkTypeSparse {
+			if err := binary.Read(r, binary.LittleEndian, &sparseLen); err != nil {
+				return files, err
+			}
+		}
+		var payload struct {
+			Len      uint64
+			Offset   uint64
+			Checksum uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &payload); err != nil {
+			return files, err
+		}
+		// sparse map entries are a skip and a length of 4 bytes each
+		if _, err := io.CopyN(io.Discard, r, int64(sparseLen)*8); err != nil {
+			return files, err
+		}
+		if !wanted[name] {
+			if _, err := io.CopyN(io.Discard, r, int64(payload.Len)); err != nil {
+				return files, err
+			}
+			continue
+		}
+		data := make([]byte, payload.Len)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return files, err
+		}
+		content := files[name]
+		if end := payload.Offset + payload.Len; uint64(len(content)) < end {
+			content = append(content, make([]byte, end-uint64(len(content)))...)
+		}
+		copy(content[payload.Offset:], data)
+		files[name] = content
+	}
+	return files, nil
+}
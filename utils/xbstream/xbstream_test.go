@@ -0,0 +1,63 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package xbstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func writeChunk(buf *bytes.Buffer, chunkType byte, path string, offset uint64, data []byte) {
+	buf.Write(chunkMagic)
+	buf.WriteByte(0)
+	buf.WriteByte(chunkType)
+	binary.Write(buf, binary.LittleEndian, uint32(len(path)))
+	buf.WriteString(path)
+	if chunkType == chunkTypeEOF {
+		return
+	}
+	binary.Write(buf, binary.LittleEndian, uint64(len(data)))
+	binary.Write(buf, binary.LittleEndian, offset)
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.Write(data)
+}
+
+func TestReadFiles(t *testing.T) {
+	var buf bytes.Buffer
+	writeChunk(&buf, chunkTypePayload, "ibdata1", 0, make([]byte, 4096))
+	writeChunk(&buf, chunkTypeEOF, "ibdata1", 0, nil)
+	writeChunk(&buf, chunkTypePayload, "xtrabackup_binlog_info", 0, []byte("mysql-bin.000003\t"))
+	writeChunk(&buf, chunkTypePayload, "xtrabackup_binlog_info", 17, []byte("1234\t0-1-100\n"))
+	writeChunk(&buf, chunkTypeEOF, "xtrabackup_binlog_info", 0, nil)
+	writeChunk(&buf, chunkTypePayload, "xtrabackup_info", 0, []byte("end_time = 2021-05-01 12:00:00\n"))
+	writeChunk(&buf, chunkTypeEOF, "xtrabackup_info", 0, nil)
+
+	files, err := ReadFiles(&buf, "xtrabackup_binlog_info", "missing")
+	if err != nil {
+		t.Fatalf("ReadFiles: %s", err)
+	}
+	if got := string(files["xtrabackup_binlog_info"]); got != "mysql-bin.000003\t1234\t0-1-100\n" {
+		t.Errorf("Unexpected binlog info %q", got)
+	}
+	if _, ok := files["ibdata1"]; ok {
+		t.Error("Files not requested should be skipped")
+	}
+	if _, ok := files["missing"]; ok {
+		t.Error("Missing file should not be returned")
+	}
+}
+
+func TestReadFilesInvalid(t *testing.T) {
+	_, err := ReadFiles(bytes.NewBufferString("not a stream"), "xtrabackup_binlog_info")
+	if err == nil {
+		t.Error("Invalid stream should fail")
+	}
+}